@@ -1,7 +1,23 @@
 
 #include "cpp/capi.cpp"
+#include "cpp/goaccessmanager.cpp"
+#include "cpp/goanimation.cpp"
+#include "cpp/godropfilter.cpp"
+#include "cpp/goeventfilter.cpp"
+#include "cpp/goframenotifier.cpp"
+#include "cpp/goimageprovider.cpp"
+#include "cpp/golazymodel.cpp"
+#include "cpp/golistmodel.cpp"
+#include "cpp/gorendertimer.cpp"
+#include "cpp/goscriptwatchdog.cpp"
+#include "cpp/gosignalconnector.cpp"
+#include "cpp/gotablemodel.cpp"
+#include "cpp/goupdateblocker.cpp"
+#include "cpp/gourlinterceptor.cpp"
+#include "cpp/govalidator.cpp"
 #include "cpp/govalue.cpp"
 #include "cpp/govaluetype.cpp"
+#include "cpp/gowindowwatcher.cpp"
 #include "cpp/idletimer.cpp"
 
 #include "cpp/moc_all.cpp"
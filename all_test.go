@@ -1,22 +1,246 @@
 package qml_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/niemeyer/qml"
+	"image"
+	"image/color"
+	"image/png"
 	"io/ioutil"
 	. "launchpad.net/gocheck"
-	"github.com/niemeyer/qml"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
 func Test(t *testing.T) { TestingT(t) }
 
+func TestMain(m *testing.M) {
+	if os.Getenv("QML_TEST_MAIN") != "" {
+		runMainProcess()
+		return
+	}
+	if runtime.GOOS == "darwin" {
+		// The GUI event loop must run in the main thread on Mac OS,
+		// so the tests run in the goroutine started by Main instead.
+		code := 1
+		qml.Main(testInitOptions(), func() {
+			initOnce.Do(func() {})
+			code = m.Run()
+		})
+		os.Exit(code)
+	}
+	os.Exit(m.Run())
+}
+
+// runMainProcess runs in its own process, started by TestMainLoop,
+// as the package may only be initialized once.
+func runMainProcess() {
+	fail := func(format string, args ...interface{}) {
+		fmt.Printf(format+"\n", args...)
+		os.Exit(1)
+	}
+	ran := false
+	qml.Main(&qml.InitOptions{Platform: "offscreen"}, func() {
+		engine := qml.NewEngine(nil)
+		component, err := engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property int value: 42 }")
+		if err != nil {
+			fail("%v", err)
+		}
+		obj := component.Create(nil)
+		if value := obj.Int("value"); value != 42 {
+			fail("value is %d, want 42", value)
+		}
+		obj.Destroy()
+		engine.Destroy()
+		ran = true
+	})
+	if !ran {
+		fail("qml.Main returned without running the function")
+	}
+	fmt.Println("qml.Main returned")
+	os.Exit(0)
+}
+
+// TestExternalLoop runs in its own process, started by TestInitExternal,
+// as the package may only be initialized once.
+func TestExternalLoop(t *testing.T) {
+	if os.Getenv("QML_TEST_EXTERNAL_LOOP") == "" {
+		t.Skip("run by TestInitExternal")
+	}
+	qml.InitExternal(nil)
+
+	engine := qml.NewEngine(nil)
+	component, err := engine.LoadString("file.qml", "import QtQuick 2.0\nRectangle { width: 100; height: 100; property int frame; property int served }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := component.CreateWindow(nil)
+	root := window.Root()
+	window.Show()
+
+	// Other goroutines are served as frames are processed.
+	done := make(chan bool)
+	go func() {
+		for i := 1; i <= 10; i++ {
+			root.Set("served", i)
+		}
+		close(done)
+	}()
+
+	for frame := 1; frame <= 100; frame++ {
+		root.Set("frame", frame)
+		qml.ProcessEventsOnce()
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("goroutine not served after 100 frames")
+	}
+	if frame := root.Int("frame"); frame != 100 {
+		t.Fatalf("frame is %d, want 100", frame)
+	}
+	if served := root.Int("served"); served != 10 {
+		t.Fatalf("served is %d, want 10", served)
+	}
+	window.Destroy()
+	engine.Destroy()
+	qml.ProcessEventsOnce()
+}
+
+// TestLazyInitProcess runs in its own process, started by TestLazyInit,
+// as the package may only be initialized once.
+func TestLazyInitProcess(t *testing.T) {
+	if os.Getenv("QML_TEST_LAZY_INIT") == "" {
+		t.Skip("run by TestLazyInit")
+	}
+	err := qml.RegisterType(&qml.TypeSpec{Location: "GoLazy", Major: 1, Name: "Lazy", New: func() interface{} { return &TestType{} }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = qml.RegisterType(&qml.TypeSpec{Location: "GoLazy", Major: 1, Name: "lazy", New: func() interface{} { return &TestType{} }})
+	if err == nil {
+		t.Fatal("invalid type registered before initialization")
+	}
+
+	// The package is initialized here, and the queued type registered.
+	engine := qml.NewEngine(nil)
+	component, err := engine.LoadString("file.qml", "import GoLazy 1.0\nLazy { intValue: 42 }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := component.Create(nil)
+	if value := obj.Int("intValue"); value != 42 {
+		t.Fatalf("intValue is %d, want 42", value)
+	}
+	if err := qml.InitErr(nil); err == nil || err.Error() != "qml.Init called more than once" {
+		t.Fatalf("InitErr after initialization on first use returned %v", err)
+	}
+	obj.Destroy()
+	engine.Destroy()
+}
+
+// TestProbeOpenGLProcess runs in its own process, started by
+// TestProbeOpenGL, on a platform without OpenGL support.
+func TestProbeOpenGLProcess(t *testing.T) {
+	if os.Getenv("QML_TEST_PROBE_OPENGL") == "" {
+		t.Skip("run by TestProbeOpenGL")
+	}
+	qml.Init(&qml.InitOptions{Platform: "minimal"})
+	if err := qml.ProbeOpenGL(); err == nil {
+		t.Fatal("ProbeOpenGL succeeded on the minimal platform")
+	} else {
+		t.Logf("ProbeOpenGL error: %v", err)
+	}
+}
+
+type PanicType struct{}
+
+func (p *PanicType) Boom() {
+	panic("boom")
+}
+
+// TestGUIPanicProcess runs in its own process, started by
+// TestGUIPanicHandler, as it kills the main GUI loop.
+func TestGUIPanicProcess(t *testing.T) {
+	if os.Getenv("QML_TEST_GUI_PANIC") == "" {
+		t.Skip("run by TestGUIPanicHandler")
+	}
+	type recovered struct {
+		value interface{}
+		stack []byte
+	}
+	handled := make(chan recovered, 1)
+	qml.SetGUIPanicHandler(func(value interface{}, stack []byte) {
+		handled <- recovered{value, stack}
+	})
+	qml.Init(nil)
+
+	// The method is called by QML code in the main GUI loop itself,
+	// rather than on behalf of a goroutine waiting for the outcome.
+	engine := qml.NewEngine(nil)
+	engine.Context().SetVar("value", &PanicType{})
+	component, err := engine.LoadString("file.qml", "import QtQuick 2.0\nTimer { interval: 1; running: true; onTriggered: value.boom() }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	component.Create(nil)
+
+	select {
+	case r := <-handled:
+		if r.value != "boom" {
+			t.Fatalf("handler got %#v, want \"boom\"", r.value)
+		}
+		if !strings.Contains(string(r.stack), "PanicType).Boom") {
+			t.Fatalf("handler got stack without the panicking method:\n%s", r.stack)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("panic handler not called")
+	}
+
+	// Package functions that depend on the loop fail rather than block.
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		engine.Context().Var("value")
+	}()
+	select {
+	case p := <-done:
+		gp, ok := p.(*qml.GUIPanic)
+		if !ok || gp.Recovered != "boom" || len(gp.Stack) == 0 {
+			t.Fatalf("call after the loop died panicked with %#v, want *qml.GUIPanic", p)
+		}
+		if gp.Error() != "qml: main GUI loop died after a panic: boom" {
+			t.Fatalf("unexpected *qml.GUIPanic message: %s", gp.Error())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("call after the loop died blocked")
+	}
+}
+
 type S struct {
 	engine  *qml.Engine
 	context *qml.Context
@@ -25,7 +249,99 @@ type S struct {
 var _ = Suite(&S{})
 
 func (s *S) SetUpSuite(c *C) {
-	qml.Init(nil)
+	initTests()
+}
+
+var initOnce sync.Once
+
+// initTests initializes the package once, for both the suite and the
+// fuzz targets, which may run on their own. Tests run offscreen when no
+// display is available.
+func initTests() {
+	initOnce.Do(func() {
+		options := testInitOptions()
+		if err := qml.InitErr(options); err != nil {
+			options.Platform = "offscreen"
+			qml.Init(options)
+		}
+	})
+}
+
+// testInitOptions returns the options the package is initialized with
+// for the suite, either by initTests or by TestMain.
+func testInitOptions() *qml.InitOptions {
+	return &qml.InitOptions{
+		ApplicationName:  "qmltest",
+		OrganizationName: "qmlorg",
+		Args:             []string{"qml.test", "-widgetcount", "extra"},
+	}
+}
+
+func (s *S) TestMainLoop(c *C) {
+	c.Assert(func() { qml.Main(nil, func() {}) }, PanicMatches, "qml.Main must be called from the main goroutine")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "QML_TEST_MAIN=1")
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Assert(string(output), Matches, "(?s).*qml.Main returned\n.*")
+}
+
+func (s *S) TestInitErr(c *C) {
+	err := qml.InitErr(&qml.InitOptions{Platform: "offscreen"})
+	c.Assert(err, ErrorMatches, "qml.Init called more than once")
+	c.Assert(func() { qml.Init(nil) }, Panics, "qml.Init called more than once")
+
+	// Windows are shown and rendered whatever the platform in use.
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+	component, err := engine.LoadString("file.qml", "import QtQuick 2.0\nRectangle { width: 30; height: 20; color: '#ff0000' }")
+	c.Assert(err, IsNil)
+	win := component.CreateWindow(nil)
+	defer win.Destroy()
+	win.Show()
+	img, err := win.Snapshot()
+	c.Assert(err, IsNil)
+	c.Assert(img.Bounds().Dx(), Equals, 30)
+	c.Assert(img.Bounds().Dy(), Equals, 20)
+}
+
+func (s *S) TestGUIPanicPropagation(c *C) {
+	// A panic in a function run by the main GUI thread on behalf of
+	// another goroutine reaches that goroutine, and the loop survives.
+	c.Assert(func() { qml.GUI(func() { panic("boom") }) }, PanicMatches, "boom")
+	c.Assert(func() {
+		qml.GUI(func() {
+			qml.GUI(func() { panic("nested boom") })
+		})
+	}, PanicMatches, "nested boom")
+
+	ran := false
+	qml.GUI(func() { ran = true })
+	c.Assert(ran, Equals, true)
+	c.Assert(s.context.Var("missing"), IsNil)
+}
+
+func (s *S) TestGUIPanicHandler(c *C) {
+	if runtime.GOOS == "darwin" {
+		c.Skip("the main GUI loop must run in the main thread on Mac OS")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestGUIPanicProcess", "-test.v")
+	cmd.Env = append(os.Environ(), "QML_TEST_GUI_PANIC=1", "QT_QPA_PLATFORM=offscreen")
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Assert(string(output), Matches, "(?s).*--- PASS: TestGUIPanicProcess.*")
+}
+
+func (s *S) TestInitOptions(c *C) {
+	c.Assert(qml.Args(), DeepEquals, []string{"extra"})
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nQtObject { property string name: Qt.application.name; property string org: Qt.application.organization }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.String("name"), Equals, "qmltest")
+	c.Assert(obj.String("org"), Equals, "qmlorg")
 }
 
 func (s *S) SetUpTest(c *C) {
@@ -34,11 +350,11 @@ func (s *S) SetUpTest(c *C) {
 	qml.ResetStats()
 
 	stats := qml.Stats()
-	if stats.EnginesAlive > 0 || stats.ValuesAlive > 0 {
+	if stats.EnginesAlive > 0 || stats.ValuesAlive > 0 || stats.ObjectsAlive > 0 {
 		panic(fmt.Sprintf("Test started with values alive: %#v\n", stats))
 	}
 
-	s.engine = qml.NewEngine()
+	s.engine = qml.NewEngine(nil)
 	s.context = s.engine.Context()
 }
 
@@ -54,7 +370,7 @@ func (s *S) TearDownTest(c *C) {
 		// these objects from being deleted.
 		runtime.GC()
 		stats := qml.Stats()
-		if stats.EnginesAlive == 0 && stats.ValuesAlive == 0 {
+		if stats.EnginesAlive == 0 && stats.ValuesAlive == 0 && stats.ObjectsAlive == 0 {
 			break
 		}
 		if retries == 0 {
@@ -95,6 +411,10 @@ func (ts *TestType) Mod(dividend, divisor int32) (int32, error) {
 	return dividend % divisor, nil
 }
 
+func (ts *TestType) JoinStrings(sep string, parts ...string) string {
+	return strings.Join(parts, sep)
+}
+
 func (ts *TestType) ChangeString(new string) (old string) {
 	old = ts.StringValue
 	ts.StringValue = new
@@ -121,12 +441,143 @@ func intNN(i int) interface{} {
 	return int32(i)
 }
 
+func (s *S) TestInitExternal(c *C) {
+	c.Assert(func() { qml.InitExternal(nil) }, PanicMatches, "qml.InitExternal called after the qml package was initialized")
+	c.Assert(func() { qml.ProcessEventsOnce() }, PanicMatches, "qml.ProcessEventsOnce called without qml.InitExternal")
+
+	if runtime.GOOS == "darwin" {
+		c.Skip("the external loop must run in the main thread on Mac OS")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestExternalLoop", "-test.v")
+	cmd.Env = append(os.Environ(), "QML_TEST_EXTERNAL_LOOP=1")
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Assert(string(output), Matches, "(?s).*--- PASS: TestExternalLoop.*")
+}
+
+func (s *S) TestLazyInit(c *C) {
+	if runtime.GOOS == "darwin" {
+		c.Skip("the package is not initialized on first use on Mac OS")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestLazyInitProcess", "-test.v")
+	cmd.Env = append(os.Environ(), "QML_TEST_LAZY_INIT=1", "QT_QPA_PLATFORM=offscreen")
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Assert(string(output), Matches, "(?s).*--- PASS: TestLazyInitProcess.*")
+}
+
+func (s *S) TestProbeOpenGL(c *C) {
+	// The outcome depends on the drivers available, but probing has
+	// no lasting effects, so it's the same when repeated.
+	err := qml.ProbeOpenGL()
+	if err != nil {
+		c.Assert(err, ErrorMatches, "cannot (create offscreen surface for OpenGL probing|create OpenGL context|make OpenGL context current)")
+		c.Assert(qml.ProbeOpenGL(), ErrorMatches, regexp.QuoteMeta(err.Error()))
+	} else {
+		c.Assert(qml.ProbeOpenGL(), IsNil)
+	}
+
+	if runtime.GOOS == "darwin" {
+		c.Skip("the package may only be initialized via Main on Mac OS")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestProbeOpenGLProcess", "-test.v")
+	cmd.Env = append(os.Environ(), "QML_TEST_PROBE_OPENGL=1")
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Assert(string(output), Matches, "(?s).*ProbeOpenGL error: cannot .*--- PASS: TestProbeOpenGLProcess.*")
+}
+
 func (s *S) TestEngineDestroyedUse(c *C) {
 	s.engine.Destroy()
 	s.engine.Destroy()
 	c.Assert(s.engine.Context, PanicMatches, "engine already destroyed")
 }
 
+type TestTree struct {
+	Name        string
+	Left, Right *TestTree
+}
+
+func newTestTree(depth int) *TestTree {
+	if depth == 0 {
+		return nil
+	}
+	return &TestTree{
+		Name:  fmt.Sprintf("node-%d", depth),
+		Left:  newTestTree(depth - 1),
+		Right: newTestTree(depth - 1),
+	}
+}
+
+func (s *S) TestEnginePreload(c *C) {
+	tree := newTestTree(10)
+	stats := qml.Stats()
+	trips := qml.GUIRoundTrips()
+	s.engine.Preload(tree)
+	c.Assert(qml.GUIRoundTrips(), Equals, trips+1)
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1023)
+
+	// Preloading again must reuse the existing values.
+	s.engine.Preload(tree, tree.Left)
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1023)
+
+	s.context.SetVar("tree", tree)
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1023)
+	c.Assert(qml.Stats().ValuesCreated, Equals, stats.ValuesCreated+1023)
+}
+
+type TestForest struct {
+	Trees  []*TestTree
+	Named  map[string]*TestTree
+	Nested [][]interface{}
+	Bytes  []byte
+}
+
+func (s *S) TestEnginePreloadContainers(c *C) {
+	forest := &TestForest{
+		Trees:  []*TestTree{newTestTree(2), nil, newTestTree(2)},
+		Named:  map[string]*TestTree{"a": newTestTree(3), "b": nil},
+		Nested: [][]interface{}{{newTestTree(1), "text"}, {}},
+		Bytes:  make([]byte, 1<<20),
+	}
+	stats := qml.Stats()
+	s.engine.Preload(forest)
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1+3+3+7+1)
+}
+
+func (s *S) BenchmarkEnginePreload(c *C) {
+	trips := 0
+	for i := 0; i < c.N; i++ {
+		engine := qml.NewEngine(nil)
+		before := qml.GUIRoundTrips()
+		engine.Preload(newTestTree(10))
+		trips += qml.GUIRoundTrips() - before
+		engine.Destroy()
+	}
+	// The whole graph is prepared in a single trip to the GUI thread.
+	c.Assert(trips, Equals, c.N)
+}
+
+func (s *S) TestWarmUp(c *C) {
+	c.Assert(qml.WarmUp("QtQuick 2.0"), IsNil)
+	c.Assert(qml.WarmUp("QtQuick.Nonexistent 1.0"), ErrorMatches, "(?s).*module \"QtQuick.Nonexistent\" is not installed.*")
+}
+
+// BenchmarkNewEngineControls measures the work every engine still does
+// for its imports once WarmUp loaded the plugins they need.
+func (s *S) BenchmarkNewEngineControls(c *C) {
+	c.Assert(qml.WarmUp("QtQuick.Controls 1.0"), IsNil)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		for j := 0; j < 5; j++ {
+			engine := qml.NewEngine(nil)
+			_, err := engine.LoadString("file.qml", "import QtQuick 2.0\nimport QtQuick.Controls 1.0\nButton {}")
+			c.Assert(err, IsNil)
+			engine.Destroy()
+		}
+	}
+}
+
 var same = "<same>"
 
 var getSetTests = []struct{ set, get interface{} }{
@@ -143,6 +594,10 @@ var getSetTests = []struct{ set, get interface{} }{
 }
 
 func (s *S) TestContextGetSet(c *C) {
+	s.checkContextGetSet(c)
+}
+
+func (s *S) checkContextGetSet(c *C) {
 	for i, t := range getSetTests {
 		want := t.get
 		if t.get == same {
@@ -154,10 +609,198 @@ func (s *S) TestContextGetSet(c *C) {
 	}
 }
 
+// TestConcurrentUse is most useful with the race detector enabled,
+// as in "go test -race".
+func (s *S) TestConcurrentUse(c *C) {
+	const workers = 8
+	const rounds = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				value := &TestType{IntValue: i*rounds + j}
+				ctx := s.context.Spawn()
+				ctx.SetVar("value", value)
+				component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property int n: value.intValue }")
+				if !c.Check(err, IsNil) {
+					return
+				}
+				obj := component.Create(ctx)
+				c.Check(obj.Int("n"), Equals, i*rounds+j)
+				obj.Destroy()
+				component.Destroy()
+				ctx.Destroy()
+			}
+		}(i)
+	}
+
+	// Engines are created and destroyed meanwhile too.
+	for j := 0; j < rounds; j++ {
+		engine := qml.NewEngine(nil)
+		engine.Context().SetVar("value", &TestType{})
+		engine.Destroy()
+	}
+	wg.Wait()
+}
+
 func (s *S) TestContextGetMissing(c *C) {
 	c.Assert(s.context.Var("missing"), Equals, nil)
 }
 
+func (s *S) TestContextWithOverrides(c *C) {
+	s.context.SetVar("clock", "<real clock>")
+	s.context.SetVar("network", "<real network>")
+	s.context.SetVar("user", "<user>")
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var seenClock: typeof(clock) == "undefined" || clock === null ? "<none>" : clock
+			property var seenNetwork: network.stringValue
+			property string seenUser: user
+		}
+	`)
+	c.Assert(err, IsNil)
+
+	stats := qml.Stats()
+	ctx := s.context.WithOverrides(map[string]interface{}{
+		"clock":   nil,
+		"network": &TestType{StringValue: "<fake network>"},
+	})
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1)
+
+	obj1 := component.Create(ctx)
+	obj2 := component.Create(ctx)
+	c.Assert(obj1.Property("seenClock"), Equals, "<none>")
+	c.Assert(obj1.String("seenNetwork"), Equals, "<fake network>")
+	c.Assert(obj1.String("seenUser"), Equals, "<user>")
+	c.Assert(s.context.Var("clock"), Equals, "<real clock>")
+
+	// The context lives while any object created under it does.
+	obj1.Destroy()
+	for i := 0; i < 10; i++ {
+		c.Assert(obj2.String("seenNetwork"), Equals, "<fake network>")
+		time.Sleep(10 * time.Millisecond)
+	}
+	obj2.Destroy()
+	for i := 0; i < 30 && qml.Stats().ValuesAlive > stats.ValuesAlive; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive)
+	c.Assert(func() { ctx.SetVar("clock", 1) }, PanicMatches, "context already destroyed")
+}
+
+func (s *S) TestContextSpawn(c *C) {
+	value := &TestType{StringValue: "<content>"}
+	s.context.SetVar("value", value)
+	s.context.SetVar("other", "<root>")
+
+	stats := qml.Stats()
+	ctx := s.context.Spawn()
+	ctx.SetVar("other", "<spawned>")
+	ctx.SetVar("spawned", value)
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string s: value.stringValue
+			property string t: spawned.stringValue
+			property string o: other
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(ctx)
+	c.Assert(obj.String("s"), Equals, "<content>")
+	c.Assert(obj.String("t"), Equals, "<content>")
+	c.Assert(obj.String("o"), Equals, "<spawned>")
+	obj.Destroy()
+
+	ctx.Destroy()
+	ctx.Destroy()
+	c.Assert(func() { component.Create(ctx) }, PanicMatches, "context already destroyed")
+	c.Assert(func() { ctx.SetVar("foo", 1) }, PanicMatches, "context already destroyed")
+	c.Assert(s.context.Destroy, PanicMatches, "cannot destroy the root context of an engine")
+
+	// The value held by the spawned context must be released, while
+	// the one held by the root context must remain alive.
+	for i := 0; i < 30 && qml.Stats().ValuesAlive > stats.ValuesAlive; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive)
+	c.Assert(s.context.Var("value"), Equals, value)
+}
+
+func (s *S) TestContextSpawnNestedDestroy(c *C) {
+	parent := s.context.Spawn()
+	child := parent.Spawn()
+	grandchild := child.WithOverrides(map[string]interface{}{"foo": 1})
+	sibling := parent.Spawn()
+	sibling.Destroy()
+
+	parent.Destroy()
+
+	// Qt deletes the spawned contexts along with their parent.
+	c.Assert(func() { child.SetVar("foo", 1) }, PanicMatches, "context already destroyed")
+	c.Assert(func() { grandchild.Var("foo") }, PanicMatches, "context already destroyed")
+	c.Assert(func() { child.Spawn() }, PanicMatches, "context already destroyed")
+	child.Destroy()
+	grandchild.Destroy()
+}
+
+type SwapDataset struct {
+	Items []string
+}
+
+func (s *S) TestContextSwapVar(c *C) {
+	stats := qml.Stats()
+	s.context.SwapVar("dataset", &SwapDataset{Items: []string{"a", "b", "c"}})
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		ListView {
+			property var counts: []
+			width: 100; height: 100
+			model: dataset.items
+			delegate: Item { width: 10; height: 10 }
+			onCountChanged: counts.push(count)
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	c.Assert(obj.Int("count"), Equals, 3)
+
+	for i := 4; i < 8; i++ {
+		items := make([]string, i)
+		for j := range items {
+			items[j] = strconv.Itoa(j)
+		}
+		s.context.SwapVar("dataset", &SwapDataset{Items: items})
+		c.Assert(obj.Int("count"), Equals, i)
+	}
+	counts := obj.Property("counts").([]interface{})
+	c.Assert(counts, Not(HasLen), 0)
+	for _, count := range counts {
+		c.Assert(fmt.Sprint(count), Not(Equals), "0")
+	}
+	obj.Destroy()
+
+	// Only the last value swapped in remains alive.
+	for i := 0; i < 30 && qml.Stats().ValuesAlive > stats.ValuesAlive+1; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive+1)
+
+	s.context.SwapVar("dataset", nil)
+	for i := 0; i < 30 && qml.Stats().ValuesAlive > stats.ValuesAlive; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(qml.Stats().ValuesAlive, Equals, stats.ValuesAlive)
+}
+
 func (s *S) TestContextSetVars(c *C) {
 	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 42 }")
 	c.Assert(err, IsNil)
@@ -188,28 +831,6068 @@ func (s *S) TestContextSetVars(c *C) {
 	vars.AnyValue = 42
 	c.Assert(s.context.Var("anyValue"), Equals, intNN(42))
 
-	c.Assert(s.context.Var("objectValue").(*qml.Object).Int("width"), Equals, 42)
+	c.Assert(s.context.Var("objectValue").(*qml.Object).Int("width"), Equals, 42)
+}
+
+func (s *S) TestComponentSetDataError(c *C) {
+	_, err := s.engine.LoadString("file.qml", "Item{}")
+	c.Assert(err, ErrorMatches, "file:.*/file.qml:1 Item is not a type")
+}
+
+func (s *S) TestEngineLoadFirst(c *C) {
+	dir := c.MkDir()
+	broken := dir + "/broken.qml"
+	good := dir + "/good.qml"
+	err := ioutil.WriteFile(broken, []byte("Item{}"), 0644)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(good, []byte("import QtQuick 2.0\nItem { width: 42 }"), 0644)
+	c.Assert(err, IsNil)
+
+	component, location, err := s.engine.LoadFirst(dir+"/missing.qml", broken, good)
+	c.Assert(err, IsNil)
+	c.Assert(location, Equals, good)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Int("width"), Equals, 42)
+
+	_, _, err = s.engine.LoadFirst(dir+"/missing.qml", broken)
+	c.Assert(err, ErrorMatches, "(?s)cannot load from any location:\n.*/missing.qml: .*\n.*/broken.qml: .*Item is not a type")
+}
+
+func (s *S) TestLoader(c *C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(dir+"/panel.qml", []byte("import QtQuick 2.0\nItem { property int value: 1; property int double: value * 2 }"), 0644)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(dir+"/broken.qml", []byte("import QtQuick 2.0\nItem {\n\tfoo: 1\n}"), 0644)
+	c.Assert(err, IsNil)
+
+	component, err := s.engine.LoadString(dir+"/main.qml", "import QtQuick 2.0\nItem { Loader { objectName: 'loader' } }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	_, err = qml.NewLoader(obj)
+	c.Assert(err, ErrorMatches, "cannot use object of class QQuickItem as a Loader")
+
+	loader, err := qml.NewLoader(obj.ObjectByName("loader"))
+	c.Assert(err, IsNil)
+	c.Assert(loader.Status(), Equals, qml.StatusNull)
+	c.Assert(loader.Item(), IsNil)
+
+	changes := make(chan error, 10)
+	loader.OnStatusChanged(func(status qml.Status, err error) {
+		c.Check(status == qml.StatusError, Equals, err != nil)
+		changes <- err
+	})
+
+	err = loader.SetSource("panel.qml", map[string]interface{}{"value": 21})
+	c.Assert(err, IsNil)
+	c.Assert(loader.Status(), Equals, qml.StatusReady)
+	c.Assert(loader.Item().Int("double"), Equals, 42)
+	c.Assert(<-changes, IsNil)
+
+	err = loader.SetSource("broken.qml", nil)
+	c.Assert(err, ErrorMatches, `.*/broken.qml:3:\d+: .*"foo".*`)
+	errs, ok := err.(qml.ComponentErrors)
+	c.Assert(ok, Equals, true)
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0].Line, Equals, 3)
+	c.Assert(loader.Status(), Equals, qml.StatusError)
+	c.Assert(loader.Item(), IsNil)
+	// The item is dropped before the error is reported.
+	for err = range changes {
+		if err != nil {
+			break
+		}
+	}
+	c.Assert(err, ErrorMatches, `.*/broken.qml:3:\d+: .*`)
+}
+
+func (s *S) TestWaitReady(c *C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(dir+"/panel.qml", []byte("import QtQuick 2.0\nItem { Image { objectName: 'broken'; asynchronous: true; source: 'missing.png' } }"), 0644)
+	c.Assert(err, IsNil)
+
+	component, err := s.engine.LoadString(dir+"/main.qml", "import QtQuick 2.0\nItem { Loader { asynchronous: true; source: 'panel.qml' } }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err = obj.WaitReady(ctx)
+	c.Assert(err, ErrorMatches, `QQuickImage "broken" failed to load .*/missing.png`)
+	failures, ok := err.(qml.LoadFailures)
+	c.Assert(ok, Equals, true)
+	c.Assert(failures, HasLen, 1)
+	c.Assert(failures[0].Class, Equals, "QQuickImage")
+
+	component, err = s.engine.LoadString("ready.qml", "import QtQuick 2.0\nItem { Rectangle {} }")
+	c.Assert(err, IsNil)
+	ready := component.Create(nil)
+	defer ready.Destroy()
+	c.Assert(ready.WaitReady(context.Background()), IsNil)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	component, err = s.engine.LoadString(dir+"/main.qml", "import QtQuick 2.0\nItem { Loader { asynchronous: true; source: 'panel.qml' } }")
+	c.Assert(err, IsNil)
+	pending := component.Create(nil)
+	defer pending.Destroy()
+	c.Assert(pending.WaitReady(ctx), Equals, context.Canceled)
+}
+
+func (s *S) TestRenderFile(c *C) {
+	dir := c.MkDir()
+	good := dir + "/good.qml"
+	err := ioutil.WriteFile(good, []byte("import QtQuick 2.0\nRectangle { width: 100; height: 100; color: fill }"), 0644)
+	c.Assert(err, IsNil)
+
+	img, err := qml.RenderFile(good, qml.RenderOptions{
+		Width:  20,
+		Height: 10,
+		Scale:  2,
+		Vars:   map[string]interface{}{"fill": "#00ff00"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(img.Bounds(), Equals, image.Rect(0, 0, 40, 20))
+	c.Assert(color.NRGBAModel.Convert(img.At(39, 19)), Equals, color.NRGBA{0, 255, 0, 255})
+
+	broken := dir + "/broken.qml"
+	err = ioutil.WriteFile(broken, []byte("Item{}"), 0644)
+	c.Assert(err, IsNil)
+	_, err = qml.RenderFile(broken, qml.RenderOptions{})
+	c.Assert(err, ErrorMatches, "cannot render .*/broken.qml: .*Item is not a type")
+
+	missing := dir + "/missing.qml"
+	err = ioutil.WriteFile(missing, []byte("import QtQuick 2.0\nImage { source: 'missing.png' }"), 0644)
+	c.Assert(err, IsNil)
+	_, err = qml.RenderFile(missing, qml.RenderOptions{Timeout: 3 * time.Second})
+	c.Assert(err, ErrorMatches, "cannot render .*/missing.qml: 1 images or fonts failed to load")
+}
+
+func (s *S) TestEngineOptions(c *C) {
+	engine := qml.NewEngine(&qml.EngineOptions{AllowNetwork: true})
+	defer engine.Destroy()
+
+	_, err := engine.LoadString("file.qml", "import QtQuick 2.0\nimport Qt.labs.folderlistmodel 2.0\nimport QtQuick.LocalStorage 2.0\nItem {}")
+	c.Assert(err, ErrorMatches, `engine options deny imported modules: Qt.labs.folderlistmodel \(local files\), QtQuick.LocalStorage \(local files\)`)
+
+	dir := c.MkDir()
+	err = ioutil.WriteFile(dir+"/data.txt", []byte("secret"), 0644)
+	c.Assert(err, IsNil)
+
+	component, err := engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string result: "none"
+			function load(url) {
+				var xhr = new XMLHttpRequest()
+				xhr.onreadystatechange = function() {
+					if (xhr.readyState == XMLHttpRequest.DONE) {
+						result = xhr.responseText
+					}
+				}
+				xhr.open("GET", url)
+				xhr.send()
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	logMark := c.GetTestLog()
+	obj.Call("load", "file://"+dir+"/data.txt")
+	for i := 0; i < 100 && obj.String("result") == "none"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(obj.String("result"), Equals, "")
+	c.Assert(c.GetTestLog()[len(logMark):], Matches, "(?s).*engine options deny access to.*data.txt.*")
+}
+
+func (s *S) TestEngineOptionsOpenUrlExternally(c *C) {
+	data := `
+		import QtQuick 2.0
+		Item { function open(url) { return Qt.openUrlExternally(url) } }
+	`
+	engine := qml.NewEngine(&qml.EngineOptions{AllowLocalFiles: true, AllowNetwork: true})
+	defer engine.Destroy()
+	component, err := engine.LoadString("file.qml", data)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	logMark := c.GetTestLog()
+	c.Assert(obj.Call("open", "unknownscheme:foo"), Equals, false)
+	c.Assert(c.GetTestLog()[len(logMark):], Matches, "(?s).*engine options deny opening unknownscheme:foo externally.*")
+
+	// Engines without options keep the real function, which isn't
+	// called here as it would launch an external application.
+	component, err = s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item { property string source: Qt.openUrlExternally.toString() }
+	`)
+	c.Assert(err, IsNil)
+	other := component.Create(nil)
+	defer other.Destroy()
+	c.Assert(other.String("source"), Matches, `(?s).*\[native code\].*`)
+}
+
+func (s *S) TestComponentCreateError(c *C) {
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem {}")
+	c.Assert(err, IsNil)
+
+	// The context belongs to a different engine.
+	ctx := engine.Context()
+	c.Assert(func() { component.Create(ctx) }, PanicMatches, "cannot create component instance.*")
+	c.Assert(func() { component.CreateWindow(ctx) }, PanicMatches, "cannot create component instance.*")
+
+	// Undefined context variables don't prevent the instance from being
+	// created, even in strict mode, but each use is reported along with
+	// its location.
+	qml.SetStrictMode(true)
+	defer qml.SetStrictMode(false)
+	component, err = s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem {\n    property int n: missing\n}")
+	c.Assert(err, IsNil)
+	logMark := c.GetTestLog()
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(c.GetTestLog()[len(logMark):], Matches, `(?s).*file\.qml:3: ReferenceError: missing is not defined\n.*`)
+	c.Assert(obj.Int("n"), Equals, 0)
+}
+
+func (s *S) TestValidator(c *C) {
+	validator := qml.NewValidator(func(input string, pos int) (qml.ValidationState, string, int) {
+		input = strings.ToLower(input)
+		for _, r := range input {
+			if r < 'a' || r > 'z' {
+				return qml.Invalid, input, pos
+			}
+		}
+		return qml.Acceptable, input, pos
+	})
+	defer validator.Destroy()
+
+	s.context.SetVar("validator", validator)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 100; height: 20
+			TextInput { objectName: "input"; anchors.fill: parent; validator: validator }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	// Key events are only delivered to active windows.
+	input := window.Root().ObjectByName("input")
+	c.Assert(input.ForceFocus(qml.OtherFocusReason), IsNil)
+	if !input.HasFocus() {
+		c.Skip("window cannot be activated to receive key events")
+	}
+
+	// Rejected characters never appear, not even transiently.
+	var seen []string
+	input.ConnectInline("textChanged", func() {
+		seen = append(seen, input.String("text"))
+	})
+	keys := []struct {
+		key       qml.Key
+		modifiers qml.Modifier
+		text      string
+	}{
+		{qml.Key('A'), 0, "a"},
+		{qml.Key('1'), 0, "1"},
+		{qml.Key('B'), qml.ShiftModifier, "B"},
+		{qml.Key('-'), 0, "-"},
+		{qml.Key('C'), 0, "c"},
+	}
+	for _, k := range keys {
+		window.PostKeyEvent(k.key, k.modifiers, k.text)
+	}
+	qml.Settle()
+	c.Assert(input.String("text"), Equals, "abc")
+	c.Assert(input.Int("cursorPosition"), Equals, 3)
+	c.Assert(input.Bool("acceptableInput"), Equals, true)
+	c.Assert(seen, DeepEquals, []string{"a", "ab", "abc"})
+}
+
+type typeInfoSample struct {
+	Name    string
+	private int
+	Count   int
+}
+
+func (ts *typeInfoSample) Greet(name string) string {
+	return "Hello " + name + " from " + ts.Name
+}
+
+const typeInfoSampleSource = `// This file was generated by qml.WriteTypeInfo. Do not edit.
+
+package qml_test
+
+import (
+	"github.com/niemeyer/qml"
+	"unsafe"
+)
+
+func init() {
+	qml.UseTypeInfo((*typeInfoSample)(nil), &qml.TypeInfo{
+		Name: "typeInfoSample",
+		Fields: []qml.TypeField{
+			{"name", 0, unsafe.Offsetof(typeInfoSample{}.Name)},
+			{"count", 2, unsafe.Offsetof(typeInfoSample{}.Count)},
+		},
+		Methods: []qml.TypeMethod{
+			{"greet", 0, "greet(QVariant)", "QVariant", 1, 1, "func(string) string"},
+		},
+	})
+}
+`
+
+// typeInfoSampleInfo is what the generated code in typeInfoSampleSource
+// provides to UseTypeInfo.
+func typeInfoSampleInfo() *qml.TypeInfo {
+	return &qml.TypeInfo{
+		Name: "typeInfoSample",
+		Fields: []qml.TypeField{
+			{"name", 0, unsafe.Offsetof(typeInfoSample{}.Name)},
+			{"count", 2, unsafe.Offsetof(typeInfoSample{}.Count)},
+		},
+		Methods: []qml.TypeMethod{
+			{"greet", 0, "greet(QVariant)", "QVariant", 1, 1, "func(string) string"},
+		},
+	}
+}
+
+func (s *S) TestWriteTypeInfo(c *C) {
+	var buf bytes.Buffer
+	err := qml.WriteTypeInfo(&buf, &typeInfoSample{})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, typeInfoSampleSource)
+
+	err = qml.WriteTypeInfo(&buf, 42)
+	c.Assert(err, ErrorMatches, "cannot generate type information for int: not a named struct type")
+	err = qml.WriteTypeInfo(&buf, &typeInfoSample{}, &bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "cannot generate type information for types in both .*qml_test and bytes")
+	err = qml.WriteTypeInfo(&buf, &EmbeddedType{})
+	c.Assert(err, ErrorMatches, "cannot generate type information for qml_test.EmbeddedType: fields promoted from embedded structs are not supported")
+}
+
+func (s *S) TestUseTypeInfoStale(c *C) {
+	defer qml.ResetTypeInfo((*typeInfoSample)(nil))()
+
+	tweaks := []func(info *qml.TypeInfo){
+		func(info *qml.TypeInfo) { info.Fields = info.Fields[:1] },
+		func(info *qml.TypeInfo) { info.Fields[1].Offset++ },
+		func(info *qml.TypeInfo) { info.Methods[0].Name = "hello" },
+		func(info *qml.TypeInfo) { info.Methods[0].Signature = "greet()" },
+		func(info *qml.TypeInfo) { info.Methods[0].Result = "" },
+		func(info *qml.TypeInfo) { info.Methods[0].NumIn = 2 },
+		func(info *qml.TypeInfo) { info.Methods[0].NumOut = 0 },
+		func(info *qml.TypeInfo) { info.Methods[0].Type = "func(int) string" },
+		func(info *qml.TypeInfo) { info.Methods[0].Type = "func(string) (string, error)" },
+	}
+	for i, tweak := range tweaks {
+		c.Logf("Tweak #%d", i)
+		info := typeInfoSampleInfo()
+		tweak(info)
+		c.Assert(func() { qml.UseTypeInfo((*typeInfoSample)(nil), info) }, PanicMatches, "type information for qml_test.typeInfoSample is out of date; .*")
+	}
+}
+
+func (s *S) TestUseTypeInfo(c *C) {
+	// Values must behave the same whether their member information is
+	// obtained via reflection or was recorded via UseTypeInfo.
+	samples := []interface{}{(*typeInfoSample)(nil), (*TestType)(nil), (*ConversionType)(nil)}
+	for _, recorded := range []bool{false, true} {
+		c.Logf("With recorded type information: %v", recorded)
+		for _, sample := range samples {
+			defer qml.ResetTypeInfo(sample)()
+			if recorded {
+				qml.UseTypeInfo(sample, qml.GeneratedTypeInfo(sample))
+			}
+		}
+		s.checkTypeInfoSample(c)
+		s.checkContextGetSet(c)
+		s.checkConversions(c)
+	}
+	c.Assert(qml.GeneratedTypeInfo((*typeInfoSample)(nil)), DeepEquals, typeInfoSampleInfo())
+}
+
+func (s *S) checkTypeInfoSample(c *C) {
+	sample := &typeInfoSample{Name: "Go", Count: 42}
+	s.context.SetVar("sample", sample)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string name: sample.name
+			property int count: sample.count
+			property string greeting: sample.greet("QML")
+			function setCount(n) { sample.count = n }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.String("name"), Equals, "Go")
+	c.Assert(obj.Int("count"), Equals, 42)
+	c.Assert(obj.String("greeting"), Equals, "Hello QML from Go")
+
+	obj.Call("setCount", 7)
+	c.Assert(sample.Count, Equals, 7)
+
+	sample.Name = "Gopher"
+	qml.Changed(sample, &sample.Name)
+	c.Assert(obj.String("name"), Equals, "Gopher")
+}
+
+type EmbeddedBase struct {
+	ID    int
+	Label string
+}
+
+func (b *EmbeddedBase) Describe() string {
+	return fmt.Sprintf("%d:%s", b.ID, b.Label)
+}
+
+type EmbeddedExtra struct {
+	Note  string
+	Label string
+}
+
+type EmbeddedType struct {
+	EmbeddedBase
+	*EmbeddedExtra
+	Label string
+}
+
+type EmbeddedNamer interface {
+	Describe() string
+}
+
+func (s *S) TestEmbeddedFields(c *C) {
+	value := &EmbeddedType{EmbeddedBase: EmbeddedBase{ID: 1, Label: "base"}, Label: "outer"}
+	var namer EmbeddedNamer = value
+	s.context.SetVar("value", value)
+	s.context.SetVar("namer", &namer)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property int id: value.iD
+			property string label: value.label
+			property var note: value.note
+			property string described: value.describe()
+			property bool same: namer.label == value.label
+			function setNote() { value.note = "noted" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	// The outer Label shadows the ones from the embedded structs.
+	c.Assert(obj.Int("id"), Equals, 1)
+	c.Assert(obj.String("label"), Equals, "outer")
+	c.Assert(obj.String("described"), Equals, "1:base")
+	c.Assert(obj.Bool("same"), Equals, true)
+
+	// Fields of nil embedded pointers are undefined until set.
+	c.Assert(obj.Property("note"), IsNil)
+	obj.Call("setNote")
+	c.Assert(value.EmbeddedExtra, NotNil)
+	c.Assert(value.Note, Equals, "noted")
+}
+
+type SignalType struct {
+	Name       string
+	OnFinished func(code int, message string)
+	Changed    func()
+}
+
+func (s *S) TestFuncFieldSignals(c *C) {
+	changed := 0
+	value := &SignalType{Name: "<name>", Changed: func() { changed++ }}
+	s.context.SetVar("value", value)
+	c.Assert(value.OnFinished, Not(IsNil))
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string result
+			Connections {
+				target: value
+				onFinished: result = value.name + ":" + arguments[0] + ":" + arguments[1]
+			}
+			function finish() { value.finished(2, "qml") }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	value.OnFinished(1, "go")
+	c.Assert(obj.String("result"), Equals, "<name>:1:go")
+
+	obj.Call("finish")
+	c.Assert(obj.String("result"), Equals, "<name>:2:qml")
+
+	// Functions assigned by Go code are left alone.
+	value.Changed()
+	c.Assert(changed, Equals, 1)
+}
+
+func (s *S) TestEmit(c *C) {
+	value := &SignalType{Name: "<name>", Changed: func() {}}
+	s.context.SetVar("value", value)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property int changes
+			property string result
+			signal moved(int x)
+			onMoved: result = "moved:" + x
+			Connections {
+				target: value
+				onChanged: changes++
+				onFinished: result = arguments[0] + ":" + arguments[1]
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	// Emitting works from any goroutine, even for fields set by Go code.
+	done := make(chan bool)
+	go func() {
+		qml.Emit(value, "changed")
+		qml.Emit(value, "finished", 3, "emit")
+		done <- true
+	}()
+	<-done
+	c.Assert(obj.Int("changes"), Equals, 1)
+	c.Assert(obj.String("result"), Equals, "3:emit")
+
+	c.Assert(func() { qml.Emit(value, "missing") }, PanicMatches, `type \*qml_test.SignalType has no signal "missing"`)
+	c.Assert(func() { qml.Emit(value, "finished", 1) }, PanicMatches, `signal "finished" of type \*qml_test.SignalType takes 2 arguments, got 1`)
+
+	obj.Emit("moved", 42)
+	c.Assert(obj.String("result"), Equals, "moved:42")
+	c.Assert(func() { obj.Emit("moved") }, PanicMatches, `cannot emit signal moved\(int\) with 0 arguments`)
+	c.Assert(func() { obj.Emit("missing") }, PanicMatches, `object has no signal "missing"`)
+}
+
+func (s *S) TestFuncFieldSignalsRegisteredType(c *C) {
+	var values []*SignalType
+	err := qml.RegisterType(&qml.TypeSpec{Location: "GoSignalTest", Major: 1, Name: "Signaler", New: func() interface{} {
+		value := &SignalType{}
+		values = append(values, value)
+		return value
+	}})
+	c.Assert(err, IsNil)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoSignalTest 1.0
+		Item {
+			property string result
+			Signaler { id: first; name: "first"; onFinished: result += name + ":" + arguments[0] + ";" }
+			Signaler { id: second; name: "second"; onFinished: result += name + ":" + arguments[0] + ";" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(values, HasLen, 2)
+
+	// Only the objects wrapping the emitting value observe the signal.
+	values[1].OnFinished(1, "go")
+	c.Assert(obj.String("result"), Equals, "second:1;")
+	qml.Emit(values[0], "finished", 2, "emit")
+	c.Assert(obj.String("result"), Equals, "second:1;first:2;")
+}
+
+type TextPoint struct{ X, Y int }
+
+func (p TextPoint) MarshalText() ([]byte, error) {
+	if p.X < 0 {
+		return nil, fmt.Errorf("negative X")
+	}
+	return []byte(fmt.Sprintf("%d,%d", p.X, p.Y)), nil
+}
+
+func (p *TextPoint) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+// MarshalJSON is never used, as MarshalText takes precedence.
+func (p TextPoint) MarshalJSON() ([]byte, error) {
+	return []byte(`"unused"`), nil
+}
+
+type JSONPoint struct{ X, Y int }
+
+func (p JSONPoint) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`[%d, %d]`, p.X, p.Y)), nil
+}
+
+type MarshalType struct {
+	Point TextPoint
+	Last  TextPoint
+}
+
+func (m *MarshalType) Move(p TextPoint) TextPoint {
+	m.Last = p
+	return TextPoint{p.X + 1, p.Y + 1}
+}
+
+func (s *S) TestMarshalers(c *C) {
+	defer qml.SetUseMarshalers(true)()
+
+	value := &MarshalType{Point: TextPoint{1, 2}}
+	s.context.SetVar("value", value)
+	s.context.SetVar("text", TextPoint{3, 4})
+	s.context.SetVar("json", JSONPoint{5, 6})
+
+	c.Assert(s.context.Var("text"), Equals, "3,4")
+	c.Assert(s.context.Var("json"), DeepEquals, []int{5, 6})
+	c.Assert(func() { s.context.SetVar("bad", TextPoint{-1, 0}) }, PanicMatches, "cannot marshal qml_test.TextPoint as text: negative X")
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string point: value.point
+			property string moved: value.move("7,8")
+			Component.onCompleted: value.point = "9,10"
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.String("point"), Equals, "1,2")
+	c.Assert(obj.String("moved"), Equals, "8,9")
+	c.Assert(value.Last, Equals, TextPoint{7, 8})
+	c.Assert(value.Point, Equals, TextPoint{9, 10})
+
+	// Failures are thrown into QML rather than crashing the hooks.
+	component, err = s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			function attempt(f) {
+				try { f(); return "" } catch (e) { return e.message }
+			}
+			function read() { return attempt(function() { return value.point }) }
+			function write() { return attempt(function() { value.point = "bad" }) }
+			function call() { return attempt(function() { value.move("bad") }) }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj = component.Create(nil)
+	defer obj.Destroy()
+
+	value.Point = TextPoint{-1, 0}
+	c.Assert(obj.Call("read"), Equals, "cannot marshal qml_test.TextPoint as text: negative X")
+	c.Assert(obj.Call("write"), Matches, `cannot unmarshal "bad" into qml_test.TextPoint: .*`)
+	c.Assert(value.Point, Equals, TextPoint{-1, 0})
+	c.Assert(obj.Call("call"), Matches, `cannot convert parameter 1 of method: cannot unmarshal "bad" into qml_test.TextPoint: .*`)
+	c.Assert(value.Last, Equals, TextPoint{7, 8})
+}
+
+func (s *S) TestMarshalersDisabled(c *C) {
+	// Without the option, values are exposed as usual.
+	s.context.SetVar("text", TextPoint{3, 4})
+	c.Assert(s.context.Var("text"), Equals, TextPoint{3, 4})
+}
+
+func (s *S) TestMenu(c *C) {
+	menu := qml.NewMenu()
+	defer menu.Destroy()
+
+	for i := 0; i < 2; i++ {
+		menu.AddAction("Open", "", true, func() {})
+		menu.AddSeparator()
+		recent := menu.AddSubmenu("Recent")
+		recent.AddAction("file.qml", "", false, func() {})
+		menu.AddCheckAction("Wrap", true, true, func(checked bool) {})
+		menu.Close()
+		menu.Clear()
+	}
+}
+
+func (s *S) TestTrayIcon(c *C) {
+	tray, err := qml.NewTrayIcon(image.NewNRGBA(image.Rect(0, 0, 16, 16)))
+	if err != nil {
+		// Headless test environments have no system tray.
+		c.Assert(err, Equals, qml.ErrUnsupported)
+		c.Assert(tray, IsNil)
+		return
+	}
+	defer tray.Destroy()
+
+	menu := qml.NewMenu()
+	defer menu.Destroy()
+	menu.AddAction("Quit", "", true, func() {})
+
+	tray.SetIcon(image.NewNRGBA(image.Rect(0, 0, 16, 16)))
+	tray.SetToolTip("Monitor")
+	tray.SetMenu(menu)
+	tray.OnActivated(func(reason qml.TrayActivation) {})
+	tray.Show()
+	if err := tray.ShowMessage("Monitor", "Disk almost full", time.Second); err != nil {
+		c.Assert(err, Equals, qml.ErrUnsupported)
+	}
+	tray.SetIcon(image.NewRGBA(image.Rect(0, 0, 16, 16)))
+	tray.Hide()
+	tray.SetMenu(nil)
+}
+
+func (s *S) TestSetLoggerFunc(c *C) {
+	var mutex sync.Mutex
+	var msgs []qml.LogMessage
+	qml.SetLogger(func(msg qml.LogMessage) {
+		mutex.Lock()
+		msgs = append(msgs, msg)
+		mutex.Unlock()
+	})
+	defer qml.SetLogger(c)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property int value: undefined.foo
+			Component.onCompleted: console.log("hello", 42)
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	c.Assert(msgs, HasLen, 2)
+	c.Assert(msgs[0].Severity(), Equals, qml.LogWarning)
+	c.Assert(msgs[0].Text(), Matches, ".*file.qml:4: TypeError: .*")
+	c.Assert(msgs[1].Severity(), Equals, qml.LogDebug)
+	c.Assert(msgs[1].Text(), Equals, "hello 42")
+	c.Assert(msgs[1].Line(), Equals, 5)
+	c.Assert(filepath.Base(msgs[1].File()), Equals, "file.qml")
+}
+
+func (s *S) TestSaveState(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			objectName: "root"
+			property int page: 2
+			Flickable { objectName: "list"; contentHeight: 1000; contentY: 120 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	saved := make(chan []byte, 1)
+	qml.OnSaveState(func(st *qml.StateSaver) {
+		st.Set("document", "notes.txt")
+		st.Set("broken", func() {})
+		st.Include(obj, "page")
+		st.Include(obj.ObjectByName("list"), "contentY", "missing")
+		data, err := st.Bytes()
+		c.Check(err, ErrorMatches, `cannot include property "missing" of "list": object has no such property; cannot save value "broken": .*`)
+		saved <- data
+	})
+	c.Assert(qml.SaveState(), IsNil)
+	data := <-saved
+
+	obj.Set("page", 5)
+	obj.ObjectByName("list").Set("contentY", 0)
+
+	state, err := qml.RestoreState(data)
+	c.Assert(err, IsNil)
+	var document string
+	ok, err := state.Get("document", &document)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	c.Assert(document, Equals, "notes.txt")
+	ok, err = state.Get("broken", &document)
+	c.Assert(ok, Equals, false)
+
+	c.Assert(state.Apply(obj), IsNil)
+	c.Assert(obj.Int("page"), Equals, 2)
+	c.Assert(obj.ObjectByName("list").Float64("contentY"), Equals, 120.0)
+
+	_, err = qml.RestoreState([]byte("bogus"))
+	c.Assert(err, ErrorMatches, "cannot restore state: .*")
+}
+
+func (s *S) TestStats(c *C) {
+	qml.SetLeakDetection(true)
+	defer qml.SetLeakDetection(false)
+
+	waitStats := func(want qml.Statistics) qml.Statistics {
+		for i := 0; i < 30; i++ {
+			runtime.GC()
+			if qml.Stats() == want {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return qml.Stats()
+	}
+
+	base := qml.Stats()
+	c.Assert(base.EnginesAlive, Equals, 1)
+
+	engine := qml.NewEngine(nil)
+	engine.Context().SetVar("value", &TestType{})
+	component, err := engine.LoadString("file.qml", "import QtQuick 2.0\nItem {}")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	win := component.CreateWindow(nil)
+
+	stats := qml.Stats()
+	c.Assert(stats.EnginesAlive, Equals, base.EnginesAlive+1)
+	c.Assert(stats.ValuesAlive, Equals, base.ValuesAlive+1)
+	c.Assert(stats.ObjectsAlive, Equals, base.ObjectsAlive+2)
+
+	obj.Destroy()
+	want := stats
+	want.ObjectsAlive--
+	c.Assert(waitStats(want), Equals, want)
+
+	win.Destroy()
+	engine.Destroy()
+	want = base
+	want.ValuesCreated = stats.ValuesCreated
+	c.Assert(waitStats(want), Equals, want)
+
+	qml.ResetStats()
+	c.Assert(qml.Stats(), Equals, base)
+}
+
+func (s *S) TestStore(c *C) {
+	store := qml.NewStore()
+	defer store.Destroy()
+	store.Set("page", "home")
+	store.Set("value", &TestType{StringValue: "<content>"})
+
+	var changes []interface{}
+	store.OnChangeInline("page", func(old, new interface{}) {
+		changes = append(changes, old, new)
+	})
+	dispatched := make(chan interface{}, 10)
+	store.OnChange("page", func(old, new interface{}) {
+		dispatched <- new
+	})
+
+	s.context.SetVar("store", store)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var page: store.page
+			property string s: store.value.stringValue
+			function go(page) { store.page = page }
+			function get(key) { return store[key] }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.String("page"), Equals, "home")
+	c.Assert(obj.String("s"), Equals, "<content>")
+	c.Assert(obj.Call("get", "selected"), IsNil)
+
+	// Keys may be created after the store is in use.
+	store.Set("selected", 42)
+	c.Assert(obj.Call("get", "selected"), Equals, int32(42))
+
+	obj.Call("go", "settings")
+	c.Assert(store.Get("page"), Equals, "settings")
+	c.Assert(changes, DeepEquals, []interface{}{"home", "settings"})
+	select {
+	case value := <-dispatched:
+		c.Assert(value, Equals, "settings")
+	case <-time.After(3 * time.Second):
+		c.Fatalf("dispatched subscriber not called")
+	}
+
+	store.Delete("selected")
+	c.Assert(obj.Call("get", "selected"), IsNil)
+	c.Assert(store.Keys(), DeepEquals, []string{"page", "value"})
+
+	store.SetMap(map[string]interface{}{"page": "about", "flag": true})
+	c.Assert(store.Map(), DeepEquals, map[string]interface{}{"page": "about", "flag": true})
+	c.Assert(obj.String("page"), Equals, "about")
+	c.Assert(changes, HasLen, 2)
+}
+
+func (s *S) TestEventBus(c *C) {
+	bus := qml.NewEventBus()
+	defer bus.Destroy()
+
+	s.context.SetVar("bus", bus)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var events: []
+			property var prices: []
+			property var owned: []
+			Connections {
+				target: bus
+				onEvent: events.push(topic)
+			}
+			property Item child: Item {
+				Component.onCompleted: bus.subscribe("prices", function(p) { owned.push(p.price) }, this)
+			}
+			Component.onCompleted: bus.subscribe("prices", function(p) { prices.push(p.price) })
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	bus.Publish("prices", map[string]interface{}{"price": 1})
+	bus.Publish("news", "hello")
+	bus.Publish("prices", map[string]interface{}{"price": 2})
+
+	c.Assert(obj.Property("events"), DeepEquals, []interface{}{"prices", "news", "prices"})
+	c.Assert(obj.Property("prices"), DeepEquals, []interface{}{int32(1), int32(2)})
+	c.Assert(obj.Property("owned"), DeepEquals, []interface{}{int32(1), int32(2)})
+
+	// Subscriptions are dropped with their owner.
+	obj.Object("child").Destroy()
+	bus.Publish("prices", map[string]interface{}{"price": 3})
+	c.Assert(obj.Property("prices"), DeepEquals, []interface{}{int32(1), int32(2), int32(3)})
+	c.Assert(obj.Property("owned"), DeepEquals, []interface{}{int32(1), int32(2)})
+
+	// Events published concurrently are all delivered in order.
+	done := make(chan bool)
+	go func() {
+		for i := 4; i < 10; i++ {
+			bus.Publish("prices", map[string]interface{}{"price": i})
+		}
+		done <- true
+	}()
+	<-done
+	bus.Publish("prices", map[string]interface{}{"price": 10})
+	prices := obj.Property("prices").([]interface{})
+	c.Assert(prices, HasLen, 10)
+	for i, price := range prices {
+		c.Assert(price, Equals, int32(i+1))
+	}
+}
+
+func (s *S) TestLazyModel(c *C) {
+	var offsets []int
+	model := qml.NewLazyModel(
+		func() int { return 1000 },
+		func(offset, limit int) []interface{} {
+			offsets = append(offsets, offset)
+			items := make([]interface{}, limit)
+			for i := range items {
+				items[i] = fmt.Sprintf("item-%d", offset+i)
+			}
+			return items
+		},
+	)
+	defer model.Destroy()
+	model.SetPageSize(20)
+
+	s.context.SetVar("lazyModel", model)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		ListView {
+			width: 100; height: 100
+			model: lazyModel
+			delegate: Text { height: 10; text: modelData }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	view := window.Root()
+	for i := 0; i < 10; i++ {
+		window.PostWheelEvent(50, 50, -360, 0)
+		qml.Settle()
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Assert(len(offsets) > 1, Equals, true)
+	c.Assert(offsets[0], Equals, 0)
+	for i := 1; i < len(offsets); i++ {
+		c.Assert(offsets[i] > offsets[i-1], Equals, true, Commentf("offsets: %v", offsets))
+	}
+	c.Assert(view.Int("count") < 1000, Equals, true)
+}
+
+type ListItem struct {
+	Name  string
+	Count int
+	Notes string `qml:"-"`
+}
+
+func (s *S) TestList(c *C) {
+	list := qml.NewList([]ListItem{{"a", 1, ""}, {"b", 2, ""}})
+	defer list.Destroy()
+
+	s.context.SetVar("list", list)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 100; height: 200
+			property alias count: view.count
+			ListView {
+				id: view
+				anchors.fill: parent
+				model: list
+				delegate: Text { height: 10; text: name + count }
+			}
+			Repeater {
+				id: repeater
+				model: list
+				Item { property string text: name + count }
+			}
+			function texts() {
+				var result = []
+				for (var i = 0; i < repeater.count; i++) {
+					result.push(repeater.itemAt(i).text)
+				}
+				return result.join(",")
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+	view := window.Root()
+
+	c.Assert(view.Int("count"), Equals, 2)
+	c.Assert(view.Call("texts"), Equals, "a1,b2")
+
+	done := make(chan bool)
+	go func() {
+		list.Append(ListItem{"d", 4, ""})
+		list.Insert(2, ListItem{"c", 3, ""})
+		done <- true
+	}()
+	<-done
+	c.Assert(list.Len(), Equals, 4)
+	c.Assert(view.Int("count"), Equals, 4)
+	c.Assert(view.Call("texts"), Equals, "a1,b2,c3,d4")
+
+	list.Set(0, ListItem{"z", 26, ""})
+	list.Remove(1, 2)
+	c.Assert(list.Get(0), Equals, ListItem{"z", 26, ""})
+	c.Assert(list.Len(), Equals, 2)
+	c.Assert(view.Int("count"), Equals, 2)
+	c.Assert(view.Call("texts"), Equals, "z26,d4")
+
+	c.Assert(list.Append("foo"), ErrorMatches, "cannot insert list item 2: cannot use string as an item of a list of qml_test.ListItem")
+	c.Assert(func() { qml.NewList([]int{1}) }, Panics, "cannot create list from []int: not a slice of structs")
+}
+
+type ListSchema struct {
+	Name  string
+	Count int
+	Extra interface{}
+}
+
+func (s *S) TestListModel(c *C) {
+	list := qml.NewListModel(&ListSchema{})
+	defer list.Destroy()
+
+	// The first item has nil and missing fields, which must not affect
+	// the items that follow.
+	c.Assert(list.Append(map[string]interface{}{"name": "a", "extra": nil}), IsNil)
+	c.Assert(list.Append(map[string]interface{}{"name": "b", "count": 2.0, "extra": "x"}), IsNil)
+	c.Assert(list.Append(ListItem{"c", 3, "ignored"}), IsNil)
+	c.Assert(list.Get(0), DeepEquals, &ListSchema{Name: "a"})
+	c.Assert(list.Get(1), DeepEquals, &ListSchema{Name: "b", Count: 2, Extra: "x"})
+	c.Assert(list.Get(2), DeepEquals, &ListSchema{Name: "c", Count: 3})
+
+	s.context.SetVar("list", list)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			Repeater {
+				id: repeater
+				model: list
+				delegate: Item { property string text: name + count }
+			}
+			function texts() {
+				var result = []
+				for (var i = 0; i < repeater.count; i++) {
+					result.push(repeater.itemAt(i).text)
+				}
+				return result.join(",")
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Call("texts"), Equals, "a0,b2,c3")
+
+	err = list.Insert(1, map[string]interface{}{"name": "x"}, map[string]interface{}{"count": "many"})
+	c.Assert(err, ErrorMatches, `cannot insert list item 2: role "count": cannot use value "many" as int`)
+	err = list.Append(map[string]interface{}{"missing": 1})
+	c.Assert(err, ErrorMatches, `cannot insert list item 3: list has no "missing" role`)
+	err = list.Set(0, map[string]interface{}{"name": 42})
+	c.Assert(err, ErrorMatches, `cannot set list item 0: role "name": cannot use value 42 as string`)
+	c.Assert(list.Len(), Equals, 3)
+
+	c.Assert(func() { qml.NewListModel(42) }, Panics, "cannot create list model from int: not a struct")
+}
+
+func (s *S) TestListUpdateFromChannel(c *C) {
+	list := qml.NewList([]ListItem{{"a", 1, ""}})
+	defer list.Destroy()
+
+	s.context.SetVar("list", list)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			Repeater {
+				id: repeater
+				model: list
+				delegate: Item { property string text: name + count }
+			}
+			function texts() {
+				var result = []
+				for (var i = 0; i < repeater.count; i++) {
+					result.push(repeater.itemAt(i).text)
+				}
+				return result.join(",")
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	ops := make(chan qml.ListOp)
+	c.Assert(list.UpdateFromChannel(ops), IsNil)
+	c.Assert(list.UpdateFromChannel(ops), ErrorMatches, "cannot update list from channel: list is already being updated from another channel")
+
+	// Operations are applied in order, whether they arrive one at a
+	// time or queued in bursts that are applied together.
+	want := []ListItem{{"a", 1, ""}}
+	for i := 0; i < 20; i++ {
+		item := ListItem{string('b' + rune(i)), i, ""}
+		ops <- qml.ListInsert{Index: len(want), Value: item}
+		want = append(want, item)
+	}
+	ops <- qml.ListUpdate{Index: 3, Value: map[string]interface{}{"name": "x", "count": 9}}
+	want[3] = ListItem{"x", 9, ""}
+	ops <- qml.ListRemove{Index: 0}
+	ops <- qml.ListRemove{Index: 0}
+	want = want[2:]
+	ops <- qml.ListInsert{Index: 0, Value: ListItem{"z", 0, ""}}
+	want = append([]ListItem{{"z", 0, ""}}, want...)
+	close(ops)
+	list.WaitUpdates()
+	c.Assert(list.Len(), Equals, len(want))
+	c.Assert(list.Get(0), Equals, want[0])
+
+	burst := make(chan qml.ListOp, 100)
+	for i := 0; i < 10; i++ {
+		item := ListItem{"y", i, ""}
+		burst <- qml.ListInsert{Index: i, Value: item}
+		want = append(want[:i], append([]ListItem{item}, want[i:]...)...)
+	}
+	for i := 0; i < 5; i++ {
+		burst <- qml.ListRemove{Index: 10}
+	}
+	want = append(want[:10], want[15:]...)
+	burst <- qml.ListUpdate{Index: 0, Value: ListItem{"w", 1, ""}}
+	burst <- qml.ListUpdate{Index: 1, Value: ListItem{"w", 2, ""}}
+	want[0], want[1] = ListItem{"w", 1, ""}, ListItem{"w", 2, ""}
+	burst <- qml.ListRemove{Index: 1000}
+	burst <- qml.ListInsert{Index: 0, Value: "bad"}
+	close(burst)
+	c.Assert(list.UpdateFromChannel(burst), IsNil)
+	list.WaitUpdates()
+
+	var texts []string
+	c.Assert(list.Len(), Equals, len(want))
+	for i, item := range want {
+		c.Assert(list.Get(i), Equals, item)
+		texts = append(texts, fmt.Sprintf("%s%d", item.Name, item.Count))
+	}
+	c.Assert(obj.Call("texts"), Equals, strings.Join(texts, ","))
+
+	reset := make(chan qml.ListOp, 1)
+	reset <- qml.ListReset{Values: []interface{}{ListItem{"r", 1, ""}, map[string]interface{}{"name": "s"}}}
+	close(reset)
+	c.Assert(list.UpdateFromChannel(reset), IsNil)
+	list.WaitUpdates()
+	c.Assert(list.Len(), Equals, 2)
+	c.Assert(obj.Call("texts"), Equals, "r1,s0")
+}
+
+type TableRow struct {
+	Name  string
+	Age   int
+	Admin bool
+	Data  []int
+}
+
+func (s *S) TestTableModel(c *C) {
+	table := qml.NewTableModel([]TableRow{{Name: "bob", Age: 30}, {Name: "alice", Age: 25}})
+	defer table.Destroy()
+
+	c.Assert(table.Columns(), DeepEquals, []string{"name", "age", "admin", "data"})
+	c.Assert(table.ColumnCount(), Equals, 4)
+	c.Assert(table.RowCount(), Equals, 2)
+
+	s.context.SetVar("table", table)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			Repeater {
+				id: repeater
+				model: table
+				delegate: Item { property string text: name + age }
+			}
+			function texts() {
+				var result = []
+				for (var i = 0; i < repeater.count; i++) {
+					result.push(repeater.itemAt(i).text)
+				}
+				return result.join(",")
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Call("texts"), Equals, "bob30,alice25")
+
+	c.Assert(table.Append(TableRow{Name: "carol", Age: 41}, map[string]interface{}{"name": "dave", "age": 25}), IsNil)
+	c.Assert(table.Set(0, map[string]interface{}{"name": "bob", "age": 31}), IsNil)
+	c.Assert(obj.Call("texts"), Equals, "bob31,alice25,carol41,dave25")
+
+	c.Assert(table.Sort("age", true), IsNil)
+	c.Assert(obj.Call("texts"), Equals, "alice25,dave25,bob31,carol41")
+	c.Assert(table.Sort("name", false), IsNil)
+	c.Assert(obj.Call("texts"), Equals, "dave25,carol41,bob31,alice25")
+	c.Assert(table.Get(0), DeepEquals, TableRow{Name: "dave", Age: 25})
+
+	c.Assert(table.Sort("missing", true), ErrorMatches, `cannot sort table by "missing": table has no such column`)
+	c.Assert(table.Sort("data", true), ErrorMatches, `cannot sort table by "data": \[\]int values are not ordered`)
+
+	err = table.Append(map[string]interface{}{"age": "old"})
+	c.Assert(err, ErrorMatches, `cannot append table row 4: role "age": cannot use value "old" as int`)
+
+	table.Remove(1, 2)
+	c.Assert(obj.Call("texts"), Equals, "dave25,alice25")
+
+	table.Reset([]TableRow{{Name: "erin", Age: 19}})
+	c.Assert(table.RowCount(), Equals, 1)
+	c.Assert(obj.Call("texts"), Equals, "erin19")
+
+	c.Assert(func() { table.Remove(0, 2) }, Panics, "cannot remove 2 rows from table at row 0: table has 1 rows")
+	c.Assert(func() { table.Reset([]ListItem{}) }, Panics, "cannot reset table of qml_test.TableRow with []qml_test.ListItem")
+	c.Assert(func() { qml.NewTableModel(42) }, Panics, "cannot create table from int: not a slice of structs")
+}
+
+func (s *S) TestMaps(c *C) {
+	s.context.SetVar("m", map[string]interface{}{
+		"name":   "<name>",
+		"nested": map[string]string{"key": "<value>"},
+		"list":   []interface{}{"a", map[string]interface{}{"b": true}},
+	})
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string name: m.name
+			property string nested: m.nested.key
+			property bool listed: m.list[1].b
+			function echo(v) { return v }
+			function make() { return {s: "<s>", o: {t: true}, l: ["x", "y"]} }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.String("name"), Equals, "<name>")
+	c.Assert(obj.String("nested"), Equals, "<value>")
+	c.Assert(obj.Bool("listed"), Equals, true)
+
+	c.Assert(obj.Call("make"), DeepEquals, map[string]interface{}{
+		"s": "<s>",
+		"o": map[string]interface{}{"t": true},
+		"l": []string{"x", "y"},
+	})
+	c.Assert(obj.Call("echo", map[string]interface{}{"k": "v"}), DeepEquals, map[string]interface{}{"k": "v"})
+
+	c.Assert(func() { s.context.SetVar("bad", map[int]string{1: "a"}) }, Panics,
+		"cannot use map[int]string as a QML value: map keys must be strings")
+}
+
+func (s *S) TestObjectIdentity(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var self: this
+			property Item other: child
+			Item { id: child; objectName: "child" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	child := obj.ObjectByName("child")
+	c.Assert(obj.ObjectByName("child"), Equals, child)
+	c.Assert(obj.Object("other"), Equals, child)
+	c.Assert(obj.Object("self"), Equals, obj)
+	c.Assert(child.Object("parent"), Equals, obj)
+}
+
+func (s *S) TestStrictMode(c *C) {
+	qml.SetStrictMode(true)
+	defer qml.SetStrictMode(false)
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 42 }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	c.Assert(obj.Int("width"), Equals, 42)
+	obj.Destroy()
+
+	c.Assert(func() { obj.Int("width") }, PanicMatches, `(?s)qml: object used after being destroyed\n\nUsed at:\n.*\nCreated at:\n.*TestStrictMode.*`)
+}
+
+func (s *S) TestObjectOwnership(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property Component factory: Component { QtObject { property int value: 42 } }
+			function make() { return factory.createObject(null) }
+			function collect() { gc() }
+		}
+	`)
+	c.Assert(err, IsNil)
+	root := component.Create(nil)
+	defer root.Destroy()
+
+	// Objects created by QML code are pinned once returned to Go, so
+	// the garbage collector doesn't destroy them under Go's feet.
+	obj := root.Call("make").(*qml.Object)
+	c.Assert(obj.Ownership(), Equals, qml.CppOwnership)
+	root.Call("collect")
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(obj.Int("value"), Equals, 42)
+
+	// Once handed back, using the object after it's collected panics
+	// rather than crashing.
+	obj.SetOwnership(qml.JsOwnership)
+	c.Assert(obj.Ownership(), Equals, qml.JsOwnership)
+	used := func() (err interface{}) {
+		defer func() { err = recover() }()
+		obj.Int("value")
+		return nil
+	}
+	for i := 0; i < 100 && used() == nil; i++ {
+		root.Call("collect")
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(func() { obj.Int("value") }, PanicMatches, "qml: object used after being destroyed")
+	obj.Destroy()
+
+	obj = root.Call("make").(*qml.Object)
+	obj.Destroy()
+	c.Assert(func() { obj.Int("value") }, PanicMatches, "qml: object used after being destroyed")
+}
+
+func (s *S) TestObjectDestroyedViaOtherEngine(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property int value: 42 }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+
+	// The object obtained back via another engine has its own wrapper,
+	// which is reused while the object lives.
+	other := qml.NewEngine(nil)
+	defer other.Destroy()
+	other.Context().SetVar("obj", obj)
+	foreign := other.Context().Var("obj").(*qml.Object)
+	c.Assert(foreign == obj, Equals, false)
+	c.Assert(other.Context().Var("obj").(*qml.Object) == foreign, Equals, true)
+	c.Assert(foreign.Int("value"), Equals, 42)
+
+	// The wrapper of the other engine learns about the destruction
+	// once the object is actually deleted.
+	obj.Destroy()
+	c.Assert(func() { obj.Int("value") }, PanicMatches, "qml: object used after being destroyed")
+	used := func() (err interface{}) {
+		defer func() { err = recover() }()
+		foreign.Int("value")
+		return nil
+	}
+	for i := 0; i < 30 && used() == nil; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Assert(func() { foreign.Int("value") }, PanicMatches, "qml: object used after being destroyed")
+
+	validator := qml.NewValidator(func(input string, pos int) (qml.ValidationState, string, int) {
+		return qml.Acceptable, input, pos
+	})
+	validator.Destroy()
+	c.Assert(func() { validator.Property("objectName") }, PanicMatches, "qml: object used after being destroyed")
+}
+
+func (s *S) TestObjectConnect(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			signal clicked
+			signal moved(int x, string name, var extra)
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	clicked := make(chan bool, 10)
+	conn := obj.Connect("clicked", func() { clicked <- true })
+
+	type move struct {
+		x     int
+		name  string
+		extra interface{}
+	}
+	moved := make(chan move, 10)
+	obj.Connect("moved", func(x int, name string, extra interface{}) {
+		moved <- move{x, name, extra}
+	})
+
+	obj.Call("clicked")
+	obj.Call("moved", 42, "<name>", true)
+	select {
+	case <-clicked:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("clicked handler not called")
+	}
+	select {
+	case m := <-moved:
+		c.Assert(m, Equals, move{42, "<name>", true})
+	case <-time.After(3 * time.Second):
+		c.Fatalf("moved handler not called")
+	}
+
+	conn.Disconnect()
+	conn.Disconnect()
+	obj.Call("clicked")
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(clicked, HasLen, 0)
+
+	c.Assert(func() { obj.Connect("missing", func() {}) }, PanicMatches, `object has no signal "missing"`)
+	c.Assert(func() { obj.Connect("clicked", func(int) {}) }, PanicMatches, `cannot connect signal clicked\(\) to func\(int\): signal has 0 parameters, function has 1`)
+	c.Assert(func() { obj.Connect("moved", func(x, name, extra int) {}) }, PanicMatches, `cannot connect signal moved\(int,QString,QVariant\) to .*: parameter 2 has type QString`)
+	c.Assert(func() { obj.Connect("clicked", 42) }, PanicMatches, `cannot connect signal clicked to int: not a function with no results`)
+}
+
+func (s *S) TestConnectTyped(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			signal clicked
+			signal renamed(string name)
+			signal moved(int x, int y)
+			signal sent(var a, string b, bool c)
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	calls := make(chan string, 10)
+	_, err = qml.Connect0(obj, "clicked", func() { calls <- "clicked" })
+	c.Assert(err, IsNil)
+	_, err = qml.Connect1(obj, "renamed", func(name string) { calls <- "renamed " + name })
+	c.Assert(err, IsNil)
+	_, err = qml.Connect2(obj, "moved", func(x, y float64) { calls <- fmt.Sprintf("moved %g %g", x, y) })
+	c.Assert(err, IsNil)
+	_, err = qml.Connect3(obj, "sent", func(a int, b string, c bool) { calls <- fmt.Sprintf("sent %d %s %v", a, b, c) })
+	c.Assert(err, IsNil)
+
+	var mutex sync.Mutex
+	var msgs []string
+	qml.SetLogger(func(msg qml.LogMessage) {
+		mutex.Lock()
+		msgs = append(msgs, msg.String())
+		mutex.Unlock()
+	})
+	defer qml.SetLogger(c)
+
+	obj.Call("clicked")
+	obj.Call("renamed", "<name>")
+	obj.Call("moved", 1, 2)
+	obj.Call("sent", "not a number", "b", true)
+	obj.Call("sent", 3, "b", true)
+	for _, want := range []string{"clicked", "renamed <name>", "moved 1 2", "sent 3 b true"} {
+		select {
+		case got := <-calls:
+			c.Assert(got, Equals, want)
+		case <-time.After(3 * time.Second):
+			c.Fatalf("handler not called for %q", want)
+		}
+	}
+	mutex.Lock()
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0], Matches, `all_test.go:\d+: qml: cannot call func\(int, string, bool\): cannot convert signal parameter 1: .*`)
+	mutex.Unlock()
+
+	_, err = qml.Connect0(obj, "missing", func() {})
+	c.Assert(err, ErrorMatches, `object has no signal "missing"`)
+	_, err = qml.Connect1(obj, "clicked", func(int) {})
+	c.Assert(err, ErrorMatches, `cannot connect signal clicked\(\) to func\(int\): signal has 0 parameters, function has 1`)
+	_, err = qml.Connect1(obj, "renamed", func(bool) {})
+	c.Assert(err, ErrorMatches, `cannot connect signal renamed\(QString\) to func\(bool\): parameter 1 has type QString`)
+}
+
+func (s *S) TestOnChange(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property real value
+			property string label
+			onValueChanged: label = "v" + value
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+
+	values := make(chan interface{}, 10)
+	conn, err := obj.OnChange("value", func(value interface{}) { values <- value })
+	c.Assert(err, IsNil)
+	labels := make(chan interface{}, 10)
+	_, err = obj.OnChange("label", func(label interface{}) { labels <- label })
+	c.Assert(err, IsNil)
+
+	obj.Set("value", 1.5)
+	obj.Set("value", 2)
+	for _, want := range []interface{}{1.5, 2.0} {
+		select {
+		case got := <-values:
+			c.Assert(got, Equals, want)
+		case <-time.After(3 * time.Second):
+			c.Fatalf("handler not called for %v", want)
+		}
+	}
+	for _, want := range []string{"v1.5", "v2"} {
+		select {
+		case got := <-labels:
+			c.Assert(got, Equals, want)
+		case <-time.After(3 * time.Second):
+			c.Fatalf("handler not called for %q", want)
+		}
+	}
+
+	conn.Disconnect()
+	obj.Set("value", 3)
+	c.Assert(<-labels, Equals, "v3")
+	select {
+	case got := <-values:
+		c.Fatalf("handler called after disconnecting with %v", got)
+	default:
+	}
+
+	_, err = obj.OnChange("missing", func(interface{}) {})
+	c.Assert(err, ErrorMatches, `cannot observe property "missing": object does not have such property`)
+	_, err = obj.OnChange("data", func(interface{}) {})
+	c.Assert(err, ErrorMatches, `cannot observe property "data": property has no notify signal`)
+
+	// Connections are dropped with the object.
+	obj.Destroy()
+	conn.Disconnect()
+}
+
+func (s *S) TestCallbackOrdering(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			signal a(int n)
+			signal b(int n)
+			function emitAll(count) {
+				for (var i = 0; i < count; i++) {
+					a(i)
+					b(i)
+				}
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	const count = 200
+	received := make(chan [2]int, count*3)
+	obj.Connect("a", func(n int) {
+		if n%20 == 0 {
+			// A slow handler must not reorder or delay the other source.
+			time.Sleep(5 * time.Millisecond)
+		}
+		received <- [2]int{0, n}
+	})
+	obj.Connect("b", func(n int) { received <- [2]int{1, n} })
+
+	var inline []int
+	obj.ConnectInline("a", func(n int) { inline = append(inline, n) })
+
+	obj.Call("emitAll", count)
+	c.Assert(inline, HasLen, count)
+
+	next := [2]int{}
+	for i := 0; i < count*2; i++ {
+		select {
+		case r := <-received:
+			c.Assert(r[1], Equals, next[r[0]])
+			next[r[0]]++
+		case <-time.After(5 * time.Second):
+			c.Fatalf("handlers not called; received %v", next)
+		}
+	}
+}
+
+func (s *S) TestConnectOptions(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			signal ping()
+			property int value
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	obj := window.Root()
+
+	// Direct functions run during the emission, in priority order, and
+	// in connection order for the same priority.
+	var order []string
+	direct := func(name string) func() {
+		return func() { order = append(order, name) }
+	}
+	obj.Connect("ping", direct("low1"), qml.Direct)
+	obj.Connect("ping", direct("high"), qml.Direct, qml.Priority(10))
+	obj.Connect("ping", direct("low2"), qml.Direct)
+	obj.Connect("ping", direct("mid"), qml.Priority(5), qml.Direct)
+	obj.Connect("ping", direct("negative"), qml.Direct, qml.Priority(-1))
+	obj.ConnectInline("ping", direct("low3"))
+	queued := make(chan bool, 1)
+	obj.Connect("ping", func() { queued <- true }, qml.Queued)
+
+	obj.Emit("ping")
+	c.Assert(order, DeepEquals, []string{"high", "mid", "low1", "low2", "low3", "negative"})
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("queued function not called")
+	}
+
+	// A direct function may act on the object before the emission returns.
+	obj.Connect("valueChanged", func() {
+		if obj.Int("value") < 0 {
+			obj.Set("value", 0)
+		}
+	}, qml.Direct)
+	obj.Set("value", -5)
+	c.Assert(obj.Int("value"), Equals, 0)
+
+	c.Assert(func() { obj.Connect("ping", func() {}, qml.Queued, qml.Direct) }, Panics,
+		"cannot connect signal ping: both Queued and Direct options provided")
+	c.Assert(func() { obj.Connect("ping", func() {}, qml.Priority(1), qml.Priority(2)) }, Panics,
+		"cannot connect signal ping: conflicting Priority options provided")
+	c.Assert(func() { obj.Connect("ping", func() {}, qml.ConnectOption{}) }, Panics,
+		"cannot connect signal ping: invalid option")
+
+	// Blocking from a direct function is reported rather than deadlocking.
+	window.Show()
+	conn := obj.Connect("ping", func() { window.Wait() }, qml.Direct)
+	c.Assert(func() { obj.Emit("ping") }, Panics,
+		"cannot wait for window from within the main GUI thread: called from a Direct function connected to signal ping")
+	conn.Disconnect()
+}
+
+type ScanAddress struct {
+	Street string
+	Number int
+}
+
+type ScanForm struct {
+	Name     string
+	Age      int
+	Ratio    float32
+	Enabled  bool   `qml:"active"`
+	Ignored  string `qml:"-"`
+	Address  ScanAddress
+	Billing  *ScanAddress
+	internal int
+}
+
+func (s *S) TestObjectScanFill(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string name: "<name>"
+			property int age: 42
+			property real ratio: 0.5
+			property bool active: true
+			property QtObject address: QtObject {
+				property string street: "<street>"
+				property int number: 1
+			}
+			Item {
+				objectName: "billing"
+				property string street: "<billing>"
+				property real number: 2.7
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	var form ScanForm
+	c.Assert(obj.Scan(&form), IsNil)
+	c.Assert(form, DeepEquals, ScanForm{
+		Name:    "<name>",
+		Age:     42,
+		Ratio:   0.5,
+		Enabled: true,
+		Address: ScanAddress{"<street>", 1},
+		Billing: &ScanAddress{"<billing>", 2},
+	})
+
+	form.Name = "<other>"
+	form.Age = 7
+	form.Address.Street = "<other street>"
+	form.Billing.Street = "<other billing>"
+	c.Assert(obj.Fill(&form), IsNil)
+	c.Assert(obj.String("name"), Equals, "<other>")
+	c.Assert(obj.Int("age"), Equals, 7)
+	c.Assert(obj.Object("address").String("street"), Equals, "<other street>")
+	c.Assert(obj.ObjectByName("billing").String("street"), Equals, "<other billing>")
+
+	var bad struct {
+		Name    int
+		Missing string
+		Age     string
+	}
+	err = obj.Scan(&bad)
+	c.Assert(err, ErrorMatches, "cannot scan object into .*:\n"+
+		"Name: cannot use value \"<other>\" as int\n"+
+		"Missing: object has no \"missing\" property\n"+
+		"Age: cannot use value 7 as string")
+	c.Assert(obj.Scan(form), ErrorMatches, "cannot scan object into qml_test.ScanForm: not a pointer to a struct")
+}
+
+func (s *S) TestApplyDiff(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string name
+			property int age
+			property real ratio
+			property bool active
+			property QtObject address: QtObject {
+				property string street
+				property int number
+			}
+			Item {
+				objectName: "billing"
+				property string street
+				property int number
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	old := ScanForm{Name: "<name>", Age: 42, Address: ScanAddress{"<street>", 1}}
+	written, err := qml.ApplyDiff(obj, nil, &old)
+	c.Assert(err, IsNil)
+	c.Assert(written, DeepEquals, []string{"Name", "Age", "Ratio", "Enabled", "Address.Street", "Address.Number"})
+	c.Assert(obj.String("name"), Equals, "<name>")
+
+	new := old
+	new.Age = 43
+	new.Address.Number = 2
+	new.Billing = &ScanAddress{"<billing>", 3}
+	written, err = qml.ApplyDiff(obj, old, new)
+	c.Assert(err, IsNil)
+	c.Assert(written, DeepEquals, []string{"Age", "Address.Number", "Billing.Street", "Billing.Number"})
+	c.Assert(obj.Int("age"), Equals, 43)
+	c.Assert(obj.Object("address").Int("number"), Equals, 2)
+	c.Assert(obj.ObjectByName("billing").String("street"), Equals, "<billing>")
+
+	// Equal values in distinct pointers are not written.
+	old, new = new, new
+	new.Billing = &ScanAddress{"<billing>", 3}
+	written, err = qml.ApplyDiff(obj, old, new)
+	c.Assert(err, IsNil)
+	c.Assert(written, HasLen, 0)
+
+	_, err = qml.ApplyDiff(obj, old, ScanAddress{})
+	c.Assert(err, ErrorMatches, "cannot apply diff from qml_test.ScanForm to qml_test.ScanAddress: different types")
+	_, err = qml.ApplyDiff(obj, nil, 42)
+	c.Assert(err, ErrorMatches, "cannot apply diff from int: not a struct")
+
+	var bad struct {
+		Name    int
+		Missing string
+	}
+	bad.Name = 1
+	written, err = qml.ApplyDiff(obj, nil, bad)
+	c.Assert(written, DeepEquals, []string{"Name"})
+	c.Assert(err, ErrorMatches, "cannot apply diff from .*:\nMissing: object has no property \"missing\"")
+}
+
+type DiffWide struct {
+	F0, F1, F2, F3, F4, F5, F6, F7, F8, F9, F10, F11, F12, F13, F14, F15, F16, F17, F18, F19, F20, F21, F22, F23, F24, F25, F26, F27, F28, F29, F30, F31, F32, F33, F34, F35, F36, F37, F38, F39, F40, F41, F42, F43, F44, F45, F46, F47, F48, F49, F50, F51, F52, F53, F54, F55, F56, F57, F58, F59, F60, F61, F62, F63, F64, F65, F66, F67, F68, F69, F70, F71, F72, F73, F74, F75, F76, F77, F78, F79, F80, F81, F82, F83, F84, F85, F86, F87, F88, F89, F90, F91, F92, F93, F94, F95, F96, F97, F98, F99 int
+}
+
+// wideObject returns an object with properties for the DiffWide fields.
+func (s *S) wideObject(c *C) *qml.Object {
+	var src bytes.Buffer
+	src.WriteString("import QtQuick 2.0\nItem {\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&src, "property int f%d\n", i)
+	}
+	src.WriteString("}\n")
+	component, err := s.engine.LoadString("file.qml", src.String())
+	c.Assert(err, IsNil)
+	return component.Create(nil)
+}
+
+func (s *S) BenchmarkApplyDiff(c *C) {
+	obj := s.wideObject(c)
+	defer obj.Destroy()
+	var old, new DiffWide
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		new.F1, new.F50, new.F99 = i, i, i
+		if _, err := qml.ApplyDiff(obj, &old, &new); err != nil {
+			c.Fatal(err)
+		}
+		old = new
+	}
+}
+
+func (s *S) BenchmarkApplyDiffFill(c *C) {
+	obj := s.wideObject(c)
+	defer obj.Destroy()
+	var new DiffWide
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		new.F1, new.F50, new.F99 = i, i, i
+		if err := obj.Fill(&new); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+func (s *S) TestCompatNumbers64(c *C) {
+	defer qml.SetCompat(0)
+
+	s.context.SetVar("i", int32(42))
+	s.context.SetVar("f", float32(0.5))
+	c.Assert(s.context.Var("i"), Equals, int32(42))
+	c.Assert(s.context.Var("f"), Equals, float32(0.5))
+
+	qml.SetCompat(qml.Numbers64)
+	c.Assert(s.context.Var("i"), Equals, int64(42))
+	c.Assert(s.context.Var("f"), Equals, float64(0.5))
+}
+
+func (s *S) TestCompatStrictCoercions(c *C) {
+	defer qml.SetCompat(0)
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property real r: 1.5; property real w: 2 }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.Int("r"), Equals, 1)
+	c.Assert(obj.Int64("r"), Equals, int64(1))
+
+	qml.SetCompat(qml.StrictCoercions)
+	c.Assert(func() { obj.Int("r") }, PanicMatches, `value of property "r" cannot be represented as an int without loss: 1.5`)
+	c.Assert(func() { obj.Int64("r") }, PanicMatches, `value of property "r" cannot be represented as an int64 without loss: 1.5`)
+	c.Assert(obj.Int("w"), Equals, 2)
+}
+
+func (s *S) TestCompatCollectableSetValues(c *C) {
+	defer qml.SetCompat(0)
+	s.engine.SetCollectInterval(10 * time.Millisecond)
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property var v }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	waitAlive := func(alive int) int {
+		for i := 0; i < 100 && qml.Stats().ValuesAlive != alive; i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return qml.Stats().ValuesAlive
+	}
+
+	stats := qml.Stats()
+	obj.Set("v", &TestType{})
+	obj.Set("v", nil)
+	c.Assert(waitAlive(stats.ValuesAlive), Equals, stats.ValuesAlive+1)
+
+	qml.SetCompat(qml.CollectableSetValues)
+	obj.Set("v", &TestType{})
+	obj.Set("v", nil)
+	c.Assert(waitAlive(stats.ValuesAlive+1), Equals, stats.ValuesAlive+1)
+}
+
+type ValueHolder struct {
+	Value *TestType
+}
+
+func (s *S) TestValuesResurrected(c *C) {
+	// The record of evicted values is dropped on garbage collection.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	s.engine.SetCollectInterval(10 * time.Millisecond)
+
+	s.context.SetVar("holder", &ValueHolder{&TestType{StringValue: "<content>"}})
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item { function read() { return holder.value.stringValue } }
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	// Both the holder and the value it holds are referenced by the
+	// engine, so nothing is collected while more values are required.
+	s.engine.SetCollectThreshold(3)
+	stats := qml.Stats()
+	c.Assert(obj.Call("read"), Equals, "<content>")
+	time.Sleep(600 * time.Millisecond)
+	c.Assert(qml.Stats().ValuesEvicted, Equals, stats.ValuesEvicted)
+
+	// Collection runs once the GUI loop is idle for a moment.
+	s.engine.SetCollectThreshold(2)
+	for i := 0; i < 100 && qml.Stats().ValuesEvicted == stats.ValuesEvicted; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Assert(qml.Stats().ValuesEvicted, Equals, stats.ValuesEvicted+1)
+	c.Assert(qml.Stats().ValuesResurrected, Equals, stats.ValuesResurrected)
+
+	c.Assert(obj.Call("read"), Equals, "<content>")
+	c.Assert(qml.Stats().ValuesResurrected, Equals, stats.ValuesResurrected+1)
+}
+
+type MemoryTrimmer struct {
+	engine *qml.Engine
+	Trims  int
+}
+
+func (t *MemoryTrimmer) Trim() {
+	t.engine.CollectGarbage()
+	t.engine.TrimComponentCache()
+	t.Trims++
+}
+
+func (s *S) TestEngineMemoryStats(c *C) {
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+	c.Assert(engine.MemoryStats().GoValues, Equals, 0)
+
+	value := &TestType{}
+	engine.Context().SetVar("value", value)
+	ctx := engine.Context().Spawn()
+	ctx.SetVar("value", value)
+	c.Assert(engine.MemoryStats().GoValues, Equals, 2)
+
+	trimmer := &MemoryTrimmer{engine: engine}
+	engine.Context().SetVar("trimmer", trimmer)
+	component, err := engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var data
+			Repeater {
+				model: 10
+				Item { Component.onCompleted: trimmer.trim() }
+			}
+			function fill() {
+				var list = []
+				for (var i = 0; i < 10000; i++) {
+					list.push({index: i, text: "item " + i})
+				}
+				data = list
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(ctx)
+	c.Assert(trimmer.Trims, Equals, 10)
+
+	before := engine.MemoryStats()
+	obj.Call("fill")
+	filled := engine.MemoryStats()
+	c.Assert(filled.JSHeapUsed >= before.JSHeapUsed, Equals, true)
+	c.Assert(filled.JSHeapAllocated >= filled.JSHeapUsed, Equals, true)
+
+	obj.Set("data", nil)
+	engine.CollectGarbage()
+	engine.TrimComponentCache()
+	c.Assert(engine.MemoryStats().GoValues, Equals, 3)
+
+	obj.Destroy()
+	ctx.Destroy()
+	for i := 0; i < 30 && engine.MemoryStats().GoValues > 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Assert(engine.MemoryStats().GoValues, Equals, 2)
+}
+
+func (s *S) TestCompatReportLegacy(c *C) {
+	defer qml.SetCompat(0)
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property real r: 1.5 }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	logMark := c.GetTestLog()
+	obj.Int("r")
+	c.Assert(c.GetTestLog()[len(logMark):], Equals, "")
+
+	qml.SetCompat(qml.ReportLegacy)
+	for i := 0; i < 3; i++ {
+		obj.Int("r")
+	}
+	logged := c.GetTestLog()[len(logMark):]
+	c.Assert(logged, Matches, `all_test.go:[0-9]+: qml: value of property "r" truncated to an int; this changes with the StrictCoercions compatibility flag\n`)
+
+	// New behavior is not reported.
+	qml.SetCompat(qml.ReportLegacy | qml.StrictCoercions | qml.Numbers64)
+	c.Assert(obj.Property("r"), Equals, 1.5)
+	c.Assert(c.GetTestLog()[len(logMark):], Equals, logged)
+}
+
+func (s *S) TestObjectSetErrors(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			readonly property int fixed: 1
+			property var any
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.Set("width", 300), IsNil)
+	c.Assert(obj.Set("width", "400"), IsNil)
+	c.Assert(obj.Int("width"), Equals, 400)
+	c.Assert(obj.Set("any", "text"), IsNil)
+
+	c.Assert(obj.Set("titel", "text"), ErrorMatches, `object has no property "titel"`)
+	c.Assert(obj.Set("width", "wide"), ErrorMatches, `cannot assign string to property "width" of type (double|qreal)`)
+	c.Assert(obj.Set("fixed", 2), ErrorMatches, `cannot assign to read-only property "fixed"`)
+	c.Assert(obj.Int("fixed"), Equals, 1)
+}
+
+func (s *S) TestObjectIntrospection(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property int foo: 1
+			readonly property string bar: "bar"
+			signal done(int code, string reason)
+			function greet(name) { return "Hello " + name }
+			Item { objectName: "first" }
+			Timer { objectName: "second" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	props := make(map[string]qml.PropertyInfo)
+	for _, prop := range obj.Properties() {
+		props[prop.Name] = prop
+	}
+	c.Assert(props["foo"], Equals, qml.PropertyInfo{Name: "foo", Type: "int", Writable: true, HasNotify: true})
+	c.Assert(props["bar"], Equals, qml.PropertyInfo{Name: "bar", Type: "QString", Writable: false, HasNotify: true})
+	c.Assert(props["width"].Writable, Equals, true)
+	c.Assert(props["objectName"].Type, Equals, "QString")
+
+	methods := make(map[string]qml.MethodInfo)
+	for _, method := range obj.Methods() {
+		methods[method.Name] = method
+	}
+	c.Assert(methods["done"], DeepEquals, qml.MethodInfo{
+		Name:       "done",
+		Signal:     true,
+		Result:     "void",
+		ParamTypes: []string{"int", "QString"},
+		ParamNames: []string{"code", "reason"},
+	})
+	c.Assert(methods["greet"], DeepEquals, qml.MethodInfo{
+		Name:       "greet",
+		Result:     "QVariant",
+		ParamTypes: []string{"QVariant"},
+		ParamNames: []string{"name"},
+	})
+	c.Assert(methods["deleteLater"].ParamTypes, DeepEquals, []string{})
+	c.Assert(methods["widthChanged"].Signal, Equals, true)
+
+	var names []string
+	for _, child := range obj.Children() {
+		if name := child.String("objectName"); name != "" {
+			names = append(names, name)
+		}
+	}
+	c.Assert(names, DeepEquals, []string{"first", "second"})
+	c.Assert(obj.ObjectByName("first").Children(), HasLen, 0)
+}
+
+func (s *S) TestObjectPropertyInfo(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Text {
+			property int foo: 1
+			property int bar: foo * 2
+			horizontalAlignment: Text.AlignRight
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	meta, err := obj.PropertyInfo("foo")
+	c.Assert(err, IsNil)
+	c.Assert(meta.PropertyInfo, Equals, qml.PropertyInfo{Name: "foo", Type: "int", Writable: true, HasNotify: true})
+	c.Assert(meta.NotifySignal, Equals, "fooChanged")
+	c.Assert(meta.Bound, Equals, false)
+	c.Assert(meta.Grouped, Equals, false)
+	c.Assert(meta.EnumValues, IsNil)
+	c.Assert(meta.HasMin || meta.HasMax, Equals, false)
+
+	meta, err = obj.PropertyInfo("bar")
+	c.Assert(err, IsNil)
+	c.Assert(meta.Bound, Equals, true)
+
+	meta, err = obj.PropertyInfo("horizontalAlignment")
+	c.Assert(err, IsNil)
+	c.Assert(meta.Enum, Equals, "HAlignment")
+	c.Assert(meta.EnumValues["AlignRight"], Equals, obj.Int("horizontalAlignment"))
+	c.Assert(meta.EnumValues, HasLen, 4)
+
+	for _, name := range []string{"anchors", "font"} {
+		meta, err = obj.PropertyInfo(name)
+		c.Assert(err, IsNil)
+		c.Assert(meta.Grouped, Equals, true, Commentf("property %q", name))
+	}
+
+	_, err = obj.PropertyInfo("missing")
+	c.Assert(err, ErrorMatches, `object does not have a "missing" property`)
+}
+
+func (s *S) TestObjectPropertyErrors(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var list: ["a", "b"]
+			property var map: ({"key": "value"})
+			property var none
+			property real ratio: 1.5
+			property Item child: Item { objectName: "child" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.HasProperty("width"), Equals, true)
+	c.Assert(obj.HasProperty("child.objectName"), Equals, true)
+	c.Assert(obj.HasProperty("missing"), Equals, false)
+	c.Assert(obj.HasProperty("child.missing"), Equals, false)
+
+	value, err := obj.PropertyErr("list")
+	c.Assert(err, IsNil)
+	c.Assert(value, DeepEquals, obj.Property("list"))
+	value, err = obj.PropertyErr("map")
+	c.Assert(err, IsNil)
+	c.Assert(value, DeepEquals, map[string]interface{}{"key": "value"})
+	value, err = obj.PropertyErr("none")
+	c.Assert(err, IsNil)
+	c.Assert(value, IsNil)
+	value, err = obj.PropertyErr("child")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, obj.Object("child"))
+
+	value, err = obj.PropertyErr("missing")
+	c.Assert(err, ErrorMatches, `object does not have a "missing" property`)
+	c.Assert(value, IsNil)
+	_, err = obj.PropertyErr("child.missing")
+	c.Assert(err, ErrorMatches, `object does not have a "child.missing" property: cannot find "missing"`)
+
+	c.Assert(obj.IntOr("width", 7), Equals, 0)
+	c.Assert(obj.IntOr("missing", 7), Equals, 7)
+	c.Assert(obj.IntOr("map", 7), Equals, 7)
+	c.Assert(obj.Int64Or("ratio", 7), Equals, int64(1))
+	c.Assert(obj.Int64Or("missing", 7), Equals, int64(7))
+	c.Assert(obj.Float64Or("ratio", 7), Equals, 1.5)
+	c.Assert(obj.Float64Or("none", 7), Equals, 7.0)
+	c.Assert(obj.BoolOr("visible", false), Equals, true)
+	c.Assert(obj.BoolOr("missing", true), Equals, true)
+	c.Assert(obj.StringOr("child.objectName", "-"), Equals, "child")
+	c.Assert(obj.StringOr("list", "-"), Equals, "-")
+	c.Assert(obj.ObjectOr("child", nil), Equals, obj.Object("child"))
+	c.Assert(obj.ObjectOr("missing", nil), IsNil)
+	c.Assert(obj.ObjectOr("none", obj), Equals, obj)
+
+	qml.SetCompat(qml.StrictCoercions)
+	defer qml.SetCompat(0)
+	c.Assert(obj.IntOr("ratio", 7), Equals, 7)
+	c.Assert(func() { obj.Int("ratio") }, PanicMatches, `value of property "ratio" cannot be represented as an int without loss: 1.5`)
+}
+
+func (s *S) TestResult(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var count: "42"
+			property var ratio: "1.5"
+			property real size: 3
+			property var flag: "true"
+			property var stamp: "2014-03-01T10:20:30.000Z"
+			property date day: new Date(0)
+			property var big: "18446744073709551615"
+			property var names: ["a", "b"]
+			property var map: {"key": "value"}
+			function sum(a, b) { return a + b }
+			function label() { return "n" + 7 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	i, err := obj.PropertyResult("count").Int()
+	c.Assert(err, IsNil)
+	c.Assert(i, Equals, 42)
+	f, err := obj.PropertyResult("ratio").Float64()
+	c.Assert(err, IsNil)
+	c.Assert(f, Equals, 1.5)
+	i64, err := obj.PropertyResult("size").Int64()
+	c.Assert(err, IsNil)
+	c.Assert(i64, Equals, int64(3))
+	u, err := obj.PropertyResult("big").Uint64()
+	c.Assert(err, IsNil)
+	c.Assert(u, Equals, uint64(18446744073709551615))
+	str, err := obj.PropertyResult("size").String()
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "3")
+	b, err := obj.PropertyResult("flag").Bool()
+	c.Assert(err, IsNil)
+	c.Assert(b, Equals, true)
+	t, err := obj.PropertyResult("stamp").Time()
+	c.Assert(err, IsNil)
+	c.Assert(t.Equal(time.Date(2014, 3, 1, 10, 20, 30, 0, time.UTC)), Equals, true)
+	list, err := obj.PropertyResult("names").List()
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []interface{}{"a", "b"})
+	m, err := obj.PropertyResult("map").Map()
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string]interface{}{"key": "value"})
+
+	sum, err := obj.CallResult("sum", 1, 2).Int()
+	c.Assert(err, IsNil)
+	c.Assert(sum, Equals, 3)
+	_, err = obj.CallResult("label").Int()
+	c.Assert(err, ErrorMatches, `value of result of method "label" is not a number: "n7"`)
+	_, err = obj.CallResult("missing").String()
+	c.Assert(err, ErrorMatches, `.*missing.*`)
+	_, err = obj.PropertyResult("missing").Int()
+	c.Assert(err, ErrorMatches, `object does not have a "missing" property`)
+	_, err = obj.PropertyResult("names").Object()
+	c.Assert(err, ErrorMatches, `value of property "names" is not a \*qml.Object: .*`)
+
+	s.context.SetVar("limit", "128")
+	limit, err := s.context.VarResult("limit").Float32()
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, float32(128))
+
+	msecs, err := qml.ResultOf(int64(1000)).Time()
+	c.Assert(err, IsNil)
+	c.Assert(msecs.Equal(time.Unix(1, 0)), Equals, true)
+
+	// The strict getters of Object.
+	c.Assert(obj.Float32("size"), Equals, float32(3))
+	c.Assert(obj.Uint64("size"), Equals, uint64(3))
+	c.Assert(obj.Time("day").Equal(time.Unix(0, 0)), Equals, true)
+	c.Assert(obj.Uint64Or("count", 7), Equals, uint64(7))
+	c.Assert(func() { obj.Uint64("count") }, PanicMatches, `value of property "count" cannot be represented as a uint64: "42"`)
+	c.Assert(func() { obj.Time("size") }, PanicMatches, `value of property "size" is not a time.Time: 3`)
+}
+
+func (s *S) TestDestroyOrder(c *C) {
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		engine := qml.NewEngine(nil)
+		component, err := engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 42 }")
+		c.Assert(err, IsNil)
+		obj := component.Create(nil)
+		win := component.CreateWindow(nil)
+
+		destroy := []func(){engine.Destroy, component.Destroy, obj.Destroy, win.Destroy}
+		for _, j := range rnd.Perm(len(destroy)) {
+			destroy[j]()
+		}
+	}
+}
+
+func (s *S) TestURLInterceptor(c *C) {
+	dir := c.MkDir()
+	for name, text := range map[string]string{"a": "a", "b": "b", "c": "c", "d": "d"} {
+		data := "import QtQuick 2.0\nItem { property string name: \"" + text + "\" }"
+		err := ioutil.WriteFile(filepath.Join(dir, name+".qml"), []byte(data), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+
+	var mu sync.Mutex
+	var kinds []qml.URLKind
+	engine.SetURLInterceptor(func(url string, kind qml.URLKind) string {
+		mu.Lock()
+		kinds = append(kinds, kind)
+		mu.Unlock()
+		return strings.Replace(url, "/a.qml", "/b.qml", 1)
+	})
+
+	component, err := engine.LoadFile(filepath.Join(dir, "a.qml"))
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.String("name"), Equals, "b")
+	mu.Lock()
+	c.Assert(len(kinds) > 0, Equals, true)
+	c.Assert(kinds[0], Equals, qml.QMLFileURL)
+	mu.Unlock()
+
+	// Unchanged URLs load as usual.
+	component, err = engine.LoadFile(filepath.Join(dir, "c.qml"))
+	c.Assert(err, IsNil)
+	obj = component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.String("name"), Equals, "c")
+
+	engine.SetURLInterceptor(nil)
+	mu.Lock()
+	seen := len(kinds)
+	mu.Unlock()
+	component, err = engine.LoadFile(filepath.Join(dir, "d.qml"))
+	c.Assert(err, IsNil)
+	obj = component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.String("name"), Equals, "d")
+	mu.Lock()
+	c.Assert(kinds, HasLen, seen)
+	mu.Unlock()
+}
+
+func (s *S) TestWebViewErrors(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem {}")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	_, err = qml.NewWebView(obj)
+	if err == qml.ErrUnsupported {
+		c.Skip("QtWebChannel module not available")
+	}
+	c.Assert(err, ErrorMatches, "cannot use web view: object is not a WebEngineView")
+}
+
+func (s *S) TestComponentCreateWith(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property int size
+			property int completedSize: -1
+			Component.onCompleted: completedSize = size
+		}
+	`)
+	c.Assert(err, IsNil)
+
+	obj := component.CreateWith(nil, map[string]interface{}{"size": 300})
+	defer obj.Destroy()
+	c.Assert(obj.Int("size"), Equals, 300)
+	c.Assert(obj.Int("completedSize"), Equals, 300)
+
+	inc := component.CreateAsync(nil, map[string]interface{}{"size": 42})
+	async, err := inc.Wait()
+	c.Assert(err, IsNil)
+	defer async.Destroy()
+	c.Assert(async.Int("completedSize"), Equals, 42)
+	select {
+	case <-inc.Done():
+	default:
+		c.Fatalf("incubation not done after Wait")
+	}
+
+	// Canceling an incubation in progress.
+	heavy, err := s.engine.LoadString("heavy.qml", `
+		import QtQuick 2.0
+		Item { Repeater { model: 20000; Rectangle { width: index } } }
+	`)
+	c.Assert(err, IsNil)
+	inc = heavy.CreateAsync(nil, nil)
+	inc.Cancel()
+	_, err = inc.Wait()
+	c.Assert(err, ErrorMatches, "cannot create component instance: canceled")
+	inc.Cancel()
+
+	// Required properties must be provided, with Qt 5.15 or later.
+	required, err := s.engine.LoadString("required.qml", "import QtQuick 2.15\nItem { required property string title }")
+	if err != nil {
+		c.Logf("required properties not supported: %v", err)
+		return
+	}
+	_, err = required.CreateAsync(nil, nil).Wait()
+	c.Assert(err, ErrorMatches, `cannot create component instance: .*[Rr]equired property title.*`)
+	c.Assert(func() { required.CreateWith(nil, nil) }, PanicMatches, `cannot create component instance: .*title.*`)
+	titled := required.CreateWith(nil, map[string]interface{}{"title": "<title>"})
+	defer titled.Destroy()
+	c.Assert(titled.String("title"), Equals, "<title>")
+}
+
+func (s *S) TestComponentCreateWindow(c *C) {
+	data := `
+		import QtQuick 2.0
+		Item { width: 300; height: 200; }
+	`
+	component, err := s.engine.LoadString("file.qml", data)
+	c.Assert(err, IsNil)
+
+	// TODO How to test this more effectively?
+	window := component.CreateWindow(nil)
+	window.Show()
+	// Qt doesn't hide the Window if we call it too quickly. :-(
+	time.Sleep(100 * time.Millisecond)
+	window.Hide()
+}
+
+func (s *S) TestWindowGeometry(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 300; height: 200 }")
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+
+	c.Assert(window.Title(), Equals, "")
+	window.SetTitle("Kiosk")
+	c.Assert(window.Title(), Equals, "Kiosk")
+
+	window.SetMinimumSize(100, 50)
+	window.SetMaximumSize(800, 600)
+	w, h := window.MinimumSize()
+	c.Assert([]int{w, h}, DeepEquals, []int{100, 50})
+	w, h = window.MaximumSize()
+	c.Assert([]int{w, h}, DeepEquals, []int{800, 600})
+
+	// Geometry set before the window is shown is kept.
+	window.SetPosition(30, 40)
+	window.SetSize(400, 250)
+	x, y := window.Position()
+	c.Assert([]int{x, y}, DeepEquals, []int{30, 40})
+	w, h = window.Size()
+	c.Assert([]int{w, h}, DeepEquals, []int{400, 250})
+	c.Assert(window.Root().Int("width"), Equals, 400)
+
+	c.Assert(window.Flags(), Equals, qml.WindowFlags(0))
+	window.SetFlags(qml.FramelessWindow | qml.StaysOnTopWindow)
+	c.Assert(window.Flags(), Equals, qml.FramelessWindow|qml.StaysOnTopWindow)
+	window.SetClickThrough(true)
+	window.SetFlags(qml.StaysOnTopWindow)
+	c.Assert(window.Flags(), Equals, qml.StaysOnTopWindow)
+
+	window.SetState(qml.MaximizedState)
+	c.Assert(window.State(), Equals, qml.MaximizedState)
+	window.Show()
+	c.Assert(window.State(), Equals, qml.MaximizedState)
+
+	window.SetState(qml.NormalState)
+	window.SetSize(320, 240)
+	done := make(chan bool)
+	go func() {
+		w, h := window.Size()
+		c.Check([]int{w, h}, DeepEquals, []int{320, 240})
+		done <- true
+	}()
+	<-done
+}
+
+func (s *S) TestWindowClickThroughAndInputRegion(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 300; height: 200 }")
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+
+	region := []image.Rectangle{image.Rect(0, 0, 100, 100)}
+
+	// Click-through first, then the input region.
+	window.SetClickThrough(true)
+	window.SetInputRegion(region)
+	c.Assert(window.IsTransparentForInput(), Equals, true)
+	window.SetInputRegion(nil)
+	c.Assert(window.IsTransparentForInput(), Equals, true)
+	window.SetClickThrough(false)
+	c.Assert(window.IsTransparentForInput(), Equals, false)
+
+	// The input region first, then click-through.
+	window.SetInputRegion([]image.Rectangle{})
+	c.Assert(window.IsTransparentForInput(), Equals, true)
+	window.SetClickThrough(true)
+	window.SetClickThrough(false)
+	c.Assert(window.IsTransparentForInput(), Equals, true)
+	window.SetInputRegion(region)
+	c.Assert(window.IsTransparentForInput(), Equals, false)
+	window.SetClickThrough(true)
+	window.SetInputRegion(nil)
+	c.Assert(window.IsTransparentForInput(), Equals, true)
+}
+
+func (s *S) TestAnimate(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property real base: 1
+			property real bound: base * 2
+			property real restored: base * 3
+			property color tint: "red"
+			property string tintName: tint.toString()
+			property point spot
+			property real spotY: spot.y
+			property string label
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	finished := func(anim *qml.Animation) bool {
+		done := make(chan bool, 1)
+		anim.OnFinished(func(completed bool) { done <- completed })
+		select {
+		case completed := <-done:
+			return completed
+		case <-time.After(3 * time.Second):
+			c.Fatalf("animation never finished")
+		}
+		return false
+	}
+
+	anim, err := obj.Animate("bound", 100, 50*time.Millisecond, qml.OutCubicEasing)
+	c.Assert(err, IsNil)
+	c.Assert(finished(anim), Equals, true)
+	c.Assert(obj.Float64("bound"), Equals, 100.0)
+
+	anim, err = obj.AnimateWith("restored", 100, 50*time.Millisecond, &qml.AnimationOptions{RestoreBinding: true})
+	c.Assert(err, IsNil)
+	c.Assert(finished(anim), Equals, true)
+	c.Assert(obj.Float64("restored"), Equals, 3.0)
+
+	// The binding of bound was dropped for good.
+	obj.Set("base", 2)
+	c.Assert(obj.Float64("bound"), Equals, 100.0)
+	c.Assert(obj.Float64("restored"), Equals, 6.0)
+
+	anim, err = obj.Animate("tint", color.RGBA{0, 0, 255, 255}, 50*time.Millisecond, qml.LinearEasing)
+	c.Assert(err, IsNil)
+	c.Assert(finished(anim), Equals, true)
+	c.Assert(obj.String("tintName"), Equals, "#0000ff")
+
+	anim, err = obj.Animate("spot", image.Point{10, 20}, 50*time.Millisecond, qml.LinearEasing)
+	c.Assert(err, IsNil)
+	c.Assert(finished(anim), Equals, true)
+	c.Assert(obj.Float64("spotY"), Equals, 20.0)
+
+	anim, err = obj.Animate("base", 1000, time.Hour, qml.LinearEasing)
+	c.Assert(err, IsNil)
+	anim.Stop()
+	c.Assert(finished(anim), Equals, false)
+	anim.Stop()
+
+	_, err = obj.Animate("label", "x", time.Second, qml.LinearEasing)
+	c.Assert(err, ErrorMatches, `cannot animate property "label" of type QString`)
+	_, err = obj.Animate("missing", 1, time.Second, qml.LinearEasing)
+	c.Assert(err, ErrorMatches, `object has no property "missing"`)
+	_, err = obj.Animate("base", "bogus", time.Second, qml.LinearEasing)
+	c.Assert(err, ErrorMatches, `cannot animate property "base" of type double to string`)
+}
+
+type ConversionType struct {
+	Timeout time.Duration
+	Tint    color.Color
+}
+
+func (v *ConversionType) Later(t time.Time, d time.Duration) time.Time {
+	return t.Add(d)
+}
+
+// payloadData returns n bytes of text that differ depending on seed.
+func payloadData(seed, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte('a' + (seed+i)%26)
+	}
+	return data
+}
+
+type PayloadType struct{}
+
+func (p *PayloadType) Make(seed, n int) string {
+	return string(payloadData(seed, n))
+}
+
+func (s *S) TestLargeTransfers(c *C) {
+	defer qml.SetUseMarshalers(true)()
+
+	s.context.SetVar("payload", &PayloadType{})
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string text
+			property var blob
+			property var point
+			function make(seed, n) { return payload.make(seed, n) }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	// Data is copied while other goroutines keep the garbage
+	// collector busy, so it's found out if C++ observes Go
+	// memory that was released meanwhile.
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = payloadData(0, 1<<20)
+			runtime.GC()
+		}
+	}()
+
+	const size = 4 << 20
+	for i := 0; i < 10; i++ {
+		want := payloadData(i, size)
+		obj.Set("text", string(want))
+		c.Assert(obj.String("text") == string(want), Equals, true)
+
+		obj.Set("blob", want)
+		blob, ok := obj.Property("blob").([]byte)
+		c.Assert(ok, Equals, true)
+		c.Assert(bytes.Equal(blob, want), Equals, true)
+
+		c.Assert(obj.Call("make", i, size) == string(want), Equals, true)
+
+		obj.Set("point", TextPoint{i, i})
+		c.Assert(obj.String("point"), Equals, fmt.Sprintf("%d,%d", i, i))
+	}
+
+	// Text is not truncated at NUL bytes in either direction.
+	obj.Set("text", "a\x00b")
+	c.Assert(obj.String("text"), Equals, "a\x00b")
+	obj.Set("blob", []byte{})
+	c.Assert(obj.Property("blob"), DeepEquals, []byte{})
+}
+
+func (s *S) BenchmarkSetLargeString(c *C) {
+	s.benchmarkSetLarge(c, "text", string(payloadData(0, 10<<20)))
+}
+
+func (s *S) BenchmarkSetLargeBytes(c *C) {
+	s.benchmarkSetLarge(c, "blob", payloadData(0, 10<<20))
+}
+
+func (s *S) benchmarkSetLarge(c *C, name string, value interface{}) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property string text; property var blob }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.SetBytes(10 << 20)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		if err := obj.Set(name, value); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSetString and BenchmarkCallString are plain benchmarks rather
+// than suite ones, so that they report allocations.
+func BenchmarkSetString(b *testing.B) {
+	obj := newBenchObject(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := obj.Set("text", "frame"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCallString(b *testing.B) {
+	obj := newBenchObject(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := obj.CallError("echo", "frame"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func newBenchObject(b *testing.B) *qml.Object {
+	initTests()
+	engine := qml.NewEngine(nil)
+	component, err := engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property string text; function echo(s) { return s } }")
+	if err != nil {
+		b.Fatal(err)
+	}
+	obj := component.Create(nil)
+	b.Cleanup(engine.Destroy)
+	return obj
+}
+
+func (s *S) TestSetStringNames(c *C) {
+	long := "p" + strings.Repeat("x", 300)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string text
+			property var blob
+			property string `+long+`
+			function echo(s) { return s }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	for _, text := range []string{"", "a\x00b", "a\xffb", "\U0001F600"} {
+		c.Assert(obj.Set("text", text), IsNil)
+		c.Assert(obj.Property("text"), Equals, obj.Call("echo", text))
+		if utf8.ValidString(text) {
+			c.Assert(obj.String("text"), Equals, text)
+		}
+	}
+	for _, blob := range [][]byte{{}, {0}, {0xff, 0, 0xfe}} {
+		c.Assert(obj.Set("blob", blob), IsNil)
+		c.Assert(obj.Property("blob"), DeepEquals, blob)
+	}
+
+	// Names too long for the reused C memory work as well.
+	c.Assert(obj.Set(long, "long"), IsNil)
+	c.Assert(obj.String(long), Equals, "long")
+	c.Assert(obj.Set(long+"y", "long"), ErrorMatches, `object has no property "`+long+`y"`)
+
+	// Names of properties set by QML code run while setting another
+	// property are not clobbered.
+	obj.ConnectInline("textChanged", func() { obj.Set(long, obj.String("text")) })
+	c.Assert(obj.Set("text", "nested"), IsNil)
+	c.Assert(obj.String(long), Equals, "nested")
+}
+
+func (s *S) BenchmarkGetLargeString(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property string text }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	obj.Set("text", string(payloadData(0, 10<<20)))
+	c.SetBytes(10 << 20)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		obj.String("text")
+	}
+}
+
+func (s *S) TestConversions(c *C) {
+	s.checkConversions(c)
+}
+
+func (s *S) checkConversions(c *C) {
+	value := &ConversionType{Timeout: time.Second, Tint: color.RGBA{0, 0, 255, 255}}
+	s.context.SetVar("value", value)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property date when
+			property color tint
+			property url source
+			property real timeout: value.timeout
+			property string tintName: value.tint.toString()
+			property var later: value.later(new Date(Date.UTC(2014, 0, 2, 3, 4, 5)), 1500)
+			function iso(d) { return d.toISOString() }
+			Component.onCompleted: {
+				value.timeout = 2500
+				value.tint = Qt.rgba(1, 0, 0, 1)
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.Float64("timeout"), Equals, 1000.0)
+	c.Assert(obj.String("tintName"), Equals, "#0000ff")
+	c.Assert(value.Timeout, Equals, 2500*time.Millisecond)
+	c.Assert(value.Tint, Equals, color.RGBA{255, 0, 0, 255})
+
+	t := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	later, ok := obj.Property("later").(time.Time)
+	c.Assert(ok, Equals, true)
+	c.Assert(later.Equal(t.Add(1500*time.Millisecond)), Equals, true)
+
+	obj.Set("when", t)
+	when, ok := obj.Property("when").(time.Time)
+	c.Assert(ok, Equals, true)
+	c.Assert(when.Equal(t), Equals, true)
+	c.Assert(obj.Call("iso", t), Equals, "2014-01-02T03:04:05.000Z")
+
+	obj.Set("tint", color.NRGBA{255, 0, 0, 0x80})
+	c.Assert(obj.Property("tint"), Equals, color.RGBA{0x80, 0, 0, 0x80})
+
+	obj.Set("source", "http://example.com/a")
+	c.Assert(obj.Property("source"), Equals, "http://example.com/a")
+	u, err := url.Parse("http://example.com/b")
+	c.Assert(err, IsNil)
+	obj.Set("source", u)
+	c.Assert(obj.Property("source"), Equals, "http://example.com/b")
+}
+
+func (s *S) TestJSValueConversions(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var date: new Date(Date.UTC(2014, 0, 2, 3, 4, 5))
+			property var re: /ab+c/gi
+			property bool hasTypedArrays: typeof Float32Array != "undefined"
+			property var floats: hasTypedArrays ? new Float32Array([1.5, 2.5]) : null
+			property var bytes: hasTypedArrays ? new Uint8Array([1, 255]) : null
+			property var samples
+			property string samplesType: samples ? samples.constructor.name : ""
+			property real samplesSum: samples ? samples[0] + samples[1] : 0
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	date, ok := obj.Property("date").(time.Time)
+	c.Assert(ok, Equals, true)
+	c.Assert(date.Equal(time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)), Equals, true)
+
+	re, ok := obj.Property("re").(qml.Regexp)
+	c.Assert(ok, Equals, true)
+	c.Assert(re, Equals, qml.Regexp{Pattern: "ab+c", Flags: "gi"})
+	compiled, err := re.Compile()
+	c.Assert(err, IsNil)
+	c.Assert(compiled.MatchString("xABBC"), Equals, true)
+	_, err = qml.Regexp{Pattern: `(a)\1`}.Compile()
+	c.Assert(err, NotNil)
+
+	obj.Set("samples", qml.TypedArray{[]float32{1.5, 2}})
+	c.Assert(obj.Float64("samplesSum"), Equals, 3.5)
+
+	if !obj.Bool("hasTypedArrays") {
+		c.Assert(obj.Property("samples"), DeepEquals, []float64{1.5, 2})
+		c.Logf("JavaScript engine has no typed arrays; skipping the rest of the test.")
+		return
+	}
+	c.Assert(obj.Property("floats"), DeepEquals, []float32{1.5, 2.5})
+	c.Assert(obj.Property("bytes"), DeepEquals, []uint8{1, 255})
+	c.Assert(obj.String("samplesType"), Equals, "Float32Array")
+	c.Assert(obj.Property("samples"), DeepEquals, []float32{1.5, 2})
+}
+
+func (s *S) TestLoadAsync(c *C) {
+	path := filepath.Join(c.MkDir(), "file.qml")
+	c.Assert(ioutil.WriteFile(path, []byte("import QtQuick 2.0\nItem { property int value: 42 }"), 0644), IsNil)
+
+	load := s.engine.LoadAsync(path, nil)
+	select {
+	case <-load.Done():
+	case <-time.After(3 * time.Second):
+		c.Fatalf("component not loaded")
+	}
+	component, err := load.Wait()
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	c.Assert(obj.Int("value"), Equals, 42)
+	obj.Destroy()
+
+	component, err = s.engine.LoadAsync("file.qml", strings.NewReader("import QtQuick 2.0\nItem { property int value: 7 }")).Wait()
+	c.Assert(err, IsNil)
+	obj = component.Create(nil)
+	c.Assert(obj.Int("value"), Equals, 7)
+	obj.Destroy()
+
+	// Errors are reported as done by Load.
+	broken := "import QtQuick 2.0\nItem { bogus: 1 }"
+	_, loadErr := s.engine.LoadString("file.qml", broken)
+	c.Assert(loadErr, NotNil)
+	_, err = s.engine.LoadAsync("file.qml", strings.NewReader(broken)).Wait()
+	c.Assert(err, DeepEquals, loadErr)
+
+	_, err = s.engine.LoadAsync(filepath.Join(c.MkDir(), "missing.qml"), nil).Wait()
+	c.Assert(err, NotNil)
+}
+
+func (s *S) TestLoadURL(c *C) {
+	files := map[string]string{
+		"/app/main.qml":  "import QtQuick 2.0\nChild { property int value: child + 1 }",
+		"/app/Child.qml": "import QtQuick 2.0\nItem { property int child: 41 }",
+		"/app/bad.qml":   "import QtQuick 2.0\nItem {\n    bogus: 1\n}",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if data, ok := files[req.URL.Path]; ok {
+			w.Write([]byte(data))
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	// Child.qml is resolved relative to the remote document.
+	component, err := s.engine.LoadURL(server.URL + "/app/main.qml")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	c.Assert(obj.Int("value"), Equals, 42)
+	obj.Destroy()
+
+	_, err = s.engine.LoadURL(server.URL + "/app/bad.qml")
+	errs, ok := err.(qml.ComponentErrors)
+	c.Assert(ok, Equals, true, Commentf("error: %#v", err))
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0].URL, Equals, server.URL+"/app/bad.qml")
+	c.Assert(errs[0].Line, Equals, 3)
+
+	dir := c.MkDir()
+	for _, name := range []string{"main.qml", "Child.qml"} {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(files["/app/"+name]), 0644), IsNil)
+	}
+	component, err = s.engine.LoadURL("file://" + filepath.ToSlash(dir) + "/main.qml")
+	c.Assert(err, IsNil)
+	obj = component.Create(nil)
+	c.Assert(obj.Int("value"), Equals, 42)
+	obj.Destroy()
+
+	for _, bad := range []struct{ url, err string }{
+		{"%zz", `cannot load from malformed URL "%zz": .*`},
+		{"main.qml", `cannot load from URL "main.qml": scheme missing`},
+		{"ftp://example.com/main.qml", `cannot load from URL "ftp://example.com/main.qml": unsupported scheme "ftp"`},
+		{"http:///main.qml", `cannot load from URL "http:///main.qml": host missing`},
+		{"qrc:main.qml", `cannot load from URL "qrc:main.qml": path must be absolute`},
+	} {
+		_, err := s.engine.LoadURL(bad.url)
+		c.Assert(err, ErrorMatches, bad.err)
+	}
+}
+
+func (s *S) TestPrecompileIdle(c *C) {
+	dir := c.MkDir()
+	screen := filepath.Join(dir, "screen.qml")
+	broken := filepath.Join(dir, "broken.qml")
+	later := filepath.Join(dir, "later.qml")
+	c.Assert(ioutil.WriteFile(screen, []byte("import QtQuick 2.0\nItem { property int value: 42 }"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(broken, []byte("import QtQuick 2.0\nItem { bogus: 1 }"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(later, []byte("import QtQuick 2.0\nItem { property int value: 7 }"), 0644), IsNil)
+
+	job := s.engine.PrecompileIdle([]string{screen, broken})
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		c.Fatalf("documents not precompiled")
+	}
+	done, total, current := job.Progress()
+	c.Assert(done, Equals, 2)
+	c.Assert(total, Equals, 2)
+	c.Assert(current, Equals, "")
+	errs := job.Errors()
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[broken], ErrorMatches, ".*bogus.*")
+
+	// The compiled component is handed over to LoadFile.
+	component, err := s.engine.LoadFile(screen)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	c.Assert(obj.Int("value"), Equals, 42)
+	obj.Destroy()
+	_, err = s.engine.LoadFile(broken)
+	c.Assert(err, ErrorMatches, ".*bogus.*")
+
+	// Canceled jobs skip the documents not yet started, and documents
+	// are loaded as usual either way.
+	job = s.engine.PrecompileIdle([]string{later})
+	job.Cancel()
+	<-job.Done()
+	_, total, _ = job.Progress()
+	c.Assert(total, Equals, 1)
+	component, err = s.engine.LoadFile(later)
+	c.Assert(err, IsNil)
+	obj = component.Create(nil)
+	c.Assert(obj.Int("value"), Equals, 7)
+	obj.Destroy()
+}
+
+func (s *S) TestWindowSceneStats(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 100; height: 100
+			Rectangle { Rectangle {} }
+			Repeater { model: 2; Item {} }
+		}
+	`)
+	c.Assert(err, IsNil)
+	win := component.CreateWindow(nil)
+	defer win.Destroy()
+
+	stats, err := win.SceneStats()
+	c.Assert(err, Equals, qml.ErrUnsupported)
+	c.Assert(stats, Equals, qml.SceneStats{Items: 6, Nodes: -1, TextureBytes: -1})
+	c.Assert(win.SetStatsOverlay(true), Equals, qml.ErrUnsupported)
+}
+
+func (s *S) TestUncaughtException(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			signal fire(int n)
+			onFire: { throw new TypeError("boom " + n) }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	errs := make(chan *qml.JSError, 100)
+	s.engine.OnUncaughtException(func(err *qml.JSError) { errs <- err })
+
+	next := func() *qml.JSError {
+		select {
+		case err := <-errs:
+			return err
+		case <-time.After(3 * time.Second):
+			c.Fatalf("uncaught exception not reported")
+		}
+		return nil
+	}
+
+	for i := 0; i < 15; i++ {
+		obj.Emit("fire", i)
+	}
+	for i := 0; i < 10; i++ {
+		err := next()
+		c.Assert(err.Name, Equals, "TypeError")
+		c.Assert(err.Message, Equals, fmt.Sprintf("boom %d", i))
+		c.Assert(err.URL, Matches, ".*file.qml")
+		c.Assert(err.Line, Equals, 5)
+		c.Assert(err.Suppressed, Equals, 0)
+	}
+	select {
+	case err := <-errs:
+		c.Fatalf("exception reported past the rate limit: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	time.Sleep(1 * time.Second)
+	obj.Emit("fire", 42)
+	last := next()
+	c.Assert(last.Message, Equals, "boom 42")
+	c.Assert(last.Suppressed, Equals, 5)
+}
+
+func (s *S) TestObjectCensus(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item { Rectangle {} Rectangle {} }
+	`)
+	c.Assert(err, IsNil)
+
+	before := s.engine.ObjectCensus()
+	for i := 0; i < 3; i++ {
+		obj := component.Create(nil)
+		defer obj.Destroy()
+	}
+	after := s.engine.ObjectCensus()
+	c.Assert(after.Total-before.Total >= 9, Equals, true)
+
+	deltas := before.Diff(after)
+	c.Assert(len(deltas) >= 2, Equals, true)
+	c.Assert(deltas[0].Class, Equals, "QQuickRectangle")
+	c.Assert(deltas[0].After-deltas[0].Before, Equals, 6)
+	c.Assert(deltas[0].URL, Matches, ".*file.qml")
+	c.Assert(after.Diff(before), HasLen, 0)
+}
+
+func (s *S) TestReload(c *C) {
+	dir := c.MkDir()
+	mainPath := filepath.Join(dir, "main.qml")
+	childPath := filepath.Join(dir, "Child.qml")
+	writeFile := func(path, content string) {
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+	}
+	writeFile(mainPath, "import QtQuick 2.0\nItem { width: 100; height: 100; property alias child: child; Child { id: child } }")
+	writeFile(childPath, "import QtQuick 2.0\nItem { property string label: greeting + ' one' }")
+
+	s.context.SetVar("greeting", "hello")
+	component, err := s.engine.LoadFile(mainPath)
+	c.Assert(err, IsNil)
+	win := component.CreateWindow(nil)
+	defer win.Destroy()
+	win.SetSize(200, 150)
+	c.Assert(win.Root().Object("child").String("label"), Equals, "hello one")
+
+	// Imported files are only read again once the cache is cleared.
+	writeFile(childPath, "import QtQuick 2.0\nItem { property string label: greeting + ' two' }")
+	s.engine.ClearComponentCache()
+	component, err = s.engine.LoadFile(mainPath)
+	c.Assert(err, IsNil)
+	c.Assert(win.Recreate(component, nil), IsNil)
+	c.Assert(win.Root().Object("child").String("label"), Equals, "hello two")
+	c.Assert(win.Root().Int("width"), Equals, 200)
+	width, height := win.Size()
+	c.Assert([]int{width, height}, DeepEquals, []int{200, 150})
+
+	reloader := qml.NewReloader(win, mainPath, nil)
+	writeFile(childPath, "import QtQuick 2.0\nItem { property string label: greeting + ' three' }")
+	c.Assert(reloader.Reload(), IsNil)
+	c.Assert(win.Root().Object("child").String("label"), Equals, "hello three")
+
+	// Broken content leaves the window untouched.
+	writeFile(childPath, "import QtQuick 2.0\nItem { bogus: 1 }")
+	c.Assert(reloader.Reload(), ErrorMatches, `(?s).*Child.qml.*`)
+	c.Assert(win.Root().Object("child").String("label"), Equals, "hello three")
+
+	errors := make(chan error, 10)
+	reloader.OnError(func(err error) { errors <- err })
+	reloader.Watch(dir, 10*time.Millisecond)
+	defer reloader.Stop()
+
+	writeFile(childPath, "import QtQuick 2.0\nItem { property string label: greeting + ' four!' }")
+	for i := 0; win.Root().Object("child").String("label") != "hello four!"; i++ {
+		if i == 300 {
+			c.Fatalf("watched change not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	writeFile(childPath, "import QtQuick 2.0\nItem { bogus: 2 }")
+	select {
+	case err := <-errors:
+		c.Assert(err, ErrorMatches, `(?s).*Child.qml.*`)
+	case <-time.After(3 * time.Second):
+		c.Fatalf("reload error not reported")
+	}
+	c.Assert(win.Root().Object("child").String("label"), Equals, "hello four!")
+}
+
+func (s *S) TestWindowSnapshot(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nRectangle { width: 30; height: 20; color: '#ff0000' }")
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+
+	presented := make(chan bool, 1)
+	window.OnFirstFrame(func() { presented <- true })
+	window.Show()
+	select {
+	case <-presented:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("window was not rendered")
+	}
+
+	img, err := window.Snapshot()
+	c.Assert(err, IsNil)
+	w, h := window.Size()
+	c.Assert(img.Bounds().Dx() >= w && img.Bounds().Dy() >= h, Equals, true)
+	c.Assert(color.NRGBAModel.Convert(img.At(w/2, h/2)), Equals, color.NRGBA{255, 0, 0, 255})
+
+	data, err := window.SnapshotEncoded("PNG", -1)
+	c.Assert(err, IsNil)
+	img, err = png.Decode(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(color.NRGBAModel.Convert(img.At(w/2, h/2)), Equals, color.NRGBA{255, 0, 0, 255})
+
+	_, err = window.SnapshotEncoded("bogus", -1)
+	c.Assert(err, ErrorMatches, `cannot snapshot window: cannot encode image as "bogus": available formats are .*png.*`)
+	_, err = window.SnapshotEncoded("png", 101)
+	c.Assert(err, ErrorMatches, "cannot snapshot window: invalid quality 101")
+
+	window.Destroy()
+	_, err = window.Snapshot()
+	c.Assert(err, ErrorMatches, "cannot snapshot window: window was destroyed")
+	_, err = window.SnapshotEncoded("png", -1)
+	c.Assert(err, ErrorMatches, "cannot snapshot window: window was destroyed")
+}
+
+func (s *S) largeWindow(c *C) *qml.Window {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nRectangle { width: 3840; height: 2160; gradient: Gradient { GradientStop { position: 0; color: 'red' } GradientStop { position: 1; color: 'blue' } } }")
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	presented := make(chan bool, 1)
+	window.OnFirstFrame(func() { presented <- true })
+	window.Show()
+	select {
+	case <-presented:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("window was not rendered")
+	}
+	return window
+}
+
+func (s *S) BenchmarkSnapshotPNG4K(c *C) {
+	window := s.largeWindow(c)
+	defer window.Destroy()
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		img, err := window.Snapshot()
+		if err != nil {
+			c.Fatal(err)
+		}
+		if err := png.Encode(ioutil.Discard, img); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+func (s *S) BenchmarkSnapshotEncodedPNG4K(c *C) {
+	window := s.largeWindow(c)
+	defer window.Destroy()
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		if _, err := window.SnapshotEncoded("png", -1); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+func (s *S) TestWindowWait(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 30; height: 20 }")
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+
+	// Never shown, and hidden before waiting.
+	window.Wait()
+	window.Show()
+	window.Hide()
+	window.Wait()
+
+	waitAll := func(n int) chan bool {
+		done := make(chan bool, n)
+		for i := 0; i < n; i++ {
+			go func() {
+				window.Wait()
+				done <- true
+			}()
+		}
+		return done
+	}
+	checkReleased := func(done chan bool, n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				c.Fatalf("waiter %d was not released", i)
+			}
+		}
+	}
+
+	window.Show()
+	done := waitAll(2)
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		c.Fatalf("waiter released while the window is visible")
+	default:
+	}
+	window.Hide()
+	checkReleased(done, 2)
+
+	// Waiting again on the same window works.
+	window.Show()
+	done = waitAll(1)
+	time.Sleep(50 * time.Millisecond)
+	window.Hide()
+	checkReleased(done, 1)
+
+	window.Show()
+	done = waitAll(2)
+	time.Sleep(50 * time.Millisecond)
+	window.Destroy()
+	checkReleased(done, 2)
+	window.Wait()
+}
+
+func (s *S) TestWindowOnHide(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 30; height: 20 }")
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+
+	hidden := make(chan int, 10)
+	window.OnHide(func() { hidden <- 1 })
+	window.OnHide(func() { hidden <- 2 })
+
+	// Hiding a window programmatically is not an attempt to close it.
+	// See TestCloseAll for closing it instead.
+	closing := 0
+	window.OnClosing(func(ev *qml.CloseEvent) {
+		closing++
+		ev.Ignore()
+	})
+
+	for i := 0; i < 2; i++ {
+		window.Show()
+		window.Hide()
+		for _, want := range []int{1, 2} {
+			select {
+			case got := <-hidden:
+				c.Assert(got, Equals, want)
+			case <-time.After(3 * time.Second):
+				c.Fatalf("hide function %d not called", want)
+			}
+		}
+	}
+	c.Assert(closing, Equals, 0)
+}
+
+func (s *S) TestCloseAll(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 30; height: 20 }")
+	c.Assert(err, IsNil)
+
+	var closing []string
+	vetoes := map[string]bool{"doc2": true, "main": true}
+	create := func(name, group string) *qml.Window {
+		win := component.CreateWindow(nil)
+		win.SetGroup(group)
+		win.OnClosing(func(ev *qml.CloseEvent) {
+			closing = append(closing, name)
+			if vetoes[name] {
+				ev.Ignore()
+			}
+		})
+		win.Show()
+		return win
+	}
+	visible := func(win *qml.Window) bool {
+		done := make(chan bool)
+		go func() {
+			win.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return false
+		case <-time.After(100 * time.Millisecond):
+			return true
+		}
+	}
+
+	main := create("main", "")
+	defer main.Destroy()
+	doc1 := create("doc1", "docs")
+	defer doc1.Destroy()
+	doc2 := create("doc2", "docs")
+	defer doc2.Destroy()
+	c.Assert(doc2.Group(), Equals, "docs")
+
+	released := make(chan bool)
+	go func() {
+		doc1.Wait()
+		close(released)
+	}()
+
+	err = qml.CloseGroup("docs", 0)
+	c.Assert(err, FitsTypeOf, &qml.CloseVetoError{})
+	c.Assert(err.(*qml.CloseVetoError).Window, Equals, doc2)
+	c.Assert(err.(*qml.CloseVetoError).Forced, Equals, false)
+	c.Assert(closing, DeepEquals, []string{"doc2"})
+	c.Assert(visible(doc1), Equals, true)
+
+	vetoes["doc2"] = false
+	c.Assert(qml.CloseGroup("docs", 0), IsNil)
+	c.Assert(closing, DeepEquals, []string{"doc2", "doc2", "doc1"})
+	select {
+	case <-released:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("Wait not released by CloseGroup")
+	}
+	c.Assert(visible(main), Equals, true)
+
+	// The main window never closes by itself, so it's hidden at the deadline.
+	err = qml.CloseAll(100 * time.Millisecond)
+	c.Assert(err, FitsTypeOf, &qml.CloseVetoError{})
+	c.Assert(err.(*qml.CloseVetoError).Window, Equals, main)
+	c.Assert(err.(*qml.CloseVetoError).Forced, Equals, true)
+	c.Assert(visible(main), Equals, false)
+
+	// The GUI event loop is still running after all windows are closed.
+	c.Assert(qml.CloseAll(0), IsNil)
+	main.Show()
+	c.Assert(main.Close(), Equals, false)
+	vetoes["main"] = false
+	c.Assert(main.Close(), Equals, true)
+	c.Assert(visible(main), Equals, false)
+}
+
+func (s *S) TestWindowFirstFrame(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nRectangle { width: 300; height: 200; color: 'black' }")
+	c.Assert(err, IsNil)
+
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+
+	frames := make(chan int, 10)
+	window.OnFirstFrame(func() { frames <- 1 })
+	window.ShowWhenReady()
+
+	select {
+	case <-frames:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("first frame was never presented")
+	}
+
+	// Handlers provided afterwards run right away.
+	window.OnFirstFrame(func() { frames <- 2 })
+	c.Assert(<-frames, Equals, 2)
+
+	// Hide and show cycles do not fire handlers again.
+	window.Hide()
+	time.Sleep(100 * time.Millisecond)
+	window.Show()
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(len(frames), Equals, 0)
+}
+
+func (s *S) TestCreationLocation(c *C) {
+	component, err := s.engine.LoadString("file.qml", `import QtQuick 2.0
+Item {
+    Item { objectName: "child" }
+    property var dynamic: Qt.createQmlObject("import QtQuick 2.0\nItem {}", this, "dynamic.qml")
+}`)
+	c.Assert(err, IsNil)
+	root := component.Create(nil)
+	defer root.Destroy()
+
+	url, line, column, ok := root.CreationLocation()
+	c.Assert(ok, Equals, true)
+	c.Assert(url, Matches, ".*file.qml")
+	c.Assert([]int{line, column}, DeepEquals, []int{2, 1})
+
+	url, line, column, ok = root.ObjectByName("child").CreationLocation()
+	c.Assert(ok, Equals, true)
+	c.Assert(url, Matches, ".*file.qml")
+	c.Assert([]int{line, column}, DeepEquals, []int{3, 5})
+
+	url, line, _, ok = root.Object("dynamic").CreationLocation()
+	c.Assert(ok, Equals, true)
+	c.Assert(url, Matches, ".*dynamic.qml")
+	c.Assert(line, Equals, 2)
+}
+
+func (s *S) TestRequiredContextVars(c *C) {
+	s.context.SetVar("present", 1)
+	component, err := s.engine.LoadString("file.qml", `import QtQuick 2.0
+Item {
+    property int a: present + missingB
+    property int b: missingA
+    Component.onCompleted: missingB
+}`)
+	c.Assert(err, IsNil)
+
+	c.Assert(component.RequiredContextVars(), DeepEquals, []string{"missingA", "missingB"})
+
+	uses := component.RequiredContextVarUses()
+	c.Assert(uses, HasLen, 3)
+	var lines []int
+	for _, use := range uses {
+		c.Assert(use.File(), Matches, ".*file.qml")
+		c.Assert(use.Text(), Matches, "ReferenceError: missing. is not defined")
+		lines = append(lines, use.Line())
+	}
+	sort.Ints(lines)
+	c.Assert(lines, DeepEquals, []int{3, 4, 5})
+
+	s.context.SetVar("missingA", 2)
+	s.context.SetVar("missingB", 3)
+	c.Assert(component.RequiredContextVars(), HasLen, 0)
+}
+
+func (s *S) TestClipboard(c *C) {
+	clipboard := qml.Clipboard()
+	c.Assert(clipboard.Supported(), Equals, true)
+
+	changed := make(chan bool, 10)
+	clipboard.OnChanged(func() { changed <- true })
+	defer clipboard.OnChanged(nil)
+
+	clipboard.SetText("Hello clipboard")
+	c.Assert(clipboard.Text(), Equals, "Hello clipboard")
+	select {
+	case <-changed:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("clipboard change not reported")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+	img.Set(1, 1, color.NRGBA{0, 0, 255, 128})
+	clipboard.SetImage(img)
+	c.Assert(clipboard.Image(), DeepEquals, img)
+
+	clipboard.Clear()
+	c.Assert(clipboard.Text(), Equals, "")
+	c.Assert(clipboard.Image(), IsNil)
+}
+
+func (s *S) TestDialogErrors(c *C) {
+	// Dialogs wait for the user, so only the failures that happen
+	// before showing them are tested.
+	_, err := qml.OpenFilesDialog(nil, qml.FileDialogOptions{Save: true})
+	c.Assert(err, ErrorMatches, "cannot choose multiple files for saving")
+
+	c.Assert(func() {
+		qml.RunMain(func() { qml.MessageBox(nil, qml.MessageBoxOptions{Text: "Hello"}) })
+	}, PanicMatches, "cannot show a dialog from within the main GUI thread")
+}
+
+type AsyncWorker struct {
+	mutex sync.Mutex
+	order []string
+}
+
+func (w *AsyncWorker) Work(name string, delay int) (string, error) {
+	time.Sleep(time.Duration(delay) * time.Millisecond)
+	w.mutex.Lock()
+	w.order = append(w.order, name)
+	w.mutex.Unlock()
+	if name == "bad" {
+		return "", fmt.Errorf("bad work")
+	}
+	if name == "boom" {
+		panic("boom")
+	}
+	return "done " + name, nil
+}
+
+func (w *AsyncWorker) Spawn(name string) *qml.AsyncCall {
+	return qml.Async(func() (interface{}, error) { return "spawned " + name, nil })
+}
+
+func (s *S) TestAsyncMethods(c *C) {
+	qml.SetTypeAsync(&AsyncWorker{}, qml.SerialAsync, "Work")
+	defer qml.SetTypeAsync(&AsyncWorker{}, qml.SerialAsync)
+
+	worker := &AsyncWorker{}
+	s.context.SetVar("worker", worker)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property var outcomes: []
+			property int finished: 0
+			function run(name, delay) {
+				var call = name == "spawn" ? worker.spawn("x") : worker.work(name, delay)
+				call.finished.connect(function(result, error) {
+					outcomes.push(error ? "error: " + error : result)
+					finished++
+				})
+				return call.done
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	// The slow call is queued first, so it finishes first.
+	c.Assert(obj.Call("run", "slow", 100), Equals, false)
+	c.Assert(obj.Call("run", "fast", 0), Equals, false)
+	c.Assert(obj.Call("run", "bad", 0), Equals, false)
+	c.Assert(obj.Call("run", "boom", 0), Equals, false)
+	c.Assert(obj.Call("run", "spawn", 0), Equals, false)
+	for i := 0; i < 300 && obj.Int("finished") < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(obj.Int("finished"), Equals, 5)
+
+	worker.mutex.Lock()
+	c.Assert(worker.order, DeepEquals, []string{"slow", "fast", "bad", "boom"})
+	worker.mutex.Unlock()
+
+	outcomes, ok := obj.Property("outcomes").([]string)
+	c.Assert(ok, Equals, true)
+	sort.Strings(outcomes)
+	c.Assert(outcomes, DeepEquals, []string{"done fast", "done slow", "error: bad work", "error: panic: boom", "spawned x"})
+}
+
+func (s *S) TestTranslation(c *C) {
+	err := qml.LoadTranslation("/non/existent.qm")
+	c.Assert(err, ErrorMatches, `cannot load translation from "/non/existent.qm"`)
+	qml.RemoveTranslation()
+
+	err = s.engine.Retranslate()
+	if err != nil {
+		c.Assert(err, Equals, qml.ErrUnsupported)
+	}
+
+	locale := qml.Locale()
+	defer qml.SetLocale(locale)
+	qml.SetLocale("pt_BR")
+	c.Assert(qml.Locale(), Equals, "pt_BR")
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item { property string name: Qt.locale().name }
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.String("name"), Equals, "pt_BR")
+}
+
+func (s *S) TestEngineLocale(c *C) {
+	locale := qml.Locale()
+	defer qml.SetLocale(locale)
+
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+	c.Assert(engine.SetLocale("de-DE"), IsNil)
+	c.Assert(engine.Locale(), Equals, "de-DE")
+	c.Assert(qml.Locale(), Equals, "de_DE")
+
+	component, err := engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string name: Qt.locale().name
+			property string number: Number(1234.5).toLocaleString(Qt.locale(), "f", 1)
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.String("name"), Equals, "de_DE")
+	c.Assert(obj.String("number"), Equals, "1.234,5")
+
+	c.Assert(engine.SetLocale("pt_BR"), IsNil)
+	c.Assert(engine.Locale(), Equals, "pt-BR")
+	if engine.Retranslate() == nil {
+		// Bindings are only reevaluated with Qt 5.10 and later.
+		c.Assert(obj.String("name"), Equals, "pt_BR")
+	}
+
+	c.Assert(engine.SetLocale("xx"), ErrorMatches, `cannot set locale: unknown locale "xx"`)
+	c.Assert(engine.SetLocale("en-ZZ"), ErrorMatches, `cannot set locale: unknown locale "en-ZZ"`)
+	c.Assert(engine.Locale(), Equals, "pt-BR")
+}
+
+type BoundSettings struct {
+	UserName string `qmlobserver:"CheckUserName"`
+	Volume   int
+}
+
+func (s *BoundSettings) CheckUserName(old, new interface{}) error {
+	if new == "" {
+		return fmt.Errorf("user name must not be empty")
+	}
+	return nil
+}
+
+func (s *S) TestFieldBinding(c *C) {
+	settings := &BoundSettings{}
+	var changes []string
+	qml.SetFieldObserver(settings, "Volume", func(old, new interface{}) error {
+		changes = append(changes, fmt.Sprintf("%v->%v", old, new))
+		return nil
+	})
+	defer qml.SetFieldObserver(settings, "Volume", nil)
+
+	s.context.SetVar("settings", settings)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string input: "alice"
+			property string shownName: settings.userName
+			property int shownVolume: settings.volume
+			Binding { target: settings; property: "userName"; value: input }
+			function setVolume(v) { settings.volume = v }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	// Writes from QML reach the Go field, and other bindings follow.
+	c.Assert(settings.UserName, Equals, "alice")
+	c.Assert(obj.String("shownName"), Equals, "alice")
+	obj.Set("input", "bob")
+	c.Assert(settings.UserName, Equals, "bob")
+	c.Assert(obj.String("shownName"), Equals, "bob")
+
+	// The tagged observer rejects empty names.
+	obj.Set("input", "")
+	c.Assert(settings.UserName, Equals, "bob")
+	c.Assert(obj.String("shownName"), Equals, "bob")
+
+	obj.Call("setVolume", 3)
+	obj.Call("setVolume", 3)
+	c.Assert(qml.SetField(settings, "Volume", 5), IsNil)
+	c.Assert(obj.Int("shownVolume"), Equals, 5)
+	c.Assert(changes, DeepEquals, []string{"0->3", "3->3"})
+
+	c.Assert(qml.SetField(settings, "Missing", 1), ErrorMatches, `cannot set field "Missing": \*qml_test.BoundSettings has no such exported field`)
+	c.Assert(qml.SetField(settings, "Volume", "loud"), ErrorMatches, `cannot set field "Volume": cannot use value "loud" as int`)
+
+	// Interleaved writes from Go and QML leave both sides agreeing
+	// on whichever write happened last.
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 50; i++ {
+			qml.SetField(settings, "Volume", 1000+i)
+		}
+		done <- true
+	}()
+	for i := 0; i < 50; i++ {
+		obj.Call("setVolume", i)
+	}
+	<-done
+	var volume int
+	qml.RunMain(func() { volume = settings.Volume })
+	c.Assert(obj.Int("shownVolume"), Equals, volume)
+}
+
+func (s *S) TestRunErrors(c *C) {
+	// The package is initialized by the test suite, and tests run
+	// out of the main goroutine, so Run fails without running f.
+	called := false
+	err := qml.Run(func() error { called = true; return nil })
+	c.Assert(err, ErrorMatches, "qml.Run must be called from the main goroutine")
+	c.Assert(called, Equals, false)
+
+	// Quit has no effect out of Run.
+	qml.Quit()
+	qml.Quit()
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 42 }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Int("width"), Equals, 42)
+}
+
+func (s *S) TestRendererErrors(c *C) {
+	c.Assert(qml.IsRenderer(), Equals, false)
+	c.Assert(qml.ServeRenderer(), ErrorMatches, "cannot serve renderer: process was not started by SpawnRenderer")
+
+	_, err := qml.SpawnRenderer(c.MkDir()+"/missing", "file.qml", qml.RemoteOptions{})
+	c.Assert(err, ErrorMatches, "cannot start renderer: .*")
+
+	opts := qml.RemoteOptions{Vars: map[string]interface{}{"obj": struct{}{}}}
+	_, err = qml.SpawnRenderer("renderer", "file.qml", opts)
+	c.Assert(err, ErrorMatches, `cannot set variable "obj": cannot send struct {} value to renderer`)
+}
+
+func (s *S) TestWatchdog(c *C) {
+	stalls := make(chan qml.StallReport, 10)
+	resumes := make(chan time.Duration, 10)
+	w := qml.StartWatchdog(10*time.Millisecond, 100*time.Millisecond, func(r qml.StallReport) { stalls <- r })
+	w.OnResume(func(stalled time.Duration) { resumes <- stalled })
+	w.SetRefireInterval(time.Hour)
+	defer w.Stop()
+
+	// A busy GUI thread within the threshold isn't a stall.
+	qml.RunMain(func() { time.Sleep(20 * time.Millisecond) })
+
+	qml.RunMain(func() { time.Sleep(400 * time.Millisecond) })
+	select {
+	case r := <-stalls:
+		c.Assert(r.Stalled >= 100*time.Millisecond, Equals, true)
+		c.Assert(r.Operation, Matches, `.*TestWatchdog\.func.*`)
+		c.Assert(string(r.Stacks), Matches, `(?s)goroutine \d+.*`)
+	case <-time.After(3 * time.Second):
+		c.Fatalf("stall not reported")
+	}
+	select {
+	case stalled := <-resumes:
+		c.Assert(stalled >= 300*time.Millisecond, Equals, true)
+	case <-time.After(3 * time.Second):
+		c.Fatalf("resume not reported")
+	}
+
+	// Further stalls within the refire interval aren't reported.
+	qml.RunMain(func() { time.Sleep(300 * time.Millisecond) })
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(len(stalls), Equals, 0)
+	c.Assert(len(resumes), Equals, 0)
+}
+
+func (s *S) TestRunMain(c *C) {
+	var order []int
+	qml.RunMain(func() {
+		order = append(order, 1)
+		qml.RunMain(func() {
+			order = append(order, 2)
+		})
+		order = append(order, 3)
+	})
+	c.Assert(order, DeepEquals, []int{1, 2, 3})
+
+	c.Assert(func() { qml.RunMain(func() { panic("boom") }) }, PanicMatches, "boom")
+
+	// The event loop keeps working after a panic.
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 42 }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	qml.RunMain(func() { order = append(order, obj.Int("width")) })
+	c.Assert(order, DeepEquals, []int{1, 2, 3, 42})
+}
+
+func (s *S) TestPropertyPaths(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import QtQuick.Layouts 1.0
+		RowLayout {
+			Text { objectName: "text" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	text := obj.ObjectByName("text")
+
+	c.Assert(text.Set("layer.enabled", true), IsNil)
+	c.Assert(text.Set("layer.samples", 4), IsNil)
+	c.Assert(text.Bool("layer.enabled"), Equals, true)
+	c.Assert(text.Int("layer.samples"), Equals, 4)
+
+	c.Assert(text.Set("anchors.margins", 10), IsNil)
+	c.Assert(text.Float64("anchors.margins"), Equals, 10.0)
+
+	c.Assert(text.Set("font.pixelSize", 14), IsNil)
+	c.Assert(text.Int("font.pixelSize"), Equals, 14)
+
+	c.Assert(text.Bool("Layout.fillWidth"), Equals, false)
+	c.Assert(text.Set("Layout.fillWidth", true), IsNil)
+	c.Assert(text.Bool("Layout.fillWidth"), Equals, true)
+
+	c.Assert(text.Set("anchors.bogus", 1), ErrorMatches, `object has no property "anchors.bogus": cannot find "bogus"`)
+	c.Assert(text.Set("bogus.margins", 1), ErrorMatches, `object has no property "bogus.margins": cannot find "bogus"`)
+	c.Assert(text.Set("Layout.bogus", 1), ErrorMatches, `object has no property "Layout.bogus": cannot find "bogus"`)
+	c.Assert(text.Set("layer.samples", "many"), ErrorMatches, `cannot assign string to property "layer.samples" of type int`)
+	c.Assert(func() { text.Property("font.bogus") }, PanicMatches, `object does not have a "font.bogus" property: cannot find "bogus"`)
+}
+
+func (s *S) TestEngineObjectOf(c *C) {
+	value := &TestType{StringValue: "<content>"}
+	_, err := s.engine.ObjectOf(value)
+	c.Assert(err, ErrorMatches, `cannot find object for \*qml_test.TestType: value is not held by the engine`)
+	_, err = s.engine.ObjectOf([]int{1})
+	c.Assert(err, ErrorMatches, `cannot find object for \[\]int: value is not held by the engine`)
+
+	s.context.SetVar("value", value)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			function same(obj) { return obj === value }
+			function content(obj) { return obj.stringValue }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	vobj, err := s.engine.ObjectOf(value)
+	c.Assert(err, IsNil)
+	again, err := s.engine.ObjectOf(value)
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, vobj)
+
+	c.Assert(vobj.String("stringValue"), Equals, "<content>")
+	c.Assert(vobj.Set("stringValue", "<new>"), IsNil)
+	c.Assert(value.StringValue, Equals, "<new>")
+	c.Assert(obj.Call("same", vobj), Equals, true)
+	c.Assert(obj.Call("content", vobj), Equals, "<new>")
+}
+
+type OptInType struct {
+	ID     string
+	Name   string `qml:"name"`
+	Secret string `qml:"-"`
+}
+
+func (s *S) TestExposureOptIn(c *C) {
+	qml.SetTypeExposure(&OptInType{}, qml.OptIn)
+	defer qml.SetTypeExposure(&OptInType{}, qml.DefaultExposure)
+
+	s.context.SetVar("value", &OptInType{ID: "id-1", Name: "<name>", Secret: "<secret>"})
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string name: value.name
+			property bool hidden: value.iD === undefined && value.id === undefined && value.secret === undefined
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.String("name"), Equals, "<name>")
+	c.Assert(obj.Bool("hidden"), Equals, true)
+
+	// Other conversion paths agree on the exposed fields.
+	list := qml.NewList([]OptInType{{ID: "id-2", Name: "<listed>"}})
+	defer list.Destroy()
+	err = list.Append(map[string]interface{}{"iD": "id-3"})
+	c.Assert(err, ErrorMatches, `cannot insert list item 1: list has no "iD" role`)
+
+	var scanned OptInType
+	c.Assert(obj.Scan(&scanned), IsNil)
+	c.Assert(scanned, Equals, OptInType{Name: "<name>"})
+}
+
+type TaggedType struct {
+	URL      string `qml:"url"`
+	ID       int    `qml:"id"`
+	Password string `qml:"-"`
+	Title    string
+	OnSaved  func() `qml:"stored"`
+}
+
+type ClashingType struct {
+	Title string
+	Name  string `qml:"title"`
+}
+
+func (s *S) TestExposureTags(c *C) {
+	value := &TaggedType{URL: "http://example.com", ID: 42, Password: "<secret>", Title: "<title>"}
+	s.context.SetVar("value", value)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string url: value.url
+			property int ident: value.id
+			property string title: value.title
+			property bool hidden: value.uRL === undefined && value.password === undefined
+			property bool saved
+			Connections { target: value; onStored: saved = true }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.String("url"), Equals, "http://example.com")
+	c.Assert(obj.Int("ident"), Equals, 42)
+	c.Assert(obj.String("title"), Equals, "<title>")
+	c.Assert(obj.Bool("hidden"), Equals, true)
+	value.OnSaved()
+	c.Assert(obj.Bool("saved"), Equals, true)
+
+	// Other conversion paths agree on the names.
+	list := qml.NewList([]TaggedType{{URL: "http://a"}})
+	defer list.Destroy()
+	c.Assert(list.Append(map[string]interface{}{"url": "http://b", "id": 1}), IsNil)
+	err = list.Append(map[string]interface{}{"password": "<secret>"})
+	c.Assert(err, ErrorMatches, `cannot insert list item 2: list has no "password" role`)
+
+	err = qml.RegisterTypes("GoTypes", 4, 1, []qml.TypeSpec{{
+		Name: "ClashingType",
+		New:  func() interface{} { return &ClashingType{} },
+	}})
+	c.Assert(err, ErrorMatches, `cannot register type "ClashingType": field Title and field Name are both exposed to QML as "title"`)
+	c.Assert(func() { s.context.SetVar("clash", &ClashingType{}) }, PanicMatches, `cannot expose qml_test.ClashingType to QML: .*`)
+}
+
+type LazyType struct {
+	Text        string
+	Activations int
+	Panic       bool
+}
+
+func (v *LazyType) QMLActivate() {
+	v.Activations++
+	if v.Panic {
+		panic("activation failed")
+	}
+	v.Text = "<loaded>"
+}
+
+func (s *S) TestLazyValue(c *C) {
+	value := &LazyType{}
+	broken := &LazyType{Panic: true}
+	s.context.SetVar("value", value)
+	s.context.SetVar("again", value)
+	s.context.SetVar("broken", broken)
+	c.Assert(value.Activations, Equals, 1)
+	c.Assert(broken.Activations, Equals, 1)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string text: value.text
+			property int activations: broken.activations
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.String("text"), Equals, "<loaded>")
+	c.Assert(obj.Int("activations"), Equals, 1)
+	c.Assert(value.Activations, Equals, 1)
+
+	other := qml.NewEngine(nil)
+	defer other.Destroy()
+	other.Context().SetVar("value", value)
+	c.Assert(value.Activations, Equals, 2)
+}
+
+func (s *S) TestResources(c *C) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	var imgData bytes.Buffer
+	c.Assert(png.Encode(&imgData, img), IsNil)
+
+	var rp qml.ResourcesPacker
+	rp.Add("app/main.qml", []byte(`
+		import QtQuick 2.0
+		import "widgets"
+		import "logic.js" as Logic
+		Item {
+			property alias label: label
+			property alias image: image
+			Label { id: label; text: Logic.greeting() }
+			Image { id: image; source: "images/logo.png" }
+		}
+	`))
+	rp.Add("/app/widgets/Label.qml", []byte("import QtQuick 2.0\nText {}"))
+	rp.Add("app/logic.js", []byte("function greeting() { return 'hello' }"))
+	rp.Add("app/images/logo.png", imgData.Bytes())
+	rp.Add("app/broken.qml", []byte("import QtQuick 2.0\nItem { bogus: 1 }"))
+	c.Assert(func() { rp.Add("app/main.qml/x", nil) }, PanicMatches, `cannot add resource "app/main.qml/x": "app/main.qml" is both a file and a directory`)
+
+	r, err := qml.ParseResources(rp.Pack().Bytes())
+	c.Assert(err, IsNil)
+	qml.LoadResources(r)
+	defer qml.UnloadResources(r)
+
+	component, err := s.engine.LoadFile("qrc:///app/main.qml")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Object("label").String("text"), Equals, "hello")
+	c.Assert(obj.Object("image").Int("status"), Equals, 1) // Image.Ready
+	c.Assert(obj.Object("image").Int("sourceSize.width"), Equals, 4)
+
+	_, err = s.engine.LoadFile("qrc:///app/broken.qml")
+	c.Assert(err, ErrorMatches, `qrc:///app/broken.qml:2 .*`)
+	_, err = s.engine.LoadFile("qrc:///app/missing.qml")
+	c.Assert(err, ErrorMatches, `cannot open qrc:///app/missing.qml: resource not found`)
+
+	_, err = qml.ParseResources([]byte("bogus"))
+	c.Assert(err, ErrorMatches, "cannot parse resources: invalid header")
+}
+
+func (s *S) TestRegisterModule(c *C) {
+	var rp qml.ResourcesPacker
+	rp.Add("lib/widgets/qmldir", []byte(strings.Join([]string{
+		"module TestLib.Widgets",
+		"Button 1.0 Button10.qml",
+		"Button 1.1 Button11.qml",
+		"singleton Theme 1.0 Theme.qml",
+		"Util 1.0 util.js",
+	}, "\n")))
+	rp.Add("lib/widgets/Button10.qml", []byte("import QtQuick 2.0\nItem { property string version: '1.0' }"))
+	rp.Add("lib/widgets/Button11.qml", []byte("import QtQuick 2.0\nItem { property string version: '1.1' }"))
+	rp.Add("lib/widgets/Theme.qml", []byte("pragma Singleton\nimport QtQuick 2.0\nQtObject { property string color: 'red' }"))
+	rp.Add("lib/widgets/util.js", []byte(".pragma library\nfunction twice(n) { return n * 2 }"))
+	r := rp.Pack()
+
+	c.Assert(qml.RegisterModule("TestLib.Widgets", r, "lib/widgets"), IsNil)
+	c.Assert(qml.RegisterModule("TestLib.Widgets", r, "lib/widgets"), ErrorMatches, `cannot register module "TestLib.Widgets": module already registered`)
+	c.Assert(qml.RegisterModule("TestLib.Missing", r, "lib/missing"), ErrorMatches, `cannot register module "TestLib.Missing": cannot read resources: directory "lib/missing" not found`)
+	c.Assert(qml.RegisterModule("TestLib.Bad", r, "lib"), ErrorMatches, `cannot register module "TestLib.Bad": "lib" has no qmldir file`)
+	c.Assert(qml.RegisterModule("TestLib..Bad", r, "lib/widgets"), ErrorMatches, `cannot register module "TestLib..Bad": invalid URI`)
+
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+
+	for _, version := range []string{"1.0", "1.1"} {
+		component, err := engine.LoadString("file.qml", `
+			import QtQuick 2.0
+			import TestLib.Widgets `+version+`
+			Item {
+				property alias button: button
+				property string color: Theme.color
+				property int twice: Util.twice(21)
+				Button { id: button }
+			}
+		`)
+		c.Assert(err, IsNil)
+		obj := component.Create(nil)
+		c.Assert(obj.Object("button").String("version"), Equals, version)
+		c.Assert(obj.String("color"), Equals, "red")
+		c.Assert(obj.Int("twice"), Equals, 42)
+		obj.Destroy()
+	}
+}
+
+func (s *S) TestRegisterComponent(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "Gauge.qml")
+	err := ioutil.WriteFile(path, []byte("import QtQuick 2.0\nItem { property int value; property string kind: 'file' }"), 0644)
+	c.Assert(err, IsNil)
+
+	var rp qml.ResourcesPacker
+	rp.Add("components/Dial.qml", []byte("import QtQuick 2.0\nItem { property string kind: 'resource' }"))
+	r := rp.Pack()
+	qml.LoadResources(r)
+	defer qml.UnloadResources(r)
+
+	c.Assert(qml.RegisterComponent("TestApp.Components", 1, 0, "Gauge", path), IsNil)
+	c.Assert(qml.RegisterComponent("TestApp.Components", 1, 0, "Dial", "qrc:///components/Dial.qml"), IsNil)
+	c.Assert(qml.RegisterComponentData("TestApp.Components", 1, 0, "Label", []byte("import QtQuick 2.0\nItem { property string kind: 'data' }")), IsNil)
+
+	c.Assert(qml.RegisterComponent("TestApp.Components", 1, 0, "Gauge", path), ErrorMatches, `type "Gauge" is already registered in TestApp.Components 1.0`)
+	c.Assert(qml.RegisterComponent("TestApp.Components", 1, 0, "Missing", filepath.Join(dir, "Missing.qml")), ErrorMatches, `cannot register component "Missing": .*no such file or directory`)
+	c.Assert(qml.RegisterComponent("TestApp.Components", 1, 0, "Missing", "qrc:///components/Missing.qml"), ErrorMatches, `cannot register component "Missing": cannot open qrc:///components/Missing.qml: resource not found`)
+	c.Assert(qml.RegisterComponent("TestApp.Components", 1, 0, "lower", path), ErrorMatches, `cannot register component "lower": name must start with an uppercase letter.*`)
+	c.Assert(qml.RegisterComponent("TestApp..Components", 1, 0, "Gauge", path), ErrorMatches, `cannot register component "Gauge": invalid location "TestApp..Components"`)
+
+	// Components are found when loading documents from strings.
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import TestApp.Components 1.0
+		Item {
+			property var kinds: [gauge.kind, dial.kind, label.kind]
+			Gauge { id: gauge; value: 42 }
+			Dial { id: dial }
+			Label { id: label }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Property("kinds"), DeepEquals, []string{"file", "resource", "data"})
+
+	c.Assert(qml.RegisterComponent("TestApp.Components", 1, 0, "Late", path), ErrorMatches, `cannot register component "Late": module TestApp.Components was already imported by a loaded component`)
+}
+
+func (s *S) TestFocus(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 100; height: 100
+			TextInput { objectName: "a"; width: 50; height: 20 }
+			TextInput { objectName: "disabled"; enabled: false }
+			TextInput { objectName: "invisible"; visible: false }
+			QtObject { objectName: "plain" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+
+	changes := make(chan *qml.Object, 10)
+	window.OnFocusChanged(func(old, new *qml.Object) { changes <- new })
+	window.Show()
+
+	root := window.Root()
+	a := root.ObjectByName("a")
+	c.Assert(a.ForceFocus(qml.OtherFocusReason), IsNil)
+	c.Assert(window.FocusedObject() == a, Equals, a.HasFocus())
+	if a.HasFocus() {
+		select {
+		case obj := <-changes:
+			c.Assert(obj, Equals, a)
+		case <-time.After(3 * time.Second):
+			c.Fatalf("focus change not reported")
+		}
+	}
+
+	c.Assert(root.ObjectByName("disabled").ForceFocus(qml.TabFocusReason), ErrorMatches, "cannot focus disabled item")
+	c.Assert(root.ObjectByName("invisible").ForceFocus(qml.TabFocusReason), ErrorMatches, "cannot focus invisible item")
+	c.Assert(root.ObjectByName("plain").ForceFocus(qml.TabFocusReason), ErrorMatches, "cannot focus object: not a visual item")
+	c.Assert(root.ObjectByName("plain").HasFocus(), Equals, false)
+}
+
+type DropReceiver struct {
+	urls chan interface{}
+}
+
+func (r *DropReceiver) Dropped(urls interface{}) {
+	r.urls <- urls
+}
+
+func (s *S) TestDrop(c *C) {
+	receiver := &DropReceiver{make(chan interface{}, 10)}
+	s.context.SetVar("receiver", receiver)
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 200; height: 100
+			DropArea {
+				x: 100; width: 100; height: 100
+				onDropped: { receiver.dropped(drop.urls); drop.accept() }
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	type drop struct {
+		paths []string
+		x, y  float64
+	}
+	drops := make(chan drop, 10)
+	window.OnDrop(func(paths []string, x, y float64) bool {
+		drops <- drop{paths, x, y}
+		return x < 100
+	})
+
+	urls := []string{"file:///tmp/a.txt", "file:///tmp/b%20c.txt", "http://example.com/d"}
+	paths := []string{"/tmp/a.txt", "/tmp/b c.txt", "http://example.com/d"}
+
+	// Accepted by the window handler, so QML doesn't see it.
+	window.PostDropEvent(urls, 50, 50)
+	qml.Settle()
+	c.Assert(<-drops, DeepEquals, drop{paths, 50, 50})
+	c.Assert(len(receiver.urls), Equals, 0)
+
+	// Ignored by the window handler, and delivered to the DropArea.
+	window.PostDropEvent(urls[:1], 150, 50)
+	qml.Settle()
+	c.Assert(<-drops, DeepEquals, drop{paths[:1], 150, 50})
+	c.Assert(<-receiver.urls, DeepEquals, paths[:1])
+
+	window.OnDrop(nil)
+	window.PostDropEvent(urls, 150, 50)
+	qml.Settle()
+	c.Assert(len(drops), Equals, 0)
+	c.Assert(<-receiver.urls, DeepEquals, paths)
+}
+
+func (s *S) TestItemGeometry(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 200; height: 200
+			Item {
+				x: 10; y: 20
+				Rectangle { objectName: "box"; x: 5; y: 7; width: 30; height: 40 }
+			}
+			QtObject { objectName: "plain" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+
+	root := window.Root()
+	box := root.ObjectByName("box")
+	x, y, w, h := box.Geometry()
+	c.Assert([]float64{x, y, w, h}, DeepEquals, []float64{5, 7, 30, 40})
+
+	sx, sy := box.MapToScene(1, 2)
+	c.Assert([]float64{sx, sy}, DeepEquals, []float64{16, 29})
+	x, y = box.MapFromScene(sx, sy)
+	c.Assert([]float64{x, y}, DeepEquals, []float64{1, 2})
+
+	plain := root.ObjectByName("plain")
+	c.Assert(func() { plain.Geometry() }, Panics, "cannot get geometry of object: not a visual item")
+	c.Assert(func() { plain.MapToScene(0, 0) }, Panics, "cannot map point to scene: object is not a visual item")
+	c.Assert(func() { plain.MapFromScene(0, 0) }, Panics, "cannot map point from scene: object is not a visual item")
+}
+
+var updateGolden = flag.Bool("update-golden", false, "if provided, TestStateSnapshot rewrites its golden file")
+
+func (s *S) TestStateSnapshot(c *C) {
+	const qmlData = `
+		import QtQuick 2.0
+		Rectangle {
+			width: 200; height: 100; color: "red"
+			Rectangle {
+				objectName: "okButton"
+				width: 80; height: 30; color: "#00ff00"
+				Item { objectName: "label"; width: 40; height: 10 }
+			}
+			Item { width: 20; height: 20 }
+		}
+	`
+	component, err := s.engine.LoadString("file.qml", qmlData)
+	c.Assert(err, IsNil)
+	root := component.Create(nil)
+	defer root.Destroy()
+
+	props := []string{"width", "height", "color"}
+	snapshot, err := root.StateSnapshot(props, -1)
+	c.Assert(err, IsNil)
+
+	const golden = "testdata/snapshot.golden.json"
+	if *updateGolden {
+		data, err := json.MarshalIndent(snapshot, "", "\t")
+		c.Assert(err, IsNil)
+		c.Assert(ioutil.WriteFile(golden, append(data, '\n'), 0644), IsNil)
+	}
+	data, err := ioutil.ReadFile(golden)
+	c.Assert(err, IsNil)
+	var stored map[string]interface{}
+	c.Assert(json.Unmarshal(data, &stored), IsNil)
+	c.Assert(qml.DiffSnapshots(stored, snapshot), HasLen, 0)
+
+	// Changes are reported by path, and numbers may be compared with a tolerance.
+	root.ObjectByName("okButton").Set("width", 82)
+	c.Assert(root.ObjectByName("label").Set("objectName", ""), IsNil)
+	changed, err := root.StateSnapshot(props, -1)
+	c.Assert(err, IsNil)
+	var diffs []string
+	for _, d := range qml.DiffSnapshots(stored, changed) {
+		diffs = append(diffs, d.String())
+	}
+	c.Assert(diffs, DeepEquals, []string{
+		`children.okButton.children.#0: <missing> != map[height:10 width:40]`,
+		`children.okButton.children.label: map[height:10 width:40] != <missing>`,
+		`children.okButton.width: 80 != 82`,
+	})
+	diffs = nil
+	for _, d := range qml.DiffSnapshotsWithin(stored, changed, 5) {
+		diffs = append(diffs, d.String())
+	}
+	c.Assert(diffs, HasLen, 2)
+
+	// The depth limits the descendants included.
+	shallow, err := root.StateSnapshot(props, 0)
+	c.Assert(err, IsNil)
+	c.Assert(shallow, DeepEquals, map[string]interface{}{"width": 200.0, "height": 100.0, "color": "#ffff0000"})
+
+	_, err = root.StateSnapshot([]string{"width", "missing"}, -1)
+	c.Assert(err, ErrorMatches, `cannot snapshot object: object does not have a "missing" property`)
+}
+
+func (s *S) TestSceneFromGo(c *C) {
+	win := s.engine.NewWindow(200, 100)
+	defer win.Destroy()
+	root := win.Root()
+
+	button, err := s.engine.Item("Rectangle")
+	c.Assert(err, IsNil)
+	c.Assert(button.Set("color", "red"), IsNil)
+	button.SetGeometry(10, 20, 80, 30)
+	c.Assert(button.SetParentItem(root), IsNil)
+
+	area, err := s.engine.Item("MouseArea")
+	c.Assert(err, IsNil)
+	area.SetGeometry(0, 0, 80, 30)
+	c.Assert(area.SetParentItem(button), IsNil)
+
+	clicked := make(chan bool, 1)
+	area.Connect("clicked", func(mouse *qml.Object) { clicked <- true })
+
+	win.Show()
+	x, y, width, height := button.Geometry()
+	c.Assert([]float64{x, y, width, height}, DeepEquals, []float64{10, 20, 80, 30})
+	sx, sy := area.MapToScene(0, 0)
+	c.Assert([]float64{sx, sy}, DeepEquals, []float64{10, 20})
+	c.Assert(root.Int("width"), Equals, 200)
+
+	c.Assert(area.Click(), IsNil)
+	select {
+	case <-clicked:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("click handler not called")
+	}
+
+	// Items are created by type, in any imported module.
+	_, err = s.engine.Item("Missing")
+	c.Assert(err, ErrorMatches, `cannot create item of type Missing: .*Missing is not a type.*`)
+	_, err = s.engine.Item("Timer")
+	c.Assert(err, ErrorMatches, `cannot create item of type Timer: not a visual item type`)
+	_, err = s.engine.Item("Rectangle {} Item")
+	c.Assert(err, ErrorMatches, `cannot create item: invalid type name "Rectangle {} Item"`)
+	_, err = s.engine.Item("GoRect", "GoTypes 4.3; import X")
+	c.Assert(err, ErrorMatches, `cannot create item of type GoRect: invalid import "GoTypes 4.3; import X"`)
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nQtObject {}")
+	c.Assert(err, IsNil)
+	plain := component.Create(nil)
+	defer plain.Destroy()
+	c.Assert(area.SetParentItem(plain), ErrorMatches, "cannot set parent item: object is not a visual item")
+	c.Assert(func() { plain.SetGeometry(0, 0, 1, 1) }, PanicMatches, "cannot set geometry of object: not a visual item")
+}
+
+func (s *S) TestWindows(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import QtQuick.Window 2.0
+		Window {
+			objectName: "popup"
+			width: 60; height: 40
+			visible: true
+			Item { objectName: "inner" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	popup := component.Create(nil)
+	defer popup.Destroy()
+
+	view, err := s.engine.LoadString("view.qml", "import QtQuick 2.0\nItem { objectName: \"view\" }")
+	c.Assert(err, IsNil)
+	created := view.CreateWindow(nil)
+	defer created.Destroy()
+
+	var adopted *qml.Window
+	var found bool
+	for _, win := range qml.Windows() {
+		switch win.Root().String("objectName") {
+		case "popup":
+			adopted = win
+		case "view":
+			c.Assert(win, Equals, created)
+			found = true
+		}
+	}
+	c.Assert(found, Equals, true)
+	c.Assert(adopted, NotNil)
+	c.Assert(adopted.Root().ObjectByName("inner").String("objectName"), Equals, "inner")
+
+	// The same value is handed out while the window is alive.
+	for _, win := range qml.Windows() {
+		if win.Root().String("objectName") == "popup" {
+			c.Assert(win, Equals, adopted)
+		}
+	}
+
+	err = adopted.Recreate(view, nil)
+	c.Assert(err, ErrorMatches, "cannot recreate window created by QML code")
+
+	focused := make(chan *qml.Window, 10)
+	qml.OnFocusWindowChanged(func(win *qml.Window) { focused <- win })
+	defer qml.OnFocusWindowChanged(nil)
+
+	adopted.Raise()
+	adopted.RequestActivate()
+	// Window systems may refuse activation, so only check consistency.
+	select {
+	case win := <-focused:
+		c.Assert(win, Equals, adopted)
+		c.Assert(adopted.IsActive(), Equals, true)
+	case <-time.After(500 * time.Millisecond):
+		c.Assert(adopted.IsActive(), Equals, false)
+	}
+}
+
+func (s *S) TestScreens(c *C) {
+	screens := qml.Screens()
+	c.Assert(len(screens) > 0, Equals, true)
+	c.Assert(screens[0].Primary, Equals, true)
+	for _, screen := range screens {
+		c.Assert(screen.Name, Not(Equals), "")
+		c.Assert(screen.Geometry.Empty(), Equals, false)
+		c.Assert(screen.AvailableGeometry.In(screen.Geometry), Equals, true)
+		c.Assert(screen.DevicePixelRatio > 0, Equals, true)
+	}
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { width: 40; height: 30 }")
+	c.Assert(err, IsNil)
+	win := component.CreateWindow(nil)
+	defer win.Destroy()
+	win.Show()
+
+	last := screens[len(screens)-1]
+	c.Assert(win.SetScreen(last), IsNil)
+	c.Assert(win.Screen().Name, Equals, last.Name)
+	x, y := win.Position()
+	c.Assert(image.Pt(x, y).In(last.AvailableGeometry), Equals, true)
+
+	err = win.SetScreen(qml.Screen{Name: "no-such-screen"})
+	c.Assert(err, ErrorMatches, `cannot move window to screen "no-such-screen": screen not found`)
+	c.Assert(win.Screen().Name, Equals, last.Name)
+
+	qml.OnScreensChanged(func(screens []qml.Screen) {})
+	qml.OnScreensChanged(nil)
+}
+
+func (s *S) TestEventInjection(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 100; height: 100
+			property int clicks
+			property bool submitted
+			MouseArea { objectName: "button"; width: 50; height: 50; onClicked: clicks++ }
+			TextInput {
+				objectName: "input"
+				y: 60; width: 100; height: 20
+				Keys.onReturnPressed: submitted = true
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	root := window.Root()
+	c.Assert(root.ObjectByName("button").Click(), IsNil)
+	qml.Settle()
+	c.Assert(root.Int("clicks"), Equals, 1)
+
+	window.PostMouseEvent(10, 10, qml.LeftButton, qml.MouseButtonPress)
+	window.PostMouseEvent(10, 10, qml.LeftButton, qml.MouseButtonRelease)
+	qml.Settle()
+	c.Assert(root.Int("clicks"), Equals, 2)
+
+	// Clicks outside the button are not seen by it.
+	window.PostMouseEvent(90, 10, qml.LeftButton, qml.MouseButtonPress)
+	window.PostMouseEvent(90, 10, qml.LeftButton, qml.MouseButtonRelease)
+	qml.Settle()
+	c.Assert(root.Int("clicks"), Equals, 2)
+
+	// Key events are only delivered to active windows.
+	input := root.ObjectByName("input")
+	c.Assert(input.ForceFocus(qml.OtherFocusReason), IsNil)
+	if input.HasFocus() {
+		window.PostKeyEvent(0, 0, "John")
+		window.PostKeyEvent(qml.ReturnKey, 0, "\r")
+		qml.Settle()
+		c.Assert(input.String("text"), Equals, "John")
+		c.Assert(root.Bool("submitted"), Equals, true)
+	}
+
+	c.Assert(func() { window.PostMouseEvent(0, 0, qml.LeftButton, qml.KeyPress) }, PanicMatches, "cannot post mouse event of type 6")
+
+	component, err = s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { Item { objectName: 'hidden'; visible: false }; QtObject { objectName: 'plain' } }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Click(), ErrorMatches, "cannot click item: item is not in a window")
+	c.Assert(obj.ObjectByName("plain").Click(), ErrorMatches, "cannot click object: not a visual item")
+
+	hidden := component.CreateWindow(nil)
+	defer hidden.Destroy()
+	c.Assert(hidden.Root().ObjectByName("hidden").Click(), ErrorMatches, "cannot click invisible item")
+}
+
+func (s *S) TestWindowEventFilter(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 100; height: 100
+			property int clicks
+			MouseArea { anchors.fill: parent; onClicked: clicks++ }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+	root := window.Root()
+
+	click := func() {
+		window.PostMouseEvent(10, 20, qml.LeftButton, qml.MouseButtonPress)
+		window.PostMouseEvent(10, 20, qml.LeftButton, qml.MouseButtonRelease)
+		qml.Settle()
+	}
+
+	// Filters run in the main GUI thread, and Settle waits for them.
+	// Other events, such as hovering, depend on the environment.
+	posted := map[qml.EventType]bool{
+		qml.MouseButtonPress: true, qml.MouseButtonRelease: true,
+		qml.KeyPress: true, qml.KeyRelease: true,
+	}
+	var calls []string
+	var events []qml.InputEvent
+	consume := false
+	first := window.AddEventFilter(func(ev qml.InputEvent) bool {
+		if !posted[ev.Type] {
+			return false
+		}
+		calls = append(calls, "first")
+		events = append(events, ev)
+		return consume
+	})
+	second := window.AddEventFilter(func(ev qml.InputEvent) bool {
+		if !posted[ev.Type] {
+			return false
+		}
+		calls = append(calls, "second")
+		return false
+	})
+
+	click()
+	c.Assert(calls, DeepEquals, []string{"first", "second", "first", "second"})
+	c.Assert(root.Int("clicks"), Equals, 1)
+	c.Assert(events, HasLen, 2)
+	c.Assert(events[0].Type, Equals, qml.MouseButtonPress)
+	c.Assert(events[0].X, Equals, 10.0)
+	c.Assert(events[0].Y, Equals, 20.0)
+	c.Assert(events[0].Button, Equals, qml.LeftButton)
+	c.Assert(events[0].Buttons, Equals, qml.LeftButton)
+	c.Assert(events[1].Type, Equals, qml.MouseButtonRelease)
+	c.Assert(events[1].Button, Equals, qml.LeftButton)
+	c.Assert(events[1].Buttons, Equals, qml.MouseButton(0))
+
+	calls, events = nil, nil
+	window.PostKeyEvent(qml.Key('A'), qml.ShiftModifier, "A")
+	qml.Settle()
+	c.Assert(calls, DeepEquals, []string{"first", "second", "first", "second"})
+	c.Assert(events, HasLen, 2)
+	for i, typ := range []qml.EventType{qml.KeyPress, qml.KeyRelease} {
+		c.Assert(events[i].Type, Equals, typ)
+		c.Assert(events[i].Key, Equals, qml.Key('A'))
+		c.Assert(events[i].Modifiers, Equals, qml.ShiftModifier)
+		c.Assert(events[i].Text, Equals, "A")
+	}
+
+	// Consumed events are seen neither by later filters nor by QML.
+	calls, consume = nil, true
+	click()
+	c.Assert(calls, DeepEquals, []string{"first", "first"})
+	c.Assert(root.Int("clicks"), Equals, 1)
+
+	// Removed filters aren't called, and removing twice is harmless.
+	calls = nil
+	first.Remove()
+	first.Remove()
+	click()
+	c.Assert(calls, DeepEquals, []string{"second", "second"})
+	c.Assert(root.Int("clicks"), Equals, 2)
+
+	calls = nil
+	second.Remove()
+	second.Remove()
+	click()
+	c.Assert(calls, IsNil)
+	c.Assert(root.Int("clicks"), Equals, 3)
+}
+
+func (s *S) TestRecordInput(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			width: 100; height: 100
+			property int clicks
+			MouseArea { objectName: "button"; width: 50; height: 50; onClicked: clicks++ }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	var recording bytes.Buffer
+	stop := window.RecordInput(&recording)
+	c.Assert(window.Root().ObjectByName("button").Click(), IsNil)
+	qml.Settle()
+	stop()
+	stop()
+	c.Assert(window.Root().Int("clicks"), Equals, 1)
+	c.Assert(recording.String(), Matches, `qml-input 1 100 100\n\d+ 2 25 25 1 1 0 0 0 ""\n\d+ 3 25 25 1 0 0 0 0 ""\n`)
+
+	// Positions are scaled to the size of the replaying window.
+	replay := component.CreateWindow(nil)
+	defer replay.Destroy()
+	replay.SetSize(200, 200)
+	replay.Root().ObjectByName("button").Set("width", 100)
+	replay.Root().ObjectByName("button").Set("height", 100)
+	replay.Show()
+	c.Assert(replay.ReplayInput(bytes.NewReader(recording.Bytes()), 10), IsNil)
+	qml.Settle()
+	c.Assert(replay.Root().Int("clicks"), Equals, 1)
+
+	slow := "qml-input 1 100 100\n60000 2 25 25 1 1 0 0 0 \"\"\n"
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		replay.StopReplay()
+	}()
+	c.Assert(replay.ReplayInput(strings.NewReader(slow), 1), Equals, qml.ErrReplayStopped)
+
+	c.Assert(replay.ReplayInput(strings.NewReader("bogus\n"), 1), ErrorMatches, "cannot replay input: unknown recording format")
+	c.Assert(replay.ReplayInput(strings.NewReader("qml-input 1 100 100\n1 2 x\n"), 1), ErrorMatches, "cannot replay input: line 2: expected 10 fields, got 3")
+	c.Assert(replay.ReplayInput(strings.NewReader(""), 0), ErrorMatches, "cannot replay input at speed 0")
+}
+
+func (s *S) TestImageProvider(c *C) {
+	requests := make(chan string, 10)
+	s.engine.AddImageProvider("Chart", func(id string, width, height int) image.Image {
+		requests <- fmt.Sprintf("%s %dx%d", id, width, height)
+		img := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+		img.Set(1, 1, color.NRGBA{255, 0, 0, 255})
+		return img
+	})
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Image {
+			source: "image://chart/sales"
+			sourceSize.width: 16
+			sourceSize.height: 12
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	select {
+	case request := <-requests:
+		c.Assert(request, Equals, "sales 16x12")
+	case <-time.After(3 * time.Second):
+		c.Fatalf("image was not requested")
+	}
+	for i := 0; i < 100 && obj.Int("status") == 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(obj.Int("status"), Equals, 1) // Image.Ready
+
+	var buf bytes.Buffer
+	c.Assert(png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 8, 6))), IsNil)
+	s.engine.AddEncodedImageProvider("encoded", func(id string, width, height int) ([]byte, string) {
+		if id == "bad" {
+			return []byte("not an image"), "png"
+		}
+		return buf.Bytes(), id
+	})
+
+	var mutex sync.Mutex
+	var msgs []string
+	qml.SetLogger(func(msg qml.LogMessage) {
+		mutex.Lock()
+		msgs = append(msgs, msg.String())
+		mutex.Unlock()
+	})
+	defer qml.SetLogger(c)
+
+	for _, test := range []struct {
+		id     string
+		status int
+	}{{"png", 1}, {"", 1}, {"bad", 3}, {"bogus", 3}} {
+		component, err := s.engine.LoadString("file.qml", `import QtQuick 2.0; Image { asynchronous: false; source: "image://encoded/`+test.id+`" }`)
+		c.Assert(err, IsNil)
+		img := component.Create(nil)
+		for i := 0; i < 100 && img.Int("status") == 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Assert(img.Int("status"), Equals, test.status, Commentf("id %q", test.id))
+		img.Destroy()
+	}
+	mutex.Lock()
+	c.Assert(strings.Join(msgs, "\n"), Matches, `(?s).*all_test.go:\d+: qml: image provider: cannot decode image as "png": invalid data.*`)
+	c.Assert(strings.Join(msgs, "\n"), Matches, `(?s).*cannot decode image as "bogus": available formats are .*png.*`)
+	mutex.Unlock()
+
+	// Replacing and removing providers is fine, as is destroying the
+	// engine with providers registered.
+	s.engine.AddImageProvider("chart", func(id string, width, height int) image.Image { return nil })
+	s.engine.RemoveImageProvider("chart")
+	s.engine.AddImageProvider("other", func(id string, width, height int) image.Image { return nil })
+}
+
+func (s *S) TestChildEngine(c *C) {
+	parent := qml.NewEngine(&qml.EngineOptions{AllowLocalFiles: true})
+	defer parent.Destroy()
+	parent.AddImageProvider("shared", func(id string, width, height int) image.Image {
+		return image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	})
+	parent.AddImageProvider("removed", func(id string, width, height int) image.Image {
+		return image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	})
+
+	child := parent.NewChildEngine()
+
+	// Changes made after the child is created aren't shared.
+	parent.RemoveImageProvider("removed")
+	parent.AddImageProvider("later", func(id string, width, height int) image.Image {
+		return image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	})
+
+	status := func(engine *qml.Engine, provider string) int {
+		component, err := engine.LoadString("file.qml", `import QtQuick 2.0; Image { asynchronous: false; source: "image://`+provider+`/x" }`)
+		c.Assert(err, IsNil)
+		img := component.Create(nil)
+		defer img.Destroy()
+		return img.Int("status")
+	}
+	c.Assert(status(child, "shared"), Equals, 1)
+	c.Assert(status(child, "removed"), Equals, 1)
+	c.Assert(status(child, "later"), Equals, 3)
+	c.Assert(status(parent, "later"), Equals, 1)
+
+	// Options are inherited.
+	_, err := child.LoadString("file.qml", "import QtWebKit 3.0\nItem {}")
+	c.Assert(err, ErrorMatches, `engine options deny imported modules: QtWebKit \(network\)`)
+
+	// A child may be destroyed on its own.
+	other := parent.NewChildEngine()
+	other.Destroy()
+	c.Assert(status(parent, "shared"), Equals, 1)
+
+	// Destroying the parent destroys the children as well.
+	component, err := child.LoadString("file.qml", "import QtQuick 2.0\nItem {}")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	parent.Destroy()
+	c.Assert(func() { child.Context() }, Panics, "engine already destroyed")
+	c.Assert(func() { parent.NewChildEngine() }, Panics, "engine already destroyed")
+	obj.Destroy()
+	child.Destroy()
+}
+
+type recordingTransport struct {
+	mutex sync.Mutex
+	urls  []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	t.urls = append(t.urls, req.URL.String())
+	t.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *S) TestNetworkSettings(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Host == "example.invalid" {
+			fmt.Fprintf(w, "proxied %s", req.URL.Path)
+			return
+		}
+		if req.URL.Path == "/missing" {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprintf(w, "%s %s %s", req.Method, req.URL.Path, req.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "local.txt"), []byte("local"), 0644), IsNil)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		QtObject {
+			property bool done
+			property int status
+			property string result
+			function get(url) {
+				done = false
+				var req = new XMLHttpRequest()
+				req.onreadystatechange = function() {
+					if (req.readyState === XMLHttpRequest.DONE) {
+						result = req.responseText
+						status = req.status
+						done = true
+					}
+				}
+				req.open("GET", url)
+				req.send()
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	get := func(url string) (int, string) {
+		obj.Call("get", url)
+		for i := 0; i < 300 && !obj.Bool("done"); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return obj.Int("status"), obj.String("result")
+	}
+
+	s.engine.SetUserAgent("qmltest/1.0")
+	status, result := get(server.URL + "/plain")
+	c.Assert(status, Equals, 200)
+	c.Assert(result, Equals, "GET /plain qmltest/1.0")
+
+	transport := &recordingTransport{}
+	s.engine.SetNetworkTransport(transport)
+	status, result = get(server.URL + "/routed")
+	c.Assert(status, Equals, 200)
+	c.Assert(result, Equals, "GET /routed qmltest/1.0")
+	status, _ = get(server.URL + "/missing")
+	c.Assert(status, Equals, 404)
+
+	// Local files bypass the transport.
+	status, result = get("file://" + filepath.Join(dir, "local.txt"))
+	c.Assert(result, Equals, "local")
+
+	transport.mutex.Lock()
+	c.Assert(transport.urls, DeepEquals, []string{server.URL + "/routed", server.URL + "/missing"})
+	transport.mutex.Unlock()
+
+	// The proxy only applies to Qt's own network stack.
+	s.engine.SetNetworkTransport(nil)
+	u, err := url.Parse(server.URL)
+	c.Assert(err, IsNil)
+	port, err := strconv.Atoi(u.Port())
+	c.Assert(err, IsNil)
+	s.engine.SetNetworkProxy(u.Hostname(), port, qml.HTTPProxy)
+	status, result = get("http://example.invalid/page")
+	c.Assert(status, Equals, 200)
+	c.Assert(result, Equals, "proxied /page")
+	s.engine.SetNetworkProxy("", 0, qml.DefaultProxy)
+}
+
+func (s *S) TestRegisterTypeErrors(c *C) {
+	newValue := func() interface{} { return &TestType{} }
+	tests := []struct {
+		spec qml.TypeSpec
+		err  string
+	}{
+		{qml.TypeSpec{Location: "GoErrTest", Major: 1}, "cannot register type with an empty name"},
+		{qml.TypeSpec{Location: "GoErrTest", Major: 1, Name: "lower"}, `cannot register type "lower": name must start with an uppercase letter .*`},
+		{qml.TypeSpec{Location: "GoErrTest", Major: 1, Name: "Bad-Name"}, `cannot register type "Bad-Name": name must start .*`},
+		{qml.TypeSpec{Location: "Go Err", Major: 1, Name: "T"}, `cannot register type "T": invalid location "Go Err"`},
+		{qml.TypeSpec{Location: "", Major: 1, Name: "T"}, `cannot register type "T": invalid location ""`},
+		{qml.TypeSpec{Location: "GoErrTest.", Major: 1, Name: "T"}, `cannot register type "T": invalid location "GoErrTest."`},
+		{qml.TypeSpec{Location: "GoErrTest", Major: -1, Name: "T"}, `cannot register type "T": invalid version -1.0`},
+		{qml.TypeSpec{Location: "GoErrTest", Major: 1, Minor: -2, Name: "T"}, `cannot register type "T": invalid version 1.-2`},
+		{qml.TypeSpec{Location: "GoErrTest", Major: 1, Name: "T"}, `cannot register type "T": TypeSpec.New is nil`},
+	}
+	for _, test := range tests {
+		c.Assert(qml.RegisterType(&test.spec), ErrorMatches, test.err)
+	}
+
+	spec := qml.TypeSpec{Location: "GoErrTest", Major: 1, Name: "Once", New: newValue}
+	c.Assert(qml.RegisterType(&spec), IsNil)
+	c.Assert(qml.RegisterType(&spec), ErrorMatches, `type "Once" is already registered in GoErrTest 1.0`)
+	c.Assert(qml.RegisterSingleton(&spec), ErrorMatches, `type "Once" is already registered in GoErrTest 1.0`)
+
+	// Other versions may still be registered.
+	spec.Minor = 1
+	c.Assert(qml.RegisterType(&spec), IsNil)
+
+	_, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nimport GoErrTest 1.1\nOnce {}")
+	c.Assert(err, IsNil)
+	spec.Name = "Late"
+	c.Assert(qml.RegisterType(&spec), ErrorMatches, `cannot register type "Late": module GoErrTest was already imported by a loaded component`)
+}
+
+func (s *S) TestRegisterTypes(c *C) {
+	newValue := func() interface{} { return &TestType{} }
+
+	err := qml.RegisterTypes("GoBatchTest", 1, 0, []qml.TypeSpec{
+		{Name: "Alpha", New: newValue},
+		{Name: "beta", New: newValue},
+	})
+	c.Assert(err, ErrorMatches, `cannot register type "beta": name must start .*`)
+	err = qml.RegisterTypes("GoBatchTest", 1, 0, []qml.TypeSpec{
+		{Name: "Alpha", New: newValue},
+		{Name: "Alpha", New: newValue},
+	})
+	c.Assert(err, ErrorMatches, `type "Alpha" is already registered in GoBatchTest 1.0`)
+
+	// Nothing was registered by the failed attempts above.
+	err = qml.RegisterTypes("GoBatchTest", 1, 0, []qml.TypeSpec{
+		{Location: "Ignored", Name: "Alpha", New: newValue},
+		{Name: "Beta", New: func() interface{} { return &TestType{StringValue: "single"} }, Singleton: true},
+	})
+	c.Assert(err, IsNil)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoBatchTest 1.0
+		Item {
+			property QtObject alpha: Alpha { stringValue: "alpha" }
+			property string beta: Beta.stringValue
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Object("alpha").String("stringValue"), Equals, "alpha")
+	c.Assert(obj.String("beta"), Equals, "single")
+}
+
+func (s *S) TestReplaceType(c *C) {
+	destroyed := make(chan string, 2)
+	spec := qml.TypeSpec{
+		Location: "GoReplaceTest",
+		Major:    1,
+		Name:     "Replaced",
+		New:      func() interface{} { return &TestType{StringValue: "old"} },
+		Destroy:  func(value interface{}) { destroyed <- "old:" + value.(*TestType).StringValue },
+	}
+	c.Assert(qml.RegisterType(&spec), IsNil)
+
+	component, err := s.engine.LoadString("file.qml", "import GoReplaceTest 1.0\nReplaced {}")
+	c.Assert(err, IsNil)
+	oldObj := component.Create(nil)
+	c.Assert(oldObj.String("stringValue"), Equals, "old")
+
+	spec.New = func() interface{} { return &TestType{StringValue: "new"} }
+	spec.Destroy = func(value interface{}) { destroyed <- "new:" + value.(*TestType).StringValue }
+	c.Assert(qml.ReplaceType(&spec), ErrorMatches, `cannot replace type "Replaced": development mode is disabled`)
+
+	qml.SetDevMode(true)
+	defer qml.SetDevMode(false)
+
+	other := spec
+	other.Name = "Missing"
+	c.Assert(qml.ReplaceType(&other), ErrorMatches, `cannot replace type "Missing": not registered in GoReplaceTest 1.0`)
+	other = spec
+	other.New = func() interface{} { return &EmbeddedType{} }
+	c.Assert(qml.ReplaceType(&other), ErrorMatches, `cannot replace type "Replaced": \*qml_test.EmbeddedType and \*qml_test.TestType expose different members to QML`)
+
+	c.Assert(qml.ReplaceType(&spec), IsNil)
+	newObj := component.Create(nil)
+	c.Assert(newObj.String("stringValue"), Equals, "new")
+
+	// Existing values keep the functions they were created with.
+	for _, obj := range []*qml.Object{oldObj, newObj} {
+		want := obj.String("stringValue") + ":" + obj.String("stringValue")
+		obj.Destroy()
+		select {
+		case v := <-destroyed:
+			c.Assert(v, Equals, want)
+		case <-time.After(3 * time.Second):
+			c.Fatalf("Destroy not called")
+		}
+	}
+}
+
+func (s *S) TestTypeInitDestroy(c *C) {
+	destroyed := make(chan *TestType, 1)
+	spec := qml.TypeSpec{
+		Location: "GoHookTest",
+		Major:    1,
+		Name:     "Hooked",
+		New:      func() interface{} { return &TestType{} },
+		Init: func(obj *qml.Object, value interface{}) {
+			// Properties set by QML take precedence.
+			obj.Set("stringValue", "init")
+			obj.Set("intValue", 42)
+			value.(*TestType).ObjectValue = obj
+		},
+		Destroy: func(value interface{}) {
+			destroyed <- value.(*TestType)
+		},
+	}
+	c.Assert(qml.RegisterType(&spec), IsNil)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoHookTest 1.0
+		Item {
+			property QtObject hooked: Hooked { stringValue: "qml" }
+			property int seen: hooked.intValue
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+
+	value, ok := obj.Property("hooked").(*TestType)
+	c.Assert(ok, Equals, true)
+	c.Assert(value.StringValue, Equals, "qml")
+	c.Assert(obj.Int("seen"), Equals, 42)
+	c.Assert(value.ObjectValue, NotNil)
+	c.Assert(value.ObjectValue.String("stringValue"), Equals, "qml")
+
+	obj.Destroy()
+	select {
+	case v := <-destroyed:
+		c.Assert(v, Equals, value)
+	case <-time.After(3 * time.Second):
+		c.Fatalf("Destroy not called")
+	}
+}
+
+func (s *S) TestTypeEnums(c *C) {
+	spec := qml.TypeSpec{
+		Location: "GoEnumTest",
+		Major:    1,
+		Name:     "Machine",
+		New:      func() interface{} { return &TestType{} },
+		Enums: map[string]map[string]int{
+			"State": {"StateIdle": 0, "StateRunning": 1},
+			"Mode":  {"ModeFast": 10},
+		},
+	}
+	c.Assert(qml.RegisterType(&spec), IsNil)
+
+	spec.Name = "Dup"
+	spec.Enums = map[string]map[string]int{"A": {"Same": 1}, "B": {"Same": 2}}
+	c.Assert(qml.RegisterType(&spec), ErrorMatches, `type "Dup" has key "Same" in both the A and B enums`)
+	spec.Enums = map[string]map[string]int{"A": {"lower": 1}}
+	c.Assert(qml.RegisterType(&spec), ErrorMatches, `enum A of type "Dup" has invalid key "lower": must start with an uppercase letter`)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoEnumTest 1.0
+		Item {
+			property int state: Machine.StateRunning
+			property int mode: Machine.ModeFast
+			Text { objectName: "text"; horizontalAlignment: Text.AlignHCenter }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.Int("state"), Equals, 1)
+	c.Assert(obj.Int("mode"), Equals, 10)
+
+	text := obj.ObjectByName("text")
+	c.Assert(text.EnumValue("AlignHCenter"), Equals, 4)
+	c.Assert(text.EnumValue("HAlignment.AlignHCenter"), Equals, 4)
+	c.Assert(text.Int("horizontalAlignment"), Equals, 4)
+	c.Assert(func() { text.EnumValue("VAlignment.AlignHCenter") }, PanicMatches, `object has no enum key "VAlignment.AlignHCenter"`)
+
+	c.Assert(text.Enums()["HAlignment"], DeepEquals, map[string]int{"AlignLeft": 1, "AlignRight": 2, "AlignHCenter": 4, "AlignJustify": 8})
+	name, ok := text.EnumName("HAlignment", 4)
+	c.Assert(ok, Equals, true)
+	c.Assert(name, Equals, "AlignHCenter")
+	_, ok = text.EnumName("HAlignment", 3)
+	c.Assert(ok, Equals, false)
+	_, ok = text.EnumName("Missing", 4)
+	c.Assert(ok, Equals, false)
+
+	c.Assert(text.Set("horizontalAlignment", qml.Enum("HAlignment", "AlignRight")), IsNil)
+	c.Assert(text.Int("horizontalAlignment"), Equals, 2)
+	c.Assert(text.Set("horizontalAlignment", qml.Enum("", "AlignLeft")), IsNil)
+	c.Assert(text.Int("horizontalAlignment"), Equals, 1)
+	err = text.Set("horizontalAlignment", qml.Enum("VAlignment", "AlignLeft"))
+	c.Assert(err, ErrorMatches, `cannot assign enum key "VAlignment.AlignLeft" to property "horizontalAlignment": object has no such key`)
+}
+
+type PaintedChart struct {
+	Label   string
+	painted chan string
+	resized chan [2]float64
+}
+
+func (chart *PaintedChart) Paint(p *qml.Painter) {
+	w, h := p.Size()
+	p.FillRect(0, 0, w, h, color.White)
+	p.SetPen(color.Black, 1)
+	p.SetBrush(color.Transparent)
+	p.DrawRect(0, 0, w-1, h-1)
+	p.DrawLine(0, h, w, 0)
+	p.DrawEllipse(w/4, h/4, w/2, h/2)
+	p.SetFont("Sans", 8)
+	p.DrawText(2, 10, chart.Label)
+	p.DrawImage(1, 1, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	chart.painted <- fmt.Sprintf("%s %gx%g", chart.Label, w, h)
+}
+
+func (chart *PaintedChart) Resized(width, height float64) {
+	chart.resized <- [2]float64{width, height}
+}
+
+func (s *S) TestPaintedType(c *C) {
+	chart := &PaintedChart{painted: make(chan string, 100), resized: make(chan [2]float64, 100)}
+	spec := qml.TypeSpec{
+		Location: "GoPaintTest",
+		Major:    1,
+		Name:     "Chart",
+		New:      func() interface{} { return chart },
+	}
+	c.Assert(qml.RegisterPaintedType(&spec), IsNil)
+
+	spec.Name = "Plain"
+	spec.New = func() interface{} { return &TestType{} }
+	c.Assert(qml.RegisterPaintedType(&spec), ErrorMatches, `cannot register painted type "Plain": \*qml_test.TestType has no Paint\(\*qml.Painter\) method`)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import GoPaintTest 1.0
+		Chart { width: 40; height: 30; label: "sales" }
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	waitPainted := func(want string) {
+		timeout := time.After(3 * time.Second)
+		for {
+			select {
+			case painted := <-chart.painted:
+				if painted == want {
+					return
+				}
+			case <-timeout:
+				c.Fatalf("chart was not painted as %q", want)
+			}
+		}
+	}
+	waitPainted("sales 40x30")
+
+	// Fields are exposed as usual, but the Paint method is not.
+	root := window.Root()
+	c.Assert(root.String("label"), Equals, "sales")
+	_, err = root.CallError("paint")
+	c.Assert(err, ErrorMatches, `object has no method "paint"`)
+
+	for len(chart.resized) > 0 {
+		<-chart.resized
+	}
+	root.Set("width", 50)
+	c.Assert(<-chart.resized, Equals, [2]float64{50, 30})
+	waitPainted("sales 50x30")
+
+	chart.Label = "costs"
+	qml.Update(chart)
+	waitPainted("costs 50x30")
+}
+
+func (s *S) TestApplicationWindowParts(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import QtQuick.Controls 1.0
+		ApplicationWindow {
+			objectName: "app"
+			width: 200; height: 100
+			menuBar: MenuBar { Menu { title: "File"; MenuItem { objectName: "quit"; text: "Quit" } } }
+			toolBar: ToolBar { objectName: "tools" }
+			statusBar: StatusBar {
+				objectName: "bar"
+				Row {
+					Label { objectName: "first"; text: "-" }
+					Label { objectName: "status"; text: "-" }
+				}
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	root := component.Create(nil)
+	defer root.Destroy()
+
+	// find returns the window whose root has the given objectName.
+	find := func(name string) *qml.Window {
+		for _, w := range qml.Windows() {
+			if w.Root().String("objectName") == name {
+				return w
+			}
+		}
+		c.Fatalf("window %q not found", name)
+		return nil
+	}
+	win := find("app")
+
+	header, err := win.Header()
+	c.Assert(err, IsNil)
+	c.Assert(header.String("objectName"), Equals, "tools")
+	footer, err := win.Footer()
+	c.Assert(err, IsNil)
+	c.Assert(footer.String("objectName"), Equals, "bar")
+	menuBar, err := win.MenuBar()
+	c.Assert(err, IsNil)
+	c.Assert(menuBar.Property("menus"), NotNil)
+
+	// The label named "status" is preferred over the first one.
+	c.Assert(win.SetStatus("Saved"), IsNil)
+	c.Assert(footer.ObjectByName("status").String("text"), Equals, "Saved")
+	c.Assert(footer.ObjectByName("first").String("text"), Equals, "-")
+	footer.ObjectByName("status").Set("objectName", "other")
+	c.Assert(win.SetStatus("Loaded"), IsNil)
+	c.Assert(footer.ObjectByName("first").String("text"), Equals, "Loaded")
+
+	component, err = s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import QtQuick.Controls 1.0
+		import QtQuick.Window 2.0
+		Item {
+			ApplicationWindow { objectName: "bare"; statusBar: StatusBar {} }
+			Window { objectName: "plain" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	root = component.Create(nil)
+	defer root.Destroy()
+
+	bare := find("bare")
+	_, err = bare.Header()
+	c.Assert(err, ErrorMatches, "cannot get window header: window has no header")
+	_, err = bare.MenuBar()
+	c.Assert(err, ErrorMatches, "cannot get window menu bar: window has no menu bar")
+	c.Assert(bare.SetStatus("x"), ErrorMatches, "cannot set window status: footer has no label")
+
+	plain := find("plain")
+	_, err = plain.Footer()
+	c.Assert(err, ErrorMatches, "cannot get window footer: window root is not an ApplicationWindow")
+	c.Assert(plain.SetStatus("x"), ErrorMatches, "cannot set window status: cannot get window footer: window root is not an ApplicationWindow")
+}
+
+func (s *S) TestBatchUpdates(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import QtQuick.Window 2.0
+		Window {
+			objectName: "batch"
+			width: 60; height: 40
+			visible: true
+			property int frames
+			onFrameSwapped: frames++
+			Rectangle { objectName: "rect"; width: 10; height: 10; color: "red" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	root := component.Create(nil)
+	defer root.Destroy()
+	rect := root.ObjectByName("rect")
+
+	var win *qml.Window
+	for _, w := range qml.Windows() {
+		if w.Root().String("objectName") == "batch" {
+			win = w
+		}
+	}
+	c.Assert(win, NotNil)
+
+	// settle waits for pending frames and returns the frame count.
+	settle := func() int {
+		frames := root.Int("frames")
+		for {
+			time.Sleep(100 * time.Millisecond)
+			now := root.Int("frames")
+			if now == frames {
+				return frames
+			}
+			frames = now
+		}
+	}
+	for i := 0; i < 100 && root.Int("frames") == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	frames := settle()
+	c.Assert(frames > 0, Equals, true)
+
+	// Nested calls are refcounted, and nothing is rendered until the
+	// outermost one ends, which renders exactly once.
+	win.BeginUpdates()
+	win.BeginUpdates()
+	c.Assert(win.UpdatesSuspended(), Equals, true)
+	for i := 0; i < 5; i++ {
+		rect.Set("x", i*5)
+		rect.Set("color", []string{"green", "blue"}[i%2])
+		time.Sleep(20 * time.Millisecond)
+	}
+	win.EndUpdates()
+	c.Assert(win.UpdatesSuspended(), Equals, true)
+	c.Assert(settle(), Equals, frames)
+	win.EndUpdates()
+	c.Assert(win.UpdatesSuspended(), Equals, false)
+	c.Assert(settle(), Equals, frames+1)
+	frames++
+
+	// Unmatched calls are ignored.
+	win.EndUpdates()
+	c.Assert(win.UpdatesSuspended(), Equals, false)
+
+	// A panicking batch doesn't leave rendering suspended.
+	func() {
+		defer func() { c.Assert(recover(), Equals, "boom") }()
+		win.BatchUpdates(func() {
+			c.Assert(win.UpdatesSuspended(), Equals, true)
+			rect.Set("x", 1)
+			panic("boom")
+		})
+	}()
+	c.Assert(win.UpdatesSuspended(), Equals, false)
+	c.Assert(settle(), Equals, frames+1)
+	frames++
+
+	// Rendering is resumed after the timeout.
+	win.SetUpdatesTimeout(200 * time.Millisecond)
+	win.BeginUpdates()
+	rect.Set("x", 2)
+	c.Assert(win.UpdatesSuspended(), Equals, true)
+	c.Assert(root.Int("frames"), Equals, frames)
+	for i := 0; i < 100 && win.UpdatesSuspended(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(win.UpdatesSuspended(), Equals, false)
+	c.Assert(settle(), Equals, frames+1)
+	c.Assert(c.GetTestLog(), Matches, "(?s).*qml: window updates not ended within 200ms; resuming rendering.*")
+	win.EndUpdates()
+	c.Assert(win.UpdatesSuspended(), Equals, false)
+}
+
+func (s *S) TestEngineProfiling(c *C) {
+	value := &TestType{StringValue: "<content>"}
+	s.context.SetVar("value", value)
+
+	var buf bytes.Buffer
+	c.Assert(s.engine.StopProfiling(), ErrorMatches, "cannot stop profiling: profiling not started")
+	c.Assert(s.engine.StartProfiling(&buf), IsNil)
+	c.Assert(s.engine.StartProfiling(&buf), ErrorMatches, "cannot start profiling: profiling already started")
+
+	component, err := s.engine.LoadString("profiled.qml", `
+		import QtQuick 2.0
+		Item {
+			signal ping(int n)
+			property string text: value.stringValue
+			Component.onCompleted: { value.intValue = 42; value.incrementInt() }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(s.context)
+	defer obj.Destroy()
+	var pinged int
+	obj.ConnectInline("ping", func(n int) { pinged = n })
+	obj.Call("ping", 7)
+	c.Assert(pinged, Equals, 7)
+	c.Assert(value.IntValue, Equals, 43)
+
+	c.Assert(s.engine.StopProfiling(), IsNil)
+	c.Assert(s.engine.StopProfiling(), ErrorMatches, "cannot stop profiling: profiling not started")
+
+	results := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		fields := strings.Split(line, "\t")
+		c.Assert(fields, HasLen, 5)
+		count, err := strconv.Atoi(fields[2])
+		c.Assert(err, IsNil)
+		total, err := time.ParseDuration(fields[3])
+		c.Assert(err, IsNil)
+		c.Assert(total > 0, Equals, true, Commentf("line: %q", line))
+		name := fields[1]
+		if fields[0] == "compile" {
+			c.Assert(name, Matches, "file:.*/profiled.qml")
+			name = "profiled.qml"
+		}
+		results[fields[0]+" "+name] = count
+	}
+	c.Assert(results["compile profiled.qml"], Equals, 1)
+	c.Assert(results["read TestType.StringValue"] > 0, Equals, true)
+	c.Assert(results["write TestType.IntValue"], Equals, 1)
+	c.Assert(results["method TestType.IncrementInt"], Equals, 1)
+	c.Assert(results["signal ping"], Equals, 1)
+}
+
+func (s *S) TestRenderTimings(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import QtQuick.Window 2.0
+		Window {
+			objectName: "timed"
+			width: 60; height: 40
+			visible: true
+			Rectangle { objectName: "rect"; width: 10; height: 10; color: "red" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	root := component.Create(nil)
+	defer root.Destroy()
+	rect := root.ObjectByName("rect")
+
+	var win *qml.Window
+	for _, w := range qml.Windows() {
+		if w.Root().String("objectName") == "timed" {
+			win = w
+		}
+	}
+	c.Assert(win, NotNil)
+	c.Assert(win.RenderTimings(), IsNil)
+
+	win.SetRenderTiming(true)
+	var timings []qml.FrameTiming
+	for i := 0; i < 100 && len(timings) == 0; i++ {
+		rect.Set("x", i)
+		time.Sleep(20 * time.Millisecond)
+		timings = win.RenderTimings()
+	}
+	c.Assert(timings, Not(HasLen), 0)
+	for _, t := range timings {
+		c.Assert(t.Sync > 0, Equals, true, Commentf("timing: %#v", t))
+		c.Assert(t.Render > 0, Equals, true, Commentf("timing: %#v", t))
+		c.Assert(t.Swap > 0, Equals, true, Commentf("timing: %#v", t))
+	}
+
+	win.SetRenderTiming(false)
+	c.Assert(win.RenderTimings(), IsNil)
+}
+
+type KeyItem struct {
+	events []string
+}
+
+func (item *KeyItem) Paint(p *qml.Painter) {}
+
+func (item *KeyItem) KeyPress(e *qml.KeyEvent) {
+	item.events = append(item.events, fmt.Sprintf("press %q", e.Text))
+	if e.Key == qml.EscapeKey {
+		e.Ignore()
+	}
+}
+
+func (item *KeyItem) KeyRelease(e *qml.KeyEvent) {
+	item.events = append(item.events, fmt.Sprintf("release %q", e.Text))
+}
+
+func (s *S) TestKeyEvents(c *C) {
+	item := &KeyItem{}
+	spec := qml.TypeSpec{
+		Location:  "GoKeyTest",
+		Major:     1,
+		Name:      "KeyItem",
+		Focusable: true,
+		New:       func() interface{} { return item },
+	}
+	c.Assert(qml.RegisterPaintedType(&spec), IsNil)
+
+	spec.Name = "Plain"
+	spec.New = func() interface{} { return &TestType{} }
+	c.Assert(qml.RegisterType(&spec), ErrorMatches, `cannot register type "Plain": only visual types may be focusable`)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoKeyTest 1.0
+		Item {
+			width: 100; height: 100
+			property int parentKeys
+			Keys.onPressed: parentKeys++
+			KeyItem { objectName: "item"; width: 50; height: 50 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	root := window.Root()
+	obj := root.ObjectByName("item")
+	c.Assert(obj.Bool("activeFocusOnTab"), Equals, true)
+	c.Assert(obj.Set("focus", true), IsNil)
+
+	// Key events are only delivered to active windows.
+	c.Assert(obj.ForceFocus(qml.OtherFocusReason), IsNil)
+	if obj.HasFocus() {
+		window.PostKeyEvent(0, 0, "a")
+		qml.Settle()
+		c.Assert(item.events, DeepEquals, []string{`press "a"`, `release "a"`})
+		c.Assert(root.Int("parentKeys"), Equals, 0)
+
+		// Ignored events propagate to the parent item.
+		window.PostKeyEvent(qml.EscapeKey, 0, "")
+		qml.Settle()
+		c.Assert(item.events[2], Equals, `press ""`)
+		c.Assert(root.Int("parentKeys"), Equals, 1)
+	}
+}
+
+type MouseItem struct {
+	obj    *qml.Object
+	grab   bool
+	events []string
+}
+
+func (item *MouseItem) Paint(p *qml.Painter) {}
+
+func (item *MouseItem) MousePress(e *qml.MouseEvent) {
+	item.events = append(item.events, fmt.Sprintf("press %v,%v", e.X, e.Y))
+	if item.grab {
+		item.obj.GrabMouse()
+	}
+}
+
+func (item *MouseItem) MouseMove(e *qml.MouseEvent) {
+	item.events = append(item.events, fmt.Sprintf("move %v,%v", e.X, e.Y))
+}
+
+func (item *MouseItem) MouseRelease(e *qml.MouseEvent) {
+	item.events = append(item.events, fmt.Sprintf("release %v,%v", e.X, e.Y))
+}
+
+func (item *MouseItem) MouseUngrab() {
+	item.events = append(item.events, "ungrab")
+}
+
+func (item *MouseItem) HoverEnter(e *qml.MouseEvent) {
+	item.events = append(item.events, fmt.Sprintf("enter %v,%v", e.X, e.Y))
+}
+
+func (item *MouseItem) HoverMove(e *qml.MouseEvent) {
+	item.events = append(item.events, fmt.Sprintf("hover %v,%v", e.X, e.Y))
+}
+
+func (item *MouseItem) HoverLeave(e *qml.MouseEvent) {
+	item.events = append(item.events, "leave")
+}
+
+func (s *S) TestMouseEvents(c *C) {
+	item := &MouseItem{}
+	spec := qml.TypeSpec{
+		Location: "GoMouseTest",
+		Major:    1,
+		Name:     "MouseItem",
+		New:      func() interface{} { return item },
+		Init:     func(obj *qml.Object, value interface{}) { value.(*MouseItem).obj = obj },
+	}
+	c.Assert(qml.RegisterPaintedType(&spec), IsNil)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoMouseTest 1.0
+		Flickable {
+			width: 200; height: 200
+			contentWidth: 200; contentHeight: 1000
+			MouseItem { objectName: "item"; width: 100; height: 100 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+	flick := window.Root()
+
+	post := func(x, y float64, button qml.MouseButton, typ qml.EventType) {
+		window.PostMouseEvent(x, y, button, typ)
+		qml.Settle()
+	}
+
+	// Hover events are delivered while no button is pressed.
+	post(150, 150, 0, qml.MouseMove)
+	post(20, 20, 0, qml.MouseMove)
+	post(30, 30, 0, qml.MouseMove)
+	post(150, 150, 0, qml.MouseMove)
+	c.Assert(item.events, DeepEquals, []string{"enter 20,20", "hover 30,30", "leave"})
+
+	// Without a grab, the Flickable steals the drag.
+	item.events = nil
+	post(50, 90, qml.LeftButton, qml.MouseButtonPress)
+	for y := 80.0; y >= 10; y -= 10 {
+		post(50, y, qml.LeftButton, qml.MouseMove)
+	}
+	post(50, 10, qml.LeftButton, qml.MouseButtonRelease)
+	c.Assert(item.events[0], Equals, "press 50,90")
+	c.Assert(item.events[len(item.events)-1], Equals, "ungrab")
+	for _, event := range item.events {
+		c.Assert(event, Not(Matches), "release.*")
+	}
+	c.Assert(flick.Float64("contentY") > 0, Equals, true)
+	flick.Set("contentY", 0)
+	qml.Settle()
+
+	// With a grab, the whole drag is delivered to the item, including
+	// moves and the release outside of it.
+	item.events = nil
+	item.grab = true
+	post(50, 90, qml.LeftButton, qml.MouseButtonPress)
+	want := []string{"press 50,90"}
+	for y := 80.0; y >= 10; y -= 10 {
+		post(50, y, qml.LeftButton, qml.MouseMove)
+		want = append(want, fmt.Sprintf("move 50,%v", y))
+	}
+	post(150, 10, qml.LeftButton, qml.MouseMove)
+	post(150, 10, qml.LeftButton, qml.MouseButtonRelease)
+	want = append(want, "move 150,10", "release 150,10")
+	c.Assert(len(item.events) >= len(want), Equals, true, Commentf("events: %v", item.events))
+	c.Assert(item.events[:len(want)], DeepEquals, want)
+	c.Assert(flick.Float64("contentY"), Equals, 0.0)
+
+	c.Assert(item.obj.UngrabMouse(), IsNil)
+	c.Assert(component.GrabMouse(), ErrorMatches, "cannot grab mouse: object is not a visual item")
+}
+
+type GLChart struct {
+	painted chan qml.GL
+}
+
+func (chart *GLChart) Paint(gl *qml.GL) {
+	select {
+	case chart.painted <- *gl:
+	default:
+	}
+}
+
+func (s *S) TestGLType(c *C) {
+	chart := &GLChart{painted: make(chan qml.GL, 1)}
+	spec := qml.TypeSpec{
+		Location: "GoGLTest",
+		Major:    1,
+		Name:     "Chart",
+		New:      func() interface{} { return chart },
+		GLStage:  qml.GLBeforeScene,
+	}
+	c.Assert(qml.RegisterGLType(&spec), IsNil)
+
+	spec.Name = "Plain"
+	spec.New = func() interface{} { return &PaintedChart{} }
+	c.Assert(qml.RegisterGLType(&spec), ErrorMatches, `cannot register GL type "Plain": \*qml_test.PaintedChart has no Paint\(\*qml.GL\) method`)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoGLTest 1.0
+		Item {
+			width: 60; height: 40
+			Chart { x: 10; y: 5; width: 20; height: 10 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	window := component.CreateWindow(nil)
+	defer window.Destroy()
+	window.Show()
+
+	var gl qml.GL
+	select {
+	case gl = <-chart.painted:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("chart was not painted")
+	}
+	c.Assert(gl.X, Equals, 10.0)
+	c.Assert(gl.Y, Equals, 5.0)
+	c.Assert(gl.Width, Equals, 20.0)
+	c.Assert(gl.Height, Equals, 10.0)
+	c.Assert(gl.WindowWidth, Equals, 60.0)
+	c.Assert(gl.WindowHeight, Equals, 40.0)
+
+	// Drain paintings that happened meanwhile, then request a new one.
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-chart.painted:
+	default:
+	}
+	qml.Update(chart)
+	select {
+	case <-chart.painted:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("chart was not painted after Update")
+	}
+
+	gl = qml.GL{X: 10, Y: 5, Width: 20, Height: 10, WindowWidth: 60, WindowHeight: 40, DevicePixelRatio: 2}
+	x, y, width, height := gl.Viewport()
+	c.Assert([]int{x, y, width, height}, DeepEquals, []int{20, 50, 40, 20})
+}
+
+func (s *S) TestObjectCallError(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			signal moved(int x, string name)
+			function add(a, b) { return a + b }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	result, err := obj.CallError("add", 1, 2)
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, int32(3))
+
+	result, err = obj.CallError("moved", 1, "<name>")
+	c.Assert(err, IsNil)
+	c.Assert(result, IsNil)
+
+	_, err = obj.CallError("missing")
+	c.Assert(err, ErrorMatches, `object has no method "missing"`)
+
+	_, err = obj.CallError("add", 1)
+	c.Assert(err, ErrorMatches, `cannot call method "add" with 1 arguments; candidates are:\n\tadd\(QVariant,QVariant\)`)
+
+	c.Assert(func() { obj.Call("missing") }, Panics, `object has no method "missing"`)
+}
+
+func (s *S) TestObjectCallManyParams(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			function row(a, b) {
+				var sum = 0
+				for (var i = 0; i < arguments.length; i++) {
+					sum += arguments[i]
+				}
+				return sum
+			}
+			function tail(first, ...rest) { return Array.isArray(rest[0]) ? rest[0].length : -1 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	params := make([]interface{}, 24)
+	for i := range params {
+		params[i] = i + 1
+	}
+	result, err := obj.CallError("row", params...)
+	c.Assert(err, IsNil)
+	c.Assert(fmt.Sprint(result), Equals, "300")
+
+	// Fewer than the maximum, but more than declared.
+	result, err = obj.CallError("row", 1, 2, 3)
+	c.Assert(err, IsNil)
+	c.Assert(fmt.Sprint(result), Equals, "6")
+
+	result, err = obj.CallError("tail", "first", []int{1, 2, 3})
+	c.Assert(err, IsNil)
+	c.Assert(fmt.Sprint(result), Equals, "3")
+
+	// Missing parameters are still reported.
+	_, err = obj.CallError("row", 1)
+	c.Assert(err, ErrorMatches, `cannot call method "row" with 1 arguments; candidates are:\n\trow\(QVariant,QVariant\)`)
+}
+
+func (s *S) TestTimers(c *C) {
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property int ticks; property int value }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+
+	fired := make(chan bool, 10)
+	qml.After(10*time.Millisecond, func() {
+		// Timers run in the GUI thread, so this does not block.
+		obj.Set("value", 42)
+		fired <- true
+	})
+	select {
+	case <-fired:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("After timer not fired")
+	}
+	c.Assert(obj.Int("value"), Equals, 42)
+
+	every := make(chan bool, 100)
+	timer := qml.Every(5*time.Millisecond, func() { every <- true })
+	for i := 0; i < 3; i++ {
+		select {
+		case <-every:
+		case <-time.After(3 * time.Second):
+			c.Fatalf("Every timer not fired")
+		}
+	}
+	timer.Stop()
+	timer.Stop()
+	qml.Flush()
+	for len(every) > 0 {
+		<-every
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(every, HasLen, 0)
+
+	var last time.Time
+	ticks := make(chan time.Time, 100)
+	qml.Tick(func(t time.Time) {
+		c.Check(t.After(last), Equals, true)
+		last = t
+		obj.Set("ticks", obj.Int("ticks")+1)
+		ticks <- t
+	}).StopWith(obj)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(3 * time.Second):
+			c.Fatalf("Tick timer not fired")
+		}
+	}
+
+	// Timers tied to an object stop once it's destroyed.
+	obj.Destroy()
+	qml.Flush()
+	for len(ticks) > 0 {
+		<-ticks
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(ticks, HasLen, 0)
+}
+
+func (s *S) TestThrottle(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property int value
+			property int writes
+			onValueChanged: writes++
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	t := qml.Throttle(obj, "value", 200*time.Millisecond)
+	for i := 1; i <= 1000; i++ {
+		t.Set(i)
+	}
+	t.Close()
+	c.Assert(obj.Int("value"), Equals, 1000)
+	c.Assert(obj.Int("writes") <= 3, Equals, true)
+
+	// Setting after closing has no effect.
+	t.Set(1)
+	c.Assert(obj.Int("value"), Equals, 1000)
+
+	// Setting after the object is destroyed has no effect either.
+	t = qml.Throttle(obj, "value", 200*time.Millisecond)
+	obj.Destroy()
+	time.Sleep(100 * time.Millisecond)
+	t.Set(2)
+	t.Close()
+}
+
+type InitSettings struct{ Ready bool }
+type InitTheme struct{ Dark bool }
+
+func (s *S) TestInitializeModules(c *C) {
+	var order []string
+	themeSpec := qml.TypeSpec{
+		Location:  "GoInitTest",
+		Major:     1,
+		Name:      "Theme",
+		New:       func() interface{} { order = append(order, "Theme"); return &InitTheme{} },
+		DependsOn: []string{"Settings"},
+	}
+	settingsSpec := qml.TypeSpec{
+		Location: "GoInitTest",
+		Major:    1,
+		Name:     "Settings",
+		New:      func() interface{} { order = append(order, "Settings"); return &InitSettings{} },
+	}
+	c.Assert(qml.RegisterSingleton(&themeSpec), IsNil)
+	c.Assert(qml.RegisterSingleton(&settingsSpec), IsNil)
+
+	leftSpec := qml.TypeSpec{
+		Location:  "GoInitCycle",
+		Major:     1,
+		Name:      "Left",
+		New:       func() interface{} { return &InitSettings{} },
+		DependsOn: []string{"Right"},
+	}
+	rightSpec := leftSpec
+	rightSpec.Name = "Right"
+	rightSpec.DependsOn = []string{"Left"}
+	c.Assert(qml.RegisterSingleton(&leftSpec), IsNil)
+	c.Assert(qml.RegisterSingleton(&rightSpec), ErrorMatches, `type "Right" has cyclic dependencies: Right -> Left -> Right`)
+	c.Assert(s.engine.InitializeModules("GoInitCycle"), ErrorMatches, `type "Left" depends on "Right", which is not registered`)
+
+	order = nil
+	c.Assert(s.engine.InitializeModules("GoInitTest"), IsNil)
+	c.Assert(order, DeepEquals, []string{"Settings", "Theme"})
 }
 
-func (s *S) TestComponentSetDataError(c *C) {
-	_, err := s.engine.LoadString("file.qml", "Item{}")
-	c.Assert(err, ErrorMatches, "file:.*/file.qml:1 Item is not a type")
+type SingletonCounter struct{ N int }
+
+func (s *S) TestEngineSingleton(c *C) {
+	created := 0
+	spec := qml.TypeSpec{
+		Location: "GoSingletonTest",
+		Major:    1,
+		Name:     "Counter",
+		New:      func() interface{} { created++; return &SingletonCounter{} },
+	}
+	c.Assert(qml.RegisterSingleton(&spec), IsNil)
+
+	value, obj, err := s.engine.Singleton("GoSingletonTest", 1, 0, "Counter")
+	c.Assert(err, IsNil)
+	counter := value.(*SingletonCounter)
+	c.Assert(created, Equals, 1)
+
+	// QML code sees the same instance.
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nimport GoSingletonTest 1.0\nItem { Component.onCompleted: Counter.n = 42 }")
+	c.Assert(err, IsNil)
+	component.Create(nil).Destroy()
+	c.Assert(counter.N, Equals, 42)
+	c.Assert(obj.Int("n"), Equals, 42)
+
+	again, _, err := s.engine.Singleton("GoSingletonTest", 1, 0, "Counter")
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, value)
+	c.Assert(created, Equals, 1)
+
+	// Other engines have their own instance.
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+	other, _, err := engine.Singleton("GoSingletonTest", 1, 0, "Counter")
+	c.Assert(err, IsNil)
+	c.Assert(other.(*SingletonCounter) == counter, Equals, false)
+	c.Assert(other.(*SingletonCounter).N, Equals, 0)
+	c.Assert(created, Equals, 2)
+
+	_, _, err = s.engine.Singleton("GoSingletonTest", 1, 0, "Missing")
+	c.Assert(err, ErrorMatches, `no singleton "Missing" registered in module GoSingletonTest 1.0`)
+	_, _, err = s.engine.Singleton("GoSingletonTest", 2, 0, "Counter")
+	c.Assert(err, ErrorMatches, `no singleton "Counter" registered in module GoSingletonTest 2.0`)
 }
 
-func (s *S) TestComponentCreateWindow(c *C) {
-	data := `
+func (s *S) TestMoveItem(c *C) {
+	component1, err := s.engine.LoadString("file1.qml", `
 		import QtQuick 2.0
-		Item { width: 300; height: 200; }
-	`
-	component, err := s.engine.LoadString("file.qml", data)
+		Rectangle {
+			width: 300; height: 200
+			Rectangle { objectName: "panel"; signal clicked; width: 50; height: 50 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	component2, err := s.engine.LoadString("file2.qml", "import QtQuick 2.0\nRectangle { width: 400; height: 100 }")
 	c.Assert(err, IsNil)
 
-	// TODO How to test this more effectively?
-	window := component.CreateWindow(nil)
-	window.Show()
-	// Qt doesn't hide the Window if we call it too quickly. :-(
-	time.Sleep(100 * time.Millisecond)
-	window.Hide()
+	win1 := component1.CreateWindow(nil)
+	defer win1.Destroy()
+	win2 := component2.CreateWindow(nil)
+	defer win2.Destroy()
+	win1.Root().Object("parent").Set("objectName", "content1")
+	win2.Root().Object("parent").Set("objectName", "content2")
+
+	panel := win1.Root().ObjectByName("panel")
+	clicked := make(chan bool, 10)
+	panel.Connect("clicked", func() { clicked <- true })
+
+	c.Assert(qml.MoveItem(panel, win2, 10, 20), IsNil)
+	c.Assert(panel.Object("parent").String("objectName"), Equals, "content2")
+	c.Assert(panel.Float64("x"), Equals, float64(10))
+	c.Assert(panel.Float64("y"), Equals, float64(20))
+
+	panel.Call("clicked")
+	select {
+	case <-clicked:
+	case <-time.After(3 * time.Second):
+		c.Fatalf("connection lost after moving item")
+	}
+
+	c.Assert(qml.MoveItem(panel, win1, 0, 0), IsNil)
+	c.Assert(panel.Object("parent").String("objectName"), Equals, "content1")
+
+	other := qml.NewEngine(nil)
+	defer other.Destroy()
+	component3, err := other.LoadString("file3.qml", "import QtQuick 2.0\nItem {}")
+	c.Assert(err, IsNil)
+	win3 := component3.CreateWindow(nil)
+	defer win3.Destroy()
+	c.Assert(qml.MoveItem(panel, win3, 0, 0), ErrorMatches, "cannot move item to a window of a different engine")
+
+	component4, err := s.engine.LoadString("file4.qml", "import QtQuick 2.0\nQtObject {}")
+	c.Assert(err, IsNil)
+	plain := component4.Create(nil)
+	defer plain.Destroy()
+	c.Assert(qml.MoveItem(plain, win2, 0, 0), ErrorMatches, "cannot move object to a window: not a visual item")
 }
 
 type TestData struct {
@@ -274,7 +6957,7 @@ var tests = []struct {
 	},
 	{
 		Summary: "Read object properties",
-		QML:     `
+		QML: `
 			Item {
 				property bool boolp: true
 				property int intp: 1
@@ -309,6 +6992,79 @@ var tests = []struct {
 			d.Check(func() { obj.Property("missing") }, Panics, `object does not have a "missing" property`)
 		},
 	},
+	{
+		Summary: "Read list properties",
+		QML: `
+			Item {
+				property var emptyp: []
+				property var intsp: [1, 2, 3]
+				property var intp: [1]
+				property var floatsp: [1, 2.5]
+				property var floatp: [2.5]
+				property var stringsp: ["a", "b"]
+				property var stringp: ["a"]
+				property var boolsp: [true, false]
+				property var boolp: [true]
+				property var mixedp: [1, "a", true]
+				property var nestedp: [[1, 2], ["a"]]
+			}
+		`,
+		Done: func(d *TestData) {
+			obj := d.compinst
+			d.Check(obj.Property("emptyp"), DeepEquals, []interface{}{})
+			d.Check(obj.Property("intsp"), DeepEquals, []int{1, 2, 3})
+			d.Check(obj.Property("intp"), DeepEquals, []int{1})
+			d.Check(obj.Property("floatsp"), DeepEquals, []float64{1, 2.5})
+			d.Check(obj.Property("floatp"), DeepEquals, []float64{2.5})
+			d.Check(obj.Property("stringsp"), DeepEquals, []string{"a", "b"})
+			d.Check(obj.Property("stringp"), DeepEquals, []string{"a"})
+			d.Check(obj.Property("boolsp"), DeepEquals, []bool{true, false})
+			d.Check(obj.Property("boolp"), DeepEquals, []bool{true})
+			d.Check(obj.Property("mixedp"), DeepEquals, []interface{}{int32(1), "a", true})
+			d.Check(obj.Property("nestedp"), DeepEquals, []interface{}{[]int{1, 2}, []string{"a"}})
+		},
+	},
+	{
+		Summary: "Pass lists into QML",
+		QML: `
+			Item {
+				function describe(l) {
+					var types = []
+					for (var i = 0; i < l.length; i++) {
+						types.push(typeof l[i])
+					}
+					return l.length + ":" + types.join(",")
+				}
+			}
+		`,
+		Done: func(d *TestData) {
+			obj := d.compinst
+			d.Check(obj.Call("describe", []int{}), Equals, "0:")
+			d.Check(obj.Call("describe", []int{1}), Equals, "1:number")
+			d.Check(obj.Call("describe", []float64{1.5, 2}), Equals, "2:number,number")
+			d.Check(obj.Call("describe", []string{"a"}), Equals, "1:string")
+			d.Check(obj.Call("describe", []bool{true, false}), Equals, "2:boolean,boolean")
+			d.Check(obj.Call("describe", []interface{}{1, "a", []int{2}}), Equals, "3:number,string,object")
+
+			d.context.SetVar("list", []string{"a", "b"})
+			d.Check(d.context.Var("list"), DeepEquals, []string{"a", "b"})
+			d.context.SetVar("list", []interface{}{})
+			d.Check(d.context.Var("list"), DeepEquals, []interface{}{})
+			d.context.SetVar("list", []string(nil))
+			d.Check(d.context.Var("list"), DeepEquals, []interface{}{})
+			d.context.SetVar("list", nil)
+			d.Check(d.context.Var("list"), IsNil)
+
+			d.Check(obj.Call("describe", [][]string{{"a"}, {}}), Equals, "2:object,object")
+			d.context.SetVar("list", [][]string{{"a", "b"}, {"c"}})
+			d.Check(d.context.Var("list"), DeepEquals, []interface{}{[]string{"a", "b"}, []string{"c"}})
+
+			items := []TestType{{StringValue: "<a>"}, {StringValue: "<b>"}}
+			d.Check(obj.Call("describe", items), Equals, "2:object,object")
+			d.context.SetVar("list", items)
+			d.Check(d.context.Var("list").([]interface{})[1], Equals, &items[1])
+		},
+	},
 	{
 		Summary: "No access to private fields",
 		Value:   TestType{private: true},
@@ -449,6 +7205,35 @@ var tests = []struct {
 			d.Check(d.compinst.String("s"), Equals, "String is <new>")
 		},
 	},
+	{
+		Summary: "qml.Changed batches concurrent notifications",
+		Value:   TestType{StringValue: "<old>"},
+		QML: `
+			Item {
+				property int changes
+				Connections { target: value; onStringValueChanged: changes++ }
+			}
+		`,
+		Done: func(d *TestData) {
+			d.value.StringValue = "<new>"
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					qml.Changed(d.value, &d.value.StringValue)
+					wg.Done()
+				}()
+			}
+			wg.Wait()
+			qml.Flush()
+			changes := d.compinst.Int("changes")
+			d.Check(changes >= 1 && changes <= 10, Equals, true, Commentf("changes: %d", changes))
+
+			// Values unknown to QML are ignored.
+			other := &TestType{}
+			qml.Changed(other, &other.StringValue)
+		},
+	},
 	{
 		Summary:  "Call a Go method without arguments or result",
 		Value:    TestType{IntValue: 42},
@@ -487,6 +7272,24 @@ var tests = []struct {
 		`,
 		QMLLog: `err is <division by zero>`,
 	},
+	{
+		Summary: "Call a Go method from a signal handler",
+		Value:   TestType{StringValue: "<old>"},
+		QML: `
+			Item {
+				id: item
+				signal saved(string text)
+				onSaved: value.changeString(text)
+				Component.onCompleted: item.saved("<new>")
+			}
+		`,
+		QMLValue: TestType{StringValue: "<new>"},
+	},
+	{
+		Summary: "Variadic Go methods are not exposed",
+		QML:     `Item { Component.onCompleted: console.log("joinStrings is", typeof value.joinStrings) }`,
+		QMLLog:  "joinStrings is undefined",
+	},
 	{
 		Summary: "Call a Go method that recurses back into the GUI thread",
 		QML: `
@@ -745,3 +7548,635 @@ func (s *S) TestTable(c *C) {
 		}
 	}
 }
+
+func (s *S) TestBatch(c *C) {
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property int a
+			property int b
+			property string log
+			onAChanged: log += "a" + a
+			onBChanged: log += "b" + b
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	err = qml.Batch(func(b *qml.Batcher) {
+		b.Set(obj, "b", 1)
+		b.Set(obj, "missing", 2)
+		b.Set(obj, "a", 3)
+		b.SetVar(s.context, "batched", "yes")
+		b.Set(obj, "other", 0)
+		b.Set(obj, "a", 4)
+	})
+	c.Assert(obj.String("log"), Equals, "b1a3a4")
+	c.Assert(s.context.Var("batched"), Equals, "yes")
+
+	errs, ok := err.(qml.BatchErrors)
+	c.Assert(ok, Equals, true)
+	c.Assert(errs, HasLen, 2)
+	c.Assert(errs[0].Index, Equals, 1)
+	c.Assert(errs[0].Property, Equals, "missing")
+	c.Assert(errs[0].Err, ErrorMatches, `object has no property "missing"`)
+	c.Assert(errs[1].Index, Equals, 4)
+	c.Assert(errs[1].Property, Equals, "other")
+
+	c.Assert(qml.Batch(func(b *qml.Batcher) {}), IsNil)
+
+	err = obj.SetAll(map[string]interface{}{"b": 5, "a": 6})
+	c.Assert(err, IsNil)
+	c.Assert(obj.String("log"), Equals, "b1a3a4a6b5")
+}
+
+func (s *S) batchObject(c *C, n int) *qml.Object {
+	var src bytes.Buffer
+	src.WriteString("import QtQuick 2.0\nItem {\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&src, "property int p%d\n", i)
+	}
+	src.WriteString("}\n")
+	component, err := s.engine.LoadString("file.qml", src.String())
+	c.Assert(err, IsNil)
+	return component.Create(nil)
+}
+
+func (s *S) BenchmarkSetEach100(c *C) {
+	obj := s.batchObject(c, 100)
+	defer obj.Destroy()
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		for j := 0; j < 100; j++ {
+			if err := obj.Set(fmt.Sprintf("p%d", j), i); err != nil {
+				c.Fatal(err)
+			}
+		}
+	}
+}
+
+func (s *S) BenchmarkBatchSet100(c *C) {
+	obj := s.batchObject(c, 100)
+	defer obj.Destroy()
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		err := qml.Batch(func(b *qml.Batcher) {
+			for j := 0; j < 100; j++ {
+				b.Set(obj, fmt.Sprintf("p%d", j), i)
+			}
+		})
+		if err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+type Celsius float64
+
+type Level uint8
+
+func (s *S) TestNumericKinds(c *C) {
+	defer qml.SetCompat(0)
+	qml.SetCompat(qml.Numbers64)
+
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{uint(42), int64(42)},
+		{uint8(42), int64(42)},
+		{uint16(42), int64(42)},
+		{uint32(1 << 31), int64(1 << 31)},
+		{uint64(1 << 40), int64(1 << 40)},
+		{int8(-42), int64(-42)},
+		{int16(-42), int64(-42)},
+		{Celsius(21.5), float64(21.5)},
+		{Level(3), int64(3)},
+		{float32(0.5), float64(0.5)},
+	}
+	for _, test := range tests {
+		s.context.SetVar("v", test.value)
+		c.Assert(s.context.Var("v"), Equals, test.want, Commentf("value %T(%v)", test.value, test.value))
+	}
+
+	c.Assert(func() { s.context.SetVar("v", uint64(math.MaxUint64)) }, PanicMatches,
+		`cannot use uint64 value 18446744073709551615 as a QML value: too large for a 64-bit integer`)
+
+	component, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property var v; property real r }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	c.Assert(obj.Set("r", Celsius(36.6)), IsNil)
+	c.Assert(obj.Float64("r"), Equals, 36.6)
+	c.Assert(obj.Set("v", Level(7)), IsNil)
+	c.Assert(obj.Int("v"), Equals, 7)
+	c.Assert(obj.Int64("v"), Equals, int64(7))
+}
+
+func (s *S) TestScriptTimeout(c *C) {
+	if err := s.engine.SetScriptTimeout(200 * time.Millisecond); err == qml.ErrUnsupported {
+		c.Skip("scripts cannot be interrupted with this Qt version")
+	} else {
+		c.Assert(err, IsNil)
+	}
+	defer s.engine.SetScriptTimeout(0)
+
+	var mutex sync.Mutex
+	var msgs []string
+	qml.SetLogger(func(msg qml.LogMessage) {
+		mutex.Lock()
+		msgs = append(msgs, msg.String())
+		mutex.Unlock()
+	})
+	defer qml.SetLogger(c)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			function work() {
+				var t = Date.now()
+				while (Date.now() - t < 20) {}
+			}
+			function spin() {
+				while (true) {}
+			}
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	// Many short executions are fine, however long they take together.
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		obj.Call("work")
+	}
+	mutex.Lock()
+	c.Assert(msgs, HasLen, 0)
+	mutex.Unlock()
+
+	obj.Call("spin")
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+	mutex.Lock()
+	c.Assert(strings.Join(msgs, "\n"), Matches, `(?s).*file.qml:\d+: Error: script interrupted after running for more than 200 ms.*`)
+	mutex.Unlock()
+
+	// Manual interruptions work without the main GUI thread.
+	c.Assert(s.engine.SetScriptTimeout(0), IsNil)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		c.Check(s.engine.InterruptScripts(), IsNil)
+	}()
+	obj.Call("spin")
+	obj.Call("work")
+
+	c.Assert(s.engine.SetScriptTimeout(-1), ErrorMatches, "invalid script timeout: -1ns")
+}
+
+type UndoDoc struct {
+	Title string
+	Size  int
+}
+
+func (s *S) TestUndoStack(c *C) {
+	doc := &UndoDoc{Title: "a", Size: 1}
+	stack := qml.NewUndoStack()
+	stack.Track(doc)
+	s.context.SetVar("doc", doc)
+	s.context.SetVar("undoStack", stack)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			property string title: doc.title
+			property bool canUndo: undoStack.canUndo
+			property bool canRedo: undoStack.canRedo
+			property string undoText: undoStack.undoText
+			function rename(t) { doc.title = t }
+			function undo() { undoStack.undo() }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	c.Assert(obj.Bool("canUndo"), Equals, false)
+
+	// Assignments from QML are recorded.
+	obj.Call("rename", "b")
+	c.Assert(doc.Title, Equals, "b")
+	c.Assert(obj.Bool("canUndo"), Equals, true)
+	c.Assert(obj.String("undoText"), Equals, "Title")
+
+	// As are changes reported by Go, grouped by macros.
+	stack.BeginMacro("Resize")
+	qml.SetField(doc, "Size", 2)
+	qml.SetField(doc, "Size", 3)
+	qml.SetField(doc, "Title", "c")
+	stack.EndMacro()
+	c.Assert(obj.String("undoText"), Equals, "Resize")
+
+	stack.Undo()
+	c.Assert(doc.Size, Equals, 1)
+	c.Assert(doc.Title, Equals, "b")
+	c.Assert(obj.String("title"), Equals, "b")
+	c.Assert(obj.Bool("canRedo"), Equals, true)
+
+	obj.Call("undo")
+	c.Assert(doc.Title, Equals, "a")
+	c.Assert(obj.String("title"), Equals, "a")
+	c.Assert(obj.Bool("canUndo"), Equals, false)
+
+	stack.Redo()
+	stack.Redo()
+	c.Assert(doc.Title, Equals, "c")
+	c.Assert(doc.Size, Equals, 3)
+	c.Assert(obj.Bool("canRedo"), Equals, false)
+
+	// New changes discard the ones undone.
+	stack.Undo()
+	doc.Size = 10
+	qml.Changed(doc, &doc.Size)
+	stack.Redo()
+	c.Assert(doc.Size, Equals, 10)
+	stack.Undo()
+	c.Assert(doc.Size, Equals, 1)
+
+	stack.Untrack(doc)
+	qml.SetField(doc, "Size", 5)
+	stack.Clear()
+	c.Assert(obj.Bool("canUndo"), Equals, false)
+
+	c.Assert(func() { stack.EndMacro() }, PanicMatches, "qml.UndoStack.EndMacro called without an open macro")
+	c.Assert(func() { stack.Track(doc, "Missing") }, PanicMatches, `cannot track field "Missing": \*qml_test.UndoDoc has no such exported field`)
+}
+
+type IfaceDoc struct{ Title string }
+
+func (d *IfaceDoc) Same(other interface{}) bool { return other == d }
+
+func (s *S) TestObjectInterface(c *C) {
+	spec := qml.TypeSpec{
+		Location: "GoIfaceTest",
+		Major:    1,
+		Name:     "Doc",
+		New:      func() interface{} { return &IfaceDoc{} },
+	}
+	c.Assert(qml.RegisterType(&spec), IsNil)
+
+	component, err := s.engine.LoadString("file.qml", "import GoIfaceTest 1.0\nDoc { title: \"hello\" }")
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	value, err := obj.Interface()
+	c.Assert(err, IsNil)
+	doc, ok := value.(*IfaceDoc)
+	c.Assert(ok, Equals, true)
+	c.Assert(doc.Title, Equals, "hello")
+
+	// Round-tripping the value through QML yields the same pointer.
+	holder, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem { property var doc; function same(d) { return d.same(d) } }")
+	c.Assert(err, IsNil)
+	hobj := holder.Create(nil)
+	defer hobj.Destroy()
+	c.Assert(hobj.Set("doc", obj), IsNil)
+	c.Assert(hobj.Property("doc") == value, Equals, true)
+	c.Assert(hobj.Call("same", doc), Equals, true)
+
+	s.context.SetVar("wrapped", doc)
+	c.Assert(s.context.Var("wrapped") == value, Equals, true)
+
+	plain, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nItem {}")
+	c.Assert(err, IsNil)
+	pobj := plain.Create(nil)
+	defer pobj.Destroy()
+	_, err = pobj.Interface()
+	c.Assert(err, ErrorMatches, "object of class QQuickItem does not wrap a Go value")
+}
+
+type SerializeGauge struct{ Level int }
+
+func (g *SerializeGauge) Paint(p *qml.Painter) {}
+
+func (s *S) TestSerializeQML(c *C) {
+	spec := qml.TypeSpec{
+		Location: "GoSerializeTest",
+		Major:    1,
+		Name:     "Gauge",
+		New:      func() interface{} { return &SerializeGauge{} },
+	}
+	c.Assert(qml.RegisterPaintedType(&spec), IsNil)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import GoSerializeTest 1.0
+		Rectangle {
+			width: 100; height: 50; color: "red"
+			Text { objectName: "title"; x: 5; text: "Hello \"world\"\n" }
+			Rectangle { objectName: "half"; width: parent.width / 2; height: 10; opacity: 0.5 }
+			Gauge { objectName: "gauge"; level: 7; width: 20; height: 20 }
+		}
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	src, err := obj.SerializeQML(nil)
+	c.Assert(err, IsNil)
+	c.Assert(src, Matches, `(?s)import GoSerializeTest 1\.0\nimport QtQuick 2\.\d+\n\nRectangle \{\n.*`)
+	c.Assert(strings.Contains(src, "// bound"), Equals, false)
+
+	loaded, err := s.engine.LoadString("saved.qml", src)
+	c.Assert(err, IsNil, Commentf("%s", src))
+	saved := loaded.Create(nil)
+	defer saved.Destroy()
+
+	c.Assert(saved.Int("width"), Equals, 100)
+	c.Assert(saved.Int("height"), Equals, 50)
+	c.Assert(saved.Property("color"), Equals, color.RGBA{255, 0, 0, 255})
+	title := saved.ObjectByName("title")
+	c.Assert(title.String("text"), Equals, "Hello \"world\"\n")
+	c.Assert(title.Int("x"), Equals, 5)
+	half := saved.ObjectByName("half")
+	c.Assert(half.Int("width"), Equals, 50)
+	c.Assert(half.Float64("opacity"), Equals, 0.5)
+	gauge, err := saved.ObjectByName("gauge").Interface()
+	c.Assert(err, IsNil)
+	c.Assert(gauge.(*SerializeGauge).Level, Equals, 7)
+
+	src, err = obj.SerializeQML(&qml.SerializeOptions{CommentBindings: true})
+	c.Assert(err, IsNil)
+	c.Assert(src, Matches, `(?s).*width: 50 // bound\n.*`)
+	src, err = obj.SerializeQML(&qml.SerializeOptions{SkipBindings: true})
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(src, "width: 50"), Equals, false)
+
+	plain, err := s.engine.LoadString("file.qml", "import QtQuick 2.0\nQtObject {}")
+	c.Assert(err, IsNil)
+	pobj := plain.Create(nil)
+	defer pobj.Destroy()
+	_, err = pobj.SerializeQML(nil)
+	c.Assert(err, ErrorMatches, "cannot serialize object: not a visual item")
+}
+
+type FuzzRecord struct {
+	Name  string
+	Count int64
+	Ratio float64
+	Tags  []string
+}
+
+func (s *S) TestSettings(c *C) {
+	settings := qml.Settings("", "").Group("qmltest-settings")
+	defer settings.Remove("")
+
+	c.Assert(settings.Get("missing", 42), Equals, 42)
+	c.Assert(settings.Contains("missing"), Equals, false)
+
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	settings.Set("width", 640)
+	settings.Set("title", "Notes")
+	settings.Set("maximized", true)
+	settings.Set("recent", []string{"/tmp/a", "/tmp/b"})
+	settings.Set("saved", when)
+	settings.Group("inner").Set("depth", 2.5)
+
+	c.Assert(settings.Get("width", 0), Equals, 640)
+	c.Assert(settings.Get("title", ""), Equals, "Notes")
+	c.Assert(settings.Get("maximized", false), Equals, true)
+	c.Assert(settings.Get("recent", nil), DeepEquals, []string{"/tmp/a", "/tmp/b"})
+	c.Assert(settings.Get("saved", time.Time{}).(time.Time).Equal(when), Equals, true)
+	c.Assert(qml.Settings("", "").Get("qmltest-settings/inner/depth", 0.0), Equals, 2.5)
+
+	keys := settings.Keys()
+	sort.Strings(keys)
+	c.Assert(keys, DeepEquals, []string{"maximized", "recent", "saved", "title", "width"})
+	c.Assert(settings.Groups(), DeepEquals, []string{"inner"})
+	c.Assert(settings.Sync(), IsNil)
+
+	// QML sees the same values.
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		import Qt.labs.settings 1.0
+		Settings { category: "qmltest-settings"; property int width; property string title }
+	`)
+	c.Assert(err, IsNil)
+	obj := component.Create(nil)
+	c.Assert(obj.Int("width"), Equals, 640)
+	c.Assert(obj.String("title"), Equals, "Notes")
+	obj.Set("title", "Tasks")
+	obj.Destroy()
+	c.Assert(settings.Get("title", ""), Equals, "Tasks")
+
+	settings.Remove("inner")
+	c.Assert(settings.Groups(), IsNil)
+	c.Assert(func() { settings.Set("value", &TestType{}) }, Panics, `cannot store *qml_test.TestType value in settings key "value": *qml_test.TestType values cannot be stored`)
+}
+
+func (s *S) TestRoundTrip(c *C) {
+	for _, value := range []interface{}{
+		"hello",
+		true,
+		int64(math.MaxInt64),
+		int64(math.MinInt64),
+		math.MaxFloat64,
+		math.Inf(-1),
+		[]interface{}{1, "two", []interface{}{3.5}},
+		map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": "d"}},
+		&FuzzRecord{Name: "rec", Count: 1 << 60, Tags: []string{"x"}},
+	} {
+		result, err := qml.RoundTrip(value)
+		c.Assert(err, IsNil, Commentf("value %#v", value))
+		if rec, ok := value.(*FuzzRecord); ok {
+			c.Assert(result, Equals, rec)
+		}
+	}
+
+	result, err := qml.RoundTrip("a\xffb")
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, "a\ufffdb")
+
+	result, err = qml.RoundTrip(math.NaN())
+	c.Assert(err, IsNil)
+	c.Assert(math.IsNaN(result.(float64)), Equals, true)
+
+	_, err = qml.RoundTrip(uint64(math.MaxUint64))
+	c.Assert(err, ErrorMatches, "cannot round trip uint64 value via context variable: cannot use uint64 value 18446744073709551615 as a QML value: too large for a 64-bit integer")
+}
+
+// FuzzRoundTrip exercises the data conversion layer with nested values
+// built out of the fuzzed parameters. Run it with:
+//
+//     go test -run '^$' -fuzz FuzzRoundTrip
+func FuzzRoundTrip(f *testing.F) {
+	initTests()
+	f.Add("", int64(0), 0.0, false, uint8(0))
+	f.Add("a\xffb\x00c", int64(math.MaxInt64), math.MaxFloat64, true, uint8(3))
+	f.Add("\U0001F600", int64(math.MinInt64), math.SmallestNonzeroFloat64, false, uint8(7))
+	f.Fuzz(func(t *testing.T, str string, n int64, x float64, b bool, shape uint8) {
+		var value interface{} = map[string]interface{}{"str": str, "n": n, "x": x, "b": b}
+		for i := 0; i < int(shape%4); i++ {
+			value = []interface{}{value, str, n}
+		}
+		if shape&4 != 0 {
+			value = &FuzzRecord{Name: str, Count: n, Ratio: x, Tags: []string{str, str}}
+		}
+		result, err := qml.RoundTrip(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if utf8.ValidString(str) && shape&4 == 0 && shape%4 == 0 {
+			if got := result.(map[string]interface{})["str"]; got != str {
+				t.Fatalf("string %q came back as %q", str, got)
+			}
+		}
+	})
+}
+
+// debugClient sends requests of the debug protocol and returns the
+// value or error in the response.
+type debugClient struct {
+	conn net.Conn
+	dec  *json.Decoder
+	seq  int
+}
+
+func (client *debugClient) request(req map[string]interface{}) (interface{}, error) {
+	client.seq++
+	req["seq"] = client.seq
+	if err := json.NewEncoder(client.conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Seq   int
+		Value interface{}
+		Error string
+	}
+	if err := client.dec.Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Value, nil
+}
+
+func (s *S) TestServeDebug(c *C) {
+	dir := c.MkDir()
+	tokenFile := filepath.Join(dir, "token")
+	c.Assert(ioutil.WriteFile(tokenFile, []byte("secret\n"), 0644), IsNil)
+	sock := "unix:" + filepath.Join(dir, "debug.sock")
+
+	_, err := qml.ServeDebugWith(sock, qml.DebugOptions{})
+	c.Assert(err, ErrorMatches, "cannot serve debug protocol: token file not provided")
+	_, err = qml.ServeDebugWith(sock, qml.DebugOptions{TokenFile: tokenFile})
+	c.Assert(err, ErrorMatches, "cannot serve debug protocol: token file .* must not be accessible by other users")
+	c.Assert(os.Chmod(tokenFile, 0600), IsNil)
+
+	component, err := s.engine.LoadString("file.qml", `
+		import QtQuick 2.0
+		Item {
+			objectName: "debugRoot"
+			width: 40
+			function double(n) { return n * 2 }
+			function spin(ms) { var end = Date.now() + ms; while (Date.now() < end) {} }
+			Item { objectName: "child" }
+		}
+	`)
+	c.Assert(err, IsNil)
+	root := component.Create(nil)
+	defer root.Destroy()
+
+	connect := func(readOnly bool) (*debugClient, func()) {
+		closer, err := qml.ServeDebugWith(sock, qml.DebugOptions{TokenFile: tokenFile, ReadOnly: readOnly, Timeout: 100 * time.Millisecond})
+		c.Assert(err, IsNil)
+		conn, err := net.Dial("unix", filepath.Join(dir, "debug.sock"))
+		c.Assert(err, IsNil)
+		return &debugClient{conn: conn, dec: json.NewDecoder(conn)}, func() {
+			conn.Close()
+			closer.Close()
+		}
+	}
+
+	// Clients must authenticate first.
+	client, stop := connect(true)
+	_, err = client.request(map[string]interface{}{"op": "engines"})
+	c.Assert(err, ErrorMatches, "not authenticated")
+	_, err = client.request(map[string]interface{}{"op": "engines"})
+	c.Assert(err, NotNil)
+	stop()
+
+	client, stop = connect(true)
+	_, err = client.request(map[string]interface{}{"op": "auth", "token": "wrong"})
+	c.Assert(err, ErrorMatches, "authentication failed")
+	stop()
+
+	client, stop = connect(true)
+	_, err = client.request(map[string]interface{}{"op": "auth", "token": "secret"})
+	c.Assert(err, IsNil)
+
+	// Find the root object among the objects of the engines.
+	value, err := client.request(map[string]interface{}{"op": "engines"})
+	c.Assert(err, IsNil)
+	var id float64
+	for _, engine := range value.([]interface{}) {
+		for _, obj := range engine.(map[string]interface{})["objects"].([]interface{}) {
+			obj := obj.(map[string]interface{})
+			if obj["name"] == "debugRoot" {
+				id = obj["id"].(float64)
+				c.Assert(obj["url"], Matches, ".*file.qml")
+				c.Assert(obj["line"], Equals, 3.0)
+			}
+		}
+	}
+	c.Assert(id, Not(Equals), 0.0)
+
+	value, err = client.request(map[string]interface{}{"op": "tree", "object": id, "depth": -1})
+	c.Assert(err, IsNil)
+	children := value.(map[string]interface{})["children"].([]interface{})
+	c.Assert(children, HasLen, 1)
+	c.Assert(children[0].(map[string]interface{})["name"], Equals, "child")
+
+	value, err = client.request(map[string]interface{}{"op": "get", "object": id, "name": "width"})
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 40.0)
+	value, err = client.request(map[string]interface{}{"op": "get", "object": id})
+	c.Assert(err, IsNil)
+	c.Assert(value.(map[string]interface{})["objectName"], Equals, "debugRoot")
+
+	_, err = client.request(map[string]interface{}{"op": "set", "object": id, "name": "width", "value": 50})
+	c.Assert(err, ErrorMatches, "debug server is read-only")
+	_, err = client.request(map[string]interface{}{"op": "call", "object": id, "name": "double", "args": []interface{}{2}})
+	c.Assert(err, ErrorMatches, "debug server is read-only")
+	_, err = client.request(map[string]interface{}{"op": "get", "object": 12345})
+	c.Assert(err, ErrorMatches, "object 12345 not found")
+	stop()
+
+	// Writable servers may change the application.
+	client, stop = connect(false)
+	defer stop()
+	_, err = client.request(map[string]interface{}{"op": "auth", "token": "secret"})
+	c.Assert(err, IsNil)
+	value, err = client.request(map[string]interface{}{"op": "engines"})
+	c.Assert(err, IsNil)
+	for _, engine := range value.([]interface{}) {
+		for _, obj := range engine.(map[string]interface{})["objects"].([]interface{}) {
+			obj := obj.(map[string]interface{})
+			if obj["name"] == "debugRoot" {
+				id = obj["id"].(float64)
+			}
+		}
+	}
+	_, err = client.request(map[string]interface{}{"op": "set", "object": id, "name": "width", "value": 50})
+	c.Assert(err, IsNil)
+	c.Assert(root.Int("width"), Equals, 50)
+	value, err = client.request(map[string]interface{}{"op": "call", "object": id, "name": "double", "args": []interface{}{21}})
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, 42.0)
+
+	// Operations taking too long are reported as such.
+	_, err = client.request(map[string]interface{}{"op": "call", "object": id, "name": "spin", "args": []interface{}{300}})
+	c.Assert(err, ErrorMatches, "operation call timed out after 100ms")
+}
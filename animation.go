@@ -0,0 +1,200 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"time"
+	"unsafe"
+)
+
+// Easing defines how the value of an animated property progresses
+// towards its target over the animation duration. The easing curves
+// are those of the Easing.Type property of QML animations.
+type Easing int
+
+const (
+	LinearEasing Easing = iota
+	InQuadEasing
+	OutQuadEasing
+	InOutQuadEasing
+	OutInQuadEasing
+	InCubicEasing
+	OutCubicEasing
+	InOutCubicEasing
+	OutInCubicEasing
+	InQuartEasing
+	OutQuartEasing
+	InOutQuartEasing
+	OutInQuartEasing
+	InQuintEasing
+	OutQuintEasing
+	InOutQuintEasing
+	OutInQuintEasing
+	InSineEasing
+	OutSineEasing
+	InOutSineEasing
+	OutInSineEasing
+	InExpoEasing
+	OutExpoEasing
+	InOutExpoEasing
+	OutInExpoEasing
+	InCircEasing
+	OutCircEasing
+	InOutCircEasing
+	OutInCircEasing
+	InElasticEasing
+	OutElasticEasing
+	InOutElasticEasing
+	OutInElasticEasing
+	InBackEasing
+	OutBackEasing
+	InOutBackEasing
+	OutInBackEasing
+	InBounceEasing
+	OutBounceEasing
+	InOutBounceEasing
+	OutInBounceEasing
+)
+
+// AnimationOptions holds the options for animating a property via
+// Object.AnimateWith.
+type AnimationOptions struct {
+	// Easing defines how the property progresses towards its target.
+	Easing Easing
+
+	// RestoreBinding restores the binding of the animated property,
+	// if it had one, once the animation is over, so the property
+	// follows its binding again. By default the binding is dropped
+	// for good when the animation starts, so the property keeps the
+	// target value, as if it had been set via Object.Set.
+	RestoreBinding bool
+}
+
+// Animation represents a property animation started via Object.Animate.
+type Animation struct {
+	addr unsafe.Pointer
+
+	// Only accessed from the main GUI thread.
+	finished   bool
+	completed  bool
+	onFinished []func(completed bool)
+	queue      callbackQueue
+}
+
+// animations holds the running animations alive, since their C++
+// counterparts only hold unsafe references to them.
+var animations = make(map[*Animation]bool)
+
+// Animate animates the named property of obj from its current value to
+// the to value over the d duration, progressing as defined by easing.
+// The property may be numeric, a color, or a point, and the target may be
+// any value convertible to the property type. Colors may also be provided
+// as a color.Color, and points as an image.Point or as a map holding "x"
+// and "y" values. Names in the form "anchors.margins" refer to grouped
+// properties, as documented in Object.Set.
+//
+// Any binding of the property is dropped for good when the animation
+// starts. See AnimateWith for restoring it once the animation is over.
+func (obj *Object) Animate(property string, to interface{}, d time.Duration, easing Easing) (*Animation, error) {
+	return obj.AnimateWith(property, to, d, &AnimationOptions{Easing: easing})
+}
+
+// AnimateWith works as Animate, but with the provided options.
+func (obj *Object) AnimateWith(property string, to interface{}, d time.Duration, options *AnimationOptions) (*Animation, error) {
+	obj.assertLive()
+	if p, ok := to.(image.Point); ok {
+		to = map[string]interface{}{"x": p.X, "y": p.Y}
+	}
+	var opts AnimationOptions
+	if options != nil {
+		opts = *options
+	}
+	var restoreBinding C.int
+	if opts.RestoreBinding {
+		restoreBinding = 1
+	}
+	cproperty := C.CString(property)
+	defer C.free(unsafe.Pointer(cproperty))
+	anim := &Animation{}
+	var result C.int
+	var typeName string
+	gui(func() {
+		var dvalue C.DataValue
+		var ctypeName *C.char
+		packDataValue(to, &dvalue, obj.engine, jsOwner)
+		// Registered first, as a zero duration finishes right away.
+		animations[anim] = true
+		addr := C.objectAnimate(obj.addr, cproperty, &dvalue, C.int(d/time.Millisecond), C.int(opts.Easing), restoreBinding, unsafe.Pointer(anim), &result, &ctypeName)
+		if ctypeName != nilCharPtr {
+			typeName = C.GoString(ctypeName)
+		}
+		if result != C.AnimateOK {
+			delete(animations, anim)
+		} else if !anim.finished {
+			anim.addr = addr
+		}
+	})
+	switch result {
+	case C.AnimateNoProperty:
+		return nil, fmt.Errorf("object has no property %q", property)
+	case C.AnimateReadOnly:
+		return nil, fmt.Errorf("cannot animate read-only property %q", property)
+	case C.AnimateUnsupported:
+		return nil, fmt.Errorf("cannot animate property %q of type %s", property, typeName)
+	case C.AnimateWrongType:
+		return nil, fmt.Errorf("cannot animate property %q of type %s to %T", property, typeName, to)
+	}
+	return anim, nil
+}
+
+// Stop stops the animation, leaving the property at its current value,
+// or restoring its binding if requested via AnimationOptions. Stopping
+// an animation that is over has no effect.
+func (anim *Animation) Stop() {
+	gui(func() {
+		if !anim.finished {
+			C.animationStop(anim.addr)
+		}
+	})
+}
+
+// OnFinished registers f to be called once the animation is over, with
+// whether it completed, rather than being stopped via Stop or due to the
+// animated object being destroyed. If the animation is already over, f
+// is called right away. The function is called in a goroutine owned by
+// the package, as documented in the package documentation under
+// "Callbacks".
+func (anim *Animation) OnFinished(f func(completed bool)) {
+	gui(func() {
+		if anim.finished {
+			completed := anim.completed
+			anim.queue.dispatch(func() { f(completed) })
+			return
+		}
+		anim.onFinished = append(anim.onFinished, f)
+	})
+}
+
+//export hookAnimationFinished
+func hookAnimationFinished(addr unsafe.Pointer, completed C.int) {
+	if !onGuiThread("hookAnimationFinished") {
+		gui(func() { hookAnimationFinished(addr, completed) })
+		return
+	}
+	anim := (*Animation)(addr)
+	delete(animations, anim)
+	anim.finished = true
+	anim.completed = completed != 0
+	anim.addr = nilPtr
+	for _, f := range anim.onFinished {
+		f := f
+		anim.queue.dispatch(func() { f(completed != 0) })
+	}
+	anim.onFinished = nil
+}
@@ -0,0 +1,107 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Header returns the item shown at the top of the window, when the root
+// of the window is an ApplicationWindow from Qt Quick Controls, such as
+// the windows listed by Windows for ApplicationWindow instances. That's
+// the header property in Controls 2, and the toolBar property in
+// Controls 1. An error is returned if the root is not an
+// ApplicationWindow, or if it has no header.
+func (win *Window) Header() (*Object, error) {
+	return win.applicationPart("header", "header", "toolBar")
+}
+
+// Footer returns the item shown at the bottom of the window, when the
+// root of the window is an ApplicationWindow from Qt Quick Controls.
+// That's the footer property in Controls 2, and the statusBar property
+// in Controls 1. An error is returned if the root is not an
+// ApplicationWindow, or if it has no footer.
+func (win *Window) Footer() (*Object, error) {
+	return win.applicationPart("footer", "footer", "statusBar")
+}
+
+// MenuBar returns the menu bar of the window, when the root of the
+// window is an ApplicationWindow from Qt Quick Controls. An error is
+// returned if the root is not an ApplicationWindow, or if it has no
+// menu bar.
+func (win *Window) MenuBar() (*Object, error) {
+	return win.applicationPart("menu bar", "menuBar")
+}
+
+// applicationPart returns the object held by the first of the named
+// properties the ApplicationWindow root of the window has.
+func (win *Window) applicationPart(part string, names ...string) (*Object, error) {
+	root := win.Root()
+	if root == nil {
+		return nil, fmt.Errorf("cannot get window %s: window has no root", part)
+	}
+	for _, name := range names {
+		value, found := root.property(name)
+		if !found {
+			continue
+		}
+		if obj, ok := value.(*Object); ok && obj != nil {
+			return obj, nil
+		}
+		return nil, fmt.Errorf("cannot get window %s: window has no %s", part, part)
+	}
+	return nil, fmt.Errorf("cannot get window %s: window root is not an ApplicationWindow", part)
+}
+
+// SetStatus sets the text of the label in the footer of the window, as
+// returned by Footer, so that status messages may be shown without
+// locating the label by hand. The label is the descendant of the footer
+// with objectName "status", or otherwise the first Label found in it.
+// An error is returned if the window has no footer, or if no label is
+// found in it.
+func (win *Window) SetStatus(text string) error {
+	footer, err := win.Footer()
+	if err != nil {
+		return fmt.Errorf("cannot set window status: %v", err)
+	}
+	label := findStatusLabel(footer)
+	if label == nil {
+		return fmt.Errorf("cannot set window status: footer has no label")
+	}
+	if err := label.Set("text", text); err != nil {
+		return fmt.Errorf("cannot set window status: %v", err)
+	}
+	return nil
+}
+
+// findStatusLabel returns the descendant of footer with objectName
+// "status", or otherwise its first Label descendant in breadth-first
+// order, or nil if there are none.
+func findStatusLabel(footer *Object) *Object {
+	var label *Object
+	queue := footer.Children()
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = append(queue[1:], obj.Children()...)
+		if obj.String("objectName") == "status" {
+			return obj
+		}
+		if label == nil && isLabel(obj) {
+			label = obj
+		}
+	}
+	return label
+}
+
+// isLabel returns whether obj is a Label from Qt Quick Controls, which is
+// implemented in C++ in Controls 2, and in QML in Controls 1.
+func isLabel(obj *Object) bool {
+	var class string
+	gui(func() {
+		class = C.GoString(C.objectClassName(obj.addr))
+	})
+	return class == "QQuickLabel" || strings.HasPrefix(class, "Label_QMLTYPE_")
+}
@@ -0,0 +1,322 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// ComponentLoad represents a component being loaded via Engine.LoadAsync.
+type ComponentLoad struct {
+	done chan struct{}
+
+	// Set before done is closed.
+	comp *Object
+	err  error
+
+	// Records the compilation time when the engine is being profiled.
+	profiled func()
+}
+
+// componentLoads holds the loads in progress, since their C++
+// counterparts only hold unsafe references to them.
+var componentLoads = make(map[*ComponentLoad]bool)
+
+// LoadAsync starts loading a component with the provided location and
+// returns right away, so that the GUI thread remains free to animate
+// windows already visible while the component is compiled, and to load
+// any resources the component depends on. The returned handle reports
+// when the component is loaded, and provides the result.
+//
+// If r is nil, the content is read from location, which may be the path
+// of a QML file or a "qrc:///path" location, and Qt reads and compiles
+// it in the background. Otherwise the content is read from r as done by
+// Load, and only the resources it depends on are loaded asynchronously.
+//
+// If r is nil and the location is being compiled by PrecompileIdle, the
+// load in progress is returned rather than starting another one.
+func (e *Engine) LoadAsync(location string, r io.Reader) *ComponentLoad {
+	e.assertValid()
+	if r == nil {
+		if load := e.claimPrecompiled(location); load != nil {
+			return load
+		}
+	}
+	return e.loadAsync(location, r)
+}
+
+func (e *Engine) loadAsync(location string, r io.Reader) *ComponentLoad {
+	load := &ComponentLoad{done: make(chan struct{})}
+	var data []byte
+	var err error
+	hasData := r != nil
+	if hasData {
+		data, err = ioutil.ReadAll(r)
+	} else if e.options != nil && !isRemoteURL(location) {
+		// The content must be inspected for denied imports. Remote
+		// content is only fetched by Qt, and can't be inspected.
+		data, err = readLocation(location)
+	}
+	if err == nil {
+		err = e.checkImports(data)
+	}
+	if err == nil {
+		location, err = locationURL(location)
+	}
+	if err != nil {
+		load.err = err
+		close(load.done)
+		return load
+	}
+
+	cdata, cdatalen := nilCharPtr, C.int(0)
+	if hasData {
+		// Non-nil even when empty, so that C tells it apart from no data.
+		cdata, cdatalen = unsafeBytesData(append(data, 0))
+		cdatalen--
+	}
+	cloc, cloclen := unsafeStringData(location)
+	gui(func() {
+		noteImports(data)
+		load.comp = wrapObject(C.newComponent(e.addr, nilPtr), e)
+		componentLoads[load] = true
+		if p := e.profile; p != nil {
+			start := time.Now()
+			load.profiled = func() { p.measure("compile", location, start) }
+		}
+		C.componentLoadAsync(load.comp.addr, unsafe.Pointer(load), cdata, cdatalen, cloc, cloclen)
+		if C.componentIsLoading(load.comp.addr) == 0 {
+			load.finish()
+		}
+	})
+	return load
+}
+
+// readLocation returns the content of the QML file or "qrc:" resource
+// at location, which may also be a "file:" URL.
+func readLocation(location string) ([]byte, error) {
+	if strings.HasPrefix(location, "qrc:") {
+		return readResource(location)
+	}
+	if strings.HasPrefix(location, "file:") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		location = filepath.FromSlash(u.Path)
+	}
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// Done returns a channel that is closed once the component is loaded,
+// or once loading fails.
+func (l *ComponentLoad) Done() <-chan struct{} {
+	return l.done
+}
+
+// Wait blocks until the component is loaded and returns it, or returns
+// the errors reported while loading it as done by Engine.Load. Since the
+// component is only provided once loaded, instances may not be created
+// before that. Wait panics if called from within the main GUI thread
+// before the component is loaded, as loading would never complete.
+func (l *ComponentLoad) Wait() (*Object, error) {
+	select {
+	case <-l.done:
+	default:
+		assertMayBlock("wait for component load")
+		<-l.done
+	}
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.comp, nil
+}
+
+// finish records the result of the load and releases its waiters.
+//
+// This must be run from the main GUI thread.
+func (l *ComponentLoad) finish() {
+	if !componentLoads[l] {
+		return
+	}
+	delete(componentLoads, l)
+	l.err = componentError(l.comp.addr)
+	if l.profiled != nil {
+		l.profiled()
+	}
+	close(l.done)
+}
+
+//export hookComponentLoaded
+func hookComponentLoaded(addr unsafe.Pointer) {
+	if !onGuiThread("hookComponentLoaded") {
+		gui(func() { hookComponentLoaded(addr) })
+		return
+	}
+	(*ComponentLoad)(addr).finish()
+}
+
+// Incubation represents a component instance being created via
+// Object.CreateAsync.
+type Incubation struct {
+	done chan struct{}
+
+	// Set before done is closed.
+	obj *Object
+	err error
+
+	// Only accessed from the main GUI thread.
+	addr   unsafe.Pointer
+	engine *Engine
+	ctx    *Context
+}
+
+// incubations holds the incubations in progress, since their C++
+// counterparts only hold unsafe references to them.
+var incubations = make(map[*Incubation]bool)
+
+// CreateWith creates a new instance of the component held by obj, as
+// done by Create, with the provided properties set before the bindings
+// of the instance are first evaluated and before its Component.onCompleted
+// handlers run, so that those may rely on them:
+//
+//     card := component.CreateWith(nil, map[string]interface{}{"width": 300})
+//
+// With Qt 5.15 or later, required properties of the component must be
+// provided, or creating the instance fails as reported by Create.
+func (obj *Object) CreateWith(ctx *Context, props map[string]interface{}) *Object {
+	root, err := obj.incubate(ctx, props, false).Wait()
+	if err != nil {
+		panic(err.Error())
+	}
+	return root
+}
+
+// CreateAsync starts creating a new instance of the component held by
+// obj, with the provided properties set as done by CreateWith, and
+// returns right away. The instance is created in slices of time while
+// the main GUI thread handles events, so that windows remain responsive
+// while heavy object trees are created. The returned handle reports when
+// the instance is created, and provides it.
+//
+// CreateAsync panics if called on an object that does not represent a
+// QML component.
+func (obj *Object) CreateAsync(ctx *Context, props map[string]interface{}) *Incubation {
+	return obj.incubate(ctx, props, true)
+}
+
+func (obj *Object) incubate(ctx *Context, props map[string]interface{}, async bool) *Incubation {
+	obj.assertLive()
+	if C.objectIsComponent(obj.addr) == 0 {
+		panic("object is not a component")
+	}
+	if ctx != nil {
+		ctx.assertValid()
+	}
+	inc := &Incubation{done: make(chan struct{}), engine: obj.engine, ctx: ctx}
+	var casync C.int
+	if async {
+		casync = 1
+	}
+	gui(func() {
+		ctxaddr := nilPtr
+		if ctx != nil {
+			ctxaddr = ctx.obj.addr
+		}
+		var dprops C.DataValue
+		packDataValue(props, &dprops, obj.engine, jsOwner)
+		inc.addr = C.componentIncubate(obj.addr, ctxaddr, &dprops, unsafe.Pointer(inc), casync)
+		incubations[inc] = true
+		if C.incubatorIsLoading(inc.addr) == 0 {
+			inc.finish()
+		}
+	})
+	return inc
+}
+
+// Done returns a channel that is closed once the instance is created,
+// or once creating it fails or is canceled.
+func (inc *Incubation) Done() <-chan struct{} {
+	return inc.done
+}
+
+// Wait blocks until the instance is created and returns it, or returns
+// the errors reported while creating it. Wait panics if called from
+// within the main GUI thread before the instance is created, as its
+// creation would never complete.
+func (inc *Incubation) Wait() (*Object, error) {
+	select {
+	case <-inc.done:
+	default:
+		assertMayBlock("wait for component instance")
+		<-inc.done
+	}
+	if inc.err != nil {
+		return nil, inc.err
+	}
+	return inc.obj, nil
+}
+
+// Cancel aborts the creation of the instance if it's still in progress,
+// destroying the objects created so far, in which case Wait returns an
+// error. Cancel does nothing if the instance was created already.
+func (inc *Incubation) Cancel() {
+	gui(func() {
+		if !incubations[inc] {
+			return
+		}
+		delete(incubations, inc)
+		C.delIncubatorLater(inc.addr, 1)
+		inc.err = errors.New("cannot create component instance: canceled")
+		close(inc.done)
+	})
+}
+
+// finish records the result of the incubation and releases its waiters.
+//
+// This must be run from the main GUI thread.
+func (inc *Incubation) finish() {
+	if !incubations[inc] {
+		return
+	}
+	delete(incubations, inc)
+	if addr := C.incubatorObject(inc.addr); addr != nilPtr {
+		inc.obj = wrapObject(addr, inc.engine)
+		ownObject(inc.obj)
+		inc.ctx.scope(addr)
+	} else if cerrors := C.incubatorErrors(inc.addr); cerrors != nilCharPtr {
+		inc.err = fmt.Errorf("cannot create component instance: %s", C.GoString(cerrors))
+		C.free(unsafe.Pointer(cerrors))
+	} else {
+		inc.err = errors.New("cannot create component instance")
+	}
+	C.delIncubatorLater(inc.addr, 0)
+	close(inc.done)
+}
+
+//export hookIncubationDone
+func hookIncubationDone(addr unsafe.Pointer) {
+	if !onGuiThread("hookIncubationDone") {
+		gui(func() { hookIncubationDone(addr) })
+		return
+	}
+	(*Incubation)(addr).finish()
+}
@@ -0,0 +1,225 @@
+package qml
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// AsyncCall is provided to QML as the result of a Go method that runs
+// asynchronously, so that QML code may act on the method outcome once
+// it's known, without blocking the GUI thread meanwhile:
+//
+//     var call = hasher.hash(path)
+//     call.finished.connect(function(result, error) {
+//         if (error) console.log("failed: " + error)
+//         else label.text = result
+//     })
+//
+// The finished signal is only emitted once the QML code running at the
+// time of the method call returns, so connecting to it right after the
+// call never misses the outcome. The done, result, and error properties
+// hold the outcome as well, so bindings may refer to them directly.
+//
+// Methods run asynchronously when opted in via SetTypeAsync or
+// TypeSpec.Async, or when they return the result of Async.
+type AsyncCall struct {
+	// Done is whether the method has finished.
+	Done bool
+
+	// Result holds the result of the method, or a list with its results
+	// if it has several, not counting a trailing error result.
+	Result interface{}
+
+	// Error holds the message of the error returned by the method, or
+	// describes the panic it raised, and is empty if the method succeeded.
+	Error string
+
+	// Finished is emitted with the result and error once the method
+	// finishes.
+	Finished func(result interface{}, err string)
+}
+
+// Async runs f in a separate goroutine and returns an AsyncCall that
+// reports its outcome to QML. A Go method may return the result of Async
+// to run asynchronously regardless of the policy of its type:
+//
+//     func (h *Hasher) Hash(path string) *qml.AsyncCall {
+//         return qml.Async(func() (interface{}, error) {
+//             return hashFile(path)
+//         })
+//     }
+//
+// Calls made via Async may run concurrently with each other.
+func Async(f func() (interface{}, error)) *AsyncCall {
+	call := &AsyncCall{}
+	go call.run(f)
+	return call
+}
+
+// run calls f, recovering any panic it raises, and reports its outcome
+// to QML.
+func (call *AsyncCall) run(f func() (interface{}, error)) {
+	var result interface{}
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result, err = f()
+	}()
+	gui(func() {
+		call.Done = true
+		call.Result = result
+		if err != nil {
+			call.Error = err.Error()
+		}
+		Changed(call, &call.Done)
+		Changed(call, &call.Result)
+		Changed(call, &call.Error)
+		Emit(call, "finished", call.Result, call.Error)
+	})
+}
+
+// AsyncOrder defines how the asynchronous methods called on the same Go
+// value run relative to each other.
+type AsyncOrder int
+
+const (
+	// SerialAsync runs the asynchronous methods called on the same value
+	// one at a time, in the order they were called, so that they don't
+	// need to synchronize access to the value among themselves. Methods
+	// called on different values still run concurrently.
+	SerialAsync AsyncOrder = iota
+
+	// ConcurrentAsync runs every asynchronous method call in its own
+	// goroutine, concurrently with any other calls.
+	ConcurrentAsync
+)
+
+// asyncPolicy holds the methods of a type that run asynchronously,
+// and how they are ordered.
+type asyncPolicy struct {
+	order   AsyncOrder
+	methods map[string]bool
+}
+
+// asyncQueue holds the calls pending for a value under SerialAsync.
+type asyncQueue struct {
+	callbackQueue
+	pending int
+}
+
+var (
+	asyncMutex  sync.Mutex
+	typeAsync   = make(map[reflect.Type]*asyncPolicy)
+	asyncQueues = make(map[interface{}]*asyncQueue)
+)
+
+// SetTypeAsync defines that the named methods of the struct type of
+// sample, which may also be a pointer to the struct, run asynchronously
+// when called from QML, in a separate goroutine rather than in the main
+// GUI thread, so that slow methods don't freeze the user interface.
+// Instead of the method results, QML obtains an *AsyncCall that reports
+// them once the method finishes. Methods are named as in Go, and calling
+// SetTypeAsync without methods makes all methods of the type synchronous
+// again. The order defines how the calls made on the same value run
+// relative to each other.
+//
+// Since the members of a type are only inspected once, SetTypeAsync must
+// be called before values of the type are first provided to QML, as
+// done with SetTypeExposure. Asynchronous methods must synchronize their
+// access to any data shared with code running in the main GUI thread.
+func SetTypeAsync(sample interface{}, order AsyncOrder, methods ...string) {
+	setTypeAsync(reflect.TypeOf(sample), order, methods)
+}
+
+func setTypeAsync(typ reflect.Type, order AsyncOrder, methods []string) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	asyncMutex.Lock()
+	defer asyncMutex.Unlock()
+	if len(methods) == 0 {
+		delete(typeAsync, typ)
+		return
+	}
+	policy := &asyncPolicy{order: order, methods: make(map[string]bool)}
+	for _, name := range methods {
+		policy.methods[name] = true
+	}
+	typeAsync[typ] = policy
+}
+
+// isAsyncMethod returns whether the named method of the struct type st
+// runs asynchronously, and if so how calls are ordered.
+func isAsyncMethod(st reflect.Type, name string) (order AsyncOrder, ok bool) {
+	asyncMutex.Lock()
+	defer asyncMutex.Unlock()
+	policy := typeAsync[st]
+	if policy == nil || !policy.methods[name] {
+		return 0, false
+	}
+	return policy.order, true
+}
+
+// callAsync calls method with params in a separate goroutine, ordered
+// with other calls on gvalue as defined by order, and returns the call
+// reporting its results.
+func callAsync(gvalue interface{}, order AsyncOrder, method reflect.Value, params []reflect.Value) *AsyncCall {
+	call := &AsyncCall{}
+	f := func() {
+		call.run(func() (interface{}, error) {
+			return asyncResult(method.Call(params))
+		})
+	}
+	if order == ConcurrentAsync {
+		go f()
+		return call
+	}
+	asyncMutex.Lock()
+	queue := asyncQueues[gvalue]
+	if queue == nil {
+		queue = &asyncQueue{}
+		asyncQueues[gvalue] = queue
+	}
+	queue.pending++
+	asyncMutex.Unlock()
+	queue.dispatch(func() {
+		f()
+		asyncMutex.Lock()
+		queue.pending--
+		if queue.pending == 0 {
+			delete(asyncQueues, gvalue)
+		}
+		asyncMutex.Unlock()
+	})
+	return call
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// asyncResult returns the method results in out as reported by AsyncCall,
+// with a trailing error result returned separately.
+func asyncResult(out []reflect.Value) (interface{}, error) {
+	var err error
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if !out[n-1].IsNil() {
+			err = out[n-1].Interface().(error)
+		}
+		out = out[:n-1]
+	}
+	switch len(out) {
+	case 0:
+		return nil, err
+	case 1:
+		return out[0].Interface(), err
+	}
+	results := make([]interface{}, len(out))
+	for i, v := range out {
+		results[i] = v.Interface()
+	}
+	return results, err
+}
@@ -0,0 +1,124 @@
+package qml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Batcher holds property and variable updates queued within a Batch call,
+// which are applied in order with a single trip into the main GUI thread.
+type Batcher struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	obj   *Object
+	name  string
+	value interface{}
+	ctx   *Context
+}
+
+// BatchError describes a single update of a batch that failed.
+type BatchError struct {
+	// Index is the position of the update within the batch, starting at zero.
+	Index int
+
+	// Property is the name of the property the update was made to.
+	Property string
+
+	// Err is the error returned by the update.
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch update %d: %v", e.Index, e.Err)
+}
+
+// BatchErrors holds all the updates of a batch that failed, as returned
+// by Batch and Object.SetAll.
+type BatchErrors []*BatchError
+
+func (errs BatchErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Batch calls f to queue property and variable updates, and then applies
+// them all in the order they were queued with a single trip into the main
+// GUI thread, rather than one trip per update. This is significantly
+// cheaper when many values change at once, and ensures QML observes all
+// the updates together, without other events being processed midway:
+//
+//     err := qml.Batch(func(b *qml.Batcher) {
+//         b.Set(gauge, "value", reading.Value)
+//         b.Set(gauge, "unit", reading.Unit)
+//         b.SetVar(ctx, "lastReading", reading.Time)
+//     })
+//
+// Updates are applied as done by Object.Set and Context.SetVar. An update
+// that fails does not prevent the following ones from being applied, and
+// all failures are returned together as a BatchErrors value.
+func Batch(f func(b *Batcher)) error {
+	var b Batcher
+	f(&b)
+	return b.run()
+}
+
+// Set queues the assignment of value to the property of obj, as done by
+// Object.Set.
+func (b *Batcher) Set(obj *Object, property string, value interface{}) {
+	obj.assertLive()
+	b.ops = append(b.ops, batchOp{obj: obj, name: property, value: value})
+}
+
+// SetVar queues the assignment of value to the variable name of ctx, as
+// done by Context.SetVar.
+func (b *Batcher) SetVar(ctx *Context, name string, value interface{}) {
+	ctx.assertValid()
+	b.ops = append(b.ops, batchOp{ctx: ctx, name: name, value: value})
+}
+
+// run applies the queued updates in order within the main GUI thread.
+func (b *Batcher) run() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	var errs BatchErrors
+	gui(func() {
+		for i, op := range b.ops {
+			if op.ctx != nil {
+				op.ctx.SetVar(op.name, op.value)
+				continue
+			}
+			if err := op.obj.Set(op.name, op.value); err != nil {
+				errs = append(errs, &BatchError{Index: i, Property: op.name, Err: err})
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SetAll assigns the provided values to the properties of obj, named by
+// the map keys, with a single trip into the main GUI thread. Properties
+// are assigned in the lexical order of their names. An assignment that
+// fails does not prevent the others from being made, and all failures
+// are returned together as a BatchErrors value.
+func (obj *Object) SetAll(values map[string]interface{}) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Batch(func(b *Batcher) {
+		for _, name := range names {
+			b.Set(obj, name, values[name])
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package qml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FieldObserver is called when QML code assigns a new value to an exposed
+// field of a Go value, with the field values before and after the
+// assignment. If it returns an error, the assignment is rejected and
+// the field is restored to its old value.
+type FieldObserver func(old, new interface{}) error
+
+// fieldObservers holds the observers registered via SetFieldObserver,
+// by Go value and field name.
+//
+// Only accessed from the main GUI thread.
+var fieldObservers = make(map[interface{}]map[string]FieldObserver)
+
+// SetFieldObserver registers f to be called whenever QML code assigns to
+// the named field of value, which must be a pointer to a struct, such as
+// when a Binding element targets the respective property, or when a
+// handler assigns to it. The field is named as in Go. The observer may
+// validate the new value and persist it, and is called in the main GUI
+// thread right after the field is assigned, so it must not block. If f
+// is nil, the observer previously registered for the field is removed.
+//
+// Observers may also be declared by tagging the field with the name of a
+// method of the value with the FieldObserver signature:
+//
+//     type Settings struct {
+//         UserName string `qmlobserver:"CheckUserName"`
+//     }
+//
+//     func (s *Settings) CheckUserName(old, new interface{}) error
+//
+// Observers registered via SetFieldObserver take precedence over tags.
+// Assignments that change the field value, or that are rejected by the
+// observer, are reported to QML as done by Changed, so that other
+// bindings reading the property are updated.
+func SetFieldObserver(value interface{}, field string, f FieldObserver) {
+	if _, ok := reflect.Indirect(reflect.ValueOf(value)).Type().FieldByName(field); !ok {
+		panic(fmt.Sprintf("cannot observe field %q: %T has no such field", field, value))
+	}
+	gui(func() {
+		observers := fieldObservers[value]
+		if f == nil {
+			delete(observers, field)
+			if len(observers) == 0 {
+				delete(fieldObservers, value)
+			}
+			return
+		}
+		if observers == nil {
+			observers = make(map[string]FieldObserver)
+			fieldObservers[value] = observers
+		}
+		observers[field] = f
+	})
+}
+
+// SetField assigns v to the named field of value, which must be a pointer
+// to a struct, and reports the change to QML as done by Changed. The field
+// is named as in Go, and v must be convertible to the field type.
+//
+// Assignments made via SetField run in the main GUI thread, so they are
+// ordered with the assignments made by QML code: whichever runs last
+// defines the field value, and QML is notified of the result in both
+// cases. Go code that changes fields directly and calls Changed must
+// otherwise synchronize with the assignments made by QML itself. Field
+// observers are not called for assignments made by SetField.
+func SetField(value interface{}, field string, v interface{}) error {
+	var err error
+	gui(func() {
+		fv := reflect.Indirect(reflect.ValueOf(value)).FieldByName(field)
+		if !fv.IsValid() || !fv.CanSet() {
+			err = fmt.Errorf("cannot set field %q: %T has no such exported field", field, value)
+			return
+		}
+		var cv reflect.Value
+		cv, err = coerce(v, fv.Type())
+		if err != nil {
+			err = fmt.Errorf("cannot set field %q: %v", field, err)
+			return
+		}
+		fv.Set(cv)
+		Changed(value, fv.Addr().Interface())
+	})
+	return err
+}
+
+// observeWrite calls the observer of the field at index of gvalue, if
+// any, after the field was changed from old by QML code. The old value
+// is restored if the observer rejects the change. It returns whether QML
+// must be notified of the outcome.
+//
+// This must be run from the main GUI thread.
+func observeWrite(gvalue interface{}, index int, field, old reflect.Value) (notify bool) {
+	v := reflect.Indirect(reflect.ValueOf(gvalue))
+	var sf reflect.StructField
+	if index < v.NumField() {
+		sf = v.Type().Field(index)
+	} else {
+		sf = v.Type().FieldByIndex(promotedFields[v.Type()][index-v.NumField()])
+	}
+	f := fieldObservers[gvalue][sf.Name]
+	if method := sf.Tag.Get("qmlobserver"); f == nil && method != "" {
+		mv := reflect.ValueOf(gvalue).MethodByName(method)
+		if !mv.IsValid() {
+			panic(fmt.Sprintf("field %s of %T is observed by %s, which is not a method of the type", sf.Name, gvalue, method))
+		}
+		var ok bool
+		f, ok = mv.Interface().(func(old, new interface{}) error)
+		if !ok {
+			panic(fmt.Sprintf("method %s of %T does not have the signature of qml.FieldObserver", method, gvalue))
+		}
+	}
+	if f != nil {
+		if err := f(old.Interface(), field.Interface()); err != nil {
+			field.Set(old)
+			return true
+		}
+	}
+	return !reflect.DeepEqual(old.Interface(), field.Interface())
+}
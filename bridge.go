@@ -1,6 +1,6 @@
 package qml
 
-// #cgo CPPFLAGS: -I/usr/include/qt5/QtCore/5.0.2/QtCore -I/usr/include/qt/QtCore/5.1.1/QtCore -I./cpp
+// #cgo CPPFLAGS: -I/usr/include/qt5/QtCore/5.0.2/QtCore -I/usr/include/qt/QtCore/5.1.1/QtCore -I/usr/include/qt5/QtQml/5.0.2/QtQml -I/usr/include/qt/QtQml/5.1.1/QtQml -I/usr/include/qt5/QtGui/5.0.2 -I/usr/include/qt5/QtGui/5.0.2/QtGui -I/usr/include/qt/QtGui/5.1.1 -I/usr/include/qt/QtGui/5.1.1/QtGui -I/usr/include/qt5/QtQuick/5.0.2 -I/usr/include/qt5/QtQuick/5.0.2/QtQuick -I/usr/include/qt/QtQuick/5.1.1 -I/usr/include/qt/QtQuick/5.1.1/QtQuick -I./cpp
 // #cgo CXXFLAGS: -std=c++0x -pedantic-errors -Wall -fno-strict-aliasing
 // #cgo LDFLAGS: -lstdc++
 // #cgo pkg-config: Qt5Core Qt5Widgets Qt5Quick glib-2.0
@@ -12,35 +12,139 @@ import "C"
 import (
 	"fmt"
 	"github.com/niemeyer/qml/tref"
+	"log"
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 var hookWaiting C.int
 
+// mainRef holds the reference of the main thread, which the main
+// goroutine is locked to so that Main may run the GUI loop in it.
+var mainRef uintptr
+
+func init() {
+	runtime.LockOSThread()
+	mainRef = tref.Ref()
+}
+
 // guiLoop runs the main GUI thread event loop in C++ land.
 func guiLoop() {
 	runtime.LockOSThread()
 	guiLoopRef = tref.Ref()
 	guiLoopReady.Unlock()
-	C.newGuiApplication()
+	defer guiRecover()
+	newGuiApplication()
 	C.startIdleTimer(&hookWaiting)
 	C.applicationExec()
 }
 
 var (
-	guiFunc      = make(chan func())
-	guiDone      = make(chan struct{})
+	guiFunc      = make(chan guiRequest)
 	guiLock      = 0
 	guiLoopReady sync.Mutex
 	guiLoopRef   uintptr
+
+	// guiDead is closed once the main GUI loop dies due to a panic,
+	// which is then held in guiPanic.
+	guiDead         = make(chan bool)
+	guiPanic        *GUIPanic
+	guiPanicMutex   sync.Mutex
+	guiPanicHandler func(recovered interface{}, stack []byte)
 )
 
+// guiRoundTrips counts the functions handed by other goroutines to the
+// main GUI thread via gui. Accessed atomically.
+var guiRoundTrips uint64
+
+// guiRequest holds a function sent to the main GUI thread via gui, and
+// the channel its outcome is reported on. Each request has its own
+// channel, as the GUI thread may run requests while others are waiting,
+// such as in guiServe.
+type guiRequest struct {
+	f    func()
+	done chan interface{}
+}
+
+// GUIPanic is the value package functions panic with once the main GUI
+// loop died due to a panic that happened within it, such as a panic in
+// a method of a Go value called by QML code. It holds the value the loop
+// panicked with and the stack trace at the time of the panic.
+type GUIPanic struct {
+	Recovered interface{}
+	Stack     []byte
+}
+
+func (p *GUIPanic) Error() string {
+	return fmt.Sprintf("qml: main GUI loop died after a panic: %v", p.Recovered)
+}
+
+// SetGUIPanicHandler sets f to be called if the main GUI loop dies due to
+// a panic that happened within it, with the value it panicked with and
+// the stack trace at the time of the panic. Once the loop dies, package
+// functions that depend on it panic with a *GUIPanic rather than blocking
+// forever, but the application may be otherwise unaware of the problem,
+// so f is the place to save any state and exit cleanly. Without a handler,
+// the panic is logged.
+//
+// The function is called in the main GUI thread, after the loop died, so
+// it must not use the qml package.
+func SetGUIPanicHandler(f func(recovered interface{}, stack []byte)) {
+	guiPanicMutex.Lock()
+	guiPanicHandler = f
+	guiPanicMutex.Unlock()
+}
+
+// guiRecover recovers from a panic that is killing the main GUI loop,
+// and makes further calls to gui fail rather than block forever.
+func guiRecover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	// Deferred functions run before the panicking stack unwinds.
+	stack := debug.Stack()
+	guiPanicMutex.Lock()
+	guiPanic = &GUIPanic{r, stack}
+	handler := guiPanicHandler
+	guiPanicMutex.Unlock()
+	close(guiDead)
+	if handler != nil {
+		handler(r, stack)
+	} else {
+		log.Printf("qml: main GUI loop died after a panic: %v\n%s", r, stack)
+	}
+}
+
+// guiDeadPanic panics with the value describing why the main GUI
+// loop died.
+func guiDeadPanic() {
+	guiPanicMutex.Lock()
+	p := guiPanic
+	guiPanicMutex.Unlock()
+	panic(p)
+}
+
 // gui runs f in the main GUI thread and waits for f to return.
+// If f panics, the panic is propagated to the calling goroutine.
+//
+// If the main GUI loop died due to a panic, gui panics with a *GUIPanic
+// rather than blocking forever. If the package was not initialized yet,
+// it's initialized with default options first, as done by Init.
 func gui(f func()) {
+	if atomic.LoadInt32(&initialized) == 0 {
+		initLazily()
+	}
+	select {
+	case <-guiDead:
+		guiDeadPanic()
+	default:
+	}
 	if tref.Ref() == guiLoopRef {
 		// Already within the GUI thread. Attempting to wait would deadlock.
 		f()
@@ -51,10 +155,39 @@ func gui(f func()) {
 	atomic.AddInt32((*int32)(unsafe.Pointer(&hookWaiting)), 1)
 
 	// Send f to be executed by the idle hook in the main GUI thread.
-	guiFunc <- f
+	atomic.AddUint64(&guiRoundTrips, 1)
+	req := guiRequest{f, make(chan interface{}, 1)}
+	select {
+	case guiFunc <- req:
+	case <-guiDead:
+		guiDeadPanic()
+	}
 
 	// Wait until f is done executing.
-	<-guiDone
+	select {
+	case p := <-req.done:
+		if p != nil {
+			panic(p)
+		}
+	case <-guiDead:
+		guiDeadPanic()
+	}
+}
+
+// onGuiThread returns whether the caller is running in the main GUI thread.
+// It's used by the hooks called from C++, which access the state of the
+// package without locking. When a hook is called from a different thread,
+// a diagnostic is logged and the hook must rerun itself via gui, which
+// blocks the calling thread until the main GUI thread is idle.
+func onGuiThread(hook string) bool {
+	if tref.Ref() == guiLoopRef {
+		return true
+	}
+	if isStrict() {
+		strictPanic(hook+" called from a thread other than the main GUI thread", nil)
+	}
+	log.Printf("qml: %s called from a thread other than the main GUI thread; running it there instead\n%s", hook, debug.Stack())
+	return false
 }
 
 // Lock freezes all QML activity by blocking the main event loop.
@@ -86,6 +219,25 @@ func Unlock() {
 	})
 }
 
+// RunMain runs f in the main GUI thread, where Qt runs its event loop,
+// and returns once f returns. This is useful for integrating libraries
+// that must be called from the same thread used by Qt, such as some
+// OpenGL operations.
+//
+// RunMain may be called from within the main GUI thread, such as from
+// within another function run by RunMain, in which case f runs right
+// away rather than deadlocking. Functions provided to RunMain may use
+// any qml functionality. While f runs, the GUI event loop is blocked,
+// so f must not wait for follow up QML events to be processed, as
+// documented in Lock.
+//
+// If f panics, the panic is recovered in the main GUI thread, so that
+// the event loop is not affected, and is raised again in the goroutine
+// that called RunMain.
+func RunMain(f func()) {
+	gui(f)
+}
+
 // Flush synchronously flushes all pending QML activities.
 func Flush() {
 	// TODO Better testing for this.
@@ -95,11 +247,18 @@ func Flush() {
 }
 
 // Changed notifies all QML bindings that the given field value has changed.
+// Changed may be called from any goroutine, and has no effect if the value
+// is not currently available to QML.
 //
 // For example:
 //
 //     qml.Changed(&value, &value.Field)
 //
+// Notifications issued concurrently are delivered together in a single trip
+// to the GUI thread, and repeated notifications for the same field within
+// that trip are delivered once. For that reason Changed may return before
+// the notification is delivered, if another goroutine is already waiting
+// to deliver the pending notifications.
 func Changed(value, fieldAddr interface{}) {
 	valuev := reflect.ValueOf(value)
 	fieldv := reflect.ValueOf(fieldAddr)
@@ -117,32 +276,91 @@ func Changed(value, fieldAddr interface{}) {
 		panic("provided field is not a member of the given value")
 	}
 
-	found := false
-	gui(func() {
+	changedMutex.Lock()
+	changedPending = append(changedPending, changedField{value, offset})
+	deliver := len(changedPending) == 1
+	changedMutex.Unlock()
+	if deliver {
+		gui(deliverChanged)
+	}
+}
+
+type changedField struct {
+	value  interface{}
+	offset uintptr
+}
+
+var (
+	changedMutex   sync.Mutex
+	changedPending []changedField
+)
+
+// deliverChanged activates the change signals for all the fields
+// pending notification via Changed.
+//
+// This must be run from the main GUI thread.
+func deliverChanged() {
+	changedMutex.Lock()
+	pending := changedPending
+	changedPending = nil
+	changedMutex.Unlock()
+
+	seen := make(map[changedField]bool)
+	for _, changed := range pending {
+		if seen[changed] {
+			continue
+		}
+		seen[changed] = true
+		observeUndo(changed.value, changed.offset)
+		value, offset := changed.value, C.int(changed.offset)
 		tinfo := typeInfo(value)
 		for _, engine := range engines {
-			fold := engine.values[value]
-			for fold != nil {
-				found = true
-				C.goValueActivate(fold.cvalue, tinfo, C.int(offset))
-				fold = fold.next
+			for fold := engine.values[value]; fold != nil; fold = fold.next {
+				C.goValueActivate(fold.cvalue, tinfo, offset)
 			}
-			// TODO typeNew might also be a linked list keyed by the gvalue.
-			//      This would prevent the iteration and the deferrals.
-			for fold, _ = range typeNew {
-				if fold.gvalue == value {
-					found = true
-					// Activate these later so they don't get recursively moved
-					// out of typeNew while the iteration is still happening.
-					defer C.goValueActivate(fold.cvalue, tinfo, C.int(offset))
-				}
+		}
+		// The slice isn't modified as activation moves the folds
+		// out of typeNew, so it may be iterated over directly.
+		for _, fold := range typeNewByValue[value] {
+			C.goValueActivate(fold.cvalue, tinfo, offset)
+		}
+	}
+}
+
+// Emit emits the named signal on every QML object wrapping value, with
+// the provided arguments. Signals are declared by exported fields of func
+// type, as documented in Context.SetVar, and calling a nil field injected
+// by the qml package has the same effect. Emit is useful when the field
+// was set by Go code, and like the injected functions it may be called
+// from any goroutine. It has no effect if value was not made available
+// to QML yet.
+//
+// Emit panics if the type of value declares no signal with the given
+// name, or if the number of arguments doesn't match the signal.
+func Emit(value interface{}, signal string, args ...interface{}) {
+	var member *C.GoMemberInfo
+	gui(func() {
+		tinfo := typeInfo(value)
+		for i := 0; i < int(tinfo.signalMembersLen); i++ {
+			m := (*C.GoMemberInfo)(unsafe.Pointer(uintptr(unsafe.Pointer(tinfo.signalMembers)) + uintptr(i)*uintptr(memberInfoSize)))
+			if C.GoString(m.memberName) == signal {
+				member = m
+				break
 			}
 		}
 	})
-	if !found {
-		// TODO Perhaps return an error instead.
-		panic("value is not known")
+	if member == nil {
+		panic(fmt.Sprintf("type %T has no signal %q", value, signal))
 	}
+	if int(member.numIn) != len(args) {
+		panic(fmt.Sprintf("signal %q of type %T takes %d arguments, got %d", signal, value, member.numIn, len(args)))
+	}
+	vargs := make([]reflect.Value, len(args))
+	for i := range args {
+		// Retain the interface type so nil arguments are valid.
+		vargs[i] = reflect.ValueOf(&args[i]).Elem()
+	}
+	emitSignal(value, int(member.reflectIndex), vargs)
 }
 
 // hookIdleTimer is run once per iteration of the Qt event loop,
@@ -151,23 +369,56 @@ func Changed(value, fieldAddr interface{}) {
 //
 //export hookIdleTimer
 func hookIdleTimer() {
-	var f func()
+	var req guiRequest
 	for {
 		select {
-		case f = <-guiFunc:
+		case req = <-guiFunc:
 		default:
 			if guiLock > 0 {
-				f = <-guiFunc
+				req = <-guiFunc
 			} else {
 				return
 			}
 		}
-		f()
-		guiDone <- struct{}{}
+		req.done <- guiCall(req.f)
 		atomic.AddInt32((*int32)(unsafe.Pointer(&hookWaiting)), -1)
 	}
 }
 
+// guiServe runs the functions provided to gui by other goroutines until
+// done is closed, or until timeout elapses, in which case it returns false.
+// It allows the main GUI thread to wait for goroutines that use the qml
+// package without processing any other events meanwhile.
+//
+// This must be run from the main GUI thread.
+func guiServe(done <-chan bool, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case req := <-guiFunc:
+			req.done <- guiCall(req.f)
+			atomic.AddInt32((*int32)(unsafe.Pointer(&hookWaiting)), -1)
+		case <-done:
+			return true
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// guiCall runs f and returns the value it panicked with, if any.
+func guiCall(f func()) (panicked interface{}) {
+	previous := atomic.SwapUintptr(&guiCurrent, funcEntry(f))
+	defer func() {
+		atomic.StoreUintptr(&guiCurrent, previous)
+		releasePacked()
+		panicked = recover()
+	}()
+	f()
+	return nil
+}
+
 type valueFold struct {
 	engine *Engine
 	gvalue interface{}
@@ -175,6 +426,13 @@ type valueFold struct {
 	prev   *valueFold
 	next   *valueFold
 	owner  valueOwner
+
+	// spec is the registered type the value was created for by QML.
+	spec *TypeSpec
+
+	// watched is whether a finalizer reports the fold being garbage
+	// collected before it's released, as done by SetLeakDetection.
+	watched bool
 }
 
 type valueOwner uint8
@@ -182,6 +440,7 @@ type valueOwner uint8
 const (
 	cppOwner = 1 << iota
 	jsOwner
+	ctxOwner // Held by a context created via Context.Spawn.
 )
 
 // wrapGoValue creates a new GoValue object in C++ land wrapping
@@ -192,8 +451,12 @@ func wrapGoValue(engine *Engine, gvalue interface{}, owner valueOwner) (cvalue u
 
 	// TODO Return an error if gvalue is a non-basic type and not a pointer.
 	//      Pointer-to-pointer is also not okay.
+	gvalue = dynamicValue(gvalue)
+
+	// Values held by spawned contexts always get their own wrapper,
+	// so that destroying the context releases exactly what it holds.
 	prev, ok := engine.values[gvalue]
-	if ok && (prev.owner == owner || owner != cppOwner) {
+	if ok && owner != ctxOwner && (prev.owner == owner || owner != cppOwner) {
 		return prev.cvalue
 	}
 
@@ -206,24 +469,151 @@ func wrapGoValue(engine *Engine, gvalue interface{}, owner valueOwner) (cvalue u
 		gvalue: gvalue,
 		owner:  owner,
 	}
-	fold.cvalue = C.newGoValue(unsafe.Pointer(fold), typeInfo(gvalue), parent)
+	tinfo := typeInfo(gvalue)
+	fold.cvalue = C.newGoValue(unsafe.Pointer(fold), tinfo, parent)
+	injectSignals(gvalue)
 	if prev != nil {
+		for prev.next != nil {
+			prev = prev.next
+		}
 		prev.next = fold
 		fold.prev = prev
 	} else {
 		engine.values[gvalue] = fold
 	}
 	stats.valuesAlive(+1)
+	recordWrap(engine, gvalue)
+	watchFold(fold)
 	C.engineSetContextForObject(engine.addr, fold.cvalue)
 	switch owner {
-	case cppOwner:
+	case cppOwner, ctxOwner:
 		C.engineSetOwnershipCPP(engine.addr, fold.cvalue)
 	case jsOwner:
 		C.engineSetOwnershipJS(engine.addr, fold.cvalue)
 	}
+	activateValue(engine, gvalue)
 	return fold.cvalue
 }
 
+// LazyValue is implemented by Go values that are expensive to populate,
+// so that the work may be deferred until the values are used with QML.
+// The QMLActivate method is called the first time a value is provided to
+// QML code running under an engine, such as via Context.SetVar or as the
+// result of a method called by QML code, and before QML code may observe
+// any of its fields. It is called exactly once per engine, even if the
+// value is provided again after QML code releases it, so the engine holds
+// values implementing LazyValue until the engine is destroyed.
+//
+// QMLActivate is called in the main GUI thread while the value is being
+// provided to QML, so the GUI event loop is blocked until it returns. It
+// should populate the value quickly, or start a goroutine that populates
+// it and reports the changes via Changed. Panics in QMLActivate are logged
+// and do not prevent the value from being used.
+type LazyValue interface {
+	QMLActivate()
+}
+
+// activateValue calls the QMLActivate method of gvalue if it implements
+// LazyValue and was not yet activated for engine.
+//
+// This must be run from the main GUI thread.
+func activateValue(engine *Engine, gvalue interface{}) {
+	lazy, ok := gvalue.(LazyValue)
+	if !ok || engine.activated[gvalue] {
+		return
+	}
+	if engine.activated == nil {
+		engine.activated = make(map[interface{}]bool)
+	}
+	engine.activated[gvalue] = true
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("qml: panic in %T.QMLActivate: %v\n%s", gvalue, r, debug.Stack())
+		}
+	}()
+	lazy.QMLActivate()
+}
+
+// wrapGoValueGraph wraps gvalue as done by wrapGoValue, and then walks
+// the exported fields of the value wrapping any further struct pointers
+// found, either directly or as elements of slices, arrays, and maps, so
+// that they are ready by the time QML code accesses them. The walk goes
+// at most depth levels deep, with each struct and each slice, array, or
+// map counting as a level, and stops once budget values were wrapped.
+// Values already in seen are not visited again.
+//
+// This must be run from the main GUI thread.
+func wrapGoValueGraph(engine *Engine, gvalue interface{}, owner valueOwner, depth int, budget *int, seen map[interface{}]bool) {
+	if *budget <= 0 || seen[gvalue] {
+		return
+	}
+	v := reflect.ValueOf(gvalue)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	seen[gvalue] = true
+	wrapGoValue(engine, gvalue, owner)
+	*budget--
+	v = v.Elem()
+	vt := v.Type()
+	for i, n := 0, v.NumField(); i < n; i++ {
+		if _, ok := wrappedFieldName(vt, vt.Field(i), false); !ok {
+			continue // not exposed
+		}
+		wrapGoValueElems(engine, v.Field(i), owner, depth-1, budget, seen)
+	}
+}
+
+// wrapGoValueElems wraps via wrapGoValueGraph the struct pointer held
+// in v, or the ones held as elements of v if it's a slice, an array, or
+// a map, with depth as in wrapGoValueGraph.
+//
+// This must be run from the main GUI thread.
+func wrapGoValueElems(engine *Engine, v reflect.Value, owner valueOwner, depth int, budget *int, seen map[interface{}]bool) {
+	if depth < 0 {
+		return
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() && v.Type() != typeObjectPtr {
+			wrapGoValueGraph(engine, v.Interface(), owner, depth, budget, seen)
+		}
+	case reflect.Slice, reflect.Array:
+		if !mayHoldPointers(v.Type().Elem()) {
+			return
+		}
+		for i, n := 0, v.Len(); i < n && *budget > 0; i++ {
+			wrapGoValueElems(engine, v.Index(i), owner, depth-1, budget, seen)
+		}
+	case reflect.Map:
+		if !mayHoldPointers(v.Type().Elem()) {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			if *budget <= 0 {
+				break
+			}
+			wrapGoValueElems(engine, v.MapIndex(key), owner, depth-1, budget, seen)
+		}
+	}
+}
+
+// mayHoldPointers returns whether values of type t may hold struct
+// pointers that wrapGoValueElems walks into.
+func mayHoldPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
 // typeNew holds fold values that are created by registered types.
 // These values are special in two senses: first, they don't have a
 // reference to an engine before they are used in a context that can
@@ -237,26 +627,225 @@ func wrapGoValue(engine *Engine, gvalue interface{}, owner valueOwner) (cvalue u
 // gvalue may occur.
 var typeNew = make(map[*valueFold]bool)
 
+// typeNewByValue indexes the folds in typeNew by their Go value, so
+// that the folds of a value are found without iterating over typeNew.
+// Slices in it are never modified in place, so they may be iterated
+// over while folds are added and removed.
+var typeNewByValue = make(map[interface{}][]*valueFold)
+
+// addTypeNew records fold in typeNew.
+//
+// This must be run from the main GUI thread.
+func addTypeNew(fold *valueFold) {
+	typeNew[fold] = true
+	typeNewByValue[fold.gvalue] = append(typeNewByValue[fold.gvalue], fold)
+}
+
+// removeTypeNew drops fold from typeNew, and returns whether it was there.
+//
+// This must be run from the main GUI thread.
+func removeTypeNew(fold *valueFold) bool {
+	if !typeNew[fold] {
+		return false
+	}
+	delete(typeNew, fold)
+	folds := typeNewByValue[fold.gvalue]
+	for i, f := range folds {
+		if f == fold {
+			folds = append(folds[:i:i], folds[i+1:]...)
+			break
+		}
+	}
+	if len(folds) == 0 {
+		delete(typeNewByValue, fold.gvalue)
+	} else {
+		typeNewByValue[fold.gvalue] = folds
+	}
+	return true
+}
+
 //export hookGoValueTypeNew
 func hookGoValueTypeNew(cvalue unsafe.Pointer, specp unsafe.Pointer) (foldp unsafe.Pointer) {
+	if !onGuiThread("hookGoValueTypeNew") {
+		gui(func() { foldp = hookGoValueTypeNew(cvalue, specp) })
+		return foldp
+	}
+	spec := (*TypeSpec)(specp)
+	for spec.replacement != nil {
+		spec = spec.replacement
+	}
 	fold := &valueFold{
-		gvalue: (*TypeSpec)(specp).New(),
+		gvalue: spec.New(),
 		cvalue: cvalue,
 		owner:  jsOwner,
+		spec:   spec,
 	}
-	typeNew[fold] = true
+	addTypeNew(fold)
 	stats.valuesAlive(+1)
+	watchFold(fold)
+	// The value was just created, so nothing else may be using it.
+	injectSignals(fold.gvalue)
 	return unsafe.Pointer(fold)
 }
 
+//export hookGoValueTypeInit
+func hookGoValueTypeInit(cvalue unsafe.Pointer, foldp unsafe.Pointer) {
+	if !onGuiThread("hookGoValueTypeInit") {
+		gui(func() { hookGoValueTypeInit(cvalue, foldp) })
+		return
+	}
+	fold := (*valueFold)(foldp)
+	if fold.spec.Focusable {
+		C.itemSetActiveFocusOnTab(cvalue)
+	}
+	if mouse, hover := acceptsMouse(fold.gvalue); mouse || hover {
+		var cmouse, chover C.int
+		if mouse {
+			cmouse = 1
+		}
+		if hover {
+			chover = 1
+		}
+		C.itemAcceptMouse(cvalue, cmouse, chover)
+	}
+	if fold.spec.Init != nil {
+		fold.spec.Init(wrapObject(cvalue, fold.engine), fold.gvalue)
+	}
+}
+
+// injectSignals sets the exported func fields of gvalue that are exposed
+// to QML as signals to functions that emit the respective signal on every
+// QML object wrapping gvalue, so that Go code emits a signal by calling
+// the field. Only nil fields are set, so a function assigned by Go code
+// before or after the value is exposed is left alone, and calling it
+// does not emit the signal.
+//
+// The package functions that hand values over to QML call injectSignals
+// in the calling goroutine before the value is published to the main GUI
+// thread, so that the fields aren't assigned concurrently with the Go
+// code that owns the value. Values first reached by QML via other values,
+// such as via field reads and method results, and values created by
+// registered types, have their fields set by the main GUI thread instead.
+func injectSignals(gvalue interface{}) {
+	v := reflect.ValueOf(dynamicValue(gvalue))
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	gvalue = v.Interface()
+	v = v.Elem()
+	info := signalsInfo(v.Type())
+	for _, signal := range info.Signals {
+		field, ok := signalField(v, info, signal.Index)
+		if !ok || !field.IsNil() {
+			continue
+		}
+		index := signal.Index
+		field.Set(reflect.MakeFunc(field.Type(), func(args []reflect.Value) []reflect.Value {
+			emitSignal(gvalue, index, args)
+			return nil
+		}))
+	}
+}
+
+var (
+	signalsMutex sync.Mutex
+	signalsCache = make(map[reflect.Type]*TypeInfo)
+)
+
+// signalsInfo returns the member information of vt obtained via
+// reflection, for injecting signals from any goroutine. Type information
+// recorded via UseTypeInfo declares the same signals at the same indexes.
+func signalsInfo(vt reflect.Type) *TypeInfo {
+	signalsMutex.Lock()
+	defer signalsMutex.Unlock()
+	info, ok := signalsCache[vt]
+	if !ok {
+		info = reflectTypeInfo(vt)
+		signalsCache[vt] = info
+	}
+	return info
+}
+
+// signalField returns the field of v at index, as recorded in info,
+// and whether it's reachable without traversing nil embedded pointers.
+func signalField(v reflect.Value, info *TypeInfo, index int) (reflect.Value, bool) {
+	if index < v.NumField() {
+		return v.Field(index), true
+	}
+	for i, fi := range info.promoted[index-v.NumField()] {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(fi)
+	}
+	return v, true
+}
+
+// emitSignal emits the signal declared by the field at index of gvalue,
+// with the provided arguments, on every QML object wrapping gvalue.
+func emitSignal(gvalue interface{}, index int, args []reflect.Value) {
+	var params [C.MaximumParamCount - 1]C.DataValue
+	gui(func() {
+		var signal *C.GoMemberInfo
+		tinfo := typeInfo(gvalue)
+		for i := 0; i < int(tinfo.signalMembersLen); i++ {
+			m := (*C.GoMemberInfo)(unsafe.Pointer(uintptr(unsafe.Pointer(tinfo.signalMembers)) + uintptr(i)*uintptr(memberInfoSize)))
+			if int(m.reflectIndex) == index {
+				signal = m
+				break
+			}
+		}
+		if signal == nil {
+			return
+		}
+		emit := func(fold *valueFold) {
+			if fold.engine == nil {
+				// Created by a registered type and not yet used.
+				enginep := C.objectEngine(fold.cvalue)
+				if enginep == nilPtr {
+					return
+				}
+				fold = ensureEngine(enginep, unsafe.Pointer(fold))
+			}
+			for i, arg := range args {
+				packDataValue(arg.Interface(), &params[i], fold.engine, jsOwner)
+			}
+			C.goValueEmit(fold.cvalue, signal.metaIndex, &params[0], C.int(len(args)))
+		}
+		var folds []*valueFold
+		for _, engine := range engines {
+			for fold := engine.values[gvalue]; fold != nil; fold = fold.next {
+				folds = append(folds, fold)
+			}
+		}
+		folds = append(folds, typeNewByValue[gvalue]...)
+		// Handlers may cause further folds to be created, so only
+		// emit once all the current ones are known.
+		for _, fold := range folds {
+			emit(fold)
+		}
+	})
+}
+
 //export hookGoValueDestroyed
 func hookGoValueDestroyed(enginep unsafe.Pointer, foldp unsafe.Pointer) {
+	if !onGuiThread("hookGoValueDestroyed") {
+		gui(func() { hookGoValueDestroyed(enginep, foldp) })
+		return
+	}
 	fold := (*valueFold)(foldp)
+	if fold.spec != nil && fold.spec.Destroy != nil {
+		fold.spec.Destroy(fold.gvalue)
+	}
+	if fold.owner == ctxOwner {
+		forgetSwappedVar(fold.cvalue)
+	}
 	engine := fold.engine
 	if engine == nil {
-		before := len(typeNew)
-		delete(typeNew, fold)
-		if len(typeNew) == before {
+		if !removeTypeNew(fold) {
 			panic("destroying value without an associated engine; who created the value?")
 		}
 	} else if engines[engine.addr] == nil {
@@ -282,46 +871,103 @@ func hookGoValueDestroyed(enginep unsafe.Pointer, foldp unsafe.Pointer) {
 			if len(engine.values) == before {
 				panic("destroying value that knows about the engine, but the engine doesn't know about the value; who cleared the engine?")
 			}
-			if engine.destroyed && len(engine.values) == 0 {
+			if engine.isDestroyed() && len(engine.values) == 0 {
 				delete(engines, engine.addr)
 			}
 		}
 	}
+	if engine != nil && !engine.isDestroyed() && fold.owner == jsOwner {
+		stats.valuesEvicted(+1)
+		recordEviction(engine, fold.gvalue)
+	}
 	stats.valuesAlive(-1)
+	unwatchFold(fold)
 }
 
 //export hookGoValueReadField
 func hookGoValueReadField(enginep, foldp unsafe.Pointer, reflectIndex C.int, resultdv *C.DataValue) {
+	if !onGuiThread("hookGoValueReadField") {
+		gui(func() { hookGoValueReadField(enginep, foldp, reflectIndex, resultdv) })
+		return
+	}
 	fold := ensureEngine(enginep, foldp)
 	v := reflect.ValueOf(fold.gvalue)
 	for v.Type().Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
-	field := v.Field(int(reflectIndex))
+	if p := fold.engine.profile; p != nil {
+		defer p.measure("read", profileName(v, int(reflectIndex), false), time.Now())
+	}
+	field, ok := valueField(v, int(reflectIndex), false)
+	if !ok {
+		// Promoted from a nil embedded pointer.
+		resultdv.dataType = C.DTInvalid
+		return
+	}
 
 	// TODO Strings are being passed in an unsafe manner here. There is a
 	// small chance that the field is changed and the garbage collector is run
 	// before C++ has a chance to look at the data. We can solve this problem
 	// by queuing up values in a stack, and cleaning the stack when the
 	// idle timer fires next.
-	packDataValue(field.Interface(), resultdv, fold.engine, jsOwner)
+	packResult(field.Interface(), resultdv, fold.engine)
 }
 
 //export hookGoValueWriteField
 func hookGoValueWriteField(enginep, foldp unsafe.Pointer, reflectIndex C.int, assigndv *C.DataValue) {
+	if !onGuiThread("hookGoValueWriteField") {
+		gui(func() { hookGoValueWriteField(enginep, foldp, reflectIndex, assigndv) })
+		return
+	}
 	fold := ensureEngine(enginep, foldp)
 	v := reflect.ValueOf(fold.gvalue)
 	for v.Type().Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
-	field := v.Field(int(reflectIndex))
+	if p := fold.engine.profile; p != nil {
+		defer p.measure("write", profileName(v, int(reflectIndex), false), time.Now())
+	}
+	field, ok := valueField(v, int(reflectIndex), true)
+	if !ok {
+		// Promoted from a nil embedded pointer that cannot be set.
+		return
+	}
 	assign := unpackDataValue(assigndv, fold.engine)
+	old := reflect.New(field.Type()).Elem()
+	old.Set(field)
 
 	// TODO Return false to the call site if it fails. That's how Qt seems to handle it internally.
-	convertAndSet(field, reflect.ValueOf(assign))
+	if err := convertAndSet(field, reflect.ValueOf(assign)); err != nil {
+		// The assigned value was consumed, so assigndv reports the error.
+		packError(err, assigndv)
+		return
+	}
+
+	if observeWrite(fold.gvalue, int(reflectIndex), field, old) && field.Type().Size() > 0 {
+		if offset := field.UnsafeAddr() - v.UnsafeAddr(); offset < v.Type().Size() {
+			// Fields reached via embedded pointers are out of reach.
+			Changed(fold.gvalue, field.Addr().Interface())
+		}
+	}
 }
 
-func convertAndSet(to, from reflect.Value) {
+// convertAndSet sets to to from, converted as necessary. The error
+// returned reports a string that couldn't be unmarshaled into to.
+func convertAndSet(to, from reflect.Value) error {
+	if useMarshalers && from.Kind() == reflect.String {
+		if v, ok, err := unmarshalText(from.String(), to.Type()); ok {
+			if err != nil {
+				return err
+			}
+			to.Set(v)
+			return nil
+		}
+	}
+	if to.Type() == typeDuration && isNumber(from.Kind()) {
+		v, _ := coerce(from.Interface(), typeDuration)
+		to.Set(v)
+		return nil
+	}
 	defer func() {
 		if v := recover(); v != nil {
 			// TODO This should be an error. Test and fix.
@@ -329,6 +975,7 @@ func convertAndSet(to, from reflect.Value) {
 		}
 	}()
 	to.Set(from.Convert(to.Type()))
+	return nil
 }
 
 var (
@@ -338,6 +985,10 @@ var (
 
 //export hookGoValueCallMethod
 func hookGoValueCallMethod(enginep, foldp unsafe.Pointer, reflectIndex C.int, args *C.DataValue) {
+	if !onGuiThread("hookGoValueCallMethod") {
+		gui(func() { hookGoValueCallMethod(enginep, foldp, reflectIndex, args) })
+		return
+	}
 	fold := ensureEngine(enginep, foldp)
 	v := reflect.ValueOf(fold.gvalue)
 
@@ -345,29 +996,46 @@ func hookGoValueCallMethod(enginep, foldp unsafe.Pointer, reflectIndex C.int, ar
 	//      gvalue here for that. This should happen in a sensible place in the wrapping functions
 	//      that can still error out to the user in due time.
 
+	if p := fold.engine.profile; p != nil {
+		defer p.measure("method", profileName(v, int(reflectIndex), true), time.Now())
+	}
 	method := v.Method(int(reflectIndex))
 
-	// TODO Ensure methods with more parameters than this are not registered.
+	// Methods with more parameters than this are not exposed.
 	var params [C.MaximumParamCount - 1]reflect.Value
 
 	numIn := uintptr(method.Type().NumIn())
 	for i := uintptr(0); i < numIn; i++ {
-		// TODO Convert the arguments when possible (int32 => int, etc).
 		// TODO Type checking to avoid explosions (or catch the explosion)
 		paramdv := (*C.DataValue)(unsafe.Pointer(uintptr(unsafe.Pointer(args)) + (i+1)*dataValueSize))
-		params[i] = reflect.ValueOf(unpackDataValue(paramdv, fold.engine))
+		param, err := coerce(unpackDataValue(paramdv, fold.engine), method.Type().In(int(i)))
+		if err != nil {
+			packError(fmt.Errorf("cannot convert parameter %d of method: %v", i+1, err), args)
+			return
+		}
+		params[i] = param
+	}
+
+	if order, ok := isAsyncMethod(reflect.Indirect(v).Type(), v.Type().Method(int(reflectIndex)).Name); ok {
+		call := callAsync(fold.gvalue, order, method, append([]reflect.Value(nil), params[:numIn]...))
+		packDataValue(call, args, fold.engine, jsOwner)
+		return
 	}
 
 	result := method.Call(params[:numIn])
 
 	if len(result) == 1 {
-		packDataValue(result[0].Interface(), args, fold.engine, jsOwner)
+		packResult(result[0].Interface(), args, fold.engine)
 	} else if len(result) > 1 {
 		if len(result) > len(dataValueArray) {
 			panic("function has too many results")
 		}
 		for i, v := range result {
-			packDataValue(v.Interface(), &dataValueArray[i], fold.engine, jsOwner)
+			packResult(v.Interface(), &dataValueArray[i], fold.engine)
+			if dataValueArray[i].dataType == C.DTError {
+				*args = dataValueArray[i]
+				return
+			}
 		}
 		args.dataType = C.DTList
 		*(*unsafe.Pointer)(unsafe.Pointer(&args.data)) = C.newVariantList(&dataValueArray[0], C.int(len(result)))
@@ -377,6 +1045,9 @@ func hookGoValueCallMethod(enginep, foldp unsafe.Pointer, reflectIndex C.int, ar
 func ensureEngine(enginep, foldp unsafe.Pointer) *valueFold {
 	fold := (*valueFold)(foldp)
 	if fold.engine != nil {
+		if fold.engine.isDestroyed() && isStrict() {
+			strictPanic("Go value accessed after its engine was destroyed", nil)
+		}
 		return fold
 	}
 
@@ -398,10 +1069,9 @@ func ensureEngine(enginep, foldp unsafe.Pointer) *valueFold {
 	} else {
 		engine.values[fold.gvalue] = fold
 	}
-	before := len(typeNew)
-	delete(typeNew, fold)
-	if len(typeNew) == before {
+	if !removeTypeNew(fold) {
 		panic("value had no engine, but was not created by a registered type; who created the value?")
 	}
+	activateValue(engine, fold.gvalue)
 	return fold
 }
@@ -0,0 +1,127 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Census holds the number of objects alive under an engine at some point
+// in time, as returned by Engine.ObjectCensus.
+type Census struct {
+	// Total is the number of objects found.
+	Total int
+
+	// Entries holds the number of objects of each class, and for objects
+	// created by QML code, of each URL they were created from, sorted by
+	// class name and URL.
+	Entries []CensusEntry
+}
+
+// CensusEntry holds the number of objects of a single class created from
+// the same URL, if any, as part of a Census.
+type CensusEntry struct {
+	Class string
+	URL   string
+	Count int
+}
+
+// Delta holds the change in the number of objects of a single class
+// created from the same URL, as reported by Census.Diff.
+type Delta struct {
+	Class         string
+	URL           string
+	Before, After int
+}
+
+// ObjectCensus returns the number of objects alive under the engine per
+// class, and per URL of the QML document that created them, so that
+// objects leaked by some part of the interface may be found by comparing
+// a census taken before it is used to one taken afterwards:
+//
+//     before := engine.ObjectCensus()
+//     openAndCloseSettings()
+//     for _, delta := range before.Diff(engine.ObjectCensus()) {
+//         fmt.Printf("%s (%s): %d -> %d\n", delta.Class, delta.URL, delta.Before, delta.After)
+//     }
+//
+// Qt offers no way to enumerate all objects of an engine, so the census
+// is approximate. It includes the objects reachable from the root objects
+// of all component instances and windows of the engine, and from the
+// objects owned by the engine itself, such as components, but not Go
+// values or objects created by C++ code without a parent. The census is
+// taken in a single trip to the GUI thread, so it's cheap enough to be
+// taken between the steps of a test.
+func (e *Engine) ObjectCensus() Census {
+	e.assertValid()
+	var report string
+	gui(func() {
+		creport := C.engineObjectCensus(e.addr)
+		report = C.GoString(creport)
+		C.free(unsafe.Pointer(creport))
+	})
+	var census Census
+	for _, line := range strings.Split(report, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		count, _ := strconv.Atoi(fields[0])
+		census.Total += count
+		census.Entries = append(census.Entries, CensusEntry{Class: fields[1], URL: fields[2], Count: count})
+	}
+	sort.Sort(censusEntries(census.Entries))
+	return census
+}
+
+// Diff returns the classes and URLs with more objects alive in the after
+// census than in c, sorted by decreasing growth, and then by class name
+// and URL.
+func (c Census) Diff(after Census) []Delta {
+	before := make(map[[2]string]int)
+	for _, entry := range c.Entries {
+		before[[2]string{entry.Class, entry.URL}] = entry.Count
+	}
+	var deltas []Delta
+	for _, entry := range after.Entries {
+		n := before[[2]string{entry.Class, entry.URL}]
+		if entry.Count > n {
+			deltas = append(deltas, Delta{entry.Class, entry.URL, n, entry.Count})
+		}
+	}
+	sort.Sort(deltaGrowth(deltas))
+	return deltas
+}
+
+type censusEntries []CensusEntry
+
+func (s censusEntries) Len() int      { return len(s) }
+func (s censusEntries) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s censusEntries) Less(i, j int) bool {
+	if s[i].Class != s[j].Class {
+		return s[i].Class < s[j].Class
+	}
+	return s[i].URL < s[j].URL
+}
+
+type deltaGrowth []Delta
+
+func (s deltaGrowth) Len() int      { return len(s) }
+func (s deltaGrowth) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s deltaGrowth) Less(i, j int) bool {
+	gi, gj := s[i].After-s[i].Before, s[j].After-s[j].Before
+	if gi != gj {
+		return gi > gj
+	}
+	if s[i].Class != s[j].Class {
+		return s[i].Class < s[j].Class
+	}
+	return s[i].URL < s[j].URL
+}
@@ -0,0 +1,149 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"image"
+	"unsafe"
+)
+
+// SystemClipboard provides access to the system clipboard, or to the
+// selection that holds the text last selected by the user in systems
+// that support it, such as X11. See the Clipboard and Selection
+// functions.
+//
+// SystemClipboard methods may be called from any goroutine.
+type SystemClipboard struct {
+	mode C.int
+
+	changed      func()
+	changedQueue callbackQueue
+}
+
+// The modes match the respective QClipboard::Mode values.
+var (
+	clipboard = &SystemClipboard{mode: 0}
+	selection = &SystemClipboard{mode: 1}
+)
+
+// clipboardWatched is whether the clipboard changes are being reported
+// to hookClipboardChanged.
+//
+// Only accessed from the main GUI thread.
+var clipboardWatched bool
+
+// Clipboard returns the system clipboard, which holds the data the user
+// copies and pastes.
+func Clipboard() *SystemClipboard {
+	return clipboard
+}
+
+// Selection returns the clipboard holding the text last selected by the
+// user, which is pasted with the middle mouse button on X11. Selection
+// is only available in some systems, as reported by its Supported method.
+func Selection() *SystemClipboard {
+	return selection
+}
+
+// Supported returns whether the clipboard is available in the system.
+// The clipboard returned by Clipboard is always available.
+func (cb *SystemClipboard) Supported() bool {
+	var supported bool
+	gui(func() {
+		supported = C.clipboardSupported(cb.mode) != 0
+	})
+	return supported
+}
+
+// Text returns the text held by the clipboard, or an empty string if
+// it holds no text.
+func (cb *SystemClipboard) Text() string {
+	var text string
+	gui(func() {
+		var clen C.int
+		ba := C.clipboardText(cb.mode, &clen)
+		text = C.GoStringN(C.byteArrayData(ba), clen)
+		C.delByteArray(ba)
+	})
+	return text
+}
+
+// SetText replaces the content of the clipboard with text.
+func (cb *SystemClipboard) SetText(text string) {
+	ctext, ctextlen := unsafeStringData(text)
+	gui(func() {
+		C.clipboardSetText(cb.mode, ctext, ctextlen)
+	})
+}
+
+// Image returns a copy of the image held by the clipboard, or nil if it
+// holds no image.
+func (cb *SystemClipboard) Image() image.Image {
+	var img image.Image
+	gui(func() {
+		var bits *C.uchar
+		var width, height, stride C.int
+		qimage := C.clipboardImage(cb.mode, &bits, &width, &height, &stride)
+		defer C.delImage(qimage)
+		if width > 0 && height > 0 {
+			img = copyImage(unsafe.Pointer(bits), int(width), int(height), int(stride))
+		}
+	})
+	return img
+}
+
+// SetImage replaces the content of the clipboard with a copy of img.
+// Images of types *image.RGBA and *image.NRGBA are converted more
+// efficiently than other types.
+func (cb *SystemClipboard) SetImage(img image.Image) {
+	bounds := img.Bounds()
+	premultiplied := C.int(1)
+	if _, ok := img.(*image.NRGBA); ok {
+		premultiplied = 0
+	}
+	gui(func() {
+		var bits *C.uchar
+		var stride C.int
+		qimage := C.newImage(C.int(bounds.Dx()), C.int(bounds.Dy()), premultiplied, &bits, &stride)
+		defer C.delImage(qimage)
+		fillImage(img, unsafe.Pointer(bits), int(stride))
+		C.clipboardSetImage(cb.mode, qimage)
+	})
+}
+
+// Clear removes the content of the clipboard.
+func (cb *SystemClipboard) Clear() {
+	gui(func() {
+		C.clipboardClear(cb.mode)
+	})
+}
+
+// OnChanged registers f to be called whenever the content of the
+// clipboard changes, whether changed by this application or by others,
+// replacing any function previously registered. If f is nil, changes
+// are not reported anymore. The function is called in a goroutine owned
+// by the package. See the Callbacks section of the package documentation.
+func (cb *SystemClipboard) OnChanged(f func()) {
+	gui(func() {
+		cb.changed = f
+		if !clipboardWatched {
+			clipboardWatched = true
+			C.clipboardWatch()
+		}
+	})
+}
+
+//export hookClipboardChanged
+func hookClipboardChanged(mode C.int) {
+	if !onGuiThread("hookClipboardChanged") {
+		gui(func() { hookClipboardChanged(mode) })
+		return
+	}
+	for _, cb := range []*SystemClipboard{clipboard, selection} {
+		if cb.mode == mode && cb.changed != nil {
+			cb.changedQueue.dispatch(cb.changed)
+		}
+	}
+}
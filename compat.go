@@ -0,0 +1,102 @@
+package qml
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CompatFlags select the new behavior of the qml package in areas where
+// the legacy behavior is scheduled to change, so that applications may
+// migrate one area at a time. Unless the respective flag is set via
+// SetCompat, the legacy behavior is preserved.
+type CompatFlags int
+
+const (
+	// Numbers64 causes integer and floating point values obtained from
+	// QML to be always returned as int64 and float64, rather than as
+	// int32 and float32 depending on how QML holds them internally.
+	Numbers64 CompatFlags = 1 << iota
+
+	// StrictCoercions causes the Int and Int64 methods of Object to panic
+	// when the property holds a floating point value with a fractional
+	// part, rather than truncating it.
+	StrictCoercions
+
+	// CollectableSetValues causes Go values provided to Object.Set to be
+	// released once QML code no longer references them, rather than being
+	// held by the engine until it is destroyed.
+	CollectableSetValues
+
+	// ReportLegacy causes the qml package to log a warning whenever the
+	// application observes a legacy behavior that differs from the new
+	// one, once per call site, with the location of the call into the
+	// qml package that observed it.
+	ReportLegacy
+)
+
+var compatNames = []string{"Numbers64", "StrictCoercions", "CollectableSetValues", "ReportLegacy"}
+
+func (flags CompatFlags) String() string {
+	var names []string
+	for i, name := range compatNames {
+		if flags&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, "|")
+}
+
+var compatFlags int32
+
+// SetCompat sets the flags that select the new behavior of the qml
+// package in areas where it is scheduled to change. See CompatFlags.
+func SetCompat(flags CompatFlags) {
+	atomic.StoreInt32(&compatFlags, int32(flags))
+}
+
+// compat returns whether flag is set via SetCompat.
+func compat(flag CompatFlags) bool {
+	return CompatFlags(atomic.LoadInt32(&compatFlags))&flag != 0
+}
+
+var (
+	legacyMutex    sync.Mutex
+	legacyReported = make(map[uintptr]bool)
+)
+
+const pkgPrefix = "github.com/niemeyer/qml."
+
+// reportLegacy logs a warning saying that the legacy behavior described
+// by what was observed, and that it changes when flag is set, if the
+// ReportLegacy flag is set. The warning is logged once per call site,
+// and only if the qml package was called by application code.
+func reportLegacy(flag CompatFlags, what string) {
+	if !compat(ReportLegacy) {
+		return
+	}
+	for i := 2; ; i++ {
+		pc, file, line, ok := runtime.Caller(i)
+		if !ok {
+			return
+		}
+		f := runtime.FuncForPC(pc)
+		if f == nil || strings.HasPrefix(f.Name(), pkgPrefix) || strings.HasPrefix(f.Name(), "runtime.") || strings.HasPrefix(f.Name(), "reflect.") {
+			continue
+		}
+		legacyMutex.Lock()
+		reported := legacyReported[pc]
+		legacyReported[pc] = true
+		legacyMutex.Unlock()
+		if !reported {
+			text := fmt.Sprintf("qml: %s; this changes with the %s compatibility flag", what, flag)
+			logHandler.QmlOutput(&goLogMessage{LogWarning, text, file, line})
+		}
+		return
+	}
+}
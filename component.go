@@ -0,0 +1,158 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const componentsPath = "goqml-components"
+
+// registeredComponents holds the QML documents registered as types so
+// far, keyed by location, version, and name.
+//
+// Only accessed from the main GUI thread.
+var registeredComponents = make(map[string]string)
+
+// RegisterComponent registers the QML document at qmlPath as a type named
+// name in the module at location, with the major and minor version, so
+// that documents importing the module may use it as any other type, even
+// when loaded from strings or from resources where relative directory
+// imports cannot find it:
+//
+//     err := qml.RegisterComponent("MyApp.Components", 1, 0, "Gauge", "qml/Gauge.qml")
+//
+//     import MyApp.Components 1.0
+//     Gauge { value: 42 }
+//
+// The qmlPath may be a path on disk, relative to the current directory,
+// a "file:" URL, or a "qrc:" location of resources loaded via
+// LoadResources. Relative references within the document, such as to
+// images and other documents, are resolved relative to its location.
+// See RegisterComponentData for documents not stored in files.
+//
+// RegisterComponent returns an error if the document does not exist, if
+// a type with the same name is already registered in the same location
+// and version, if the module was already imported by a loaded component,
+// or if Qt refuses the registration. As with RegisterType, components
+// may be registered before the package is initialized, in which case
+// the errors only detected by Qt are reported once it is.
+func RegisterComponent(location string, major, minor int, name string, qmlPath string) error {
+	if err := validateComponent(location, major, minor, name); err != nil {
+		return err
+	}
+	var docURL string
+	switch {
+	case strings.HasPrefix(qmlPath, "qrc:"):
+		// Resources are only checked once the package is initialized.
+		docURL = qmlPath
+	default:
+		path := qmlPath
+		if strings.HasPrefix(qmlPath, "file:") {
+			u, err := url.Parse(qmlPath)
+			if err != nil {
+				return fmt.Errorf("cannot register component %q: %v", name, err)
+			}
+			path = u.Path
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("cannot register component %q: %v", name, err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return fmt.Errorf("cannot register component %q: %v", name, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("cannot register component %q: %s is a directory", name, qmlPath)
+		}
+		docURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+	}
+	return whenInitialized(func() error {
+		if strings.HasPrefix(qmlPath, "qrc:") {
+			if _, err := readResource(qmlPath); err != nil {
+				return fmt.Errorf("cannot register component %q: %v", name, err)
+			}
+		}
+		return registerComponent(location, major, minor, name, docURL)
+	})
+}
+
+// RegisterComponentData works as RegisterComponent, but registers the QML
+// document in data, such as one embedded in the program. The document is
+// made available as a resource, so its relative references are resolved
+// relative to a "qrc:" location private to the component, and documents
+// and images it uses must be referenced via their full locations or via
+// imports.
+func RegisterComponentData(location string, major, minor int, name string, data []byte) error {
+	if err := validateComponent(location, major, minor, name); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("cannot register component %q: empty document", name)
+	}
+	path := fmt.Sprintf("%s/%s/%d.%d/%s.qml", componentsPath, strings.Replace(location, ".", "/", -1), major, minor, name)
+	var rp ResourcesPacker
+	rp.Add(path, data)
+	resources := rp.Pack()
+	return whenInitialized(func() error {
+		LoadResources(resources)
+		return registerComponent(location, major, minor, name, "qrc:///"+path)
+	})
+}
+
+// validateComponent returns an error if a component cannot be registered
+// under the provided name and location.
+func validateComponent(location string, major, minor int, name string) error {
+	if name == "" {
+		return fmt.Errorf("cannot register component with an empty name")
+	}
+	if !isUpperName(name) {
+		return fmt.Errorf("cannot register component %q: name must start with an uppercase letter and hold only letters, digits, and underscores", name)
+	}
+	if !locationPattern.MatchString(location) {
+		return fmt.Errorf("cannot register component %q: invalid location %q", name, location)
+	}
+	if major < 0 || minor < 0 {
+		return fmt.Errorf("cannot register component %q: invalid version %d.%d", name, major, minor)
+	}
+	return nil
+}
+
+// registerComponent registers the document at the url location as a type.
+func registerComponent(location string, major, minor int, name string, docURL string) error {
+	var err error
+	gui(func() {
+		key := fmt.Sprintf("%s %d.%d %s", location, major, minor, name)
+		if registeredComponents[key] != "" {
+			err = fmt.Errorf("type %q is already registered in %s %d.%d", name, location, major, minor)
+			return
+		}
+		for _, other := range types {
+			if other.Location == location && other.Major == major && other.Minor == minor && other.Name == name {
+				err = fmt.Errorf("type %q is already registered in %s %d.%d", name, location, major, minor)
+				return
+			}
+		}
+		if importedModules[location] {
+			err = fmt.Errorf("cannot register component %q: module %s was already imported by a loaded component", name, location)
+			return
+		}
+		curl, curllen := unsafeStringData(docURL)
+		// Qt holds on to the location and name.
+		cloc := C.CString(location)
+		cname := C.CString(name)
+		if C.registerComponent(curl, curllen, cloc, C.int(major), C.int(minor), cname) != C.RegisterOK {
+			err = fmt.Errorf("cannot register component %q: rejected by Qt (see the logged messages)", name)
+			return
+		}
+		registeredComponents[key] = docURL
+	})
+	return err
+}
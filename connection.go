@@ -0,0 +1,542 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"github.com/niemeyer/qml/tref"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Connection represents a connection between a signal of a QML object
+// and a Go function, established via Object.Connect or Object.OnChange.
+type Connection struct {
+	addr   unsafe.Pointer
+	engine *Engine
+	f      reflect.Value
+	inline bool
+	queue  callbackQueue
+
+	// The signal connected to, for reporting profiling results.
+	signal string
+
+	// The object and signal index connected to, the priority set via
+	// the Priority option, and the order in which the connection is
+	// delivered the signal relative to others, as documented in order.
+	sender      unsafe.Pointer
+	signalIndex int
+	priority    int
+	seq         uint64
+
+	// The location Connect0 and related functions were called from, to
+	// report parameters that cannot be converted when the signal is
+	// emitted. Empty for connections made via Connect.
+	file string
+	line int
+
+	// The object and property observed by connections made via
+	// Object.OnChange, and the number of notify signal parameters,
+	// which are ignored in favor of the current property value.
+	obj      *Object
+	property string
+	params   int
+
+	disconnected bool
+}
+
+// connections holds the connections alive until they are disconnected
+// or the connected object is destroyed, since their C++ counterparts
+// only hold unsafe references to them.
+var connections = make(map[*Connection]bool)
+
+// Connect arranges for f to be called whenever the named signal of obj
+// is emitted, until the returned connection is disconnected or obj is
+// destroyed. The function f must take as many parameters as the signal
+// does, and the values emitted are converted to the parameter types of
+// f as done for the parameters of methods called by QML code:
+//
+//     obj.Connect("clicked", func() { ... })
+//     obj.Connect("textChanged", func(text string) { ... })
+//
+// By default, or with the Queued option, the function is called in a
+// goroutine owned by the package, so it may take as long as necessary
+// without blocking the GUI event loop. Calls for the same connection
+// happen one at a time, in the order the signal was emitted. See the
+// Callbacks section of the package documentation. With the Direct option
+// the function is called in the main GUI thread while the signal is
+// being emitted instead, and with the Priority option the function is
+// delivered the signal before the functions connected with a lower
+// priority:
+//
+//     obj.Connect("accepted", validate, qml.Direct, qml.Priority(10))
+//
+// Connect panics if obj has no signal with the given name, if f is not
+// a function with no results that can take the signal parameters, or if
+// the options conflict with each other.
+func (obj *Object) Connect(signal string, f interface{}, options ...ConnectOption) *Connection {
+	conn, err := obj.connectErr(signal, f, connectConfig(signal, options))
+	if err != nil {
+		panic(err.Error())
+	}
+	return conn
+}
+
+// ConnectInline works as Connect with the Direct option.
+func (obj *Object) ConnectInline(signal string, f interface{}) *Connection {
+	return obj.Connect(signal, f, Direct)
+}
+
+// ConnectOption changes how a function connected via Object.Connect is
+// delivered the signal. See Queued, Direct, and Priority.
+type ConnectOption struct {
+	kind     connectOptionKind
+	priority int
+}
+
+type connectOptionKind int
+
+const (
+	queuedOption connectOptionKind = iota + 1
+	directOption
+	priorityOption
+)
+
+var (
+	// Queued has the connected function called in a goroutine owned by
+	// the package after the signal is emitted, so that it may block
+	// without blocking the GUI event loop. That's the default.
+	Queued = ConnectOption{kind: queuedOption}
+
+	// Direct has the connected function called in the main GUI thread
+	// while the signal is being emitted, so that it may act on the
+	// emitting object before the emission returns, such as to veto or
+	// amend a change. The function must not block, and the blocking
+	// functions of the package, such as Window.Wait, panic when called
+	// from it rather than deadlocking.
+	Direct = ConnectOption{kind: directOption}
+)
+
+// Priority orders the delivery of a signal to the functions connected
+// to it via Object.Connect, so that functions connected with a higher
+// priority are delivered the signal first. Functions with the same
+// priority are delivered the signal in the order they were connected,
+// and the priority defaults to zero. Direct functions are called in
+// that order, while queued functions are only queued in that order,
+// as each runs in its own goroutine. Qt offers no means of ordering
+// these functions relative to signal handlers in QML code.
+func Priority(priority int) ConnectOption {
+	return ConnectOption{kind: priorityOption, priority: priority}
+}
+
+// connectOptions holds the options of a connection made via Connect.
+type connectOptions struct {
+	direct   bool
+	priority int
+}
+
+// connectConfig returns the options of a connection to signal made with
+// the provided options, and panics if they conflict.
+func connectConfig(signal string, options []ConnectOption) connectOptions {
+	var config connectOptions
+	var delivery, priority bool
+	for _, option := range options {
+		switch option.kind {
+		case queuedOption, directOption:
+			if delivery && config.direct != (option.kind == directOption) {
+				panic(fmt.Sprintf("cannot connect signal %s: both Queued and Direct options provided", signal))
+			}
+			delivery = true
+			config.direct = option.kind == directOption
+		case priorityOption:
+			if priority && config.priority != option.priority {
+				panic(fmt.Sprintf("cannot connect signal %s: conflicting Priority options provided", signal))
+			}
+			priority = true
+			config.priority = option.priority
+		default:
+			panic(fmt.Sprintf("cannot connect signal %s: invalid option", signal))
+		}
+	}
+	return config
+}
+
+// Connect0 arranges for f to be called whenever the named signal of obj
+// is emitted, as done by Object.Connect, but returns an error rather than
+// panicking if the signal has parameters. See Connect1.
+func Connect0(obj *Object, signal string, f func()) (*Connection, error) {
+	return obj.connectTyped(signal, f)
+}
+
+// Connect1 arranges for f to be called with the parameter of the named
+// signal of obj whenever it is emitted, as done by Object.Connect:
+//
+//     conn, err := qml.Connect1(obj, "textChanged", func(text string) {
+//         ...
+//     })
+//
+// Connect1 returns an error describing both the signal and the function
+// signatures if the signal does not have exactly one parameter, or if the
+// parameter type cannot be converted to T. Parameters of types that may
+// hold any value, such as var parameters, are converted when the signal
+// is emitted instead, and values that cannot be converted are reported
+// via the logger set with SetLogger, without calling f.
+func Connect1[T any](obj *Object, signal string, f func(T)) (*Connection, error) {
+	return obj.connectTyped(signal, f)
+}
+
+// Connect2 works as Connect1, for signals with two parameters.
+func Connect2[T1, T2 any](obj *Object, signal string, f func(T1, T2)) (*Connection, error) {
+	return obj.connectTyped(signal, f)
+}
+
+// Connect3 works as Connect1, for signals with three parameters.
+func Connect3[T1, T2, T3 any](obj *Object, signal string, f func(T1, T2, T3)) (*Connection, error) {
+	return obj.connectTyped(signal, f)
+}
+
+// connectTyped connects f to the signal for Connect0 and related functions,
+// recording the location of their caller.
+func (obj *Object) connectTyped(signal string, f interface{}) (*Connection, error) {
+	_, file, line, _ := runtime.Caller(2)
+	conn, err := obj.connectErr(signal, f, connectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	conn.file, conn.line = file, line
+	return conn, nil
+}
+
+func (obj *Object) connectErr(signal string, f interface{}, options connectOptions) (*Connection, error) {
+	obj.assertLive()
+	fv := reflect.ValueOf(f)
+	if fv.Kind() != reflect.Func || fv.Type().NumOut() > 0 || fv.Type().IsVariadic() {
+		return nil, fmt.Errorf("cannot connect signal %s to %T: not a function with no results", signal, f)
+	}
+	conn := &Connection{engine: obj.engine, f: fv, inline: options.direct, signal: signal, priority: options.priority}
+	csignal, csignallen := unsafeStringData(signal)
+	var err error
+	gui(func() {
+		var signalIndex C.int
+		csig := C.objectSignalSignature(obj.addr, csignal, csignallen, &signalIndex)
+		if csig == nilCharPtr {
+			err = fmt.Errorf("object has no signal %q", signal)
+			return
+		}
+		sig := C.GoString(csig)
+		C.free(unsafe.Pointer(csig))
+		if err = checkSignalFunc(sig, fv.Type()); err != nil {
+			return
+		}
+		connections[conn] = true
+		conn.sender, conn.signalIndex = obj.addr, int(signalIndex)
+		conn.addr = C.objectConnect(obj.addr, signalIndex, unsafe.Pointer(conn))
+		conn.order()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// directSignal holds the name of the signal whose Direct function is
+// running, if any.
+//
+// Only accessed from the main GUI thread.
+var directSignal string
+
+// assertMayBlock panics if called from the main GUI thread, where waiting
+// as described by what would deadlock, mentioning the Direct function
+// that is running, if any, as its likely culprit.
+func assertMayBlock(what string) {
+	if tref.Ref() != guiLoopRef {
+		return
+	}
+	if directSignal != "" {
+		panic(fmt.Sprintf("cannot %s from within the main GUI thread: called from a Direct function connected to signal %s", what, directSignal))
+	}
+	panic(fmt.Sprintf("cannot %s from within the main GUI thread", what))
+}
+
+// connectionSeq is incremented whenever a connection is made or remade,
+// so that the order in which Qt delivers signals to connections is known.
+//
+// Only accessed from the main GUI thread.
+var connectionSeq uint64
+
+// order reconnects the connections to the same signal as conn that have
+// a lower priority, in the order they are currently delivered the signal,
+// so that Qt delivers it to them after conn.
+//
+// This must be run from the main GUI thread.
+func (conn *Connection) order() {
+	connectionSeq++
+	conn.seq = connectionSeq
+	var lower []*Connection
+	for other := range connections {
+		if other.sender == conn.sender && other.signalIndex == conn.signalIndex && other.priority < conn.priority {
+			lower = append(lower, other)
+		}
+	}
+	sort.Sort(connectionsBySeq(lower))
+	for _, other := range lower {
+		C.signalConnectorReconnect(other.addr)
+		connectionSeq++
+		other.seq = connectionSeq
+	}
+}
+
+type connectionsBySeq []*Connection
+
+func (s connectionsBySeq) Len() int           { return len(s) }
+func (s connectionsBySeq) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s connectionsBySeq) Less(i, j int) bool { return s[i].seq < s[j].seq }
+
+// OnChange arranges for f to be called with the new value of the named
+// property of obj whenever it changes, until the returned connection is
+// disconnected or obj is destroyed. The property is observed via its
+// notify signal, so that Go code may react to changes made by the user
+// or by QML code, such as to the value of a slider:
+//
+//     conn, err := slider.OnChange("value", func(value interface{}) {
+//         fmt.Println("value changed to", value)
+//     })
+//
+// The value is read when the notify signal is emitted, and f is called
+// with it in a goroutine owned by the package, as done for Connect. An
+// error is returned if obj has no such property, or if the property has
+// no notify signal and so its changes cannot be observed.
+func (obj *Object) OnChange(property string, f func(value interface{})) (*Connection, error) {
+	obj.assertLive()
+	if f == nil {
+		return nil, fmt.Errorf("cannot observe property %q: nil function", property)
+	}
+	conn := &Connection{engine: obj.engine, f: reflect.ValueOf(f), obj: obj, property: property}
+	cname, cnamelen := unsafeStringData(property)
+	var err error
+	gui(func() {
+		var cparams C.int
+		signalIndex := C.objectPropertyNotifySignal(obj.addr, cname, cnamelen, &cparams)
+		switch signalIndex {
+		case -1:
+			err = fmt.Errorf("cannot observe property %q: object does not have such property", property)
+			return
+		case -2:
+			err = fmt.Errorf("cannot observe property %q: property has no notify signal", property)
+			return
+		}
+		conn.params = int(cparams)
+		connections[conn] = true
+		conn.addr = C.objectConnect(obj.addr, signalIndex, unsafe.Pointer(conn))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Emit emits the named signal of obj with the provided arguments, so that
+// handlers in QML code and functions connected via Connect are called.
+// Emit panics if obj has no signal with the given name, or if the
+// arguments cannot be converted to the signal parameters.
+func (obj *Object) Emit(signal string, args ...interface{}) {
+	obj.assertLive()
+	if len(args) > len(dataValueArray) {
+		panic("too many parameters")
+	}
+	csignal, csignallen := unsafeStringData(signal)
+	cmethod := C.CString(signal)
+	defer C.free(unsafe.Pointer(cmethod))
+	var err error
+	gui(func() {
+		var signalIndex C.int
+		csig := C.objectSignalSignature(obj.addr, csignal, csignallen, &signalIndex)
+		if csig == nilCharPtr {
+			err = fmt.Errorf("object has no signal %q", signal)
+			return
+		}
+		sig := C.GoString(csig)
+		C.free(unsafe.Pointer(csig))
+		if n := len(signalParams(sig)); n != len(args) {
+			err = fmt.Errorf("cannot emit signal %s with %d arguments", sig, len(args))
+			return
+		}
+		for i, arg := range args {
+			packDataValue(arg, &dataValueArray[i], obj.engine, jsOwner)
+		}
+		var result C.DataValue
+		var candidates *C.char
+		if C.objectInvoke(obj.addr, cmethod, &result, &dataValueArray[0], C.int(len(args)), &candidates) != C.InvokeOK {
+			err = fmt.Errorf("cannot emit signal %s with the provided arguments", sig)
+		}
+		if candidates != nilCharPtr {
+			C.free(unsafe.Pointer(candidates))
+		}
+	})
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// Disconnect disconnects the function from the signal, so that it is not
+// called for signals emitted afterwards. It is safe to call Disconnect
+// more than once, and after the connected object is destroyed.
+func (conn *Connection) Disconnect() {
+	gui(func() {
+		if !conn.disconnected {
+			conn.disconnected = true
+			delete(connections, conn)
+			C.delObjectLater(conn.addr)
+		}
+	})
+}
+
+// checkSignalFunc returns an error if a function of type ftype cannot
+// take the parameters of the signal with the Qt signature sig, such as
+// "textChanged(QString)".
+func checkSignalFunc(sig string, ftype reflect.Type) error {
+	params := signalParams(sig)
+	if ftype.NumIn() != len(params) {
+		return fmt.Errorf("cannot connect signal %s to %s: signal has %d parameters, function has %d", sig, ftype, len(params), ftype.NumIn())
+	}
+	for i, param := range params {
+		if !signalParamAssignable(param, ftype.In(i)) {
+			return fmt.Errorf("cannot connect signal %s to %s: parameter %d has type %s", sig, ftype, i+1, param)
+		}
+	}
+	return nil
+}
+
+// signalParams returns the parameter types in the Qt signature sig.
+func signalParams(sig string) []string {
+	if i := strings.Index(sig, "("); i >= 0 && i+1 < len(sig)-1 {
+		return strings.Split(sig[i+1:len(sig)-1], ",")
+	}
+	return nil
+}
+
+var typeObject = reflect.TypeOf(&Object{})
+
+// signalParamAssignable returns whether a signal parameter of the Qt type
+// qtype may be converted to typ. Parameters that may hold values of any
+// type, such as QVariant ones, are only converted when the signal is
+// emitted.
+func signalParamAssignable(qtype string, typ reflect.Type) bool {
+	if typ.Kind() == reflect.Interface && typ.NumMethod() == 0 {
+		return true
+	}
+	switch qtype {
+	case "QString":
+		return typ.Kind() == reflect.String || useMarshalers && (typ.Implements(typeTextUnmarshaler) || reflect.PtrTo(typ).Implements(typeTextUnmarshaler))
+	case "bool":
+		return typ.Kind() == reflect.Bool
+	case "int", "uint", "qlonglong", "qulonglong", "double", "float", "qreal":
+		return isNumber(typ.Kind())
+	}
+	if strings.HasSuffix(qtype, "*") {
+		return typ == typeObject
+	}
+	return true
+}
+
+// signalParam converts the value v emitted by a signal to typ.
+func signalParam(v interface{}, typ reflect.Type) reflect.Value {
+	rv, err := coerce(v, typ)
+	if err != nil {
+		panic(fmt.Sprintf("cannot convert signal parameter: %v", err))
+	}
+	return rv
+}
+
+//export hookSignalCall
+func hookSignalCall(connp unsafe.Pointer, args *C.DataValue) {
+	if !onGuiThread("hookSignalCall") {
+		gui(func() { hookSignalCall(connp, args) })
+		return
+	}
+	conn := (*Connection)(connp)
+	if conn.property != "" {
+		hookPropertyChange(conn, args)
+		return
+	}
+	ftype := conn.f.Type()
+	values := make([]interface{}, ftype.NumIn())
+	for i := range values {
+		argdv := (*C.DataValue)(unsafe.Pointer(uintptr(unsafe.Pointer(args)) + uintptr(i)*dataValueSize))
+		values[i] = unpackDataValue(argdv, conn.engine)
+	}
+	if conn.disconnected {
+		return
+	}
+	var profile *profiler
+	if conn.engine != nil {
+		profile = conn.engine.profile
+	}
+	call := func() {
+		params := make([]reflect.Value, len(values))
+		for i, v := range values {
+			if conn.file == "" {
+				params[i] = signalParam(v, ftype.In(i))
+				continue
+			}
+			rv, err := coerce(v, ftype.In(i))
+			if err != nil {
+				text := fmt.Sprintf("qml: cannot call %s: cannot convert signal parameter %d: %v", ftype, i+1, err)
+				logMutex.RLock()
+				handler := logHandler
+				logMutex.RUnlock()
+				handler.QmlOutput(&goLogMessage{LogWarning, text, conn.file, conn.line})
+				return
+			}
+			params[i] = rv
+		}
+		if profile != nil {
+			defer profile.measure("signal", conn.signal, time.Now())
+		}
+		conn.f.Call(params)
+	}
+	if conn.inline {
+		outer := directSignal
+		directSignal = conn.signal
+		defer func() { directSignal = outer }()
+		call()
+	} else {
+		conn.queue.dispatch(call)
+	}
+}
+
+// hookPropertyChange delivers the current value of the property observed
+// by conn, whose notify signal was emitted with args.
+func hookPropertyChange(conn *Connection, args *C.DataValue) {
+	for i := 0; i < conn.params; i++ {
+		// Releases the memory held by the parameters.
+		argdv := (*C.DataValue)(unsafe.Pointer(uintptr(unsafe.Pointer(args)) + uintptr(i)*dataValueSize))
+		unpackDataValue(argdv, conn.engine)
+	}
+	if conn.disconnected {
+		return
+	}
+	value, _ := conn.obj.property(conn.property)
+	conn.queue.dispatch(func() {
+		conn.f.Call([]reflect.Value{reflect.ValueOf(&value).Elem()})
+	})
+}
+
+//export hookSignalConnectionDestroyed
+func hookSignalConnectionDestroyed(connp unsafe.Pointer) {
+	if !onGuiThread("hookSignalConnectionDestroyed") {
+		gui(func() { hookSignalConnectionDestroyed(connp) })
+		return
+	}
+	conn := (*Connection)(connp)
+	conn.disconnected = true
+	delete(connections, conn)
+}
@@ -0,0 +1,94 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+var undefinedPattern = regexp.MustCompile(`ReferenceError: ([\w$]+) is not defined`)
+
+// RequiredContextVars returns the sorted names used by the component held
+// by obj that are not defined in the context the component is created
+// under by Create when no context is provided. These are usually context
+// variables that were never set via Context.SetVar, so applications may
+// assert that none are reported before showing their interface:
+//
+//     if names := component.RequiredContextVars(); len(names) > 0 {
+//         panic(fmt.Sprintf("context variables not set: %v", names))
+//     }
+//
+// The names are found by creating a trial instance of the component in a
+// throwaway context and collecting the reference errors reported meanwhile,
+// so only names used by code that runs while the component is created,
+// such as bindings and Component.onCompleted handlers, are found. The
+// trial instance is destroyed right away, and any errors it reports are
+// not logged. RequiredContextVars panics if called on an object that does
+// not represent a QML component.
+func (obj *Object) RequiredContextVars() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, use := range obj.undefinedUses() {
+		if !seen[use.name] {
+			seen[use.name] = true
+			names = append(names, use.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RequiredContextVarUses works as RequiredContextVars, but returns one
+// warning for each use of an undefined name, with the file and line where
+// it is used, in the order the uses were found.
+func (obj *Object) RequiredContextVarUses() []LogMessage {
+	uses := obj.undefinedUses()
+	msgs := make([]LogMessage, len(uses))
+	for i, use := range uses {
+		msgs[i] = use.msg
+	}
+	return msgs
+}
+
+// undefinedUse holds a use of an undefined name found by undefinedUses.
+type undefinedUse struct {
+	name string
+	msg  *goLogMessage
+}
+
+// undefinedUses returns the uses of undefined names reported while
+// creating a trial instance of the component held by obj.
+func (obj *Object) undefinedUses() []undefinedUse {
+	if C.objectIsComponent(obj.addr) == 0 {
+		panic("object is not a component")
+	}
+	var report string
+	gui(func() {
+		creport := C.componentTrialErrors(obj.addr)
+		report = C.GoString(creport)
+		C.free(unsafe.Pointer(creport))
+	})
+	var uses []undefinedUse
+	for _, line := range strings.Split(report, "\n") {
+		// Each line holds the line, column, file, and description.
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		m := undefinedPattern.FindStringSubmatch(fields[3])
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(fields[0])
+		uses = append(uses, undefinedUse{m[1], &goLogMessage{LogWarning, fields[3], fields[2], n}})
+	}
+	return uses
+}
@@ -1,23 +1,127 @@
+#include <QAbstractEventDispatcher>
 #include <QApplication>
+#include <QBuffer>
+#include <QClipboard>
+#include <QCloseEvent>
+#include <QElapsedTimer>
+#include <QFile>
+#include <QFileDialog>
+#include <QImageReader>
+#include <QImageWriter>
+#include <QJsonArray>
+#include <QJsonDocument>
+#include <QMenu>
+#include <QMimeData>
+#include <QMessageBox>
+#include <QOffscreenSurface>
+#include <QOpenGLContext>
+#include <QPainter>
 #include <QQuickView>
+#include <QResource>
+#include <QScreen>
+#include <QSessionManager>
+#include <QSettings>
+#include <QSystemTrayIcon>
+#include <QTranslator>
 #include <QtQml>
 #include <QDebug>
 
+#include <private/qqmlcontext_p.h>
+#include <private/qqmldata_p.h>
+#include <private/qqmlmetatype_p.h>
+#include <private/qqmlproperty_p.h>
+#include <private/qqmlvaluetype_p.h>
+
+#if QT_VERSION >= QT_VERSION_CHECK(5, 14, 0)
+#include <private/qv4engine_p.h>
+#include <private/qv4mm_p.h>
+#endif
+
 #include <string.h>
 
+#include "goaccessmanager.h"
+#include "goanimation.h"
+#include "godropfilter.h"
+#include "goeventfilter.h"
+#include "goframenotifier.h"
+#include "goimageprovider.h"
+#include "golazymodel.h"
+#include "golistmodel.h"
+#include "gorendertimer.h"
+#include "goscriptwatchdog.h"
+#include "gosignalconnector.h"
+#include "gotablemodel.h"
+#include "goupdateblocker.h"
+#include "gourlinterceptor.h"
+#include "govalidator.h"
 #include "govalue.h"
 #include "govaluetype.h"
+#include "gowindowwatcher.h"
 #include "capi.h"
 
-void newGuiApplication()
+// RenderBackend matches the RenderBackend values in the Go side.
+enum { DefaultRender, OpenGLRender, SoftwareRender };
+
+void applicationSetAttributes(int highDpiScaling, int renderBackend)
+{
+#if QT_VERSION >= QT_VERSION_CHECK(5, 6, 0)
+    if (highDpiScaling) {
+        QCoreApplication::setAttribute(Qt::AA_EnableHighDpiScaling);
+    }
+#else
+    Q_UNUSED(highDpiScaling);
+#endif
+#if QT_VERSION >= QT_VERSION_CHECK(5, 8, 0)
+    switch (renderBackend) {
+    case OpenGLRender:
+        QQuickWindow::setSceneGraphBackend(QSGRendererInterface::OpenGL);
+        break;
+    case SoftwareRender:
+        QQuickWindow::setSceneGraphBackend(QSGRendererInterface::Software);
+        break;
+    }
+#else
+    switch (renderBackend) {
+    case OpenGLRender:
+        qunsetenv("QMLSCENE_DEVICE");
+        break;
+    case SoftwareRender:
+        qputenv("QMLSCENE_DEVICE", "softwarecontext");
+        break;
+    }
+#endif
+}
+
+void newGuiApplication(int *argc, char **argv)
 {
-    static char empty[1] = {0};
-    static char *argv[] = {empty};
-    static int argc = 1;
-    new QGuiApplication(argc, argv);
+    // QApplication is needed for widgets such as QMenu. It holds on to
+    // argc and argv, and removes the arguments it handles from them.
+    new QApplication(*argc, argv);
 
     // The event should never die.
     qApp->setQuitOnLastWindowClosed(false);
+
+    // Give the application a last chance to save its state.
+    QObject::connect(qApp, &QGuiApplication::commitDataRequest, [=](QSessionManager &) {
+        hookSaveState();
+    });
+#if QT_VERSION >= QT_VERSION_CHECK(5, 2, 0)
+    QObject::connect(qApp, &QGuiApplication::applicationStateChanged, [=](Qt::ApplicationState state) {
+        if (state == Qt::ApplicationSuspended) {
+            hookSaveState();
+        }
+    });
+#endif
+}
+
+void applicationSetNames(const char *name, int nameLen, const char *org, int orgLen)
+{
+    if (nameLen > 0) {
+        qApp->setApplicationName(QString::fromUtf8(name, nameLen));
+    }
+    if (orgLen > 0) {
+        qApp->setOrganizationName(QString::fromUtf8(org, orgLen));
+    }
 }
 
 void applicationExec()
@@ -25,11 +129,68 @@ void applicationExec()
     qApp->exec();
 }
 
+void applicationExit()
+{
+    qApp->exit(0);
+}
+
 void applicationFlushAll()
 {
     qApp->processEvents();
 }
 
+void applicationFlushDeleted()
+{
+    QCoreApplication::sendPostedEvents(0, QEvent::DeferredDelete);
+}
+
+int applicationHasPendingEvents()
+{
+    return QAbstractEventDispatcher::instance()->hasPendingEvents() ? 1 : 0;
+}
+
+// InputWatcher records when the application last received user input.
+class InputWatcher : public QObject
+{
+public:
+    QElapsedTimer elapsed;
+
+    InputWatcher() { elapsed.start(); }
+
+protected:
+    bool eventFilter(QObject *, QEvent *event)
+    {
+        switch (event->type()) {
+        case QEvent::KeyPress:
+        case QEvent::KeyRelease:
+        case QEvent::MouseButtonPress:
+        case QEvent::MouseButtonRelease:
+        case QEvent::MouseButtonDblClick:
+        case QEvent::MouseMove:
+        case QEvent::Wheel:
+        case QEvent::TouchBegin:
+        case QEvent::TouchUpdate:
+        case QEvent::TouchEnd:
+            elapsed.restart();
+            break;
+        default:
+            break;
+        }
+        return false;
+    }
+};
+
+static InputWatcher *inputWatcher = 0;
+
+int applicationInputIdle()
+{
+    if (!inputWatcher) {
+        inputWatcher = new InputWatcher();
+        qApp->installEventFilter(inputWatcher);
+    }
+    return int(qMin(inputWatcher->elapsed.elapsed(), qint64(INT_MAX)));
+}
+
 void *currentThread()
 {
     return QThread::currentThread();
@@ -74,6 +235,220 @@ void engineSetOwnershipJS(QQmlEngine_ *engine, QObject_ *object)
     qengine->setObjectOwnership(qobject, QQmlEngine::JavaScriptOwnership);
 }
 
+void engineSetCollectInterval(QQmlEngine_ *engine, int msec)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QTimer *timer = qengine->findChild<QTimer *>("goCollectTimer", Qt::FindDirectChildrenOnly);
+    if (msec <= 0) {
+        delete timer;
+        return;
+    }
+    if (!timer) {
+        timer = new QTimer(qengine);
+        timer->setObjectName("goCollectTimer");
+        QObject::connect(timer, &QTimer::timeout, [=]() {
+            hookEngineCollectTick(qengine);
+        });
+    }
+    timer->start(msec);
+}
+
+void engineSetAccess(QQmlEngine_ *engine, int allowLocalFiles, int allowNetwork)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QSharedPointer<GoNetworkConfig> config(new GoNetworkConfig(engine, allowLocalFiles, allowNetwork));
+    GoNetworkAccessManagerFactory *factory = new GoNetworkAccessManagerFactory(config);
+    qengine->setNetworkAccessManagerFactory(factory);
+
+    // The engine does not take ownership of the factory.
+    QObject::connect(qengine, &QObject::destroyed, [=]() {
+        delete factory;
+    });
+}
+
+void engineDenyOpenUrlExternally(QQmlEngine_ *engine)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    // QDesktopServices handlers are process-wide and per scheme, so the
+    // function is replaced within this engine's Qt object instead.
+    QJSValue deny = qengine->evaluate(
+        "(function(url) {"
+        "    console.warn('qml: engine options deny opening ' + url + ' externally');"
+        "    return false;"
+        "})");
+    qengine->globalObject().property("Qt").setProperty("openUrlExternally", deny);
+}
+
+static GoNetworkConfig *engineNetworkConfig(QQmlEngine_ *engine)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    return static_cast<GoNetworkAccessManagerFactory *>(qengine->networkAccessManagerFactory())->config.data();
+}
+
+void engineSetNetworkProxy(QQmlEngine_ *engine, int kind, const char *host, int hostLen, int port)
+{
+    GoNetworkConfig *config = engineNetworkConfig(engine);
+    QMutexLocker locker(&config->mutex);
+    config->proxy = QNetworkProxy(QNetworkProxy::ProxyType(kind), QString::fromUtf8(host, hostLen), port);
+}
+
+void engineSetUserAgent(QQmlEngine_ *engine, const char *userAgent, int userAgentLen)
+{
+    GoNetworkConfig *config = engineNetworkConfig(engine);
+    QMutexLocker locker(&config->mutex);
+    config->userAgent = QByteArray(userAgent, userAgentLen);
+}
+
+void engineSetNetworkTransport(QQmlEngine_ *engine, int enabled)
+{
+    GoNetworkConfig *config = engineNetworkConfig(engine);
+    QMutexLocker locker(&config->mutex);
+    config->transport = enabled;
+}
+
+void engineClearComponentCache(QQmlEngine_ *engine)
+{
+    reinterpret_cast<QQmlEngine *>(engine)->clearComponentCache();
+}
+
+void engineTrimComponentCache(QQmlEngine_ *engine, int deferred)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    if (deferred) {
+        // Run once control returns to the event loop, rather than while
+        // components may be instantiating further up the stack.
+        QTimer::singleShot(0, qengine, [=]() { qengine->trimComponentCache(); });
+        return;
+    }
+    qengine->trimComponentCache();
+}
+
+void engineCollectGarbage(QQmlEngine_ *engine, int deferred)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    if (deferred) {
+        QTimer::singleShot(0, qengine, [=]() { qengine->collectGarbage(); });
+        return;
+    }
+    qengine->collectGarbage();
+}
+
+int engineMemoryStats(QQmlEngine_ *engine, long long *used, long long *allocated, long long *largeItems)
+{
+#if QT_VERSION >= QT_VERSION_CHECK(5, 14, 0)
+    QV4::MemoryManager *mm = reinterpret_cast<QQmlEngine *>(engine)->handle()->memoryManager;
+    *used = mm->getUsedMem();
+    *allocated = mm->getAllocatedMem();
+    *largeItems = mm->getLargeItemsMem();
+    return 1;
+#else
+    Q_UNUSED(engine);
+    Q_UNUSED(used);
+    Q_UNUSED(allocated);
+    Q_UNUSED(largeItems);
+    return 0;
+#endif
+}
+
+void engineWatchWarnings(QQmlEngine_ *engine)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QObject::connect(qengine, &QQmlEngine::warnings, [=](const QList<QQmlError> &warnings) {
+        foreach (const QQmlError &warning, warnings) {
+            QByteArray url = warning.url().toString().toUtf8();
+            QByteArray desc = warning.description().toUtf8();
+            hookEngineWarning(engine, url.constData(), url.size(), warning.line(), warning.column(), desc.constData(), desc.size());
+        }
+    });
+}
+
+void engineAddImportPath(QQmlEngine_ *engine, const char *path, int pathLen)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    qengine->addImportPath(QString::fromUtf8(path, pathLen));
+}
+
+void engineCopySettings(QQmlEngine_ *engine, QQmlEngine_ *parent)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QQmlEngine *qparent = reinterpret_cast<QQmlEngine *>(parent);
+    qengine->setImportPathList(qparent->importPathList());
+    qengine->setPluginPathList(qparent->pluginPathList());
+    qengine->setBaseUrl(qparent->baseUrl());
+#if QT_VERSION >= QT_VERSION_CHECK(5, 4, 0)
+    // Interceptors are owned by whoever installed them, so the
+    // child engine refers to the same one.
+    qengine->setUrlInterceptor(qparent->urlInterceptor());
+#endif
+}
+
+void engineInstallUrlInterceptor(QQmlEngine_ *engine)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    GoUrlInterceptor *interceptor = new GoUrlInterceptor(engine);
+    qengine->setUrlInterceptor(interceptor);
+    // Not owned by the engine. Child engines created meanwhile refer to
+    // it as well, but they are always deleted before their parents.
+    QObject::connect(qengine, &QObject::destroyed, [=]() {
+        delete interceptor;
+    });
+}
+
+void engineAddImageProvider(QQmlEngine_ *engine, QString_ *providerId, GoAddr *provider)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QString *qproviderId = reinterpret_cast<QString *>(providerId);
+
+    // The engine takes ownership of the provider, and deletes the
+    // replaced one, if any.
+    qengine->removeImageProvider(*qproviderId);
+    qengine->addImageProvider(*qproviderId, new GoImageProvider(provider));
+}
+
+void engineRemoveImageProvider(QQmlEngine_ *engine, QString_ *providerId)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QString *qproviderId = reinterpret_cast<QString *>(providerId);
+    qengine->removeImageProvider(*qproviderId);
+}
+
+QImage_ *newImage(int width, int height, int premultiplied, unsigned char **bits, int *bytesPerLine)
+{
+    QImage::Format format = premultiplied ? QImage::Format_ARGB32_Premultiplied : QImage::Format_ARGB32;
+    QImage *image = new QImage(width, height, format);
+    *bits = image->bits();
+    *bytesPerLine = image->bytesPerLine();
+    return image;
+}
+
+void delImage(QImage_ *image)
+{
+    delete reinterpret_cast<QImage *>(image);
+}
+
+void registerResourceData(void *data)
+{
+    QResource::registerResource(reinterpret_cast<uchar *>(data));
+}
+
+void unregisterResourceData(void *data)
+{
+    QResource::unregisterResource(reinterpret_cast<uchar *>(data));
+}
+
+void *readResource(const char *path, int pathLen, int *dataLen)
+{
+    QFile file(QString::fromUtf8(path, pathLen));
+    if (!file.open(QIODevice::ReadOnly)) {
+        return 0;
+    }
+    QByteArray data = file.readAll();
+    void *result = malloc(data.size() > 0 ? data.size() : 1);
+    memcpy(result, data.constData(), data.size());
+    *dataLen = data.size();
+    return result;
+}
+
 QQmlComponent_ *newComponent(QQmlEngine_ *engine, QObject_ *parent)
 {
     QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
@@ -89,6 +464,28 @@ void componentSetData(QQmlComponent_ *component, const char *data, int dataLen,
     reinterpret_cast<QQmlComponent *>(component)->setData(qdata, qsurl);
 }
 
+void componentLoadAsync(QQmlComponent_ *component, GoAddr *load, const char *data, int dataLen, const char *url, int urlLen)
+{
+    QQmlComponent *qcomponent = reinterpret_cast<QQmlComponent *>(component);
+    QObject::connect(qcomponent, &QQmlComponent::statusChanged, [=](QQmlComponent::Status status) {
+        if (status == QQmlComponent::Ready || status == QQmlComponent::Error) {
+            hookComponentLoaded(load);
+        }
+    });
+    QUrl qurl(QString::fromUtf8(url, urlLen));
+    if (data) {
+        qcomponent->setData(QByteArray(data, dataLen), qurl);
+    } else {
+        qcomponent->loadUrl(qurl, QQmlComponent::Asynchronous);
+    }
+}
+
+int componentIsLoading(QQmlComponent_ *component)
+{
+    QQmlComponent *qcomponent = reinterpret_cast<QQmlComponent *>(component);
+    return qcomponent->status() == QQmlComponent::Loading;
+}
+
 static char *local_strdup(const char *str)
 {
     char *strcopy = 0;
@@ -100,6 +497,26 @@ static char *local_strdup(const char *str)
     return strcopy;
 }
 
+// packByteArray packs ba into value with the given type, which must be
+// held as DTString. The data is shared with ba rather than copied, and
+// Go releases it via delByteArray once it's copied into Go memory.
+static void packByteArray(DataType dataType, const QByteArray &ba, DataValue *value)
+{
+    value->dataType = dataType;
+    *(QByteArray_ **)(value->data) = new QByteArray(ba);
+    value->len = ba.size();
+}
+
+const char *byteArrayData(QByteArray_ *ba)
+{
+    return reinterpret_cast<QByteArray *>(ba)->constData();
+}
+
+void delByteArray(QByteArray_ *ba)
+{
+    delete reinterpret_cast<QByteArray *>(ba);
+}
+
 char *componentErrorString(QQmlComponent_ *component)
 {
     QQmlComponent *qcomponent = reinterpret_cast<QQmlComponent *>(component);
@@ -113,6 +530,49 @@ char *componentErrorString(QQmlComponent_ *component)
     return local_strdup("component is not ready (why!?)");
 }
 
+char *probeOpenGL()
+{
+    QOffscreenSurface surface;
+    surface.create();
+    if (!surface.isValid()) {
+        return local_strdup("cannot create offscreen surface for OpenGL probing");
+    }
+    QOpenGLContext context;
+    if (!context.create()) {
+        return local_strdup("cannot create OpenGL context");
+    }
+    if (!context.makeCurrent(&surface)) {
+        return local_strdup("cannot make OpenGL context current");
+    }
+    context.doneCurrent();
+    return NULL;
+}
+
+// engineObjects holds the component instances and windows created under
+// each engine, so that they may be deleted before the engine itself.
+static QHash<QQmlEngine *, QList<QPointer<QObject> > > engineObjects;
+
+static void engineTrackObject(QQmlEngine *engine, QObject *object)
+{
+    QList<QPointer<QObject> > &objects = engineObjects[engine];
+    // Forget objects deleted meanwhile so the list doesn't grow unbounded.
+    objects.removeAll(QPointer<QObject>());
+    objects.append(object);
+}
+
+void delEngineLater(QQmlEngine_ *engine)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QList<QPointer<QObject> > objects = engineObjects.take(qengine);
+    for (int i = objects.size() - 1; i >= 0; i--) {
+        if (objects[i]) {
+            objects[i]->deleteLater();
+        }
+    }
+    // Deferred deletions run in the order they are requested.
+    qengine->deleteLater();
+}
+
 QObject_ *componentCreate(QQmlComponent_ *component, QQmlContext_ *context)
 {
     QQmlComponent *qcomponent = reinterpret_cast<QQmlComponent *>(component);
@@ -121,7 +581,228 @@ QObject_ *componentCreate(QQmlComponent_ *component, QQmlContext_ *context)
     if (!qcontext) {
         qcontext = qmlContext(qcomponent);
     }
-    return qcomponent->create(qcontext);
+    QObject *instance = qcomponent->create(qcontext);
+    if (instance) {
+        engineTrackObject(qmlEngine(qcomponent), instance);
+    }
+    return instance;
+}
+
+// IncubationController incubates objects in slices from the event loop,
+// as done by windows for the engines they render, so that engines without
+// windows create component instances asynchronously as well.
+class IncubationController : public QObject, public QQmlIncubationController
+{
+protected:
+    void incubatingObjectCountChanged(int count)
+    {
+        if (count > 0 && timerId == 0) {
+            timerId = startTimer(0);
+        } else if (count == 0 && timerId != 0) {
+            killTimer(timerId);
+            timerId = 0;
+        }
+    }
+
+    void timerEvent(QTimerEvent *)
+    {
+        incubateFor(5);
+    }
+
+private:
+    int timerId = 0;
+};
+
+// Incubator creates a component instance with initial properties, and
+// reports to Go once it's done.
+class Incubator : public QQmlIncubator
+{
+public:
+    GoAddr *incubation;
+    QVariantMap properties;
+
+    Incubator(GoAddr *incubation, IncubationMode mode)
+        : QQmlIncubator(mode), incubation(incubation) {}
+
+protected:
+    void setInitialState(QObject *object)
+    {
+#if QT_VERSION < QT_VERSION_CHECK(5, 15, 0)
+        // Newer versions take them via setInitialProperties, which
+        // also tracks required properties.
+        for (QVariantMap::const_iterator it = properties.constBegin(); it != properties.constEnd(); ++it) {
+            QQmlProperty::write(object, it.key(), it.value());
+        }
+#else
+        Q_UNUSED(object);
+#endif
+    }
+
+    void statusChanged(Status status)
+    {
+        if (incubation && (status == Ready || status == Error)) {
+            hookIncubationDone(incubation);
+        }
+    }
+};
+
+QQmlIncubator_ *componentIncubate(QQmlComponent_ *component, QQmlContext_ *context, DataValue *props, GoAddr *incubation, int async)
+{
+    QQmlComponent *qcomponent = reinterpret_cast<QQmlComponent *>(component);
+    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
+    QQmlEngine *qengine = qmlEngine(qcomponent);
+
+    if (!qcontext) {
+        qcontext = qmlContext(qcomponent);
+    }
+    if (async && !qengine->incubationController()) {
+        IncubationController *controller = new IncubationController();
+        controller->setParent(qengine);
+        qengine->setIncubationController(controller);
+    }
+    Incubator *incubator = new Incubator(incubation, async ? QQmlIncubator::Asynchronous : QQmlIncubator::Synchronous);
+    QVariant var;
+    unpackDataValue(props, &var);
+    incubator->properties = var.toMap();
+#if QT_VERSION >= QT_VERSION_CHECK(5, 15, 0)
+    incubator->setInitialProperties(incubator->properties);
+#endif
+    qcomponent->create(*incubator, qcontext);
+    return incubator;
+}
+
+int incubatorIsLoading(QQmlIncubator_ *incubator)
+{
+    return reinterpret_cast<Incubator *>(incubator)->isLoading();
+}
+
+QObject_ *incubatorObject(QQmlIncubator_ *incubator)
+{
+    Incubator *qincubator = reinterpret_cast<Incubator *>(incubator);
+    QObject *object = qincubator->object();
+    if (object) {
+        engineTrackObject(qmlEngine(object), object);
+    }
+    return object;
+}
+
+char *incubatorErrors(QQmlIncubator_ *incubator)
+{
+    QList<QQmlError> errors = reinterpret_cast<Incubator *>(incubator)->errors();
+    if (errors.isEmpty()) {
+        return NULL;
+    }
+    QByteArray result;
+    for (int i = 0; i < errors.size(); i++) {
+        if (i > 0) {
+            result.append('\n');
+        }
+        result.append(errors.at(i).toString().toUtf8());
+    }
+    return local_strdup(result.constData());
+}
+
+void delIncubatorLater(QQmlIncubator_ *incubator, int abort)
+{
+    Incubator *qincubator = reinterpret_cast<Incubator *>(incubator);
+    qincubator->incubation = 0;
+    if (abort) {
+        // Destroys the objects created so far.
+        qincubator->clear();
+    }
+    // It may be reporting its status right now.
+    QTimer::singleShot(0, qApp, [=]() {
+        delete qincubator;
+    });
+}
+
+// formatErrors returns errors formatted as one line per error, holding
+// its line, column, URL, and description separated by tabs.
+static char *formatErrors(const QList<QQmlError> &errors)
+{
+    QByteArray result;
+    for (int i = 0; i < errors.size(); i++) {
+        const QQmlError &error = errors.at(i);
+        result.append(QByteArray::number(error.line()));
+        result.append('\t');
+        result.append(QByteArray::number(error.column()));
+        result.append('\t');
+        result.append(error.url().toString().toUtf8());
+        result.append('\t');
+        result.append(error.description().toUtf8());
+        result.append('\n');
+    }
+    return local_strdup(result.constData());
+}
+
+char *componentErrors(QQmlComponent_ *component)
+{
+    return formatErrors(reinterpret_cast<QQmlComponent *>(component)->errors());
+}
+
+char *componentTrialErrors(QQmlComponent_ *component)
+{
+    QQmlComponent *qcomponent = reinterpret_cast<QQmlComponent *>(component);
+    QQmlEngine *qengine = qmlEngine(qcomponent);
+
+    QList<QQmlError> errors;
+    QMetaObject::Connection conn = QObject::connect(qengine, &QQmlEngine::warnings, [&](const QList<QQmlError> &warnings) {
+        errors.append(warnings);
+    });
+    bool output = qengine->outputWarningsToStandardError();
+    qengine->setOutputWarningsToStandardError(false);
+
+    QQmlContext *qcontext = new QQmlContext(qmlContext(qcomponent));
+    QObject *instance = qcomponent->create(qcontext);
+    delete instance;
+    delete qcontext;
+
+    qengine->setOutputWarningsToStandardError(output);
+    QObject::disconnect(conn);
+
+    return formatErrors(errors);
+}
+
+char *loaderSetSource(QObject_ *loader, const char *url, int urlLen, DataValue *props)
+{
+    QObject *qloader = reinterpret_cast<QObject *>(loader);
+    QQmlContext *parent = qmlContext(qloader);
+    if (!parent) {
+        parent = qmlEngine(qloader)->rootContext();
+    }
+
+    // Loader.setSource takes the initial properties as a JavaScript object,
+    // and is only callable from JavaScript, so it's called via an expression
+    // evaluated in a context holding the arguments. The loader may refer to
+    // the context until the item is created, so the context is kept as a
+    // child of the loader until the next call.
+    QList<QQmlContext *> previous = qloader->findChildren<QQmlContext *>("goLoaderContext", Qt::FindDirectChildrenOnly);
+    QQmlContext *qcontext = new QQmlContext(parent, qloader);
+    qcontext->setObjectName("goLoaderContext");
+    QVariant qprops;
+    unpackDataValue(props, &qprops);
+    qcontext->setContextProperty("__goSource", QString::fromUtf8(url, urlLen));
+    qcontext->setContextProperty("__goProperties", qprops);
+
+    QQmlExpression expr(qcontext, qloader, "setSource(__goSource, __goProperties)");
+    expr.evaluate();
+    char *result = NULL;
+    if (expr.hasError()) {
+        QByteArray ba = expr.error().description().toUtf8();
+        result = local_strdup(ba.constData());
+    }
+    qDeleteAll(previous);
+    return result;
+}
+
+char *loaderErrors(QObject_ *loader)
+{
+    QObject *qloader = reinterpret_cast<QObject *>(loader);
+    QQmlComponent *qcomponent = qloader->property("sourceComponent").value<QQmlComponent *>();
+    if (!qcomponent) {
+        return local_strdup("");
+    }
+    return formatErrors(qcomponent->errors());
 }
 
 QQuickView_ *componentCreateView(QQmlComponent_ *component, QQmlContext_ *context)
@@ -133,229 +814,2647 @@ QQuickView_ *componentCreateView(QQmlComponent_ *component, QQmlContext_ *contex
         qcontext = qmlContext(qcomponent);
     }
     QObject *instance = qcomponent->create(qcontext);
+    if (!instance) {
+        return NULL;
+    }
     QQuickView *view = new QQuickView(qmlEngine(qcomponent), 0);
     view->setContent(qcomponent->url(), qcomponent, instance);
     view->setResizeMode(QQuickView::SizeRootObjectToView);
+    new GoFrameNotifier(view);
+    engineTrackObject(qmlEngine(qcomponent), view);
     return view;
 }
 
-void viewShow(QQuickView_ *view)
+// windowRoot returns the root object of window. Windows created via
+// componentCreateView render the root object of the view, while those
+// created by QML's Window element are the root object themselves.
+static QObject *windowRoot(QQuickWindow *window)
+{
+    QQuickView *view = qobject_cast<QQuickView *>(window);
+    if (view) {
+        return view->rootObject();
+    }
+    if (qmlEngine(window)) {
+        return window;
+    }
+    return window->contentItem();
+}
+
+int viewSetRoot(QQuickView_ *view, QQmlComponent_ *component, QQmlContext_ *context)
+{
+    QQuickView *qview = qobject_cast<QQuickView *>(reinterpret_cast<QQuickWindow *>(view));
+    QQmlComponent *qcomponent = reinterpret_cast<QQmlComponent *>(component);
+    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
+
+    if (!qview) {
+        return -1;
+    }
+
+    if (!qcontext) {
+        qcontext = qmlContext(qcomponent);
+    }
+    QObject *instance = qcomponent->create(qcontext);
+    if (!instance) {
+        return 0;
+    }
+    QQuickItem *old = qview->rootObject();
+    qview->setContent(qcomponent->url(), qcomponent, instance);
+    if (old && old != instance) {
+        // Stop rendering it right away, but leave the deletion for later
+        // as it may be running code that triggered the reload.
+        old->setParentItem(0);
+        old->deleteLater();
+    }
+    return 1;
+}
+
+void viewShow(QQuickView_ *view)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    // QWindow::show resets the window state, so keep the one set
+    // via viewSetState before the window was shown.
+    if (qview->windowState() == Qt::WindowNoState) {
+        qview->show();
+    } else {
+        qview->setVisible(true);
+    }
+}
+
+void viewHide(QQuickView_ *view)
+{
+    reinterpret_cast<QQuickView *>(view)->hide();
+}
+
+int viewClose(QQuickView_ *view)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    // QWindow::close doesn't deliver a close event in the supported
+    // Qt versions, so deliver one as the window system would.
+    QCloseEvent event;
+    QCoreApplication::sendEvent(qview, &event);
+    if (!event.isAccepted()) {
+        return 0;
+    }
+    qview->hide();
+    return 1;
+}
+
+static GoFrameNotifier *viewFrameNotifier(QQuickView_ *view)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    QObject *notifier = qview->findChild<QObject *>("goFrameNotifier", Qt::FindDirectChildrenOnly);
+    return static_cast<GoFrameNotifier *>(notifier);
+}
+
+int viewFirstFramePresented(QQuickView_ *view)
+{
+    return viewFrameNotifier(view)->presented();
+}
+
+void viewShowWhenReady(QQuickView_ *view)
+{
+    viewFrameNotifier(view)->showWhenReady();
+}
+
+int viewSetRenderSize(QQuickView_ *view, int width, int height, double scale)
+{
+    QQuickView *qview = qobject_cast<QQuickView *>(reinterpret_cast<QQuickWindow *>(view));
+    QQuickItem *root = qview ? qview->rootObject() : 0;
+    if (!root) {
+        return 0;
+    }
+    if (width > 0) {
+        root->setWidth(width);
+    }
+    if (height > 0) {
+        root->setHeight(height);
+    }
+    // The view is sized after the root object, and then resized to fit
+    // the scaled content, which it keeps since the root size is fixed.
+    qview->setResizeMode(QQuickView::SizeViewToRootObject);
+    QQuickItem *content = qview->contentItem();
+    content->setTransformOrigin(QQuickItem::TopLeft);
+    content->setScale(scale);
+    qview->resize(qCeil(root->width() * scale), qCeil(root->height() * scale));
+    return 1;
+}
+
+// statusLoading and statusError are the Loading and Error values of
+// the status property of Image and FontLoader.
+enum { statusLoading = 2, statusError = 3 };
+
+static void objectResourceStatus(QObject *object, int *loading, int *failed)
+{
+    if (object->inherits("QQuickImageBase") || object->inherits("QQuickFontLoader")) {
+        int status = object->property("status").toInt();
+        if (status == statusLoading) {
+            (*loading)++;
+        } else if (status == statusError) {
+            (*failed)++;
+        }
+    }
+    foreach (QObject *child, object->children()) {
+        objectResourceStatus(child, loading, failed);
+    }
+    QQuickItem *item = qobject_cast<QQuickItem *>(object);
+    if (item) {
+        foreach (QQuickItem *child, item->childItems()) {
+            if (child->parent() != object) {
+                objectResourceStatus(child, loading, failed);
+            }
+        }
+    }
+}
+
+void viewResourceStatus(QQuickView_ *view, int *loading, int *failed)
+{
+    QObject *root = windowRoot(reinterpret_cast<QQuickWindow *>(view));
+    *loading = 0;
+    *failed = 0;
+    if (root) {
+        objectResourceStatus(root, loading, failed);
+    }
+}
+
+QImage_ *viewGrabWindow(QQuickView_ *view, unsigned char **bits, int *width, int *height, int *bytesPerLine)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    QImage *image = new QImage(qview->grabWindow().convertToFormat(QImage::Format_ARGB32));
+    *bits = image->bits();
+    *width = image->width();
+    *height = image->height();
+    *bytesPerLine = image->bytesPerLine();
+    return image;
+}
+
+int viewGrabWindowEncoded(QQuickView_ *view, const char *format, int quality, char **data, int *dataLen)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    QImage image = qview->grabWindow();
+    *data = 0;
+    *dataLen = 0;
+    if (image.isNull() || image.width() == 0 || image.height() == 0) {
+        return EncodeEmpty;
+    }
+    QByteArray ba;
+    QBuffer buffer(&ba);
+    buffer.open(QIODevice::WriteOnly);
+    if (!image.save(&buffer, format, quality)) {
+        return EncodeFailed;
+    }
+    *data = (char *)malloc(ba.size());
+    memcpy(*data, ba.constData(), ba.size());
+    *dataLen = ba.size();
+    return EncodeOK;
+}
+
+QImage_ *newImageFromData(const char *data, int dataLen, const char *format)
+{
+    QImage *image = new QImage();
+    if (!image->loadFromData(reinterpret_cast<const uchar *>(data), dataLen, *format ? format : 0)) {
+        delete image;
+        return 0;
+    }
+    return image;
+}
+
+static char *imageFormats(const QList<QByteArray> &formats)
+{
+    QByteArray ba;
+    for (int i = 0; i < formats.size(); i++) {
+        if (i > 0) {
+            ba.append(' ');
+        }
+        ba.append(formats[i].toLower());
+    }
+    return local_strdup(ba.constData());
+}
+
+char *imageReadFormats()
+{
+    return imageFormats(QImageReader::supportedImageFormats());
+}
+
+char *imageWriteFormats()
+{
+    return imageFormats(QImageWriter::supportedImageFormats());
+}
+
+int itemMoveToView(QObject_ *item, QQuickView_ *view, double x, double y)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    if (!qitem) {
+        return MoveNotItem;
+    }
+    if (qmlEngine(qitem) && qmlEngine(qitem) != qview->engine()) {
+        return MoveOtherEngine;
+    }
+
+    // Focus and grabs are held by the old window, and would otherwise
+    // keep pointing to an item that it doesn't contain anymore.
+    QQuickWindow *old = qitem->window();
+    if (old && old != qview) {
+        QQuickItem *grabber = old->mouseGrabberItem();
+        for (QQuickItem *p = grabber; p; p = p->parentItem()) {
+            if (p == qitem) {
+                grabber->ungrabMouse();
+                break;
+            }
+        }
+        QQuickItem *focus = old->activeFocusItem();
+        for (QQuickItem *p = focus; p; p = p->parentItem()) {
+            if (p == qitem) {
+                focus->setFocus(false);
+                break;
+            }
+        }
+    }
+
+    // The QObject parent is changed as well so that the item isn't
+    // destroyed together with the window it was moved away from.
+    QQuickItem *content = qview->contentItem();
+    qitem->setParentItem(content);
+    qitem->setParent(content);
+    qitem->setX(x);
+    qitem->setY(y);
+    return MoveOK;
+}
+
+// viewFocusItem returns the item with active focus in the view, or null
+// if no item has it or the window itself is not active.
+static QQuickItem *viewFocusItem(QQuickView *qview)
+{
+    QQuickItem *item = qview->activeFocusItem();
+    if (!qview->isActive() || item == qview->contentItem()) {
+        return 0;
+    }
+    return item;
+}
+
+QObject_ *viewActiveFocusItem(QQuickView_ *view)
+{
+    return viewFocusItem(reinterpret_cast<QQuickView *>(view));
+}
+
+void viewConnectFocusChanged(QQuickView_ *view)
+{
+#if QT_VERSION >= 0x050100
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    QSharedPointer< QPointer<QQuickItem> > last(new QPointer<QQuickItem>(viewFocusItem(qview)));
+    auto report = [=]() {
+        QQuickItem *item = viewFocusItem(qview);
+        if (item == last->data()) {
+            return;
+        }
+        QQuickItem *old = last->data();
+        *last = item;
+        hookWindowFocusChanged(view, old, item);
+    };
+    QObject::connect(qview, &QQuickWindow::activeFocusItemChanged, report);
+    QObject::connect(qview, &QWindow::activeChanged, report);
+#endif
+    QObject::connect(reinterpret_cast<QObject *>(view), &QObject::destroyed, [=]() {
+        hookWindowFocusDisconnected(view);
+    });
+}
+
+static int countItems(QQuickItem *item)
+{
+    int count = 0;
+    foreach (QQuickItem *child, item->childItems()) {
+        count += 1 + countItems(child);
+    }
+    return count;
+}
+
+int viewSceneStats(QQuickView_ *view, int *items, int *nodes, long long *textureBytes)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    *items = countItems(qview->contentItem());
+
+    // The scene graph renderer does not report its node count or
+    // texture memory usage.
+    *nodes = -1;
+    *textureBytes = -1;
+    return 0;
+}
+
+int itemHasFocus(QObject_ *item)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    return qitem && qitem->hasActiveFocus();
+}
+
+int itemForceFocus(QObject_ *item, int reason)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (!qitem) {
+        return FocusNotItem;
+    }
+    if (!qitem->isEnabled()) {
+        return FocusDisabled;
+    }
+    if (!qitem->isVisible()) {
+        return FocusInvisible;
+    }
+#if QT_VERSION >= 0x050100
+    qitem->forceActiveFocus(Qt::FocusReason(reason));
+#else
+    qitem->forceActiveFocus();
+#endif
+    return FocusOK;
+}
+
+void itemSetActiveFocusOnTab(QObject_ *item)
+{
+#if QT_VERSION >= 0x050100
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (qitem) {
+        qitem->setActiveFocusOnTab(true);
+    }
+#endif
+}
+
+void itemAcceptMouse(QObject_ *item, int mouse, int hover)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (qitem) {
+        if (mouse) {
+            qitem->setAcceptedMouseButtons(Qt::AllButtons);
+        }
+        qitem->setAcceptHoverEvents(hover != 0);
+    }
+}
+
+int itemGrabMouse(QObject_ *item, int grab)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (!qitem) {
+        return ClickNotItem;
+    }
+    if (!grab) {
+        qitem->setKeepMouseGrab(false);
+        if (qitem->window() && qitem->window()->mouseGrabberItem() == qitem) {
+            qitem->ungrabMouse();
+        }
+        return ClickOK;
+    }
+    if (!qitem->window()) {
+        return ClickNoWindow;
+    }
+    if (!qitem->isVisible()) {
+        return ClickInvisible;
+    }
+    // Keeping the grab prevents parents that filter the events of their
+    // children, such as Flickable, from stealing it to start a gesture.
+    qitem->setKeepMouseGrab(true);
+    if (qitem->window()->mouseGrabberItem() != qitem) {
+        qitem->grabMouse();
+    }
+    return ClickOK;
+}
+
+static void postMouseEvent(QWindow *window, QEvent::Type type, const QPointF &pos, Qt::MouseButton button, Qt::MouseButtons buttons, Qt::KeyboardModifiers modifiers)
+{
+    QPointF screenPos = window->mapToGlobal(pos.toPoint());
+    QCoreApplication::postEvent(window, new QMouseEvent(type, pos, pos, screenPos, button, buttons, modifiers));
+}
+
+int itemClick(QObject_ *item)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (!qitem) {
+        return ClickNotItem;
+    }
+    QQuickWindow *window = qitem->window();
+    if (!window) {
+        return ClickNoWindow;
+    }
+    if (!qitem->isVisible()) {
+        return ClickInvisible;
+    }
+    QPointF pos = qitem->mapToScene(QPointF(qitem->width() / 2, qitem->height() / 2));
+    postMouseEvent(window, QEvent::MouseButtonPress, pos, Qt::LeftButton, Qt::LeftButton, Qt::NoModifier);
+    postMouseEvent(window, QEvent::MouseButtonRelease, pos, Qt::LeftButton, Qt::NoButton, Qt::NoModifier);
+    return ClickOK;
+}
+
+int itemMapToScene(QObject_ *item, double x, double y, double *sceneX, double *sceneY)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (!qitem) {
+        return 0;
+    }
+    QPointF pos = qitem->mapToScene(QPointF(x, y));
+    *sceneX = pos.x();
+    *sceneY = pos.y();
+    return 1;
+}
+
+int itemMapFromScene(QObject_ *item, double sceneX, double sceneY, double *x, double *y)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (!qitem) {
+        return 0;
+    }
+    QPointF pos = qitem->mapFromScene(QPointF(sceneX, sceneY));
+    *x = pos.x();
+    *y = pos.y();
+    return 1;
+}
+
+int itemGeometry(QObject_ *item, double *x, double *y, double *width, double *height)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (!qitem) {
+        return 0;
+    }
+    *x = qitem->x();
+    *y = qitem->y();
+    *width = qitem->width();
+    *height = qitem->height();
+    return 1;
+}
+
+int itemSetGeometry(QObject_ *item, double x, double y, double width, double height)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    if (!qitem) {
+        return 0;
+    }
+    qitem->setPosition(QPointF(x, y));
+    qitem->setSize(QSizeF(width, height));
+    return 1;
+}
+
+int itemSetParentItem(QObject_ *item, QObject_ *parent)
+{
+    QQuickItem *qitem = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(item));
+    QQuickItem *qparent = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(parent));
+    if (!qitem || (parent && !qparent)) {
+        return 0;
+    }
+    // The parent object owns the item, as it would if the item was
+    // declared within it in a QML document.
+    qitem->setParentItem(qparent);
+    qitem->setParent(qparent);
+    return 1;
+}
+
+void viewWatch(QQuickView_ *view)
+{
+    new GoWindowWatcher(reinterpret_cast<QQuickView *>(view));
+}
+
+int viewIsVisible(QQuickView_ *view)
+{
+    return reinterpret_cast<QQuickView *>(view)->isVisible();
+}
+
+QObject_ *viewRootObject(QQuickView_ *view)
+{
+    return windowRoot(reinterpret_cast<QQuickWindow *>(view));
+}
+
+void viewSetMask(QQuickView_ *view, int *rects, int rectsLen)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    QRegion region;
+    for (int i = 0; i < rectsLen; i++) {
+        int *r = &rects[i*4];
+        region += QRect(r[0], r[1], r[2], r[3]);
+    }
+    qview->setMask(region);
+}
+
+void viewSetTransparentForInput(QQuickView_ *view, int transparent)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    Qt::WindowFlags flags = qview->flags();
+    if (transparent) {
+        flags |= Qt::WindowTransparentForInput;
+    } else {
+        flags &= ~Qt::WindowTransparentForInput;
+    }
+    if (flags != qview->flags()) {
+        qview->setFlags(flags);
+    }
+}
+
+int viewTransparentForInput(QQuickView_ *view)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    return (qview->flags() & Qt::WindowTransparentForInput) != 0;
+}
+
+void viewSetTitle(QQuickView_ *view, const char *title, int titleLen)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    qview->setTitle(QString::fromUtf8(title, titleLen));
+}
+
+char *viewTitle(QQuickView_ *view)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    return local_strdup(qview->title().toUtf8().constData());
+}
+
+void viewSetPosition(QQuickView_ *view, int x, int y)
+{
+    reinterpret_cast<QQuickView *>(view)->setPosition(x, y);
+}
+
+void viewPosition(QQuickView_ *view, int *x, int *y)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    *x = qview->x();
+    *y = qview->y();
+}
+
+void viewSetSize(QQuickView_ *view, int width, int height)
+{
+    reinterpret_cast<QQuickView *>(view)->resize(width, height);
+}
+
+void viewSize(QQuickView_ *view, int *width, int *height)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    *width = qview->width();
+    *height = qview->height();
+}
+
+void viewSetMinimumSize(QQuickView_ *view, int width, int height)
+{
+    reinterpret_cast<QQuickView *>(view)->setMinimumSize(QSize(width, height));
+}
+
+void viewMinimumSize(QQuickView_ *view, int *width, int *height)
+{
+    QSize size = reinterpret_cast<QQuickView *>(view)->minimumSize();
+    *width = size.width();
+    *height = size.height();
+}
+
+void viewSetMaximumSize(QQuickView_ *view, int width, int height)
+{
+    reinterpret_cast<QQuickView *>(view)->setMaximumSize(QSize(width, height));
+}
+
+void viewMaximumSize(QQuickView_ *view, int *width, int *height)
+{
+    QSize size = reinterpret_cast<QQuickView *>(view)->maximumSize();
+    *width = size.width();
+    *height = size.height();
+}
+
+void viewSetState(QQuickView_ *view, int state)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    switch (state) {
+    case WindowMinimized:
+        qview->setWindowState(Qt::WindowMinimized);
+        break;
+    case WindowMaximized:
+        qview->setWindowState(Qt::WindowMaximized);
+        break;
+    case WindowFullScreen:
+        qview->setWindowState(Qt::WindowFullScreen);
+        break;
+    default:
+        qview->setWindowState(Qt::WindowNoState);
+        break;
+    }
+}
+
+int viewState(QQuickView_ *view)
+{
+    switch (reinterpret_cast<QQuickView *>(view)->windowState()) {
+    case Qt::WindowMinimized:
+        return WindowMinimized;
+    case Qt::WindowMaximized:
+        return WindowMaximized;
+    case Qt::WindowFullScreen:
+        return WindowFullScreen;
+    default:
+        return WindowNormal;
+    }
+}
+
+void viewSetFlags(QQuickView_ *view, int flags)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    // Leave alone flags not managed here, such as the one set
+    // by viewSetTransparentForInput.
+    Qt::WindowFlags qflags = qview->flags();
+    qflags &= ~(Qt::FramelessWindowHint | Qt::WindowStaysOnTopHint | Qt::WindowStaysOnBottomHint);
+    if (flags & WindowFrameless) {
+        qflags |= Qt::FramelessWindowHint;
+    }
+    if (flags & WindowStaysOnTop) {
+        qflags |= Qt::WindowStaysOnTopHint;
+    }
+    if (flags & WindowStaysOnBottom) {
+        qflags |= Qt::WindowStaysOnBottomHint;
+    }
+    if (qflags != qview->flags()) {
+        qview->setFlags(qflags);
+    }
+}
+
+int viewFlags(QQuickView_ *view)
+{
+    Qt::WindowFlags qflags = reinterpret_cast<QQuickView *>(view)->flags();
+    int flags = 0;
+    if (qflags & Qt::FramelessWindowHint) {
+        flags |= WindowFrameless;
+    }
+    if (qflags & Qt::WindowStaysOnTopHint) {
+        flags |= WindowStaysOnTop;
+    }
+    if (qflags & Qt::WindowStaysOnBottomHint) {
+        flags |= WindowStaysOnBottom;
+    }
+    return flags;
+}
+
+QQmlContext_ *newContext(QQmlContext_ *parentContext)
+{
+    QQmlContext *qparent = reinterpret_cast<QQmlContext *>(parentContext);
+
+    // The parent context also owns the new context, so that destroying
+    // either the parent or the engine takes the new context with it.
+    return new QQmlContext(qparent, qparent);
+}
+
+QObject_ *viewInstallEventFilter(QQuickView_ *view)
+{
+    return new GoEventFilter(reinterpret_cast<QQuickView *>(view));
+}
+
+QObject_ *viewInstallDropFilter(QQuickView_ *view)
+{
+    return new GoDropFilter(reinterpret_cast<QQuickView *>(view));
+}
+
+QObject_ *viewInstallUpdateBlocker(QQuickView_ *view)
+{
+    return new GoUpdateBlocker(reinterpret_cast<QQuickWindow *>(view));
+}
+
+void updateBlockerSuspend(QObject_ *blocker)
+{
+    reinterpret_cast<GoUpdateBlocker *>(blocker)->suspend();
+}
+
+void updateBlockerResume(QObject_ *blocker, int render)
+{
+    reinterpret_cast<GoUpdateBlocker *>(blocker)->resume(render != 0);
+}
+
+QObject_ *viewInstallRenderTimer(QQuickView_ *view)
+{
+    return new GoRenderTimer(reinterpret_cast<QQuickWindow *>(view));
+}
+
+void renderTimerSetEnabled(QObject_ *timer, int enabled)
+{
+    reinterpret_cast<GoRenderTimer *>(timer)->setEnabled(enabled != 0);
+}
+
+int renderTimerFrames(QObject_ *timer, long long *timings, int max)
+{
+    return reinterpret_cast<GoRenderTimer *>(timer)->frames(timings, max);
+}
+
+void viewPostMouseEvent(QQuickView_ *view, int type, double x, double y, int button, int buttons, int modifiers)
+{
+    postMouseEvent(reinterpret_cast<QQuickView *>(view), QEvent::Type(type), QPointF(x, y), Qt::MouseButton(button), Qt::MouseButtons(buttons), Qt::KeyboardModifiers(modifiers));
+}
+
+void viewPostWheelEvent(QQuickView_ *view, double x, double y, int delta, int modifiers)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    QPointF pos(x, y);
+    QPointF screenPos = qview->mapToGlobal(pos.toPoint());
+    QWheelEvent *event = new QWheelEvent(pos, screenPos, QPoint(), QPoint(0, delta), delta, Qt::Vertical, Qt::NoButton, Qt::KeyboardModifiers(modifiers));
+    QCoreApplication::postEvent(qview, event);
+}
+
+void viewPostKeyEvent(QQuickView_ *view, int type, int key, int modifiers, const char *text, int textLen)
+{
+    QString qtext = QString::fromUtf8(text, textLen);
+    QKeyEvent *event = new QKeyEvent(QEvent::Type(type), key, Qt::KeyboardModifiers(modifiers), qtext);
+    QCoreApplication::postEvent(reinterpret_cast<QQuickView *>(view), event);
+}
+
+void viewPostDropEvent(QQuickView_ *view, const char *urls, int urlsLen, double x, double y)
+{
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    QMimeData *data = new QMimeData();
+    QList<QUrl> qurls;
+    foreach (const QString &url, QString::fromUtf8(urls, urlsLen).split('\n')) {
+        qurls.append(QUrl(url));
+    }
+    data->setUrls(qurls);
+    QPoint pos(x, y);
+    Qt::DropActions actions = Qt::CopyAction | Qt::LinkAction;
+    QCoreApplication::postEvent(qview, new QDragEnterEvent(pos, actions, data, Qt::NoButton, Qt::NoModifier));
+    QCoreApplication::postEvent(qview, new QDragMoveEvent(pos, actions, data, Qt::NoButton, Qt::NoModifier));
+    QCoreApplication::postEvent(qview, new QDropEvent(pos, actions, data, Qt::NoButton, Qt::NoModifier));
+    // Deleted after the events above are delivered.
+    data->deleteLater();
+}
+
+void contextSetObject(QQmlContext_ *context, QObject_ *value)
+{
+    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
+    QObject *qvalue = reinterpret_cast<QObject *>(value);
+
+    // Give qvalue an engine reference if it doesn't yet have one.
+    if (!qmlEngine(qvalue)) {
+        QQmlEngine::setContextForObject(qvalue, qcontext->engine()->rootContext());
+    }
+
+    qcontext->setContextObject(qvalue);
+}
+
+void contextSetProperty(QQmlContext_ *context, QString_ *name, DataValue *value)
+{
+    const QString *qname = reinterpret_cast<QString *>(name);
+    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
+
+    QVariant var;
+    unpackDataValue(value, &var);
+
+    // Give qvalue an engine reference if it doesn't yet have one .
+    QObject *obj = var.value<QObject *>();
+    if (obj && !qmlEngine(obj)) {
+        QQmlEngine::setContextForObject(obj, qcontext);
+    }
+
+    qcontext->setContextProperty(*qname, var);
+}
+
+void contextGetProperty(QQmlContext_ *context, QString_ *name, DataValue *result)
+{
+    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
+    const QString *qname = reinterpret_cast<QString *>(name);
+
+    QVariant var = qcontext->contextProperty(*qname);
+    packDataValue(&var, result);
+}
+
+void delObject(QObject_ *object)
+{
+    delete reinterpret_cast<QObject *>(object);
+}
+
+void delObjectLater(QObject_ *object)
+{
+    reinterpret_cast<QObject *>(object)->deleteLater();
+}
+
+GoAddr *objectGoAddr(QObject_ *object)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    if (GoValue *govalue = dynamic_cast<GoValue *>(qobject)) {
+        return govalue->addr();
+    }
+    if (GoPaintedValue *painted = dynamic_cast<GoPaintedValue *>(qobject)) {
+        return painted->addr();
+    }
+    if (GoGLValue *gl = dynamic_cast<GoGLValue *>(qobject)) {
+        return gl->addr();
+    }
+    return 0;
+}
+
+int objectGetProperty(QObject_ *object, const char *name, DataValue *result)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+
+    if (strchr(name, '.')) {
+        QQmlProperty prop(qobject, QString::fromUtf8(name), qmlContext(qobject));
+        if (!prop.isValid()) {
+            return 0;
+        }
+        QVariant var = prop.read();
+        packDataValue(&var, result);
+        return 1;
+    }
+    
+    QVariant var = qobject->property(name);
+    packDataValue(&var, result);
+
+    if (!var.isValid() && qobject->metaObject()->indexOfProperty(name) == -1) {
+            // TODO May have to check the dynamic property names too.
+            return 0;
+    }
+    return 1;
+}
+
+int objectEnumValue(QObject_ *object, const char *key, int *value)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+    QByteArray enumName;
+    QByteArray keyName(key);
+    int dot = keyName.lastIndexOf('.');
+    if (dot >= 0) {
+        enumName = keyName.left(dot);
+        keyName = keyName.mid(dot+1);
+    }
+    for (int i = 0; i < meta->enumeratorCount(); i++) {
+        QMetaEnum metaEnum = meta->enumerator(i);
+        if (!enumName.isEmpty() && enumName != metaEnum.name()) {
+            continue;
+        }
+        bool ok;
+        int v = metaEnum.keyToValue(keyName.constData(), &ok);
+        if (ok) {
+            *value = v;
+            return 1;
+        }
+    }
+    return 0;
+}
+
+const char *objectEnumKey(QObject_ *object, const char *enumName, int value)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+    int index = meta->indexOfEnumerator(enumName);
+    if (index < 0) {
+        return 0;
+    }
+    return meta->enumerator(index).valueToKey(value);
+}
+
+char *objectEnumsReport(QObject_ *object)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+
+    // Each line holds the enum name and its keys and values separated
+    // by semicolons.
+    QByteArray report;
+    for (int i = 0; i < meta->enumeratorCount(); i++) {
+        QMetaEnum metaEnum = meta->enumerator(i);
+        report += QByteArray(metaEnum.name()) + '\t';
+        for (int j = 0; j < metaEnum.keyCount(); j++) {
+            report += (j > 0 ? ";" : "") + QByteArray(metaEnum.key(j)) + '=' + QByteArray::number(metaEnum.value(j));
+        }
+        report += '\n';
+    }
+    return local_strdup(report.constData());
+}
+
+QObject_ *objectAnimate(QObject_ *object, const char *name, DataValue *to, int msecs, int easing, int restoreBinding, GoAddr *anim, int *result, const char **typeName)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    QQmlProperty property(qobject, QString::fromUtf8(name), qmlContext(qobject));
+    if (!property.isValid() || property.type() != QQmlProperty::Property) {
+        *result = AnimateNoProperty;
+        return 0;
+    }
+    *typeName = property.propertyTypeName();
+    if (!property.isWritable()) {
+        *result = AnimateReadOnly;
+        return 0;
+    }
+    int propType = property.propertyType();
+    switch (propType) {
+    case QMetaType::Int:
+    case QMetaType::UInt:
+    case QMetaType::Double:
+    case QMetaType::Float:
+    case QMetaType::QColor:
+    case QMetaType::QPoint:
+    case QMetaType::QPointF:
+        break;
+    default:
+        *result = AnimateUnsupported;
+        return 0;
+    }
+
+    QVariant var;
+    unpackDataValue(to, &var);
+    if (var.type() == QVariant::Map && (propType == QMetaType::QPoint || propType == QMetaType::QPointF)) {
+        QVariantMap point = var.toMap();
+        var = QPointF(point.value("x").toReal(), point.value("y").toReal());
+    }
+    if (!var.convert(propType)) {
+        *result = AnimateWrongType;
+        return 0;
+    }
+
+    GoAnimation *animation = new GoAnimation(anim, property, restoreBinding != 0);
+    animation->setStartValue(property.read());
+    animation->setEndValue(var);
+    animation->setDuration(msecs);
+    animation->setEasingCurve(QEasingCurve::Type(easing));
+    animation->start();
+    *result = AnimateOK;
+    return animation;
+}
+
+void animationStop(QObject_ *animation)
+{
+    reinterpret_cast<GoAnimation *>(animation)->stop();
+}
+
+int objectSetProperty(QObject_ *object, const char *name, DataValue *value, const char **typeName)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+
+    // Dotted names such as "anchors.margins", "font.pixelSize", and
+    // "Layout.fillWidth" refer to grouped, value type, and attached
+    // properties, which are resolved by QQmlProperty.
+    QQmlProperty path;
+    QMetaProperty prop;
+    if (strchr(name, '.')) {
+        path = QQmlProperty(qobject, QString::fromUtf8(name), qmlContext(qobject));
+        if (!path.isValid()) {
+            return SetNoProperty;
+        }
+        prop = path.property();
+        *typeName = path.propertyTypeName();
+        if (!path.isWritable()) {
+            return SetReadOnly;
+        }
+    } else {
+        const QMetaObject *meta = qobject->metaObject();
+        int propIndex = meta->indexOfProperty(name);
+        if (propIndex == -1) {
+            return SetNoProperty;
+        }
+        prop = meta->property(propIndex);
+        *typeName = prop.typeName();
+        if (!prop.isWritable()) {
+            return SetReadOnly;
+        }
+    }
+
+    QVariant var;
+    unpackDataValue(value, &var);
+
+    int propType = path.isValid() ? path.propertyType() : prop.userType();
+    if (propType != QMetaType::QVariant && propType != qMetaTypeId<QJSValue>() && !prop.isEnumType() &&
+            !(QMetaType::typeFlags(propType) & QMetaType::PointerToQObject) && var.isValid()) {
+        QVariant converted = var;
+        if (!converted.convert(propType)) {
+            return SetWrongType;
+        }
+    }
+
+    // Give qvalue an engine reference if it doesn't yet have one.
+    QObject *obj = var.value<QObject *>();
+    if (obj && !qmlEngine(obj)) {
+        QQmlContext *context = qmlContext(qobject);
+        if (context) {
+            QQmlEngine::setContextForObject(obj, context);
+        }
+    }
+
+    if (path.isValid() ? !path.write(var) : !qobject->setProperty(name, var)) {
+        return SetWrongType;
+    }
+    return SetOK;
+}
+
+int objectMissingPropertySegment(QObject_ *object, const char *name)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    QQmlContext *context = qmlContext(qobject);
+    QStringList segments = QString::fromUtf8(name).split('.');
+    for (int i = 0; i < segments.size(); i++) {
+        // A leading capitalized segment names the type of an attached
+        // property, which cannot be resolved on its own.
+        if (i == 0 && segments.size() > 1 && segments[0].size() > 0 && segments[0].at(0).isUpper()) {
+            continue;
+        }
+        QStringList prefix = segments.mid(0, i+1);
+        if (!QQmlProperty(qobject, prefix.join("."), context).isValid()) {
+            return i;
+        }
+    }
+    return segments.size() - 1;
+}
+
+// invokeArgument prepares param to be provided as an argument of the given
+// parameter type, returning false if it cannot be converted to that type.
+static bool invokeArgument(int type, QVariant *param, QObject **objectParam, QGenericArgument *arg)
+{
+    if (type == QMetaType::QVariant) {
+        *arg = Q_ARG(QVariant, *param);
+        return true;
+    }
+    if (QMetaType::typeFlags(type) & QMetaType::PointerToQObject) {
+        const QMetaObject *meta = QMetaType::metaObjectForType(type);
+        *objectParam = param->value<QObject *>();
+        if (*objectParam && meta && !(*objectParam)->metaObject()->inherits(meta)) {
+            return false;
+        }
+        if (!*objectParam && !param->isNull()) {
+            return false;
+        }
+        *arg = QGenericArgument(QMetaType::typeName(type), objectParam);
+        return true;
+    }
+    if (param->userType() != type && !param->convert(type)) {
+        return false;
+    }
+    *arg = QGenericArgument(QMetaType::typeName(type), param->constData());
+    return true;
+}
+
+// qmlMethodOffset returns the index of the first method of meta that
+// was declared in QML code rather than in C++.
+static int qmlMethodOffset(const QMetaObject *meta)
+{
+    while (meta->superClass()) {
+        QByteArray className(meta->className());
+        if (!className.contains("_QMLTYPE_") && !className.contains("_QML_")) {
+            break;
+        }
+        meta = meta->superClass();
+    }
+    return meta->methodCount();
+}
+
+// objectCallFunction calls the named function declared in QML code via
+// JavaScript, so that it may take any number of arguments, including more
+// than the ones it declares, as done for functions with rest parameters.
+static int objectCallFunction(QObject *qobject, const QByteArray &name, DataValue *resultdv, const QVariantList &params)
+{
+    QQmlContext *parent = qmlContext(qobject);
+    if (!parent) {
+        return InvokeFailed;
+    }
+    QQmlContext qcontext(parent);
+    qcontext.setContextProperty("__goObject", qobject);
+    qcontext.setContextProperty("__goMethod", QString::fromUtf8(name));
+    qcontext.setContextProperty("__goParams", params);
+
+    QQmlExpression expr(&qcontext, qobject, "__goObject[__goMethod].apply(__goObject, __goParams)");
+    QVariant result = expr.evaluate();
+    if (expr.hasError()) {
+        return InvokeFailed;
+    }
+    packDataValue(&result, resultdv);
+    return InvokeOK;
+}
+
+int objectInvoke(QObject_ *object, const char *method, DataValue *resultdv, DataValue *paramsdv, int paramsLen, char **candidates)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+    QByteArray name(method);
+
+    QVariantList param;
+    for (int i = 0; i < paramsLen; i++) {
+        QVariant var;
+        unpackDataValue(&paramsdv[i], &var);
+        param.append(var);
+    }
+
+    QByteArray sigs;
+    bool found = false;
+    bool matched = false;
+    bool variadic = false;
+    int qmlOffset = qmlMethodOffset(meta);
+    int status = InvokeNoMatch;
+
+    // Prefer the most derived method when names are overloaded, but
+    // report all candidates when none of them can be called.
+    for (int i = meta->methodCount() - 1; i >= 0; i--) {
+        QMetaMethod qmethod = meta->method(i);
+        if (qmethod.name() != name) {
+            continue;
+        }
+        if (found) {
+            sigs.append('\n');
+        }
+        found = true;
+        sigs.append(qmethod.methodSignature());
+        if (i >= qmlOffset && qmethod.parameterCount() < paramsLen) {
+            // Functions declared in QML take extra arguments in JavaScript.
+            variadic = true;
+        }
+        if (matched || qmethod.parameterCount() != paramsLen || paramsLen > MaximumParamCount-1) {
+            continue;
+        }
+
+        QVariant arg[MaximumParamCount-1];
+        QObject *objectArg[MaximumParamCount-1];
+        QGenericArgument garg[MaximumParamCount-1];
+        bool ok = true;
+        for (int j = 0; j < paramsLen && ok; j++) {
+            arg[j] = param[j];
+            ok = invokeArgument(qmethod.parameterType(j), &arg[j], &objectArg[j], &garg[j]);
+        }
+        if (!ok) {
+            continue;
+        }
+        matched = true;
+
+        QVariant result;
+        QGenericReturnArgument gresult;
+        int returnType = qmethod.returnType();
+        if (returnType == QMetaType::QVariant) {
+            gresult = Q_RETURN_ARG(QVariant, result);
+        } else if (returnType != QMetaType::Void && returnType != QMetaType::UnknownType) {
+            result = QVariant(returnType, (const void *)0);
+            gresult = QGenericReturnArgument(QMetaType::typeName(returnType), result.data());
+        }
+        if (qmethod.invoke(qobject, Qt::DirectConnection, gresult,
+                garg[0], garg[1], garg[2], garg[3], garg[4], garg[5], garg[6], garg[7], garg[8], garg[9])) {
+            packDataValue(&result, resultdv);
+            return InvokeOK;
+        }
+        status = InvokeFailed;
+    }
+    if (!found) {
+        return InvokeNoMethod;
+    }
+    if (!matched && variadic) {
+        status = objectCallFunction(qobject, name, resultdv, param);
+        if (status == InvokeOK) {
+            return status;
+        }
+    }
+    *candidates = local_strdup(sigs.constData());
+    return status;
+}
+
+void objectFindChild(QObject_ *object, QString_ *name, DataValue *resultdv)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    QString *qname = reinterpret_cast<QString *>(name);
+    
+    QVariant var;
+    QObject *result = qobject->findChild<QObject *>(*qname);
+    if (result) {
+        var.setValue(result);
+    }
+    packDataValue(&var, resultdv);
+}
+
+char *objectCreationLocation(QObject_ *object, int *line, int *column)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    QQmlData *ddata = QQmlData::get(qobject, false);
+    if (!ddata || !ddata->outerContext || ddata->lineNumber == 0) {
+        return 0;
+    }
+    QUrl url = ddata->outerContext->url;
+    if (url.isEmpty()) {
+        return 0;
+    }
+    *line = ddata->lineNumber;
+    *column = ddata->columnNumber;
+    return local_strdup(url.toString().toUtf8().constData());
+}
+
+static void censusObject(QObject *object, QSet<QObject *> &seen, QHash<QByteArray, int> &counts)
+{
+    if (!object || seen.contains(object)) {
+        return;
+    }
+    seen.insert(object);
+
+    QByteArray key = object->metaObject()->className();
+    key += '\t';
+    QQmlData *ddata = QQmlData::get(object, false);
+    if (ddata && ddata->outerContext) {
+        key += ddata->outerContext->url.toString().toUtf8();
+    }
+    counts[key]++;
+
+    foreach (QObject *child, object->children()) {
+        censusObject(child, seen, counts);
+    }
+    QQuickItem *item = qobject_cast<QQuickItem *>(object);
+    if (item) {
+        foreach (QQuickItem *child, item->childItems()) {
+            censusObject(child, seen, counts);
+        }
+    }
+}
+
+static void censusContext(QQmlContextData *context, QSet<QObject *> &seen, QHash<QByteArray, int> &counts)
+{
+    // Each component instance has its own context, with the
+    // root object of the instance as the context object.
+    censusObject(context->contextObject, seen, counts);
+    for (QQmlContextData *child = context->childContexts; child; child = child->nextChild) {
+        censusContext(child, seen, counts);
+    }
+}
+
+char *engineObjectCensus(QQmlEngine_ *engine)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QSet<QObject *> seen;
+    QHash<QByteArray, int> counts;
+
+    // The engine and its root context are not interesting.
+    seen.insert(qengine);
+    seen.insert(qengine->rootContext());
+    foreach (QWindow *window, QGuiApplication::allWindows()) {
+        QQuickView *view = qobject_cast<QQuickView *>(window);
+        if (view && view->engine() == qengine) {
+            censusObject(view, seen, counts);
+        }
+    }
+    censusContext(QQmlContextData::get(qengine->rootContext()), seen, counts);
+    foreach (QObject *child, qengine->children()) {
+        censusObject(child, seen, counts);
+    }
+
+    // Each line holds the count, class name, and creation URL.
+    QByteArray report;
+    for (QHash<QByteArray, int>::const_iterator it = counts.constBegin(); it != counts.constEnd(); ++it) {
+        report += QByteArray::number(it.value()) + '\t' + it.key() + '\n';
+    }
+    return local_strdup(report.constData());
+}
+
+QObject_ **engineRootObjects(QQmlEngine_ *engine, int *len)
+{
+    QList<QObject *> roots;
+    foreach (const QPointer<QObject> &object, engineObjects.value(reinterpret_cast<QQmlEngine *>(engine))) {
+        if (!object) {
+            continue;
+        }
+        QQuickWindow *window = qobject_cast<QQuickWindow *>(object.data());
+        QObject *root = window ? windowRoot(window) : object.data();
+        if (root) {
+            roots.append(root);
+        }
+    }
+    *len = roots.size();
+    if (roots.isEmpty()) {
+        return 0;
+    }
+    QObject_ **result = (QObject_ **)malloc(sizeof(QObject_ *) * roots.size());
+    for (int i = 0; i < roots.size(); i++) {
+        result[i] = roots[i];
+    }
+    return result;
+}
+
+char *objectSignalSignature(QObject_ *object, const char *name, int nameLen, int *signalIndex)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+    QByteArray qname(name, nameLen);
+
+    // Prefer the most derived signal when names are overloaded.
+    for (int i = meta->methodCount() - 1; i >= 0; i--) {
+        QMetaMethod method = meta->method(i);
+        if (method.methodType() == QMetaMethod::Signal && method.name() == qname) {
+            *signalIndex = i;
+            return local_strdup(method.methodSignature().constData());
+        }
+    }
+    return 0;
+}
+
+int objectPropertyNotifySignal(QObject_ *object, const char *name, int nameLen, int *paramCount)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+    int propIndex = meta->indexOfProperty(QByteArray(name, nameLen).constData());
+    if (propIndex < 0) {
+        return -1;
+    }
+    QMetaProperty prop = meta->property(propIndex);
+    if (!prop.hasNotifySignal()) {
+        return -2;
+    }
+    QMetaMethod signal = prop.notifySignal();
+    *paramCount = signal.parameterCount();
+    return signal.methodIndex();
+}
+
+QObject_ *objectConnect(QObject_ *object, int signalIndex, GoAddr *conn)
+{
+    return new GoSignalConnector(reinterpret_cast<QObject *>(object), signalIndex, conn);
+}
+
+void signalConnectorReconnect(QObject_ *connector)
+{
+    reinterpret_cast<GoSignalConnector *>(connector)->reconnect();
+}
+
+QObject_ *objectNewThrottleTimer(QObject_ *object, GoAddr *throttler)
+{
+    // The timer is a child of the object so that it's destroyed with it.
+    QTimer *timer = new QTimer(reinterpret_cast<QObject *>(object));
+    timer->setSingleShot(true);
+    QObject::connect(timer, &QTimer::timeout, [=]() {
+        hookThrottleTimeout(throttler);
+    });
+    QObject::connect(timer, &QObject::destroyed, [=]() {
+        hookThrottleDestroyed(throttler);
+    });
+    return timer;
+}
+
+void throttleTimerStart(QObject_ *timer, int msec)
+{
+    reinterpret_cast<QTimer *>(timer)->start(msec);
+}
+
+QObject_ *newTimer(GoAddr *timer, int msec, int singleShot)
+{
+    QTimer *qtimer = new QTimer();
+    qtimer->setTimerType(Qt::PreciseTimer);
+    qtimer->setSingleShot(singleShot);
+    QObject::connect(qtimer, &QTimer::timeout, [=]() {
+        hookTimerTimeout(timer);
+    });
+    QObject::connect(qtimer, &QObject::destroyed, [=]() {
+        hookTimerDestroyed(timer);
+    });
+    qtimer->start(msec);
+    return qtimer;
+}
+
+void objectSetParent(QObject_ *object, QObject_ *parent)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    QObject *qparent = reinterpret_cast<QObject *>(parent);
+
+    qobject->setParent(qparent);
+}
+
+void objectTrackDestroyed(QObject_ *object)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    QObject::connect(qobject, &QObject::destroyed, [=]() {
+        hookObjectDestroyed(object);
+    });
+}
+
+int objectOwnership(QObject_ *object)
+{
+    return QQmlEngine::objectOwnership(reinterpret_cast<QObject *>(object));
+}
+
+void objectSetOwnership(QObject_ *object, int ownership)
+{
+    QQmlEngine::setObjectOwnership(reinterpret_cast<QObject *>(object), QQmlEngine::ObjectOwnership(ownership));
+}
+
+void objectPinOwnership(QObject_ *object)
+{
+    // Only objects without a parent are collected.
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    if (!qobject->parent() && QQmlEngine::objectOwnership(qobject) == QQmlEngine::JavaScriptOwnership) {
+        QQmlEngine::setObjectOwnership(qobject, QQmlEngine::CppOwnership);
+    }
+}
+
+QQmlContext_ *objectContext(QObject_ *object)
+{
+    return qmlContext(reinterpret_cast<QObject *>(object));
+}
+
+QQmlEngine_ *objectEngine(QObject_ *object)
+{
+    return qmlEngine(reinterpret_cast<QObject *>(object));
+}
+
+int objectIsComponent(QObject_ *object)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    return dynamic_cast<QQmlComponent *>(qobject) ? 1 : 0;
+}
+
+int objectInherits(QObject_ *object, const char *className)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    return qobject->inherits(className) ? 1 : 0;
+}
+
+const char *objectClassName(QObject_ *object)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    return qobject->metaObject()->className();
+}
+
+char *objectPropertiesReport(QObject_ *object)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+
+    // Each line holds the name, type name, and whether the property is
+    // writable and has a notify signal.
+    QByteArray report;
+    for (int i = 0; i < meta->propertyCount(); i++) {
+        QMetaProperty property = meta->property(i);
+        report += QByteArray(property.name()) + '\t' + property.typeName() + '\t';
+        report += property.isWritable() ? "1\t" : "0\t";
+        report += property.hasNotifySignal() ? "1\n" : "0\n";
+    }
+    return local_strdup(report.constData());
+}
+
+char *objectPropertyReport(QObject_ *object, const char *name)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+    int index = meta->indexOfProperty(name);
+    if (index < 0) {
+        return 0;
+    }
+    QMetaProperty property = meta->property(index);
+
+    // The report is a single line with the type name, whether the
+    // property is writable, the enum name and its keys and values
+    // separated by semicolons, the minimum and maximum values, whether
+    // the property is grouped, the notify signal name, and whether
+    // the property is bound.
+    QByteArray report = QByteArray(property.typeName()) + '\t';
+    report += property.isWritable() ? "1\t" : "0\t";
+    if (property.isEnumType()) {
+        QMetaEnum enumerator = property.enumerator();
+        report += QByteArray(enumerator.name()) + '\t';
+        for (int i = 0; i < enumerator.keyCount(); i++) {
+            report += (i > 0 ? ";" : "") + QByteArray(enumerator.key(i)) + '=' + QByteArray::number(enumerator.value(i));
+        }
+        report += '\t';
+    } else {
+        report += "\t\t";
+    }
+
+    // Qt has no notion of property ranges, so these are taken from
+    // class information entries such as "value.minimum".
+    int minIndex = meta->indexOfClassInfo(QByteArray(name) + ".minimum");
+    int maxIndex = meta->indexOfClassInfo(QByteArray(name) + ".maximum");
+    report += QByteArray(minIndex < 0 ? "" : meta->classInfo(minIndex).value()) + '\t';
+    report += QByteArray(maxIndex < 0 ? "" : meta->classInfo(maxIndex).value()) + '\t';
+
+    // Grouped properties such as anchors and font have sub-properties
+    // that are set as anchors.fill or font.bold.
+    bool grouped = QQmlValueTypeFactory::isValueType(property.userType()) ||
+        (!property.isWritable() && (QMetaType::typeFlags(property.userType()) & QMetaType::PointerToQObject));
+    report += grouped ? "1\t" : "0\t";
+    report += (property.hasNotifySignal() ? property.notifySignal().name() : QByteArray()) + '\t';
+    report += QQmlPropertyPrivate::binding(QQmlProperty(qobject, name)) ? "1\n" : "0\n";
+    return local_strdup(report.constData());
+}
+
+char *objectMethodsReport(QObject_ *object)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QMetaObject *meta = qobject->metaObject();
+
+    // Each line holds the name, whether the method is a signal, the
+    // result type, and the parameter types and names separated by
+    // semicolons, as type names may hold commas.
+    QByteArray report;
+    for (int i = 0; i < meta->methodCount(); i++) {
+        QMetaMethod method = meta->method(i);
+        if (method.access() == QMetaMethod::Private) {
+            continue;
+        }
+        report += method.name() + '\t';
+        report += method.methodType() == QMetaMethod::Signal ? "1\t" : "0\t";
+        report += QByteArray(method.typeName()) + '\t';
+        QList<QByteArray> types = method.parameterTypes();
+        QList<QByteArray> names = method.parameterNames();
+        for (int j = 0; j < types.size(); j++) {
+            report += (j > 0 ? ";" : "") + types[j];
+        }
+        report += '\t';
+        for (int j = 0; j < names.size(); j++) {
+            report += (j > 0 ? ";" : "") + names[j];
+        }
+        report += '\n';
+    }
+    return local_strdup(report.constData());
+}
+
+QObject_ **objectChildren(QObject_ *object, int *len)
+{
+    QObject *qobject = reinterpret_cast<QObject *>(object);
+    const QObjectList &children = qobject->children();
+    *len = children.size();
+    if (children.isEmpty()) {
+        return 0;
+    }
+    QObject_ **result = (QObject_ **)malloc(sizeof(QObject_ *) * children.size());
+    for (int i = 0; i < children.size(); i++) {
+        result[i] = children[i];
+    }
+    return result;
+}
+
+static void readyObject(QObject *object, QSet<QObject *> &seen, QByteArray &report)
+{
+    if (!object || seen.contains(object)) {
+        return;
+    }
+    seen.insert(object);
+
+    if (object->inherits("QQuickImageBase") || object->inherits("QQuickLoader") || object->inherits("QQuickFontLoader")) {
+        // Report the class the QML type was derived from, if any.
+        const QMetaObject *meta = object->metaObject();
+        while (meta->superClass() && QByteArray(meta->className()).contains("_QML")) {
+            meta = meta->superClass();
+        }
+        report += QByteArray::number(object->property("status").toInt()) + '\t';
+        report += QByteArray(meta->className()) + '\t';
+        report += object->objectName().toUtf8() + '\t';
+        report += object->property("source").toUrl().toString().toUtf8() + '\n';
+    }
+
+    foreach (QObject *child, object->children()) {
+        readyObject(child, seen, report);
+    }
+    QQuickItem *item = qobject_cast<QQuickItem *>(object);
+    if (item) {
+        foreach (QQuickItem *child, item->childItems()) {
+            readyObject(child, seen, report);
+        }
+    }
+}
+
+char *objectReadyReport(QObject_ *object, int *total)
+{
+    QSet<QObject *> seen;
+    QByteArray report;
+    readyObject(reinterpret_cast<QObject *>(object), seen, report);
+    *total = seen.size();
+
+    // Each line holds the status, class name, object name, and source.
+    return local_strdup(report.constData());
+}
+
+// qmlLiteral sets literal to the QML source for value, and returns
+// whether the value has a literal form.
+static bool qmlLiteral(const QVariant &value, QByteArray &literal)
+{
+    switch (value.userType()) {
+    case QMetaType::Bool:
+        literal = value.toBool() ? "true" : "false";
+        return true;
+    case QMetaType::Int:
+    case QMetaType::UInt:
+    case QMetaType::LongLong:
+    case QMetaType::ULongLong:
+        literal = value.toByteArray();
+        return true;
+    case QMetaType::Float:
+    case QMetaType::Double:
+        literal = QByteArray::number(value.toDouble(), 'g', 17);
+        return true;
+    case QMetaType::QString:
+    case QMetaType::QUrl:
+        {
+            // Quoted and escaped as done for JSON strings, which are
+            // valid JavaScript strings.
+            QJsonArray array;
+            array.append(value.toString());
+            QByteArray json = QJsonDocument(array).toJson(QJsonDocument::Compact);
+            literal = json.mid(1, json.size() - 2);
+            return true;
+        }
+    case QMetaType::QColor:
+        {
+            QColor color = value.value<QColor>();
+#if QT_VERSION >= QT_VERSION_CHECK(5, 2, 0)
+            literal = '"' + color.name(QColor::HexArgb).toLatin1() + '"';
+#else
+            literal = '"' + color.name().toLatin1() + '"';
+#endif
+            return true;
+        }
+    case QMetaType::QPointF:
+        {
+            QPointF p = value.toPointF();
+            literal = "Qt.point(" + QByteArray::number(p.x(), 'g', 17) + ", " + QByteArray::number(p.y(), 'g', 17) + ")";
+            return true;
+        }
+    case QMetaType::QSizeF:
+        {
+            QSizeF s = value.toSizeF();
+            literal = "Qt.size(" + QByteArray::number(s.width(), 'g', 17) + ", " + QByteArray::number(s.height(), 'g', 17) + ")";
+            return true;
+        }
+    case QMetaType::QRectF:
+        {
+            QRectF r = value.toRectF();
+            literal = "Qt.rect(" + QByteArray::number(r.x(), 'g', 17) + ", " + QByteArray::number(r.y(), 'g', 17) + ", " +
+                QByteArray::number(r.width(), 'g', 17) + ", " + QByteArray::number(r.height(), 'g', 17) + ")";
+            return true;
+        }
+    }
+    if (QMetaType::typeFlags(value.userType()) & QMetaType::IsEnumeration) {
+        literal = QByteArray::number(value.toInt());
+        return true;
+    }
+    return false;
+}
+
+// serializeItem appends to report the lines describing item and its
+// visual children, and returns false if some item has no QML type.
+static bool serializeItem(QQuickItem *item, int depth, QByteArray &report)
+{
+    const QMetaObject *meta = item->metaObject();
+    const QMetaObject *typeMeta = meta;
+#if QT_VERSION >= QT_VERSION_CHECK(5, 10, 0)
+    QQmlType type;
+    for (; typeMeta && !(type = QQmlMetaType::qmlType(typeMeta)).isValid(); typeMeta = typeMeta->superClass()) {}
+    if (!type.isValid()) {
+        report += "E\t" + QByteArray(meta->className()) + '\n';
+        return false;
+    }
+    QQmlType *qtype = &type;
+#else
+    QQmlType *qtype = 0;
+    for (; typeMeta && !(qtype = QQmlMetaType::qmlType(typeMeta)); typeMeta = typeMeta->superClass()) {}
+    if (!qtype) {
+        report += "E\t" + QByteArray(meta->className()) + '\n';
+        return false;
+    }
+#endif
+
+    // Each item is described by a line with its depth, module, version,
+    // and element name, followed by one line per property with a value
+    // different from the default, with the property name, whether it's
+    // bound, and the value as QML source.
+    report += "I\t" + QByteArray::number(depth) + '\t' + qtype->module().toUtf8() + '\t' +
+        QByteArray::number(qtype->majorVersion()) + '\t' + QByteArray::number(qtype->minorVersion()) + '\t' +
+        qtype->elementName().toUtf8() + '\n';
+
+    QObject *fresh = qtype->create();
+    for (int i = 0; i < meta->propertyCount(); i++) {
+        QMetaProperty property = meta->property(i);
+        const char *name = property.name();
+        if (!property.isWritable() || !property.isStored() || strcmp(name, "parent") == 0) {
+            continue;
+        }
+        int t = property.userType();
+        if (QQmlValueTypeFactory::isValueType(t) && t != QMetaType::QColor && t != QMetaType::QPointF && t != QMetaType::QSizeF && t != QMetaType::QRectF) {
+            // Grouped properties such as font.
+            continue;
+        }
+        QVariant value = property.read(item);
+        if (fresh && fresh->metaObject()->indexOfProperty(name) >= 0 && fresh->property(name) == value) {
+            continue;
+        }
+        QByteArray literal;
+        if (!qmlLiteral(value, literal)) {
+            continue;
+        }
+        report += "P\t" + QByteArray(name) + '\t';
+        report += QQmlPropertyPrivate::binding(QQmlProperty(item, name)) ? "1\t" : "0\t";
+        report += literal + '\n';
+    }
+    delete fresh;
+
+    QList<QQuickItem *> children = item->childItems();
+    for (int i = 0; i < children.size(); i++) {
+        if (!serializeItem(children[i], depth + 1, report)) {
+            return false;
+        }
+    }
+    return true;
+}
+
+char *itemSerializeReport(QObject_ *object)
+{
+    QQuickItem *item = qobject_cast<QQuickItem *>(reinterpret_cast<QObject *>(object));
+    if (!item) {
+        return 0;
+    }
+    QByteArray report;
+    serializeItem(item, 0, report);
+    return local_strdup(report.constData());
+}
+
+// translator holds the translation installed via applicationLoadTranslation.
+static QTranslator *translator = 0;
+
+int applicationLoadTranslation(const char *path, int pathLen)
+{
+    QTranslator *loaded = new QTranslator();
+    if (!loaded->load(QString::fromUtf8(path, pathLen))) {
+        delete loaded;
+        return 0;
+    }
+    applicationRemoveTranslation();
+    translator = loaded;
+    qApp->installTranslator(translator);
+    return 1;
+}
+
+int applicationLoadLocaleTranslation(const char *locale, int localeLen, const char *dir, int dirLen, const char *prefix, int prefixLen)
+{
+    QTranslator *loaded = new QTranslator();
+    QLocale qlocale(QString::fromUtf8(locale, localeLen));
+    if (!loaded->load(qlocale, QString::fromUtf8(prefix, prefixLen), QString(), QString::fromUtf8(dir, dirLen))) {
+        delete loaded;
+        return 0;
+    }
+    applicationRemoveTranslation();
+    translator = loaded;
+    qApp->installTranslator(translator);
+    return 1;
+}
+
+void applicationRemoveTranslation()
+{
+    if (translator) {
+        qApp->removeTranslator(translator);
+        delete translator;
+        translator = 0;
+    }
+}
+
+int engineRetranslate(QQmlEngine_ *engine)
+{
+#if QT_VERSION >= QT_VERSION_CHECK(5, 10, 0)
+    reinterpret_cast<QQmlEngine *>(engine)->retranslate();
+    return 1;
+#else
+    Q_UNUSED(engine);
+    return 0;
+#endif
+}
+
+QObject_ *newScriptWatchdog(QQmlEngine_ *engine)
+{
+#if QT_VERSION >= QT_VERSION_CHECK(5, 14, 0)
+    return new GoScriptWatchdog(reinterpret_cast<QQmlEngine *>(engine));
+#else
+    Q_UNUSED(engine);
+    return 0;
+#endif
+}
+
+void scriptWatchdogSetTimeout(QObject_ *watchdog, int msec)
+{
+    reinterpret_cast<GoScriptWatchdog *>(watchdog)->setTimeout(msec);
+}
+
+int engineInterruptScripts(QQmlEngine_ *engine)
+{
+    return GoScriptWatchdog::interrupt(reinterpret_cast<QQmlEngine *>(engine));
+}
+
+char *localeName()
+{
+    return local_strdup(QLocale().name().toUtf8().constData());
+}
+
+void localeSetDefault(const char *name, int nameLen)
+{
+    QLocale::setDefault(QLocale(QString::fromUtf8(name, nameLen)));
+}
+
+char *localeCanonicalName(const char *name, int nameLen)
+{
+    QString qname = QString::fromUtf8(name, nameLen).replace('_', '-');
+    if (qname == "C") {
+        return local_strdup("C");
+    }
+    QLocale locale(qname);
+    if (locale.language() == QLocale::C) {
+        return 0;
+    }
+
+    // QLocale falls back to the default country of the language when
+    // the requested one is unknown, rather than failing.
+    QString country = locale.name().section('_', 1, 1);
+    QStringList parts = qname.split('-');
+    for (int i = 1; i < parts.size(); i++) {
+        const QString &part = parts[i];
+        bool isCountry = (part.size() == 2 && part[0].isLetter()) || (part.size() == 3 && part[0].isDigit());
+        if (isCountry && part.compare(country, Qt::CaseInsensitive) != 0) {
+            return 0;
+        }
+    }
+    return local_strdup(locale.name().replace('_', '-').toUtf8().constData());
+}
+
+void engineSetUiLanguage(QQmlEngine_ *engine, const char *name, int nameLen)
+{
+#if QT_VERSION >= QT_VERSION_CHECK(5, 15, 0)
+    reinterpret_cast<QQmlEngine *>(engine)->setUiLanguage(QString::fromUtf8(name, nameLen));
+#else
+    Q_UNUSED(engine);
+    Q_UNUSED(name);
+    Q_UNUSED(nameLen);
+#endif
+}
+
+QString_ *newString(const char *data, int len)
+{
+    // This will copy data only once.
+    QByteArray ba = QByteArray::fromRawData(data, len);
+    return new QString(ba);
+}
+
+void delString(QString_ *s)
+{
+    delete reinterpret_cast<QString *>(s);
+}
+
+GoValue_ *newGoValue(GoAddr *addr, GoTypeInfo *typeInfo, QObject_ *parent)
+{
+    QObject *qparent = reinterpret_cast<QObject *>(parent);
+    return new GoValue(addr, typeInfo, qparent);
+}
+
+// goValueMeta returns the meta object of value, which is either
+// a GoValue, a GoPaintedValue, or a GoGLValue.
+static GoValueMetaObject *goValueMeta(GoValue_ *value)
+{
+    QObject *qvalue = reinterpret_cast<QObject *>(value);
+    GoPaintedValue *painted = dynamic_cast<GoPaintedValue *>(qvalue);
+    if (painted) {
+        return painted->valueMeta();
+    }
+    GoGLValue *gl = dynamic_cast<GoGLValue *>(qvalue);
+    if (gl) {
+        return gl->valueMeta();
+    }
+    return static_cast<GoValue *>(qvalue)->valueMeta();
+}
+
+void goValueActivate(GoValue_ *value, GoTypeInfo *typeInfo, int addrOffset)
+{
+    GoMemberInfo *fieldInfo = typeInfo->fields;
+    for (int i = 0; i < typeInfo->fieldsLen; i++) {
+        if (fieldInfo->addrOffset == addrOffset) {
+            goValueMeta(value)->activateField(fieldInfo->metaIndex);
+            return;
+        }
+        fieldInfo++;
+    }
+
+    // TODO Return an error; probably an unexported field.
+}
+
+void goValueEmit(GoValue_ *value, int metaIndex, DataValue *params, int paramsLen)
+{
+    QVariant vars[MaximumParamCount - 1];
+    void *args[MaximumParamCount];
+    args[0] = 0;
+    for (int i = 0; i < paramsLen; i++) {
+        unpackDataValue(&params[i], &vars[i]);
+        args[i+1] = &vars[i];
+    }
+    goValueMeta(value)->emitSignal(metaIndex, args);
+}
+
+void goValueUpdate(GoValue_ *value)
+{
+    QObject *qvalue = reinterpret_cast<QObject *>(value);
+    GoPaintedValue *painted = dynamic_cast<GoPaintedValue *>(qvalue);
+    if (painted) {
+        painted->update();
+    }
+    GoGLValue *gl = dynamic_cast<GoGLValue *>(qvalue);
+    if (gl && gl->window()) {
+        gl->window()->update();
+    }
+}
+
+void painterSetPen(QPainter_ *painter, int r, int g, int b, int a, double width)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    QPen pen(QColor(r, g, b, a));
+    pen.setWidthF(width);
+    qpainter->setPen(pen);
+}
+
+void painterSetBrush(QPainter_ *painter, int r, int g, int b, int a)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    qpainter->setBrush(QColor(r, g, b, a));
+}
+
+void painterSetFont(QPainter_ *painter, const char *family, int familyLen, int pixelSize)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    QFont font(QString::fromUtf8(family, familyLen));
+    font.setPixelSize(pixelSize);
+    qpainter->setFont(font);
+}
+
+void painterDrawLine(QPainter_ *painter, double x1, double y1, double x2, double y2)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    qpainter->drawLine(QPointF(x1, y1), QPointF(x2, y2));
+}
+
+void painterDrawRect(QPainter_ *painter, double x, double y, double width, double height)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    qpainter->drawRect(QRectF(x, y, width, height));
+}
+
+void painterDrawEllipse(QPainter_ *painter, double x, double y, double width, double height)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    qpainter->drawEllipse(QRectF(x, y, width, height));
+}
+
+void painterFillRect(QPainter_ *painter, double x, double y, double width, double height, int r, int g, int b, int a)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    qpainter->fillRect(QRectF(x, y, width, height), QColor(r, g, b, a));
+}
+
+void painterDrawText(QPainter_ *painter, double x, double y, const char *text, int textLen)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    qpainter->drawText(QPointF(x, y), QString::fromUtf8(text, textLen));
+}
+
+void painterDrawImage(QPainter_ *painter, double x, double y, QImage_ *image)
+{
+    QPainter *qpainter = reinterpret_cast<QPainter *>(painter);
+    qpainter->drawImage(QPointF(x, y), *reinterpret_cast<QImage *>(image));
+}
+
+QMenu_ *newMenu()
+{
+    return new QMenu();
+}
+
+void menuAddAction(QMenu_ *menu, GoAddr *action, const char *text, int textLen, const char *icon, int iconLen, int enabled)
+{
+    QMenu *qmenu = reinterpret_cast<QMenu *>(menu);
+    QAction *qaction = qmenu->addAction(QString::fromUtf8(text, textLen));
+    if (iconLen > 0) {
+        qaction->setIcon(QIcon(QString::fromUtf8(icon, iconLen)));
+    }
+    qaction->setEnabled(enabled);
+    QObject::connect(qaction, &QAction::triggered, [=](bool checked) {
+        hookMenuActionTriggered(action, checked);
+    });
+}
+
+void menuAddCheckAction(QMenu_ *menu, GoAddr *action, const char *text, int textLen, int enabled, int checked)
+{
+    QMenu *qmenu = reinterpret_cast<QMenu *>(menu);
+    QAction *qaction = qmenu->addAction(QString::fromUtf8(text, textLen));
+    qaction->setCheckable(true);
+    qaction->setChecked(checked);
+    qaction->setEnabled(enabled);
+    QObject::connect(qaction, &QAction::triggered, [=](bool checked) {
+        hookMenuActionTriggered(action, checked);
+    });
+}
+
+void menuAddSeparator(QMenu_ *menu)
+{
+    reinterpret_cast<QMenu *>(menu)->addSeparator();
+}
+
+QMenu_ *menuAddSubmenu(QMenu_ *menu, const char *text, int textLen)
+{
+    return reinterpret_cast<QMenu *>(menu)->addMenu(QString::fromUtf8(text, textLen));
+}
+
+void menuClear(QMenu_ *menu)
+{
+    QMenu *qmenu = reinterpret_cast<QMenu *>(menu);
+    qmenu->clear();
+    qDeleteAll(qmenu->findChildren<QMenu *>(QString(), Qt::FindDirectChildrenOnly));
+}
+
+void menuPopup(QMenu_ *menu, QQuickView_ *view, int x, int y)
+{
+    QMenu *qmenu = reinterpret_cast<QMenu *>(menu);
+    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
+    qmenu->popup(qview->mapToGlobal(QPoint(x, y)));
+}
+
+void menuClose(QMenu_ *menu)
+{
+    reinterpret_cast<QMenu *>(menu)->close();
+}
+
+int trayIsAvailable()
+{
+    return QSystemTrayIcon::isSystemTrayAvailable();
+}
+
+QSystemTrayIcon_ *newTrayIcon(GoAddr *addr)
+{
+    QSystemTrayIcon *tray = new QSystemTrayIcon();
+    QObject::connect(tray, &QSystemTrayIcon::activated, [=](QSystemTrayIcon::ActivationReason reason) {
+        hookTrayActivated(addr, reason);
+    });
+    return tray;
+}
+
+void traySetImage(QSystemTrayIcon_ *tray, QImage_ *image)
+{
+    reinterpret_cast<QSystemTrayIcon *>(tray)->setIcon(QIcon(QPixmap::fromImage(*reinterpret_cast<QImage *>(image))));
+}
+
+void traySetIconFile(QSystemTrayIcon_ *tray, const char *path, int pathLen)
+{
+    QString qpath = QString::fromUtf8(path, pathLen);
+    if (qpath.startsWith("qrc:")) {
+        // QIcon knows resources by the ":/path" form only.
+        qpath = ":" + QUrl(qpath).path();
+    }
+    reinterpret_cast<QSystemTrayIcon *>(tray)->setIcon(QIcon(qpath));
+}
+
+void traySetToolTip(QSystemTrayIcon_ *tray, const char *text, int textLen)
+{
+    reinterpret_cast<QSystemTrayIcon *>(tray)->setToolTip(QString::fromUtf8(text, textLen));
+}
+
+void traySetMenu(QSystemTrayIcon_ *tray, QMenu_ *menu)
+{
+    reinterpret_cast<QSystemTrayIcon *>(tray)->setContextMenu(reinterpret_cast<QMenu *>(menu));
+}
+
+void traySetVisible(QSystemTrayIcon_ *tray, int visible)
+{
+    reinterpret_cast<QSystemTrayIcon *>(tray)->setVisible(visible);
+}
+
+int trayShowMessage(QSystemTrayIcon_ *tray, const char *title, int titleLen, const char *body, int bodyLen, int msecs)
+{
+    if (!QSystemTrayIcon::supportsMessages()) {
+        return 0;
+    }
+    QString qtitle = QString::fromUtf8(title, titleLen);
+    QString qbody = QString::fromUtf8(body, bodyLen);
+    reinterpret_cast<QSystemTrayIcon *>(tray)->showMessage(qtitle, qbody, QSystemTrayIcon::Information, msecs);
+    return 1;
+}
+
+int clipboardSupported(int mode)
+{
+    QClipboard *clipboard = QGuiApplication::clipboard();
+    switch (QClipboard::Mode(mode)) {
+    case QClipboard::Selection:
+        return clipboard->supportsSelection();
+    case QClipboard::FindBuffer:
+        return clipboard->supportsFindBuffer();
+    default:
+        return 1;
+    }
+}
+
+QByteArray_ *clipboardText(int mode, int *len)
+{
+    QByteArray *ba = new QByteArray(QGuiApplication::clipboard()->text(QClipboard::Mode(mode)).toUtf8());
+    *len = ba->size();
+    return ba;
+}
+
+void clipboardSetText(int mode, const char *text, int textLen)
+{
+    QGuiApplication::clipboard()->setText(QString::fromUtf8(text, textLen), QClipboard::Mode(mode));
+}
+
+QImage_ *clipboardImage(int mode, unsigned char **bits, int *width, int *height, int *bytesPerLine)
+{
+    QImage *image = new QImage(QGuiApplication::clipboard()->image(QClipboard::Mode(mode)).convertToFormat(QImage::Format_ARGB32));
+    *bits = image->bits();
+    *width = image->width();
+    *height = image->height();
+    *bytesPerLine = image->bytesPerLine();
+    return image;
+}
+
+void clipboardSetImage(int mode, QImage_ *image)
+{
+    QGuiApplication::clipboard()->setImage(*reinterpret_cast<QImage *>(image), QClipboard::Mode(mode));
+}
+
+void clipboardClear(int mode)
+{
+    QGuiApplication::clipboard()->clear(QClipboard::Mode(mode));
+}
+
+void clipboardWatch()
+{
+    QObject::connect(QGuiApplication::clipboard(), &QClipboard::changed, [=](QClipboard::Mode mode) {
+        hookClipboardChanged(mode);
+    });
+}
+
+QQuickView_ **applicationWindows(int *len)
+{
+    QList<QQuickWindow *> windows;
+    foreach (QWindow *window, QGuiApplication::topLevelWindows()) {
+        QQuickWindow *qwindow = qobject_cast<QQuickWindow *>(window);
+        if (qwindow && (qmlEngine(qwindow) || qobject_cast<QQuickView *>(qwindow))) {
+            windows.append(qwindow);
+        }
+    }
+    *len = windows.size();
+    if (windows.isEmpty()) {
+        return 0;
+    }
+    QQuickView_ **result = (QQuickView_ **)malloc(sizeof(QQuickView_ *) * windows.size());
+    for (int i = 0; i < windows.size(); i++) {
+        result[i] = windows[i];
+    }
+    return result;
+}
+
+QQmlEngine_ *viewEngine(QQuickView_ *view)
+{
+    QQuickWindow *window = reinterpret_cast<QQuickWindow *>(view);
+    QQuickView *qview = qobject_cast<QQuickView *>(window);
+    if (qview) {
+        return qview->engine();
+    }
+    return qmlEngine(window);
+}
+
+void applicationWatchFocusWindow()
+{
+    QObject::connect(qApp, &QGuiApplication::focusWindowChanged, [=](QWindow *window) {
+        QQuickWindow *qwindow = qobject_cast<QQuickWindow *>(window);
+        if (qwindow && !qmlEngine(qwindow) && !qobject_cast<QQuickView *>(qwindow)) {
+            qwindow = 0;
+        }
+        hookFocusWindowChanged(qwindow);
+    });
+}
+
+void viewRaise(QQuickView_ *view)
+{
+    reinterpret_cast<QQuickWindow *>(view)->raise();
+}
+
+void viewRequestActivate(QQuickView_ *view)
+{
+    reinterpret_cast<QQuickWindow *>(view)->requestActivate();
+}
+
+int viewIsActive(QQuickView_ *view)
+{
+    return reinterpret_cast<QQuickWindow *>(view)->isActive();
+}
+
+// screenInfo fills info with the details of screen. Geometries are in
+// logical pixels, as used for window positions and sizes.
+static void screenInfo(QScreen *screen, ScreenInfo *info)
+{
+    QRect geometry = screen->geometry();
+    QRect available = screen->availableGeometry();
+    info->name = local_strdup(screen->name().toUtf8().constData());
+    info->x = geometry.x();
+    info->y = geometry.y();
+    info->width = geometry.width();
+    info->height = geometry.height();
+    info->availableX = available.x();
+    info->availableY = available.y();
+    info->availableWidth = available.width();
+    info->availableHeight = available.height();
+    info->devicePixelRatio = screen->devicePixelRatio();
+    info->refreshRate = screen->refreshRate();
+    info->logicalDpi = screen->logicalDotsPerInch();
+    info->physicalDpi = screen->physicalDotsPerInch();
+    info->primary = screen == QGuiApplication::primaryScreen();
+}
+
+int applicationScreenCount()
+{
+    return QGuiApplication::screens().size();
+}
+
+void applicationScreen(int index, ScreenInfo *info)
+{
+    screenInfo(QGuiApplication::screens().at(index), info);
+}
+
+void applicationWatchScreens()
+{
+    QObject::connect(qApp, &QGuiApplication::screenAdded, [=](QScreen *) {
+        hookScreensChanged();
+    });
+    QObject::connect(qApp, &QGuiApplication::screenRemoved, [=](QScreen *) {
+        hookScreensChanged();
+    });
+    QObject::connect(qApp, &QGuiApplication::primaryScreenChanged, [=](QScreen *) {
+        hookScreensChanged();
+    });
+}
+
+void viewScreen(QQuickView_ *view, ScreenInfo *info)
+{
+    QQuickWindow *window = reinterpret_cast<QQuickWindow *>(view);
+    QScreen *screen = window->screen();
+    if (!screen) {
+        screen = QGuiApplication::primaryScreen();
+    }
+    screenInfo(screen, info);
+}
+
+int viewSetScreen(QQuickView_ *view, const char *name, int nameLen)
+{
+    QQuickWindow *window = reinterpret_cast<QQuickWindow *>(view);
+    QString qname = QString::fromUtf8(name, nameLen);
+    QScreen *target = 0;
+    foreach (QScreen *screen, QGuiApplication::screens()) {
+        if (screen->name() == qname) {
+            target = screen;
+            break;
+        }
+    }
+    if (!target) {
+        return 0;
+    }
+    QScreen *current = window->screen();
+    if (current == target) {
+        return 1;
+    }
+    // Changing the screen alone does not move a visible window on most
+    // platforms, so the window keeps its offset within the available
+    // area, constrained to the area of the new screen.
+    QRect from = current ? current->availableGeometry() : QRect();
+    QRect to = target->availableGeometry();
+    QPoint offset = window->position() - from.topLeft();
+    offset.setX(qBound(0, offset.x(), qMax(0, to.width() - window->width())));
+    offset.setY(qBound(0, offset.y(), qMax(0, to.height() - window->height())));
+    window->setScreen(target);
+    window->setPosition(to.topLeft() + offset);
+    return 1;
+}
+
+// showDialog shows dialog as a modal dialog over parent, if provided,
+// and deletes it once it is finished.
+static void showDialog(QDialog *dialog, QQuickView_ *parent)
+{
+    dialog->setAttribute(Qt::WA_DeleteOnClose);
+    if (parent) {
+        // The dialog has no parent widget to be transient for, so the
+        // parent view is set directly on its window.
+        dialog->winId();
+        dialog->windowHandle()->setTransientParent(reinterpret_cast<QQuickView *>(parent));
+        dialog->setWindowModality(Qt::WindowModal);
+    } else {
+        dialog->setWindowModality(Qt::ApplicationModal);
+    }
+    dialog->show();
+}
+
+void fileDialogOpen(QQuickView_ *parent, GoAddr *addr, const char *title, int titleLen, const char *dir, int dirLen, const char *filters, int filtersLen, int mode)
+{
+    QFileDialog *dialog = new QFileDialog(0, QString::fromUtf8(title, titleLen), QString::fromUtf8(dir, dirLen));
+    if (filtersLen > 0) {
+        dialog->setNameFilters(QString::fromUtf8(filters, filtersLen).split(";;"));
+    }
+    switch (mode) {
+    case 0:
+        dialog->setFileMode(QFileDialog::ExistingFile);
+        break;
+    case 1:
+        dialog->setFileMode(QFileDialog::ExistingFiles);
+        break;
+    case 2:
+        dialog->setFileMode(QFileDialog::AnyFile);
+        dialog->setAcceptMode(QFileDialog::AcceptSave);
+        break;
+    }
+    QObject::connect(dialog, &QDialog::finished, [=](int result) {
+        // Paths are separated by NUL, as no path may hold it.
+        QByteArray paths;
+        if (result == QDialog::Accepted) {
+            paths = dialog->selectedFiles().join(QChar(0)).toUtf8();
+        }
+        hookDialogFinished(addr, result, paths.data(), paths.size());
+    });
+    showDialog(dialog, parent);
+}
+
+void messageBoxOpen(QQuickView_ *parent, GoAddr *addr, const char *title, int titleLen, const char *text, int textLen, int icon, int buttons)
+{
+    QMessageBox *dialog = new QMessageBox(QMessageBox::Icon(icon), QString::fromUtf8(title, titleLen), QString::fromUtf8(text, textLen), QMessageBox::StandardButtons(buttons));
+    QObject::connect(dialog, &QDialog::finished, [=](int) {
+        hookDialogFinished(addr, dialog->standardButton(dialog->clickedButton()), 0, 0);
+    });
+    showDialog(dialog, parent);
+}
+
+GoLazyModel_ *newLazyModel(GoAddr *addr)
+{
+    return new GoLazyModel(addr, 0);
+}
+
+void lazyModelSetPageSize(GoLazyModel_ *model, int size)
+{
+    reinterpret_cast<GoLazyModel *>(model)->setPageSize(size);
+}
+
+void lazyModelInvalidate(GoLazyModel_ *model, int offset, int count)
+{
+    reinterpret_cast<GoLazyModel *>(model)->invalidate(offset, count);
+}
+
+void lazyModelRefresh(GoLazyModel_ *model)
 {
-    reinterpret_cast<QQuickView *>(view)->show();
+    reinterpret_cast<GoLazyModel *>(model)->refresh();
 }
 
-void viewHide(QQuickView_ *view)
+GoListModel_ *newListModel(GoAddr *addr, const char *roles, int rolesLen)
 {
-    reinterpret_cast<QQuickView *>(view)->hide();
+    QList<QByteArray> qroles;
+    if (rolesLen > 0) {
+        qroles = QByteArray(roles, rolesLen).split(',');
+    }
+    return new GoListModel(addr, qroles, 0);
 }
 
-void viewConnectHidden(QQuickView_ *view)
+void listModelBeginInsert(GoListModel_ *model, int first, int last)
 {
-    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
-    QObject::connect(qview, &QWindow::visibleChanged, [=](bool visible){
-        if (!visible) {
-            hookWindowHidden(view);
-        }
-    });
+    reinterpret_cast<GoListModel *>(model)->beginInsert(first, last);
 }
 
-QObject_ *viewRootObject(QQuickView_ *view)
+void listModelEndInsert(GoListModel_ *model)
 {
-    QQuickView *qview = reinterpret_cast<QQuickView *>(view);
-    return qview->rootObject();
+    reinterpret_cast<GoListModel *>(model)->endInsert();
 }
 
-void contextSetObject(QQmlContext_ *context, QObject_ *value)
+void listModelBeginRemove(GoListModel_ *model, int first, int last)
 {
-    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
-    QObject *qvalue = reinterpret_cast<QObject *>(value);
+    reinterpret_cast<GoListModel *>(model)->beginRemove(first, last);
+}
 
-    // Give qvalue an engine reference if it doesn't yet have one.
-    if (!qmlEngine(qvalue)) {
-        QQmlEngine::setContextForObject(qvalue, qcontext->engine()->rootContext());
-    }
+void listModelEndRemove(GoListModel_ *model)
+{
+    reinterpret_cast<GoListModel *>(model)->endRemove();
+}
 
-    qcontext->setContextObject(qvalue);
+void listModelChanged(GoListModel_ *model, int first, int last)
+{
+    reinterpret_cast<GoListModel *>(model)->changed(first, last);
 }
 
-void contextSetProperty(QQmlContext_ *context, QString_ *name, DataValue *value)
+void listModelBeginReset(GoListModel_ *model)
 {
-    const QString *qname = reinterpret_cast<QString *>(name);
-    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
+    reinterpret_cast<GoListModel *>(model)->beginReset();
+}
 
-    QVariant var;
-    unpackDataValue(value, &var);
+void listModelEndReset(GoListModel_ *model)
+{
+    reinterpret_cast<GoListModel *>(model)->endReset();
+}
 
-    // Give qvalue an engine reference if it doesn't yet have one .
-    QObject *obj = var.value<QObject *>();
-    if (obj && !qmlEngine(obj)) {
-        QQmlEngine::setContextForObject(obj, qcontext);
+GoTableModel_ *newTableModel(GoAddr *addr, const char *roles, int rolesLen)
+{
+    QList<QByteArray> qroles;
+    if (rolesLen > 0) {
+        qroles = QByteArray(roles, rolesLen).split(',');
     }
-
-    qcontext->setContextProperty(*qname, var);
+    return new GoTableModel(addr, qroles, 0);
 }
 
-void contextGetProperty(QQmlContext_ *context, QString_ *name, DataValue *result)
+void tableModelBeginInsert(GoTableModel_ *model, int first, int last)
 {
-    QQmlContext *qcontext = reinterpret_cast<QQmlContext *>(context);
-    const QString *qname = reinterpret_cast<QString *>(name);
-
-    QVariant var = qcontext->contextProperty(*qname);
-    packDataValue(&var, result);
+    reinterpret_cast<GoTableModel *>(model)->beginInsert(first, last);
 }
 
-void delObject(QObject_ *object)
+void tableModelEndInsert(GoTableModel_ *model)
 {
-    delete reinterpret_cast<QObject *>(object);
+    reinterpret_cast<GoTableModel *>(model)->endInsert();
 }
 
-void delObjectLater(QObject_ *object)
+void tableModelBeginRemove(GoTableModel_ *model, int first, int last)
 {
-    reinterpret_cast<QObject *>(object)->deleteLater();
+    reinterpret_cast<GoTableModel *>(model)->beginRemove(first, last);
 }
 
-int objectGetProperty(QObject_ *object, const char *name, DataValue *result)
+void tableModelEndRemove(GoTableModel_ *model)
 {
-    QObject *qobject = reinterpret_cast<QObject *>(object);
-    
-    QVariant var = qobject->property(name);
-    packDataValue(&var, result);
+    reinterpret_cast<GoTableModel *>(model)->endRemove();
+}
 
-    if (!var.isValid() && qobject->metaObject()->indexOfProperty(name) == -1) {
-            // TODO May have to check the dynamic property names too.
-            return 0;
-    }
-    return 1;
+void tableModelChanged(GoTableModel_ *model, int first, int last)
+{
+    reinterpret_cast<GoTableModel *>(model)->changed(first, last);
 }
 
-void objectSetProperty(QObject_ *object, const char *name, DataValue *value)
+void tableModelBeginReset(GoTableModel_ *model)
 {
-    QObject *qobject = reinterpret_cast<QObject *>(object);
-    QVariant var;
-    unpackDataValue(value, &var);
+    reinterpret_cast<GoTableModel *>(model)->beginReset();
+}
 
-    // Give qvalue an engine reference if it doesn't yet have one.
-    QObject *obj = var.value<QObject *>();
-    if (obj && !qmlEngine(obj)) {
-        QQmlContext *context = qmlContext(qobject);
-        if (context) {
-            QQmlEngine::setContextForObject(obj, context);
-        }
-    }
+void tableModelEndReset(GoTableModel_ *model)
+{
+    reinterpret_cast<GoTableModel *>(model)->endReset();
+}
 
-    qobject->setProperty(name, var);
+void tableModelBeginLayout(GoTableModel_ *model)
+{
+    reinterpret_cast<GoTableModel *>(model)->beginLayout();
 }
 
-void objectInvoke(QObject_ *object, const char *method, DataValue *resultdv, DataValue *paramsdv, int paramsLen)
+void tableModelEndLayout(GoTableModel_ *model, int *newRows, int len)
 {
-    QObject *qobject = reinterpret_cast<QObject *>(object);
+    reinterpret_cast<GoTableModel *>(model)->endLayout(newRows, len);
+}
 
-    QVariant result;
-    QVariant param[MaximumParamCount-1];
-    QGenericArgument arg[MaximumParamCount-1];
-    for (int i = 0; i < paramsLen; i++) {
-        unpackDataValue(&paramsdv[i], &param[i]);
-        arg[i] = Q_ARG(QVariant, param[i]);
-    }
-    if (paramsLen > 10) {
-        qFatal("fix the parameter dispatching");
-    }
-    bool ok = QMetaObject::invokeMethod(qobject, method, Qt::DirectConnection, 
-            Q_RETURN_ARG(QVariant, result),
-            arg[0], arg[1], arg[2], arg[3], arg[4], arg[5], arg[6], arg[7], arg[8], arg[9]);
-    if (!ok) {
-        // TODO Find out how to tell if a result is available or not without calling it twice.
-        ok = QMetaObject::invokeMethod(qobject, method, Qt::DirectConnection, 
-            arg[0], arg[1], arg[2], arg[3], arg[4], arg[5], arg[6], arg[7], arg[8], arg[9]);
-    }
-    packDataValue(&result, resultdv);
+QQmlPropertyMap_ *newStore(GoAddr *addr)
+{
+    QQmlPropertyMap *store = new QQmlPropertyMap();
+    // valueChanged is only emitted for changes made by QML code.
+    QObject::connect(store, &QQmlPropertyMap::valueChanged, [=](const QString &key, const QVariant &value) {
+        QByteArray qkey = key.toUtf8();
+        QVariant var = value;
+        DataValue dvalue;
+        packDataValue(&var, &dvalue);
+        hookStoreChanged(addr, qkey.constData(), qkey.size(), &dvalue);
+    });
+    return store;
 }
 
-void objectFindChild(QObject_ *object, QString_ *name, DataValue *resultdv)
+void storeInsert(QQmlPropertyMap_ *store, QString_ *key, DataValue *value)
 {
-    QObject *qobject = reinterpret_cast<QObject *>(object);
-    QString *qname = reinterpret_cast<QString *>(name);
-    
+    QQmlPropertyMap *qstore = reinterpret_cast<QQmlPropertyMap *>(store);
+    QString *qkey = reinterpret_cast<QString *>(key);
     QVariant var;
-    QObject *result = qobject->findChild<QObject *>(*qname);
-    if (result) {
-        var.setValue(result);
-    }
-    packDataValue(&var, resultdv);
+    unpackDataValue(value, &var);
+    qstore->insert(*qkey, var);
 }
 
-void objectSetParent(QObject_ *object, QObject_ *parent)
+QSettings_ *newSettings(const char *organization, int organizationLen, const char *application, int applicationLen)
 {
-    QObject *qobject = reinterpret_cast<QObject *>(object);
-    QObject *qparent = reinterpret_cast<QObject *>(parent);
-
-    qobject->setParent(qparent);
+    if (organizationLen == 0 && applicationLen == 0) {
+        // Same as Qt.labs.settings, which uses the application names.
+        return new QSettings();
+    }
+    return new QSettings(QString::fromUtf8(organization, organizationLen), QString::fromUtf8(application, applicationLen));
 }
 
-QQmlContext_ *objectContext(QObject_ *object)
+int settingsValue(QSettings_ *settings, const char *key, int keyLen, DataValue *result)
 {
-    return qmlContext(reinterpret_cast<QObject *>(object));
+    QSettings *qsettings = reinterpret_cast<QSettings *>(settings);
+    QString qkey = QString::fromUtf8(key, keyLen);
+    if (!qsettings->contains(qkey)) {
+        return 0;
+    }
+    QVariant var = qsettings->value(qkey);
+    packDataValue(&var, result);
+    return 1;
 }
 
-int objectIsComponent(QObject_ *object)
+void settingsSetValue(QSettings_ *settings, const char *key, int keyLen, DataValue *value)
 {
-    QObject *qobject = reinterpret_cast<QObject *>(object);
-    return dynamic_cast<QQmlComponent *>(qobject) ? 1 : 0;
+    QVariant var;
+    unpackDataValue(value, &var);
+    reinterpret_cast<QSettings *>(settings)->setValue(QString::fromUtf8(key, keyLen), var);
 }
 
-QString_ *newString(const char *data, int len)
+void settingsRemove(QSettings_ *settings, const char *key, int keyLen)
 {
-    // This will copy data only once.
-    QByteArray ba = QByteArray::fromRawData(data, len);
-    return new QString(ba);
+    reinterpret_cast<QSettings *>(settings)->remove(QString::fromUtf8(key, keyLen));
 }
 
-void delString(QString_ *s)
+char *settingsChildren(QSettings_ *settings, const char *group, int groupLen, int groups)
 {
-    delete reinterpret_cast<QString *>(s);
+    QSettings *qsettings = reinterpret_cast<QSettings *>(settings);
+    qsettings->beginGroup(QString::fromUtf8(group, groupLen));
+    QStringList names = groups ? qsettings->childGroups() : qsettings->childKeys();
+    qsettings->endGroup();
+    return local_strdup(names.join("\n").toUtf8().constData());
 }
 
-GoValue_ *newGoValue(GoAddr *addr, GoTypeInfo *typeInfo, QObject_ *parent)
+int settingsSync(QSettings_ *settings)
 {
-    QObject *qparent = reinterpret_cast<QObject *>(parent);
-    return new GoValue(addr, typeInfo, qparent);
+    QSettings *qsettings = reinterpret_cast<QSettings *>(settings);
+    qsettings->sync();
+    return qsettings->status();
 }
 
-void goValueActivate(GoValue_ *value, GoTypeInfo *typeInfo, int addrOffset)
+void storeClear(QQmlPropertyMap_ *store, QString_ *key)
 {
-    GoMemberInfo *fieldInfo = typeInfo->fields;
-    for (int i = 0; i < typeInfo->fieldsLen; i++) {
-        if (fieldInfo->addrOffset == addrOffset) {
-            reinterpret_cast<GoValue *>(value)->activate(fieldInfo->metaIndex);
-            return;
-        }
-        fieldInfo++;
-    }
+    QQmlPropertyMap *qstore = reinterpret_cast<QQmlPropertyMap *>(store);
+    QString *qkey = reinterpret_cast<QString *>(key);
+    qstore->clear(*qkey);
+}
 
-    // TODO Return an error; probably an unexported field.
+QValidator_ *newValidator(GoAddr *addr)
+{
+    return new GoValidator(addr, 0);
 }
 
 template<int N>
-void registerSingletonN(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec) {
+int registerSingletonN(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec) {
     GoValueType<N>::init(info, spec);
-    qmlRegisterSingletonType< GoValueType<N> >(location, major, minor, name, [](QQmlEngine *qmlEngine, QJSEngine *jsEngine) -> QObject* {
+    return qmlRegisterSingletonType< GoValueType<N> >(location, major, minor, name, [](QQmlEngine *qmlEngine, QJSEngine *jsEngine) -> QObject* {
         QObject *singleton = new GoValueType<N>();
         QQmlEngine::setContextForObject(singleton, qmlEngine->rootContext());
         return singleton;
     });
 }
 
-void registerSingleton(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec)
+template<int N>
+int registerTypeN(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec) {
+    GoValueType<N>::init(info, spec);
+    return qmlRegisterType< GoValueType<N> >(location, major, minor, name);
+}
+
+template<int N>
+int registerPaintedTypeN(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec) {
+    GoPaintedValueType<N>::init(info, spec);
+    return qmlRegisterType< GoPaintedValueType<N> >(location, major, minor, name);
+}
+
+template<int N>
+int registerGLTypeN(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec, int stage) {
+    GoGLValueType<N>::init(info, spec, stage);
+    return qmlRegisterType< GoGLValueType<N> >(location, major, minor, name);
+}
+
+typedef int (*registerFunc)(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec);
+
+#define REGISTER_SINGLETON_FUNC(N) registerSingletonN<N>,
+#define REGISTER_TYPE_FUNC(N) registerTypeN<N>,
+#define REGISTER_PAINTED_TYPE_FUNC(N) registerPaintedTypeN<N>,
+
+static registerFunc registerSingletonFuncs[] = { GOVALUETYPE_FOREACH(REGISTER_SINGLETON_FUNC) };
+static registerFunc registerTypeFuncs[] = { GOVALUETYPE_FOREACH(REGISTER_TYPE_FUNC) };
+static registerFunc registerPaintedTypeFuncs[] = { GOVALUETYPE_FOREACH(REGISTER_PAINTED_TYPE_FUNC) };
+
+// Each registration uses the next GoValueType instance, shared by
+// registered types and singletons.
+static unsigned int registeredTypes = 0;
+
+int registerSingleton(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec)
+{
+    if (registeredTypes >= sizeof(registerSingletonFuncs) / sizeof(registerFunc)) {
+        return RegisterTooMany;
+    }
+    if (registerSingletonFuncs[registeredTypes++](location, major, minor, name, info, spec) < 0) {
+        return RegisterFailed;
+    }
+    return RegisterOK;
+}
+
+int registerType(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec)
+{
+    if (registeredTypes >= sizeof(registerTypeFuncs) / sizeof(registerFunc)) {
+        return RegisterTooMany;
+    }
+    if (registerTypeFuncs[registeredTypes++](location, major, minor, name, info, spec) < 0) {
+        return RegisterFailed;
+    }
+    return RegisterOK;
+}
+
+// Painted types use their own GoPaintedValueType instances.
+static unsigned int registeredPaintedTypes = 0;
+
+int registerPaintedType(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec)
+{
+    if (registeredPaintedTypes >= sizeof(registerPaintedTypeFuncs) / sizeof(registerFunc)) {
+        return RegisterTooMany;
+    }
+    if (registerPaintedTypeFuncs[registeredPaintedTypes++](location, major, minor, name, info, spec) < 0) {
+        return RegisterFailed;
+    }
+    return RegisterOK;
+}
+
+typedef int (*registerGLFunc)(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec, int stage);
+
+#define REGISTER_GL_TYPE_FUNC(N) registerGLTypeN<N>,
+
+static registerGLFunc registerGLTypeFuncs[] = { GOVALUETYPE_FOREACH(REGISTER_GL_TYPE_FUNC) };
+
+// GL types use their own GoGLValueType instances.
+static unsigned int registeredGLTypes = 0;
+
+int registerGLType(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec, int stage)
 {
-    // TODO Must increment the number and use different types per call.
-    registerSingletonN<1>(location, major, minor, name, info, spec);
+    if (registeredGLTypes >= sizeof(registerGLTypeFuncs) / sizeof(registerGLFunc)) {
+        return RegisterTooMany;
+    }
+    if (registerGLTypeFuncs[registeredGLTypes++](location, major, minor, name, info, spec, stage) < 0) {
+        return RegisterFailed;
+    }
+    return RegisterOK;
 }
 
-void registerType(char *location, int major, int minor, char *name, GoTypeInfo *info, GoTypeSpec_ *spec)
+int registerComponent(const char *url, int urlLen, char *location, int major, int minor, char *name)
 {
-    // TODO Must increment the number and use different types per call.
-    GoValueType<1>::init(info, spec);
-    qmlRegisterType< GoValueType<1> >(location, major, minor, name);
+    QUrl qurl(QString::fromUtf8(url, urlLen));
+    if (qmlRegisterType(qurl, location, major, minor, name) < 0) {
+        return RegisterFailed;
+    }
+    return RegisterOK;
 }
 
 void unpackDataValue(DataValue *value, QVariant_ *var)
@@ -365,6 +3464,9 @@ void unpackDataValue(DataValue *value, QVariant_ *var)
     case DTString:
         *qvar = QString::fromUtf8(*(char **)value->data, value->len);
         break;
+    case DTBytes:
+        *qvar = QByteArray(*(char **)value->data, value->len);
+        break;
     case DTBool:
         *qvar = bool(*(char *)(value->data) != 0);
         break;
@@ -380,10 +3482,47 @@ void unpackDataValue(DataValue *value, QVariant_ *var)
     case DTFloat32:
         *qvar = *(float*)(value->data);
         break;
+    case DTJSValue:
+        {
+            QJSValue *jsvalue = *(QJSValue **)(value->data);
+            *qvar = QVariant::fromValue(*jsvalue);
+            delete jsvalue;
+            break;
+        }
+    case DTJSON:
+        {
+            // Wrapped in an array as QJsonDocument can't hold scalars.
+            QByteArray json = "[" + QByteArray(*(char **)value->data, value->len) + "]";
+            *qvar = QJsonDocument::fromJson(json).array().at(0).toVariant();
+            break;
+        }
+    case DTTime:
+        {
+            QDateTime t = QDateTime::fromMSecsSinceEpoch(*(qint64*)(value->data));
+            if (value->len == 0) {
+                t = t.toUTC();
+            } else if (value->len != LocalTimeOffset) {
+#if QT_VERSION >= QT_VERSION_CHECK(5, 2, 0)
+                t = t.toOffsetFromUtc(value->len);
+#else
+                t = t.toUTC().addSecs(value->len);
+                t.setUtcOffset(value->len);
+#endif
+            }
+            *qvar = t;
+            break;
+        }
+    case DTColor:
+        *qvar = QColor::fromRgba(*(QRgb*)(value->data));
+        break;
     case DTList:
         *qvar = **(QVariantList**)(value->data);
         delete *(QVariantList**)(value->data);
         break;
+    case DTMap:
+        *qvar = **(QVariantMap**)(value->data);
+        delete *(QVariantMap**)(value->data);
+        break;
     case DTObject:
         qvar->setValue(*(QObject**)(value->data));
         break;
@@ -399,10 +3538,151 @@ void unpackDataValue(DataValue *value, QVariant_ *var)
     }
 }
 
+// typedArrayTypes maps the names of JavaScript typed array constructors
+// to the data types their elements are packed as.
+static const struct {
+    const char *name;
+    DataType dataType;
+    int size;
+} typedArrayTypes[] = {
+    {"Int8Array", DTInt8Array, 1},
+    {"Uint8Array", DTUint8Array, 1},
+    {"Uint8ClampedArray", DTUint8Array, 1},
+    {"Int16Array", DTInt16Array, 2},
+    {"Uint16Array", DTUint16Array, 2},
+    {"Int32Array", DTInt32Array, 4},
+    {"Uint32Array", DTUint32Array, 4},
+    {"Float32Array", DTFloat32Array, 4},
+    {"Float64Array", DTFloat64Array, 8},
+};
+
+static double typedArrayElement(DataType dataType, void *data, int i)
+{
+    switch (dataType) {
+    case DTInt8Array: return ((qint8 *)data)[i];
+    case DTUint8Array: return ((quint8 *)data)[i];
+    case DTInt16Array: return ((qint16 *)data)[i];
+    case DTUint16Array: return ((quint16 *)data)[i];
+    case DTInt32Array: return ((qint32 *)data)[i];
+    case DTUint32Array: return ((quint32 *)data)[i];
+    case DTFloat32Array: return ((float *)data)[i];
+    case DTFloat64Array: return ((double *)data)[i];
+    default: qFatal("not a typed array data type: %d", dataType);
+    }
+    return 0;
+}
+
+static void setTypedArrayElement(DataType dataType, void *data, int i, double element)
+{
+    switch (dataType) {
+    case DTInt8Array: ((qint8 *)data)[i] = (qint8)element; break;
+    case DTUint8Array: ((quint8 *)data)[i] = (quint8)element; break;
+    case DTInt16Array: ((qint16 *)data)[i] = (qint16)element; break;
+    case DTUint16Array: ((quint16 *)data)[i] = (quint16)element; break;
+    case DTInt32Array: ((qint32 *)data)[i] = (qint32)element; break;
+    case DTUint32Array: ((quint32 *)data)[i] = (quint32)element; break;
+    case DTFloat32Array: ((float *)data)[i] = (float)element; break;
+    case DTFloat64Array: ((double *)data)[i] = element; break;
+    default: qFatal("not a typed array data type: %d", dataType);
+    }
+}
+
+// packTypedArray packs jsvalue into value if it's a JavaScript typed
+// array, and returns whether it was.
+static bool packTypedArray(const QJSValue &jsvalue, DataValue *value)
+{
+    if (!jsvalue.isObject() || jsvalue.isArray()) {
+        return false;
+    }
+    QString name = jsvalue.property("constructor").property("name").toString();
+    for (size_t t = 0; t < sizeof(typedArrayTypes)/sizeof(typedArrayTypes[0]); t++) {
+        if (name != typedArrayTypes[t].name) {
+            continue;
+        }
+        int len = jsvalue.property("length").toInt();
+        void *data = malloc(typedArrayTypes[t].size * (len > 0 ? len : 1));
+        for (int i = 0; i < len; i++) {
+            setTypedArrayElement(typedArrayTypes[t].dataType, data, i, jsvalue.property(i).toNumber());
+        }
+        value->dataType = typedArrayTypes[t].dataType;
+        *(void **)(value->data) = data;
+        value->len = len;
+        return true;
+    }
+    return false;
+}
+
+// packRegExp packs the regular expression with the provided pattern and
+// JavaScript flags into value.
+static void packRegExp(const QString &pattern, const QString &flags, DataValue *value)
+{
+    packByteArray(DTRegExp, ("/" + pattern + "/" + flags).toUtf8(), value);
+}
+
+void *engineNewTypedArray(QQmlEngine_ *engine, DataType dataType, void *data, int len)
+{
+    QQmlEngine *qengine = reinterpret_cast<QQmlEngine *>(engine);
+    QJSValue array;
+    for (size_t t = 0; t < sizeof(typedArrayTypes)/sizeof(typedArrayTypes[0]); t++) {
+        if (typedArrayTypes[t].dataType == dataType) {
+            QJSValue ctor = qengine->globalObject().property(typedArrayTypes[t].name);
+            if (ctor.isCallable()) {
+                array = ctor.callAsConstructor(QJSValueList() << len);
+            }
+            break;
+        }
+    }
+    if (!array.isObject()) {
+        // The JavaScript engine has no typed arrays.
+        array = qengine->newArray(len);
+    }
+    for (int i = 0; i < len; i++) {
+        array.setProperty(i, typedArrayElement(dataType, data, i));
+    }
+    return new QJSValue(array);
+}
+
 void packDataValue(QVariant_ *var, DataValue *value)
 {
     QVariant *qvar = reinterpret_cast<QVariant *>(var);
 
+    if (qvar->userType() == qMetaTypeId<QJSValue>()) {
+        // Values from var properties, such as JavaScript arrays.
+        QJSValue jsvalue = qvar->value<QJSValue>();
+        if (jsvalue.isRegExp()) {
+            QString flags;
+            if (jsvalue.property("global").toBool()) {
+                flags += 'g';
+            }
+            if (jsvalue.property("ignoreCase").toBool()) {
+                flags += 'i';
+            }
+            if (jsvalue.property("multiline").toBool()) {
+                flags += 'm';
+            }
+            packRegExp(jsvalue.property("source").toString(), flags, value);
+            return;
+        }
+        if (packTypedArray(jsvalue, value)) {
+            return;
+        }
+        QVariant converted = jsvalue.toVariant();
+        packDataValue(&converted, value);
+        return;
+    }
+
+    if (qvar->userType() == qMetaTypeId<QList<QUrl> >()) {
+        // Url lists, such as the ones of drag events, hold local files as paths.
+        QList<QUrl> urls = qvar->value<QList<QUrl> >();
+        QVariantList paths;
+        for (int i = 0; i < urls.size(); i++) {
+            paths.append(urls[i].isLocalFile() ? urls[i].toLocalFile() : urls[i].toString());
+        }
+        QVariant converted(paths);
+        packDataValue(&converted, value);
+        return;
+    }
+
     // Some assumptions are made below regarding the size of types.
     // There's apparently no better way to handle this since that's
     // how the types with well defined sizes (qint64) are mapped to
@@ -412,13 +3692,11 @@ void packDataValue(QVariant_ *var, DataValue *value)
         value->dataType = DTInvalid;
         break;
     case QMetaType::QString:
-        {
-            value->dataType = DTString;
-            QByteArray ba = qvar->toByteArray();
-            *(char**)(value->data) = local_strdup(ba.constData());
-            value->len = ba.size();
-            break;
-        }
+        packByteArray(DTString, qvar->toString().toUtf8(), value);
+        break;
+    case QMetaType::QByteArray:
+        packByteArray(DTBytes, qvar->toByteArray(), value);
+        break;
     case QMetaType::Bool:
         value->dataType = DTBool;
         *(qint8*)(value->data) = (qint8)qvar->toInt();
@@ -439,13 +3717,103 @@ void packDataValue(QVariant_ *var, DataValue *value)
         value->dataType = DTFloat32;
         *(float*)(value->data) = qvar->toFloat();
         break;
+    case QMetaType::QDate:
+    case QMetaType::QDateTime:
+        {
+            // Dates are taken as local midnight, as done by QML itself.
+            QDateTime t = qvar->toDateTime();
+            value->dataType = DTTime;
+            *(qint64*)(value->data) = t.toMSecsSinceEpoch();
+            switch (t.timeSpec()) {
+            case Qt::UTC:
+                value->len = 0;
+                break;
+            case Qt::OffsetFromUTC:
+#if QT_VERSION >= QT_VERSION_CHECK(5, 2, 0)
+                value->len = t.offsetFromUtc();
+#else
+                value->len = t.utcOffset();
+#endif
+                break;
+            default:
+                value->len = LocalTimeOffset;
+                break;
+            }
+            break;
+        }
+    case QMetaType::QColor:
+        value->dataType = DTColor;
+        *(QRgb*)(value->data) = qvar->value<QColor>().rgba();
+        break;
+    case QMetaType::QRegExp:
+        {
+            QRegExp re = qvar->toRegExp();
+            packRegExp(re.pattern(), re.caseSensitivity() == Qt::CaseInsensitive ? "i" : "", value);
+            break;
+        }
+    case QMetaType::QRegularExpression:
+        {
+            QRegularExpression re = qvar->toRegularExpression();
+            QString flags;
+            if (re.patternOptions() & QRegularExpression::CaseInsensitiveOption) {
+                flags += 'i';
+            }
+            if (re.patternOptions() & QRegularExpression::MultilineOption) {
+                flags += 'm';
+            }
+            if (re.patternOptions() & QRegularExpression::DotMatchesEverythingOption) {
+                flags += 's';
+            }
+            packRegExp(re.pattern(), flags, value);
+            break;
+        }
+    case QMetaType::QUrl:
+        packByteArray(DTString, qvar->toUrl().toString().toUtf8(), value);
+        break;
+    case QMetaType::QStringList:
+    case QMetaType::QVariantList:
+        {
+            QVariantList list = qvar->toList();
+            DataValue *values = (DataValue *)malloc(sizeof(DataValue) * list.size());
+            for (int i = 0; i < list.size(); i++) {
+                packDataValue(&list[i], &values[i]);
+            }
+            value->dataType = DTValues;
+            *(DataValue **)(value->data) = values;
+            value->len = list.size();
+            break;
+        }
+    case QMetaType::QVariantMap:
+        {
+            QVariantMap map = qvar->toMap();
+            DataValue *pairs = (DataValue *)malloc(sizeof(DataValue) * map.size() * 2);
+            int i = 0;
+            for (QVariantMap::const_iterator it = map.constBegin(); it != map.constEnd(); ++it, i += 2) {
+                QVariant key(it.key());
+                QVariant item(it.value());
+                packDataValue(&key, &pairs[i]);
+                packDataValue(&item, &pairs[i+1]);
+            }
+            value->dataType = DTPairs;
+            *(DataValue **)(value->data) = pairs;
+            value->len = map.size();
+            break;
+        }
     case QMetaType::QObjectStar:
         {
             QObject *qobject = qvar->value<QObject *>();
             GoValue *govalue = dynamic_cast<GoValue *>(qobject);
+            GoPaintedValue *painted = dynamic_cast<GoPaintedValue *>(qobject);
+            GoGLValue *gl = dynamic_cast<GoGLValue *>(qobject);
             if (govalue) {
                 value->dataType = DTGoAddr;
                 *(void **)(value->data) = govalue->addr();
+            } else if (painted) {
+                value->dataType = DTGoAddr;
+                *(void **)(value->data) = painted->addr();
+            } else if (gl) {
+                value->dataType = DTGoAddr;
+                *(void **)(value->data) = gl->addr();
             } else {
                 value->dataType = DTObject;
                 *(void **)(value->data) = qobject;
@@ -454,6 +3822,12 @@ void packDataValue(QVariant_ *var, DataValue *value)
         }
         // fallthrough
     default:
+        if (QMetaType::typeFlags(qvar->userType()) & QMetaType::IsEnumeration) {
+            // Enum values of properties declared with an enum type.
+            value->dataType = DTInt32;
+            *(qint32*)(value->data) = *reinterpret_cast<const qint32 *>(qvar->constData());
+            break;
+        }
         qFatal("Unsupported variant type: %d", qvar->type());
         break;
     }
@@ -471,10 +3845,25 @@ QVariantList_ *newVariantList(DataValue *list, int len)
     return vlist;
 }
 
+QVariantMap_ *newVariantMap(DataValue *pairs, int len)
+{
+    QVariantMap *vmap = new QVariantMap();
+    for (int i = 0; i < len; i++) {
+        QVariant key, value;
+        unpackDataValue(&pairs[i*2], &key);
+        unpackDataValue(&pairs[i*2+1], &value);
+        vmap->insert(key.toString(), value);
+    }
+    return vmap;
+}
+
 void internalLogHandler(QtMsgType severity, const QMessageLogContext &context, const QString &text)
 {
     QByteArray textba = text.toUtf8();
-    LogMessage message = {severity, textba.constData(), textba.size(), context.file, (int)strlen(context.file), context.line};
+    // The context is only filled in debug builds of Qt, but the warnings
+    // reported by QML engines carry their location anyway.
+    const char *file = context.file ? context.file : "";
+    LogMessage message = {severity, textba.constData(), textba.size(), file, (int)strlen(file), context.line};
     hookLogHandler(&message);
 }
 
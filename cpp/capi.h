@@ -17,36 +17,143 @@ typedef void QMetaObject_;
 typedef void QObject_;
 typedef void QVariant_;
 typedef void QVariantList_;
+typedef void QVariantMap_;
 typedef void QString_;
+typedef void QByteArray_;
 typedef void QQmlEngine_;
 typedef void QQmlContext_;
 typedef void QQmlComponent_;
+typedef void QQmlIncubator_;
 typedef void QQuickView_;
+typedef void QSettings_;
 typedef void QMessageLogContext_;
 typedef void GoValue_;
 typedef void GoAddr;
 typedef void GoTypeSpec_;
+typedef void QValidator_;
+typedef void QMenu_;
+typedef void QSystemTrayIcon_;
+typedef void GoLazyModel_;
+typedef void GoListModel_;
+typedef void GoTableModel_;
+typedef void QQmlPropertyMap_;
+typedef void QImage_;
+typedef void QPainter_;
 
 typedef enum {
     DTUnknown = 0, // Has an unsupported type.
     DTInvalid = 1, // Does not exist or similar.
 
-    DTString  = 10,
+    DTString  = 10, // From Go, a char pointer to len bytes of Go memory. From C++, a QByteArray pointer released via delByteArray.
     DTBool    = 11,
     DTInt64   = 12,
     DTInt32   = 13,
     DTFloat64 = 14,
     DTFloat32 = 15,
+    DTJSON    = 16, // Holds JSON text, from Go into C++.
+    DTTime    = 17, // Milliseconds since the epoch, with the UTC offset in seconds or LocalTimeOffset as len.
+    DTColor   = 18, // QRgb value with non-premultiplied alpha.
+    DTRegExp  = 19, // Regular expression as "/pattern/flags", held as DTString.
+    DTBytes   = 20, // Binary data, held as DTString.
+    DTError   = 21, // Error message thrown into QML by a hook, held as DTString.
 
     DTGoAddr  = 100,
     DTObject  = 101,
-    DTList    = 102,
+    DTList    = 102, // QVariantList pointer, from Go into C++.
+    DTValues  = 103, // DataValue array allocated with malloc, from C++ into Go.
+    DTMap     = 104, // QVariantMap pointer, from Go into C++.
+    DTPairs   = 105, // DataValue array of keys and values allocated with malloc, from C++ into Go.
+    DTJSValue = 106, // QJSValue pointer, from Go into C++.
+
+    // Typed array elements allocated with malloc, with len holding the
+    // number of elements. From C++ into Go only.
+    DTInt8Array    = 110,
+    DTUint8Array   = 111,
+    DTInt16Array   = 112,
+    DTUint16Array  = 113,
+    DTInt32Array   = 114,
+    DTUint32Array  = 115,
+    DTFloat32Array = 116,
+    DTFloat64Array = 117,
 
     // Used in type information, not in an actual data value.
     DTAny     = 201, // Can hold any of the above types.
     DTMethod  = 202,
+    DTSignal  = 203,
 } DataType;
 
+// LocalTimeOffset is used as the UTC offset of DTTime values in local time.
+#define LocalTimeOffset 0x7fffffff
+
+typedef enum {
+    RegisterOK      = 0,
+    RegisterTooMany = 1, // All the type instances available were used.
+    RegisterFailed  = 2, // Qt refused the registration.
+} RegisterResult;
+
+typedef enum {
+    SetOK         = 0,
+    SetNoProperty = 1,
+    SetReadOnly   = 2,
+    SetWrongType  = 3, // The value cannot be converted to the property type.
+} SetResult;
+
+typedef enum {
+    AnimateOK          = 0,
+    AnimateNoProperty  = 1,
+    AnimateReadOnly    = 2,
+    AnimateWrongType   = 3, // The target value cannot be converted to the property type.
+    AnimateUnsupported = 4, // The property type cannot be interpolated.
+} AnimateResult;
+
+typedef enum {
+    InvokeOK       = 0,
+    InvokeNoMethod = 1,
+    InvokeNoMatch  = 2, // No overload takes the provided arguments.
+    InvokeFailed   = 3, // The method was found but invoking it failed.
+} InvokeResult;
+
+typedef enum {
+    MoveOK          = 0,
+    MoveNotItem     = 1,
+    MoveOtherEngine = 2,
+} MoveResult;
+
+typedef enum {
+    FocusOK        = 0,
+    FocusNotItem   = 1,
+    FocusDisabled  = 2,
+    FocusInvisible = 3,
+} FocusResult;
+
+typedef enum {
+    ClickOK        = 0,
+    ClickNotItem   = 1,
+    ClickNoWindow  = 2,
+    ClickInvisible = 3,
+} ClickResult;
+
+typedef enum {
+    EncodeOK      = 0,
+    EncodeEmpty   = 1,
+    EncodeFailed  = 2,
+} EncodeResult;
+
+// WindowState and WindowFlag match the WindowState and WindowFlags
+// values in the Go side.
+typedef enum {
+    WindowNormal     = 0,
+    WindowMinimized  = 1,
+    WindowMaximized  = 2,
+    WindowFullScreen = 3,
+} WindowState;
+
+typedef enum {
+    WindowFrameless     = 1,
+    WindowStaysOnTop    = 2,
+    WindowStaysOnBottom = 4,
+} WindowFlag;
+
 typedef struct {
     DataType dataType;
     char data[8];
@@ -69,15 +176,41 @@ typedef struct {
     char *typeName;
     GoMemberInfo *fields;
     GoMemberInfo *methods;
-    GoMemberInfo *members; // fields + methods
+    GoMemberInfo *signalMembers;
+    GoMemberInfo *members; // fields + methods + signalMembers
     int fieldsLen;
     int methodsLen;
+    int signalMembersLen;
     int membersLen;
     char *memberNames;
 
     QMetaObject_ *metaObject;
 } GoTypeInfo;
 
+typedef struct {
+    int type;
+    double x;
+    double y;
+    int button;
+    int buttons;
+    int delta;
+    int key;
+    const char *text;
+    int textLen;
+    int modifiers;
+    unsigned long timestamp;
+} InputEvent;
+
+typedef struct {
+    double x;
+    double y;
+    double width;
+    double height;
+    double windowWidth;
+    double windowHeight;
+    double devicePixelRatio;
+} GLState;
+
 typedef struct {
     int severity;
     const char *text;
@@ -87,20 +220,67 @@ typedef struct {
     int line;
 } LogMessage;
 
-void newGuiApplication();
+typedef struct {
+    char *name;
+    int x, y, width, height;
+    int availableX, availableY, availableWidth, availableHeight;
+    double devicePixelRatio;
+    double refreshRate;
+    double logicalDpi;
+    double physicalDpi;
+    int primary;
+} ScreenInfo;
+
+void applicationSetAttributes(int highDpiScaling, int renderBackend);
+void newGuiApplication(int *argc, char **argv);
+void applicationSetNames(const char *name, int nameLen, const char *org, int orgLen);
 void applicationExec();
+void applicationExit();
 void applicationFlushAll();
+void applicationFlushDeleted();
+int applicationHasPendingEvents();
+int applicationInputIdle();
 void startIdleTimer(int *hookWaiting);
+char *probeOpenGL();
 
 void *currentThread();
 void *appThread();
 
 QQmlEngine_ *newEngine(QObject_ *parent);
+void delEngineLater(QQmlEngine_ *engine);
 QQmlContext_ *engineRootContext(QQmlEngine_ *engine);
 void engineSetOwnershipCPP(QQmlEngine_ *engine, QObject_ *object);
 void engineSetOwnershipJS(QQmlEngine_ *engine, QObject_ *object);
 void engineSetContextForObject(QQmlEngine_ *engine, QObject_ *object);
+void engineSetCollectInterval(QQmlEngine_ *engine, int msec);
+void engineSetAccess(QQmlEngine_ *engine, int allowLocalFiles, int allowNetwork);
+void engineDenyOpenUrlExternally(QQmlEngine_ *engine);
+void engineSetNetworkProxy(QQmlEngine_ *engine, int kind, const char *host, int hostLen, int port);
+void engineSetUserAgent(QQmlEngine_ *engine, const char *userAgent, int userAgentLen);
+void engineSetNetworkTransport(QQmlEngine_ *engine, int enabled);
+void networkReplyFinish(QObject_ *reply, int status, const char *reason, int reasonLen, const char *headers, int headersLen,
+                        const char *body, int bodyLen, const char *error, int errorLen);
+void engineAddImportPath(QQmlEngine_ *engine, const char *path, int pathLen);
+void engineCopySettings(QQmlEngine_ *engine, QQmlEngine_ *parent);
+void engineInstallUrlInterceptor(QQmlEngine_ *engine);
+void engineClearComponentCache(QQmlEngine_ *engine);
+void engineTrimComponentCache(QQmlEngine_ *engine, int deferred);
+void engineCollectGarbage(QQmlEngine_ *engine, int deferred);
+int engineMemoryStats(QQmlEngine_ *engine, long long *used, long long *allocated, long long *largeItems);
+char *engineObjectCensus(QQmlEngine_ *engine);
+QObject_ **engineRootObjects(QQmlEngine_ *engine, int *len);
+void *engineNewTypedArray(QQmlEngine_ *engine, DataType dataType, void *data, int len);
+void engineWatchWarnings(QQmlEngine_ *engine);
+void engineAddImageProvider(QQmlEngine_ *engine, QString_ *providerId, GoAddr *provider);
+void engineRemoveImageProvider(QQmlEngine_ *engine, QString_ *providerId);
 
+QImage_ *newImage(int width, int height, int premultiplied, unsigned char **bits, int *bytesPerLine);
+void delImage(QImage_ *image);
+QImage_ *newImageFromData(const char *data, int dataLen, const char *format);
+char *imageReadFormats();
+char *imageWriteFormats();
+
+QQmlContext_ *newContext(QQmlContext_ *parentContext);
 void contextGetProperty(QQmlContext_ *context, QString_ *name, DataValue *value);
 void contextSetProperty(QQmlContext_ *context, QString_ *name, DataValue *value);
 void contextSetObject(QQmlContext_ *context, QObject_ *value);
@@ -108,48 +288,312 @@ void contextSetObject(QQmlContext_ *context, QObject_ *value);
 void delObject(QObject_ *object);
 void delObjectLater(QObject_ *object);
 int objectGetProperty(QObject_ *object, const char *name, DataValue *result);
-void objectSetProperty(QObject_ *object, const char *name, DataValue *value);
+int objectEnumValue(QObject_ *object, const char *key, int *value);
+const char *objectEnumKey(QObject_ *object, const char *enumName, int value);
+char *objectEnumsReport(QObject_ *object);
+int objectSetProperty(QObject_ *object, const char *name, DataValue *value, const char **typeName);
+QObject_ *objectAnimate(QObject_ *object, const char *name, DataValue *to, int msecs, int easing, int restoreBinding, GoAddr *anim, int *result, const char **typeName);
+void animationStop(QObject_ *animation);
+int objectMissingPropertySegment(QObject_ *object, const char *name);
+char *objectSignalSignature(QObject_ *object, const char *name, int nameLen, int *signalIndex);
+int objectPropertyNotifySignal(QObject_ *object, const char *name, int nameLen, int *paramCount);
+QObject_ *objectConnect(QObject_ *object, int signalIndex, GoAddr *conn);
+void signalConnectorReconnect(QObject_ *connector);
 void objectSetParent(QObject_ *object, QObject_ *parent);
-void objectInvoke(QObject_ *object, const char *method, DataValue *result, DataValue *params, int paramsLen);
+void objectTrackDestroyed(QObject_ *object);
+int objectOwnership(QObject_ *object);
+void objectSetOwnership(QObject_ *object, int ownership);
+void objectPinOwnership(QObject_ *object);
+QObject_ *objectNewThrottleTimer(QObject_ *object, GoAddr *throttler);
+void throttleTimerStart(QObject_ *timer, int msec);
+QObject_ *newTimer(GoAddr *timer, int msec, int singleShot);
+int objectInvoke(QObject_ *object, const char *method, DataValue *result, DataValue *params, int paramsLen, char **candidates);
 void objectFindChild(QObject_ *object, QString_ *name, DataValue *result);
+char *objectCreationLocation(QObject_ *object, int *line, int *column);
 QQmlContext_ *objectContext(QObject_ *object);
+QQmlEngine_ *objectEngine(QObject_ *object);
 int objectIsComponent(QObject_ *object);
+int objectInherits(QObject_ *object, const char *className);
+const char *objectClassName(QObject_ *object);
+GoAddr *objectGoAddr(QObject_ *object);
+char *objectPropertiesReport(QObject_ *object);
+char *objectPropertyReport(QObject_ *object, const char *name);
+char *objectMethodsReport(QObject_ *object);
+QObject_ **objectChildren(QObject_ *object, int *len);
+char *itemSerializeReport(QObject_ *object);
+char *objectReadyReport(QObject_ *object, int *total);
+
+const char *byteArrayData(QByteArray_ *ba);
+void delByteArray(QByteArray_ *ba);
+
+int applicationLoadTranslation(const char *path, int pathLen);
+void applicationRemoveTranslation();
+int engineRetranslate(QQmlEngine_ *engine);
+QObject_ *newScriptWatchdog(QQmlEngine_ *engine);
+void scriptWatchdogSetTimeout(QObject_ *watchdog, int msec);
+int engineInterruptScripts(QQmlEngine_ *engine);
+char *localeName();
+void localeSetDefault(const char *name, int nameLen);
+char *localeCanonicalName(const char *name, int nameLen);
+void engineSetUiLanguage(QQmlEngine_ *engine, const char *name, int nameLen);
+int applicationLoadLocaleTranslation(const char *locale, int localeLen, const char *dir, int dirLen, const char *prefix, int prefixLen);
+
+void registerResourceData(void *data);
+void unregisterResourceData(void *data);
+void *readResource(const char *path, int pathLen, int *dataLen);
 
 QQmlComponent_ *newComponent(QQmlEngine_ *engine, QObject_ *parent);
 void componentSetData(QQmlComponent_ *component, const char *data, int dataLen, const char *url, int urlLen);
+void componentLoadAsync(QQmlComponent_ *component, GoAddr *load, const char *data, int dataLen, const char *url, int urlLen);
+int componentIsLoading(QQmlComponent_ *component);
 char *componentErrorString(QQmlComponent_ *component);
+char *componentErrors(QQmlComponent_ *component);
 QObject_ *componentCreate(QQmlComponent_ *component, QQmlContext_ *context);
+QQmlIncubator_ *componentIncubate(QQmlComponent_ *component, QQmlContext_ *context, DataValue *props, GoAddr *incubation, int async);
+int incubatorIsLoading(QQmlIncubator_ *incubator);
+QObject_ *incubatorObject(QQmlIncubator_ *incubator);
+char *incubatorErrors(QQmlIncubator_ *incubator);
+void delIncubatorLater(QQmlIncubator_ *incubator, int abort);
+char *componentTrialErrors(QQmlComponent_ *component);
 QQuickView_ *componentCreateView(QQmlComponent_ *component, QQmlContext_ *context);
+int viewSetRoot(QQuickView_ *view, QQmlComponent_ *component, QQmlContext_ *context);
+
+char *loaderSetSource(QObject_ *loader, const char *url, int urlLen, DataValue *props);
+char *loaderErrors(QObject_ *loader);
 
 void viewShow(QQuickView_ *view);
 void viewHide(QQuickView_ *view);
-void viewConnectHidden(QQuickView_ *view);
+int viewClose(QQuickView_ *view);
+void viewWatch(QQuickView_ *view);
+int viewIsVisible(QQuickView_ *view);
+int viewSceneStats(QQuickView_ *view, int *items, int *nodes, long long *textureBytes);
 QObject_ *viewRootObject(QQuickView_ *view);
+QObject_ *viewInstallEventFilter(QQuickView_ *view);
+QObject_ *viewInstallDropFilter(QQuickView_ *view);
+QObject_ *viewInstallUpdateBlocker(QQuickView_ *view);
+void updateBlockerSuspend(QObject_ *blocker);
+void updateBlockerResume(QObject_ *blocker, int render);
+QObject_ *viewInstallRenderTimer(QQuickView_ *view);
+void renderTimerSetEnabled(QObject_ *timer, int enabled);
+int renderTimerFrames(QObject_ *timer, long long *timings, int max);
+void viewPostMouseEvent(QQuickView_ *view, int type, double x, double y, int button, int buttons, int modifiers);
+void viewPostWheelEvent(QQuickView_ *view, double x, double y, int delta, int modifiers);
+void viewPostKeyEvent(QQuickView_ *view, int type, int key, int modifiers, const char *text, int textLen);
+void viewPostDropEvent(QQuickView_ *view, const char *urls, int urlsLen, double x, double y);
+void viewSetMask(QQuickView_ *view, int *rects, int rectsLen);
+void viewSetTransparentForInput(QQuickView_ *view, int transparent);
+int viewTransparentForInput(QQuickView_ *view);
+void viewSetTitle(QQuickView_ *view, const char *title, int titleLen);
+char *viewTitle(QQuickView_ *view);
+void viewSetPosition(QQuickView_ *view, int x, int y);
+void viewPosition(QQuickView_ *view, int *x, int *y);
+void viewSetSize(QQuickView_ *view, int width, int height);
+void viewSize(QQuickView_ *view, int *width, int *height);
+void viewSetMinimumSize(QQuickView_ *view, int width, int height);
+void viewMinimumSize(QQuickView_ *view, int *width, int *height);
+void viewSetMaximumSize(QQuickView_ *view, int width, int height);
+void viewMaximumSize(QQuickView_ *view, int *width, int *height);
+void viewSetState(QQuickView_ *view, int state);
+int viewState(QQuickView_ *view);
+void viewSetFlags(QQuickView_ *view, int flags);
+int viewFlags(QQuickView_ *view);
+int viewFirstFramePresented(QQuickView_ *view);
+void viewShowWhenReady(QQuickView_ *view);
+int viewSetRenderSize(QQuickView_ *view, int width, int height, double scale);
+void viewResourceStatus(QQuickView_ *view, int *loading, int *failed);
+QImage_ *viewGrabWindow(QQuickView_ *view, unsigned char **bits, int *width, int *height, int *bytesPerLine);
+int viewGrabWindowEncoded(QQuickView_ *view, const char *format, int quality, char **data, int *dataLen);
+int itemMoveToView(QObject_ *item, QQuickView_ *view, double x, double y);
+QObject_ *viewActiveFocusItem(QQuickView_ *view);
+void viewConnectFocusChanged(QQuickView_ *view);
+int itemHasFocus(QObject_ *item);
+int itemForceFocus(QObject_ *item, int reason);
+void itemSetActiveFocusOnTab(QObject_ *item);
+void itemAcceptMouse(QObject_ *item, int mouse, int hover);
+int itemGrabMouse(QObject_ *item, int grab);
+int itemClick(QObject_ *item);
+int itemMapToScene(QObject_ *item, double x, double y, double *sceneX, double *sceneY);
+int itemMapFromScene(QObject_ *item, double sceneX, double sceneY, double *x, double *y);
+int itemGeometry(QObject_ *item, double *x, double *y, double *width, double *height);
+int itemSetGeometry(QObject_ *item, double x, double y, double width, double height);
+int itemSetParentItem(QObject_ *item, QObject_ *parent);
 
 QString_ *newString(const char *data, int len);
 void delString(QString_ *s);
 
 GoValue_ *newGoValue(GoAddr *addr, GoTypeInfo *typeInfo, QObject_ *parent);
 void goValueActivate(GoValue_ *value, GoTypeInfo *typeInfo, int addrOffset);
+void goValueEmit(GoValue_ *value, int metaIndex, DataValue *params, int paramsLen);
+void goValueUpdate(GoValue_ *value);
+
+void painterSetPen(QPainter_ *painter, int r, int g, int b, int a, double width);
+void painterSetBrush(QPainter_ *painter, int r, int g, int b, int a);
+void painterSetFont(QPainter_ *painter, const char *family, int familyLen, int pixelSize);
+void painterDrawLine(QPainter_ *painter, double x1, double y1, double x2, double y2);
+void painterDrawRect(QPainter_ *painter, double x, double y, double width, double height);
+void painterDrawEllipse(QPainter_ *painter, double x, double y, double width, double height);
+void painterFillRect(QPainter_ *painter, double x, double y, double width, double height, int r, int g, int b, int a);
+void painterDrawText(QPainter_ *painter, double x, double y, const char *text, int textLen);
+void painterDrawImage(QPainter_ *painter, double x, double y, QImage_ *image);
+
+QValidator_ *newValidator(GoAddr *addr);
+
+QMenu_ *newMenu();
+void menuAddAction(QMenu_ *menu, GoAddr *action, const char *text, int textLen, const char *icon, int iconLen, int enabled);
+void menuAddCheckAction(QMenu_ *menu, GoAddr *action, const char *text, int textLen, int enabled, int checked);
+void menuAddSeparator(QMenu_ *menu);
+QMenu_ *menuAddSubmenu(QMenu_ *menu, const char *text, int textLen);
+void menuClear(QMenu_ *menu);
+void menuPopup(QMenu_ *menu, QQuickView_ *view, int x, int y);
+void menuClose(QMenu_ *menu);
+
+int clipboardSupported(int mode);
+QByteArray_ *clipboardText(int mode, int *len);
+void clipboardSetText(int mode, const char *text, int textLen);
+QImage_ *clipboardImage(int mode, unsigned char **bits, int *width, int *height, int *bytesPerLine);
+void clipboardSetImage(int mode, QImage_ *image);
+void clipboardClear(int mode);
+void clipboardWatch();
+
+QQuickView_ **applicationWindows(int *len);
+QQmlEngine_ *viewEngine(QQuickView_ *view);
+void applicationWatchFocusWindow();
+void viewRaise(QQuickView_ *view);
+void viewRequestActivate(QQuickView_ *view);
+int viewIsActive(QQuickView_ *view);
+
+int applicationScreenCount();
+void applicationScreen(int index, ScreenInfo *info);
+void applicationWatchScreens();
+void viewScreen(QQuickView_ *view, ScreenInfo *info);
+int viewSetScreen(QQuickView_ *view, const char *name, int nameLen);
+
+int trayIsAvailable();
+QSystemTrayIcon_ *newTrayIcon(GoAddr *addr);
+void traySetImage(QSystemTrayIcon_ *tray, QImage_ *image);
+void traySetIconFile(QSystemTrayIcon_ *tray, const char *path, int pathLen);
+void traySetToolTip(QSystemTrayIcon_ *tray, const char *text, int textLen);
+void traySetMenu(QSystemTrayIcon_ *tray, QMenu_ *menu);
+void traySetVisible(QSystemTrayIcon_ *tray, int visible);
+int trayShowMessage(QSystemTrayIcon_ *tray, const char *title, int titleLen, const char *body, int bodyLen, int msecs);
+
+void fileDialogOpen(QQuickView_ *parent, GoAddr *addr, const char *title, int titleLen, const char *dir, int dirLen, const char *filters, int filtersLen, int mode);
+void messageBoxOpen(QQuickView_ *parent, GoAddr *addr, const char *title, int titleLen, const char *text, int textLen, int icon, int buttons);
+
+GoLazyModel_ *newLazyModel(GoAddr *addr);
+void lazyModelSetPageSize(GoLazyModel_ *model, int size);
+void lazyModelInvalidate(GoLazyModel_ *model, int offset, int count);
+void lazyModelRefresh(GoLazyModel_ *model);
+
+GoListModel_ *newListModel(GoAddr *addr, const char *roles, int rolesLen);
+void listModelBeginInsert(GoListModel_ *model, int first, int last);
+void listModelEndInsert(GoListModel_ *model);
+void listModelBeginRemove(GoListModel_ *model, int first, int last);
+void listModelEndRemove(GoListModel_ *model);
+void listModelChanged(GoListModel_ *model, int first, int last);
+void listModelBeginReset(GoListModel_ *model);
+void listModelEndReset(GoListModel_ *model);
+
+GoTableModel_ *newTableModel(GoAddr *addr, const char *roles, int rolesLen);
+void tableModelBeginInsert(GoTableModel_ *model, int first, int last);
+void tableModelEndInsert(GoTableModel_ *model);
+void tableModelBeginRemove(GoTableModel_ *model, int first, int last);
+void tableModelEndRemove(GoTableModel_ *model);
+void tableModelChanged(GoTableModel_ *model, int first, int last);
+void tableModelBeginReset(GoTableModel_ *model);
+void tableModelEndReset(GoTableModel_ *model);
+void tableModelBeginLayout(GoTableModel_ *model);
+void tableModelEndLayout(GoTableModel_ *model, int *newRows, int len);
+
+QQmlPropertyMap_ *newStore(GoAddr *addr);
+void storeInsert(QQmlPropertyMap_ *store, QString_ *key, DataValue *value);
+void storeClear(QQmlPropertyMap_ *store, QString_ *key);
+
+QSettings_ *newSettings(const char *organization, int organizationLen, const char *application, int applicationLen);
+int settingsValue(QSettings_ *settings, const char *key, int keyLen, DataValue *result);
+void settingsSetValue(QSettings_ *settings, const char *key, int keyLen, DataValue *value);
+void settingsRemove(QSettings_ *settings, const char *key, int keyLen);
+char *settingsChildren(QSettings_ *settings, const char *group, int groupLen, int groups);
+int settingsSync(QSettings_ *settings);
 
 void packDataValue(QVariant_ *var, DataValue *result);
 void unpackDataValue(DataValue *value, QVariant_ *result);
 
 QVariantList_ *newVariantList(DataValue *list, int len);
+QVariantMap_ *newVariantMap(DataValue *pairs, int len);
 
-void registerType(char *location, int major, int minor, char *name, GoTypeInfo *typeInfo, GoTypeSpec_ *spec);
-void registerSingleton(char *location, int major, int minor, char *name, GoTypeInfo *typeInfo, GoTypeSpec_ *spec);
+int registerType(char *location, int major, int minor, char *name, GoTypeInfo *typeInfo, GoTypeSpec_ *spec);
+int registerPaintedType(char *location, int major, int minor, char *name, GoTypeInfo *typeInfo, GoTypeSpec_ *spec);
+int registerGLType(char *location, int major, int minor, char *name, GoTypeInfo *typeInfo, GoTypeSpec_ *spec, int stage);
+int registerComponent(const char *url, int urlLen, char *location, int major, int minor, char *name);
+int registerSingleton(char *location, int major, int minor, char *name, GoTypeInfo *typeInfo, GoTypeSpec_ *spec);
 
 void installLogHandler();
 
 void hookIdleTimer();
+void hookEngineCollectTick(QQmlEngine_ *engine);
 void hookLogHandler(LogMessage *message);
 void hookGoValueReadField(QQmlEngine_ *engine, GoAddr *addr, int memberIndex, DataValue *result);
 void hookGoValueWriteField(QQmlEngine_ *engine, GoAddr *addr, int memberIndex, DataValue *assign);
 void hookGoValueCallMethod(QQmlEngine_ *engine, GoAddr *addr, int memberIndex, DataValue *result);
 void hookGoValueDestroyed(QQmlEngine_ *engine, GoAddr *addr);
 GoAddr *hookGoValueTypeNew(GoValue_ *value, GoTypeSpec_ *spec);
-void hookWindowHidden(QObject_ *addr);
+void hookGoValueTypeInit(GoValue_ *value, GoAddr *addr);
+char *hookGoValueTypeEnums(GoTypeSpec_ *spec);
+void hookGoValuePaint(GoAddr *addr, QPainter_ *painter, double width, double height);
+void hookGoValueResized(GoAddr *addr, double width, double height);
+int hookGoValueKeyEvent(GoAddr *addr, InputEvent *event, int autoRepeat);
+int hookGoValueMouseEvent(GoAddr *addr, InputEvent *event);
+void hookGoValueMouseUngrab(GoAddr *addr);
+void hookGoValueGLPaint(GoAddr *addr, GLState *state);
+void hookWindowHidden(QQuickView_ *view);
+int hookWindowClosing(QQuickView_ *view);
+void hookWindowUnwatched(QQuickView_ *view);
+void hookWindowFirstFrame(QQuickView_ *view, int presented);
+void hookWindowFocusChanged(QQuickView_ *view, QObject_ *oldItem, QObject_ *newItem);
+void hookWindowFocusDisconnected(QQuickView_ *view);
+void hookFocusWindowChanged(QQuickView_ *view);
+void hookScreensChanged();
+int hookValidatorValidate(GoAddr *addr, char *input, int inputLen, int *pos, char **fixed, int *fixedLen);
+void hookValidatorDestroyed(GoAddr *addr);
+void hookMenuActionTriggered(GoAddr *action, int checked);
+void hookClipboardChanged(int mode);
+void hookTrayActivated(GoAddr *addr, int reason);
+void hookDialogFinished(GoAddr *addr, int result, char *paths, int pathsLen);
+int hookLazyModelCount(GoAddr *addr);
+void hookLazyModelData(QQmlEngine_ *engine, GoAddr *addr, int row, DataValue *result);
+void hookLazyModelDestroyed(GoAddr *addr);
+int hookListModelCount(GoAddr *addr);
+void hookListModelData(QQmlEngine_ *engine, GoAddr *addr, int row, int field, DataValue *result);
+void hookListModelDestroyed(GoAddr *addr);
+int hookTableModelCount(GoAddr *addr);
+void hookTableModelData(QQmlEngine_ *engine, GoAddr *addr, int row, int column, DataValue *result);
+void hookTableModelDestroyed(GoAddr *addr);
+int hookEventFilter(QObject_ *target, InputEvent *event);
+void hookEventFilterDestroyed(QObject_ *target, QObject_ *filter);
+void hookNetworkRequest(QQmlEngine_ *engine, QObject_ *reply, const char *method, int methodLen, const char *url, int urlLen,
+                        const char *headers, int headersLen, const char *body, int bodyLen);
+void hookNetworkReplyDestroyed(QObject_ *reply);
+int hookWindowDrop(QQuickView_ *view, const char *paths, int pathsLen, int count, double x, double y);
+void hookDropFilterDestroyed(QQuickView_ *view, QObject_ *filter);
+void hookUpdateBlockerDestroyed(QQuickView_ *view);
+void hookRenderTimerDestroyed(QQuickView_ *view);
+void hookSignalCall(GoAddr *conn, DataValue *args);
+void hookSignalConnectionDestroyed(GoAddr *conn);
+void hookStoreChanged(GoAddr *addr, const char *key, int keyLen, DataValue *value);
+void hookObjectDestroyed(QObject_ *object);
+QImage_ *hookImageProviderRequest(GoAddr *provider, const char *id, int idLen, int width, int height);
+void hookImageProviderDestroyed(GoAddr *provider);
+void hookThrottleTimeout(GoAddr *throttler);
+void hookThrottleDestroyed(GoAddr *throttler);
+void hookTimerTimeout(GoAddr *timer);
+void hookTimerDestroyed(GoAddr *timer);
+void hookComponentLoaded(GoAddr *load);
+void hookIncubationDone(GoAddr *incubation);
+char *hookUrlIntercept(QQmlEngine_ *engine, const char *url, int urlLen, int kind);
+void hookAnimationFinished(GoAddr *anim, int completed);
+void hookSaveState();
+void hookEngineWarning(QQmlEngine_ *engine, const char *url, int urlLen, int line, int column, const char *desc, int descLen);
 
 #ifdef __cplusplus
 } // extern "C"
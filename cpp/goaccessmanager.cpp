@@ -0,0 +1,223 @@
+#include <QCoreApplication>
+#include <QDebug>
+#include <QNetworkRequest>
+
+#include "goaccessmanager.h"
+
+GoNetworkConfig::GoNetworkConfig(QQmlEngine_ *engine, bool allowLocalFiles, bool allowNetwork)
+    : engine(engine), allowLocalFiles(allowLocalFiles), allowNetwork(allowNetwork),
+      proxy(QNetworkProxy::DefaultProxy), transport(false)
+{
+}
+
+GoNetworkAccessManager::GoNetworkAccessManager(QSharedPointer<GoNetworkConfig> config, QObject *parent)
+    : QNetworkAccessManager(parent), config(config)
+{
+}
+
+QNetworkReply *GoNetworkAccessManager::createRequest(Operation op, const QNetworkRequest &request, QIODevice *outgoingData)
+{
+    QUrl url = request.url();
+    QString scheme = url.scheme();
+    bool allowed;
+    if (scheme == "qrc" || scheme == "data") {
+        allowed = true;
+    } else if (url.isLocalFile() || scheme.isEmpty()) {
+        allowed = config->allowLocalFiles;
+    } else {
+        allowed = config->allowNetwork;
+    }
+    if (!allowed) {
+        qWarning() << "qml: engine options deny access to" << url.toString();
+
+        // Unknown schemes fail asynchronously with a proper error reply.
+        QNetworkRequest denied(QUrl("denied:" + url.toString()));
+        return QNetworkAccessManager::createRequest(op, denied, outgoingData);
+    }
+    if (scheme != "http" && scheme != "https") {
+        // Local files and resources are never affected by the settings.
+        return QNetworkAccessManager::createRequest(op, request, outgoingData);
+    }
+
+    config->mutex.lock();
+    QNetworkProxy proxy = config->proxy;
+    QByteArray userAgent = config->userAgent;
+    bool transport = config->transport;
+    config->mutex.unlock();
+
+    QNetworkRequest req(request);
+    if (!userAgent.isEmpty()) {
+        req.setRawHeader("User-Agent", userAgent);
+    }
+    if (!transport) {
+        setProxy(proxy);
+        return QNetworkAccessManager::createRequest(op, req, outgoingData);
+    }
+
+    QByteArray method;
+    switch (op) {
+    case HeadOperation:   method = "HEAD";   break;
+    case GetOperation:    method = "GET";    break;
+    case PutOperation:    method = "PUT";    break;
+    case PostOperation:   method = "POST";   break;
+    case DeleteOperation: method = "DELETE"; break;
+    default:
+        method = req.attribute(QNetworkRequest::CustomVerbAttribute).toByteArray();
+        break;
+    }
+    QByteArray headers;
+    foreach (const QByteArray &name, req.rawHeaderList()) {
+        headers += name + ": " + req.rawHeader(name) + '\n';
+    }
+    QByteArray body;
+    if (outgoingData) {
+        body = outgoingData->readAll();
+    }
+    QByteArray urlData = url.toEncoded();
+    GoNetworkReply *reply = new GoNetworkReply(op, req, this);
+    hookNetworkRequest(config->engine, reply, method.constData(), method.size(), urlData.constData(), urlData.size(),
+                       headers.constData(), headers.size(), body.constData(), body.size());
+    return reply;
+}
+
+GoNetworkAccessManagerFactory::GoNetworkAccessManagerFactory(QSharedPointer<GoNetworkConfig> config)
+    : config(config)
+{
+}
+
+QNetworkAccessManager *GoNetworkAccessManagerFactory::create(QObject *parent)
+{
+    // This may run in threads other than the GUI one, so the managers
+    // only access the settings in the config under its mutex.
+    return new GoNetworkAccessManager(config, parent);
+}
+
+// GoNetworkReplyEvent holds the response delivered to a GoNetworkReply.
+class GoNetworkReplyEvent : public QEvent
+{
+public:
+    GoNetworkReplyEvent() : QEvent(GoNetworkReply::FinishEvent) {}
+
+    int status;
+    QByteArray reason;
+    QByteArray headers;
+    QByteArray body;
+    QByteArray error;
+};
+
+GoNetworkReply::GoNetworkReply(QNetworkAccessManager::Operation op, const QNetworkRequest &request, QObject *parent)
+    : QNetworkReply(parent), offset(0), done(false)
+{
+    setRequest(request);
+    setUrl(request.url());
+    setOperation(op);
+    open(QIODevice::ReadOnly | QIODevice::Unbuffered);
+}
+
+GoNetworkReply::~GoNetworkReply()
+{
+    hookNetworkReplyDestroyed(this);
+}
+
+void GoNetworkReply::abort()
+{
+    if (!done) {
+        fail(OperationCanceledError, "Operation canceled");
+    }
+}
+
+qint64 GoNetworkReply::bytesAvailable() const
+{
+    return content.size() - offset + QIODevice::bytesAvailable();
+}
+
+bool GoNetworkReply::isSequential() const
+{
+    return true;
+}
+
+qint64 GoNetworkReply::readData(char *data, qint64 maxSize)
+{
+    if (offset >= content.size()) {
+        return done ? -1 : 0;
+    }
+    qint64 n = qMin(maxSize, content.size() - offset);
+    memcpy(data, content.constData() + offset, n);
+    offset += n;
+    return n;
+}
+
+void GoNetworkReply::fail(NetworkError code, const QString &message)
+{
+    done = true;
+    setError(code, message);
+#if QT_VERSION >= QT_VERSION_CHECK(5, 15, 0)
+    emit errorOccurred(code);
+#else
+    emit error(code);
+#endif
+    emit finished();
+}
+
+bool GoNetworkReply::event(QEvent *event)
+{
+    if (event->type() != FinishEvent) {
+        return QNetworkReply::event(event);
+    }
+    if (done) {
+        return true;
+    }
+    GoNetworkReplyEvent *ev = static_cast<GoNetworkReplyEvent *>(event);
+    if (!ev->error.isEmpty()) {
+        fail(UnknownNetworkError, QString::fromUtf8(ev->error));
+        return true;
+    }
+    setAttribute(QNetworkRequest::HttpStatusCodeAttribute, ev->status);
+    setAttribute(QNetworkRequest::HttpReasonPhraseAttribute, ev->reason);
+    foreach (const QByteArray &line, ev->headers.split('\n')) {
+        int colon = line.indexOf(':');
+        if (colon > 0) {
+            setRawHeader(line.left(colon), line.mid(colon + 1).trimmed());
+        }
+    }
+    content = ev->body;
+    emit metaDataChanged();
+    if (ev->status >= 400) {
+        // Mirror how Qt reports HTTP errors, while still offering the body.
+        NetworkError code = ev->status == 404 ? ContentNotFoundError :
+                            ev->status == 401 ? AuthenticationRequiredError :
+                            ev->status == 403 ? ContentAccessDenied :
+                            ev->status >= 500 ? InternalServerError : UnknownContentError;
+        setError(code, QString::fromUtf8(ev->reason));
+    }
+    if (!content.isEmpty()) {
+        emit downloadProgress(content.size(), content.size());
+        emit readyRead();
+    }
+    done = true;
+    if (error() != NoError) {
+#if QT_VERSION >= QT_VERSION_CHECK(5, 15, 0)
+        emit errorOccurred(error());
+#else
+        emit error(error());
+#endif
+    }
+    emit finished();
+    return true;
+}
+
+void networkReplyFinish(QObject_ *reply, int status, const char *reason, int reasonLen, const char *headers, int headersLen,
+                        const char *body, int bodyLen, const char *error, int errorLen)
+{
+    // May run in any thread. The event is discarded if the reply is
+    // deleted before it's delivered.
+    GoNetworkReplyEvent *event = new GoNetworkReplyEvent();
+    event->status = status;
+    event->reason = QByteArray(reason, reasonLen);
+    event->headers = QByteArray(headers, headersLen);
+    event->body = QByteArray(body, bodyLen);
+    event->error = QByteArray(error, errorLen);
+    QCoreApplication::postEvent(reinterpret_cast<QObject *>(reply), event);
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
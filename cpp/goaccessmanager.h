@@ -0,0 +1,84 @@
+#ifndef GOACCESSMANAGER_H
+#define GOACCESSMANAGER_H
+
+#include <QEvent>
+#include <QMutex>
+#include <QNetworkAccessManager>
+#include <QNetworkProxy>
+#include <QNetworkReply>
+#include <QQmlNetworkAccessManagerFactory>
+#include <QSharedPointer>
+
+#include "capi.h"
+
+// GoNetworkConfig holds the network settings of an engine, which are
+// shared by the access managers Qt creates for it in several threads.
+class GoNetworkConfig
+{
+public:
+    GoNetworkConfig(QQmlEngine_ *engine, bool allowLocalFiles, bool allowNetwork);
+
+    QQmlEngine_ *engine;
+    const bool allowLocalFiles;
+    const bool allowNetwork;
+
+    // Guarded by mutex.
+    QMutex mutex;
+    QNetworkProxy proxy;
+    QByteArray userAgent;
+    bool transport;
+};
+
+class GoNetworkAccessManager : public QNetworkAccessManager
+{
+public:
+    GoNetworkAccessManager(QSharedPointer<GoNetworkConfig> config, QObject *parent);
+
+protected:
+    QNetworkReply *createRequest(Operation op, const QNetworkRequest &request, QIODevice *outgoingData);
+
+private:
+    QSharedPointer<GoNetworkConfig> config;
+};
+
+class GoNetworkAccessManagerFactory : public QQmlNetworkAccessManagerFactory
+{
+public:
+    GoNetworkAccessManagerFactory(QSharedPointer<GoNetworkConfig> config);
+
+    QNetworkAccessManager *create(QObject *parent);
+
+    QSharedPointer<GoNetworkConfig> config;
+};
+
+// GoNetworkReply is the reply of a request made via the Go transport
+// set with Engine.SetNetworkTransport. The response is delivered by Go
+// via networkReplyFinish, from any thread.
+class GoNetworkReply : public QNetworkReply
+{
+public:
+    GoNetworkReply(QNetworkAccessManager::Operation op, const QNetworkRequest &request, QObject *parent);
+
+    virtual ~GoNetworkReply();
+
+    static const QEvent::Type FinishEvent = QEvent::Type(QEvent::User + 1);
+
+    void abort();
+    qint64 bytesAvailable() const;
+    bool isSequential() const;
+
+protected:
+    bool event(QEvent *event);
+    qint64 readData(char *data, qint64 maxSize);
+
+private:
+    void fail(NetworkError code, const QString &message);
+
+    QByteArray content;
+    qint64 offset;
+    bool done;
+};
+
+#endif // GOACCESSMANAGER_H
+
+// vim:ts=4:et
@@ -0,0 +1,63 @@
+#include <private/qqmlbinding_p.h>
+#include <private/qqmlproperty_p.h>
+
+#include "goanimation.h"
+#include "capi.h"
+
+GoAnimation::GoAnimation(GoAddr *addr, const QQmlProperty &property, bool restoreBinding)
+    : QVariantAnimation(property.object()), addr(addr), property(property), binding(0)
+{
+    // The binding is taken out so it doesn't fight the animation, and is
+    // either put back once the animation is over or dropped for good.
+    binding = QQmlPropertyPrivate::setBinding(property, 0);
+    if (binding && !restoreBinding) {
+        binding->destroy();
+        binding = 0;
+    }
+}
+
+GoAnimation::~GoAnimation()
+{
+    if (addr) {
+        // Destroyed with the animated object while running.
+        if (binding) {
+            binding->destroy();
+            binding = 0;
+        }
+        GoAddr *released = addr;
+        addr = 0;
+        hookAnimationFinished(released, 0);
+    }
+}
+
+void GoAnimation::updateCurrentValue(const QVariant &value)
+{
+    if (addr) {
+        QQmlPropertyPrivate::write(property, value, QQmlPropertyPrivate::DontRemoveBinding);
+    }
+}
+
+void GoAnimation::updateState(QAbstractAnimation::State newState, QAbstractAnimation::State oldState)
+{
+    QVariantAnimation::updateState(newState, oldState);
+    if (newState == QAbstractAnimation::Stopped && addr) {
+        release(currentTime() == duration());
+    }
+}
+
+void GoAnimation::release(bool completed)
+{
+    if (binding) {
+        QQmlAbstractBinding *replaced = QQmlPropertyPrivate::setBinding(property, binding);
+        if (replaced && replaced != binding) {
+            replaced->destroy();
+        }
+        binding = 0;
+    }
+    GoAddr *released = addr;
+    addr = 0;
+    deleteLater();
+    hookAnimationFinished(released, completed ? 1 : 0);
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,32 @@
+#ifndef GOANIMATION_H
+#define GOANIMATION_H
+
+#include <QQmlProperty>
+#include <QVariantAnimation>
+
+#include "capi.h"
+
+class QQmlAbstractBinding;
+
+class GoAnimation : public QVariantAnimation
+{
+public:
+    GoAnimation(GoAddr *addr, const QQmlProperty &property, bool restoreBinding);
+
+    virtual ~GoAnimation();
+
+protected:
+    void updateCurrentValue(const QVariant &value);
+    void updateState(QAbstractAnimation::State newState, QAbstractAnimation::State oldState);
+
+private:
+    void release(bool completed);
+
+    GoAddr *addr;
+    QQmlProperty property;
+    QQmlAbstractBinding *binding;
+};
+
+#endif // GOANIMATION_H
+
+// vim:ts=4:et
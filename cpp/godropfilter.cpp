@@ -0,0 +1,69 @@
+#include <QDragMoveEvent>
+#include <QDropEvent>
+#include <QMimeData>
+#include <QUrl>
+
+#include "godropfilter.h"
+#include "capi.h"
+
+GoDropFilter::GoDropFilter(QQuickView *view)
+    : QObject(view), view(view)
+{
+    view->installEventFilter(this);
+}
+
+GoDropFilter::~GoDropFilter()
+{
+    hookDropFilterDestroyed(view, this);
+}
+
+bool GoDropFilter::eventFilter(QObject *watched, QEvent *event)
+{
+    if (watched != view) {
+        return false;
+    }
+    switch (event->type()) {
+    case QEvent::DragEnter:
+    case QEvent::DragMove:
+        {
+            // Deliver the event to QML first, and accept dragged urls
+            // at the window level if no item did, so they may be dropped.
+            QDragMoveEvent *dev = static_cast<QDragMoveEvent *>(event);
+            dev->ignore();
+            view->event(event);
+            if (!dev->isAccepted() && dev->mimeData()->hasUrls()) {
+                dev->acceptProposedAction();
+            }
+            return true;
+        }
+    case QEvent::Drop:
+        {
+            QDropEvent *dev = static_cast<QDropEvent *>(event);
+            if (!dev->mimeData()->hasUrls()) {
+                return false;
+            }
+            QByteArray paths;
+            QList<QUrl> urls = dev->mimeData()->urls();
+            for (int i = 0; i < urls.size(); i++) {
+                if (i > 0) {
+                    paths.append('\0');
+                }
+                QUrl url = urls[i];
+                paths.append((url.isLocalFile() ? url.toLocalFile() : url.toString()).toUtf8());
+            }
+            QPointF pos = dev->posF();
+            if (!hookWindowDrop(view, paths.constData(), paths.size(), urls.size(), pos.x(), pos.y())) {
+                return false;
+            }
+            // Let items tracking the drag know it's over.
+            QDragLeaveEvent leave;
+            view->event(&leave);
+            dev->acceptProposedAction();
+            return true;
+        }
+    default:
+        return false;
+    }
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
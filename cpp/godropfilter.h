@@ -0,0 +1,24 @@
+#ifndef GODROPFILTER_H
+#define GODROPFILTER_H
+
+#include <QQuickView>
+
+#include "capi.h"
+
+class GoDropFilter : public QObject
+{
+public:
+    GoDropFilter(QQuickView *view);
+
+    virtual ~GoDropFilter();
+
+protected:
+    bool eventFilter(QObject *watched, QEvent *event);
+
+private:
+    QQuickView *view;
+};
+
+#endif // GODROPFILTER_H
+
+// vim:ts=4:et
@@ -0,0 +1,82 @@
+#include <QKeyEvent>
+#include <QMouseEvent>
+#include <QTouchEvent>
+#include <QWheelEvent>
+
+#include "goeventfilter.h"
+#include "capi.h"
+
+GoEventFilter::GoEventFilter(QObject *target)
+    : QObject(target), target(target)
+{
+    target->installEventFilter(this);
+}
+
+GoEventFilter::~GoEventFilter()
+{
+    hookEventFilterDestroyed(target, this);
+}
+
+bool GoEventFilter::eventFilter(QObject *watched, QEvent *event)
+{
+    InputEvent ev;
+    memset(&ev, 0, sizeof(ev));
+    ev.type = event->type();
+
+    QByteArray text;
+    switch (event->type()) {
+    case QEvent::MouseButtonPress:
+    case QEvent::MouseButtonRelease:
+    case QEvent::MouseButtonDblClick:
+    case QEvent::MouseMove:
+        {
+            QMouseEvent *mev = static_cast<QMouseEvent *>(event);
+            ev.x = mev->localPos().x();
+            ev.y = mev->localPos().y();
+            ev.button = mev->button();
+            ev.buttons = mev->buttons();
+            break;
+        }
+    case QEvent::Wheel:
+        {
+            QWheelEvent *wev = static_cast<QWheelEvent *>(event);
+            ev.x = wev->posF().x();
+            ev.y = wev->posF().y();
+            ev.buttons = wev->buttons();
+            ev.delta = wev->angleDelta().y();
+            break;
+        }
+    case QEvent::KeyPress:
+    case QEvent::KeyRelease:
+        {
+            QKeyEvent *kev = static_cast<QKeyEvent *>(event);
+            text = kev->text().toUtf8();
+            ev.key = kev->key();
+            ev.text = text.constData();
+            ev.textLen = text.size();
+            break;
+        }
+    case QEvent::TouchBegin:
+    case QEvent::TouchUpdate:
+    case QEvent::TouchEnd:
+        {
+            QTouchEvent *tev = static_cast<QTouchEvent *>(event);
+            if (!tev->touchPoints().isEmpty()) {
+                QPointF pos = tev->touchPoints().first().pos();
+                ev.x = pos.x();
+                ev.y = pos.y();
+            }
+            break;
+        }
+    default:
+        return false;
+    }
+
+    QInputEvent *iev = static_cast<QInputEvent *>(event);
+    ev.modifiers = iev->modifiers();
+    ev.timestamp = iev->timestamp();
+
+    return hookEventFilter(watched, &ev) != 0;
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,24 @@
+#ifndef GOEVENTFILTER_H
+#define GOEVENTFILTER_H
+
+#include <QObject>
+
+#include "capi.h"
+
+class GoEventFilter : public QObject
+{
+public:
+    GoEventFilter(QObject *target);
+
+    virtual ~GoEventFilter();
+
+protected:
+    bool eventFilter(QObject *watched, QEvent *event);
+
+private:
+    QObject *target;
+};
+
+#endif // GOEVENTFILTER_H
+
+// vim:ts=4:et
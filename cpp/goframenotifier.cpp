@@ -0,0 +1,62 @@
+#include <QCoreApplication>
+#include <QEvent>
+
+#include "goframenotifier.h"
+#include "capi.h"
+
+static const QEvent::Type firstFrameEvent = static_cast<QEvent::Type>(QEvent::registerEventType());
+
+GoFrameNotifier::GoFrameNotifier(QQuickView *view)
+    : QObject(view), view(view), posted(0), isPresented(false), reveal(false)
+{
+    setObjectName("goFrameNotifier");
+
+    // frameSwapped is emitted from the render thread with the threaded
+    // render loop, so the notification is posted to the GUI thread.
+    connection = QObject::connect(view, &QQuickWindow::frameSwapped, [=]() {
+        if (posted.testAndSetOrdered(0, 1)) {
+            QCoreApplication::postEvent(this, new QEvent(firstFrameEvent));
+        }
+    });
+}
+
+GoFrameNotifier::~GoFrameNotifier()
+{
+    QObject::disconnect(connection);
+    if (!isPresented) {
+        hookWindowFirstFrame(view, 0);
+    }
+}
+
+void GoFrameNotifier::showWhenReady()
+{
+    if (isPresented) {
+        viewShow(view);
+        return;
+    }
+#if QT_VERSION >= QT_VERSION_CHECK(5, 1, 0)
+    // The window must be shown for the frame to be rendered, so keep
+    // it fully transparent until the frame is presented.
+    view->setOpacity(0);
+    reveal = true;
+#endif
+    viewShow(view);
+}
+
+bool GoFrameNotifier::event(QEvent *event)
+{
+    if (event->type() != firstFrameEvent) {
+        return QObject::event(event);
+    }
+    QObject::disconnect(connection);
+    isPresented = true;
+#if QT_VERSION >= QT_VERSION_CHECK(5, 1, 0)
+    if (reveal) {
+        view->setOpacity(1);
+    }
+#endif
+    hookWindowFirstFrame(view, 1);
+    return true;
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,33 @@
+#ifndef GOFRAMENOTIFIER_H
+#define GOFRAMENOTIFIER_H
+
+#include <QAtomicInt>
+#include <QQuickView>
+
+#include "capi.h"
+
+class GoFrameNotifier : public QObject
+{
+public:
+    GoFrameNotifier(QQuickView *view);
+
+    virtual ~GoFrameNotifier();
+
+    bool presented() const { return isPresented; }
+
+    void showWhenReady();
+
+protected:
+    bool event(QEvent *event);
+
+private:
+    QQuickView *view;
+    QMetaObject::Connection connection;
+    QAtomicInt posted;
+    bool isPresented;
+    bool reveal;
+};
+
+#endif // GOFRAMENOTIFIER_H
+
+// vim:ts=4:et
@@ -0,0 +1,33 @@
+#include "goimageprovider.h"
+#include "capi.h"
+
+GoImageProvider::GoImageProvider(GoAddr *addr)
+    : QQuickImageProvider(QQuickImageProvider::Image), addr(addr)
+{
+}
+
+GoImageProvider::~GoImageProvider()
+{
+    hookImageProviderDestroyed(addr);
+}
+
+QImage GoImageProvider::requestImage(const QString &id, QSize *size, const QSize &requestedSize)
+{
+    // Called from the image loading thread, and from the GUI thread
+    // for images that are not loaded asynchronously.
+    QByteArray ba = id.toUtf8();
+    int width = requestedSize.width() > 0 ? requestedSize.width() : 0;
+    int height = requestedSize.height() > 0 ? requestedSize.height() : 0;
+    QImage *image = reinterpret_cast<QImage *>(hookImageProviderRequest(addr, ba.constData(), ba.size(), width, height));
+    if (!image) {
+        return QImage();
+    }
+    QImage result = *image;
+    delete image;
+    if (size) {
+        *size = result.size();
+    }
+    return result;
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,23 @@
+#ifndef GOIMAGEPROVIDER_H
+#define GOIMAGEPROVIDER_H
+
+#include <QQuickImageProvider>
+
+#include "capi.h"
+
+class GoImageProvider : public QQuickImageProvider
+{
+public:
+    GoImageProvider(GoAddr *addr);
+
+    virtual ~GoImageProvider();
+
+    virtual QImage requestImage(const QString &id, QSize *size, const QSize &requestedSize);
+
+private:
+    GoAddr *addr;
+};
+
+#endif // GOIMAGEPROVIDER_H
+
+// vim:ts=4:et
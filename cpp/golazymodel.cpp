@@ -0,0 +1,89 @@
+#include <QQmlEngine>
+
+#include "golazymodel.h"
+#include "capi.h"
+
+enum { ModelDataRole = Qt::UserRole + 1 };
+
+GoLazyModel::GoLazyModel(GoAddr *addr, QObject *parent)
+    : QAbstractListModel(parent), addr(addr), loaded(0), pageSize(100)
+{
+}
+
+GoLazyModel::~GoLazyModel()
+{
+    hookLazyModelDestroyed(addr);
+}
+
+int GoLazyModel::rowCount(const QModelIndex &parent) const
+{
+    return parent.isValid() ? 0 : loaded;
+}
+
+QVariant GoLazyModel::data(const QModelIndex &index, int role) const
+{
+    QVariant result;
+    if (!index.isValid() || index.row() >= loaded || role != ModelDataRole) {
+        return result;
+    }
+    DataValue value;
+    hookLazyModelData(qmlEngine(this), addr, index.row(), &value);
+    unpackDataValue(&value, &result);
+    return result;
+}
+
+QHash<int, QByteArray> GoLazyModel::roleNames() const
+{
+    QHash<int, QByteArray> roles;
+    roles[ModelDataRole] = "modelData";
+    return roles;
+}
+
+bool GoLazyModel::canFetchMore(const QModelIndex &parent) const
+{
+    return !parent.isValid() && loaded < hookLazyModelCount(addr);
+}
+
+void GoLazyModel::fetchMore(const QModelIndex &parent)
+{
+    if (parent.isValid()) {
+        return;
+    }
+    int n = qMin(pageSize, hookLazyModelCount(addr) - loaded);
+    if (n <= 0) {
+        return;
+    }
+    beginInsertRows(QModelIndex(), loaded, loaded + n - 1);
+    loaded += n;
+    endInsertRows();
+}
+
+void GoLazyModel::setPageSize(int size)
+{
+    pageSize = size;
+}
+
+void GoLazyModel::invalidate(int offset, int count)
+{
+    int last = qMin(offset + count, loaded) - 1;
+    if (offset < 0 || last < offset) {
+        return;
+    }
+    emit dataChanged(index(offset), index(last));
+}
+
+void GoLazyModel::refresh()
+{
+    int total = hookLazyModelCount(addr);
+    if (total < loaded) {
+        beginRemoveRows(QModelIndex(), total, loaded - 1);
+        loaded = total;
+        endRemoveRows();
+    }
+    invalidate(0, loaded);
+    if (total > loaded) {
+        fetchMore(QModelIndex());
+    }
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,34 @@
+#ifndef GOLAZYMODEL_H
+#define GOLAZYMODEL_H
+
+#include <QAbstractListModel>
+
+#include "capi.h"
+
+class GoLazyModel : public QAbstractListModel
+{
+public:
+    GoLazyModel(GoAddr *addr, QObject *parent);
+
+    virtual ~GoLazyModel();
+
+    virtual int rowCount(const QModelIndex &parent = QModelIndex()) const;
+    virtual QVariant data(const QModelIndex &index, int role = Qt::DisplayRole) const;
+    virtual QHash<int, QByteArray> roleNames() const;
+
+    virtual bool canFetchMore(const QModelIndex &parent) const;
+    virtual void fetchMore(const QModelIndex &parent);
+
+    void setPageSize(int size);
+    void invalidate(int offset, int count);
+    void refresh();
+
+private:
+    GoAddr *addr;
+    int loaded;
+    int pageSize;
+};
+
+#endif // GOLAZYMODEL_H
+
+// vim:ts=4:et
@@ -0,0 +1,78 @@
+#include <QQmlEngine>
+
+#include "golistmodel.h"
+#include "capi.h"
+
+GoListModel::GoListModel(GoAddr *addr, const QList<QByteArray> &roles, QObject *parent)
+    : QAbstractListModel(parent), addr(addr), roles(roles)
+{
+}
+
+GoListModel::~GoListModel()
+{
+    hookListModelDestroyed(addr);
+}
+
+int GoListModel::rowCount(const QModelIndex &parent) const
+{
+    return parent.isValid() ? 0 : hookListModelCount(addr);
+}
+
+QVariant GoListModel::data(const QModelIndex &index, int role) const
+{
+    QVariant result;
+    int field = role - Qt::UserRole - 1;
+    if (!index.isValid() || field < 0 || field >= roles.size()) {
+        return result;
+    }
+    DataValue value;
+    hookListModelData(qmlEngine(this), addr, index.row(), field, &value);
+    unpackDataValue(&value, &result);
+    return result;
+}
+
+QHash<int, QByteArray> GoListModel::roleNames() const
+{
+    QHash<int, QByteArray> names;
+    for (int i = 0; i < roles.size(); i++) {
+        names[Qt::UserRole + 1 + i] = roles[i];
+    }
+    return names;
+}
+
+void GoListModel::beginInsert(int first, int last)
+{
+    beginInsertRows(QModelIndex(), first, last);
+}
+
+void GoListModel::endInsert()
+{
+    endInsertRows();
+}
+
+void GoListModel::beginRemove(int first, int last)
+{
+    beginRemoveRows(QModelIndex(), first, last);
+}
+
+void GoListModel::endRemove()
+{
+    endRemoveRows();
+}
+
+void GoListModel::changed(int first, int last)
+{
+    emit dataChanged(index(first), index(last));
+}
+
+void GoListModel::beginReset()
+{
+    beginResetModel();
+}
+
+void GoListModel::endReset()
+{
+    endResetModel();
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,34 @@
+#ifndef GOLISTMODEL_H
+#define GOLISTMODEL_H
+
+#include <QAbstractListModel>
+
+#include "capi.h"
+
+class GoListModel : public QAbstractListModel
+{
+public:
+    GoListModel(GoAddr *addr, const QList<QByteArray> &roles, QObject *parent);
+
+    virtual ~GoListModel();
+
+    virtual int rowCount(const QModelIndex &parent = QModelIndex()) const;
+    virtual QVariant data(const QModelIndex &index, int role = Qt::DisplayRole) const;
+    virtual QHash<int, QByteArray> roleNames() const;
+
+    void beginInsert(int first, int last);
+    void endInsert();
+    void beginRemove(int first, int last);
+    void endRemove();
+    void changed(int first, int last);
+    void beginReset();
+    void endReset();
+
+private:
+    GoAddr *addr;
+    QList<QByteArray> roles;
+};
+
+#endif // GOLISTMODEL_H
+
+// vim:ts=4:et
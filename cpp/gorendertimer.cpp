@@ -0,0 +1,87 @@
+#include "gorendertimer.h"
+#include "capi.h"
+
+// The number of most recent frames held.
+static const int renderTimerCapacity = 120;
+
+GoRenderTimer::GoRenderTimer(QQuickWindow *window)
+    : QObject(window), window(window), enabled(false), ring(3 * renderTimerCapacity), next(0), count(0)
+{
+    stages[0] = stages[1] = stages[2] = 0;
+
+    // The signals are emitted from the render thread with the threaded
+    // render loop, so the stages are timed in place, without queuing.
+    connections << QObject::connect(window, &QQuickWindow::beforeSynchronizing, [=]() {
+        timer.start();
+    });
+    connections << QObject::connect(window, &QQuickWindow::beforeRendering, [=]() {
+        if (timer.isValid()) {
+            stages[0] = timer.nsecsElapsed();
+        }
+    });
+    connections << QObject::connect(window, &QQuickWindow::afterRendering, [=]() {
+        if (timer.isValid()) {
+            stages[1] = timer.nsecsElapsed();
+        }
+    });
+    connections << QObject::connect(window, &QQuickWindow::frameSwapped, [=]() {
+        if (timer.isValid()) {
+            stages[2] = timer.nsecsElapsed();
+            record();
+            timer.invalidate();
+        }
+    });
+}
+
+GoRenderTimer::~GoRenderTimer()
+{
+    for (int i = 0; i < connections.size(); i++) {
+        QObject::disconnect(connections[i]);
+    }
+    hookRenderTimerDestroyed(window);
+}
+
+// record saves the duration of each stage of the frame just swapped,
+// dropping the oldest frame held if necessary.
+void GoRenderTimer::record()
+{
+    QMutexLocker locker(&mutex);
+    if (!enabled) {
+        return;
+    }
+    ring[3 * next + 0] = stages[0];
+    ring[3 * next + 1] = stages[1] - stages[0];
+    ring[3 * next + 2] = stages[2] - stages[1];
+    next = (next + 1) % renderTimerCapacity;
+    if (count < renderTimerCapacity) {
+        count++;
+    }
+}
+
+void GoRenderTimer::setEnabled(bool enabled)
+{
+    QMutexLocker locker(&mutex);
+    this->enabled = enabled;
+    if (!enabled) {
+        next = count = 0;
+    }
+}
+
+// frames copies the sync, render, and swap durations in nanoseconds of
+// up to max recent frames into timings, oldest first, and returns the
+// number of frames copied.
+int GoRenderTimer::frames(long long *timings, int max)
+{
+    QMutexLocker locker(&mutex);
+    int n = count < max ? count : max;
+    int first = (next - n + renderTimerCapacity) % renderTimerCapacity;
+    for (int i = 0; i < n; i++) {
+        int j = (first + i) % renderTimerCapacity;
+        timings[3 * i + 0] = ring[3 * j + 0];
+        timings[3 * i + 1] = ring[3 * j + 1];
+        timings[3 * i + 2] = ring[3 * j + 2];
+    }
+    return n;
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
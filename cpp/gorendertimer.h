@@ -0,0 +1,41 @@
+#ifndef GORENDERTIMER_H
+#define GORENDERTIMER_H
+
+#include <QElapsedTimer>
+#include <QMutex>
+#include <QQuickWindow>
+#include <QVector>
+
+#include "capi.h"
+
+class GoRenderTimer : public QObject
+{
+public:
+    GoRenderTimer(QQuickWindow *window);
+
+    virtual ~GoRenderTimer();
+
+    void setEnabled(bool enabled);
+    int frames(long long *timings, int max);
+
+private:
+    void record();
+
+    QQuickWindow *window;
+    QList<QMetaObject::Connection> connections;
+
+    // Only accessed from the thread rendering the window.
+    QElapsedTimer timer;
+    qint64 stages[3];
+
+    // Guarded by mutex, as frames are recorded from the render thread.
+    QMutex mutex;
+    bool enabled;
+    QVector<qint64> ring;
+    int next;
+    int count;
+};
+
+#endif // GORENDERTIMER_H
+
+// vim:ts=4:et
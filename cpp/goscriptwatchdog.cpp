@@ -0,0 +1,83 @@
+#include "goscriptwatchdog.h"
+#include "capi.h"
+
+#if QT_VERSION >= QT_VERSION_CHECK(5, 14, 0)
+#include <private/qv4engine_p.h>
+#include <private/qv4stackframe_p.h>
+#endif
+
+// samples is the number of times an execution must be observed running
+// within the timeout for it to be interrupted.
+static const int samples = 20;
+
+GoScriptWatchdog::GoScriptWatchdog(QQmlEngine *engine)
+    : QThread(engine), engine(engine)
+{
+}
+
+GoScriptWatchdog::~GoScriptWatchdog()
+{
+    stopping.store(1);
+    wait();
+}
+
+void GoScriptWatchdog::setTimeout(int msec)
+{
+    timeout.store(msec);
+    if (msec > 0 && !isRunning()) {
+        start();
+    }
+}
+
+bool GoScriptWatchdog::interrupt(QQmlEngine *engine)
+{
+#if QT_VERSION >= QT_VERSION_CHECK(5, 14, 0)
+    // The flag is only checked by running JavaScript code, and remains
+    // set until reset, so it's reset once the GUI loop is back running.
+    engine->setInterrupted(true);
+    QMetaObject::invokeMethod(engine, [=]() { engine->setInterrupted(false); }, Qt::QueuedConnection);
+    return true;
+#else
+    Q_UNUSED(engine);
+    return false;
+#endif
+}
+
+void GoScriptWatchdog::run()
+{
+#if QT_VERSION >= QT_VERSION_CHECK(5, 14, 0)
+    QV4::ExecutionEngine *v4 = engine->handle();
+    int running = 0;
+    while (!stopping.load()) {
+        int msec = timeout.load();
+        if (msec <= 0) {
+            break;
+        }
+        int step = msec / samples;
+        QThread::msleep(step > 0 ? step : 1);
+
+        // A single execution keeps a JavaScript frame on the stack at
+        // every sample, while separate executions, such as the bindings
+        // evaluated for a frame, leave the stack empty in between.
+        QV4::CppStackFrame *frame = v4->currentStackFrame;
+        if (!frame) {
+            running = 0;
+            continue;
+        }
+        if (++running < samples) {
+            continue;
+        }
+        running = 0;
+
+        // The frame is stuck running, so its location may be read
+        // while it runs for reporting.
+        QByteArray source = frame->source().toUtf8();
+        int line = frame->lineNumber();
+        if (interrupt(engine)) {
+            QMessageLogger(source.constData(), line, 0).warning("Error: script interrupted after running for more than %d ms", msec);
+        }
+    }
+#endif
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
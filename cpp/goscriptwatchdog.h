@@ -0,0 +1,35 @@
+#ifndef GOSCRIPTWATCHDOG_H
+#define GOSCRIPTWATCHDOG_H
+
+#include <QAtomicInt>
+#include <QQmlEngine>
+#include <QThread>
+
+#include "capi.h"
+
+// GoScriptWatchdog interrupts JavaScript executions of an engine that run
+// uninterrupted for longer than the configured timeout. It watches the
+// engine from its own thread, as the GUI thread is the one stuck.
+class GoScriptWatchdog : public QThread
+{
+public:
+    GoScriptWatchdog(QQmlEngine *engine);
+
+    virtual ~GoScriptWatchdog();
+
+    void setTimeout(int msec);
+
+    static bool interrupt(QQmlEngine *engine);
+
+protected:
+    void run();
+
+private:
+    QQmlEngine *engine;
+    QAtomicInt timeout;
+    QAtomicInt stopping;
+};
+
+#endif // GOSCRIPTWATCHDOG_H
+
+// vim:ts=4:et
@@ -0,0 +1,55 @@
+#include <QMetaMethod>
+
+#include "gosignalconnector.h"
+#include "capi.h"
+
+// The index of the dynamic slot, past the methods of QObject itself.
+static const int connectorSlotIndex = QObject::staticMetaObject.methodCount();
+
+GoSignalConnector::GoSignalConnector(QObject *sender, int signalIndex, GoAddr *conn)
+    : QObject(sender), sender(sender), signalIndex(signalIndex), conn(conn)
+{
+    QMetaMethod signal = sender->metaObject()->method(signalIndex);
+    for (int i = 0; i < signal.parameterCount(); i++) {
+        paramTypes.append(signal.parameterType(i));
+    }
+    QMetaObject::connect(sender, signalIndex, this, connectorSlotIndex, Qt::DirectConnection);
+}
+
+GoSignalConnector::~GoSignalConnector()
+{
+    hookSignalConnectionDestroyed(conn);
+}
+
+// reconnect connects the signal again, so that it's delivered after
+// the connections made to it meanwhile, as Qt delivers signals in the
+// order connections are made.
+void GoSignalConnector::reconnect()
+{
+    QMetaObject::disconnect(sender, signalIndex, this, connectorSlotIndex);
+    QMetaObject::connect(sender, signalIndex, this, connectorSlotIndex, Qt::DirectConnection);
+}
+
+int GoSignalConnector::qt_metacall(QMetaObject::Call c, int idx, void **a)
+{
+    if (c != QMetaObject::InvokeMetaMethod || idx != connectorSlotIndex) {
+        return QObject::qt_metacall(c, idx, a);
+    }
+    DataValue args[MaximumParamCount];
+    for (int i = 0; i < paramTypes.size(); i++) {
+        int type = paramTypes[i];
+        QVariant var;
+        if (type == QMetaType::QVariant) {
+            var = *reinterpret_cast<QVariant *>(a[i+1]);
+        } else if (QMetaType::typeFlags(type) & QMetaType::PointerToQObject) {
+            var = QVariant::fromValue(*reinterpret_cast<QObject **>(a[i+1]));
+        } else {
+            var = QVariant(type, a[i+1]);
+        }
+        packDataValue(&var, &args[i]);
+    }
+    hookSignalCall(conn, args);
+    return -1;
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,30 @@
+#ifndef GOSIGNALCONNECTOR_H
+#define GOSIGNALCONNECTOR_H
+
+#include <QObject>
+
+#include "capi.h"
+
+class GoSignalConnector : public QObject
+{
+public:
+    GoSignalConnector(QObject *sender, int signalIndex, GoAddr *conn);
+
+    virtual ~GoSignalConnector();
+
+    void reconnect();
+
+    // Receives the signal emissions via the dynamic slot connected
+    // to the signal, in the absence of a moc-generated slot.
+    virtual int qt_metacall(QMetaObject::Call c, int idx, void **a);
+
+private:
+    QObject *sender;
+    int signalIndex;
+    GoAddr *conn;
+    QList<int> paramTypes;
+};
+
+#endif // GOSIGNALCONNECTOR_H
+
+// vim:ts=4:et
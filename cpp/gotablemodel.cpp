@@ -0,0 +1,111 @@
+#include <QQmlEngine>
+
+#include "gotablemodel.h"
+#include "capi.h"
+
+GoTableModel::GoTableModel(GoAddr *addr, const QList<QByteArray> &roles, QObject *parent)
+    : QAbstractTableModel(parent), addr(addr), roles(roles)
+{
+}
+
+GoTableModel::~GoTableModel()
+{
+    hookTableModelDestroyed(addr);
+}
+
+int GoTableModel::rowCount(const QModelIndex &parent) const
+{
+    return parent.isValid() ? 0 : hookTableModelCount(addr);
+}
+
+int GoTableModel::columnCount(const QModelIndex &parent) const
+{
+    return parent.isValid() ? 0 : roles.size();
+}
+
+QVariant GoTableModel::data(const QModelIndex &index, int role) const
+{
+    QVariant result;
+    if (!index.isValid()) {
+        return result;
+    }
+
+    // Views that address columns by index ask for the display role,
+    // while the ones that address them by name ask for the role.
+    int column = role == Qt::DisplayRole ? index.column() : role - Qt::UserRole - 1;
+    if (column < 0 || column >= roles.size()) {
+        return result;
+    }
+    DataValue value;
+    hookTableModelData(qmlEngine(this), addr, index.row(), column, &value);
+    unpackDataValue(&value, &result);
+    return result;
+}
+
+QHash<int, QByteArray> GoTableModel::roleNames() const
+{
+    QHash<int, QByteArray> names;
+    names[Qt::DisplayRole] = "display";
+    for (int i = 0; i < roles.size(); i++) {
+        names[Qt::UserRole + 1 + i] = roles[i];
+    }
+    return names;
+}
+
+void GoTableModel::beginInsert(int first, int last)
+{
+    beginInsertRows(QModelIndex(), first, last);
+}
+
+void GoTableModel::endInsert()
+{
+    endInsertRows();
+}
+
+void GoTableModel::beginRemove(int first, int last)
+{
+    beginRemoveRows(QModelIndex(), first, last);
+}
+
+void GoTableModel::endRemove()
+{
+    endRemoveRows();
+}
+
+void GoTableModel::changed(int first, int last)
+{
+    emit dataChanged(index(first, 0), index(last, roles.size() - 1));
+}
+
+void GoTableModel::beginReset()
+{
+    beginResetModel();
+}
+
+void GoTableModel::endReset()
+{
+    endResetModel();
+}
+
+void GoTableModel::beginLayout()
+{
+    emit layoutAboutToBeChanged();
+}
+
+void GoTableModel::endLayout(const int *newRows, int len)
+{
+    // Move the indexes held by views to the new rows of their items.
+    QModelIndexList from = persistentIndexList();
+    QModelIndexList to;
+    foreach (const QModelIndex &index, from) {
+        if (index.row() < len) {
+            to.append(this->index(newRows[index.row()], index.column()));
+        } else {
+            to.append(QModelIndex());
+        }
+    }
+    changePersistentIndexList(from, to);
+    emit layoutChanged();
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
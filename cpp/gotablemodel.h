@@ -0,0 +1,37 @@
+#ifndef GOTABLEMODEL_H
+#define GOTABLEMODEL_H
+
+#include <QAbstractTableModel>
+
+#include "capi.h"
+
+class GoTableModel : public QAbstractTableModel
+{
+public:
+    GoTableModel(GoAddr *addr, const QList<QByteArray> &roles, QObject *parent);
+
+    virtual ~GoTableModel();
+
+    virtual int rowCount(const QModelIndex &parent = QModelIndex()) const;
+    virtual int columnCount(const QModelIndex &parent = QModelIndex()) const;
+    virtual QVariant data(const QModelIndex &index, int role = Qt::DisplayRole) const;
+    virtual QHash<int, QByteArray> roleNames() const;
+
+    void beginInsert(int first, int last);
+    void endInsert();
+    void beginRemove(int first, int last);
+    void endRemove();
+    void changed(int first, int last);
+    void beginReset();
+    void endReset();
+    void beginLayout();
+    void endLayout(const int *newRows, int len);
+
+private:
+    GoAddr *addr;
+    QList<QByteArray> roles;
+};
+
+#endif // GOTABLEMODEL_H
+
+// vim:ts=4:et
@@ -0,0 +1,82 @@
+#include <QEvent>
+
+#include <private/qquickwindow_p.h>
+#include <private/qsgrenderloop_p.h>
+
+#include "goupdateblocker.h"
+#include "capi.h"
+
+GoUpdateBlocker::GoUpdateBlocker(QQuickWindow *window)
+    : QObject(window), window(window), windowManager(0)
+{
+    window->installEventFilter(this);
+}
+
+GoUpdateBlocker::~GoUpdateBlocker()
+{
+    // Updates are resumed before the window is deleted, either by Go or
+    // when the deferred deletion is delivered.
+    hookUpdateBlockerDestroyed(window);
+}
+
+// suspend detaches the window from its render loop, as done by Qt for
+// windows rendered via QQuickRenderControl. The window then requests
+// neither synchronizing nor rendering its scene graph, whatever thread
+// the render loop runs on, and changes to its items pile up as dirty
+// until the render loop is attached again.
+void GoUpdateBlocker::suspend()
+{
+    QQuickWindowPrivate *d = QQuickWindowPrivate::get(window);
+    if (windowManager || !d->windowManager) {
+        return;
+    }
+    windowManager = d->windowManager;
+    d->windowManager = 0;
+}
+
+// resume attaches the window to its render loop again and, if render is
+// set and the window is exposed, has it synchronized and rendered once
+// with all changes made meanwhile, as done when the window is exposed.
+void GoUpdateBlocker::resume(bool render)
+{
+    if (!windowManager) {
+        return;
+    }
+    QSGRenderLoop *manager = windowManager;
+    windowManager = 0;
+    QQuickWindowPrivate::get(window)->windowManager = manager;
+    if (render && window->isExposed()) {
+        manager->exposureChanged(window);
+    }
+}
+
+bool GoUpdateBlocker::eventFilter(QObject *watched, QEvent *event)
+{
+    if (watched != window || !windowManager) {
+        return false;
+    }
+    switch (event->type()) {
+    case QEvent::DeferredDelete:
+        // The render loop must forget the window as it's deleted.
+        resume(false);
+        return false;
+    case QEvent::Show:
+    case QEvent::Hide:
+#if QT_VERSION >= QT_VERSION_CHECK(5, 5, 0)
+    case QEvent::PlatformSurface:
+#endif
+        {
+            // The render loop must track whether the window is shown
+            // and has a surface, so it's attached while handling these.
+            QQuickWindowPrivate *d = QQuickWindowPrivate::get(window);
+            d->windowManager = windowManager;
+            window->event(event);
+            d->windowManager = 0;
+            return true;
+        }
+    default:
+        return false;
+    }
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,32 @@
+#ifndef GOUPDATEBLOCKER_H
+#define GOUPDATEBLOCKER_H
+
+#include <QQuickWindow>
+
+#include "capi.h"
+
+class QSGRenderLoop;
+
+class GoUpdateBlocker : public QObject
+{
+public:
+    GoUpdateBlocker(QQuickWindow *window);
+
+    virtual ~GoUpdateBlocker();
+
+    void suspend();
+    void resume(bool render);
+
+protected:
+    bool eventFilter(QObject *watched, QEvent *event);
+
+private:
+    QQuickWindow *window;
+
+    // The render loop of the window, held while updates are suspended.
+    QSGRenderLoop *windowManager;
+};
+
+#endif // GOUPDATEBLOCKER_H
+
+// vim:ts=4:et
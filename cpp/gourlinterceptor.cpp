@@ -0,0 +1,24 @@
+#include <stdlib.h>
+
+#include "gourlinterceptor.h"
+#include "capi.h"
+
+GoUrlInterceptor::GoUrlInterceptor(QQmlEngine_ *engine)
+    : engine(engine)
+{
+}
+
+QUrl GoUrlInterceptor::intercept(const QUrl &url, DataType type)
+{
+    // Called from the thread loading types as well as from the GUI thread.
+    QByteArray ba = url.toString().toUtf8();
+    char *result = hookUrlIntercept(engine, ba.constData(), ba.size(), int(type));
+    if (!result) {
+        return url;
+    }
+    QUrl qurl(QString::fromUtf8(result));
+    free(result);
+    return qurl;
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,21 @@
+#ifndef GOURLINTERCEPTOR_H
+#define GOURLINTERCEPTOR_H
+
+#include <QQmlAbstractUrlInterceptor>
+
+#include "capi.h"
+
+class GoUrlInterceptor : public QQmlAbstractUrlInterceptor
+{
+public:
+    GoUrlInterceptor(QQmlEngine_ *engine);
+
+    virtual QUrl intercept(const QUrl &url, DataType type);
+
+private:
+    QQmlEngine_ *engine;
+};
+
+#endif // GOURLINTERCEPTOR_H
+
+// vim:ts=4:et
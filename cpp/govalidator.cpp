@@ -0,0 +1,36 @@
+#include <stdlib.h>
+
+#include "govalidator.h"
+#include "capi.h"
+
+GoValidator::GoValidator(GoAddr *addr, QObject *parent)
+    : QValidator(parent), addr(addr)
+{
+}
+
+GoValidator::~GoValidator()
+{
+    hookValidatorDestroyed(addr);
+}
+
+QValidator::State GoValidator::validate(QString &input, int &pos) const
+{
+    // The Go side deals with byte offsets into the UTF-8 encoded input.
+    QByteArray ba = input.toUtf8();
+    int bpos = input.left(pos).toUtf8().size();
+
+    char *fixed = 0;
+    int fixedLen = 0;
+    int state = hookValidatorValidate(addr, ba.data(), ba.size(), &bpos, &fixed, &fixedLen);
+    if (fixed) {
+        QByteArray fixedba(fixed, fixedLen);
+        free(fixed);
+        input = QString::fromUtf8(fixedba);
+        pos = QString::fromUtf8(fixedba.left(bpos)).size();
+    } else {
+        pos = QString::fromUtf8(ba.left(bpos)).size();
+    }
+    return State(state);
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
@@ -0,0 +1,23 @@
+#ifndef GOVALIDATOR_H
+#define GOVALIDATOR_H
+
+#include <QValidator>
+
+#include "capi.h"
+
+class GoValidator : public QValidator
+{
+public:
+    GoValidator(GoAddr *addr, QObject *parent);
+
+    virtual ~GoValidator();
+
+    virtual State validate(QString &input, int &pos) const;
+
+private:
+    GoAddr *addr;
+};
+
+#endif // GOVALIDATOR_H
+
+// vim:ts=4:et
@@ -1,6 +1,8 @@
-
 #include <private/qmetaobjectbuilder_p.h>
 
+#include <QHoverEvent>
+#include <QKeyEvent>
+#include <QMouseEvent>
 #include <QQmlEngine>
 #include <QtQml/qqml.h>
 #include <QDebug>
@@ -8,34 +10,34 @@
 #include "govalue.h"
 #include "capi.h"
 
-class GoValuePrivate;
-class GoValueMetaObject : public QAbstractDynamicMetaObject
-{
-public:
-    GoValueMetaObject(GoValue* value, GoValuePrivate *valuePriv, GoTypeInfo *typeInfo);
-
-protected:
-    int metaCall(QMetaObject::Call c, int id, void **a);
-
-private:
-    GoValue *value;
-    GoValuePrivate *valuePriv;
-};
-
 class GoValuePrivate : public QObjectPrivate
 {
     Q_DECLARE_PUBLIC(GoValue)
 public:
     GoValueMetaObject *valueMeta;
-    GoTypeInfo *typeInfo;
     GoAddr *addr;
 };
 
-GoValueMetaObject::GoValueMetaObject(GoValue *value_, GoValuePrivate *valuePriv_, GoTypeInfo *typeInfo)
-    : value(value_), valuePriv(valuePriv_)
+// throwGoError throws the error message held by dvalue into the
+// JavaScript code that accessed value.
+static void throwGoError(QObject *value, DataValue *dvalue)
+{
+    QString message = QString::fromUtf8(*(char **)dvalue->data, dvalue->len);
+#if QT_VERSION >= QT_VERSION_CHECK(5, 12, 0)
+    QQmlEngine *engine = qmlEngine(value);
+    if (engine) {
+        engine->throwError(message);
+        return;
+    }
+#endif
+    qWarning().noquote() << message;
+}
+
+GoValueMetaObject::GoValueMetaObject(QObject *value_, GoAddr *addr_, GoTypeInfo *typeInfo_, const QMetaObject *metaObject)
+    : value(value_), addr(addr_), typeInfo(typeInfo_)
 {
     //d->parent = static_cast<QAbstractDynamicMetaObject *>(priv->metaObject);
-    *static_cast<QMetaObject *>(this) = *GoValue::metaObjectFor(typeInfo);
+    *static_cast<QMetaObject *>(this) = *metaObject;
 
     QObjectPrivate *objPriv = QObjectPrivate::get(value);
     objPriv->metaObject = this;
@@ -51,19 +53,26 @@ int GoValueMetaObject::metaCall(QMetaObject::Call c, int idx, void **a)
             if (idx < propertyOffset()) {
                 return value->qt_metacall(c, idx, a);
             }
-            GoMemberInfo *memberInfo = valuePriv->typeInfo->fields;
-            for (int i = 0; i < valuePriv->typeInfo->fieldsLen; i++) {
-                if (memberInfo->metaIndex == idx) {
+            GoMemberInfo *memberInfo = typeInfo->fields;
+            for (int i = 0; i < typeInfo->fieldsLen; i++) {
+                if (memberInfo->metaIndex == idx - propertyOffset()) {
                     if (c == QMetaObject::ReadProperty) {
                         DataValue result;
-                        hookGoValueReadField(qmlEngine(value), valuePriv->addr, memberInfo->reflectIndex, &result);
+                        hookGoValueReadField(qmlEngine(value), addr, memberInfo->reflectIndex, &result);
+                        if (result.dataType == DTError) {
+                            throwGoError(value, &result);
+                            return -1;
+                        }
                         QVariant *out = reinterpret_cast<QVariant *>(a[0]);
                         unpackDataValue(&result, out);
                     } else {
                         DataValue assign;
                         QVariant *in = reinterpret_cast<QVariant *>(a[0]);
                         packDataValue(in, &assign);
-                        hookGoValueWriteField(qmlEngine(value), valuePriv->addr, memberInfo->reflectIndex, &assign);
+                        hookGoValueWriteField(qmlEngine(value), addr, memberInfo->reflectIndex, &assign);
+                        if (assign.dataType == DTError) {
+                            throwGoError(value, &assign);
+                        }
                     }
                     return -1;
                 }
@@ -78,22 +87,34 @@ int GoValueMetaObject::metaCall(QMetaObject::Call c, int idx, void **a)
             if (idx < methodOffset()) {
                 return value->qt_metacall(c, idx, a);
             }
-            GoMemberInfo *memberInfo = valuePriv->typeInfo->methods;
-            for (int i = 0; i < valuePriv->typeInfo->methodsLen; i++) {
-                if (memberInfo->metaIndex == idx) {
+            GoMemberInfo *memberInfo = typeInfo->methods;
+            for (int i = 0; i < typeInfo->methodsLen; i++) {
+                if (memberInfo->metaIndex == idx - methodOffset()) {
                     // args[0] is the result if any.
                     DataValue args[MaximumParamCount];
+                    args[0].dataType = DTUnknown;
                     for (int i = 1; i < memberInfo->numIn+1; i++) {
                         packDataValue(reinterpret_cast<QVariant *>(a[i]), &args[i]);
                     }
-                    hookGoValueCallMethod(qmlEngine(value), valuePriv->addr, memberInfo->reflectIndex, args);
-                    if (memberInfo->numOut > 0) {
+                    hookGoValueCallMethod(qmlEngine(value), addr, memberInfo->reflectIndex, args);
+                    if (args[0].dataType == DTError) {
+                        throwGoError(value, &args[0]);
+                    } else if (memberInfo->numOut > 0) {
                         unpackDataValue(&args[0], reinterpret_cast<QVariant *>(a[0]));
                     }
                     return -1;
                 }
                 memberInfo++;
             }
+            memberInfo = typeInfo->signalMembers;
+            for (int i = 0; i < typeInfo->signalMembersLen; i++) {
+                if (memberInfo->metaIndex == idx - methodOffset()) {
+                    // Invoking a signal emits it.
+                    activate(value, idx, a);
+                    return -1;
+                }
+                memberInfo++;
+            }
             QMetaMethod m = method(idx);
             qWarning() << "Method" << m.name() << "not found!?";
             break;
@@ -104,13 +125,24 @@ int GoValueMetaObject::metaCall(QMetaObject::Call c, int idx, void **a)
     return -1;
 }
 
+void GoValueMetaObject::activateField(int propIndex)
+{
+    // Properties are added first, so the first fieldLen methods are in
+    // fact the signals of the respective properties.
+    activate(value, methodOffset() + propIndex, 0);
+}
+
+void GoValueMetaObject::emitSignal(int metaIndex, void **args)
+{
+    activate(value, methodOffset() + metaIndex, args);
+}
+
 GoValue::GoValue(GoAddr *addr, GoTypeInfo *typeInfo, QObject *parent)
         : QObject(*(new GoValuePrivate()), parent)
 {
     Q_D(GoValue);
     d->addr = addr;
-    d->typeInfo = typeInfo;
-    d->valueMeta = new GoValueMetaObject(this, d, typeInfo);
+    d->valueMeta = new GoValueMetaObject(this, addr, typeInfo, metaObjectFor(typeInfo));
 }
 
 GoValue::~GoValue()
@@ -125,13 +157,291 @@ GoAddr *GoValue::addr()
     return d->addr;
 }
 
-void GoValue::activate(int propIndex) {
+GoValueMetaObject *GoValue::valueMeta()
+{
     Q_D(GoValue);
+    return d->valueMeta;
+}
 
-    // Properties are added first, so the first fieldLen methods are in
-    // fact the signals of the respective properties.
-    int relativeIndex = propIndex - d->valueMeta->propertyOffset();
-    d->valueMeta->activate(this, d->valueMeta->methodOffset() + relativeIndex, 0);
+// deliverKeyEvent hands event to the Go value at addr, accepting or
+// ignoring it as the value decides, and returns whether the value
+// handles events of that type at all.
+static bool deliverKeyEvent(GoAddr *addr, QKeyEvent *event)
+{
+    QByteArray text = event->text().toUtf8();
+    InputEvent ev;
+    memset(&ev, 0, sizeof(ev));
+    ev.type = event->type();
+    ev.key = event->key();
+    ev.text = text.constData();
+    ev.textLen = text.size();
+    ev.modifiers = event->modifiers();
+    ev.timestamp = event->timestamp();
+    int result = hookGoValueKeyEvent(addr, &ev, event->isAutoRepeat());
+    if (result < 0) {
+        return false;
+    }
+    event->setAccepted(result != 0);
+    return true;
+}
+
+// deliverMouseEvent hands a mouse or hover event at pos relative to the
+// item to the Go value at addr, accepting or ignoring it as the value
+// decides, and returns whether the value handles events of that type.
+static bool deliverMouseEvent(GoAddr *addr, QInputEvent *event, const QPointF &pos, int button, int buttons)
+{
+    InputEvent ev;
+    memset(&ev, 0, sizeof(ev));
+    ev.type = event->type();
+    ev.x = pos.x();
+    ev.y = pos.y();
+    ev.button = button;
+    ev.buttons = buttons;
+    ev.modifiers = event->modifiers();
+    ev.timestamp = event->timestamp();
+    int result = hookGoValueMouseEvent(addr, &ev);
+    if (result < 0) {
+        return false;
+    }
+    event->setAccepted(result != 0);
+    return true;
+}
+
+static bool deliverMouseEvent(GoAddr *addr, QMouseEvent *event)
+{
+    return deliverMouseEvent(addr, event, event->localPos(), event->button(), event->buttons());
+}
+
+static bool deliverHoverEvent(GoAddr *addr, QHoverEvent *event)
+{
+    return deliverMouseEvent(addr, event, event->posF(), Qt::NoButton, Qt::NoButton);
+}
+
+GoPaintedValue::GoPaintedValue(GoAddr *addr, GoTypeInfo *typeInfo, const QMetaObject *metaObject, QQuickItem *parent)
+    : QQuickPaintedItem(parent), goAddr(addr)
+{
+    meta = new GoValueMetaObject(this, addr, typeInfo, metaObject);
+}
+
+GoPaintedValue::~GoPaintedValue()
+{
+    hookGoValueDestroyed(qmlEngine(this), goAddr);
+}
+
+GoAddr *GoPaintedValue::addr()
+{
+    return goAddr;
+}
+
+GoValueMetaObject *GoPaintedValue::valueMeta()
+{
+    return meta;
+}
+
+void GoPaintedValue::paint(QPainter *painter)
+{
+    hookGoValuePaint(goAddr, painter, width(), height());
+}
+
+void GoPaintedValue::geometryChanged(const QRectF &newGeometry, const QRectF &oldGeometry)
+{
+    QQuickPaintedItem::geometryChanged(newGeometry, oldGeometry);
+    if (newGeometry.size() != oldGeometry.size()) {
+        hookGoValueResized(goAddr, newGeometry.width(), newGeometry.height());
+        update();
+    }
+}
+
+void GoPaintedValue::keyPressEvent(QKeyEvent *event)
+{
+    if (!deliverKeyEvent(goAddr, event)) {
+        QQuickPaintedItem::keyPressEvent(event);
+    }
+}
+
+void GoPaintedValue::keyReleaseEvent(QKeyEvent *event)
+{
+    if (!deliverKeyEvent(goAddr, event)) {
+        QQuickPaintedItem::keyReleaseEvent(event);
+    }
+}
+
+void GoPaintedValue::mousePressEvent(QMouseEvent *event)
+{
+    if (!deliverMouseEvent(goAddr, event)) {
+        QQuickPaintedItem::mousePressEvent(event);
+    }
+}
+
+void GoPaintedValue::mouseMoveEvent(QMouseEvent *event)
+{
+    if (!deliverMouseEvent(goAddr, event)) {
+        QQuickPaintedItem::mouseMoveEvent(event);
+    }
+}
+
+void GoPaintedValue::mouseReleaseEvent(QMouseEvent *event)
+{
+    if (!deliverMouseEvent(goAddr, event)) {
+        QQuickPaintedItem::mouseReleaseEvent(event);
+    }
+}
+
+void GoPaintedValue::mouseUngrabEvent()
+{
+    hookGoValueMouseUngrab(goAddr);
+}
+
+void GoPaintedValue::hoverEnterEvent(QHoverEvent *event)
+{
+    if (!deliverHoverEvent(goAddr, event)) {
+        QQuickPaintedItem::hoverEnterEvent(event);
+    }
+}
+
+void GoPaintedValue::hoverMoveEvent(QHoverEvent *event)
+{
+    if (!deliverHoverEvent(goAddr, event)) {
+        QQuickPaintedItem::hoverMoveEvent(event);
+    }
+}
+
+void GoPaintedValue::hoverLeaveEvent(QHoverEvent *event)
+{
+    if (!deliverHoverEvent(goAddr, event)) {
+        QQuickPaintedItem::hoverLeaveEvent(event);
+    }
+}
+
+GoGLValue::GoGLValue(GoAddr *addr, GoTypeInfo *typeInfo, const QMetaObject *metaObject, int stage_, QQuickItem *parent)
+    : QQuickItem(parent), goAddr(addr), stage(stage_), visible(false)
+{
+    meta = new GoValueMetaObject(this, addr, typeInfo, metaObject);
+}
+
+GoGLValue::~GoGLValue()
+{
+    disconnectWindow();
+    hookGoValueDestroyed(qmlEngine(this), goAddr);
+}
+
+GoAddr *GoGLValue::addr()
+{
+    return goAddr;
+}
+
+GoValueMetaObject *GoGLValue::valueMeta()
+{
+    return meta;
+}
+
+void GoGLValue::itemChange(ItemChange change, const ItemChangeData &data)
+{
+    QQuickItem::itemChange(change, data);
+    if (change == ItemSceneChange) {
+        disconnectWindow();
+        if (data.window) {
+            connectWindow(data.window);
+        }
+    }
+}
+
+void GoGLValue::keyPressEvent(QKeyEvent *event)
+{
+    if (!deliverKeyEvent(goAddr, event)) {
+        QQuickItem::keyPressEvent(event);
+    }
+}
+
+void GoGLValue::keyReleaseEvent(QKeyEvent *event)
+{
+    if (!deliverKeyEvent(goAddr, event)) {
+        QQuickItem::keyReleaseEvent(event);
+    }
+}
+
+void GoGLValue::mousePressEvent(QMouseEvent *event)
+{
+    if (!deliverMouseEvent(goAddr, event)) {
+        QQuickItem::mousePressEvent(event);
+    }
+}
+
+void GoGLValue::mouseMoveEvent(QMouseEvent *event)
+{
+    if (!deliverMouseEvent(goAddr, event)) {
+        QQuickItem::mouseMoveEvent(event);
+    }
+}
+
+void GoGLValue::mouseReleaseEvent(QMouseEvent *event)
+{
+    if (!deliverMouseEvent(goAddr, event)) {
+        QQuickItem::mouseReleaseEvent(event);
+    }
+}
+
+void GoGLValue::mouseUngrabEvent()
+{
+    hookGoValueMouseUngrab(goAddr);
+}
+
+void GoGLValue::hoverEnterEvent(QHoverEvent *event)
+{
+    if (!deliverHoverEvent(goAddr, event)) {
+        QQuickItem::hoverEnterEvent(event);
+    }
+}
+
+void GoGLValue::hoverMoveEvent(QHoverEvent *event)
+{
+    if (!deliverHoverEvent(goAddr, event)) {
+        QQuickItem::hoverMoveEvent(event);
+    }
+}
+
+void GoGLValue::hoverLeaveEvent(QHoverEvent *event)
+{
+    if (!deliverHoverEvent(goAddr, event)) {
+        QQuickItem::hoverLeaveEvent(event);
+    }
+}
+
+void GoGLValue::connectWindow(QQuickWindow *window)
+{
+    // Both signals are emitted from the render thread, and the lambdas
+    // are run right there. The GUI thread is blocked while synchronizing.
+    syncConnection = QObject::connect(window, &QQuickWindow::beforeSynchronizing, [=]() {
+        QRectF rect = mapRectToScene(QRectF(0, 0, width(), height()));
+        state.x = rect.x();
+        state.y = rect.y();
+        state.width = rect.width();
+        state.height = rect.height();
+        state.windowWidth = window->width();
+        state.windowHeight = window->height();
+        state.devicePixelRatio = window->devicePixelRatio();
+        visible = isVisible();
+    });
+    if (stage == BeforeScene) {
+        window->setClearBeforeRendering(false);
+        renderConnection = QObject::connect(window, &QQuickWindow::beforeRendering, [=]() {
+            if (visible) {
+                hookGoValueGLPaint(goAddr, &state);
+            }
+        });
+    } else {
+        renderConnection = QObject::connect(window, &QQuickWindow::afterRendering, [=]() {
+            if (visible) {
+                hookGoValueGLPaint(goAddr, &state);
+            }
+        });
+    }
+}
+
+void GoGLValue::disconnectWindow()
+{
+    QObject::disconnect(syncConnection);
+    QObject::disconnect(renderConnection);
 }
 
 QMetaObject *GoValue::metaObjectFor(GoTypeInfo *typeInfo)
@@ -139,9 +449,19 @@ QMetaObject *GoValue::metaObjectFor(GoTypeInfo *typeInfo)
     if (typeInfo->metaObject) {
             return reinterpret_cast<QMetaObject *>(typeInfo->metaObject);
     }
+    QMetaObject *mo = buildMetaObject(typeInfo, &QObject::staticMetaObject);
+    typeInfo->metaObject = mo;
+    return mo;
+}
 
+// buildMetaObject returns a new meta object for values of typeInfo
+// deriving from superClass. The meta indexes of the type members are
+// relative to the property and method offsets of the meta object, so
+// they hold for all meta objects built for the type.
+QMetaObject *GoValue::buildMetaObject(GoTypeInfo *typeInfo, const QMetaObject *superClass)
+{
     QMetaObjectBuilder mob;
-    mob.setSuperClass(&QObject::staticMetaObject);
+    mob.setSuperClass(superClass);
     mob.setClassName(typeInfo->typeName);
     mob.setFlags(QMetaObjectBuilder::DynamicMetaObject);
 
@@ -171,24 +491,40 @@ QMetaObject *GoValue::metaObjectFor(GoTypeInfo *typeInfo)
         relativeMethodIndex++;
     }
 
-    QMetaObject *mo = mob.toMetaObject();
-
-    // Turn the relative indexes into absolute indexes.
-    memberInfo = typeInfo->fields;
-    int propOffset = mo->propertyOffset();
-    for (int i = 0; i < typeInfo->fieldsLen; i++) {
-        memberInfo->metaIndex += propOffset;
-        memberInfo++;
-    }
-    memberInfo = typeInfo->methods;
-    int methodOffset = mo->methodOffset();
-    for (int i = 0; i < typeInfo->methodsLen; i++) {
-        memberInfo->metaIndex += methodOffset;
+    memberInfo = typeInfo->signalMembers;
+    for (int i = 0; i < typeInfo->signalMembersLen; i++) {
+        mob.addSignal(memberInfo->methodSignature);
+        memberInfo->metaIndex = relativeMethodIndex;
         memberInfo++;
+        relativeMethodIndex++;
     }
 
-    typeInfo->metaObject = mo;
-    return mo;
+    return mob.toMetaObject();
+}
+
+// addEnums adds to metaObject the enums of the registered type, which are
+// provided by Go as one line per enum holding its name and comma-separated
+// key=value pairs separated by a tab.
+void GoValue::addEnums(QMetaObject *metaObject, GoTypeSpec_ *typeSpec)
+{
+    char *enums = hookGoValueTypeEnums(typeSpec);
+    if (!enums) {
+        return;
+    }
+    QMetaObjectBuilder mob(metaObject);
+    mob.setFlags(QMetaObjectBuilder::DynamicMetaObject);
+    foreach (const QByteArray &line, QByteArray(enums).split('\n')) {
+        int tab = line.indexOf('\t');
+        QMetaEnumBuilder enumb = mob.addEnumerator(line.left(tab));
+        foreach (const QByteArray &pair, line.mid(tab+1).split(',')) {
+            int eq = pair.indexOf('=');
+            if (eq > 0) {
+                enumb.addKey(pair.left(eq), pair.mid(eq+1).toInt());
+            }
+        }
+    }
+    free(enums);
+    *metaObject = *mob.toMetaObject();
 }
 
 
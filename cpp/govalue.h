@@ -6,8 +6,28 @@
 // away, and without it this package wouldn't exist.
 #include <private/qmetaobject_p.h>
 
+#include <QQuickPaintedItem>
+#include <QQuickWindow>
+
 #include "capi.h"
 
+class GoValueMetaObject : public QAbstractDynamicMetaObject
+{
+public:
+    GoValueMetaObject(QObject *value, GoAddr *addr, GoTypeInfo *typeInfo, const QMetaObject *metaObject);
+
+    void activateField(int propIndex);
+    void emitSignal(int metaIndex, void **args);
+
+protected:
+    int metaCall(QMetaObject::Call c, int id, void **a);
+
+private:
+    QObject *value;
+    GoAddr *addr;
+    GoTypeInfo *typeInfo;
+};
+
 class GoValuePrivate;
 class GoValue : public QObject
 {
@@ -17,10 +37,11 @@ public:
     GoValue(GoAddr *addr, GoTypeInfo *typeInfo, QObject *parent);
 
     GoAddr *addr();
-
-    void activate(int propIndex);
+    GoValueMetaObject *valueMeta();
 
     static QMetaObject *metaObjectFor(GoTypeInfo *typeInfo);
+    static QMetaObject *buildMetaObject(GoTypeInfo *typeInfo, const QMetaObject *superClass);
+    static void addEnums(QMetaObject *metaObject, GoTypeSpec_ *typeSpec);
 
     virtual ~GoValue();
 
@@ -28,6 +49,80 @@ private:
     Q_DECLARE_PRIVATE(GoValue)
 };
 
+// GoPaintedValue is a visual item backed by a Go value that paints
+// its contents via the Paint method of the value.
+class GoPaintedValue : public QQuickPaintedItem
+{
+public:
+    GoPaintedValue(GoAddr *addr, GoTypeInfo *typeInfo, const QMetaObject *metaObject, QQuickItem *parent);
+
+    GoAddr *addr();
+    GoValueMetaObject *valueMeta();
+
+    void paint(QPainter *painter);
+
+    virtual ~GoPaintedValue();
+
+protected:
+    void geometryChanged(const QRectF &newGeometry, const QRectF &oldGeometry);
+    void keyPressEvent(QKeyEvent *event);
+    void keyReleaseEvent(QKeyEvent *event);
+    void mousePressEvent(QMouseEvent *event);
+    void mouseMoveEvent(QMouseEvent *event);
+    void mouseReleaseEvent(QMouseEvent *event);
+    void mouseUngrabEvent();
+    void hoverEnterEvent(QHoverEvent *event);
+    void hoverMoveEvent(QHoverEvent *event);
+    void hoverLeaveEvent(QHoverEvent *event);
+
+private:
+    GoAddr *goAddr;
+    GoValueMetaObject *meta;
+};
+
+// GoGLValue is a visual item backed by a Go value that renders
+// its contents with OpenGL via the Paint method of the value.
+class GoGLValue : public QQuickItem
+{
+public:
+    enum Stage { AfterScene, BeforeScene };
+
+    GoGLValue(GoAddr *addr, GoTypeInfo *typeInfo, const QMetaObject *metaObject, int stage, QQuickItem *parent);
+
+    GoAddr *addr();
+    GoValueMetaObject *valueMeta();
+
+    virtual ~GoGLValue();
+
+protected:
+    void itemChange(ItemChange change, const ItemChangeData &data);
+    void keyPressEvent(QKeyEvent *event);
+    void keyReleaseEvent(QKeyEvent *event);
+    void mousePressEvent(QMouseEvent *event);
+    void mouseMoveEvent(QMouseEvent *event);
+    void mouseReleaseEvent(QMouseEvent *event);
+    void mouseUngrabEvent();
+    void hoverEnterEvent(QHoverEvent *event);
+    void hoverMoveEvent(QHoverEvent *event);
+    void hoverLeaveEvent(QHoverEvent *event);
+
+private:
+    void connectWindow(QQuickWindow *window);
+    void disconnectWindow();
+
+    GoAddr *goAddr;
+    GoValueMetaObject *meta;
+    int stage;
+
+    // state is updated while the GUI thread is blocked for synchronizing
+    // with the render thread, and used when rendering.
+    GLState state;
+    bool visible;
+
+    QMetaObject::Connection syncConnection;
+    QMetaObject::Connection renderConnection;
+};
+
 #endif // GOVALUE_H
 
 // vim:ts=4:et
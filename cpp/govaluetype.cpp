@@ -5,8 +5,19 @@
     template<> GoTypeInfo *GoValueType<N>::typeInfo = 0; \
     template<> GoTypeSpec_ *GoValueType<N>::typeSpec = 0;
 
-DEFINE_GOVALUETYPE(1)
+#define DEFINE_GOPAINTEDVALUETYPE(N) \
+    template<> QMetaObject GoPaintedValueType<N>::staticMetaObject = QMetaObject(); \
+    template<> GoTypeInfo *GoPaintedValueType<N>::typeInfo = 0; \
+    template<> GoTypeSpec_ *GoPaintedValueType<N>::typeSpec = 0;
 
-// TODO Define N of these.
+#define DEFINE_GOGLVALUETYPE(N) \
+    template<> QMetaObject GoGLValueType<N>::staticMetaObject = QMetaObject(); \
+    template<> GoTypeInfo *GoGLValueType<N>::typeInfo = 0; \
+    template<> GoTypeSpec_ *GoGLValueType<N>::typeSpec = 0; \
+    template<> int GoGLValueType<N>::stage = 0;
+
+GOVALUETYPE_FOREACH(DEFINE_GOVALUETYPE)
+GOVALUETYPE_FOREACH(DEFINE_GOPAINTEDVALUETYPE)
+GOVALUETYPE_FOREACH(DEFINE_GOGLVALUETYPE)
 
 // vim:sw=4:st=4:et:ft=cpp
@@ -3,23 +3,76 @@
 
 #include "govalue.h"
 
+// GoValueType, GoPaintedValueType, and GoGLValueType are instantiated once
+// per registered type, since each registered type needs its own static meta
+// object. This lists the instances that are available.
+#define GOVALUETYPE_FOREACH(F) \
+    F(1) F(2) F(3) F(4) F(5) F(6) F(7) F(8) F(9) F(10) \
+    F(11) F(12) F(13) F(14) F(15) F(16) F(17) F(18) F(19) F(20) \
+    F(21) F(22) F(23) F(24) F(25) F(26) F(27) F(28) F(29) F(30)
+
 template <int N>
 class GoValueType : public GoValue
 {
 public:
 
     GoValueType()
-        : GoValue(hookGoValueTypeNew(this, typeSpec), typeInfo, 0) {};
+        : GoValue(hookGoValueTypeNew(this, typeSpec), typeInfo, 0) { hookGoValueTypeInit(this, addr()); };
 
     static void init(GoTypeInfo *info, GoTypeSpec_ *spec)
     {
         typeInfo = info;
         typeSpec = spec;
         static_cast<QMetaObject &>(staticMetaObject) = *GoValue::metaObjectFor(typeInfo);
+        GoValue::addEnums(&staticMetaObject, spec);
+    };
+
+    static GoTypeSpec_ *typeSpec;
+    static GoTypeInfo *typeInfo;
+    static QMetaObject staticMetaObject;
+};
+
+template <int N>
+class GoPaintedValueType : public GoPaintedValue
+{
+public:
+
+    GoPaintedValueType()
+        : GoPaintedValue(hookGoValueTypeNew(this, typeSpec), typeInfo, &staticMetaObject, 0) { hookGoValueTypeInit(this, addr()); };
+
+    static void init(GoTypeInfo *info, GoTypeSpec_ *spec)
+    {
+        typeInfo = info;
+        typeSpec = spec;
+        static_cast<QMetaObject &>(staticMetaObject) = *GoValue::buildMetaObject(typeInfo, &QQuickPaintedItem::staticMetaObject);
+        GoValue::addEnums(&staticMetaObject, spec);
+    };
+
+    static GoTypeSpec_ *typeSpec;
+    static GoTypeInfo *typeInfo;
+    static QMetaObject staticMetaObject;
+};
+
+template <int N>
+class GoGLValueType : public GoGLValue
+{
+public:
+
+    GoGLValueType()
+        : GoGLValue(hookGoValueTypeNew(this, typeSpec), typeInfo, &staticMetaObject, stage, 0) { hookGoValueTypeInit(this, addr()); };
+
+    static void init(GoTypeInfo *info, GoTypeSpec_ *spec, int glStage)
+    {
+        typeInfo = info;
+        typeSpec = spec;
+        stage = glStage;
+        static_cast<QMetaObject &>(staticMetaObject) = *GoValue::buildMetaObject(typeInfo, &QQuickItem::staticMetaObject);
+        GoValue::addEnums(&staticMetaObject, spec);
     };
 
     static GoTypeSpec_ *typeSpec;
     static GoTypeInfo *typeInfo;
+    static int stage;
     static QMetaObject staticMetaObject;
 };
 
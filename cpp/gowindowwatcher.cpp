@@ -0,0 +1,35 @@
+#include <QCloseEvent>
+
+#include "gowindowwatcher.h"
+#include "capi.h"
+
+GoWindowWatcher::GoWindowWatcher(QQuickView *view)
+    : QObject(view), view(view)
+{
+    view->installEventFilter(this);
+    QObject::connect(view, &QWindow::visibleChanged, [=](bool visible) {
+        if (!visible) {
+            hookWindowHidden(view);
+        }
+    });
+}
+
+GoWindowWatcher::~GoWindowWatcher()
+{
+    hookWindowUnwatched(view);
+}
+
+bool GoWindowWatcher::eventFilter(QObject *watched, QEvent *event)
+{
+    if (watched != view || event->type() != QEvent::Close) {
+        return false;
+    }
+    if (hookWindowClosing(view) != 0) {
+        return false;
+    }
+    // The close event is only discarded when not accepted.
+    event->ignore();
+    return true;
+}
+
+// vim:ts=4:sw=4:et:ft=cpp
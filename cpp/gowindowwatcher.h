@@ -0,0 +1,24 @@
+#ifndef GOWINDOWWATCHER_H
+#define GOWINDOWWATCHER_H
+
+#include <QQuickView>
+
+#include "capi.h"
+
+class GoWindowWatcher : public QObject
+{
+public:
+    GoWindowWatcher(QQuickView *view);
+
+    virtual ~GoWindowWatcher();
+
+protected:
+    bool eventFilter(QObject *watched, QEvent *event);
+
+private:
+    QQuickView *view;
+};
+
+#endif // GOWINDOWWATCHER_H
+
+// vim:ts=4:et
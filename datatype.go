@@ -6,9 +6,17 @@ import "C"
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/json"
 	"fmt"
+	"image/color"
+	"math"
+	"net/url"
 	"reflect"
+	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -26,9 +34,17 @@ var (
 	typeInt     = reflect.TypeOf(int(0))
 	typeInt64   = reflect.TypeOf(int64(0))
 	typeInt32   = reflect.TypeOf(int32(0))
+	typeUint64  = reflect.TypeOf(uint64(0))
 	typeFloat64 = reflect.TypeOf(float64(0))
 	typeFloat32 = reflect.TypeOf(float32(0))
 	typeIface   = reflect.TypeOf(new(interface{})).Elem()
+
+	typeTime     = reflect.TypeOf(time.Time{})
+	typeDuration = reflect.TypeOf(time.Duration(0))
+
+	typeObjectPtr = reflect.TypeOf(&Object{})
+
+	typeTextUnmarshaler = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
 )
 
 func init() {
@@ -58,12 +74,22 @@ func packDataValue(value interface{}, dvalue *C.DataValue, engine *Engine, owner
 		dvalue.dataType = C.DTInvalid
 		return
 	}
+	// Strings and byte slices are retained as provided, as converting
+	// them back into an interface{} would allocate every time.
+	retained := value
 	switch value := value.(type) {
 	case string:
 		dvalue.dataType = C.DTString
 		cstr, cstrlen := unsafeStringData(value)
 		*(**C.char)(datap) = cstr
 		dvalue.len = cstrlen
+		retainPacked(retained)
+	case []byte:
+		dvalue.dataType = C.DTBytes
+		cdata, cdatalen := unsafeBytesData(value)
+		*(**C.char)(datap) = cdata
+		dvalue.len = cdatalen
+		retainPacked(retained)
 	case bool:
 		dvalue.dataType = C.DTBool
 		*(*bool)(datap) = value
@@ -82,15 +108,269 @@ func packDataValue(value interface{}, dvalue *C.DataValue, engine *Engine, owner
 	case float32:
 		dvalue.dataType = C.DTFloat32
 		*(*float32)(datap) = value
+	case time.Time:
+		dvalue.dataType = C.DTTime
+		*(*int64)(datap) = value.UnixNano() / int64(time.Millisecond)
+		switch value.Location() {
+		case time.UTC:
+			dvalue.len = 0
+		case time.Local:
+			dvalue.len = C.LocalTimeOffset
+		default:
+			_, offset := value.Zone()
+			dvalue.len = C.int(offset)
+		}
+	case time.Duration:
+		dvalue.dataType = C.DTInt64
+		*(*int64)(datap) = int64(value / time.Millisecond)
+	case color.Color:
+		c := color.NRGBAModel.Convert(value).(color.NRGBA)
+		dvalue.dataType = C.DTColor
+		*(*uint32)(datap) = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+	case *url.URL:
+		packDataValue(value.String(), dvalue, engine, owner)
+	case url.URL:
+		packDataValue(value.String(), dvalue, engine, owner)
 	case *Object:
 		dvalue.dataType = C.DTObject
 		*(*unsafe.Pointer)(datap) = value.addr
+	case *LazyModel:
+		if value.engine == nil && engine != nil {
+			// Items of the model may need the engine to be packed.
+			value.engine = engine
+			C.engineSetContextForObject(engine.addr, value.addr)
+		}
+		dvalue.dataType = C.DTObject
+		*(*unsafe.Pointer)(datap) = value.addr
+	case *List:
+		if value.engine == nil && engine != nil {
+			// Items of the list may need the engine to be packed.
+			value.engine = engine
+			C.engineSetContextForObject(engine.addr, value.addr)
+		}
+		dvalue.dataType = C.DTObject
+		*(*unsafe.Pointer)(datap) = value.addr
+	case *TableModel:
+		if value.engine == nil && engine != nil {
+			// Rows of the table may need the engine to be packed.
+			value.engine = engine
+			C.engineSetContextForObject(engine.addr, value.addr)
+		}
+		dvalue.dataType = C.DTObject
+		*(*unsafe.Pointer)(datap) = value.addr
+	case *Store:
+		if value.engine == nil && engine != nil {
+			// Values set so far were waiting for an engine.
+			value.attach(engine)
+		}
+		dvalue.dataType = C.DTObject
+		*(*unsafe.Pointer)(datap) = value.addr
+	case *EventBus:
+		if engine == nil {
+			dvalue.dataType = C.DTInvalid
+			break
+		}
+		dvalue.dataType = C.DTObject
+		*(*unsafe.Pointer)(datap) = value.object(engine).addr
+	case []interface{}:
+		packList(len(value), func(i int) interface{} { return value[i] }, dvalue, engine, owner)
+	case []int:
+		packList(len(value), func(i int) interface{} { return value[i] }, dvalue, engine, owner)
+	case []float64:
+		packList(len(value), func(i int) interface{} { return value[i] }, dvalue, engine, owner)
+	case []string:
+		packList(len(value), func(i int) interface{} { return value[i] }, dvalue, engine, owner)
+	case []bool:
+		packList(len(value), func(i int) interface{} { return value[i] }, dvalue, engine, owner)
+	case map[string]interface{}:
+		packMap(reflect.ValueOf(value), dvalue, engine, owner)
+	case TypedArray:
+		packTypedArray(value, dvalue, engine, owner)
 	default:
+		if useMarshalers && packMarshaled(value, dvalue) {
+			return
+		}
+		switch v := reflect.ValueOf(value); v.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+			// Numeric kinds of other types, including named ones such as
+			// "type Celsius float64", are packed as the closest type QML
+			// holds.
+			dvalue.dataType = C.DTInt32
+			*(*int32)(datap) = int32(v.Convert(typeInt64).Int())
+			return
+		case reflect.Int, reflect.Int64, reflect.Uint32:
+			dvalue.dataType = C.DTInt64
+			*(*int64)(datap) = v.Convert(typeInt64).Int()
+			return
+		case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			if v.Uint() > math.MaxInt64 {
+				panic(fmt.Sprintf("cannot use %T value %d as a QML value: too large for a 64-bit integer", value, v.Uint()))
+			}
+			dvalue.dataType = C.DTInt64
+			*(*int64)(datap) = int64(v.Uint())
+			return
+		case reflect.Float32:
+			dvalue.dataType = C.DTFloat32
+			*(*float32)(datap) = float32(v.Float())
+			return
+		case reflect.Float64:
+			dvalue.dataType = C.DTFloat64
+			*(*float64)(datap) = v.Float()
+			return
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				panic(fmt.Sprintf("cannot use %T as a QML value: map keys must be strings", value))
+			}
+			packMap(v, dvalue, engine, owner)
+			return
+		case reflect.Slice:
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				break
+			}
+			// Struct items are wrapped by address, so that QML code
+			// observes and changes the items in the slice itself.
+			packList(v.Len(), func(i int) interface{} {
+				item := v.Index(i)
+				if item.Kind() == reflect.Struct {
+					return item.Addr().Interface()
+				}
+				return item.Interface()
+			}, dvalue, engine, owner)
+			return
+		}
 		dvalue.dataType = C.DTObject
 		*(*unsafe.Pointer)(datap) = wrapGoValue(engine, value, owner)
 	}
 }
 
+// useMarshalers defines whether values are converted via the interfaces
+// in the encoding and encoding/json packages. It is set once at
+// initialization time via InitOptions.
+var useMarshalers bool
+
+// marshalError reports the failure of a MarshalText or MarshalJSON
+// method. Packing panics with it, and hooks report it to QML as an
+// error rather than letting the panic cross into C++.
+type marshalError struct {
+	value  interface{}
+	format string
+	err    error
+}
+
+func (e *marshalError) Error() string {
+	return fmt.Sprintf("cannot marshal %T as %s: %v", e.value, e.format, e.err)
+}
+
+// packMarshaled packs value into dvalue via its MarshalText or MarshalJSON
+// method, and returns whether value implements any of them. Failures
+// from these methods cause a panic with a *marshalError.
+func packMarshaled(value interface{}, dvalue *C.DataValue) bool {
+	datap := unsafe.Pointer(&dvalue.data)
+	switch m := value.(type) {
+	case encoding.TextMarshaler:
+		data, err := m.MarshalText()
+		if err != nil {
+			panic(&marshalError{value, "text", err})
+		}
+		dvalue.dataType = C.DTString
+		*(**C.char)(datap), dvalue.len = unsafeBytesData(data)
+		retainPacked(data)
+	case json.Marshaler:
+		data, err := m.MarshalJSON()
+		if err != nil {
+			panic(&marshalError{value, "JSON", err})
+		}
+		dvalue.dataType = C.DTJSON
+		*(**C.char)(datap), dvalue.len = unsafeBytesData(data)
+		retainPacked(data)
+	default:
+		return false
+	}
+	return true
+}
+
+// packResult packs value into dvalue as a result handed to QML by a hook.
+// If value fails to marshal, dvalue is packed as an error instead, so
+// that it's reported to the QML code that obtained value.
+//
+// This must be run from the main GUI thread.
+func packResult(value interface{}, dvalue *C.DataValue, engine *Engine) {
+	defer func() {
+		if v := recover(); v != nil {
+			err, ok := v.(*marshalError)
+			if !ok {
+				panic(v)
+			}
+			packError(err, dvalue)
+		}
+	}()
+	packDataValue(value, dvalue, engine, jsOwner)
+}
+
+// packError packs err into dvalue, so that C++ throws it as an error
+// within the QML code that caused a hook to run.
+//
+// This must be run from the main GUI thread.
+func packError(err error, dvalue *C.DataValue) {
+	packDataValue(err.Error(), dvalue, nil, jsOwner)
+	dvalue.dataType = C.DTError
+}
+
+// unmarshalText returns a new value of type typ obtained by unmarshaling s
+// via the UnmarshalText method of typ or of a pointer to it, and whether
+// typ implements the method at all. The error returned is non-nil if
+// the method fails.
+func unmarshalText(s string, typ reflect.Type) (reflect.Value, bool, error) {
+	var v reflect.Value
+	switch {
+	case typ.Kind() == reflect.Ptr && typ.Implements(typeTextUnmarshaler):
+		v = reflect.New(typ.Elem())
+	case reflect.PtrTo(typ).Implements(typeTextUnmarshaler):
+		v = reflect.New(typ)
+	default:
+		return reflect.Value{}, false, nil
+	}
+	if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+		return reflect.Value{}, true, fmt.Errorf("cannot unmarshal %q into %s: %v", s, typ, err)
+	}
+	if typ.Kind() != reflect.Ptr {
+		v = v.Elem()
+	}
+	return v, true, nil
+}
+
+// packList packs the n values returned by item into a C.DataValue
+// holding a QVariantList.
+//
+// This must be run from the main GUI thread.
+func packList(n int, item func(i int) interface{}, dvalue *C.DataValue, engine *Engine, owner valueOwner) {
+	// Values are copied into the QVariantList right away, so Go
+	// memory may be used for the array and for any strings in it.
+	// The extra entry ensures &values[0] is valid for empty lists.
+	values := make([]C.DataValue, n+1)
+	for i := 0; i < n; i++ {
+		packDataValue(item(i), &values[i], engine, owner)
+	}
+	dvalue.dataType = C.DTList
+	*(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data)) = C.newVariantList(&values[0], C.int(n))
+}
+
+// packMap packs the map m, which must have string keys, into a
+// C.DataValue holding a QVariantMap.
+//
+// This must be run from the main GUI thread.
+func packMap(m reflect.Value, dvalue *C.DataValue, engine *Engine, owner valueOwner) {
+	// As in packList, values are copied into the QVariantMap right away.
+	keys := m.MapKeys()
+	pairs := make([]C.DataValue, len(keys)*2+1)
+	for i, key := range keys {
+		packDataValue(key.String(), &pairs[i*2], engine, owner)
+		packDataValue(m.MapIndex(key).Interface(), &pairs[i*2+1], engine, owner)
+	}
+	dvalue.dataType = C.DTMap
+	*(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data)) = C.newVariantMap(&pairs[0], C.int(len(keys)))
+}
+
 // TODO Handle byte slices.
 
 // unpackDataValue converts a value shipped by C++ into a native Go value.
@@ -101,34 +381,146 @@ func unpackDataValue(dvalue *C.DataValue, engine *Engine) interface{} {
 	datap := unsafe.Pointer(&dvalue.data)
 	switch dvalue.dataType {
 	case C.DTString:
-		s := C.GoStringN(*(**C.char)(datap), dvalue.len)
-		// TODO If we move all unpackDataValue calls to the GUI thread,
-		// can we get rid of this allocation somehow?
-		C.free(unsafe.Pointer(*(**C.char)(datap)))
-		return s
+		return unpackString(dvalue)
+	case C.DTBytes:
+		return unpackBytes(dvalue)
 	case C.DTBool:
 		return *(*bool)(datap)
 	case C.DTInt64:
 		return *(*int64)(datap)
 	case C.DTInt32:
+		if compat(Numbers64) {
+			return int64(*(*int32)(datap))
+		}
+		reportLegacy(Numbers64, "int32 value obtained from QML")
 		return *(*int32)(datap)
 	case C.DTFloat64:
 		return *(*float64)(datap)
 	case C.DTFloat32:
+		if compat(Numbers64) {
+			return float64(*(*float32)(datap))
+		}
+		reportLegacy(Numbers64, "float32 value obtained from QML")
 		return *(*float32)(datap)
+	case C.DTTime:
+		msecs := *(*int64)(datap)
+		t := time.Unix(msecs/1000, msecs%1000*int64(time.Millisecond))
+		switch dvalue.len {
+		case C.LocalTimeOffset:
+			return t
+		case 0:
+			return t.UTC()
+		}
+		return t.In(time.FixedZone("", int(dvalue.len)))
+	case C.DTColor:
+		rgba := *(*uint32)(datap)
+		c := color.NRGBA{uint8(rgba >> 16), uint8(rgba >> 8), uint8(rgba), uint8(rgba >> 24)}
+		return color.RGBAModel.Convert(c)
+	case C.DTRegExp:
+		return parseRegexp(unpackString(dvalue))
+	case C.DTInt8Array, C.DTUint8Array, C.DTInt16Array, C.DTUint16Array,
+		C.DTInt32Array, C.DTUint32Array, C.DTFloat32Array, C.DTFloat64Array:
+		return unpackTypedArray(dvalue)
 	case C.DTGoAddr:
 		return (*(**valueFold)(datap)).gvalue
 	case C.DTInvalid:
 		return nil
 	case C.DTObject:
-		return &Object{
-			engine: engine,
-			addr:   (*(*unsafe.Pointer)(datap)),
+		return wrapObject(*(*unsafe.Pointer)(datap), engine)
+	case C.DTValues:
+		values := *(*unsafe.Pointer)(datap)
+		list := make([]interface{}, dvalue.len)
+		for i := range list {
+			itemdv := (*C.DataValue)(unsafe.Pointer(uintptr(values) + uintptr(i)*dataValueSize))
+			list[i] = unpackDataValue(itemdv, engine)
+		}
+		C.free(values)
+		if untypedLists {
+			return list
+		}
+		return typedList(list)
+	case C.DTPairs:
+		pairs := *(*unsafe.Pointer)(datap)
+		m := make(map[string]interface{}, dvalue.len)
+		for i := 0; i < int(dvalue.len); i++ {
+			keydv := (*C.DataValue)(unsafe.Pointer(uintptr(pairs) + uintptr(i*2)*dataValueSize))
+			itemdv := (*C.DataValue)(unsafe.Pointer(uintptr(pairs) + uintptr(i*2+1)*dataValueSize))
+			m[unpackDataValue(keydv, engine).(string)] = unpackDataValue(itemdv, engine)
 		}
+		C.free(pairs)
+		return m
 	}
 	panic(fmt.Sprintf("unsupported data type: %d", dvalue.dataType))
 }
 
+// untypedLists defines whether lists are always unpacked as []interface{}.
+// It is set once at initialization time via InitOptions.
+var untypedLists bool
+
+// typedList returns list converted into a []int, []float64, []string,
+// or []bool if all of its values have the respective type. Lists with
+// integers and floating point numbers are converted into []float64,
+// and lists with mixed or other types are returned unchanged, as are
+// empty lists.
+func typedList(list []interface{}) interface{} {
+	if len(list) == 0 {
+		return list
+	}
+	var ints, floats, strs, bools int
+	for _, item := range list {
+		switch item.(type) {
+		case int64, int32:
+			ints++
+		case float64, float32:
+			floats++
+		case string:
+			strs++
+		case bool:
+			bools++
+		}
+	}
+	switch len(list) {
+	case ints:
+		result := make([]int, len(list))
+		for i, item := range list {
+			if v, ok := item.(int64); ok {
+				result[i] = int(v)
+			} else {
+				result[i] = int(item.(int32))
+			}
+		}
+		return result
+	case ints + floats:
+		result := make([]float64, len(list))
+		for i, item := range list {
+			switch v := item.(type) {
+			case int64:
+				result[i] = float64(v)
+			case int32:
+				result[i] = float64(v)
+			case float64:
+				result[i] = v
+			case float32:
+				result[i] = float64(v)
+			}
+		}
+		return result
+	case strs:
+		result := make([]string, len(list))
+		for i, item := range list {
+			result[i] = item.(string)
+		}
+		return result
+	case bools:
+		result := make([]bool, len(list))
+		for i, item := range list {
+			result[i] = item.(bool)
+		}
+		return result
+	}
+	return list
+}
+
 func dataTypeOf(typ reflect.Type) C.DataType {
 	// Compare against the specific types rather than their kind.
 	// Custom types may have methods that must be supported.
@@ -169,57 +561,44 @@ func typeInfo(v interface{}) *C.GoTypeInfo {
 		return typeInfo
 	}
 
+	info := typeInfoTables[vt]
+	if info == nil {
+		if err := checkMemberNames(vt); err != nil {
+			panic(fmt.Sprintf("cannot expose %s to QML: %v", vt, err))
+		}
+		info = reflectTypeInfo(vt)
+	}
+
 	typeInfo = (*C.GoTypeInfo)(C.malloc(typeInfoSize))
-	typeInfo.typeName = C.CString(vt.Name())
+	typeInfo.typeName = C.CString(info.Name)
 	typeInfo.metaObject = nilPtr
 
-	// TODO Only do that if it's a struct?
-	vtptr := reflect.PtrTo(vt)
-
-	numField := vt.NumField()
-	prvField := 0
-	numMethod := vtptr.NumMethod()
+	numField := len(info.Fields)
+	numMethod := len(info.Methods)
+	numSignal := len(info.Signals)
 
 	// struct { FooBar T; Baz T } => "fooBar\0baz\0"
 	namesLen := 0
-	for i := 0; i < numField; i++ {
-		field := vt.Field(i)
-		if field.PkgPath != "" {
-			prvField++ // not exported
-			continue
-		}
+	for _, field := range info.Fields {
 		namesLen += len(field.Name) + 1
 	}
-	for i := 0; i < numMethod; i++ {
-		namesLen += len(vtptr.Method(i).Name) + 1
+	for _, method := range info.Methods {
+		namesLen += len(method.Name) + 1
+	}
+	for _, signal := range info.Signals {
+		namesLen += len(signal.Name) + 1
 	}
 	names := make([]byte, 0, namesLen)
-	for i := 0; i < numField; i++ {
-		field := vt.Field(i)
-		if field.PkgPath != "" {
-			continue // not exported
-		}
-		name := field.Name
-		for i, rune := range name {
-			if i == 0 {
-				names = append(names, string(unicode.ToLower(rune))...)
-			} else {
-				names = append(names, name[i:]...)
-				break
-			}
-		}
+	for _, field := range info.Fields {
+		names = append(names, field.Name...)
 		names = append(names, 0)
 	}
-	for i := 0; i < numMethod; i++ {
-		name := vtptr.Method(i).Name
-		for i, rune := range name {
-			if i == 0 {
-				names = append(names, string(unicode.ToLower(rune))...)
-			} else {
-				names = append(names, name[i:]...)
-				break
-			}
-		}
+	for _, method := range info.Methods {
+		names = append(names, method.Name...)
+		names = append(names, 0)
+	}
+	for _, signal := range info.Signals {
+		names = append(names, signal.Name...)
 		names = append(names, 0)
 	}
 	if len(names) != namesLen {
@@ -228,50 +607,56 @@ func typeInfo(v interface{}) *C.GoTypeInfo {
 	typeInfo.memberNames = C.CString(string(names))
 
 	// Assemble information on members.
-	membersLen := numField - prvField + numMethod
+	membersLen := numField + numMethod + numSignal
 	membersi := uintptr(0)
 	mnamesi := uintptr(0)
 	members := uintptr(C.malloc(memberInfoSize * C.size_t(membersLen)))
 	mnames := uintptr(unsafe.Pointer(typeInfo.memberNames))
-	for i := 0; i < numField; i++ {
-		field := vt.Field(i)
-		if field.PkgPath != "" {
-			continue // not exported
-		}
+	for _, field := range info.Fields {
 		memberInfo := (*C.GoMemberInfo)(unsafe.Pointer(members + uintptr(memberInfoSize)*membersi))
 		memberInfo.memberName = (*C.char)(unsafe.Pointer(mnames + mnamesi))
-		memberInfo.memberType = dataTypeOf(field.Type)
-		memberInfo.reflectIndex = C.int(i)
+		memberInfo.memberType = dataTypeOf(fieldType(vt, info, field.Index))
+		memberInfo.reflectIndex = C.int(field.Index)
 		memberInfo.addrOffset = C.int(field.Offset)
 		membersi += 1
 		mnamesi += uintptr(len(field.Name)) + 1
 	}
-	for i := 0; i < numMethod; i++ {
-		method := vtptr.Method(i)
+	for _, method := range info.Methods {
 		memberInfo := (*C.GoMemberInfo)(unsafe.Pointer(members + uintptr(memberInfoSize)*membersi))
 		memberInfo.memberName = (*C.char)(unsafe.Pointer(mnames + mnamesi))
 		memberInfo.memberType = C.DTMethod
-		memberInfo.reflectIndex = C.int(i)
+		memberInfo.reflectIndex = C.int(method.Index)
 		memberInfo.addrOffset = 0
-		signature, result := methodQtSignature(method)
 		// TODO The signature data might be embedded in the same array as the member names.
-		memberInfo.methodSignature = C.CString(signature)
-		memberInfo.resultSignature = C.CString(result)
-		// TODO Sort out methods with a variable number of arguments.
-		// TODO Sort out methods with more than one result.
-		// It's called while bound, so drop the receiver.
-		memberInfo.numIn = C.int(method.Type.NumIn() - 1)
-		memberInfo.numOut = C.int(method.Type.NumOut())
+		memberInfo.methodSignature = C.CString(method.Signature)
+		memberInfo.resultSignature = C.CString(method.Result)
+		memberInfo.numIn = C.int(method.NumIn)
+		memberInfo.numOut = C.int(method.NumOut)
 		membersi += 1
 		mnamesi += uintptr(len(method.Name)) + 1
 	}
+	for _, signal := range info.Signals {
+		memberInfo := (*C.GoMemberInfo)(unsafe.Pointer(members + uintptr(memberInfoSize)*membersi))
+		memberInfo.memberName = (*C.char)(unsafe.Pointer(mnames + mnamesi))
+		memberInfo.memberType = C.DTSignal
+		memberInfo.reflectIndex = C.int(signal.Index)
+		memberInfo.addrOffset = C.int(signal.Offset)
+		memberInfo.methodSignature = C.CString(signal.Signature)
+		memberInfo.resultSignature = C.CString("")
+		memberInfo.numIn = C.int(signal.NumIn)
+		memberInfo.numOut = 0
+		membersi += 1
+		mnamesi += uintptr(len(signal.Name)) + 1
+	}
 	typeInfo.members = (*C.GoMemberInfo)(unsafe.Pointer(members))
 	typeInfo.membersLen = C.int(membersLen)
 
 	typeInfo.fields = typeInfo.members
-	typeInfo.fieldsLen = C.int(numField - prvField)
+	typeInfo.fieldsLen = C.int(numField)
 	typeInfo.methods = (*C.GoMemberInfo)(unsafe.Pointer(members + uintptr(memberInfoSize)*uintptr(typeInfo.fieldsLen)))
 	typeInfo.methodsLen = C.int(numMethod)
+	typeInfo.signalMembers = (*C.GoMemberInfo)(unsafe.Pointer(members + uintptr(memberInfoSize)*uintptr(typeInfo.fieldsLen+typeInfo.methodsLen)))
+	typeInfo.signalMembersLen = C.int(numSignal)
 
 	if int(membersi) != membersLen {
 		panic("used more space than allocated for member names")
@@ -279,14 +664,175 @@ func typeInfo(v interface{}) *C.GoTypeInfo {
 	if int(mnamesi) != namesLen {
 		panic("allocated buffer doesn't match used space")
 	}
-	if typeInfo.fieldsLen+typeInfo.methodsLen != typeInfo.membersLen {
+	if typeInfo.fieldsLen+typeInfo.methodsLen+typeInfo.signalMembersLen != typeInfo.membersLen {
 		panic("lengths are inconsistent")
 	}
 
+	if len(info.promoted) > 0 {
+		promotedFields[vt] = info.promoted
+	}
 	typeInfoCache[vt] = typeInfo
 	return typeInfo
 }
 
+// reflectTypeInfo returns information about the members of vt
+// that are visible to QML, obtained via reflection.
+func reflectTypeInfo(vt reflect.Type) *TypeInfo {
+	info := &TypeInfo{Name: vt.Name()}
+
+	// TODO Only do that if it's a struct?
+	vtptr := reflect.PtrTo(vt)
+
+	numMethod := vtptr.NumMethod()
+
+	for _, vf := range visibleFields(vt) {
+		field := vf.field
+		signal := isSignalType(field.Type)
+		name, ok := wrappedFieldName(vf.owner, field, signal)
+		if !ok {
+			continue // not exposed
+		}
+		index := field.Index[0]
+		offset := vf.offset
+		if len(field.Index) > 1 {
+			index = vt.NumField() + len(info.promoted)
+			info.promoted = append(info.promoted, field.Index)
+			if vf.indirect {
+				// Out of reach of Changed, which only
+				// knows about memory within the value.
+				offset = vt.Size()
+			}
+		}
+		if signal {
+			info.Signals = append(info.Signals, TypeSignal{
+				Name:      name,
+				Index:     index,
+				Offset:    offset,
+				Signature: signalQtSignature(name, field.Type.NumIn()),
+				NumIn:     field.Type.NumIn(),
+			})
+			continue
+		}
+		info.Fields = append(info.Fields, TypeField{
+			Name:   name,
+			Index:  index,
+			Offset: offset,
+		})
+	}
+	for i := 0; i < numMethod; i++ {
+		method := vtptr.Method(i)
+		if !isMethodExposed(method) {
+			continue
+		}
+		info.Methods = append(info.Methods, reflectMethodInfo(vt, i, method))
+	}
+	return info
+}
+
+// reflectMethodInfo returns the information about method, the method
+// at index i of *vt, that is recorded in TypeInfo.
+func reflectMethodInfo(vt reflect.Type, i int, method reflect.Method) TypeMethod {
+	signature, result := methodQtSignature(method)
+	numOut := method.Type.NumOut()
+	if _, ok := isAsyncMethod(vt, method.Name); ok {
+		// The *AsyncCall is provided instead of the results.
+		result, numOut = "QVariant", 1
+	}
+	return TypeMethod{
+		Name:      memberName(method.Name),
+		Index:     i,
+		Signature: signature,
+		Result:    result,
+		// It's called while bound, so drop the receiver.
+		NumIn:  method.Type.NumIn() - 1,
+		NumOut: numOut,
+		Type:   methodGoType(method),
+	}
+}
+
+// methodGoType returns the Go type of method without its receiver,
+// as in "func(string, int) error".
+func methodGoType(method reflect.Method) string {
+	var buf bytes.Buffer
+	buf.WriteString("func(")
+	for i := 1; i < method.Type.NumIn(); i++ {
+		if i > 1 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(method.Type.In(i).String())
+	}
+	buf.WriteByte(')')
+	switch n := method.Type.NumOut(); n {
+	case 0:
+	case 1:
+		buf.WriteByte(' ')
+		buf.WriteString(method.Type.Out(0).String())
+	default:
+		buf.WriteString(" (")
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(method.Type.Out(i).String())
+		}
+		buf.WriteByte(')')
+	}
+	return buf.String()
+}
+
+// isMethodExposed returns whether method is made available to QML.
+// Methods with a variable number of parameters, with more parameters
+// than QML may provide, or taking a *Painter or a *GL, are not.
+func isMethodExposed(method reflect.Method) bool {
+	// The receiver is the first parameter.
+	if method.Type.IsVariadic() || method.Type.NumIn()-1 >= C.MaximumParamCount {
+		return false
+	}
+	for i := 1; i < method.Type.NumIn(); i++ {
+		if in := method.Type.In(i); in == painterType || in == glPointerType || in == keyEventType || in == mouseEventType {
+			return false
+		}
+	}
+	return true
+}
+
+// isSignalType returns whether fields of type typ are exposed to QML
+// as signals rather than as properties. See injectSignals.
+func isSignalType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Func && typ.NumOut() == 0 && !typ.IsVariadic() && typ.NumIn() < C.MaximumParamCount
+}
+
+// signalName returns the name used in QML for the signal exposed
+// by the Go field with the provided name. The "On" prefix is dropped
+// from the field name, so that the handler of the "OnFinished" field
+// is named "onFinished" in QML, as it would be for a "Finished" field.
+func signalName(name string) string {
+	if len(name) > 2 && strings.HasPrefix(name, "On") && unicode.IsUpper(rune(name[2])) {
+		name = name[2:]
+	}
+	return memberName(name)
+}
+
+func signalQtSignature(name string, numIn int) string {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	buf.WriteByte('(')
+	for i := 0; i < numIn; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("QVariant")
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// memberName returns the name used in QML for the Go member name.
+func memberName(name string) string {
+	rune, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(rune)) + name[size:]
+}
+
 func methodQtSignature(method reflect.Method) (signature, result string) {
 	var buf bytes.Buffer
 	for i, rune := range method.Name {
@@ -347,6 +893,103 @@ func unsafeStringData(s string) (*C.char, C.int) {
 	return *(**C.char)(unsafe.Pointer(&s)), C.int(len(s))
 }
 
+// unpackString returns a copy of the text held by the QByteArray in
+// dvalue, and releases the QByteArray.
+//
+// This may be run out of the main GUI thread.
+func unpackString(dvalue *C.DataValue) string {
+	ba := *(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data))
+	s := C.GoStringN(C.byteArrayData(ba), dvalue.len)
+	C.delByteArray(ba)
+	return s
+}
+
+// unpackBytes returns a copy of the data held by the QByteArray in
+// dvalue, and releases the QByteArray.
+//
+// This may be run out of the main GUI thread.
+func unpackBytes(dvalue *C.DataValue) []byte {
+	ba := *(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data))
+	b := C.GoBytes(unsafe.Pointer(C.byteArrayData(ba)), dvalue.len)
+	C.delByteArray(ba)
+	return b
+}
+
+// packedData holds the Go memory that C.DataValue values packed by
+// the main GUI thread refer to, so that the memory isn't garbage
+// collected before C++ copies it. The values packed while running a
+// function provided to gui are consumed by the time the function
+// returns, so the memory is released then. Values packed as results of
+// hooks are only released when the next such function returns.
+//
+// Only accessed from the main GUI thread.
+var packedData []interface{}
+
+// retainPacked holds a reference to v in packedData.
+//
+// This must be run from the main GUI thread.
+func retainPacked(v interface{}) {
+	packedData = append(packedData, v)
+}
+
+// releasePacked drops the references held in packedData. The slice
+// itself is kept, so that packing values doesn't allocate once it grew
+// enough to hold the values packed by a single function.
+//
+// This must be run from the main GUI thread.
+func releasePacked() {
+	for i := range packedData {
+		packedData[i] = nil
+	}
+	packedData = packedData[:0]
+}
+
+// scratchCString holds the C memory reused by acquireCString for short
+// strings, such as the names of properties and methods, so that setting
+// properties and calling methods frequently, such as on every frame,
+// doesn't allocate C memory for their names.
+//
+// Only accessed from the main GUI thread.
+var (
+	scratchCString     *C.char
+	scratchCStringUsed bool
+)
+
+// scratchCStringSize is the size of scratchCString. Longer strings are
+// copied into C memory allocated for them.
+const scratchCStringSize = 256
+
+// acquireCString returns s as a null-terminated C string, which must be
+// released via releaseCString. The string is copied into scratchCString
+// unless it's too long or the memory is in use already, such as when a
+// property is set by a hook running while another property is being set.
+//
+// This must be run from the main GUI thread.
+func acquireCString(s string) *C.char {
+	if len(s) >= scratchCStringSize || scratchCStringUsed {
+		return C.CString(s)
+	}
+	if scratchCString == nil {
+		scratchCString = (*C.char)(C.malloc(scratchCStringSize))
+	}
+	scratchCStringUsed = true
+	buf := (*[scratchCStringSize]byte)(unsafe.Pointer(scratchCString))
+	copy(buf[:], s)
+	buf[len(s)] = 0
+	return scratchCString
+}
+
+// releaseCString releases the C string returned by acquireCString.
+//
+// This must be run from the main GUI thread.
+func releaseCString(cs *C.char) {
+	if cs == scratchCString {
+		scratchCStringUsed = false
+	} else {
+		C.free(unsafe.Pointer(cs))
+	}
+}
+
 // unsafeBytesData returns a C string backed by Go data. The C
 // string is NOT null-terminated, so its length must be taken
 // into account.
@@ -0,0 +1,467 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// debugRequest is a request of the debug protocol described in
+// ServeDebugWith.
+type debugRequest struct {
+	Seq    int           `json:"seq"`
+	Op     string        `json:"op"`
+	Token  string        `json:"token,omitempty"`
+	Object int           `json:"object,omitempty"`
+	Depth  int           `json:"depth,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Value  interface{}   `json:"value,omitempty"`
+	Args   []interface{} `json:"args,omitempty"`
+}
+
+type debugResponse struct {
+	Seq   int         `json:"seq"`
+	Value interface{} `json:"value,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// debugObject describes an object in the responses of the debug protocol.
+type debugObject struct {
+	ID       int            `json:"id"`
+	Class    string         `json:"class"`
+	Name     string         `json:"name,omitempty"`
+	URL      string         `json:"url,omitempty"`
+	Line     int            `json:"line,omitempty"`
+	Column   int            `json:"column,omitempty"`
+	Children []*debugObject `json:"children,omitempty"`
+}
+
+type debugEngine struct {
+	ID      int            `json:"id"`
+	Objects []*debugObject `json:"objects"`
+}
+
+// DefaultDebugTimeout is the time each operation requested by clients of
+// the debug server may take, unless changed via DebugOptions.
+const DefaultDebugTimeout = 5 * time.Second
+
+// DebugOptions holds the options for the debug server started by
+// ServeDebugWith.
+type DebugOptions struct {
+	// TokenFile holds the path of a file holding the token that clients
+	// must present, so that only users able to read it may connect. It
+	// is required, and on Unix systems the file must not be accessible
+	// by users other than its owner. The file is read again on every
+	// connection, so the token may be changed while serving.
+	TokenFile string
+
+	// ReadOnly prevents clients from setting properties and calling
+	// methods, so that they may only inspect the application.
+	ReadOnly bool
+
+	// Timeout holds the time each operation requested by clients may
+	// take before an error is returned in its place. It defaults to
+	// DefaultDebugTimeout.
+	Timeout time.Duration
+}
+
+// debugServer serves the debug protocol, and is the io.Closer returned by
+// ServeDebugWith.
+type debugServer struct {
+	listener net.Listener
+	opts     DebugOptions
+
+	mutex  sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+
+	// Only accessed from the main GUI thread.
+	objects   map[int]*Object
+	objectIDs map[unsafe.Pointer]int
+	engineIDs map[*Engine]int
+	lastID    int
+}
+
+// ServeDebug works as ServeDebugWith, with the token file taken from the
+// QML_DEBUG_TOKEN_FILE environment variable, and the server being
+// read-only unless the QML_DEBUG_WRITE environment variable is set to 1.
+// Applications may then call ServeDebug unconditionally, leaving it to
+// whoever runs them to opt in:
+//
+//     if closer, err := qml.ServeDebug("unix:/run/user/1000/app-debug"); err == nil {
+//         defer closer.Close()
+//     }
+//
+func ServeDebug(addr string) (io.Closer, error) {
+	return ServeDebugWith(addr, DebugOptions{
+		TokenFile: os.Getenv("QML_DEBUG_TOKEN_FILE"),
+		ReadOnly:  os.Getenv("QML_DEBUG_WRITE") != "1",
+	})
+}
+
+// ServeDebugWith listens on addr for clients of the debug protocol, so
+// that the live object tree of the application may be inspected and
+// changed from outside of it, such as on a machine where it misbehaves.
+// Addresses of the form "unix:/path" refer to a Unix socket, and others
+// to a TCP address such as "localhost:7070".
+//
+// The debug protocol exchanges JSON messages, one per line. Clients send
+// requests holding an op, a sequence number, and the op parameters, and
+// the server answers each request with a message holding the same
+// sequence number and either a value or an error:
+//
+//     {"seq": 1, "op": "auth", "token": "..."}
+//     {"seq": 2, "op": "engines"}
+//     {"seq": 3, "op": "tree", "object": 4, "depth": 2}
+//     {"seq": 4, "op": "get", "object": 5, "name": "width"}
+//     {"seq": 5, "op": "set", "object": 5, "name": "width", "value": 100}
+//     {"seq": 6, "op": "call", "object": 5, "name": "reset", "args": []}
+//
+//     {"seq": 4, "value": 80}
+//     {"seq": 5, "error": "debug server is read-only"}
+//
+// The first request of every connection must be auth, holding the token
+// in the token file. The connection is closed if it isn't, or if the
+// token doesn't match.
+//
+// The engines op returns the engines alive, each as an object holding
+// its id and the objects created under it, such as component instances
+// and the root objects of windows. The tree op returns the object with
+// the given id, and its descendants up to depth levels below it, or all
+// of them if depth is negative. Objects are returned as JSON objects
+// holding their id, class, objectName, creation location if known, and
+// children:
+//
+//     {"id": 4, "class": "QQuickRectangle", "name": "panel",
+//      "url": "file:///app/main.qml", "line": 12, "column": 5,
+//      "children": [...]}
+//
+// The get op returns the value of the named property, or of all of them
+// if name is empty, converted as done by Object.StateSnapshot. The set
+// and call ops set a property and call a method, as done by Object.Set
+// and Object.CallError, unless the server is read-only.
+//
+// All operations are run in the main GUI thread, and an error is
+// returned to the client in place of operations that take longer than
+// the timeout in opts, while the operation itself completes on its own.
+// Closing the returned value stops listening and disconnects the clients.
+func ServeDebugWith(addr string, opts DebugOptions) (io.Closer, error) {
+	if opts.TokenFile == "" {
+		return nil, errors.New("cannot serve debug protocol: token file not provided")
+	}
+	if _, err := readDebugToken(opts.TokenFile); err != nil {
+		return nil, fmt.Errorf("cannot serve debug protocol: %v", err)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultDebugTimeout
+	}
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", addr[len("unix:"):]
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serve debug protocol: %v", err)
+	}
+	s := &debugServer{
+		listener:  listener,
+		opts:      opts,
+		conns:     make(map[net.Conn]bool),
+		objects:   make(map[int]*Object),
+		objectIDs: make(map[unsafe.Pointer]int),
+		engineIDs: make(map[*Engine]int),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// readDebugToken returns the token held in the file at path.
+func readDebugToken(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("token file %s must not be accessible by other users", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// Close stops listening and disconnects the clients.
+func (s *debugServer) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return s.listener.Close()
+}
+
+func (s *debugServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// serve answers the requests sent over conn until it's closed.
+func (s *debugServer) serve(conn net.Conn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	authenticated := false
+	for {
+		var req debugRequest
+		if err := dec.Decode(&req); err != nil {
+			if err != io.EOF {
+				enc.Encode(&debugResponse{Error: fmt.Sprintf("malformed request: %v", err)})
+			}
+			return
+		}
+		if !authenticated {
+			if err := s.authenticate(&req); err != nil {
+				enc.Encode(&debugResponse{Seq: req.Seq, Error: err.Error()})
+				return
+			}
+			authenticated = true
+			enc.Encode(&debugResponse{Seq: req.Seq, Value: true})
+			continue
+		}
+		value, err := s.handle(&req)
+		resp := &debugResponse{Seq: req.Seq, Value: value}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// authenticate checks that req authenticates the client.
+func (s *debugServer) authenticate(req *debugRequest) error {
+	if req.Op != "auth" {
+		return errors.New("not authenticated")
+	}
+	token, err := readDebugToken(s.opts.TokenFile)
+	if err != nil {
+		return errors.New("authentication failed")
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(token)) != 1 {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+// handle runs the operation requested by req in the main GUI thread,
+// and returns its result, or an error if it doesn't complete in time.
+func (s *debugServer) handle(req *debugRequest) (interface{}, error) {
+	switch req.Op {
+	case "engines", "tree", "get":
+	case "set", "call":
+		if s.opts.ReadOnly {
+			return nil, errors.New("debug server is read-only")
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation %q", req.Op)
+	}
+	type result struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		gui(func() {
+			defer func() {
+				if v := recover(); v != nil {
+					r.err = fmt.Errorf("%v", v)
+				}
+			}()
+			r.value, r.err = s.run(req)
+		})
+		done <- r
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-time.After(s.opts.Timeout):
+		return nil, fmt.Errorf("operation %s timed out after %v", req.Op, s.opts.Timeout)
+	}
+}
+
+// run runs the operation requested by req.
+//
+// This must be run from the main GUI thread.
+func (s *debugServer) run(req *debugRequest) (interface{}, error) {
+	if req.Op == "engines" {
+		s.forgetDestroyed()
+		var list []*debugEngine
+		for _, e := range engines {
+			if e.isDestroyed() {
+				continue
+			}
+			list = append(list, &debugEngine{ID: s.engineID(e), Objects: s.engineObjects(e)})
+		}
+		return list, nil
+	}
+	obj, ok := s.objects[req.Object]
+	if ok && atomic.LoadInt32(&obj.destroyed) != 0 {
+		s.forgetDestroyed()
+		ok = false
+	}
+	if !ok {
+		return nil, fmt.Errorf("object %d not found", req.Object)
+	}
+	switch req.Op {
+	case "tree":
+		return s.describe(obj, req.Depth), nil
+	case "get":
+		if req.Name != "" {
+			value, err := obj.PropertyErr(req.Name)
+			return snapshotValue(value), err
+		}
+		props := make(map[string]interface{})
+		for _, info := range obj.Properties() {
+			if value, ok := obj.property(info.Name); ok {
+				props[info.Name] = snapshotValue(value)
+			}
+		}
+		return props, nil
+	case "set":
+		return nil, obj.Set(req.Name, req.Value)
+	case "call":
+		value, err := obj.CallError(req.Name, req.Args...)
+		return snapshotValue(value), err
+	}
+	panic("unreachable")
+}
+
+// engineObjects returns the objects created under e.
+//
+// This must be run from the main GUI thread.
+func (s *debugServer) engineObjects(e *Engine) []*debugObject {
+	var clen C.int
+	cobjects := C.engineRootObjects(e.addr, &clen)
+	if clen == 0 {
+		return nil
+	}
+	list := make([]*debugObject, clen)
+	for i := range list {
+		addr := *(*unsafe.Pointer)(unsafe.Pointer(uintptr(unsafe.Pointer(cobjects)) + uintptr(i)*unsafe.Sizeof(nilPtr)))
+		list[i] = s.describe(wrapObject(addr, e), 0)
+	}
+	C.free(unsafe.Pointer(cobjects))
+	return list
+}
+
+// describe returns the description of obj and of its descendants up to
+// depth levels below it, or all of them if depth is negative.
+//
+// This must be run from the main GUI thread.
+func (s *debugServer) describe(obj *Object, depth int) *debugObject {
+	d := &debugObject{
+		ID:    s.objectID(obj),
+		Class: C.GoString(C.objectClassName(obj.addr)),
+		Name:  obj.StringOr("objectName", ""),
+	}
+	d.URL, d.Line, d.Column, _ = obj.CreationLocation()
+	if depth != 0 {
+		for _, child := range obj.Children() {
+			d.Children = append(d.Children, s.describe(child, depth-1))
+		}
+	}
+	return d
+}
+
+// objectID returns the id identifying obj in the debug protocol.
+//
+// This must be run from the main GUI thread.
+func (s *debugServer) objectID(obj *Object) int {
+	// Another object may have been allocated at the address of a
+	// destroyed one.
+	if id, ok := s.objectIDs[obj.addr]; ok && atomic.LoadInt32(&s.objects[id].destroyed) == 0 {
+		return id
+	}
+	s.lastID++
+	s.objects[s.lastID] = obj
+	s.objectIDs[obj.addr] = s.lastID
+	return s.lastID
+}
+
+// engineID returns the id identifying e in the debug protocol.
+//
+// This must be run from the main GUI thread.
+func (s *debugServer) engineID(e *Engine) int {
+	if id, ok := s.engineIDs[e]; ok {
+		return id
+	}
+	s.lastID++
+	s.engineIDs[e] = s.lastID
+	return s.lastID
+}
+
+// forgetDestroyed drops the ids of the objects and engines destroyed,
+// so that they are not found anymore.
+//
+// This must be run from the main GUI thread.
+func (s *debugServer) forgetDestroyed() {
+	for id, obj := range s.objects {
+		if atomic.LoadInt32(&obj.destroyed) != 0 {
+			delete(s.objects, id)
+			if s.objectIDs[obj.addr] == id {
+				delete(s.objectIDs, obj.addr)
+			}
+		}
+	}
+	for e := range s.engineIDs {
+		if e.isDestroyed() {
+			delete(s.engineIDs, e)
+		}
+	}
+}
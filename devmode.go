@@ -0,0 +1,127 @@
+package qml
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// devMode is set to 1 while development mode is enabled.
+var devMode int32
+
+// SetDevMode enables or disables the development mode, in which
+// facilities meant to shorten the edit and run cycle, such as
+// ReplaceType, are available. These facilities trade safety for
+// convenience, so development mode must not be enabled in production.
+func SetDevMode(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&devMode, v)
+}
+
+// ReplaceType replaces the New, Init, and Destroy functions of the type
+// registered before with the same location, version, and name as spec,
+// so that values created by QML from then on use the new functions,
+// while the existing values keep using the ones they were created with.
+// This allows reloaded QML documents to pick up changes in how the type
+// is constructed without restarting the application.
+//
+// The other fields of spec are ignored, as Qt holds on to the type as
+// first registered. For the same reason, the values created by the new
+// New function must expose to QML exactly the same fields, methods, and
+// signals as the values of the registered type, which is trivially true
+// if they have the same Go type.
+//
+// ReplaceType returns an error if development mode is not enabled via
+// SetDevMode, if no such type was registered, or if the new values are
+// incompatible with the registered type.
+func ReplaceType(spec *TypeSpec) error {
+	if atomic.LoadInt32(&devMode) == 0 {
+		return fmt.Errorf("cannot replace type %q: development mode is disabled", spec.Name)
+	}
+	if err := validateSpec(spec); err != nil {
+		return err
+	}
+	var err error
+	gui(func() {
+		var registered *TypeSpec
+		for _, other := range types {
+			if other.Location == spec.Location && other.Major == spec.Major && other.Minor == spec.Minor && other.Name == spec.Name {
+				registered = other
+			}
+		}
+		if registered == nil {
+			err = fmt.Errorf("cannot replace type %q: not registered in %s %d.%d", spec.Name, spec.Location, spec.Major, spec.Minor)
+			return
+		}
+		current := registered
+		for current.replacement != nil {
+			current = current.replacement
+		}
+		replacement := *current
+		replacement.New = spec.New
+		replacement.Init = spec.Init
+		replacement.Destroy = spec.Destroy
+
+		sample := spec.New()
+		if sample == nil {
+			err = fmt.Errorf("TypeSpec.New for type %q returned nil", spec.Name)
+			return
+		}
+		if _, ok := sample.(paintedValue); registered.kind == paintedType && !ok {
+			err = fmt.Errorf("cannot replace painted type %q: %T has no Paint(*qml.Painter) method", spec.Name, sample)
+			return
+		}
+		if _, ok := sample.(glValue); registered.kind == glType && !ok {
+			err = fmt.Errorf("cannot replace GL type %q: %T has no Paint(*qml.GL) method", spec.Name, sample)
+			return
+		}
+		replacement.sampleType = reflect.TypeOf(sample)
+		if replacement.sampleType != registered.sampleType {
+			if registered.Exposure != DefaultExposure {
+				setTypeExposure(replacement.sampleType, registered.Exposure)
+			}
+			if !sameMembers(replacement.sampleType, registered.sampleType) {
+				err = fmt.Errorf("cannot replace type %q: %s and %s expose different members to QML", spec.Name, replacement.sampleType, registered.sampleType)
+				return
+			}
+		}
+		replacement.replacement = nil
+		current.replacement = &replacement
+	})
+	return err
+}
+
+// sameMembers returns whether values of the types a and b expose the
+// same members to QML, at the same indexes and offsets.
+//
+// This must be run from the main GUI thread.
+func sameMembers(a, b reflect.Type) bool {
+	for a.Kind() == reflect.Ptr && b.Kind() == reflect.Ptr {
+		a, b = a.Elem(), b.Elem()
+	}
+	if a.Kind() != b.Kind() {
+		return false
+	}
+	ainfo, binfo := membersInfo(a), membersInfo(b)
+	same := reflect.DeepEqual(ainfo.Fields, binfo.Fields) &&
+		reflect.DeepEqual(ainfo.Methods, binfo.Methods) &&
+		reflect.DeepEqual(ainfo.Signals, binfo.Signals) &&
+		reflect.DeepEqual(ainfo.promoted, binfo.promoted)
+	for i := 0; same && i < len(ainfo.Fields); i++ {
+		index := ainfo.Fields[i].Index
+		same = fieldType(a, ainfo, index) == fieldType(b, binfo, index)
+	}
+	return same
+}
+
+// membersInfo returns information about the members of vt that are
+// visible to QML, either as recorded via UseTypeInfo or via reflection.
+func membersInfo(vt reflect.Type) *TypeInfo {
+	if info := typeInfoTables[vt]; info != nil {
+		return info
+	}
+	return reflectTypeInfo(vt)
+}
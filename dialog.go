@@ -0,0 +1,218 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"errors"
+	"strings"
+	"unsafe"
+
+	"github.com/niemeyer/qml/tref"
+)
+
+// ErrCanceled is returned by the dialog functions when the user cancels
+// the dialog rather than accepting it.
+var ErrCanceled = errors.New("dialog canceled")
+
+// FileDialogOptions holds the options for the file dialogs shown by
+// OpenFileDialog and OpenFilesDialog.
+type FileDialogOptions struct {
+	Title string
+
+	// Dir is the directory initially shown, or the file initially
+	// selected when saving.
+	Dir string
+
+	// Filters restricts the files shown to the ones matching one of the
+	// filters the user may choose from, in the form "Images (*.png *.jpg)".
+	// All files are shown if Filters is empty.
+	Filters []string
+
+	// Save is whether the dialog asks for a file to be saved rather than
+	// opened, in which case the chosen file does not have to exist, and
+	// the user is asked to confirm overwriting it if it does.
+	Save bool
+}
+
+// MessageBoxOptions holds the options for the message boxes shown by
+// MessageBox.
+type MessageBoxOptions struct {
+	Title string
+	Text  string
+	Icon  MessageIcon
+
+	// Buttons holds the buttons offered to the user. OkButton is offered
+	// if Buttons is zero.
+	Buttons MessageButton
+}
+
+// MessageIcon identifies the icon shown in a message box.
+type MessageIcon int
+
+// The values match the respective QMessageBox::Icon values.
+const (
+	NoIcon          MessageIcon = 0
+	InformationIcon MessageIcon = 1
+	WarningIcon     MessageIcon = 2
+	CriticalIcon    MessageIcon = 3
+	QuestionIcon    MessageIcon = 4
+)
+
+// MessageButton holds a set of message box buttons.
+type MessageButton int
+
+// The values match the respective QMessageBox::StandardButton values.
+const (
+	OkButton      MessageButton = 0x00000400
+	SaveButton    MessageButton = 0x00000800
+	OpenButton    MessageButton = 0x00002000
+	YesButton     MessageButton = 0x00004000
+	NoButton      MessageButton = 0x00010000
+	AbortButton   MessageButton = 0x00040000
+	RetryButton   MessageButton = 0x00080000
+	IgnoreButton  MessageButton = 0x00100000
+	CloseButton   MessageButton = 0x00200000
+	CancelButton  MessageButton = 0x00400000
+	DiscardButton MessageButton = 0x00800000
+	ApplyButton   MessageButton = 0x02000000
+)
+
+// dialogRequest holds the outcome of a dialog shown on behalf of a
+// goroutine, which waits on done until the dialog is finished.
+type dialogRequest struct {
+	result int
+	paths  []string
+	done   chan bool
+}
+
+// dialogs holds the requests alive while their dialogs are shown, since
+// the C++ dialogs only hold unsafe references to them.
+//
+// Only accessed from the main GUI thread.
+var dialogs = make(map[*dialogRequest]bool)
+
+// File dialog modes, as understood by fileDialogOpen.
+const (
+	openFileMode = iota
+	openFilesMode
+	saveFileMode
+)
+
+// OpenFileDialog shows a native file dialog over parent, or over no
+// window if parent is nil, and blocks the calling goroutine until the
+// user chooses a file or cancels the dialog, returning the chosen path
+// or ErrCanceled. The dialog is modal to parent, while other windows and
+// goroutines keep running normally.
+//
+// OpenFileDialog must not be called from the main GUI thread, such as
+// from within a function provided to RunMain, as the dialog could never
+// be finished.
+func OpenFileDialog(parent *Window, opts FileDialogOptions) (string, error) {
+	mode := openFileMode
+	if opts.Save {
+		mode = saveFileMode
+	}
+	paths, err := fileDialog(parent, opts, mode)
+	if err != nil {
+		return "", err
+	}
+	return paths[0], nil
+}
+
+// OpenFilesDialog is like OpenFileDialog, but allows the user to choose
+// multiple existing files, and returns the paths of all of them. The
+// Save option is not supported.
+func OpenFilesDialog(parent *Window, opts FileDialogOptions) ([]string, error) {
+	if opts.Save {
+		return nil, errors.New("cannot choose multiple files for saving")
+	}
+	return fileDialog(parent, opts, openFilesMode)
+}
+
+func fileDialog(parent *Window, opts FileDialogOptions, mode int) ([]string, error) {
+	ctitle, ctitlelen := unsafeStringData(opts.Title)
+	cdir, cdirlen := unsafeStringData(opts.Dir)
+	cfilters, cfilterslen := unsafeStringData(strings.Join(opts.Filters, ";;"))
+	req := showDialog(func(req *dialogRequest) {
+		C.fileDialogOpen(windowAddr(parent), unsafe.Pointer(req), ctitle, ctitlelen, cdir, cdirlen, cfilters, cfilterslen, C.int(mode))
+	})
+	if len(req.paths) == 0 {
+		return nil, ErrCanceled
+	}
+	return req.paths, nil
+}
+
+// MessageBox shows a native message box over parent, or over no window
+// if parent is nil, and blocks the calling goroutine until the user
+// clicks one of its buttons, returning the clicked button. If the user
+// clicks CancelButton, or dismisses the message box without clicking
+// any button, MessageBox returns ErrCanceled instead.
+//
+// MessageBox must not be called from the main GUI thread, as documented
+// in OpenFileDialog.
+func MessageBox(parent *Window, opts MessageBoxOptions) (MessageButton, error) {
+	if opts.Buttons == 0 {
+		opts.Buttons = OkButton
+	}
+	ctitle, ctitlelen := unsafeStringData(opts.Title)
+	ctext, ctextlen := unsafeStringData(opts.Text)
+	req := showDialog(func(req *dialogRequest) {
+		C.messageBoxOpen(windowAddr(parent), unsafe.Pointer(req), ctitle, ctitlelen, ctext, ctextlen, C.int(opts.Icon), C.int(opts.Buttons))
+	})
+	button := MessageButton(req.result)
+	if button <= 0 || button == CancelButton || button&opts.Buttons != button {
+		return 0, ErrCanceled
+	}
+	return button, nil
+}
+
+// showDialog calls open in the main GUI thread to show a dialog on
+// behalf of req, and blocks until the dialog is finished.
+func showDialog(open func(req *dialogRequest)) *dialogRequest {
+	if tref.Ref() == guiLoopRef {
+		panic("cannot show a dialog from within the main GUI thread")
+	}
+	req := &dialogRequest{done: make(chan bool)}
+	gui(func() {
+		dialogs[req] = true
+		open(req)
+	})
+	<-req.done
+	return req
+}
+
+// windowAddr returns the address of win's view, or nil if win is nil.
+func windowAddr(win *Window) unsafe.Pointer {
+	if win == nil {
+		return nilPtr
+	}
+	return win.obj.addr
+}
+
+//export hookDialogFinished
+func hookDialogFinished(addr unsafe.Pointer, result C.int, paths *C.char, pathsLen C.int) {
+	// The paths are owned by C++, so copy them before leaving this call.
+	var gopaths string
+	if pathsLen > 0 {
+		gopaths = C.GoStringN(paths, pathsLen)
+	}
+	if !onGuiThread("hookDialogFinished") {
+		gui(func() { finishDialog((*dialogRequest)(addr), int(result), gopaths) })
+		return
+	}
+	finishDialog((*dialogRequest)(addr), int(result), gopaths)
+}
+
+// finishDialog records the outcome of req and releases its waiter.
+//
+// This must be run from the main GUI thread.
+func finishDialog(req *dialogRequest, result int, paths string) {
+	req.result = result
+	if paths != "" {
+		req.paths = strings.Split(paths, "\x00")
+	}
+	delete(dialogs, req)
+	close(req.done)
+}
@@ -0,0 +1,213 @@
+package qml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// maxDiffDepth is the maximum depth compared by ApplyDiff within field
+// values. Values nested deeper than that are considered changed.
+const maxDiffDepth = 10
+
+// fieldChange holds a field value to be written by ApplyDiff.
+type fieldChange struct {
+	path  string
+	names []string // Sub-object names and then the property name.
+	value interface{}
+}
+
+// ApplyDiff sets the properties of obj to the values of the exported
+// fields of the struct value or pointer new that differ from the
+// respective fields of old, which must be of the same type, so that
+// state snapshots may be pushed to QML without setting every property
+// every time. Fields are compared deeply, and values nested more than
+// 10 levels deep are considered changed. All the properties are set in
+// a single trip to the GUI thread. If old is nil, all fields are set,
+// as done by Object.Fill.
+//
+// Fields map to properties following the naming and nesting rules
+// documented in Object.Scan, and struct fields that are nil pointers
+// in new are left alone. The written result holds the paths of the
+// fields set, such as "Address.Street" for the Street field of the
+// Address struct field. Fields are applied even after a problem is
+// found in a previous one, and the returned error reports the problems
+// found in all of them.
+func ApplyDiff(obj *Object, old, new interface{}) (written []string, err error) {
+	nv := structValue(new)
+	if !nv.IsValid() {
+		return nil, fmt.Errorf("cannot apply diff from %T: not a struct", new)
+	}
+	ov := structValue(old)
+	if ov.IsValid() && ov.Type() != nv.Type() {
+		return nil, fmt.Errorf("cannot apply diff from %T to %T: different types", old, new)
+	}
+
+	var changes []fieldChange
+	diffFields(ov, nv, "", nil, &changes)
+
+	var msgs []string
+	gui(func() {
+		subs := make(map[string]*Object)
+		for _, change := range changes {
+			target := obj
+			for i, name := range change.names[:len(change.names)-1] {
+				key := strings.Join(change.names[:i+1], ".")
+				if sub, ok := subs[key]; ok {
+					target = sub
+					continue
+				}
+				sub, err := target.subObject(name)
+				if err != nil {
+					msgs = append(msgs, fmt.Sprintf("%s: %v", change.path, err))
+					target = nil
+					break
+				}
+				subs[key] = sub
+				target = sub
+			}
+			if target == nil {
+				continue
+			}
+			if err := target.Set(change.names[len(change.names)-1], change.value); err != nil {
+				msgs = append(msgs, fmt.Sprintf("%s: %v", change.path, err))
+				continue
+			}
+			written = append(written, change.path)
+		}
+	})
+	if len(msgs) > 0 {
+		return written, fmt.Errorf("cannot apply diff from %T:\n%s", new, strings.Join(msgs, "\n"))
+	}
+	return written, nil
+}
+
+// structValue returns the struct in value or pointed to by it, or the
+// zero Value if there is none.
+func structValue(value interface{}) reflect.Value {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return v
+}
+
+// diffFields appends to changes the fields of the nv struct that differ
+// from the ones in the ov struct, or all of them if ov is the zero Value.
+func diffFields(ov, nv reflect.Value, prefix string, names []string, changes *[]fieldChange) {
+	vt := nv.Type()
+	for i := 0; i < vt.NumField(); i++ {
+		field := vt.Field(i)
+		name, ok := propertyName(vt, field)
+		if !ok {
+			continue
+		}
+		nfv := nv.Field(i)
+		var ofv reflect.Value
+		if ov.IsValid() {
+			ofv = ov.Field(i)
+		}
+		path := prefix + field.Name
+		fieldNames := append(names[:len(names):len(names)], name)
+		if isScanStruct(field.Type) {
+			if nfv.Kind() == reflect.Ptr {
+				if nfv.IsNil() {
+					continue
+				}
+				nfv = nfv.Elem()
+				if ofv.IsValid() {
+					if ofv.IsNil() {
+						ofv = reflect.Value{}
+					} else {
+						ofv = ofv.Elem()
+					}
+				}
+			}
+			diffFields(ofv, nfv, path+".", fieldNames, changes)
+			continue
+		}
+		if ofv.IsValid() && equalValues(ofv, nfv, maxDiffDepth) {
+			continue
+		}
+		*changes = append(*changes, fieldChange{path, fieldNames, nfv.Interface()})
+	}
+}
+
+// equalValues returns whether a and b, which have the same type, hold
+// deeply equal values within depth levels.
+func equalValues(a, b reflect.Value, depth int) bool {
+	if depth == 0 {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Chan, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+	case reflect.Func:
+		return a.IsNil() && b.IsNil()
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() || a.Pointer() == b.Pointer() {
+			return a.Pointer() == b.Pointer()
+		}
+		return equalValues(a.Elem(), b.Elem(), depth-1)
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		if a.Elem().Type() != b.Elem().Type() {
+			return false
+		}
+		return equalValues(a.Elem(), b.Elem(), depth-1)
+	case reflect.Slice:
+		if a.IsNil() != b.IsNil() || a.Len() != b.Len() {
+			return false
+		}
+		if a.Pointer() == b.Pointer() {
+			return true
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if !equalValues(a.Index(i), b.Index(i), depth-1) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.IsNil() != b.IsNil() || a.Len() != b.Len() {
+			return false
+		}
+		if a.Pointer() == b.Pointer() {
+			return true
+		}
+		for _, key := range a.MapKeys() {
+			bv := b.MapIndex(key)
+			if !bv.IsValid() || !equalValues(a.MapIndex(key), bv, depth-1) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !equalValues(a.Field(i), b.Field(i), depth-1) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
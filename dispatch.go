@@ -0,0 +1,47 @@
+package qml
+
+import (
+	"sync"
+)
+
+// callbackQueue holds the callbacks pending for a single source, which
+// run one at a time and in the order they were queued, in a goroutine
+// that only exists while there are callbacks pending.
+type callbackQueue struct {
+	mutex   sync.Mutex
+	pending []func()
+	running bool
+}
+
+// dispatch queues f to be called in a goroutine owned by the package,
+// after the callbacks previously queued in q return. It may be called
+// from any goroutine, and never blocks.
+func (q *callbackQueue) dispatch(f func()) {
+	q.mutex.Lock()
+	q.pending = append(q.pending, f)
+	if q.running {
+		q.mutex.Unlock()
+		return
+	}
+	q.running = true
+	q.mutex.Unlock()
+	go q.run()
+}
+
+// run calls the callbacks queued in q until there are none left.
+func (q *callbackQueue) run() {
+	for {
+		q.mutex.Lock()
+		if len(q.pending) == 0 {
+			q.pending = nil
+			q.running = false
+			q.mutex.Unlock()
+			return
+		}
+		f := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mutex.Unlock()
+		f()
+	}
+}
@@ -0,0 +1,143 @@
+package qml
+
+import (
+	"reflect"
+)
+
+// promotedFields holds the index sequences of the fields promoted from
+// embedded structs for the struct types wrapped so far, as recorded in
+// TypeInfo.promoted.
+//
+// Only accessed from the main GUI thread.
+var promotedFields = make(map[reflect.Type][][]int)
+
+// visibleField holds a field of a struct type that may be accessed
+// directly on values of the type, either because it's declared by the
+// type itself, or because it's promoted from an embedded struct.
+type visibleField struct {
+	// field has the index sequence from the outer struct as its Index.
+	field reflect.StructField
+
+	// owner is the struct type that declares the field.
+	owner reflect.Type
+
+	// offset is the offset of the field from the start of the outer
+	// struct, meaningful only if the field is not indirect.
+	offset uintptr
+
+	// indirect is whether the field is reached via an embedded pointer.
+	indirect bool
+}
+
+// visibleFields returns the fields of the struct type vt that may be
+// accessed directly on its values, following the Go rules for field
+// promotion: the fields of embedded structs and of embedded pointers to
+// structs are promoted unless shadowed by a field with the same name at
+// a shallower depth, or unless another field at the same depth has that
+// name too. Embedded fields tagged with `qml:"-"` are not traversed.
+func visibleFields(vt reflect.Type) []visibleField {
+	type embedded struct {
+		typ      reflect.Type
+		index    []int
+		offset   uintptr
+		indirect bool
+	}
+	var result []visibleField
+	current := []embedded{{typ: vt}}
+	visited := make(map[reflect.Type]bool)
+	shadowed := make(map[string]bool)
+	for len(current) > 0 {
+		var next []embedded
+		var found []visibleField
+		count := make(map[string]int)
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				field := e.typ.Field(i)
+				if shadowed[field.Name] {
+					continue
+				}
+				field.Index = append(append([]int(nil), e.index...), i)
+				count[field.Name]++
+				found = append(found, visibleField{field, e.typ, e.offset + field.Offset, e.indirect})
+
+				if !field.Anonymous || field.Tag.Get("qml") == "-" {
+					continue
+				}
+				ft, indirect := field.Type, e.indirect
+				if ft.Kind() == reflect.Ptr {
+					ft, indirect = ft.Elem(), true
+				}
+				if ft.Kind() == reflect.Struct {
+					next = append(next, embedded{ft, field.Index, e.offset + field.Offset, indirect})
+				}
+			}
+		}
+		for _, vf := range found {
+			if count[vf.field.Name] == 1 {
+				result = append(result, vf)
+			}
+		}
+		for name := range count {
+			shadowed[name] = true
+		}
+		current = next
+	}
+	return result
+}
+
+// fieldType returns the type of the field at index in the struct type
+// vt, as described by info.
+func fieldType(vt reflect.Type, info *TypeInfo, index int) reflect.Type {
+	if index < vt.NumField() {
+		return vt.Field(index).Type
+	}
+	return vt.FieldByIndex(info.promoted[index-vt.NumField()]).Type
+}
+
+// valueField returns the field at index of the struct v, as provided in
+// the type information of v. Promoted fields reached via nil embedded
+// pointers are only available if alloc is true, in which case the
+// embedded structs are allocated as necessary. Otherwise, or if the nil
+// pointers may not be set, valueField returns false.
+//
+// This must be run from the main GUI thread.
+func valueField(v reflect.Value, index int, alloc bool) (field reflect.Value, ok bool) {
+	if index < v.NumField() {
+		return v.Field(index), true
+	}
+	path := promotedFields[v.Type()][index-v.NumField()]
+	for i, fi := range path {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(fi)
+	}
+	return v, true
+}
+
+// dynamicValue returns the value held by the interface gvalue points to,
+// if gvalue is a pointer to a non-nil interface, so that values are
+// wrapped according to their dynamic type. Otherwise gvalue is returned
+// unchanged.
+func dynamicValue(gvalue interface{}) interface{} {
+	v := reflect.ValueOf(gvalue)
+	resolved := false
+	for v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Interface && !v.Elem().IsNil() {
+		v = v.Elem().Elem()
+		resolved = true
+	}
+	if !resolved {
+		return gvalue
+	}
+	return v.Interface()
+}
@@ -0,0 +1,198 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// enumKey holds a key of an enum registered via TypeSpec.Enums.
+type enumKey struct {
+	name  string
+	value int
+}
+
+type enumKeys []enumKey
+
+func (keys enumKeys) Len() int      { return len(keys) }
+func (keys enumKeys) Swap(i, j int) { keys[i], keys[j] = keys[j], keys[i] }
+func (keys enumKeys) Less(i, j int) bool {
+	if keys[i].value != keys[j].value {
+		return keys[i].value < keys[j].value
+	}
+	return keys[i].name < keys[j].name
+}
+
+// encodeEnums validates the enums of spec and returns them encoded for
+// C++ as one line per enum, holding the enum name and its comma-separated
+// key=value pairs separated by a tab.
+func encodeEnums(spec *TypeSpec) (string, error) {
+	var names []string
+	for name := range spec.Enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	seen := make(map[string]string)
+	for _, name := range names {
+		if !isUpperName(name) {
+			return "", fmt.Errorf("type %q has invalid enum name %q: must start with an uppercase letter", spec.Name, name)
+		}
+		var keys enumKeys
+		for key, value := range spec.Enums[name] {
+			if !isUpperName(key) {
+				return "", fmt.Errorf("enum %s of type %q has invalid key %q: must start with an uppercase letter", name, spec.Name, key)
+			}
+			if other, ok := seen[key]; ok {
+				return "", fmt.Errorf("type %q has key %q in both the %s and %s enums", spec.Name, key, other, name)
+			}
+			if value < math.MinInt32 || value > math.MaxInt32 {
+				return "", fmt.Errorf("enum key %s.%s of type %q is out of range: %d", name, key, spec.Name, value)
+			}
+			seen[key] = name
+			keys = append(keys, enumKey{key, value})
+		}
+		sort.Sort(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = fmt.Sprintf("%s=%d", key.name, key.value)
+		}
+		lines = append(lines, name+"\t"+strings.Join(pairs, ","))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// isUpperName returns whether name starts with an uppercase letter and
+// holds only letters, digits, and underscores, as QML requires from the
+// names of types, enums, and enum keys.
+func isUpperName(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	if !unicode.IsUpper(r) {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnumValue returns the value of the named enum key declared by the type
+// of obj, such as "AlignHCenter" for a Text element. The key may also be
+// qualified by the enum name, as in "HAlignment.AlignHCenter". EnumValue
+// panics if the type of obj has no such key.
+func (obj *Object) EnumValue(key string) int {
+	value, ok := obj.enumValue(key)
+	if !ok {
+		panic(fmt.Sprintf("object has no enum key %q", key))
+	}
+	return value
+}
+
+// enumValue returns the value of the named enum key as documented in
+// EnumValue, and whether the key was found.
+func (obj *Object) enumValue(key string) (int, bool) {
+	obj.assertLive()
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	var value C.int
+	var found C.int
+	gui(func() {
+		found = C.objectEnumValue(obj.addr, ckey, &value)
+	})
+	return int(value), found != 0
+}
+
+// Enums returns the enums declared by the type of obj, including the
+// ones it inherits, mapping each enum name to its keys and their values.
+func (obj *Object) Enums() map[string]map[string]int {
+	obj.assertLive()
+	var report string
+	gui(func() {
+		creport := C.objectEnumsReport(obj.addr)
+		report = C.GoString(creport)
+		C.free(unsafe.Pointer(creport))
+	})
+	enums := make(map[string]map[string]int)
+	for _, fields := range splitReport(report, 2) {
+		keys := make(map[string]int)
+		for _, pair := range strings.Split(fields[1], ";") {
+			if i := strings.Index(pair, "="); i > 0 {
+				keys[pair[:i]], _ = strconv.Atoi(pair[i+1:])
+			}
+		}
+		enums[fields[0]] = keys
+	}
+	return enums
+}
+
+// EnumName returns the name of the key with the provided value in the
+// named enum declared by the type of obj, and whether there is such a
+// key. It's the inverse of EnumValue, useful for displaying and logging
+// enum values obtained as plain integers:
+//
+//     name, _ := obj.EnumName("Status", obj.Int("status"))
+//
+func (obj *Object) EnumName(enum string, value int) (string, bool) {
+	obj.assertLive()
+	cenum := C.CString(enum)
+	defer C.free(unsafe.Pointer(cenum))
+	var name string
+	gui(func() {
+		if cname := C.objectEnumKey(obj.addr, cenum, C.int(value)); cname != nilCharPtr {
+			name = C.GoString(cname)
+		}
+	})
+	return name, name != ""
+}
+
+// EnumSymbol holds an enum key by name, so that it may be provided to
+// Object.Set rather than its value. See Enum.
+type EnumSymbol struct {
+	Enum string
+	Key  string
+}
+
+// Enum returns the named key of the named enum, which Object.Set resolves
+// into its value as declared by the type of the object being set:
+//
+//     obj.Set("status", qml.Enum("Status", "Busy"))
+//
+// The enum name may be empty, in which case the key is looked up in all
+// the enums of the object type, as done by Object.EnumValue.
+func Enum(enum, key string) EnumSymbol {
+	return EnumSymbol{enum, key}
+}
+
+func (sym EnumSymbol) String() string {
+	if sym.Enum == "" {
+		return sym.Key
+	}
+	return sym.Enum + "." + sym.Key
+}
+
+//export hookGoValueTypeEnums
+func hookGoValueTypeEnums(specp unsafe.Pointer) (enums *C.char) {
+	if !onGuiThread("hookGoValueTypeEnums") {
+		gui(func() { enums = hookGoValueTypeEnums(specp) })
+		return enums
+	}
+	spec := (*TypeSpec)(specp)
+	if spec.enums == "" {
+		return nilCharPtr
+	}
+	return C.CString(spec.enums)
+}
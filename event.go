@@ -0,0 +1,688 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// EventType identifies the kind of an input event.
+type EventType int
+
+// The values match the respective QEvent::Type values.
+const (
+	MouseButtonPress    EventType = 2
+	MouseButtonRelease  EventType = 3
+	MouseButtonDblClick EventType = 4
+	MouseMove           EventType = 5
+	KeyPress            EventType = 6
+	KeyRelease          EventType = 7
+	Wheel               EventType = 31
+	HoverEnter          EventType = 127
+	HoverLeave          EventType = 128
+	HoverMove           EventType = 129
+	TouchBegin          EventType = 194
+	TouchUpdate         EventType = 195
+	TouchEnd            EventType = 196
+)
+
+// Modifier holds a set of keyboard modifiers.
+type Modifier int
+
+// The values match the respective Qt::KeyboardModifier values.
+const (
+	ShiftModifier   Modifier = 0x02000000
+	ControlModifier Modifier = 0x04000000
+	AltModifier     Modifier = 0x08000000
+	MetaModifier    Modifier = 0x10000000
+	KeypadModifier  Modifier = 0x20000000
+)
+
+// MouseButton holds a set of mouse buttons.
+type MouseButton int
+
+// The values match the respective Qt::MouseButton values.
+const (
+	LeftButton   MouseButton = 1
+	RightButton  MouseButton = 2
+	MiddleButton MouseButton = 4
+)
+
+// Key holds a key code as defined by the Qt::Key enumeration.
+type Key int
+
+// The values match the respective Qt::Key values. Keys not listed here
+// may be provided by their Qt::Key value.
+const (
+	EscapeKey    Key = 0x01000000
+	TabKey       Key = 0x01000001
+	BackspaceKey Key = 0x01000003
+	ReturnKey    Key = 0x01000004
+	EnterKey     Key = 0x01000005
+	DeleteKey    Key = 0x01000007
+	HomeKey      Key = 0x01000010
+	EndKey       Key = 0x01000011
+	LeftKey      Key = 0x01000012
+	UpKey        Key = 0x01000013
+	RightKey     Key = 0x01000014
+	DownKey      Key = 0x01000015
+)
+
+// InputEvent summarizes a mouse, wheel, key, or touch event
+// delivered to a window.
+type InputEvent struct {
+	Type EventType
+
+	// X and Y hold the event position relative to the window, for
+	// mouse, wheel, and touch events. For touch events the position
+	// is the one of the first touch point.
+	X, Y float64
+
+	// Button holds the button that caused a mouse event, and Buttons
+	// holds the buttons pressed when the event was generated.
+	Button  MouseButton
+	Buttons MouseButton
+
+	// Delta holds the vertical rotation of the wheel in eighths of a degree.
+	Delta int
+
+	// Key and Text hold the key code and the text generated by key events.
+	Key  Key
+	Text string
+
+	Modifiers Modifier
+	Timestamp time.Duration
+}
+
+// KeyEvent describes a key press or release delivered to an item of a
+// type registered with RegisterPaintedType or RegisterGLType, whose value
+// handles key events via either or both of the methods
+//
+//     KeyPress(e *qml.KeyEvent)
+//     KeyRelease(e *qml.KeyEvent)
+//
+// Items receive key events while they hold the active focus, which is
+// given to them by setting their focus property, such as via
+// obj.Set("focus", true) or "focus: true" in QML, by Object.ForceFocus,
+// or by the tab key for types registered with TypeSpec.Focusable set.
+// As with any other item, handlers of the Keys attached property in QML
+// see the events first.
+//
+// The methods are called in the main GUI thread while the event is
+// being delivered. Events are accepted by default, which stops their
+// propagation, as done for items implemented in C++. Events ignored via
+// Ignore propagate to the parent item instead, so that unhandled keys
+// reach the enclosing items.
+type KeyEvent struct {
+	Type      EventType // KeyPress or KeyRelease
+	Key       Key
+	Modifiers Modifier
+	Text      string
+
+	// AutoRepeat holds whether the event was generated by a key
+	// being held down.
+	AutoRepeat bool
+
+	accepted bool
+}
+
+// Accept accepts the event, so that it's not propagated further.
+func (e *KeyEvent) Accept() {
+	e.accepted = true
+}
+
+// Ignore ignores the event, so that it's propagated to the parent item.
+func (e *KeyEvent) Ignore() {
+	e.accepted = false
+}
+
+// IsAccepted returns whether the event is accepted.
+func (e *KeyEvent) IsAccepted() bool {
+	return e.accepted
+}
+
+var keyEventType = reflect.TypeOf((*KeyEvent)(nil))
+
+// keyPressHandler and keyReleaseHandler are implemented by the values of
+// visual types that handle key events.
+type keyPressHandler interface {
+	KeyPress(e *KeyEvent)
+}
+
+type keyReleaseHandler interface {
+	KeyRelease(e *KeyEvent)
+}
+
+//export hookGoValueKeyEvent
+func hookGoValueKeyEvent(foldp unsafe.Pointer, cev *C.InputEvent, autoRepeat C.int) C.int {
+	if !onGuiThread("hookGoValueKeyEvent") {
+		var result C.int
+		gui(func() { result = hookGoValueKeyEvent(foldp, cev, autoRepeat) })
+		return result
+	}
+	fold := (*valueFold)(foldp)
+	var handle func(e *KeyEvent)
+	switch EventType(cev._type) {
+	case KeyPress:
+		if value, ok := fold.gvalue.(keyPressHandler); ok {
+			handle = value.KeyPress
+		}
+	case KeyRelease:
+		if value, ok := fold.gvalue.(keyReleaseHandler); ok {
+			handle = value.KeyRelease
+		}
+	}
+	if handle == nil {
+		return -1
+	}
+	e := &KeyEvent{
+		Type:       EventType(cev._type),
+		Key:        Key(cev.key),
+		Modifiers:  Modifier(cev.modifiers),
+		AutoRepeat: autoRepeat != 0,
+		accepted:   true,
+	}
+	if cev.textLen > 0 {
+		e.Text = C.GoStringN(cev.text, cev.textLen)
+	}
+	handle(e)
+	if e.accepted {
+		return 1
+	}
+	return 0
+}
+
+// MouseEvent describes a mouse or hover event delivered to an item of a
+// type registered with RegisterPaintedType or RegisterGLType, whose value
+// handles mouse events via any of the methods
+//
+//     MousePress(e *qml.MouseEvent)
+//     MouseMove(e *qml.MouseEvent)
+//     MouseRelease(e *qml.MouseEvent)
+//     MouseUngrab()
+//
+// and hover events via any of the methods
+//
+//     HoverEnter(e *qml.MouseEvent)
+//     HoverMove(e *qml.MouseEvent)
+//     HoverLeave(e *qml.MouseEvent)
+//
+// The methods are called in the main GUI thread while the event is
+// being delivered. Events are accepted by default, as done for items
+// implemented in C++. An accepted press makes the item grab the mouse,
+// so that the moves and the release that follow are delivered to it even
+// if the cursor leaves the item. A press ignored via Ignore is delivered
+// to the items under the item instead.
+//
+// Parents that filter the events of their children, such as Flickable,
+// may steal the grab to start a gesture of their own once the mouse is
+// dragged far enough, in which case MouseUngrab is called and no further
+// events of the press are delivered. Object.GrabMouse prevents that, and
+// is usually called from MousePress once the item decides to handle the
+// drag itself.
+//
+// Hover events are delivered while no button is pressed.
+type MouseEvent struct {
+	Type EventType // MouseButtonPress, MouseMove, HoverEnter, etc.
+
+	// X and Y hold the event position relative to the item.
+	X, Y float64
+
+	// Button holds the button that caused the event, and Buttons
+	// holds the buttons pressed when the event was generated.
+	Button  MouseButton
+	Buttons MouseButton
+
+	Modifiers Modifier
+
+	accepted bool
+}
+
+// Accept accepts the event, so that it's not propagated further.
+func (e *MouseEvent) Accept() {
+	e.accepted = true
+}
+
+// Ignore ignores the event, so that it's propagated to the items under
+// the item.
+func (e *MouseEvent) Ignore() {
+	e.accepted = false
+}
+
+// IsAccepted returns whether the event is accepted.
+func (e *MouseEvent) IsAccepted() bool {
+	return e.accepted
+}
+
+var mouseEventType = reflect.TypeOf((*MouseEvent)(nil))
+
+// The following interfaces are implemented by the values of visual
+// types that handle mouse and hover events.
+type mousePressHandler interface {
+	MousePress(e *MouseEvent)
+}
+
+type mouseMoveHandler interface {
+	MouseMove(e *MouseEvent)
+}
+
+type mouseReleaseHandler interface {
+	MouseRelease(e *MouseEvent)
+}
+
+type mouseUngrabHandler interface {
+	MouseUngrab()
+}
+
+type hoverEnterHandler interface {
+	HoverEnter(e *MouseEvent)
+}
+
+type hoverMoveHandler interface {
+	HoverMove(e *MouseEvent)
+}
+
+type hoverLeaveHandler interface {
+	HoverLeave(e *MouseEvent)
+}
+
+// acceptsMouse returns whether gvalue handles mouse events, and
+// whether it handles hover events.
+func acceptsMouse(gvalue interface{}) (mouse, hover bool) {
+	switch gvalue.(type) {
+	case mousePressHandler, mouseMoveHandler, mouseReleaseHandler:
+		mouse = true
+	}
+	switch gvalue.(type) {
+	case hoverEnterHandler, hoverMoveHandler, hoverLeaveHandler:
+		hover = true
+	}
+	return mouse, hover
+}
+
+//export hookGoValueMouseEvent
+func hookGoValueMouseEvent(foldp unsafe.Pointer, cev *C.InputEvent) C.int {
+	if !onGuiThread("hookGoValueMouseEvent") {
+		var result C.int
+		gui(func() { result = hookGoValueMouseEvent(foldp, cev) })
+		return result
+	}
+	fold := (*valueFold)(foldp)
+	var handle func(e *MouseEvent)
+	switch EventType(cev._type) {
+	case MouseButtonPress:
+		if value, ok := fold.gvalue.(mousePressHandler); ok {
+			handle = value.MousePress
+		}
+	case MouseMove:
+		if value, ok := fold.gvalue.(mouseMoveHandler); ok {
+			handle = value.MouseMove
+		}
+	case MouseButtonRelease:
+		if value, ok := fold.gvalue.(mouseReleaseHandler); ok {
+			handle = value.MouseRelease
+		}
+	case HoverEnter:
+		if value, ok := fold.gvalue.(hoverEnterHandler); ok {
+			handle = value.HoverEnter
+		}
+	case HoverMove:
+		if value, ok := fold.gvalue.(hoverMoveHandler); ok {
+			handle = value.HoverMove
+		}
+	case HoverLeave:
+		if value, ok := fold.gvalue.(hoverLeaveHandler); ok {
+			handle = value.HoverLeave
+		}
+	}
+	if handle == nil {
+		return -1
+	}
+	e := &MouseEvent{
+		Type:      EventType(cev._type),
+		X:         float64(cev.x),
+		Y:         float64(cev.y),
+		Button:    MouseButton(cev.button),
+		Buttons:   MouseButton(cev.buttons),
+		Modifiers: Modifier(cev.modifiers),
+		accepted:  true,
+	}
+	handle(e)
+	if e.accepted {
+		return 1
+	}
+	return 0
+}
+
+//export hookGoValueMouseUngrab
+func hookGoValueMouseUngrab(foldp unsafe.Pointer) {
+	if !onGuiThread("hookGoValueMouseUngrab") {
+		gui(func() { hookGoValueMouseUngrab(foldp) })
+		return
+	}
+	fold := (*valueFold)(foldp)
+	if value, ok := fold.gvalue.(mouseUngrabHandler); ok {
+		value.MouseUngrab()
+	}
+}
+
+// GrabMouse makes obj, which must be a visible item in a window, grab
+// the mouse, so that mouse events are delivered to it until the button
+// is released or UngrabMouse is called, even if the cursor leaves the
+// item. Parents that filter the events of their children, such as
+// Flickable, can't steal the grab to start a gesture of their own until
+// UngrabMouse is called. See MouseEvent.
+func (obj *Object) GrabMouse() error {
+	obj.assertLive()
+	var result C.int
+	gui(func() {
+		result = C.itemGrabMouse(obj.addr, 1)
+	})
+	switch result {
+	case C.ClickNotItem:
+		return fmt.Errorf("cannot grab mouse: object is not a visual item")
+	case C.ClickNoWindow:
+		return fmt.Errorf("cannot grab mouse: item is not in a window")
+	case C.ClickInvisible:
+		return fmt.Errorf("cannot grab mouse: item is not visible")
+	}
+	return nil
+}
+
+// UngrabMouse releases the mouse grabbed by obj via GrabMouse or by an
+// accepted press, and allows parents to steal the grab again.
+func (obj *Object) UngrabMouse() error {
+	obj.assertLive()
+	var result C.int
+	gui(func() {
+		result = C.itemGrabMouse(obj.addr, 0)
+	})
+	if result == C.ClickNotItem {
+		return fmt.Errorf("cannot ungrab mouse: object is not a visual item")
+	}
+	return nil
+}
+
+// PostMouseEvent queues a mouse event of type typ at the x and y position
+// relative to the window, as if generated by the user with button, so
+// that interfaces may be exercised from tests. The type must be one of
+// MouseButtonPress, MouseButtonRelease, MouseButtonDblClick, or MouseMove.
+//
+// The event is delivered by the GUI loop after PostMouseEvent returns,
+// through the event filters registered via AddEventFilter, so Settle must
+// be called before observing its effects.
+func (win *Window) PostMouseEvent(x, y float64, button MouseButton, typ EventType) {
+	switch typ {
+	case MouseButtonPress, MouseButtonRelease, MouseButtonDblClick, MouseMove:
+	default:
+		panic(fmt.Sprintf("cannot post mouse event of type %d", typ))
+	}
+	buttons := button
+	if typ == MouseButtonRelease {
+		buttons = 0
+	}
+	gui(func() {
+		C.viewPostMouseEvent(win.obj.addr, C.int(typ), C.double(x), C.double(y), C.int(button), C.int(buttons), 0)
+	})
+}
+
+// PostWheelEvent queues a vertical wheel event at the x and y position
+// relative to the window, with delta holding the wheel rotation in eighths
+// of a degree, where positive values scroll up, as done by PostMouseEvent.
+func (win *Window) PostWheelEvent(x, y float64, delta int, modifiers Modifier) {
+	gui(func() {
+		C.viewPostWheelEvent(win.obj.addr, C.double(x), C.double(y), C.int(delta), C.int(modifiers))
+	})
+}
+
+// PostKeyEvent queues a press and a release of key with the provided
+// modifiers, generating text, to the item holding the active focus in
+// the window, as done by PostMouseEvent. Text may hold several
+// characters, in which case key may be zero, so that text is typed into
+// items such as TextInput at once:
+//
+//     win.PostKeyEvent(0, 0, "John")
+//     win.PostKeyEvent(qml.ReturnKey, 0, "\r")
+//     qml.Settle()
+func (win *Window) PostKeyEvent(key Key, modifiers Modifier, text string) {
+	ctext, ctextlen := unsafeStringData(text)
+	gui(func() {
+		C.viewPostKeyEvent(win.obj.addr, C.int(KeyPress), C.int(key), C.int(modifiers), ctext, ctextlen)
+		C.viewPostKeyEvent(win.obj.addr, C.int(KeyRelease), C.int(key), C.int(modifiers), ctext, ctextlen)
+	})
+}
+
+// PostDropEvent queues the events of a drag carrying urls, such as
+// file:///tmp/notes.txt, that enters the window and is dropped at the x
+// and y position relative to it, as done by PostMouseEvent. The drop is
+// delivered to the handler registered via OnDrop, if any, and to QML.
+func (win *Window) PostDropEvent(urls []string, x, y float64) {
+	if len(urls) == 0 {
+		panic("cannot post drop event without urls")
+	}
+	curls, curlslen := unsafeStringData(strings.Join(urls, "\n"))
+	gui(func() {
+		C.viewPostDropEvent(win.obj.addr, curls, curlslen, C.double(x), C.double(y))
+	})
+}
+
+// Click queues a press and a release of the left mouse button at the
+// center of obj, which must be a visible item in a window, as done by
+// Window.PostMouseEvent. Items placed over obj receive the click instead,
+// as they would if the user clicked.
+func (obj *Object) Click() error {
+	obj.assertLive()
+	var result C.int
+	gui(func() {
+		result = C.itemClick(obj.addr)
+	})
+	switch result {
+	case C.ClickNotItem:
+		return fmt.Errorf("cannot click object: not a visual item")
+	case C.ClickNoWindow:
+		return fmt.Errorf("cannot click item: item is not in a window")
+	case C.ClickInvisible:
+		return fmt.Errorf("cannot click invisible item")
+	}
+	return nil
+}
+
+// settleRounds bounds the rounds of event processing done by Settle,
+// since animations and timers keep posting new events indefinitely.
+const settleRounds = 100
+
+// Settle processes the events pending in the GUI loop, such as the ones
+// posted via Window.PostMouseEvent and Window.PostKeyEvent, along with the
+// events they cause in turn, so that their effects may be observed right
+// afterwards.
+func Settle() {
+	gui(func() {
+		C.applicationFlushAll()
+		for i := 0; i < settleRounds && C.applicationHasPendingEvents() != 0; i++ {
+			C.applicationFlushAll()
+		}
+	})
+}
+
+// EventFilter is a filter registered in a window via AddEventFilter.
+type EventFilter struct {
+	win *Window
+	f   func(ev InputEvent) (consume bool)
+}
+
+// eventFilters holds the filters registered for each window, in
+// registration order.
+var eventFilters = make(map[unsafe.Pointer][]*EventFilter)
+
+// eventFilterObjects holds the C++ object that observes the
+// events of each window with registered filters.
+var eventFilterObjects = make(map[unsafe.Pointer]unsafe.Pointer)
+
+// AddEventFilter registers f to observe the mouse, wheel, key, and touch
+// events delivered to the window before QML handles them. Filters are
+// called in registration order until one of them returns true, in which
+// case the event is consumed and neither later filters nor QML see it.
+//
+// The filter runs in the main GUI thread, so it must not block and must
+// not call back into blocking functionality of the qml package.
+func (win *Window) AddEventFilter(f func(ev InputEvent) (consume bool)) *EventFilter {
+	filter := &EventFilter{win, f}
+	gui(func() {
+		addr := win.obj.addr
+		if _, ok := eventFilterObjects[addr]; !ok {
+			eventFilterObjects[addr] = C.viewInstallEventFilter(addr)
+		}
+		eventFilters[addr] = append(eventFilters[addr], filter)
+	})
+	return filter
+}
+
+// Remove unregisters the filter from its window. Removing a filter
+// that was already removed has no effect.
+func (filter *EventFilter) Remove() {
+	gui(func() {
+		addr := filter.win.obj.addr
+		filters := eventFilters[addr]
+		for i, f := range filters {
+			if f == filter {
+				filters = append(filters[:i:i], filters[i+1:]...)
+				break
+			}
+		}
+		if len(filters) > 0 {
+			eventFilters[addr] = filters
+			return
+		}
+		delete(eventFilters, addr)
+		if obj, ok := eventFilterObjects[addr]; ok {
+			delete(eventFilterObjects, addr)
+			// The filter might be running right now.
+			C.delObjectLater(obj)
+		}
+	})
+}
+
+//export hookEventFilter
+func hookEventFilter(target unsafe.Pointer, cev *C.InputEvent) C.int {
+	if !onGuiThread("hookEventFilter") {
+		var consume C.int
+		gui(func() { consume = hookEventFilter(target, cev) })
+		return consume
+	}
+	ev := InputEvent{
+		Type:      EventType(cev._type),
+		X:         float64(cev.x),
+		Y:         float64(cev.y),
+		Button:    MouseButton(cev.button),
+		Buttons:   MouseButton(cev.buttons),
+		Delta:     int(cev.delta),
+		Key:       Key(cev.key),
+		Modifiers: Modifier(cev.modifiers),
+		Timestamp: time.Duration(cev.timestamp) * time.Millisecond,
+	}
+	if cev.textLen > 0 {
+		ev.Text = C.GoStringN(cev.text, cev.textLen)
+	}
+	// Iterate over a copy so filters may be added or removed while running.
+	filters := append([]*EventFilter(nil), eventFilters[target]...)
+	for _, filter := range filters {
+		if filter.f(ev) {
+			return 1
+		}
+	}
+	return 0
+}
+
+//export hookEventFilterDestroyed
+func hookEventFilterDestroyed(target, filter unsafe.Pointer) {
+	if !onGuiThread("hookEventFilterDestroyed") {
+		gui(func() { hookEventFilterDestroyed(target, filter) })
+		return
+	}
+	// A filter object removed via Remove might only be destroyed after
+	// a new one was installed for the same window.
+	if eventFilterObjects[target] == filter {
+		delete(eventFilters, target)
+		delete(eventFilterObjects, target)
+	}
+}
+
+// dropHandlers holds the handler registered via OnDrop for each window.
+var dropHandlers = make(map[unsafe.Pointer]func(paths []string, x, y float64) bool)
+
+// dropFilterObjects holds the C++ object that observes the drag and drop
+// events of each window with a registered drop handler.
+var dropFilterObjects = make(map[unsafe.Pointer]unsafe.Pointer)
+
+// OnDrop arranges for f to be called when urls, such as files dragged
+// from a file manager, are dropped onto the window, with the x and y
+// position of the drop relative to the window. Local files are provided
+// as file paths, and other urls as they are. If f returns true, the drop
+// is accepted at the window level and QML doesn't see it. Otherwise it's
+// delivered to QML as usual, so that DropArea items may handle it.
+//
+// Drags carrying urls are accepted by the window while f is registered,
+// even if no DropArea item under the cursor accepts them. Calling OnDrop
+// again replaces the handler, and a nil f removes it.
+//
+// The handler runs in the main GUI thread, so it must not block and must
+// not call back into blocking functionality of the qml package.
+func (win *Window) OnDrop(f func(paths []string, x, y float64) bool) {
+	gui(func() {
+		addr := win.obj.addr
+		if f != nil {
+			dropHandlers[addr] = f
+			if _, ok := dropFilterObjects[addr]; !ok {
+				dropFilterObjects[addr] = C.viewInstallDropFilter(addr)
+			}
+			return
+		}
+		delete(dropHandlers, addr)
+		if obj, ok := dropFilterObjects[addr]; ok {
+			delete(dropFilterObjects, addr)
+			// The filter might be running right now.
+			C.delObjectLater(obj)
+		}
+	})
+}
+
+//export hookWindowDrop
+func hookWindowDrop(addr unsafe.Pointer, cpaths *C.char, cpathsLen, count C.int, x, y C.double) C.int {
+	if !onGuiThread("hookWindowDrop") {
+		var accept C.int
+		gui(func() { accept = hookWindowDrop(addr, cpaths, cpathsLen, count, x, y) })
+		return accept
+	}
+	f, ok := dropHandlers[addr]
+	if !ok {
+		return 0
+	}
+	paths := make([]string, 0, count)
+	if count > 0 {
+		paths = strings.Split(C.GoStringN(cpaths, cpathsLen), "\x00")
+	}
+	if f(paths, float64(x), float64(y)) {
+		return 1
+	}
+	return 0
+}
+
+//export hookDropFilterDestroyed
+func hookDropFilterDestroyed(addr, filter unsafe.Pointer) {
+	if !onGuiThread("hookDropFilterDestroyed") {
+		gui(func() { hookDropFilterDestroyed(addr, filter) })
+		return
+	}
+	// A filter object removed via OnDrop might only be destroyed after
+	// a new one was installed for the same window.
+	if dropFilterObjects[addr] == filter {
+		delete(dropHandlers, addr)
+		delete(dropFilterObjects, addr)
+	}
+}
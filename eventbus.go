@@ -0,0 +1,188 @@
+package qml
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EventBus delivers events published by Go code to any number of QML
+// subscribers, so that unrelated parts of an interface may observe the
+// same events without being wired together. The bus is made available
+// to QML via Context.SetVar, and each event is published under a topic:
+//
+//     bus := qml.NewEventBus()
+//     engine.Context().SetVar("bus", bus)
+//     bus.Publish("prices", map[string]interface{}{"symbol": "ACME", "price": 42.5})
+//
+// QML code may handle every event published via the event signal of the
+// bus, or subscribe to the events of a single topic:
+//
+//     Connections {
+//         target: bus
+//         onEvent: console.log(topic, payload)
+//     }
+//
+//     Component.onCompleted: bus.subscribe("prices", function(payload) {
+//         price.text = payload.price
+//     }, this)
+//
+// The third parameter of subscribe is the owner of the subscription,
+// which is dropped once the owner is destroyed, so subscriptions made
+// by delegates do not outlive them. Subscriptions without an owner last
+// until the id returned by subscribe is provided to unsubscribe:
+//
+//     property int sub: bus.subscribe("prices", update)
+//     Component.onDestruction: bus.unsubscribe(sub)
+//
+// Payloads are converted as done for values provided to Context.SetVar.
+// Events are delivered in the order they were published, and all the
+// subscribers of a topic are called in the order they subscribed.
+type EventBus struct {
+	mutex   sync.Mutex
+	pending []busEvent
+
+	// Only accessed from the main GUI thread.
+	objects   map[*Engine]*Object
+	destroyed bool
+}
+
+type busEvent struct {
+	topic   string
+	payload interface{}
+}
+
+const eventBusQML = `
+import QtQuick 2.0
+QtObject {
+    id: bus
+
+    signal event(string topic, var payload)
+
+    property var subscriptions: ({})
+    property int lastId: 0
+    property Component guard: Component { QtObject { property QtObject owner } }
+
+    function subscribe(topic, callback, owner) {
+        var sub = {id: ++lastId, topic: topic, callback: callback, guard: null}
+        if (owner) {
+            // Object properties are reset to null once the object is destroyed.
+            sub.guard = guard.createObject(bus, {owner: owner})
+        }
+        if (!subscriptions[topic]) {
+            subscriptions[topic] = []
+        }
+        subscriptions[topic].push(sub)
+        return sub.id
+    }
+
+    function unsubscribe(id) {
+        for (var topic in subscriptions) {
+            var subs = subscriptions[topic]
+            for (var i = 0; i < subs.length; i++) {
+                if (subs[i].id === id) {
+                    drop(subs, i)
+                    return
+                }
+            }
+        }
+    }
+
+    function drop(subs, i) {
+        if (subs[i].guard) {
+            subs[i].guard.destroy()
+        }
+        subs.splice(i, 1)
+    }
+
+    function publish(topic, payload) {
+        event(topic, payload)
+        var subs = subscriptions[topic]
+        if (!subs) {
+            return
+        }
+        subs = subs.slice()
+        for (var i = 0; i < subs.length; i++) {
+            var sub = subs[i]
+            if (sub.guard && sub.guard.owner === null) {
+                unsubscribe(sub.id)
+                continue
+            }
+            sub.callback(payload)
+        }
+    }
+}
+`
+
+// NewEventBus returns a new event bus. The Destroy method must be called
+// once the bus is not necessary anymore.
+func NewEventBus() *EventBus {
+	return &EventBus{objects: make(map[*Engine]*Object)}
+}
+
+// Publish delivers payload to the QML subscribers of topic in every
+// engine the bus was made available to. Publish may be called from any
+// goroutine, and events published concurrently are delivered together
+// in a single trip to the GUI thread. For that reason Publish may return
+// before the event is delivered, if another goroutine is already waiting
+// to deliver the pending events.
+func (bus *EventBus) Publish(topic string, payload interface{}) {
+	bus.mutex.Lock()
+	bus.pending = append(bus.pending, busEvent{topic, payload})
+	deliver := len(bus.pending) == 1
+	bus.mutex.Unlock()
+	if deliver {
+		gui(bus.deliver)
+	}
+}
+
+// Destroy destroys the bus. The bus must not be used after this method
+// is called.
+func (bus *EventBus) Destroy() {
+	gui(func() {
+		bus.destroyed = true
+		for engine, obj := range bus.objects {
+			delete(bus.objects, engine)
+			obj.Destroy()
+		}
+	})
+}
+
+// deliver delivers the pending events to all engines.
+//
+// This must be run from the main GUI thread.
+func (bus *EventBus) deliver() {
+	bus.mutex.Lock()
+	pending := bus.pending
+	bus.pending = nil
+	bus.mutex.Unlock()
+
+	for _, event := range pending {
+		for engine, obj := range bus.objects {
+			if engine.isDestroyed() {
+				delete(bus.objects, engine)
+				continue
+			}
+			obj.Call("publish", event.topic, event.payload)
+		}
+	}
+}
+
+// object returns the QML object representing the bus in engine,
+// creating it if necessary.
+//
+// This must be run from the main GUI thread.
+func (bus *EventBus) object(engine *Engine) *Object {
+	if obj, ok := bus.objects[engine]; ok {
+		return obj
+	}
+	if bus.destroyed {
+		panic("event bus used after being destroyed")
+	}
+	component, err := engine.LoadString("eventbus.qml", eventBusQML)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create event bus: %v", err))
+	}
+	obj := component.Create(nil)
+	bus.objects[engine] = obj
+	return obj
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/niemeyer/qml"
+	"time"
+)
+
+// This example pretends to be a host application, such as a game engine,
+// which owns the main thread and its loop, and drives Qt once per frame.
+
+const source = `
+import QtQuick 2.0
+
+Rectangle {
+	width: 320; height: 120
+	color: "black"
+	property int frame
+	Text {
+		anchors.centerIn: parent
+		color: "white"
+		text: "Host frame " + frame
+	}
+}
+`
+
+func main() {
+	qml.InitExternal(nil)
+
+	engine := qml.NewEngine(nil)
+	component, err := engine.LoadString("external.qml", source)
+	if err != nil {
+		panic(err)
+	}
+	window := component.CreateWindow(nil)
+	root := window.Root()
+	window.Show()
+
+	// Goroutines use the package as usual, and are served by the host loop.
+	closed := make(chan bool)
+	go func() {
+		window.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(time.Second / 60)
+	defer ticker.Stop()
+	for frame := 1; ; frame++ {
+		select {
+		case <-closed:
+			fmt.Printf("window closed after %d frames\n", frame)
+			window.Destroy()
+			engine.Destroy()
+			qml.ProcessEventsOnce()
+			return
+		case <-ticker.C:
+		}
+
+		// The host does its own work for the frame here.
+		root.Set("frame", frame)
+
+		qml.ProcessEventsOnce()
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/niemeyer/qml"
+	"os"
+)
+
+// This example builds its whole interface from Go, without QML documents:
+// a window holding a button-like rectangle that counts its clicks.
+
+func main() {
+	qml.Main(nil, func() {
+		if err := run(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	})
+}
+
+func run() error {
+	engine := qml.NewEngine(nil)
+	defer engine.Destroy()
+
+	win := engine.NewWindow(240, 120)
+	win.SetTitle("Go scene")
+
+	button, err := engine.Item("Rectangle")
+	if err != nil {
+		return err
+	}
+	button.Set("color", "steelblue")
+	button.Set("radius", 6)
+	button.SetGeometry(40, 35, 160, 50)
+	if err := button.SetParentItem(win.Root()); err != nil {
+		return err
+	}
+
+	label, err := engine.Item("Text")
+	if err != nil {
+		return err
+	}
+	label.Set("color", "white")
+	label.Set("text", "Click me")
+	label.Set("horizontalAlignment", 4) // Text.AlignHCenter
+	label.Set("verticalAlignment", 128) // Text.AlignVCenter
+	label.SetGeometry(0, 0, 160, 50)
+	if err := label.SetParentItem(button); err != nil {
+		return err
+	}
+
+	area, err := engine.Item("MouseArea")
+	if err != nil {
+		return err
+	}
+	area.SetGeometry(0, 0, 160, 50)
+	if err := area.SetParentItem(button); err != nil {
+		return err
+	}
+	clicks := 0
+	area.ConnectInline("clicked", func(mouse *qml.Object) {
+		clicks++
+		label.Set("text", fmt.Sprintf("Clicked %d times", clicks))
+	})
+
+	win.Show()
+	win.Wait()
+	return nil
+}
@@ -7,8 +7,11 @@ import (
 )
 
 func main() {
-	qml.Init(nil)
-	engine := qml.NewEngine()
+	qml.Main(nil, run)
+}
+
+func run() {
+	engine := qml.NewEngine(nil)
 	component, err := engine.LoadFile("particle.qml")
 	if err != nil {
 		panic(err)
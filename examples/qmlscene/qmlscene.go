@@ -11,15 +11,16 @@ func main() {
 		fmt.Fprintf(os.Stderr, "usage: %s <qml file>\n", os.Args[0])
 		os.Exit(1)
 	}
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
+	qml.Main(nil, func() {
+		if err := run(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	})
 }
 
 func run() error {
-	qml.Init(nil)
-	engine := qml.NewEngine()
+	engine := qml.NewEngine(nil)
 	component, err := engine.LoadFile(os.Args[1])
 	if err != nil {
 		return err
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/niemeyer/qml"
+	"os"
+	"path/filepath"
+)
+
+// This example renders its window in a separate process, started from the
+// renderer binary built out of the renderer directory, so that a crash
+// while rendering doesn't take the process down. The process is restarted
+// if it crashes, which may be tried by killing it:
+//
+//     go build -o /tmp/renderer ./renderer
+//     go run main.go /tmp/renderer
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <renderer binary>\n", os.Args[0])
+		os.Exit(1)
+	}
+	if err := run(os.Args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(renderer string) error {
+	qmlPath, err := filepath.Abs("remote.qml")
+	if err != nil {
+		return err
+	}
+	win, err := qml.SpawnRenderer(renderer, qmlPath, qml.RemoteOptions{
+		Vars:    map[string]interface{}{"owner": fmt.Sprintf("Process %d", os.Getpid())},
+		Restart: true,
+		OnError: func(err error) { fmt.Println("renderer:", err) },
+	})
+	if err != nil {
+		return err
+	}
+	err = win.OnPropertyChanged("clicks", func(value interface{}) {
+		fmt.Println("clicks:", value)
+		if value.(float64) >= 10 {
+			result, err := win.Call("reset")
+			fmt.Println(result, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return win.Wait()
+}
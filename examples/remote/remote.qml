@@ -0,0 +1,24 @@
+import QtQuick 2.0
+
+Rectangle {
+	width: 320; height: 120
+	color: "black"
+
+	property int clicks
+
+	function reset() {
+		clicks = 0
+		return "reset by " + owner
+	}
+
+	Text {
+		anchors.centerIn: parent
+		color: "white"
+		text: owner + ": " + clicks + " clicks"
+	}
+
+	MouseArea {
+		anchors.fill: parent
+		onClicked: clicks++
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"github.com/niemeyer/qml"
+	"os"
+)
+
+// This is the helper program started by the remote example to render
+// its window in a separate process.
+
+func main() {
+	if err := qml.Run(qml.ServeRenderer); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,88 @@
+package qml
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// SetUseMarshalers enables or disables the conversion of values via
+// marshalers as done by InitOptions.UseMarshalers, and returns a
+// function that restores the previous setting.
+func SetUseMarshalers(enabled bool) (restore func()) {
+	var old bool
+	gui(func() {
+		old = useMarshalers
+		useMarshalers = enabled
+	})
+	return func() {
+		gui(func() { useMarshalers = old })
+	}
+}
+
+// GUI runs f in the main GUI thread as done by the package internally.
+func GUI(f func()) {
+	gui(f)
+}
+
+// ResetTypeInfo drops the type information recorded via UseTypeInfo and
+// cached for the type of sample, so that it's obtained again when values
+// of that type are next exposed to QML, and returns a function that
+// restores the previous state.
+func ResetTypeInfo(sample interface{}) (restore func()) {
+	vt := reflect.TypeOf(sample)
+	for vt.Kind() == reflect.Ptr {
+		vt = vt.Elem()
+	}
+	gui(func() {
+		info, hasInfo := typeInfoTables[vt]
+		cached, hasCached := typeInfoCache[vt]
+		delete(typeInfoTables, vt)
+		delete(typeInfoCache, vt)
+		restore = func() {
+			gui(func() {
+				delete(typeInfoTables, vt)
+				delete(typeInfoCache, vt)
+				if hasInfo {
+					typeInfoTables[vt] = info
+				}
+				if hasCached {
+					typeInfoCache[vt] = cached
+				}
+			})
+		}
+	})
+	return restore
+}
+
+// GeneratedTypeInfo returns the type information for the type of sample
+// that the code generated by WriteTypeInfo provides to UseTypeInfo.
+func GeneratedTypeInfo(sample interface{}) *TypeInfo {
+	vt := reflect.TypeOf(sample)
+	for vt.Kind() == reflect.Ptr {
+		vt = vt.Elem()
+	}
+	return reflectTypeInfo(vt)
+}
+
+// IsTransparentForInput returns whether win is currently transparent
+// for input, as requested via SetClickThrough or SetInputRegion.
+func (win *Window) IsTransparentForInput() bool {
+	return win.isTransparentForInput()
+}
+
+// GUIRoundTrips returns how many functions were handed by other
+// goroutines to the main GUI thread so far.
+func GUIRoundTrips() int {
+	return int(atomic.LoadUint64(&guiRoundTrips))
+}
+
+// WaitUpdates waits until list is done consuming the channel provided
+// to UpdateFromChannel, if any, which happens once the channel is closed
+// and all the operations received from it were applied.
+func (list *List) WaitUpdates() {
+	var updating chan bool
+	gui(func() { updating = list.updating })
+	if updating != nil {
+		<-updating
+	}
+}
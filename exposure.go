@@ -0,0 +1,150 @@
+package qml
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ExposurePolicy defines which exported fields of Go structs are made
+// available to QML, when values are provided via Context.SetVar and
+// Context.SetVars, created by registered types, or held by list models,
+// and which ones are considered by Object.Scan and Object.Fill.
+type ExposurePolicy int
+
+const (
+	// DefaultExposure leaves the policy of a type to the one defined
+	// via SetExposurePolicy.
+	DefaultExposure ExposurePolicy = iota
+
+	// OptOut exposes all exported fields, except for those tagged
+	// with `qml:"-"`. Fields tagged with a name, in the form
+	// `qml:"name"`, are exposed under that name rather than the one
+	// derived from the field name. This is the policy used by default.
+	OptOut
+
+	// OptIn exposes only the exported fields tagged with the name of
+	// their QML member, in the form `qml:"name"`. Other fields are not
+	// available to QML at all, so reading them from QML behaves as
+	// reading a property that does not exist.
+	OptIn
+)
+
+var (
+	exposureMutex  sync.Mutex
+	exposurePolicy = OptOut
+	typeExposure   = make(map[reflect.Type]ExposurePolicy)
+)
+
+// SetExposurePolicy sets the policy for the types without a policy of
+// their own, set via SetTypeExposure or TypeSpec.Exposure. Since the
+// members of a type are only inspected once, the policy must be set
+// before values of the affected types are first provided to QML.
+func SetExposurePolicy(policy ExposurePolicy) {
+	if policy == DefaultExposure {
+		policy = OptOut
+	}
+	exposureMutex.Lock()
+	exposurePolicy = policy
+	exposureMutex.Unlock()
+}
+
+// SetTypeExposure sets the policy for the struct type of sample, which
+// may also be a pointer to the struct, overriding the one defined via
+// SetExposurePolicy unless policy is DefaultExposure. As with
+// SetExposurePolicy, the policy must be set before values of the type
+// are first provided to QML.
+func SetTypeExposure(sample interface{}, policy ExposurePolicy) {
+	setTypeExposure(reflect.TypeOf(sample), policy)
+}
+
+func setTypeExposure(typ reflect.Type, policy ExposurePolicy) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	exposureMutex.Lock()
+	if policy == DefaultExposure {
+		delete(typeExposure, typ)
+	} else {
+		typeExposure[typ] = policy
+	}
+	exposureMutex.Unlock()
+}
+
+// optsIn returns whether the struct type st only exposes tagged fields.
+func optsIn(st reflect.Type) bool {
+	exposureMutex.Lock()
+	defer exposureMutex.Unlock()
+	if policy, ok := typeExposure[st]; ok {
+		return policy == OptIn
+	}
+	return exposurePolicy == OptIn
+}
+
+// wrappedFieldName returns the name of the QML member exposing field of
+// the struct type st in values wrapped for QML, and whether the field is
+// exposed at all. Tagged fields are named by their tag, and untagged
+// fields of types that don't opt in are named after the field name, as
+// properties or, if signal is true, as signals.
+func wrappedFieldName(st reflect.Type, field reflect.StructField, signal bool) (name string, ok bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("qml")
+	if tag == "-" || tag == "" && optsIn(st) {
+		return "", false
+	}
+	if tag != "" {
+		return tag, true
+	}
+	if signal {
+		return signalName(field.Name), true
+	}
+	return memberName(field.Name), true
+}
+
+// checkMemberNames returns an error if a field of the struct type vt
+// renamed via its tag is exposed under the same name as another member.
+// Clashes between untagged members are left alone, as the first member
+// has always won those.
+func checkMemberNames(vt reflect.Type) error {
+	for vt.Kind() == reflect.Ptr {
+		vt = vt.Elem()
+	}
+	if vt.Kind() != reflect.Struct {
+		return nil
+	}
+	type member struct {
+		goName string
+		tagged bool
+	}
+	seen := make(map[string]member)
+	add := func(name string, m member) error {
+		if other, ok := seen[name]; ok && (m.tagged || other.tagged) {
+			return fmt.Errorf("%s and %s are both exposed to QML as %q", other.goName, m.goName, name)
+		}
+		seen[name] = m
+		return nil
+	}
+	for _, vf := range visibleFields(vt) {
+		field := vf.field
+		name, ok := wrappedFieldName(vf.owner, field, isSignalType(field.Type))
+		if !ok {
+			continue
+		}
+		if err := add(name, member{"field " + field.Name, field.Tag.Get("qml") != ""}); err != nil {
+			return err
+		}
+	}
+	vtptr := reflect.PtrTo(vt)
+	for i := 0; i < vtptr.NumMethod(); i++ {
+		method := vtptr.Method(i)
+		if !isMethodExposed(method) {
+			continue
+		}
+		if err := add(memberName(method.Name), member{"method " + method.Name, false}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// GLStage defines when the items of a type registered with RegisterGLType
+// are painted relative to the QML scene of their window.
+type GLStage int
+
+const (
+	// GLAfterScene paints the items over the QML scene.
+	GLAfterScene GLStage = iota
+
+	// GLBeforeScene paints the items under the QML scene. The window
+	// is not cleared before the items are painted, and only the parts
+	// of the scene that are transparent let the painting show through.
+	GLBeforeScene
+)
+
+// GL describes the geometry of an item of a type registered with
+// RegisterGLType when it is painted.
+type GL struct {
+	// X, Y, Width and Height hold the geometry of the item in window
+	// coordinates, which have the origin at the top left corner of the
+	// window and are not scaled by the device pixel ratio.
+	X, Y, Width, Height float64
+
+	// WindowWidth and WindowHeight hold the size of the window in
+	// window coordinates.
+	WindowWidth, WindowHeight float64
+
+	// DevicePixelRatio holds the number of device pixels per unit of
+	// window coordinates, such as 2 for high density displays.
+	DevicePixelRatio float64
+}
+
+// Viewport returns the area of the item in device pixels, with the origin
+// at the bottom left corner of the window as used by OpenGL, which is
+// suitable for glViewport and glScissor.
+func (gl *GL) Viewport() (x, y, width, height int) {
+	r := gl.DevicePixelRatio
+	x = int(math.Floor(gl.X * r))
+	y = int(math.Floor((gl.WindowHeight - gl.Y - gl.Height) * r))
+	width = int(math.Ceil(gl.Width * r))
+	height = int(math.Ceil(gl.Height * r))
+	return
+}
+
+// glValue is implemented by the values of types registered with
+// RegisterGLType.
+type glValue interface {
+	Paint(gl *GL)
+}
+
+var glPointerType = reflect.TypeOf((*GL)(nil))
+
+//export hookGoValueGLPaint
+func hookGoValueGLPaint(foldp unsafe.Pointer, state *C.GLState) {
+	// Not moved into the GUI thread, as items are painted from the
+	// render thread with its OpenGL context current.
+	fold := (*valueFold)(foldp)
+	value, ok := fold.gvalue.(glValue)
+	if !ok {
+		return
+	}
+	value.Paint(&GL{
+		X:                float64(state.x),
+		Y:                float64(state.y),
+		Width:            float64(state.width),
+		Height:           float64(state.height),
+		WindowWidth:      float64(state.windowWidth),
+		WindowHeight:     float64(state.windowHeight),
+		DevicePixelRatio: float64(state.devicePixelRatio),
+	})
+}
@@ -0,0 +1,237 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// imageProvider holds the function that provides the images requested
+// via an image provider registered with Engine.AddImageProvider, or the
+// one providing encoded images registered with AddEncodedImageProvider.
+type imageProvider struct {
+	f       func(id string, width, height int) image.Image
+	encoded func(id string, width, height int) (data []byte, format string)
+
+	// The location the provider was registered from, to report images
+	// that cannot be decoded.
+	file string
+	line int
+}
+
+// imageProviders holds the providers alive until their C++ counterparts
+// are destroyed, since these only hold unsafe references to them.
+// Providers are destroyed out of the GUI thread when an image was being
+// loaded at the time, so the map is protected by a mutex.
+var (
+	imageProvidersMutex sync.Mutex
+	imageProviders      = make(map[*imageProvider]bool)
+)
+
+// AddImageProvider registers f as the provider of the images requested
+// by QML code running under the engine with sources such as
+// "image://name/id", replacing the provider previously registered with
+// the same name, if any. Provider names are case insensitive.
+//
+// The f function is called with the image id, and with the width and
+// height requested via the sourceSize property of the Image element, or
+// zero when no size was requested. The image returned is scaled by QML
+// as necessary, and a nil image makes the request fail.
+//
+// The f function is called from the image loading thread of Qt, and from
+// the main GUI thread for images that are not loaded asynchronously, so
+// it must be safe for concurrent use. Images of types *image.RGBA and
+// *image.NRGBA are converted more efficiently than other types.
+func (e *Engine) AddImageProvider(name string, f func(id string, width, height int) image.Image) {
+	e.addImageProvider(name, &imageProvider{f: f})
+}
+
+// AddEncodedImageProvider works as AddImageProvider, but f provides the
+// image already encoded in the named format, such as "png" or "jpg", so
+// that images read from files or from the network are decoded by Qt
+// without going through an image.Image value. An empty format makes Qt
+// guess it from the data. Requests fail if f returns no data, or if the
+// data cannot be decoded, in which case the reason is logged. See
+// ImageFormats for the formats that may be decoded.
+func (e *Engine) AddEncodedImageProvider(name string, f func(id string, width, height int) (data []byte, format string)) {
+	e.addImageProvider(name, &imageProvider{encoded: f})
+}
+
+func (e *Engine) addImageProvider(name string, provider *imageProvider) {
+	_, provider.file, provider.line, _ = runtime.Caller(2)
+	gui(func() {
+		e.setImageProvider(strings.ToLower(name), provider)
+	})
+}
+
+// setImageProvider registers provider with the lowercase name.
+//
+// This must be run from the main GUI thread.
+func (e *Engine) setImageProvider(name string, provider *imageProvider) {
+	imageProvidersMutex.Lock()
+	imageProviders[provider] = true
+	imageProvidersMutex.Unlock()
+	if e.providers == nil {
+		e.providers = make(map[string]*imageProvider)
+	}
+	e.providers[name] = provider
+	cname, cnamelen := unsafeStringData(name)
+	qname := C.newString(cname, cnamelen)
+	defer C.delString(qname)
+	C.engineAddImageProvider(e.addr, qname, unsafe.Pointer(provider))
+}
+
+// RemoveImageProvider removes the image provider registered with name.
+// Images being loaded at the time may still be requested from it.
+func (e *Engine) RemoveImageProvider(name string) {
+	name = strings.ToLower(name)
+	cname, cnamelen := unsafeStringData(name)
+	gui(func() {
+		delete(e.providers, name)
+		qname := C.newString(cname, cnamelen)
+		defer C.delString(qname)
+		C.engineRemoveImageProvider(e.addr, qname)
+	})
+}
+
+//export hookImageProviderRequest
+func hookImageProviderRequest(providerp unsafe.Pointer, cid *C.char, cidLen, width, height C.int) unsafe.Pointer {
+	// Not moved into the GUI thread, as images are loaded concurrently.
+	provider := (*imageProvider)(providerp)
+	if provider.encoded != nil {
+		data, format := provider.encoded(C.GoStringN(cid, cidLen), int(width), int(height))
+		qimage, err := encodedImage(data, format)
+		if err != nil {
+			logMutex.RLock()
+			handler := logHandler
+			logMutex.RUnlock()
+			handler.QmlOutput(&goLogMessage{LogWarning, "qml: image provider: " + err.Error(), provider.file, provider.line})
+		}
+		return qimage
+	}
+	img := provider.f(C.GoStringN(cid, cidLen), int(width), int(height))
+	if img == nil {
+		return nilPtr
+	}
+	bounds := img.Bounds()
+	premultiplied := C.int(1)
+	if _, ok := img.(*image.NRGBA); ok {
+		premultiplied = 0
+	}
+	var bits *C.uchar
+	var stride C.int
+	qimage := C.newImage(C.int(bounds.Dx()), C.int(bounds.Dy()), premultiplied, &bits, &stride)
+	fillImage(img, unsafe.Pointer(bits), int(stride))
+	return qimage
+}
+
+// encodedImage returns a new QImage decoded from data, or nil if there's
+// no data or it cannot be decoded, in which case an error is returned too.
+func encodedImage(data []byte, format string) (unsafe.Pointer, error) {
+	if len(data) == 0 {
+		return nilPtr, nil
+	}
+	format = strings.ToLower(format)
+	cformat := C.CString(format)
+	defer C.free(unsafe.Pointer(cformat))
+	qimage := C.newImageFromData((*C.char)(unsafe.Pointer(&data[0])), C.int(len(data)), cformat)
+	if qimage != nilPtr {
+		return qimage, nil
+	}
+	if format == "" {
+		return nilPtr, fmt.Errorf("cannot decode image of unknown format")
+	}
+	if err := checkImageFormat(format, false); err != nil {
+		return nilPtr, err
+	}
+	return nilPtr, fmt.Errorf("cannot decode image as %q: invalid data", format)
+}
+
+var (
+	imageFormatsOnce                    sync.Once
+	imageReadFormats, imageWriteFormats []string
+)
+
+// ImageFormats returns the image formats that may be decoded by Qt, as
+// done for images provided via AddEncodedImageProvider, and the ones that
+// may be encoded, as done by Window.SnapshotEncoded. The formats depend
+// on the image plugins installed with Qt. ImageFormats must be called
+// after Init.
+func ImageFormats() (read, write []string) {
+	imageFormatsOnce.Do(func() {
+		// Qt lists the formats safely from any thread, including the
+		// image loading ones the providers are called from.
+		creport := C.imageReadFormats()
+		imageReadFormats = strings.Fields(C.GoString(creport))
+		C.free(unsafe.Pointer(creport))
+		creport = C.imageWriteFormats()
+		imageWriteFormats = strings.Fields(C.GoString(creport))
+		C.free(unsafe.Pointer(creport))
+	})
+	return append([]string(nil), imageReadFormats...), append([]string(nil), imageWriteFormats...)
+}
+
+// checkImageFormat returns an error listing the available formats if
+// format cannot be decoded, or encoded if write is true.
+func checkImageFormat(format string, write bool) error {
+	read, formats := ImageFormats()
+	verb := "encode"
+	if !write {
+		formats = read
+		verb = "decode"
+	}
+	for _, f := range formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot %s image as %q: available formats are %s", verb, format, strings.Join(formats, ", "))
+}
+
+// fillImage writes the pixels of img into the buffer at bits, holding
+// rows of stride bytes with 32-bit ARGB pixels in native byte order, as
+// used by QImage. The buffer holds premultiplied pixels unless img is
+// an *image.NRGBA.
+func fillImage(img image.Image, bits unsafe.Pointer, stride int) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		dst := (*[1 << 28]uint32)(unsafe.Pointer(uintptr(bits) + uintptr(y*stride)))[:w]
+		switch img := img.(type) {
+		case *image.RGBA:
+			fillRow(dst, img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):])
+		case *image.NRGBA:
+			fillRow(dst, img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):])
+		default:
+			for x := range dst {
+				cr, cg, cb, ca := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				dst[x] = (ca>>8)<<24 | (cr>>8)<<16 | (cg>>8)<<8 | cb>>8
+			}
+		}
+	}
+}
+
+// fillRow writes into dst the pixels in src, which holds 8-bit
+// components in R, G, B, A order.
+func fillRow(dst []uint32, src []uint8) {
+	for x := range dst {
+		p := src[x*4 : x*4+4]
+		dst[x] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+	}
+}
+
+//export hookImageProviderDestroyed
+func hookImageProviderDestroyed(providerp unsafe.Pointer) {
+	imageProvidersMutex.Lock()
+	delete(imageProviders, (*imageProvider)(providerp))
+	imageProvidersMutex.Unlock()
+}
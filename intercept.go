@@ -0,0 +1,104 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// URLKind identifies what a URL intercepted by an engine refers to.
+// See Engine.SetURLInterceptor.
+type URLKind int
+
+// The values match the respective QQmlAbstractUrlInterceptor::DataType values.
+const (
+	QMLFileURL        URLKind = 0 // A QML document, such as one loaded via Engine.LoadFile or imported by another.
+	JavaScriptFileURL URLKind = 1 // A JavaScript file imported by QML code.
+	QmldirFileURL     URLKind = 2 // The qmldir file of a module being imported.
+	ResourceURL       URLKind = 3 // Any other URL, such as the source of an Image element.
+)
+
+// The interceptors are called from the thread where Qt loads types, so
+// they're guarded by interceptorMutex rather than confined to the GUI
+// thread.
+var (
+	interceptorMutex sync.Mutex
+
+	// urlInterceptors holds the interceptors set for each engine.
+	urlInterceptors = make(map[unsafe.Pointer]func(url string, kind URLKind) string)
+
+	// interceptorInstalled holds whether the engine refers to the C++
+	// interceptor, which calls the Go one if any is set.
+	interceptorInstalled = make(map[unsafe.Pointer]bool)
+)
+
+// SetURLInterceptor arranges for f to be called with every URL the engine
+// is about to load, including those of QML documents, JavaScript files,
+// and modules being imported, and of resources such as images, and for
+// the URL returned by f to be loaded instead:
+//
+//     engine.SetURLInterceptor(func(url string, kind qml.URLKind) string {
+//         if strings.HasPrefix(url, base+"assets/skin/") {
+//             return themeBase + strings.TrimPrefix(url, base+"assets/skin/")
+//         }
+//         return url
+//     })
+//
+// URLs are provided in their absolute form, with local files as "file:"
+// URLs and resources loaded via LoadResources as "qrc:" URLs, so f may
+// redirect files to resources and vice versa. Returning url unchanged,
+// or an empty string, leaves it alone at a negligible cost.
+//
+// The function f is called synchronously while the URL is resolved,
+// from the main GUI thread or from the thread where Qt loads types, so
+// it must be fast and safe for concurrent use, and must not use the
+// qml package. Engines created via NewChildEngine after the interceptor
+// is set use it as well. A nil f unsets the interceptor.
+func (e *Engine) SetURLInterceptor(f func(url string, kind URLKind) string) {
+	e.assertValid()
+	interceptorMutex.Lock()
+	if f != nil {
+		urlInterceptors[e.addr] = f
+	} else {
+		delete(urlInterceptors, e.addr)
+	}
+	install := f != nil && !interceptorInstalled[e.addr]
+	if install {
+		interceptorInstalled[e.addr] = true
+	}
+	interceptorMutex.Unlock()
+	if install {
+		gui(func() {
+			C.engineInstallUrlInterceptor(e.addr)
+		})
+	}
+}
+
+// forgetURLInterceptor drops the interceptor set for the engine at addr.
+func forgetURLInterceptor(addr unsafe.Pointer) {
+	interceptorMutex.Lock()
+	delete(urlInterceptors, addr)
+	delete(interceptorInstalled, addr)
+	interceptorMutex.Unlock()
+}
+
+//export hookUrlIntercept
+func hookUrlIntercept(engine unsafe.Pointer, curl *C.char, curlLen C.int, kind C.int) *C.char {
+	// Not moved into the GUI thread, as types are loaded from another
+	// thread, which must be kept blocked meanwhile.
+	interceptorMutex.Lock()
+	f := urlInterceptors[engine]
+	interceptorMutex.Unlock()
+	if f == nil {
+		return nilCharPtr
+	}
+	url := C.GoStringN(curl, curlLen)
+	result := f(url, URLKind(kind))
+	if result == "" || result == url {
+		return nilCharPtr
+	}
+	return C.CString(result)
+}
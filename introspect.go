@@ -0,0 +1,220 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// PropertyInfo describes a property of a QML object, as reported by
+// Object.Properties.
+type PropertyInfo struct {
+	Name string
+
+	// Type is the name of the property type as known by Qt, such as
+	// "int", "QString", or "QVariant" for var properties.
+	Type string
+
+	Writable  bool
+	HasNotify bool
+}
+
+// MethodInfo describes a method or signal of a QML object, as reported
+// by Object.Methods.
+type MethodInfo struct {
+	Name   string
+	Signal bool
+
+	// Result is the name of the result type as known by Qt, or "void".
+	Result string
+
+	// ParamTypes and ParamNames hold the type and name of each parameter.
+	// Names are empty if unknown.
+	ParamTypes []string
+	ParamNames []string
+}
+
+// Properties returns information about all the properties of the object,
+// including the ones it inherits and the ones declared by QML documents,
+// in the order defined by its class hierarchy.
+func (obj *Object) Properties() []PropertyInfo {
+	obj.assertLive()
+	var report string
+	gui(func() {
+		creport := C.objectPropertiesReport(obj.addr)
+		report = C.GoString(creport)
+		C.free(unsafe.Pointer(creport))
+	})
+	var props []PropertyInfo
+	for _, fields := range splitReport(report, 4) {
+		props = append(props, PropertyInfo{
+			Name:      fields[0],
+			Type:      fields[1],
+			Writable:  fields[2] == "1",
+			HasNotify: fields[3] == "1",
+		})
+	}
+	return props
+}
+
+// PropertyMeta holds detailed information about a property of a QML
+// object, as reported by Object.PropertyInfo, meant for tools such as
+// property editors that must render any property appropriately.
+type PropertyMeta struct {
+	PropertyInfo
+
+	// Enum is the name of the enum type of the property, and EnumValues
+	// maps the name of each of its keys to the respective value, so that
+	// editors may offer them as choices. Enum is empty and EnumValues is
+	// nil if the property is not an enum.
+	Enum       string
+	EnumValues map[string]int
+
+	// Min and Max hold the range of valid values for the property when
+	// HasMin and HasMax are set. Qt has no standard way to declare such
+	// ranges, so they are taken from class information entries named
+	// after the property, such as "value.minimum" and "value.maximum".
+	HasMin, HasMax bool
+	Min, Max       float64
+
+	// Grouped is whether the property holds sub-properties that are
+	// accessed in QML as anchors.fill or font.bold.
+	Grouped bool
+
+	// NotifySignal is the name of the signal emitted when the property
+	// changes, or empty if there is none.
+	NotifySignal string
+
+	// Bound is whether the property value currently comes from a binding
+	// rather than from an assignment.
+	Bound bool
+}
+
+// PropertyInfo returns detailed information about the named property of
+// the object, which must be one of the properties reported by Properties.
+func (obj *Object) PropertyInfo(name string) (PropertyMeta, error) {
+	obj.assertLive()
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var report string
+	var found bool
+	gui(func() {
+		creport := C.objectPropertyReport(obj.addr, cname)
+		if creport != nil {
+			found = true
+			report = C.GoString(creport)
+			C.free(unsafe.Pointer(creport))
+		}
+	})
+	lines := splitReport(report, 9)
+	if !found || len(lines) != 1 {
+		return PropertyMeta{}, fmt.Errorf("object does not have a %q property", name)
+	}
+	fields := lines[0]
+	meta := PropertyMeta{
+		PropertyInfo: PropertyInfo{
+			Name:      name,
+			Type:      fields[0],
+			Writable:  fields[1] == "1",
+			HasNotify: fields[7] != "",
+		},
+		Enum:         fields[2],
+		Grouped:      fields[6] == "1",
+		NotifySignal: fields[7],
+		Bound:        fields[8] == "1",
+	}
+	if meta.Enum != "" {
+		meta.EnumValues = make(map[string]int)
+		for _, pair := range strings.Split(fields[3], ";") {
+			if i := strings.Index(pair, "="); i > 0 {
+				meta.EnumValues[pair[:i]], _ = strconv.Atoi(pair[i+1:])
+			}
+		}
+	}
+	var err error
+	if fields[4] != "" {
+		meta.Min, err = strconv.ParseFloat(fields[4], 64)
+		meta.HasMin = err == nil
+	}
+	if fields[5] != "" {
+		meta.Max, err = strconv.ParseFloat(fields[5], 64)
+		meta.HasMax = err == nil
+	}
+	return meta, nil
+}
+
+// Methods returns information about the methods and signals of the
+// object that are accessible to QML, including the ones it inherits and
+// the ones declared by QML documents, in the order defined by its class
+// hierarchy. Overloaded methods are reported once per overload.
+func (obj *Object) Methods() []MethodInfo {
+	obj.assertLive()
+	var report string
+	gui(func() {
+		creport := C.objectMethodsReport(obj.addr)
+		report = C.GoString(creport)
+		C.free(unsafe.Pointer(creport))
+	})
+	var methods []MethodInfo
+	for _, fields := range splitReport(report, 5) {
+		method := MethodInfo{
+			Name:       fields[0],
+			Signal:     fields[1] == "1",
+			Result:     fields[2],
+			ParamTypes: []string{},
+			ParamNames: []string{},
+		}
+		if fields[3] != "" {
+			method.ParamTypes = strings.Split(fields[3], ";")
+			method.ParamNames = make([]string, len(method.ParamTypes))
+			copy(method.ParamNames, strings.Split(fields[4], ";"))
+		}
+		if method.Result == "" {
+			method.Result = "void"
+		}
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+// splitReport returns the lines in report, each split into n
+// tab-separated fields.
+func splitReport(report string, n int) [][]string {
+	var lines [][]string
+	for _, line := range strings.Split(report, "\n") {
+		fields := strings.SplitN(line, "\t", n)
+		if len(fields) == n {
+			lines = append(lines, fields)
+		}
+	}
+	return lines
+}
+
+// Children returns the objects that have obj as their parent object,
+// in the order they were parented. For items declared in QML documents
+// these include both the visual children and other objects declared
+// inside the item, such as timers and states.
+func (obj *Object) Children() []*Object {
+	obj.assertLive()
+	var children []*Object
+	gui(func() {
+		var clen C.int
+		cchildren := C.objectChildren(obj.addr, &clen)
+		if clen == 0 {
+			return
+		}
+		for i := 0; i < int(clen); i++ {
+			addr := *(*unsafe.Pointer)(unsafe.Pointer(uintptr(unsafe.Pointer(cchildren)) + uintptr(i)*unsafe.Sizeof(nilPtr)))
+			children = append(children, wrapObject(addr, obj.engine))
+		}
+		C.free(unsafe.Pointer(cchildren))
+	})
+	return children
+}
@@ -0,0 +1,130 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+	"unsafe"
+)
+
+// JSError describes a JavaScript exception that was not caught by QML
+// code, as provided to the functions registered via
+// Engine.OnUncaughtException.
+type JSError struct {
+	Name    string // Such as "TypeError" or "ReferenceError".
+	Message string
+	URL     string
+	Line    int
+	Column  int
+
+	// Stack holds the stack trace of the exception when available.
+	// The supported Qt versions report uncaught exceptions without
+	// it, so for now it only holds the location of the exception.
+	Stack string
+
+	// Suppressed is the number of exceptions dropped right before this
+	// one because too many were thrown in a short period of time.
+	Suppressed int
+}
+
+func (e *JSError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", e.URL, e.Line, e.Column, e.Name, e.Message)
+}
+
+// exceptionsPerSecond is the maximum number of uncaught exceptions
+// reported per second for an engine.
+const exceptionsPerSecond = 10
+
+// exceptionWatch holds the functions called when an uncaught exception
+// is reported by an engine, and the state of the rate limiting.
+type exceptionWatch struct {
+	handlers   []func(err *JSError)
+	queue      callbackQueue
+	period     time.Time
+	reported   int
+	suppressed int
+}
+
+var exceptionPattern = regexp.MustCompile(`^(?:Uncaught exception: )?([A-Za-z]*Error): (.*)$`)
+
+// OnUncaughtException arranges for f to be called in a goroutine owned by
+// the package whenever JavaScript code running under the engine throws an
+// exception that is not caught, such as in signal handlers, bindings, and
+// functions invoked by Go code without waiting for a result, as done when
+// emitting signals. Exceptions thrown by functions invoked via Object.Call
+// are reported as errors by CallError, though Qt may report them to f too.
+//
+// Functions are called in registration order, one at a time, as
+// documented in the Callbacks section of the package documentation. At
+// most 10 exceptions are reported per second, and the number of
+// exceptions dropped meanwhile is reported via the Suppressed field of
+// the next exception reported.
+//
+// Exceptions are recognized among the warnings reported by the engine,
+// so thrown values that are not Error objects, such as strings, are not
+// reported. These warnings are still logged as usual.
+func (e *Engine) OnUncaughtException(f func(err *JSError)) {
+	e.assertValid()
+	gui(func() {
+		if e.exceptions == nil {
+			e.exceptions = &exceptionWatch{}
+			C.engineWatchWarnings(e.addr)
+		}
+		e.exceptions.handlers = append(e.exceptions.handlers, f)
+	})
+}
+
+// allow returns whether an exception reported at now may be delivered,
+// and if so how many were suppressed before it.
+func (watch *exceptionWatch) allow(now time.Time) (ok bool, suppressed int) {
+	if now.Sub(watch.period) >= time.Second {
+		watch.period = now
+		watch.reported = 0
+	}
+	if watch.reported >= exceptionsPerSecond {
+		watch.suppressed++
+		return false, 0
+	}
+	watch.reported++
+	suppressed = watch.suppressed
+	watch.suppressed = 0
+	return true, suppressed
+}
+
+//export hookEngineWarning
+func hookEngineWarning(enginep unsafe.Pointer, curl *C.char, curlLen, line, column C.int, cdesc *C.char, cdescLen C.int) {
+	if !onGuiThread("hookEngineWarning") {
+		gui(func() { hookEngineWarning(enginep, curl, curlLen, line, column, cdesc, cdescLen) })
+		return
+	}
+	engine := engines[enginep]
+	if engine == nil || engine.exceptions == nil {
+		return
+	}
+	m := exceptionPattern.FindStringSubmatch(C.GoStringN(cdesc, cdescLen))
+	if m == nil {
+		return
+	}
+	watch := engine.exceptions
+	ok, suppressed := watch.allow(time.Now())
+	if !ok {
+		return
+	}
+	err := &JSError{
+		Name:       m[1],
+		Message:    m[2],
+		URL:        C.GoStringN(curl, curlLen),
+		Line:       int(line),
+		Column:     int(column),
+		Suppressed: suppressed,
+	}
+	err.Stack = fmt.Sprintf("%s:%d:%d", err.URL, err.Line, err.Column)
+	for _, f := range watch.handlers {
+		f := f
+		watch.queue.dispatch(func() { f(err) })
+	}
+}
@@ -0,0 +1,120 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unsafe"
+)
+
+// Regexp holds a JavaScript regular expression obtained from QML, such
+// as the value of a var property holding /ab+c/i.
+type Regexp struct {
+	Pattern string
+	Flags   string // Such as "gi".
+}
+
+func (re Regexp) String() string {
+	return "/" + re.Pattern + "/" + re.Flags
+}
+
+// Compile compiles the regular expression with the regexp package. The
+// "i" and "m" flags, and the "s" flag of expressions converted from Qt,
+// are honored, while the "g" flag is ignored as it only affects how the
+// expression is used. Compile returns an error if the pattern uses syntax
+// not supported by the regexp package, such as backreferences.
+func (re Regexp) Compile() (*regexp.Regexp, error) {
+	var prefix string
+	for _, flag := range re.Flags {
+		if strings.ContainsRune("ims", flag) {
+			prefix += string(flag)
+		}
+	}
+	pattern := re.Pattern
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// parseRegexp parses a regular expression in the "/pattern/flags" form.
+func parseRegexp(s string) Regexp {
+	i := strings.LastIndex(s, "/")
+	return Regexp{Pattern: s[1:i], Flags: s[i+1:]}
+}
+
+// TypedArray wraps a slice of numbers so that it's provided to QML as a
+// JavaScript typed array, such as a Float32Array for a []float32, rather
+// than as a generic array holding a copy of each number. The slice must
+// be a []int8, []uint8, []int16, []uint16, []int32, []uint32, []float32,
+// or []float64, and it's copied into the typed array:
+//
+//     obj.Set("samples", qml.TypedArray{samples})
+//
+// Typed arrays obtained from QML are unpacked into slices of these types
+// without the wrapper. If the JavaScript engine has no typed arrays, as
+// is the case before Qt 5.5, a generic array is provided instead.
+type TypedArray struct {
+	Slice interface{}
+}
+
+var typedArrayTypes = map[reflect.Type]C.DataType{
+	reflect.TypeOf([]int8(nil)):    C.DTInt8Array,
+	reflect.TypeOf([]uint8(nil)):   C.DTUint8Array,
+	reflect.TypeOf([]int16(nil)):   C.DTInt16Array,
+	reflect.TypeOf([]uint16(nil)):  C.DTUint16Array,
+	reflect.TypeOf([]int32(nil)):   C.DTInt32Array,
+	reflect.TypeOf([]uint32(nil)):  C.DTUint32Array,
+	reflect.TypeOf([]float32(nil)): C.DTFloat32Array,
+	reflect.TypeOf([]float64(nil)): C.DTFloat64Array,
+}
+
+// packTypedArray packs the slice held by array into dvalue as a
+// JavaScript typed array created under engine.
+//
+// This must be run from the main GUI thread.
+func packTypedArray(array TypedArray, dvalue *C.DataValue, engine *Engine, owner valueOwner) {
+	v := reflect.ValueOf(array.Slice)
+	dataType, ok := typedArrayTypes[v.Type()]
+	if !ok {
+		panic(fmt.Sprintf("cannot use %T as a typed array", array.Slice))
+	}
+	if engine == nil {
+		// No engine to create the typed array with yet.
+		packDataValue(array.Slice, dvalue, engine, owner)
+		return
+	}
+	data := nilPtr
+	if v.Len() > 0 {
+		data = unsafe.Pointer(v.Pointer())
+	}
+	datap := unsafe.Pointer(&dvalue.data)
+	dvalue.dataType = C.DTJSValue
+	*(*unsafe.Pointer)(datap) = C.engineNewTypedArray(engine.addr, dataType, data, C.int(v.Len()))
+}
+
+// unpackTypedArray returns the typed array elements in dvalue copied
+// into a slice of the respective type.
+func unpackTypedArray(dvalue *C.DataValue) interface{} {
+	data := *(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data))
+	defer C.free(data)
+	for typ, dataType := range typedArrayTypes {
+		if dataType != dvalue.dataType {
+			continue
+		}
+		n := int(dvalue.len)
+		v := reflect.MakeSlice(typ, n, n)
+		if size := n * int(typ.Elem().Size()); size > 0 {
+			copy((*[1 << 30]byte)(unsafe.Pointer(v.Pointer()))[:size], (*[1 << 30]byte)(data)[:size])
+		}
+		return v.Interface()
+	}
+	panic(fmt.Sprintf("unsupported data type: %d", dvalue.dataType))
+}
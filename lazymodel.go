@@ -0,0 +1,175 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"unsafe"
+)
+
+// lazyModelCachePages is the number of pages of items held in memory
+// by a LazyModel. Pages accessed least recently are dropped first.
+const lazyModelCachePages = 8
+
+// LazyModel is a list model that obtains its items from Go on demand,
+// one page at a time, so that views such as ListView only cause the items
+// they display to be fetched. Each item is available to delegates as
+// modelData.
+type LazyModel struct {
+	addr  unsafe.Pointer
+	count func() int
+	fetch func(offset, limit int) []interface{}
+
+	engine   *Engine
+	pageSize int
+	pages    map[int][]interface{}
+	lru      []int
+}
+
+// lazyModels holds the models alive until they are destroyed, since
+// their C++ counterparts only hold unsafe references to them.
+var lazyModels = make(map[*LazyModel]bool)
+
+// NewLazyModel returns a list model with count() items, which are
+// obtained via fetch as needed. The fetch function must return the
+// limit items starting at offset, or fewer if the end of the list is
+// reached. Both functions are called in the main GUI thread, so they
+// must not block for long and must not call back into blocking
+// functionality of the qml package.
+//
+// The model is made available to QML via Context.SetVar, and its
+// Destroy method must be called once it is not necessary anymore.
+func NewLazyModel(count func() int, fetch func(offset, limit int) []interface{}) *LazyModel {
+	model := &LazyModel{
+		count:    count,
+		fetch:    fetch,
+		pageSize: 100,
+		pages:    make(map[int][]interface{}),
+	}
+	gui(func() {
+		lazyModels[model] = true
+		model.addr = C.newLazyModel(unsafe.Pointer(model))
+	})
+	return model
+}
+
+// SetPageSize sets the number of items fetched at once, which is also
+// the number of rows added to the model each time a view asks for more.
+// The default page size is 100.
+func (model *LazyModel) SetPageSize(size int) {
+	if size < 1 {
+		panic("page size must be positive")
+	}
+	gui(func() {
+		model.pageSize = size
+		model.dropPages()
+		C.lazyModelSetPageSize(model.addr, C.int(size))
+	})
+}
+
+// Invalidate drops the cached items in the given range, and notifies
+// views so that they fetch those items again.
+func (model *LazyModel) Invalidate(offset, count int) {
+	gui(func() {
+		for page := range model.pages {
+			start := page * model.pageSize
+			if start < offset+count && offset < start+model.pageSize {
+				model.dropPage(page)
+			}
+		}
+		C.lazyModelInvalidate(model.addr, C.int(offset), C.int(count))
+	})
+}
+
+// Refresh drops all cached items and obtains the item count again,
+// notifying views about removed rows and changed items. Further rows
+// are added as views ask for them.
+func (model *LazyModel) Refresh() {
+	gui(func() {
+		model.dropPages()
+		C.lazyModelRefresh(model.addr)
+	})
+}
+
+// Destroy destroys the model. The model must not be used after this
+// method is called.
+func (model *LazyModel) Destroy() {
+	gui(func() {
+		if lazyModels[model] {
+			delete(lazyModels, model)
+			C.delObjectLater(model.addr)
+		}
+	})
+}
+
+// item returns the item at row, fetching its page if necessary.
+//
+// This must be run from the main GUI thread.
+func (model *LazyModel) item(row int) interface{} {
+	page := row / model.pageSize
+	items, ok := model.pages[page]
+	if ok {
+		model.dropPage(page)
+	} else {
+		items = model.fetch(page*model.pageSize, model.pageSize)
+		if len(model.lru) == lazyModelCachePages {
+			model.dropPage(model.lru[0])
+		}
+	}
+	model.pages[page] = items
+	model.lru = append(model.lru, page)
+
+	if i := row - page*model.pageSize; i < len(items) {
+		return items[i]
+	}
+	return nil
+}
+
+func (model *LazyModel) dropPage(page int) {
+	delete(model.pages, page)
+	for i, p := range model.lru {
+		if p == page {
+			model.lru = append(model.lru[:i], model.lru[i+1:]...)
+			break
+		}
+	}
+}
+
+func (model *LazyModel) dropPages() {
+	model.pages = make(map[int][]interface{})
+	model.lru = nil
+}
+
+//export hookLazyModelCount
+func hookLazyModelCount(addr unsafe.Pointer) C.int {
+	if !onGuiThread("hookLazyModelCount") {
+		var count C.int
+		gui(func() { count = hookLazyModelCount(addr) })
+		return count
+	}
+	return C.int((*LazyModel)(addr).count())
+}
+
+//export hookLazyModelData
+func hookLazyModelData(enginep, addr unsafe.Pointer, row C.int, result *C.DataValue) {
+	if !onGuiThread("hookLazyModelData") {
+		gui(func() { hookLazyModelData(enginep, addr, row, result) })
+		return
+	}
+	model := (*LazyModel)(addr)
+	engine := model.engine
+	if enginep != nilPtr {
+		engine = engines[enginep]
+	}
+	packDataValue(model.item(int(row)), result, engine, jsOwner)
+}
+
+//export hookLazyModelDestroyed
+func hookLazyModelDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookLazyModelDestroyed") {
+		gui(func() { hookLazyModelDestroyed(addr) })
+		return
+	}
+	delete(lazyModels, (*LazyModel)(addr))
+}
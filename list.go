@@ -0,0 +1,353 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// List is a list model holding a Go slice of structs, which views such
+// as ListView display and update live as items are added, removed, and
+// changed via the List methods. The exported fields of each item are
+// available to delegates as model roles, named as documented in
+// Context.SetVar, or by the field tag in the form `qml:"name"`.
+// Fields tagged with `qml:"-"` are not made available.
+//
+// List methods may be called from any goroutine.
+type List struct {
+	addr   unsafe.Pointer
+	engine *Engine
+
+	itemType
+	items reflect.Value
+
+	// updating is closed once the list is done consuming operations
+	// via UpdateFromChannel, and is nil while it's not consuming any.
+	updating chan bool
+}
+
+// itemType describes the items held by a model, with each role of the
+// model backed by a field of the items.
+type itemType struct {
+	kind     string // Such as "list", for error messages.
+	elemType reflect.Type
+	roles    []string
+	fields   []int
+}
+
+// newItemType returns the item type of a model of the given kind holding
+// items of elemType, which must be a struct or a pointer to a struct.
+func newItemType(kind string, elemType reflect.Type) itemType {
+	it := itemType{kind: kind, elemType: elemType}
+	structType := it.structType()
+	for i := 0; i < structType.NumField(); i++ {
+		if name, ok := propertyName(structType, structType.Field(i)); ok {
+			it.roles = append(it.roles, name)
+			it.fields = append(it.fields, i)
+		}
+	}
+	return it
+}
+
+// lists holds the lists alive until they are destroyed, since their
+// C++ counterparts only hold unsafe references to them.
+var lists = make(map[*List]bool)
+
+// NewList returns a list holding a copy of the items in slice, which must
+// be a slice of structs or of pointers to structs. Values provided to the
+// list methods are converted to the type of the slice items as documented
+// in NewListModel.
+//
+// The list is made available to QML via Context.SetVar, and its Destroy
+// method must be called once it is not necessary anymore.
+func NewList(slice interface{}) *List {
+	sv := reflect.ValueOf(slice)
+	if sv.Kind() != reflect.Slice || !isScanStruct(sv.Type().Elem()) {
+		panic(fmt.Sprintf("cannot create list from %T: not a slice of structs", slice))
+	}
+	return newList(sv.Type().Elem(), sv)
+}
+
+// NewListModel returns an empty list holding items of the same type as
+// prototype, which must be a struct or a pointer to a struct. The type
+// fixes the roles of the list and their types, regardless of the values
+// provided later, so the roles of items with nil fields are not affected.
+//
+// Values provided to the list methods that are not of the item type are
+// converted to it. These may be maps with string keys or other structs,
+// holding values for the list roles that are converted to the role types
+// with the coercions used by Object.Scan. The list methods return an
+// error mentioning the item index when a value cannot be converted, or
+// when it holds values for roles the list does not have.
+func NewListModel(prototype interface{}) *List {
+	typ := reflect.TypeOf(prototype)
+	if typ == nil || !isScanStruct(typ) {
+		panic(fmt.Sprintf("cannot create list model from %T: not a struct", prototype))
+	}
+	return newList(typ, reflect.MakeSlice(reflect.SliceOf(typ), 0, 0))
+}
+
+func newList(elemType reflect.Type, sv reflect.Value) *List {
+	list := &List{
+		itemType: newItemType("list", elemType),
+		items:    reflect.MakeSlice(reflect.SliceOf(elemType), sv.Len(), sv.Len()),
+	}
+	reflect.Copy(list.items, sv)
+
+	croles, crolesLen := unsafeStringData(strings.Join(list.roles, ","))
+	gui(func() {
+		lists[list] = true
+		list.addr = C.newListModel(unsafe.Pointer(list), croles, crolesLen)
+	})
+	return list
+}
+
+// Len returns the number of items in the list.
+func (list *List) Len() int {
+	var n int
+	gui(func() {
+		n = list.items.Len()
+	})
+	return n
+}
+
+// Get returns the item at index.
+func (list *List) Get(index int) interface{} {
+	var item interface{}
+	gui(func() {
+		item = list.items.Index(index).Interface()
+	})
+	return item
+}
+
+// Append adds the provided items at the end of the list. If any of the
+// items cannot be converted to the list item type, no items are added.
+func (list *List) Append(items ...interface{}) error {
+	var err error
+	gui(func() {
+		err = list.insert(list.items.Len(), items)
+	})
+	return err
+}
+
+// Insert adds the provided items to the list at index, moving the
+// items previously at index and after it further down the list.
+// If any of the items cannot be converted to the list item type,
+// no items are added.
+func (list *List) Insert(index int, items ...interface{}) error {
+	var err error
+	gui(func() {
+		if index < 0 || index > list.items.Len() {
+			panic(fmt.Sprintf("cannot insert into list at index %d: list has %d items", index, list.items.Len()))
+		}
+		err = list.insert(index, items)
+	})
+	return err
+}
+
+// Remove removes count items from the list starting at index.
+func (list *List) Remove(index, count int) {
+	gui(func() {
+		n := list.items.Len()
+		if index < 0 || count < 0 || index+count > n {
+			panic(fmt.Sprintf("cannot remove %d items from list at index %d: list has %d items", count, index, n))
+		}
+		list.remove(index, count)
+	})
+}
+
+// Set replaces the item at index with the provided one.
+func (list *List) Set(index int, item interface{}) error {
+	var err error
+	gui(func() {
+		if index < 0 || index >= list.items.Len() {
+			panic(fmt.Sprintf("cannot set list item at index %d: list has %d items", index, list.items.Len()))
+		}
+		var v reflect.Value
+		v, err = list.itemValue(item)
+		if err != nil {
+			err = fmt.Errorf("cannot set list item %d: %v", index, err)
+			return
+		}
+		list.items.Index(index).Set(v)
+		C.listModelChanged(list.addr, C.int(index), C.int(index))
+	})
+	return err
+}
+
+// Destroy destroys the list. The list must not be used after this
+// method is called.
+func (list *List) Destroy() {
+	gui(func() {
+		if lists[list] {
+			delete(lists, list)
+			C.delObjectLater(list.addr)
+		}
+	})
+}
+
+// insert inserts items into the list at index.
+//
+// This must be run from the main GUI thread.
+func (list *List) insert(index int, items []interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+	values := make([]reflect.Value, len(items))
+	for i, item := range items {
+		v, err := list.itemValue(item)
+		if err != nil {
+			return fmt.Errorf("cannot insert list item %d: %v", index+i, err)
+		}
+		values[i] = v
+	}
+	n := list.items.Len()
+	C.listModelBeginInsert(list.addr, C.int(index), C.int(index+len(items)-1))
+	list.items = reflect.AppendSlice(list.items, reflect.MakeSlice(list.items.Type(), len(items), len(items)))
+	reflect.Copy(list.items.Slice(index+len(items), n+len(items)), list.items.Slice(index, n))
+	for i, v := range values {
+		list.items.Index(index + i).Set(v)
+	}
+	C.listModelEndInsert(list.addr)
+	return nil
+}
+
+// remove removes count items from the list starting at index.
+//
+// This must be run from the main GUI thread.
+func (list *List) remove(index, count int) {
+	if count == 0 {
+		return
+	}
+	n := list.items.Len()
+	C.listModelBeginRemove(list.addr, C.int(index), C.int(index+count-1))
+	reflect.Copy(list.items.Slice(index, n), list.items.Slice(index+count, n))
+	for i := n - count; i < n; i++ {
+		list.items.Index(i).Set(reflect.Zero(list.elemType))
+	}
+	list.items = list.items.Slice(0, n-count)
+	C.listModelEndRemove(list.addr)
+}
+
+// structType returns the struct type of the items.
+func (it *itemType) structType() reflect.Type {
+	if it.elemType.Kind() == reflect.Ptr {
+		return it.elemType.Elem()
+	}
+	return it.elemType
+}
+
+// itemValue returns item as a value of the item type, converting
+// maps and other structs into it.
+func (it *itemType) itemValue(item interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(item)
+	if v.IsValid() && v.Type() == it.elemType {
+		return v, nil
+	}
+	result := reflect.New(it.structType())
+	err := fmt.Errorf("cannot use %T as an item of a %s of %s", item, it.kind, it.elemType)
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		for _, key := range v.MapKeys() {
+			if err := it.setRole(result.Elem(), key.String(), v.MapIndex(key).Interface()); err != nil {
+				return reflect.Value{}, err
+			}
+		}
+	case v.IsValid() && isScanStruct(v.Type()):
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, err
+			}
+			v = v.Elem()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if name, ok := propertyName(v.Type(), v.Type().Field(i)); ok {
+				if err := it.setRole(result.Elem(), name, v.Field(i).Interface()); err != nil {
+					return reflect.Value{}, err
+				}
+			}
+		}
+	default:
+		return reflect.Value{}, err
+	}
+	if it.elemType.Kind() == reflect.Ptr {
+		return result, nil
+	}
+	return result.Elem(), nil
+}
+
+// roleValue returns the field of item holding the role at index, or
+// false if item is a nil pointer.
+func (it *itemType) roleValue(item reflect.Value, index int) (reflect.Value, bool) {
+	if item.Kind() == reflect.Ptr {
+		if item.IsNil() {
+			return reflect.Value{}, false
+		}
+		item = item.Elem()
+	}
+	return item.Field(it.fields[index]), true
+}
+
+// setRole sets the field of item holding the named role to value.
+func (it *itemType) setRole(item reflect.Value, role string, value interface{}) error {
+	for i, name := range it.roles {
+		if name != role {
+			continue
+		}
+		field := item.Field(it.fields[i])
+		v, err := coerce(value, field.Type())
+		if err != nil {
+			return fmt.Errorf("role %q: %v", role, err)
+		}
+		field.Set(v)
+		return nil
+	}
+	return fmt.Errorf("%s has no %q role", it.kind, role)
+}
+
+//export hookListModelCount
+func hookListModelCount(addr unsafe.Pointer) C.int {
+	if !onGuiThread("hookListModelCount") {
+		var count C.int
+		gui(func() { count = hookListModelCount(addr) })
+		return count
+	}
+	return C.int((*List)(addr).items.Len())
+}
+
+//export hookListModelData
+func hookListModelData(enginep, addr unsafe.Pointer, row, field C.int, result *C.DataValue) {
+	if !onGuiThread("hookListModelData") {
+		gui(func() { hookListModelData(enginep, addr, row, field, result) })
+		return
+	}
+	list := (*List)(addr)
+	engine := list.engine
+	if enginep != nilPtr {
+		engine = engines[enginep]
+	}
+	if int(row) >= list.items.Len() {
+		result.dataType = C.DTInvalid
+		return
+	}
+	value, ok := list.roleValue(list.items.Index(int(row)), int(field))
+	if !ok {
+		result.dataType = C.DTInvalid
+		return
+	}
+	packDataValue(value.Interface(), result, engine, jsOwner)
+}
+
+//export hookListModelDestroyed
+func hookListModelDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookListModelDestroyed") {
+		gui(func() { hookListModelDestroyed(addr) })
+		return
+	}
+	delete(lists, (*List)(addr))
+}
@@ -0,0 +1,217 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+)
+
+// ListOp is an operation applied to a List via UpdateFromChannel.
+// It is one of ListInsert, ListRemove, ListUpdate, or ListReset.
+type ListOp interface {
+	listOp()
+}
+
+// ListInsert inserts Value into the list at Index, moving the items
+// previously at Index and after it further down the list.
+type ListInsert struct {
+	Index int
+	Value interface{}
+}
+
+// ListRemove removes the item at Index from the list.
+type ListRemove struct {
+	Index int
+}
+
+// ListUpdate replaces the item at Index with Value.
+type ListUpdate struct {
+	Index int
+	Value interface{}
+}
+
+// ListReset replaces all the items in the list with Values.
+type ListReset struct {
+	Values []interface{}
+}
+
+func (ListInsert) listOp() {}
+func (ListRemove) listOp() {}
+func (ListUpdate) listOp() {}
+func (ListReset) listOp()  {}
+
+// listOpBatch is the maximum number of operations applied at once by
+// UpdateFromChannel.
+const listOpBatch = 1000
+
+// UpdateFromChannel applies the operations received from ch to the list,
+// in the order they are received, until ch is closed. This allows the
+// list to be fed by a goroutine producing a stream of changes without
+// further synchronization:
+//
+//     ops := make(chan qml.ListOp, 64)
+//     err := list.UpdateFromChannel(ops)
+//     ...
+//     ops <- qml.ListInsert{Index: 0, Value: item}
+//     ops <- qml.ListUpdate{Index: 3, Value: other}
+//     close(ops)
+//
+// Operations already queued in ch are applied together, so that views
+// observe a burst of changes at once, with runs of insertions and updates
+// at consecutive indexes and of removals at the same index notified to
+// the views as single changes. Operations that refer to indexes out of
+// range or hold values that cannot be converted to the list item type,
+// as done by the other List methods, are logged and skipped.
+//
+// UpdateFromChannel returns an error if the list is already consuming
+// operations from a channel that wasn't closed yet.
+func (list *List) UpdateFromChannel(ch <-chan ListOp) error {
+	var err error
+	gui(func() {
+		if list.updating != nil {
+			err = errors.New("cannot update list from channel: list is already being updated from another channel")
+			return
+		}
+		list.updating = make(chan bool)
+	})
+	if err != nil {
+		return err
+	}
+	go list.consume(ch)
+	return nil
+}
+
+// consume applies the operations received from ch to the list until ch is
+// closed, in batches of the operations queued by the time each is taken.
+func (list *List) consume(ch <-chan ListOp) {
+	for op := range ch {
+		ops := []ListOp{op}
+	queued:
+		for len(ops) < listOpBatch {
+			select {
+			case op, ok := <-ch:
+				if !ok {
+					break queued
+				}
+				ops = append(ops, op)
+			default:
+				break queued
+			}
+		}
+		gui(func() {
+			if lists[list] {
+				list.apply(ops)
+			}
+		})
+	}
+	gui(func() {
+		close(list.updating)
+		list.updating = nil
+	})
+}
+
+// apply applies ops to the list in order.
+//
+// This must be run from the main GUI thread.
+func (list *List) apply(ops []ListOp) {
+	for len(ops) > 0 {
+		n, err := list.applyRun(ops)
+		if err != nil {
+			log.Printf("qml: cannot apply list operation: %v", err)
+		}
+		ops = ops[n:]
+	}
+}
+
+// applyRun applies the first operation in ops together with the ones that
+// follow it and can be merged into the same change, and returns how many
+// operations were consumed.
+//
+// This must be run from the main GUI thread.
+func (list *List) applyRun(ops []ListOp) (int, error) {
+	switch op := ops[0].(type) {
+	case ListInsert:
+		if op.Index < 0 || op.Index > list.items.Len() {
+			return 1, fmt.Errorf("cannot insert into list at index %d: list has %d items", op.Index, list.items.Len())
+		}
+		items, n := list.runValues(ops, op.Index, func(op ListOp) (int, interface{}, bool) {
+			insert, ok := op.(ListInsert)
+			return insert.Index, insert.Value, ok
+		})
+		if n == 0 {
+			return 1, list.insert(op.Index, []interface{}{op.Value})
+		}
+		return n, list.insert(op.Index, items)
+	case ListUpdate:
+		if op.Index < 0 || op.Index >= list.items.Len() {
+			return 1, fmt.Errorf("cannot set list item at index %d: list has %d items", op.Index, list.items.Len())
+		}
+		if max := list.items.Len() - op.Index; len(ops) > max {
+			ops = ops[:max]
+		}
+		items, n := list.runValues(ops, op.Index, func(op ListOp) (int, interface{}, bool) {
+			update, ok := op.(ListUpdate)
+			return update.Index, update.Value, ok
+		})
+		if n == 0 {
+			_, err := list.itemValue(op.Value)
+			return 1, fmt.Errorf("cannot set list item %d: %v", op.Index, err)
+		}
+		for i := 0; i < n; i++ {
+			list.items.Index(op.Index + i).Set(reflect.ValueOf(items[i]))
+		}
+		C.listModelChanged(list.addr, C.int(op.Index), C.int(op.Index+n-1))
+		return n, nil
+	case ListRemove:
+		if op.Index < 0 || op.Index >= list.items.Len() {
+			return 1, fmt.Errorf("cannot remove item from list at index %d: list has %d items", op.Index, list.items.Len())
+		}
+		n := 1
+		for n < len(ops) && op.Index+n < list.items.Len() {
+			if next, ok := ops[n].(ListRemove); !ok || next.Index != op.Index {
+				break
+			}
+			n++
+		}
+		list.remove(op.Index, n)
+		return n, nil
+	case ListReset:
+		items := reflect.MakeSlice(list.items.Type(), len(op.Values), len(op.Values))
+		for i, value := range op.Values {
+			v, err := list.itemValue(value)
+			if err != nil {
+				return 1, fmt.Errorf("cannot reset list item %d: %v", i, err)
+			}
+			items.Index(i).Set(v)
+		}
+		C.listModelBeginReset(list.addr)
+		list.items = items
+		C.listModelEndReset(list.addr)
+		return 1, nil
+	}
+	return 1, fmt.Errorf("unknown list operation %T", ops[0])
+}
+
+// runValues returns the values of the leading operations in ops that
+// are matched by match at consecutive indexes starting at index, and
+// converted to the item type, together with how many of them there are.
+func (list *List) runValues(ops []ListOp, index int, match func(ListOp) (int, interface{}, bool)) ([]interface{}, int) {
+	var values []interface{}
+	for _, op := range ops {
+		opIndex, value, ok := match(op)
+		if !ok || opIndex != index+len(values) {
+			break
+		}
+		v, err := list.itemValue(value)
+		if err != nil {
+			break
+		}
+		values = append(values, v.Interface())
+	}
+	return values, len(values)
+}
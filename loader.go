@@ -0,0 +1,199 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Status is the loading status of a QML Loader element.
+type Status int
+
+// The values match the Loader.Status enum in QML.
+const (
+	StatusNull Status = iota
+	StatusReady
+	StatusLoading
+	StatusError
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusNull:
+		return "Null"
+	case StatusReady:
+		return "Ready"
+	case StatusLoading:
+		return "Loading"
+	case StatusError:
+		return "Error"
+	}
+	return "Status(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ComponentError describes a single error reported by QML while loading
+// a component.
+type ComponentError struct {
+	URL         string
+	Line        int
+	Column      int
+	Description string
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.URL, e.Line, e.Column, e.Description)
+}
+
+// ComponentErrors holds all the errors reported by QML while loading a
+// component, as reported by the Loader methods.
+type ComponentErrors []*ComponentError
+
+func (errs ComponentErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Loader drives a QML Loader element from Go, so that the content it
+// displays may be changed and the outcome observed. Loader methods may
+// be called from any goroutine.
+type Loader struct {
+	obj   *Object
+	queue callbackQueue
+}
+
+// NewLoader returns a Loader driving obj, which must be a QML Loader
+// element, or an error reporting the actual class of obj otherwise.
+func NewLoader(obj *Object) (*Loader, error) {
+	obj.assertLive()
+	cname := C.CString("QQuickLoader")
+	defer C.free(unsafe.Pointer(cname))
+	var class string
+	gui(func() {
+		if C.objectInherits(obj.addr, cname) == 0 {
+			class = C.GoString(C.objectClassName(obj.addr))
+		}
+	})
+	if class != "" {
+		return nil, fmt.Errorf("cannot use object of class %s as a Loader", class)
+	}
+	return &Loader{obj: obj}, nil
+}
+
+// Object returns the Loader element driven by l.
+func (l *Loader) Object() *Object {
+	return l.obj
+}
+
+// SetSource makes the loader display the component at url, which is
+// resolved relative to the document defining the loader. The properties
+// in props, which may be nil, are set on the new item before its
+// bindings are evaluated, as done by Loader.setSource in QML.
+//
+// If the component is loaded right away, as it happens with local files
+// unless the asynchronous property of the loader is set, SetSource
+// returns the errors that prevented the item from being created as a
+// ComponentErrors value. Otherwise the outcome is reported to the
+// functions registered via OnStatusChanged.
+func (l *Loader) SetSource(url string, props map[string]interface{}) error {
+	l.obj.assertLive()
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	curl, curllen := unsafeStringData(url)
+	var err error
+	gui(func() {
+		var dprops C.DataValue
+		packDataValue(props, &dprops, l.obj.engine, cppOwner)
+		cerr := C.loaderSetSource(l.obj.addr, curl, curllen, &dprops)
+		if cerr != nilCharPtr {
+			err = fmt.Errorf("cannot set loader source to %q: %s", url, C.GoString(cerr))
+			C.free(unsafe.Pointer(cerr))
+			return
+		}
+		if l.status() == StatusError {
+			err = l.errors()
+		}
+	})
+	return err
+}
+
+// Status returns the current loading status of the loader.
+func (l *Loader) Status() Status {
+	var status Status
+	gui(func() {
+		status = l.status()
+	})
+	return status
+}
+
+// Item returns the item created by the loader, or nil if there is none.
+func (l *Loader) Item() *Object {
+	item, _ := l.obj.Property("item").(*Object)
+	return item
+}
+
+// OnStatusChanged arranges for f to be called whenever the loading
+// status of the loader changes. When the status is StatusError, err
+// holds the errors reported while loading the component as a
+// ComponentErrors value.
+//
+// Functions are called in registration order, one at a time, as
+// documented in the Callbacks section of the package documentation.
+func (l *Loader) OnStatusChanged(f func(status Status, err error)) {
+	l.obj.ConnectInline("statusChanged", func() {
+		status := l.status()
+		var err error
+		if status == StatusError {
+			err = l.errors()
+		}
+		l.queue.dispatch(func() { f(status, err) })
+	})
+}
+
+// status returns the current loading status of the loader.
+//
+// This must be run from the main GUI thread.
+func (l *Loader) status() Status {
+	return Status(l.obj.Int("status"))
+}
+
+// errors returns the errors reported while loading the loader component.
+//
+// This must be run from the main GUI thread.
+func (l *Loader) errors() error {
+	creport := C.loaderErrors(l.obj.addr)
+	errs := parseComponentErrors(C.GoString(creport))
+	C.free(unsafe.Pointer(creport))
+	if len(errs) == 0 {
+		// The component loaded, but its item could not be created.
+		errs = ComponentErrors{{URL: l.obj.String("source"), Description: "cannot create loader item"}}
+	}
+	return errs
+}
+
+// parseComponentErrors returns the errors in report, as formatted by
+// formatErrors on the C++ side.
+func parseComponentErrors(report string) ComponentErrors {
+	var errs ComponentErrors
+	for _, line := range strings.Split(report, "\n") {
+		// Each line holds the line, column, URL, and description.
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		n, _ := strconv.Atoi(fields[0])
+		col, _ := strconv.Atoi(fields[1])
+		errs = append(errs, &ComponentError{URL: fields[2], Line: n, Column: col, Description: fields[3]})
+	}
+	return errs
+}
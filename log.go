@@ -8,32 +8,45 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"sync"
 )
 
 // SetLogger sets the target for messages logged by the qml package,
-// including console.log and related calls from within qml code.
+// including console.log and related calls from within qml code, and
+// the warnings reported by Qt and by QML engines, such as binding loops
+// and errors thrown by JavaScript code.
 //
 // The logger value must implement either the StdLogger interface,
 // which is satisfied by the standard *log.Logger type, or the QmlLogger
-// interface, which offers more control over the logged message.
+// interface, which offers more control over the logged message, or be
+// a function with the signature func(LogMessage). Messages provided to
+// such functions may be retained after the function returns.
+//
+// Messages are delivered from whatever thread logged them, which may not
+// be the main GUI thread, and the logger must not block waiting for that
+// thread, as it may be the one logging. SetLogger may be called at any
+// time, including before Init.
 //
 // If no logger is provided, the qml package will send messages to the
 // default log package logger. This behavior may also be restored by
 // providing a nil logger to this function.
 func SetLogger(logger interface{}) {
-	if logger == nil {
-		logHandler = defaultLogger{}
-		return
-	}
-	if qmll, ok := logger.(QmlLogger); ok {
-		logHandler = qmll
-		return
+	var handler QmlLogger
+	switch logger := logger.(type) {
+	case nil:
+		handler = defaultLogger{}
+	case QmlLogger:
+		handler = logger
+	case StdLogger:
+		handler = wrappedStdLogger{logger}
+	case func(LogMessage):
+		handler = funcLogger(logger)
+	default:
+		panic("unsupported logger interface")
 	}
-	if stdl, ok := logger.(StdLogger); ok {
-		logHandler = wrappedStdLogger{stdl}
-		return
-	}
-	panic("unsupported logger interface")
+	logMutex.Lock()
+	logHandler = handler
+	logMutex.Unlock()
 }
 
 // The QmlLogger interface may be implemented to better control how
@@ -79,7 +92,10 @@ const (
 	LogFatal
 )
 
-var logHandler QmlLogger = defaultLogger{}
+var (
+	logMutex   sync.RWMutex
+	logHandler QmlLogger = defaultLogger{}
+)
 
 type defaultLogger struct{}
 
@@ -95,8 +111,11 @@ func init() {
 
 //export hookLogHandler
 func hookLogHandler(cmsg *C.LogMessage) {
+	logMutex.RLock()
+	handler := logHandler
+	logMutex.RUnlock()
 	msg := logMessage{c: cmsg}
-	logHandler.QmlOutput(&msg)
+	handler.QmlOutput(&msg)
 	msg.invalid = true
 }
 
@@ -108,6 +127,14 @@ func (l wrappedStdLogger) QmlOutput(msg LogMessage) error {
 	return l.Output(0, msg.String())
 }
 
+type funcLogger func(LogMessage)
+
+func (f funcLogger) QmlOutput(msg LogMessage) error {
+	// Copied, as the function may hold on to the message.
+	f(&goLogMessage{msg.Severity(), msg.Text(), msg.File(), msg.Line()})
+	return nil
+}
+
 type logMessage struct {
 	c *C.LogMessage
 
@@ -145,7 +172,27 @@ func (m *logMessage) File() string {
 
 func (m *logMessage) Text() string {
 	m.assertValid()
-	return C.GoStringN(m.c.text, m.c.line)
+	return C.GoStringN(m.c.text, m.c.textLen)
 }
 
 func (*logMessage) privateMarker() {}
+
+// goLogMessage is a LogMessage logged by the qml package itself,
+// rather than by Qt or by QML code.
+type goLogMessage struct {
+	severity LogSeverity
+	text     string
+	file     string
+	line     int
+}
+
+func (m *goLogMessage) Severity() LogSeverity { return m.severity }
+func (m *goLogMessage) Text() string          { return m.text }
+func (m *goLogMessage) File() string          { return m.file }
+func (m *goLogMessage) Line() int             { return m.line }
+
+func (m *goLogMessage) String() string {
+	return fmt.Sprintf("%s:%d: %s", filepath.Base(m.file), m.line, m.text)
+}
+
+func (*goLogMessage) privateMarker() {}
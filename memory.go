@@ -0,0 +1,97 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"github.com/niemeyer/qml/tref"
+)
+
+// MemoryStats holds memory statistics of an engine, as reported by
+// Engine.MemoryStats.
+type MemoryStats struct {
+	// JSHeapUsed is the number of bytes used by JavaScript values in the
+	// heap of the engine, and JSHeapAllocated is the number of bytes the
+	// heap holds, used or not. JSLargeItems is the number of bytes held
+	// by large values, such as long strings and arrays, allocated outside
+	// the heap. These are zero with Qt versions before 5.14, which offer
+	// no way to obtain them.
+	JSHeapUsed      int64
+	JSHeapAllocated int64
+	JSLargeItems    int64
+
+	// GoValues is the number of Go values currently made available to
+	// QML code running under the engine, including the ones wrapped more
+	// than once, such as values held by several spawned contexts.
+	GoValues int
+}
+
+// MemoryStats returns the memory statistics of the engine, so that the
+// growth of the JavaScript heap and of the Go values held by the engine
+// may be correlated with the activity of long-running applications:
+//
+//     stats := engine.MemoryStats()
+//     log.Printf("js heap: %d bytes, go values: %d", stats.JSHeapUsed, stats.GoValues)
+//
+func (e *Engine) MemoryStats() MemoryStats {
+	e.assertValid()
+	var stats MemoryStats
+	gui(func() {
+		var used, allocated, largeItems C.longlong
+		if C.engineMemoryStats(e.addr, &used, &allocated, &largeItems) != 0 {
+			stats.JSHeapUsed = int64(used)
+			stats.JSHeapAllocated = int64(allocated)
+			stats.JSLargeItems = int64(largeItems)
+		}
+		for _, fold := range e.values {
+			for ; fold != nil; fold = fold.next {
+				stats.GoValues++
+			}
+		}
+	})
+	return stats
+}
+
+// CollectGarbage runs the garbage collector of the JavaScript heap of the
+// engine, so that applications may release memory at idle moments rather
+// than waiting for the engine to do so, or periodically as arranged by
+// SetCollectInterval. Go values referenced only by JavaScript values that
+// were collected are released as well. See SetCollectInterval.
+//
+// When called from the main GUI thread, such as from a method of a Go
+// value called by QML code, the collection is deferred until control
+// returns to the GUI event loop, so that components being instantiated
+// are not affected.
+func (e *Engine) CollectGarbage() {
+	e.assertValid()
+	deferred := guiDeferred()
+	gui(func() {
+		C.engineCollectGarbage(e.addr, deferred)
+	})
+}
+
+// TrimComponentCache discards the components compiled by the engine that
+// are not in use by any object, and the type data of documents no longer
+// referenced, unlike ClearComponentCache which discards all of them. It's
+// meant for releasing the memory held by parts of the interface that were
+// loaded once and are not going to be used again.
+//
+// When called from the main GUI thread, the trimming is deferred as done
+// by CollectGarbage.
+func (e *Engine) TrimComponentCache() {
+	e.assertValid()
+	deferred := guiDeferred()
+	gui(func() {
+		C.engineTrimComponentCache(e.addr, deferred)
+	})
+}
+
+// guiDeferred returns 1 if the caller runs in the main GUI thread, where
+// it may be interrupting components being instantiated, and 0 otherwise.
+func guiDeferred() C.int {
+	if tref.Ref() == guiLoopRef {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"unsafe"
+)
+
+// Menu is a popup menu, such as a context menu, with actions handled by
+// Go functions. Menus may be shown any number of times, and may be
+// changed between popups.
+type Menu struct {
+	addr     unsafe.Pointer
+	actions  []*menuAction
+	submenus []*Menu
+}
+
+type menuAction struct {
+	f      func()
+	checkf func(checked bool)
+	queue  callbackQueue
+}
+
+// menus holds the menus alive until they are destroyed, since their
+// C++ counterparts hold unsafe references to their actions.
+var menus = make(map[*Menu]bool)
+
+// NewMenu returns a new empty menu. The Destroy method must be called
+// once the menu is not necessary anymore.
+func NewMenu() *Menu {
+	menu := &Menu{}
+	gui(func() {
+		menu.addr = C.newMenu()
+		menus[menu] = true
+	})
+	return menu
+}
+
+// AddAction adds to the menu an action with the provided text and
+// optional icon file path. When the user chooses an enabled action,
+// f is called in a goroutine owned by the package. See the Callbacks
+// section of the package documentation.
+func (menu *Menu) AddAction(text, icon string, enabled bool, f func()) {
+	action := &menuAction{f: f}
+	ctext, ctextlen := unsafeStringData(text)
+	cicon, ciconlen := unsafeStringData(icon)
+	cenabled := C.int(0)
+	if enabled {
+		cenabled = 1
+	}
+	gui(func() {
+		menu.actions = append(menu.actions, action)
+		C.menuAddAction(menu.addr, unsafe.Pointer(action), ctext, ctextlen, cicon, ciconlen, cenabled)
+	})
+}
+
+// AddCheckAction adds to the menu an action with the provided text that
+// may be checked and unchecked by the user, and is initially checked if
+// checked is true. When the user chooses an enabled action, its checked
+// state is toggled and f is called with the new state in a goroutine
+// owned by the package. See the Callbacks section of the package
+// documentation.
+func (menu *Menu) AddCheckAction(text string, enabled, checked bool, f func(checked bool)) {
+	action := &menuAction{checkf: f}
+	ctext, ctextlen := unsafeStringData(text)
+	cenabled, cchecked := C.int(0), C.int(0)
+	if enabled {
+		cenabled = 1
+	}
+	if checked {
+		cchecked = 1
+	}
+	gui(func() {
+		menu.actions = append(menu.actions, action)
+		C.menuAddCheckAction(menu.addr, unsafe.Pointer(action), ctext, ctextlen, cenabled, cchecked)
+	})
+}
+
+// AddSeparator adds a separator line to the menu.
+func (menu *Menu) AddSeparator() {
+	gui(func() {
+		C.menuAddSeparator(menu.addr)
+	})
+}
+
+// AddSubmenu adds to the menu a submenu with the provided text, and
+// returns it so that its own actions may be added.
+func (menu *Menu) AddSubmenu(text string) *Menu {
+	submenu := &Menu{}
+	ctext, ctextlen := unsafeStringData(text)
+	gui(func() {
+		submenu.addr = C.menuAddSubmenu(menu.addr, ctext, ctextlen)
+		menu.submenus = append(menu.submenus, submenu)
+	})
+	return submenu
+}
+
+// Clear removes all the actions, separators, and submenus from the menu.
+// Submenus previously returned by AddSubmenu must not be used anymore.
+func (menu *Menu) Clear() {
+	gui(func() {
+		C.menuClear(menu.addr)
+		menu.actions = nil
+		menu.submenus = nil
+	})
+}
+
+// Popup shows the menu at the position x, y in the coordinates of win,
+// and returns immediately. The menu is dismissed once the user chooses
+// an action, or cancels the menu, or when Close is called.
+func (menu *Menu) Popup(win *Window, x, y int) {
+	gui(func() {
+		C.menuPopup(menu.addr, win.obj.addr, C.int(x), C.int(y))
+	})
+}
+
+// Close dismisses the menu if it is being shown.
+func (menu *Menu) Close() {
+	gui(func() {
+		C.menuClose(menu.addr)
+	})
+}
+
+// Destroy destroys the menu and its submenus. The menu must not be used
+// after this method is called. Submenus are destroyed with the menu they
+// were added to, so calling Destroy on them has no effect.
+func (menu *Menu) Destroy() {
+	gui(func() {
+		if menus[menu] {
+			delete(menus, menu)
+			C.delObjectLater(menu.addr)
+		}
+	})
+}
+
+//export hookMenuActionTriggered
+func hookMenuActionTriggered(addr unsafe.Pointer, checked C.int) {
+	action := (*menuAction)(addr)
+	if action.checkf != nil {
+		action.queue.dispatch(func() { action.checkf(checked != 0) })
+		return
+	}
+	action.queue.dispatch(action.f)
+}
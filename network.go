@@ -0,0 +1,198 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// ProxyKind identifies the kind of a network proxy.
+type ProxyKind int
+
+// The values match the respective QNetworkProxy::ProxyType values.
+const (
+	DefaultProxy ProxyKind = 0 // The proxy set for the application, if any.
+	SOCKS5Proxy  ProxyKind = 1
+	NoProxy      ProxyKind = 2
+	HTTPProxy    ProxyKind = 3
+)
+
+// The network state is accessed from the threads where Qt makes requests,
+// so it's guarded by networkMutex rather than confined to the GUI thread.
+var (
+	networkMutex sync.Mutex
+
+	// networkTransports holds the transports set for each engine.
+	networkTransports = make(map[unsafe.Pointer]http.RoundTripper)
+
+	// networkReplies holds the function that cancels the request of each
+	// reply being handled by a transport.
+	networkReplies = make(map[unsafe.Pointer]context.CancelFunc)
+)
+
+// SetNetworkProxy sets the proxy used for the http and https requests made
+// by QML content running under the engine, such as by Image elements and
+// XMLHttpRequest, when no transport is set via SetNetworkTransport. The
+// DefaultProxy kind restores the proxy set for the application, and the
+// NoProxy kind makes requests go directly to their destination.
+func (e *Engine) SetNetworkProxy(host string, port int, kind ProxyKind) {
+	e.assertValid()
+	chost, chostlen := unsafeStringData(host)
+	gui(func() {
+		C.engineSetNetworkProxy(e.addr, C.int(kind), chost, chostlen, C.int(port))
+	})
+}
+
+// SetUserAgent sets the User-Agent header of the http and https requests
+// made by QML content running under the engine, including the ones made
+// via a transport set with SetNetworkTransport. An empty agent restores
+// the default one.
+func (e *Engine) SetUserAgent(agent string) {
+	e.assertValid()
+	cagent, cagentlen := unsafeStringData(agent)
+	gui(func() {
+		C.engineSetUserAgent(e.addr, cagent, cagentlen)
+	})
+}
+
+// SetNetworkTransport routes the http and https requests made by QML
+// content running under the engine through rt, so that authentication,
+// cookies, proxies, and TLS settings configured for Go HTTP clients apply
+// to them as well:
+//
+//     engine.SetNetworkTransport(client.Transport)
+//
+// Requests for local files and for resources, such as "file:" and "qrc:"
+// locations, are still handled by Qt. The request body, if any, is read
+// in full before rt is called, and so is the response body before it's
+// delivered to QML. Requests aborted by QML have their context canceled.
+// A nil rt restores Qt's own network stack.
+//
+// The rt transport is called from goroutines owned by the package, so it
+// must be safe for concurrent use.
+func (e *Engine) SetNetworkTransport(rt http.RoundTripper) {
+	e.assertValid()
+	networkMutex.Lock()
+	if rt != nil {
+		networkTransports[e.addr] = rt
+	} else {
+		delete(networkTransports, e.addr)
+	}
+	networkMutex.Unlock()
+	var enabled C.int
+	if rt != nil {
+		enabled = 1
+	}
+	gui(func() {
+		C.engineSetNetworkTransport(e.addr, enabled)
+	})
+}
+
+// forgetNetworkTransport drops the transport set for the engine at addr.
+func forgetNetworkTransport(addr unsafe.Pointer) {
+	networkMutex.Lock()
+	delete(networkTransports, addr)
+	networkMutex.Unlock()
+}
+
+//export hookNetworkRequest
+func hookNetworkRequest(engine, reply unsafe.Pointer, cmethod *C.char, cmethodLen C.int, curl *C.char, curlLen C.int, cheaders *C.char, cheadersLen C.int, cbody *C.char, cbodyLen C.int) {
+	// Not moved into the GUI thread, as requests are made from other
+	// threads as well, such as the one loading images.
+	method := C.GoStringN(cmethod, cmethodLen)
+	url := C.GoStringN(curl, curlLen)
+	headers := C.GoStringN(cheaders, cheadersLen)
+	body := C.GoBytes(unsafe.Pointer(cbody), cbodyLen)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	networkMutex.Lock()
+	rt := networkTransports[engine]
+	networkReplies[reply] = cancel
+	networkMutex.Unlock()
+
+	go func() {
+		resp, err := networkRoundTrip(ctx, rt, method, url, headers, body)
+		networkMutex.Lock()
+		defer networkMutex.Unlock()
+		if _, ok := networkReplies[reply]; !ok {
+			// The reply was destroyed meanwhile.
+			return
+		}
+		delete(networkReplies, reply)
+		cancel()
+		if err != nil {
+			cerr, cerrlen := unsafeStringData(err.Error())
+			C.networkReplyFinish(reply, 0, nil, 0, nil, 0, nil, 0, cerr, cerrlen)
+			return
+		}
+		var lines []string
+		for name, values := range resp.header {
+			lines = append(lines, name+": "+strings.Join(values, ", "))
+		}
+		creason, creasonlen := unsafeStringData(resp.reason)
+		cheaders, cheaderslen := unsafeStringData(strings.Join(lines, "\n"))
+		cbody, cbodylen := unsafeBytesData(resp.body)
+		C.networkReplyFinish(reply, C.int(resp.status), creason, creasonlen, cheaders, cheaderslen, cbody, cbodylen, nil, 0)
+	}()
+}
+
+type networkResponse struct {
+	status int
+	reason string
+	header http.Header
+	body   []byte
+}
+
+// networkRoundTrip makes the request described via rt.
+func networkRoundTrip(ctx context.Context, rt http.RoundTripper, method, url, headers string, body []byte) (*networkResponse, error) {
+	if rt == nil {
+		return nil, errNoTransport
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for _, line := range strings.Split(headers, "\n") {
+		if i := strings.Index(line, ": "); i > 0 {
+			req.Header.Add(line[:i], line[i+2:])
+		}
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// The status holds the code followed by the reason phrase.
+	reason := http.StatusText(resp.StatusCode)
+	if i := strings.Index(resp.Status, " "); i >= 0 {
+		reason = resp.Status[i+1:]
+	}
+	return &networkResponse{resp.StatusCode, reason, resp.Header, data}, nil
+}
+
+var errNoTransport = errors.New("network transport was removed")
+
+//export hookNetworkReplyDestroyed
+func hookNetworkReplyDestroyed(reply unsafe.Pointer) {
+	networkMutex.Lock()
+	cancel, ok := networkReplies[reply]
+	delete(networkReplies, reply)
+	networkMutex.Unlock()
+	if ok {
+		cancel()
+	}
+}
@@ -0,0 +1,163 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"unsafe"
+)
+
+// Painter paints the contents of an item of a type registered with
+// RegisterPaintedType. A Painter is only valid during the Paint call
+// it is provided to.
+//
+// Shapes are outlined with the pen and filled with the brush, and
+// coordinates are in the item's local coordinate system, with the origin
+// at its top left corner.
+type Painter struct {
+	addr          unsafe.Pointer
+	width, height float64
+}
+
+// paintedValue is implemented by the values of types registered with
+// RegisterPaintedType.
+type paintedValue interface {
+	Paint(p *Painter)
+}
+
+var painterType = reflect.TypeOf((*Painter)(nil))
+
+// Size returns the size of the item being painted.
+func (p *Painter) Size() (width, height float64) {
+	return p.width, p.height
+}
+
+// SetPen sets the color and width of the lines drawn, and of the outline
+// of the shapes drawn. A transparent color disables outlining.
+func (p *Painter) SetPen(c color.Color, width float64) {
+	r, g, b, a := colorComponents(c)
+	C.painterSetPen(p.ptr(), r, g, b, a, C.double(width))
+}
+
+// SetBrush sets the color the shapes drawn are filled with. A transparent
+// color disables filling.
+func (p *Painter) SetBrush(c color.Color) {
+	r, g, b, a := colorComponents(c)
+	C.painterSetBrush(p.ptr(), r, g, b, a)
+}
+
+// SetFont sets the font family and the size in pixels of the text drawn.
+func (p *Painter) SetFont(family string, pixelSize int) {
+	cfamily, cfamilyLen := unsafeStringData(family)
+	C.painterSetFont(p.ptr(), cfamily, cfamilyLen, C.int(pixelSize))
+}
+
+// DrawLine draws a line from (x1, y1) to (x2, y2) with the pen.
+func (p *Painter) DrawLine(x1, y1, x2, y2 float64) {
+	C.painterDrawLine(p.ptr(), C.double(x1), C.double(y1), C.double(x2), C.double(y2))
+}
+
+// DrawRect draws a rectangle with the top left corner at (x, y).
+func (p *Painter) DrawRect(x, y, width, height float64) {
+	C.painterDrawRect(p.ptr(), C.double(x), C.double(y), C.double(width), C.double(height))
+}
+
+// DrawEllipse draws the ellipse that fits the rectangle with the top
+// left corner at (x, y).
+func (p *Painter) DrawEllipse(x, y, width, height float64) {
+	C.painterDrawEllipse(p.ptr(), C.double(x), C.double(y), C.double(width), C.double(height))
+}
+
+// FillRect fills the rectangle with the top left corner at (x, y) with
+// color c, regardless of the pen and brush.
+func (p *Painter) FillRect(x, y, width, height float64, c color.Color) {
+	r, g, b, a := colorComponents(c)
+	C.painterFillRect(p.ptr(), C.double(x), C.double(y), C.double(width), C.double(height), r, g, b, a)
+}
+
+// DrawText draws text with the pen and the font, with the left end of
+// the text baseline at (x, y).
+func (p *Painter) DrawText(x, y float64, text string) {
+	ctext, ctextLen := unsafeStringData(text)
+	C.painterDrawText(p.ptr(), C.double(x), C.double(y), ctext, ctextLen)
+}
+
+// DrawImage draws img with its top left corner at (x, y). Images of
+// types *image.RGBA and *image.NRGBA are converted more efficiently
+// than other types.
+func (p *Painter) DrawImage(x, y float64, img image.Image) {
+	bounds := img.Bounds()
+	premultiplied := C.int(1)
+	if _, ok := img.(*image.NRGBA); ok {
+		premultiplied = 0
+	}
+	var bits *C.uchar
+	var stride C.int
+	qimage := C.newImage(C.int(bounds.Dx()), C.int(bounds.Dy()), premultiplied, &bits, &stride)
+	defer C.delImage(qimage)
+	fillImage(img, unsafe.Pointer(bits), int(stride))
+	C.painterDrawImage(p.ptr(), C.double(x), C.double(y), qimage)
+}
+
+// ptr returns the address of the QPainter, panicking if the painter
+// is used outside of the Paint call it was provided to.
+func (p *Painter) ptr() unsafe.Pointer {
+	if p.addr == nilPtr {
+		panic("painter used outside of the Paint method it was provided to")
+	}
+	return p.addr
+}
+
+// colorComponents returns the non-premultiplied components of c.
+func colorComponents(c color.Color) (r, g, b, a C.int) {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return C.int(nc.R), C.int(nc.G), C.int(nc.B), C.int(nc.A)
+}
+
+// Update schedules the repainting of the items wrapping value, which
+// must be a value created by a type registered with RegisterPaintedType
+// or RegisterGLType. Update may be called from any goroutine.
+func Update(value interface{}) {
+	gui(func() {
+		for _, engine := range engines {
+			for fold := engine.values[value]; fold != nil; fold = fold.next {
+				C.goValueUpdate(fold.cvalue)
+			}
+		}
+		for _, fold := range typeNewByValue[value] {
+			C.goValueUpdate(fold.cvalue)
+		}
+	})
+}
+
+//export hookGoValuePaint
+func hookGoValuePaint(foldp, painterp unsafe.Pointer, width, height C.double) {
+	// Not moved into the GUI thread, as items are painted from the
+	// render thread while the GUI thread is blocked.
+	fold := (*valueFold)(foldp)
+	value, ok := fold.gvalue.(paintedValue)
+	if !ok {
+		return
+	}
+	p := &Painter{addr: painterp, width: float64(width), height: float64(height)}
+	defer func() { p.addr = nilPtr }()
+	value.Paint(p)
+}
+
+//export hookGoValueResized
+func hookGoValueResized(foldp unsafe.Pointer, width, height C.double) {
+	if !onGuiThread("hookGoValueResized") {
+		gui(func() { hookGoValueResized(foldp, width, height) })
+		return
+	}
+	fold := (*valueFold)(foldp)
+	if value, ok := fold.gvalue.(interface {
+		Resized(width, height float64)
+	}); ok {
+		value.Resized(float64(width), float64(height))
+	}
+}
@@ -0,0 +1,120 @@
+package qml
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// platformName returns the name of the Qt platform plugin selected via
+// options, the QT_QPA_PLATFORM environment variable, or the -platform
+// command line argument, in that order, or empty for the default one.
+func platformName(options *InitOptions) string {
+	if options != nil && options.Platform != "" {
+		return options.Platform
+	}
+	for i, arg := range os.Args {
+		if (arg == "-platform" || arg == "--platform") && i+1 < len(os.Args) {
+			return os.Args[i+1]
+		}
+	}
+	return os.Getenv("QT_QPA_PLATFORM")
+}
+
+// headlessPlatform returns whether the named platform plugin renders
+// windows without a display.
+func headlessPlatform(name string) bool {
+	// Plugin options follow a colon, as in "offscreen:enable_glx".
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	return name == "offscreen" || name == "minimal"
+}
+
+// checkPlatform returns an error if the Qt platform plugin selected via
+// options requires a display that is not available, since Qt aborts the
+// whole process in that case.
+func checkPlatform(options *InitOptions) error {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return nil
+	}
+	name := platformName(options)
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	switch name {
+	case "", "xcb":
+		display := os.Getenv("DISPLAY")
+		if display == "" {
+			if name == "" && os.Getenv("WAYLAND_DISPLAY") != "" {
+				return nil
+			}
+			return fmt.Errorf("cannot initialize qml package: no X display available (DISPLAY is unset); use InitOptions.Platform %q to run without a display", "offscreen")
+		}
+		if err := dialX(display); err != nil {
+			return fmt.Errorf("cannot initialize qml package: cannot connect to X display %q: %v", display, err)
+		}
+	case "wayland", "wayland-egl":
+		display := os.Getenv("WAYLAND_DISPLAY")
+		if display == "" {
+			display = "wayland-0"
+		}
+		if !filepath.IsAbs(display) {
+			dir := os.Getenv("XDG_RUNTIME_DIR")
+			if dir == "" {
+				return fmt.Errorf("cannot initialize qml package: no Wayland display available (XDG_RUNTIME_DIR is unset); use InitOptions.Platform %q to run without a display", "offscreen")
+			}
+			display = filepath.Join(dir, display)
+		}
+		conn, err := net.DialTimeout("unix", display, 2*time.Second)
+		if err != nil {
+			return fmt.Errorf("cannot initialize qml package: cannot connect to Wayland display: %v", err)
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+// dialX checks that the X server of display accepts connections.
+// Displays not understood are assumed to be available, leaving the
+// final word to Qt.
+func dialX(display string) error {
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return nil
+	}
+	host, number := display[:i], display[i+1:]
+	if j := strings.Index(number, "."); j >= 0 {
+		number = number[:j]
+	}
+	var n int
+	if _, err := fmt.Sscanf(number, "%d", &n); err != nil {
+		return nil
+	}
+	var network, addr string
+	switch {
+	case strings.HasPrefix(host, "/"):
+		// Socket paths as used by XQuartz, such as /tmp/launch-x/org.x:0.
+		network, addr = "unix", display
+	case host == "" || host == "unix":
+		network, addr = "unix", fmt.Sprintf("/tmp/.X11-unix/X%d", n)
+	default:
+		network, addr = "tcp", net.JoinHostPort(host, fmt.Sprint(6000+n))
+	}
+	conn, err := net.DialTimeout(network, addr, 2*time.Second)
+	if err != nil {
+		if network == "unix" && runtime.GOOS == "linux" {
+			// Linux servers also listen on the abstract socket namespace.
+			conn, err = net.DialTimeout(network, "@"+addr, 2*time.Second)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	conn.Close()
+	return nil
+}
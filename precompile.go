@@ -0,0 +1,228 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"sync"
+	"time"
+
+	"github.com/niemeyer/qml/tref"
+)
+
+const (
+	// precompileIdle is how long the GUI loop must go without user input
+	// before PrecompileIdle compiles the next document.
+	precompileIdle = 300 * time.Millisecond
+
+	// precompilePoll is how often PrecompileIdle checks for idleness.
+	precompilePoll = 50 * time.Millisecond
+)
+
+// PrecompileJob represents the documents being compiled in the background
+// via Engine.PrecompileIdle. PrecompileJob methods may be called from any
+// goroutine.
+type PrecompileJob struct {
+	engine  *Engine
+	entries []*precompileEntry
+	done    chan struct{}
+
+	// Guarded by precompileMutex.
+	current  string
+	errors   map[string]error
+	canceled bool
+}
+
+// precompileEntry holds the state of a single document of a job.
+type precompileEntry struct {
+	location string
+	url      string
+
+	// Guarded by precompileMutex. The load is set once the document
+	// starts compiling, and claimed is set once the document is handed
+	// over to Load, LoadFile, or LoadAsync.
+	load    *ComponentLoad
+	claimed bool
+}
+
+// precompileMutex guards the state of all precompile jobs, and the
+// precompiled map of all engines.
+var precompileMutex sync.Mutex
+
+// PrecompileIdle compiles the QML documents at the provided locations in
+// the background, one at a time and only while the GUI loop is idle, so
+// that the screens of an application other than the first one may be
+// prepared without competing with user interaction. Whenever the user
+// interacts with the application, the next document waits until the
+// interaction stops. Locations are understood as done by LoadAsync.
+//
+// Loading a document of the job via LoadFile or LoadAsync hands over the
+// component compiled by the job, waiting for its compilation if it's in
+// progress rather than compiling it again. Documents not yet started are
+// loaded as usual and skipped by the job. Each compiled component is
+// handed over once, so later loads of the same location compile it
+// again, in most cases reusing the types already compiled by the engine.
+func (e *Engine) PrecompileIdle(locations []string) *PrecompileJob {
+	e.assertValid()
+	job := &PrecompileJob{
+		engine: e,
+		done:   make(chan struct{}),
+		errors: make(map[string]error),
+	}
+	precompileMutex.Lock()
+	if e.precompiled == nil {
+		e.precompiled = make(map[string]*precompileEntry)
+	}
+	for _, location := range locations {
+		entry := &precompileEntry{location: location, url: location}
+		if url, err := locationURL(location); err == nil {
+			entry.url = url
+		}
+		if e.precompiled[entry.url] != nil {
+			// Compiled or being compiled already.
+			continue
+		}
+		e.precompiled[entry.url] = entry
+		job.entries = append(job.entries, entry)
+	}
+	precompileMutex.Unlock()
+	go job.run()
+	return job
+}
+
+// run compiles the documents of the job one at a time.
+func (job *PrecompileJob) run() {
+	defer close(job.done)
+	for _, entry := range job.entries {
+		if !job.waitIdle() {
+			return
+		}
+		precompileMutex.Lock()
+		if entry.claimed || job.canceled {
+			precompileMutex.Unlock()
+			continue
+		}
+		job.current = entry.location
+		precompileMutex.Unlock()
+
+		// The load is started without holding the mutex, so the entry
+		// may be claimed meanwhile, in which case it's loaded again by
+		// whoever claimed it and this load is dropped.
+		load := job.engine.loadAsync(entry.location, nil)
+
+		precompileMutex.Lock()
+		claimed := entry.claimed
+		if !claimed {
+			entry.load = load
+		}
+		precompileMutex.Unlock()
+
+		<-load.Done()
+		if claimed && load.err == nil {
+			load.comp.Destroy()
+		}
+
+		precompileMutex.Lock()
+		job.current = ""
+		if load.err != nil {
+			job.errors[entry.location] = load.err
+		}
+		precompileMutex.Unlock()
+	}
+}
+
+// waitIdle blocks until the GUI loop is idle, and returns whether the job
+// should go on.
+func (job *PrecompileJob) waitIdle() bool {
+	for {
+		precompileMutex.Lock()
+		canceled := job.canceled
+		precompileMutex.Unlock()
+		if canceled || job.engine.isDestroyed() {
+			return false
+		}
+		var idle bool
+		gui(func() {
+			idle = C.applicationHasPendingEvents() == 0 && time.Duration(C.applicationInputIdle())*time.Millisecond >= precompileIdle
+		})
+		if idle {
+			return true
+		}
+		time.Sleep(precompilePoll)
+	}
+}
+
+// Progress returns the number of documents of the job already compiled or
+// handed over to Load, the total number of documents, and the location of
+// the document being compiled, if any.
+func (job *PrecompileJob) Progress() (done, total int, current string) {
+	precompileMutex.Lock()
+	defer precompileMutex.Unlock()
+	for _, entry := range job.entries {
+		if entry.claimed || entry.load != nil && entry.location != job.current {
+			done++
+		}
+	}
+	return done, len(job.entries), job.current
+}
+
+// Errors returns the errors reported while compiling the documents of the
+// job so far, by location.
+func (job *PrecompileJob) Errors() map[string]error {
+	precompileMutex.Lock()
+	defer precompileMutex.Unlock()
+	errors := make(map[string]error, len(job.errors))
+	for location, err := range job.errors {
+		errors[location] = err
+	}
+	return errors
+}
+
+// Cancel stops the job from compiling further documents. The document
+// being compiled, if any, is still compiled. Cancel has no effect if the
+// job is finished.
+func (job *PrecompileJob) Cancel() {
+	precompileMutex.Lock()
+	defer precompileMutex.Unlock()
+	job.canceled = true
+	for _, entry := range job.entries {
+		if entry.load == nil && !entry.claimed && job.engine.precompiled[entry.url] == entry {
+			delete(job.engine.precompiled, entry.url)
+		}
+	}
+}
+
+// Done returns a channel that is closed once the job is finished, whether
+// because all its documents were compiled or because it was canceled.
+func (job *PrecompileJob) Done() <-chan struct{} {
+	return job.done
+}
+
+// claimPrecompiled returns the load of the document at location started
+// by a precompile job of e, if any, and hands it over so that it is not
+// returned again. Documents of a job that were not yet started are
+// skipped by the job, and nil is returned for them.
+func (e *Engine) claimPrecompiled(location string) *ComponentLoad {
+	url, err := locationURL(location)
+	if err != nil {
+		return nil
+	}
+	precompileMutex.Lock()
+	defer precompileMutex.Unlock()
+	entry := e.precompiled[url]
+	if entry == nil {
+		return nil
+	}
+	if entry.load != nil && tref.Ref() == guiLoopRef {
+		select {
+		case <-entry.load.Done():
+		default:
+			// Cannot wait for it from the GUI thread.
+			return nil
+		}
+	}
+	delete(e.precompiled, url)
+	entry.claimed = true
+	return entry.load
+}
@@ -0,0 +1,231 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// profiler accumulates the time spent by an engine in each operation it
+// performs on behalf of QML code or Go code, while profiling is enabled.
+//
+// The profiler of an engine is only set and obtained from the main GUI
+// thread, but signals delivered to Go functions are measured from the
+// goroutines calling them.
+type profiler struct {
+	mutex   sync.Mutex
+	w       io.Writer
+	entries map[profileKey]*profileEntry
+}
+
+type profileKey struct {
+	kind string
+	name string
+}
+
+type profileEntry struct {
+	profileKey
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+// measure records that the operation of the given kind and name ran
+// from start until now. It's meant to be deferred, so that the start
+// time is taken when the defer statement runs:
+//
+//     if p := e.profile; p != nil {
+//         defer p.measure("method", name, time.Now())
+//     }
+//
+func (p *profiler) measure(kind, name string, start time.Time) {
+	d := time.Since(start)
+	key := profileKey{kind, name}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = &profileEntry{profileKey: key}
+		p.entries[key] = entry
+	}
+	entry.count++
+	entry.total += d
+	if d > entry.max {
+		entry.max = d
+	}
+}
+
+// StartProfiling starts recording the time spent by the engine in
+// compiling components loaded via the Load family of methods, in calling
+// methods of Go values from QML, in reading and writing fields of Go
+// values from QML, and in delivering signals to Go functions connected
+// via the Connect family of functions. StopProfiling writes the results
+// to w. An error is returned if the engine is already being profiled.
+//
+// Profiling costs next to nothing while disabled. The time spent by QML
+// itself, such as in evaluating bindings, is out of reach, as the Qt
+// versions supported only report it via the QML debugging service,
+// which must be enabled at build time and driven over a connection.
+func (e *Engine) StartProfiling(w io.Writer) error {
+	var err error
+	gui(func() {
+		if e.isDestroyed() {
+			err = errors.New("cannot start profiling: engine was destroyed")
+		} else if e.profile != nil {
+			err = errors.New("cannot start profiling: profiling already started")
+		} else {
+			e.profile = &profiler{w: w, entries: make(map[profileKey]*profileEntry)}
+		}
+	})
+	return err
+}
+
+// StopProfiling stops the profiling started via StartProfiling, and
+// writes the results to the writer provided to it as one line per
+// operation, with its kind, name, number of runs, total time, and
+// longest run, sorted by decreasing total time:
+//
+//     method    Doc.Render    12    48.2ms    9.1ms
+//
+// An error is returned if profiling wasn't started, or if writing fails.
+func (e *Engine) StopProfiling() error {
+	var p *profiler
+	gui(func() {
+		p = e.profile
+		e.profile = nil
+	})
+	if p == nil {
+		return errors.New("cannot stop profiling: profiling not started")
+	}
+	p.mutex.Lock()
+	entries := make([]*profileEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		e := *entry
+		entries = append(entries, &e)
+	}
+	p.mutex.Unlock()
+	sort.Sort(profileByTotal(entries))
+	for _, entry := range entries {
+		_, err := fmt.Fprintf(p.w, "%s\t%s\t%d\t%v\t%v\n", entry.kind, entry.name, entry.count, entry.total, entry.max)
+		if err != nil {
+			return fmt.Errorf("cannot write profiling results: %v", err)
+		}
+	}
+	return nil
+}
+
+type profileByTotal []*profileEntry
+
+func (s profileByTotal) Len() int      { return len(s) }
+func (s profileByTotal) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s profileByTotal) Less(i, j int) bool {
+	if s[i].total != s[j].total {
+		return s[i].total > s[j].total
+	}
+	if s[i].kind != s[j].kind {
+		return s[i].kind < s[j].kind
+	}
+	return s[i].name < s[j].name
+}
+
+// profileName returns the name of the method or field of v at index,
+// qualified by the name of the type of v, for reporting profiling results.
+func profileName(v reflect.Value, index int, method bool) string {
+	t := v.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if method {
+		return t.Name() + "." + v.Type().Method(index).Name
+	}
+	if index < t.NumField() {
+		return t.Name() + "." + t.Field(index).Name
+	}
+	return t.Name() + "." + t.FieldByIndex(promotedFields[t][index-t.NumField()]).Name
+}
+
+// FrameTiming holds the time spent in each stage of rendering a frame.
+type FrameTiming struct {
+	// Sync is the time spent synchronizing the scene graph with the
+	// state of the items in the window.
+	Sync time.Duration
+
+	// Render is the time spent rendering the scene graph.
+	Render time.Duration
+
+	// Swap is the time spent presenting the rendered frame.
+	Swap time.Duration
+}
+
+// renderTimingFrames is the number of recent frames held for RenderTimings.
+const renderTimingFrames = 120
+
+// renderTimers holds the timers installed in windows via SetRenderTiming,
+// until they are destroyed together with the windows.
+//
+// Only accessed from the main GUI thread.
+var renderTimers = make(map[unsafe.Pointer]unsafe.Pointer)
+
+// SetRenderTiming enables or disables recording the time spent in each
+// stage of rendering the frames of the window, as reported by
+// RenderTimings. Disabling it drops the frames recorded so far.
+func (win *Window) SetRenderTiming(enabled bool) {
+	var cenabled C.int
+	if enabled {
+		cenabled = 1
+	}
+	gui(func() {
+		timer, ok := renderTimers[win.obj.addr]
+		if !ok {
+			if !enabled {
+				return
+			}
+			timer = C.viewInstallRenderTimer(win.obj.addr)
+			renderTimers[win.obj.addr] = timer
+		}
+		C.renderTimerSetEnabled(timer, cenabled)
+	})
+}
+
+// RenderTimings returns the time spent in each stage of rendering the
+// most recent frames of the window, oldest first, up to 120 frames,
+// while enabled via SetRenderTiming.
+func (win *Window) RenderTimings() []FrameTiming {
+	var timings [3 * renderTimingFrames]int64
+	var n int
+	gui(func() {
+		if timer, ok := renderTimers[win.obj.addr]; ok {
+			n = int(C.renderTimerFrames(timer, (*C.longlong)(unsafe.Pointer(&timings[0])), renderTimingFrames))
+		}
+	})
+	if n == 0 {
+		return nil
+	}
+	frames := make([]FrameTiming, n)
+	for i := range frames {
+		frames[i] = FrameTiming{
+			Sync:   time.Duration(timings[3*i]),
+			Render: time.Duration(timings[3*i+1]),
+			Swap:   time.Duration(timings[3*i+2]),
+		}
+	}
+	return frames
+}
+
+//export hookRenderTimerDestroyed
+func hookRenderTimerDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookRenderTimerDestroyed") {
+		gui(func() { hookRenderTimerDestroyed(addr) })
+		return
+	}
+	delete(renderTimers, addr)
+}
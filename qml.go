@@ -10,6 +10,30 @@
 // release, please hold on a bit and subscribe to the mailing list for news. It's
 // in a pretty good state, so it shall not take too long.
 //
+// Callbacks
+//
+// Functions registered with the qml package to handle events, such as
+// the ones provided to Object.Connect, Store.OnChange, Menu.AddAction,
+// Window.OnFocusChanged, and Window.OnFirstFrame, are called in goroutines
+// owned by the package rather than in the main GUI thread, so that they may
+// block and call any qml function without stalling the GUI event loop.
+//
+// The calls for a single source, such as a single connection, a single
+// store, or a single window, happen one at a time and in the order the
+// events took place, while calls for different sources run concurrently
+// and in no particular order. A callback that blocks delays the following
+// calls for its own source only.
+//
+// The rare handlers that must act before QML observes the event, such as
+// handlers that veto or adjust changes, may request inline delivery via
+// Object.ConnectInline and Store.OnChangeInline. Inline handlers run in the
+// main GUI thread while the event is processed, so they must not block.
+//
+// Functions that are explicitly documented as called in a specific
+// thread, such as QmlLogger implementations, validators, event filters,
+// image providers, and the Paint methods of painted and OpenGL types,
+// are not affected by this.
+//
 // See http://github.com/niemeyer/qml for details.
 //
 package qml
@@ -21,66 +45,724 @@ package qml
 import "C"
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"github.com/niemeyer/qml/tref"
+	"image"
 	"io"
 	"io/ioutil"
+	"math"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 // InitOptions holds options to initialize the qml package.
 type InitOptions struct {
-	// Reserved for coming options.
+	// UntypedLists causes lists obtained from QML to be always
+	// returned as []interface{}. By default lists holding values
+	// of a single type are returned as []int, []float64, []string,
+	// or []bool, as appropriate.
+	UntypedLists bool
+
+	// UseMarshalers enables the conversion of Go values that would
+	// otherwise be exposed to QML as objects via the interfaces they
+	// implement, in the following order of precedence:
+	//
+	//   - encoding.TextMarshaler values become strings
+	//   - json.Marshaler values become the respective JavaScript value
+	//
+	// Values of the basic types, *Object, and slices are converted as
+	// usual even if they implement these interfaces. In the reverse
+	// direction, strings provided by QML as method parameters or assigned
+	// to struct fields are converted via encoding.TextUnmarshaler when the
+	// target type implements it. Failures from the marshaling methods
+	// are thrown as errors into the QML code reading a field, writing
+	// a field, or calling a method, and cause a panic mentioning the
+	// type involved when values are provided from Go, as via SetVar.
+	UseMarshalers bool
+
+	// ApplicationName and OrganizationName identify the application,
+	// and define among other things where settings saved by Qt and by
+	// QML's Settings element are stored.
+	ApplicationName  string
+	OrganizationName string
+
+	// Args holds the command line arguments handed to Qt, starting with
+	// the program name, such as os.Args. Qt handles and removes the
+	// arguments it understands, such as -platform and -style, and the
+	// remaining ones are returned by the Args function. By default no
+	// arguments are handed to Qt.
+	Args []string
+
+	// HighDpiScaling enables the scaling of the content of windows by
+	// the pixel density of the screen they're on, with Qt 5.6 and later.
+	HighDpiScaling bool
+
+	// RenderBackend selects the backend Qt Quick renders scenes with.
+	// The backend is fixed for the whole process, so it can only be
+	// selected at initialization time. See RenderBackend.
+	RenderBackend RenderBackend
+
+	// Platform selects the Qt platform plugin, such as "xcb", "wayland",
+	// or "offscreen", overriding the QT_QPA_PLATFORM environment variable.
+	// With the "offscreen" and "minimal" plugins, windows are created and
+	// rendered without a display, so that tests taking snapshots of them
+	// may run on headless systems. Scenes are then rendered in software,
+	// with Qt 5.8 and later, unless OpenGLRender is selected explicitly.
+	Platform string
 }
 
+// RenderBackend identifies a backend Qt Quick may render scenes with.
+type RenderBackend int
+
+const (
+	// DefaultRender selects the backend chosen by Qt, which is OpenGL
+	// unless selected otherwise via the QT_QUICK_BACKEND or the
+	// QMLSCENE_DEVICE environment variables.
+	DefaultRender RenderBackend = iota
+
+	// OpenGLRender renders scenes via OpenGL.
+	OpenGLRender
+
+	// SoftwareRender renders scenes in software, for systems without
+	// working OpenGL drivers. It's built into Qt 5.8 and later, and
+	// requires the Qt Quick 2D Renderer module with earlier versions.
+	// Features that depend on OpenGL, such as shader effects and the
+	// types registered via RegisterGLTypes, are not available.
+	SoftwareRender
+)
+
 var initialized int32
 
+// initOptions holds the options provided at initialization time.
+var initOptions InitOptions
+
+func applyOptions(options *InitOptions) {
+	if options != nil {
+		initOptions = *options
+		untypedLists = options.UntypedLists
+		useMarshalers = options.UseMarshalers
+	}
+}
+
+// initArgc and initArgv hold the arguments handed to Qt at initialization
+// time, which must remain valid while the application is running.
+var (
+	initArgc *C.int
+	initArgv **C.char
+)
+
+// newGuiApplication creates the Qt application with the options provided
+// at initialization time. Attributes that Qt reads when the application
+// is created are set before it.
+//
+// This must be run from the main GUI thread.
+func newGuiApplication() {
+	highDpi := C.int(0)
+	if initOptions.HighDpiScaling {
+		highDpi = 1
+	}
+	backend := initOptions.RenderBackend
+	if initOptions.Platform != "" {
+		os.Setenv("QT_QPA_PLATFORM", initOptions.Platform)
+	}
+	if headlessPlatform(platformName(&initOptions)) && backend == DefaultRender {
+		backend = SoftwareRender
+	}
+	C.applicationSetAttributes(highDpi, C.int(backend))
+
+	args := initOptions.Args
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	initArgc = (*C.int)(C.malloc(C.size_t(unsafe.Sizeof(C.int(0)))))
+	*initArgc = C.int(len(args))
+	// Qt expects a null pointer after the last argument.
+	initArgv = (**C.char)(C.malloc(C.size_t(uintptr(len(args)+1) * unsafe.Sizeof(nilCharPtr))))
+	argv := (*[1 << 20]*C.char)(unsafe.Pointer(initArgv))[:len(args)+1]
+	for i, arg := range args {
+		argv[i] = C.CString(arg)
+	}
+	argv[len(args)] = nilCharPtr
+	C.newGuiApplication(initArgc, initArgv)
+
+	cname, cnamelen := unsafeStringData(initOptions.ApplicationName)
+	corg, corglen := unsafeStringData(initOptions.OrganizationName)
+	C.applicationSetNames(cname, cnamelen, corg, corglen)
+}
+
+// Args returns the command line arguments provided via InitOptions.Args,
+// except for the program name and for the arguments handled by Qt, such
+// as -platform and -style, so that the application may interpret the
+// remaining ones. Args must be called after the qml package is
+// initialized.
+func Args() []string {
+	var args []string
+	gui(func() {
+		argv := (*[1 << 20]*C.char)(unsafe.Pointer(initArgv))[:*initArgc]
+		for _, arg := range argv[1:] {
+			args = append(args, C.GoString(arg))
+		}
+	})
+	return args
+}
+
 // Init initializes the qml package with the provided parameters.
 // If the options parameter is nil, default options suitable for a
 // normal graphic application will be used.
 //
 // Init must be called only once, and before any other functionality
-// from the qml package is used.
+// from the qml package is used. Init panics if initialization fails,
+// as reported by InitErr, including when Qt refuses the types registered
+// before the package was initialized.
+//
+// Programs that need no options may skip Init, as the package is then
+// initialized with default options on first use, such as when the first
+// engine is created. Init, Main, and Run fail after that, so programs
+// that use them must do so before anything else. On Mac OS the package
+// is not initialized on first use, and it panics asking for Main instead.
+//
+// Init cannot be used on Mac OS, where the GUI event loop must run
+// in the main thread of the process. Use Main instead for portability.
 func Init(options *InitOptions) {
+	if err := InitErr(options); err != nil {
+		panic(err.Error())
+	}
+}
+
+// InitErr works as Init, but returns an error if the package cannot be
+// initialized, including when the selected Qt platform plugin requires a
+// display that is not available, as is common in continuous integration
+// systems, rather than letting Qt abort the process. The package is left
+// uninitialized in that case, so InitErr may be called again with the
+// "offscreen" platform, for example:
+//
+//     err := qml.InitErr(nil)
+//     if err != nil {
+//         err = qml.InitErr(&qml.InitOptions{Platform: "offscreen"})
+//     }
+//
+func InitErr(options *InitOptions) error {
+	if atomic.LoadInt32(&initialized) != 0 {
+		return errors.New("qml.Init called more than once")
+	}
+	if runtime.GOOS == "darwin" {
+		return errors.New("qml.Init cannot be used on Mac OS as the GUI event loop must run in the main thread; use qml.Main instead")
+	}
+	if err := checkPlatform(options); err != nil {
+		return err
+	}
 	if !atomic.CompareAndSwapInt32(&initialized, 0, 1) {
-		panic("qml.Init called more than once")
+		return errors.New("qml.Init called more than once")
 	}
+	applyOptions(options)
 
 	guiLoopReady.Lock()
 	go guiLoop()
 	guiLoopReady.Lock()
+	return registerPending()
+}
+
+// Main initializes the qml package with the provided parameters, as
+// done by Init, and then runs the GUI event loop in the main thread
+// while f runs in a new goroutine. Once f returns, the GUI event loop
+// is stopped and Main returns. The qml package must not be used after
+// that.
+//
+// Main must be called from the main goroutine of the program, which
+// the qml package keeps locked to the main thread of the process.
+// This is required on Mac OS, and works on all other platforms, so
+// it is the most portable way to structure an application:
+//
+//     func main() {
+//         qml.Main(nil, run)
+//     }
+//
+//     func run() {
+//         engine := qml.NewEngine(nil)
+//         ...
+//     }
+//
+func Main(options *InitOptions, f func()) {
+	if tref.Ref() != mainRef {
+		panic("qml.Main must be called from the main goroutine")
+	}
+	if err := checkPlatform(options); err != nil {
+		panic(err.Error())
+	}
+	if !atomic.CompareAndSwapInt32(&initialized, 0, 1) {
+		panic("qml.Main called after the qml package was initialized")
+	}
+	applyOptions(options)
+	runLoop(func() {
+		if err := registerPending(); err != nil {
+			panic(err.Error())
+		}
+		f()
+		gui(func() {
+			C.applicationExit()
+		})
+	})
+}
+
+// runLoop runs the GUI event loop in the calling thread, and f in a new
+// goroutine once the loop is ready. f must stop the loop when done.
+func runLoop(f func()) {
+	guiLoopReady.Lock()
+	go func() {
+		guiLoopReady.Lock()
+		f()
+	}()
+	guiLoop()
+}
+
+// runQuit is closed by Quit to stop Run from waiting for windows to be
+// closed, and is nil while Run is not waiting.
+var (
+	runMutex sync.Mutex
+	runQuit  chan bool
+)
+
+// Run initializes the qml package with default options, as done by Init,
+// and then runs the GUI event loop in the main thread while f runs in a
+// new goroutine. Run returns once f returns and all the windows created
+// via CreateWindow are closed, or once f returns after Quit is called,
+// and the error returned by f is returned by Run, so that it may define
+// the exit status of the program:
+//
+//     func main() {
+//         if err := qml.Run(run); err != nil {
+//             fmt.Fprintf(os.Stderr, "error: %v\n", err)
+//             os.Exit(1)
+//         }
+//     }
+//
+// Before Run returns, all engines are destroyed along with the objects
+// they hold, so that the process shuts down cleanly. The qml package must
+// not be used after that. As with Main, Run must be called from the main
+// goroutine, and it returns an error without running f if the qml package
+// was already initialized, such as by an earlier call to Run.
+func Run(f func() error) error {
+	if tref.Ref() != mainRef {
+		return errors.New("qml.Run must be called from the main goroutine")
+	}
+	if err := checkPlatform(nil); err != nil {
+		return err
+	}
+	if !atomic.CompareAndSwapInt32(&initialized, 0, 1) {
+		return errors.New("qml.Run called after the qml package was initialized")
+	}
+	quit := make(chan bool)
+	runMutex.Lock()
+	runQuit = quit
+	runMutex.Unlock()
+
+	var err error
+	runLoop(func() {
+		err = registerPending()
+		if err == nil {
+			err = f()
+		}
+		waitWindows(quit)
+		gui(func() {
+			for _, engine := range engines {
+				engine.Destroy()
+			}
+			C.applicationExit()
+		})
+	})
+	C.applicationFlushDeleted()
+	return err
+}
+
+// Quit makes Run return as soon as the function provided to it returns,
+// without waiting for the windows still open to be closed. Quit may be
+// called from any goroutine, any number of times, and has no effect if
+// Run is not running.
+func Quit() {
+	runMutex.Lock()
+	if runQuit != nil {
+		close(runQuit)
+		runQuit = nil
+	}
+	runMutex.Unlock()
+}
+
+// waitWindows blocks until no windows created via CreateWindow remain
+// visible, or until quit is closed.
+func waitWindows(quit chan bool) {
+	for {
+		var visible []*Window
+		gui(func() {
+			for _, win := range windows {
+				if win.obj.addr != nilPtr && C.viewIsVisible(win.obj.addr) != 0 {
+					visible = append(visible, win)
+				}
+			}
+		})
+		if len(visible) == 0 {
+			return
+		}
+		closed := make(chan bool)
+		go func() {
+			for _, win := range visible {
+				win.Wait()
+			}
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// externalLoop is set by InitExternal, when the host application runs
+// the event loop by calling ProcessEventsOnce.
+var externalLoop bool
+
+// InitExternal initializes the qml package with the provided parameters,
+// as done by Init, but without running the GUI event loop. Instead, the
+// host application, which owns the thread and the loop, must call
+// ProcessEventsOnce regularly, such as once per frame of a game engine:
+//
+//     func main() {
+//         qml.InitExternal(nil)
+//         engine := qml.NewEngine(nil)
+//         ...
+//         for running {
+//             host.Tick()
+//             qml.ProcessEventsOnce()
+//         }
+//     }
+//
+// The thread InitExternal is called from becomes the main GUI thread, so
+// the calling goroutine is locked to it. On Mac OS that must be the main
+// thread of the process, which the main goroutine is locked to. All the
+// package functionality works as usual, but functions called from other
+// goroutines block until the next call to ProcessEventsOnce serves them.
+func InitExternal(options *InitOptions) {
+	if !atomic.CompareAndSwapInt32(&initialized, 0, 1) {
+		panic("qml.InitExternal called after the qml package was initialized")
+	}
+	applyOptions(options)
+
+	runtime.LockOSThread()
+
+	externalLoop = true
+	guiLoopRef = tref.Ref()
+	newGuiApplication()
+	if err := registerPending(); err != nil {
+		panic(err.Error())
+	}
+}
+
+// lazyInitMutex serializes the initialization of the package done on
+// first use, by initLazily and by RenderFile.
+var lazyInitMutex sync.Mutex
+
+// initLazily initializes the package with default options, as done by
+// Init, unless it was initialized already. It's called by gui, so that
+// programs which don't need any options may skip Init altogether.
+func initLazily() {
+	lazyInitMutex.Lock()
+	defer lazyInitMutex.Unlock()
+	if atomic.LoadInt32(&initialized) != 0 {
+		return
+	}
+	if runtime.GOOS == "darwin" {
+		panic("qml.Main must be called first, as the GUI event loop must run in the main thread on Mac OS")
+	}
+	if err := InitErr(nil); err != nil {
+		panic("cannot initialize the qml package: " + err.Error())
+	}
+}
+
+// pendingRegistrations holds the registrations of types and components
+// made before the package was initialized, which are run by
+// registerPending once the main GUI loop is ready.
+var (
+	pendingMutex         sync.Mutex
+	pendingRegistrations []func() error
+)
+
+// whenInitialized runs register right away if the package is initialized,
+// or queues it to be run by registerPending otherwise, so that types may
+// be registered before Init, Main, or Run.
+func whenInitialized(register func() error) error {
+	pendingMutex.Lock()
+	if atomic.LoadInt32(&initialized) == 0 {
+		pendingRegistrations = append(pendingRegistrations, register)
+		pendingMutex.Unlock()
+		return nil
+	}
+	pendingMutex.Unlock()
+	return register()
+}
+
+// registerPending runs the registrations queued before the package was
+// initialized, in the order they were made, and returns the errors they
+// reported, if any.
+func registerPending() error {
+	pendingMutex.Lock()
+	pending := pendingRegistrations
+	pendingRegistrations = nil
+	pendingMutex.Unlock()
+	var msgs []string
+	for _, register := range pending {
+		if err := register(); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+// ProcessEventsOnce processes the Qt events pending at the time of the
+// call and runs the functions waiting for the main GUI thread, and then
+// returns whether further work is pending already. It must be called
+// regularly from the thread InitExternal was called from.
+//
+// While the event loop is locked via Lock, ProcessEventsOnce blocks until
+// it is unlocked, as the event loop run by Init would.
+func ProcessEventsOnce() (pending bool) {
+	if !externalLoop {
+		panic("qml.ProcessEventsOnce called without qml.InitExternal")
+	}
+	if tref.Ref() != guiLoopRef {
+		panic("qml.ProcessEventsOnce called from a thread other than the one qml.InitExternal was called from")
+	}
+	select {
+	case <-guiDead:
+		guiDeadPanic()
+	default:
+	}
+	defer guiRecover()
+	C.applicationFlushAll()
+	hookIdleTimer()
+	return atomic.LoadInt32((*int32)(unsafe.Pointer(&hookWaiting))) > 0 || C.applicationHasPendingEvents() != 0
+}
+
+// ProbeOpenGL attempts to create an OpenGL context and to make it current
+// on an offscreen surface, returning an error if either step fails. It may
+// be called right after Init and before any window is shown, so that the
+// application can decide how to proceed on systems with broken drivers.
+//
+// The scene graph rendering backend is fixed for the whole process in the
+// supported Qt versions, so no transition between hardware and software
+// rendering is possible at runtime on any platform. If the probe fails, the
+// process must be restarted with a software OpenGL implementation in place
+// (for example, LIBGL_ALWAYS_SOFTWARE=1 with Mesa on Linux, or the
+// opengl32sw.dll fallback on Windows).
+func ProbeOpenGL() error {
+	var err error
+	gui(func() {
+		message := C.probeOpenGL()
+		if message != nilCharPtr {
+			err = errors.New(C.GoString(message))
+			C.free(unsafe.Pointer(message))
+		}
+	})
+	return err
 }
 
+// TODO Window.SetRenderTarget(backend) once Qt allows picking the scene graph
+//      backend per window (QQuickWindow::setSceneGraphBackend is process-wide).
+
 // Engine provides an environment for instantiating QML components.
 type Engine struct {
-	addr      unsafe.Pointer
-	values    map[interface{}]*valueFold
-	destroyed bool
+	addr    unsafe.Pointer
+	options *EngineOptions
+
+	// Set to 1 once the engine is destroyed. Accessed atomically, as
+	// the engine methods check it from any goroutine.
+	destroyed int32
+
+	// Only accessed from the main GUI thread.
+	values     map[interface{}]*valueFold
+	activated  map[interface{}]bool
+	exceptions *exceptionWatch
+	watchdog   unsafe.Pointer
+	providers  map[string]*imageProvider
+	parent     *Engine
+	children   map[*Engine]bool
+	locale     string
+	items      map[string]*Object
+	profile    *profiler
+
+	// collectThreshold is the number of Go values the engine must
+	// reference for periodic collection to run. See SetCollectThreshold.
+	collectThreshold int
+
+	// Guarded by precompileMutex.
+	precompiled map[string]*precompileEntry
+}
+
+// EngineOptions holds options that restrict what QML content running
+// under an engine may access, so that untrusted content such as
+// third-party themes may be loaded with reduced risk.
+//
+// Requests made via the engine for denied local files or network
+// resources fail, and are reported as warnings to the logger set via
+// SetLogger, so that misbehaving content may be identified. Loading
+// content that imports modules known to offer denied functionality
+// fails with an error listing the modules and what they were denied.
+//
+// In the supported Qt versions, components and images referenced by the
+// loaded content are read by the engine without going through the
+// network access layer, so AllowLocalFiles does not prevent them from
+// being loaded, and only the imports of the content provided to the
+// Load family of methods are verified. These options are therefore a
+// defense in depth mechanism and not a complete sandbox.
+type EngineOptions struct {
+	// AllowLocalFiles allows content to read local files via
+	// XMLHttpRequest and to import modules that access the filesystem,
+	// such as Qt.labs.folderlistmodel and QtQuick.LocalStorage.
+	AllowLocalFiles bool
+
+	// AllowNetwork allows content to access remote resources, and to
+	// import modules that do so, such as QtWebKit.
+	AllowNetwork bool
+
+	// AllowQtObjectProcessCreation allows content to import modules
+	// known to run external programs, such as Qt.labs.platform, and to
+	// open URLs in external applications via Qt.openUrlExternally, which
+	// otherwise returns false without opening anything.
+	AllowQtObjectProcessCreation bool
 }
 
+// engines holds the engines alive, and the ones destroyed that still
+// hold values referenced by C++, by their C++ address.
+//
+// Only accessed from the main GUI thread.
 var engines = make(map[unsafe.Pointer]*Engine)
 
-// NewEngine returns a new QML engine.
+// NewEngine returns a new QML engine. If options is nil, QML content
+// running under the engine has unrestricted access to local files,
+// network resources, and modules. Otherwise only the access allowed
+// by the provided options is granted. See EngineOptions for details.
 //
 // The Destory method must be called to finalize the engine and
 // release any resources used.
-func NewEngine() *Engine {
+func NewEngine(options *EngineOptions) *Engine {
 	engine := &Engine{values: make(map[interface{}]*valueFold)}
+	allowLocalFiles, allowNetwork := C.int(1), C.int(1)
+	if options != nil {
+		allowLocalFiles, allowNetwork = 0, 0
+		opts := *options
+		engine.options = &opts
+		if opts.AllowLocalFiles {
+			allowLocalFiles = 1
+		}
+		if opts.AllowNetwork {
+			allowNetwork = 1
+		}
+	}
 	gui(func() {
 		engine.addr = C.newEngine(nil)
+		// Also installed without options, for the network settings.
+		C.engineSetAccess(engine.addr, allowLocalFiles, allowNetwork)
+		if options != nil && !options.AllowQtObjectProcessCreation {
+			C.engineDenyOpenUrlExternally(engine.addr)
+		}
+		if len(registeredModules) > 0 {
+			cpath, cpathLen := unsafeStringData(":/" + modulesPath)
+			C.engineAddImportPath(engine.addr, cpath, cpathLen)
+		}
 		engines[engine.addr] = engine
 		stats.enginesAlive(+1)
 	})
 	return engine
 }
 
+// WarmUp loads the plugins of the modules needed by the provided imports,
+// such as "QtQuick.Controls 1.0", and registers the types they offer, so
+// that this work is done at a convenient time, such as while the
+// application is still starting, rather than when the first engine using
+// those imports loads a component. Plugins are loaded only once per
+// process, so that's the only work saved. WarmUp creates and destroys an
+// engine of its own to do it.
+//
+// Finding and parsing module definition files and compiling QML documents
+// are still done by every engine, including the ones created after WarmUp,
+// as Qt holds those caches per engine. WarmUp returns an error if any of
+// the imports cannot be resolved.
+func WarmUp(imports ...string) error {
+	engine := NewEngine(nil)
+	defer engine.Destroy()
+	data := "import QtQuick 2.0\n"
+	for _, imp := range imports {
+		data += "import " + imp + "\n"
+	}
+	_, err := engine.LoadString("warmup.qml", data+"QtObject {}\n")
+	return err
+}
+
+// deniedImports maps modules known to offer functionality that may be
+// denied via EngineOptions to a description of that functionality.
+var deniedImports = map[string]string{
+	"Qt.labs.folderlistmodel": "local files",
+	"Qt.labs.settings":        "local files",
+	"QtQuick.LocalStorage":    "local files",
+	"QtWebKit":                "network",
+	"QtWebEngine":             "network",
+	"Qt.labs.platform":        "process creation",
+}
+
+var importPattern = regexp.MustCompile(`(?m)^\s*import\s+([A-Za-z_][\w.]*)`)
+
+// checkImports returns an error if data imports any module offering
+// functionality denied by the engine options.
+func (e *Engine) checkImports(data []byte) error {
+	if e.options == nil {
+		return nil
+	}
+	var denied []string
+	for _, m := range importPattern.FindAllSubmatch(data, -1) {
+		module := string(m[1])
+		what, ok := deniedImports[module]
+		if !ok {
+			continue
+		}
+		switch what {
+		case "local files":
+			ok = e.options.AllowLocalFiles
+		case "network":
+			ok = e.options.AllowNetwork
+		case "process creation":
+			ok = e.options.AllowQtObjectProcessCreation
+		}
+		if !ok {
+			denied = append(denied, fmt.Sprintf("%s (%s)", module, what))
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("engine options deny imported modules: %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// isDestroyed returns whether the engine was destroyed. It may be
+// called from any goroutine.
+func (e *Engine) isDestroyed() bool {
+	return atomic.LoadInt32(&e.destroyed) != 0
+}
+
 func (e *Engine) assertValid() {
-	if e.destroyed {
+	if e.isDestroyed() {
 		panic("engine already destroyed")
 	}
 }
@@ -88,23 +770,166 @@ func (e *Engine) assertValid() {
 // Destroy finalizes the engine and releases any resources used.
 // The engine must not be used after calling this method.
 //
+// Component instances and windows created under the engine are
+// destroyed with it, and calling Destroy on any object obtained
+// from the engine afterwards has no effect. Child engines created
+// via NewChildEngine are destroyed with it as well.
+//
 // It is safe to call Destroy more than once.
 func (e *Engine) Destroy() {
-	if !e.destroyed {
-		gui(func() {
-			if !e.destroyed {
-				e.destroyed = true
-				C.delObjectLater(e.addr)
-				if len(e.values) == 0 {
-					delete(engines, e.addr)
-				} else {
-					// The engine reference keeps those values alive.
-					// The last value destroyed will clear it.
-				}
-				stats.enginesAlive(-1)
-			}
-		})
+	if !e.isDestroyed() {
+		gui(e.destroy)
+	}
+}
+
+// destroy destroys the engine and its child engines.
+//
+// This must be run from the main GUI thread.
+func (e *Engine) destroy() {
+	if e.isDestroyed() {
+		return
+	}
+	for child := range e.children {
+		child.destroy()
+	}
+	if e.parent != nil {
+		delete(e.parent.children, e)
+	}
+	forgetNetworkTransport(e.addr)
+	forgetURLInterceptor(e.addr)
+	atomic.StoreInt32(&e.destroyed, 1)
+	C.delEngineLater(e.addr)
+	for addr, watch := range windowWatches {
+		if watch.engine == e {
+			releaseWindowWaiters(addr)
+		}
+	}
+	if len(e.values) == 0 {
+		delete(engines, e.addr)
+	} else {
+		// The engine reference keeps those values alive.
+		// The last value destroyed will clear it.
+	}
+	stats.enginesAlive(-1)
+}
+
+// NewChildEngine returns a new engine with the options of e, and with
+// copies of its import paths, plugin paths, base url, url interceptor,
+// and image providers as of the time of the call, so that separate
+// engines may be created for sandboxed content, such as plugins, without
+// setting them up again. Types registered via RegisterTypes and the
+// related functions are available to all engines regardless.
+//
+// The child engine is independent from e afterwards, so changes made to
+// either of them, such as image providers added or removed, don't affect
+// the other one. Destroying e destroys the child engine as well, while
+// the child engine may be destroyed on its own at any time.
+func (e *Engine) NewChildEngine() *Engine {
+	e.assertValid()
+	child := NewEngine(e.options)
+	gui(func() {
+		if e.isDestroyed() {
+			child.destroy()
+			return
+		}
+		C.engineCopySettings(child.addr, e.addr)
+		for name, provider := range e.providers {
+			// Each C++ provider releases its own Go counterpart.
+			copied := *provider
+			child.setImageProvider(name, &copied)
+		}
+		child.parent = e
+		if e.children == nil {
+			e.children = make(map[*Engine]bool)
+		}
+		e.children[child] = true
+	})
+	e.assertValid()
+	return child
+}
+
+const (
+	preloadMaxDepth  = 32
+	preloadMaxValues = 1 << 16
+)
+
+// Preload prepares the provided values for use by QML code running under
+// the e engine, so that the cost of exposing them is paid up front (while
+// a splash screen is visible, for example) rather than when QML code first
+// accesses them. Struct pointers reachable via exported fields of the
+// provided values, including the ones held in slices, arrays, and maps,
+// are prepared as well, up to a bounded depth and number of values, and
+// all the work is done in a single trip to the GUI thread.
+//
+// The engine will hold a reference to the provided values and to the ones
+// reachable from them, so they will not be garbage collected until the
+// engine is destroyed, even if unused or changed.
+func (e *Engine) Preload(values ...interface{}) {
+	e.assertValid()
+	for _, value := range values {
+		injectSignals(value)
+	}
+	gui(func() {
+		budget := preloadMaxValues
+		seen := make(map[interface{}]bool)
+		for _, value := range values {
+			wrapGoValueGraph(e, value, cppOwner, preloadMaxDepth, &budget, seen)
+		}
+	})
+}
+
+// collectIdle is how long the GUI loop must go without user input
+// before periodic collection runs.
+const collectIdle = 300 * time.Millisecond
+
+// SetCollectInterval defines how often the main GUI thread considers
+// running the JavaScript garbage collector of the engine, or disables the
+// periodic collection if d is zero, which is the default. The collection
+// only runs when the GUI loop is idle, with no events pending and no user
+// input for a moment, and when the engine references at least as many Go
+// values as set via SetCollectThreshold. Otherwise that round is skipped,
+// so that collection never takes time from user interaction.
+//
+// Go values handed to QML code via method results and field reads are
+// referenced by the engine only while their JavaScript wrappers are alive,
+// so periodic collection releases the values that QML code only touched
+// briefly and makes them collectible by the Go garbage collector again.
+// Values provided via Context.SetVar, Context.SetVars, and Preload are
+// unaffected, and remain referenced as documented in those methods.
+func (e *Engine) SetCollectInterval(d time.Duration) {
+	e.assertValid()
+	gui(func() {
+		C.engineSetCollectInterval(e.addr, C.int(d/time.Millisecond))
+	})
+}
+
+// SetCollectThreshold defines how many distinct Go values the engine must
+// reference for the periodic collection enabled via SetCollectInterval to
+// run, so that engines holding few values are left alone. Values provided
+// via Context.SetVar, Context.SetVars, and Preload are counted, even though
+// they are never released by the collection. The default is zero, which
+// has the collection run whenever the GUI loop is idle.
+func (e *Engine) SetCollectThreshold(n int) {
+	e.assertValid()
+	gui(func() {
+		e.collectThreshold = n
+	})
+}
+
+//export hookEngineCollectTick
+func hookEngineCollectTick(enginep unsafe.Pointer) {
+	if !onGuiThread("hookEngineCollectTick") {
+		gui(func() { hookEngineCollectTick(enginep) })
+		return
+	}
+	engine := engines[enginep]
+	if engine == nil || engine.isDestroyed() || len(engine.values) < engine.collectThreshold {
+		return
+	}
+	if C.applicationHasPendingEvents() != 0 || time.Duration(C.applicationInputIdle())*time.Millisecond < collectIdle {
+		return
 	}
+	C.engineCollectGarbage(engine.addr, 0)
 }
 
 // Load loads a new component with the provided location and with the
@@ -119,31 +944,25 @@ func (e *Engine) Load(location string, r io.Reader) (*Object, error) {
 	if err != nil {
 		return nil, err
 	}
-	if colon, slash := strings.Index(location, ":"), strings.Index(location, "/"); colon == -1 || slash <= colon {
-		// TODO Better testing for this.
-		if filepath.IsAbs(location) {
-			location = "file:" + filepath.ToSlash(location)
-		} else {
-			dir, err := os.Getwd()
-			if err != nil {
-				return nil, fmt.Errorf("cannot obtain absolute path: %v", err)
-			}
-			location = "file:" + filepath.ToSlash(filepath.Join(dir, location))
-		}
+	if err = e.checkImports(data); err != nil {
+		return nil, err
+	}
+	if location, err = locationURL(location); err != nil {
+		return nil, err
 	}
 
 	cdata, cdatalen := unsafeBytesData(data)
 	cloc, cloclen := unsafeStringData(location)
-	comp := &Object{engine: e}
+	var comp *Object
 	gui(func() {
+		noteImports(data)
+		if p := e.profile; p != nil {
+			defer p.measure("compile", location, time.Now())
+		}
 		// TODO The component's parent should probably be the engine.
-		comp.addr = C.newComponent(e.addr, nilPtr)
+		comp = wrapObject(C.newComponent(e.addr, nilPtr), e)
 		C.componentSetData(comp.addr, cdata, cdatalen, cloc, cloclen)
-		message := C.componentErrorString(comp.addr)
-		if message != nilCharPtr {
-			err = errors.New(strings.TrimRight(C.GoString(message), "\n"))
-			C.free(unsafe.Pointer(message))
-		}
+		err = componentError(comp.addr)
 	})
 	if err != nil {
 		return nil, err
@@ -151,12 +970,56 @@ func (e *Engine) Load(location string, r io.Reader) (*Object, error) {
 	return comp, nil
 }
 
+// locationURL returns location as a URL, turning paths into file URLs.
+func locationURL(location string) (string, error) {
+	if colon, slash := strings.Index(location, ":"), strings.Index(location, "/"); colon == -1 || slash <= colon {
+		// TODO Better testing for this.
+		if filepath.IsAbs(location) {
+			return "file:" + filepath.ToSlash(location), nil
+		}
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("cannot obtain absolute path: %v", err)
+		}
+		return "file:" + filepath.ToSlash(filepath.Join(dir, location)), nil
+	}
+	return location, nil
+}
+
+// componentError returns the errors reported by the component at addr,
+// or nil if the component holds no errors.
+//
+// This must be run from the main GUI thread.
+func componentError(addr unsafe.Pointer) error {
+	message := C.componentErrorString(addr)
+	if message == nilCharPtr {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(message))
+	return errors.New(strings.TrimRight(C.GoString(message), "\n"))
+}
+
 // LoadFile loads a component from the provided QML file.
 // Resources referenced by the QML content will be resolved relative to its path.
+// Paths in the form "qrc:///path" refer to resources loaded via LoadResources.
 //
 // Once a component is loaded, component instances may be created from
 // the resulting object via its Create and CreateWindow methods.
+//
+// If the file is being compiled by PrecompileIdle, LoadFile waits for
+// that compilation and returns its outcome rather than compiling the
+// file again.
 func (e *Engine) LoadFile(path string) (*Object, error) {
+	if load := e.claimPrecompiled(path); load != nil {
+		return load.Wait()
+	}
+	if strings.HasPrefix(path, "qrc:") {
+		data, err := readResource(path)
+		if err != nil {
+			return nil, err
+		}
+		return e.Load(path, bytes.NewReader(data))
+	}
 	// TODO Test this.
 	f, err := os.Open(path)
 	if err != nil {
@@ -166,17 +1029,122 @@ func (e *Engine) LoadFile(path string) (*Object, error) {
 	return e.Load(path, f)
 }
 
-// LoadString loads a component from the provided QML string.
-// The location informs the resource name for logged messages, and its
-// path is used to locate any other resources referenced by the QML content.
+// LoadFirst loads a component from the first of the provided QML files
+// that can be successfully loaded, and returns it together with the path
+// it was loaded from. Resources referenced by the QML content will be
+// resolved relative to that path. If no file can be loaded, the returned
+// error reports the problem found in each of the locations.
 //
-// Once a component is loaded, component instances may be created from
-// the resulting object via its Create and CreateWindow methods.
-func (e *Engine) LoadString(location, qml string) (*Object, error) {
-	return e.Load(location, strings.NewReader(qml))
+// This is useful for deployments that look for the QML content in
+// several places, such as a user override directory followed by a
+// system directory, or by content embedded in the application via
+// LoadResources.
+func (e *Engine) LoadFirst(locations ...string) (*Object, string, error) {
+	if len(locations) == 0 {
+		return nil, "", errors.New("no locations provided to load from")
+	}
+	var msgs []string
+	for _, location := range locations {
+		comp, err := e.LoadFile(location)
+		if err == nil {
+			return comp, location, nil
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %v", location, err))
+	}
+	return nil, "", errors.New("cannot load from any location:\n" + strings.Join(msgs, "\n"))
 }
 
-// Context returns the engine's root context.
+// LoadURL loads a component from the QML document at the provided URL,
+// which must use the "file", "qrc", "http", or "https" scheme. The
+// document is fetched by the engine itself, so imports and resources
+// referenced by the QML content, such as the sources of Image elements,
+// are resolved relative to the URL and fetched from the same place:
+//
+//     component, err := engine.LoadURL("https://example.com/app/main.qml")
+//
+// Documents are loaded asynchronously, together with the components they
+// depend on, so LoadURL blocks the calling goroutine until loading is
+// finished while the GUI loop keeps running. If loading fails, the
+// returned error is a ComponentErrors value describing every problem
+// reported by QML. Malformed URLs, and URLs with other schemes, are
+// rejected before reaching Qt. Warnings that do not prevent the component
+// from loading are logged as usual rather than returned.
+//
+// If the engine was created with options, loading from "http" and
+// "https" URLs requires AllowNetwork, and the imports of such documents
+// are not verified, as their content is only seen by Qt.
+//
+// LoadURL panics if called from within the main GUI thread, as the
+// document is loaded by it.
+func (e *Engine) LoadURL(rawurl string) (*Object, error) {
+	e.assertValid()
+	remote, err := checkLoadURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if tref.Ref() == guiLoopRef {
+		panic("cannot load URL from within the main GUI thread")
+	}
+	if remote && e.options != nil && !e.options.AllowNetwork {
+		return nil, fmt.Errorf("cannot load from URL %q: engine options deny network access", rawurl)
+	}
+	load := e.loadAsync(rawurl, nil)
+	comp, err := load.Wait()
+	if err != nil && load.comp != nil {
+		gui(func() {
+			creport := C.componentErrors(load.comp.addr)
+			if errs := parseComponentErrors(C.GoString(creport)); len(errs) > 0 {
+				err = errs
+			}
+			C.free(unsafe.Pointer(creport))
+		})
+	}
+	return comp, err
+}
+
+// checkLoadURL returns an error if rawurl is malformed or uses a scheme
+// not supported by LoadURL, and otherwise whether it refers to a remote
+// document.
+func checkLoadURL(rawurl string) (remote bool, err error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false, fmt.Errorf("cannot load from malformed URL %q: %v", rawurl, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return false, fmt.Errorf("cannot load from URL %q: host missing", rawurl)
+		}
+		remote = true
+	case "file", "qrc":
+		if u.Opaque != "" || !strings.HasPrefix(u.Path, "/") {
+			return false, fmt.Errorf("cannot load from URL %q: path must be absolute", rawurl)
+		}
+	case "":
+		return false, fmt.Errorf("cannot load from URL %q: scheme missing", rawurl)
+	default:
+		return false, fmt.Errorf("cannot load from URL %q: unsupported scheme %q", rawurl, u.Scheme)
+	}
+	return remote, nil
+}
+
+// isRemoteURL returns whether location is an "http" or "https" URL.
+func isRemoteURL(location string) bool {
+	lower := strings.ToLower(location)
+	return strings.HasPrefix(lower, "http:") || strings.HasPrefix(lower, "https:")
+}
+
+// LoadString loads a component from the provided QML string.
+// The location informs the resource name for logged messages, and its
+// path is used to locate any other resources referenced by the QML content.
+//
+// Once a component is loaded, component instances may be created from
+// the resulting object via its Create and CreateWindow methods.
+func (e *Engine) LoadString(location, qml string) (*Object, error) {
+	return e.Load(location, strings.NewReader(qml))
+}
+
+// Context returns the engine's root context.
 func (e *Engine) Context() *Context {
 	e.assertValid()
 	var ctx Context
@@ -191,6 +1159,183 @@ func (e *Engine) Context() *Context {
 // to logic running within it.
 type Context struct {
 	obj Object
+
+	// spawned is set for contexts created via Spawn. These hold their
+	// own references to the values set on them, and may be destroyed.
+	spawned bool
+
+	// scoped is set for contexts created via WithOverrides, which are
+	// destroyed once the objects created under them are gone.
+	// instances is only accessed from the main GUI thread.
+	scoped    bool
+	instances int
+
+	// parent and children track the contexts spawned from one another,
+	// as Qt deletes the children of a context along with it.
+	// Only accessed from the main GUI thread.
+	parent   *Context
+	children []*Context
+
+	// Set to 1 once the context is destroyed. Accessed atomically.
+	destroyed int32
+}
+
+// Spawn creates a new context that has ctx as a parent. Variables
+// in ctx are visible to QML code running within the new context,
+// unless they are overridden by variables set in it.
+//
+// Go values made available to QML via the new context are held by it
+// rather than by the engine, so they are released once the context
+// is destroyed. See the Destroy method for details.
+func (ctx *Context) Spawn() *Context {
+	ctx.assertValid()
+	var result Context
+	result.obj.engine = ctx.obj.engine
+	result.spawned = true
+	result.parent = ctx
+	gui(func() {
+		result.obj.addr = C.newContext(ctx.obj.addr)
+		ctx.children = append(ctx.children, &result)
+	})
+	return &result
+}
+
+// isDestroyed returns whether the context was destroyed. It may be
+// called from any goroutine.
+func (ctx *Context) isDestroyed() bool {
+	return atomic.LoadInt32(&ctx.destroyed) != 0
+}
+
+func (ctx *Context) assertValid() {
+	if ctx.isDestroyed() {
+		panic("context already destroyed")
+	}
+}
+
+// Destroy finalizes a context created via Spawn. Its variables are
+// cleared, the bindings of objects created under it stop working, and
+// the Go values made available via its SetVar and SetVars methods are
+// released, so QML code that still references them will observe null.
+// Contexts spawned from ctx are destroyed as well.
+//
+// The context must not be used after calling this method, and Destroy
+// panics if called on the root context of an engine, which is destroyed
+// with the engine itself. It is safe to call Destroy more than once.
+func (ctx *Context) Destroy() {
+	if !ctx.spawned {
+		panic("cannot destroy the root context of an engine")
+	}
+	gui(func() {
+		if !ctx.isDestroyed() {
+			ctx.markDestroyed()
+			ctx.parent.dropChild(ctx)
+			if !ctx.obj.engine.isDestroyed() {
+				// Otherwise destroyed with the engine.
+				C.delObjectLater(ctx.obj.addr)
+			}
+		}
+	})
+}
+
+// markDestroyed flags ctx and all the contexts spawned from it as
+// destroyed, since Qt deletes them together with ctx.
+//
+// This must be run from the main GUI thread.
+func (ctx *Context) markDestroyed() {
+	atomic.StoreInt32(&ctx.destroyed, 1)
+	for _, child := range ctx.children {
+		child.markDestroyed()
+	}
+	ctx.children = nil
+}
+
+// dropChild removes child from the contexts spawned from ctx.
+//
+// This must be run from the main GUI thread.
+func (ctx *Context) dropChild(child *Context) {
+	for i, c := range ctx.children {
+		if c == child {
+			ctx.children = append(ctx.children[:i], ctx.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// WithOverrides spawns a context from ctx with the variables in vars set
+// on it, so that QML code running within the new context sees the
+// variables of ctx except for the overridden ones. Overriding a variable
+// with nil hides the respective variable of ctx. This is useful to create
+// components with most of the variables used in production, but with a
+// few of them replaced, as tests usually do:
+//
+//     ctx := engine.Context().WithOverrides(map[string]interface{}{
+//         "clock": &FakeClock{},
+//     })
+//     obj := component.Create(ctx)
+//
+// The new context is destroyed once all the objects and windows created
+// under it via Object.Create and Object.CreateWindow are destroyed, and
+// may otherwise be destroyed via its Destroy method as done for any
+// spawned context.
+func (ctx *Context) WithOverrides(vars map[string]interface{}) *Context {
+	scoped := ctx.Spawn()
+	scoped.scoped = true
+	for name, value := range vars {
+		scoped.SetVar(name, value)
+	}
+	return scoped
+}
+
+// scopedContexts holds the contexts created via WithOverrides for
+// each object created under them that was not yet destroyed.
+//
+// Only accessed from the main GUI thread.
+var scopedContexts = make(map[unsafe.Pointer]*Context)
+
+// scope records that the object at addr was created under ctx, if
+// ctx was created via WithOverrides, so that ctx is destroyed once
+// all such objects are destroyed.
+//
+// This must be run from the main GUI thread.
+func (ctx *Context) scope(addr unsafe.Pointer) {
+	if ctx != nil && ctx.scoped {
+		ctx.instances++
+		scopedContexts[addr] = ctx
+	}
+}
+
+// unscope drops the object at addr from its scoped context, if any,
+// and destroys the context if it holds no other objects.
+//
+// This must be run from the main GUI thread.
+func unscope(addr unsafe.Pointer) {
+	ctx, ok := scopedContexts[addr]
+	if !ok {
+		return
+	}
+	delete(scopedContexts, addr)
+	ctx.instances--
+	if ctx.instances == 0 {
+		ctx.Destroy()
+	}
+}
+
+// owner returns the owner to be used for values set on ctx.
+func (ctx *Context) owner() valueOwner {
+	if ctx.spawned {
+		return ctxOwner
+	}
+	return cppOwner
+}
+
+// hold makes ctx the parent of the value wrapper at cvalue, if
+// ctx is a spawned context, so that the wrapper is deleted with it.
+//
+// This must be run from the main GUI thread.
+func (ctx *Context) hold(cvalue unsafe.Pointer) {
+	if ctx.spawned {
+		C.objectSetParent(cvalue, ctx.obj.addr)
+	}
 }
 
 // TODO Consider whether to expose the methods of Object directly
@@ -204,16 +1349,66 @@ type Context struct {
 // QML code as attributes of the named object. The attribute name in the
 // object has the same name of the Go field name, except for the first
 // letter which is lowercased. This is conventional and enforced by
-// the QML implementation.
+// the QML implementation. A field tagged as `qml:"url"` is named by its
+// tag instead, and one tagged as `qml:"-"` is not made accessible at
+// all. See ExposurePolicy.
+//
+// Exported methods are also made accessible to QML code, named as
+// fields are, so that calling ctrl.save(text) in QML runs the Save
+// method of the value. Parameters are converted to the method parameter
+// types, and a single result is returned as is, while multiple results
+// are returned as a JavaScript array, with errors as objects offering an
+// error method. Methods with a variable number of parameters, or with
+// more than 10 parameters, are not made accessible.
+//
+// Exported fields of func type with no results are made accessible as
+// signals instead, named after the field without any "On" prefix, so
+// that an OnFinished or Finished field is handled by onFinished in QML.
+// If such a field is nil when the value is first made available to
+// QML, it is set to a function that emits the signal when called by Go
+// code. For the value provided to SetVar, that's done before SetVar
+// delivers it to the main GUI thread, so the field is set by the calling
+// goroutine. Functions assigned to the field by Go code are never replaced,
+// and calling them does not emit the signal.
+//
+// Slices are copied into JavaScript arrays, with struct items made
+// available as objects referring to the items in the slice, and maps
+// with string keys are copied into JavaScript objects, so that QML code
+// may access their entries as object attributes. Nested maps and slices
+// are copied as well. Maps with other key types are not supported.
+// JavaScript arrays and objects obtained from QML are in turn converted
+// into slices and map[string]interface{} values. Values of type []byte
+// are the exception, being copied into byte arrays that are obtained
+// back as []byte values.
+//
+// Values of type time.Time are converted into JavaScript dates in the same
+// time zone, and are obtained back in UTC, in the local time zone, or in a
+// fixed zone holding the original offset from UTC. Values of type
+// time.Duration are converted into a number of milliseconds, and numbers
+// are converted back into durations when used as such. Values implementing
+// color.Color are converted into colors, which are obtained back as
+// color.RGBA values, and url.URL values into their string form, as are
+// urls obtained from QML.
 //
 // The engine will hold a reference to the provided value, so it will
 // not be garbage collected until the engine is destroyed, even if the
-// value is unused or changed.
+// value is unused or changed. For contexts created via Spawn, the
+// reference is held until the context itself is destroyed.
 func (ctx *Context) SetVar(name string, value interface{}) {
+	ctx.assertValid()
+	injectSignals(value)
 	cname, cnamelen := unsafeStringData(name)
 	gui(func() {
 		var dvalue C.DataValue
-		packDataValue(value, &dvalue, ctx.obj.engine, cppOwner)
+		packDataValue(value, &dvalue, ctx.obj.engine, ctx.owner())
+		switch value.(type) {
+		case *Object, *LazyModel, *List, *TableModel, *Store, *EventBus:
+			// Not a wrapped Go value.
+		default:
+			if dvalue.dataType == C.DTObject {
+				ctx.hold(*(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data)))
+			}
+		}
 
 		qname := C.newString(cname, cnamelen)
 		defer C.delString(qname)
@@ -222,23 +1417,112 @@ func (ctx *Context) SetVar(name string, value interface{}) {
 	})
 }
 
+// swappedVar identifies a variable set via Context.SwapVar.
+type swappedVar struct {
+	ctx  unsafe.Pointer
+	name string
+}
+
+// swappedVars holds the value wrapper set for each variable via SwapVar,
+// which is released once the variable is swapped again.
+//
+// Only accessed from the main GUI thread.
+var swappedVars = make(map[swappedVar]unsafe.Pointer)
+
+// SwapVar replaces the value of the named variable with newValue, as done
+// by SetVar, so that large datasets may be replaced without views observing
+// an empty dataset in between. The new value is fully converted before the
+// variable is changed, and the variable then goes from the old value to the
+// new one in a single step on the main GUI thread, so that bindings using
+// it are reevaluated once, seeing the new value.
+//
+// Unlike values set via SetVar, which are held until the engine or the
+// spawned context is destroyed, Go values set via SwapVar are released
+// once the variable is swapped again, so that repeatedly replacing a
+// dataset does not accumulate its old versions. QML code still holding
+// references to a released value observes null.
+func (ctx *Context) SwapVar(name string, newValue interface{}) {
+	ctx.assertValid()
+	injectSignals(newValue)
+	cname, cnamelen := unsafeStringData(name)
+	gui(func() {
+		// Go values referenced by pointer get a wrapper of their own,
+		// which is never shared with other variables and so may be
+		// released once swapped out.
+		owner := ctx.owner()
+		if reflect.ValueOf(newValue).Kind() == reflect.Ptr {
+			owner = ctxOwner
+		}
+		var dvalue C.DataValue
+		packDataValue(newValue, &dvalue, ctx.obj.engine, owner)
+		var cvalue unsafe.Pointer
+		switch newValue.(type) {
+		case *Object, *LazyModel, *List, *TableModel, *Store, *EventBus:
+			// Not a wrapped Go value.
+		default:
+			if dvalue.dataType == C.DTObject && owner == ctxOwner {
+				cvalue = *(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data))
+				if ctx.spawned {
+					C.objectSetParent(cvalue, ctx.obj.addr)
+				} else {
+					C.objectSetParent(cvalue, ctx.obj.engine.addr)
+				}
+			}
+		}
+
+		qname := C.newString(cname, cnamelen)
+		defer C.delString(qname)
+		C.contextSetProperty(ctx.obj.addr, qname, &dvalue)
+
+		key := swappedVar{ctx.obj.addr, name}
+		old, ok := swappedVars[key]
+		if cvalue != nil {
+			swappedVars[key] = cvalue
+		} else {
+			delete(swappedVars, key)
+		}
+		if ok && old != cvalue {
+			C.delObjectLater(old)
+		}
+	})
+}
+
+// forgetSwappedVar drops the variables holding the value wrapper at cvalue
+// once it's destroyed.
+//
+// This must be run from the main GUI thread.
+func forgetSwappedVar(cvalue unsafe.Pointer) {
+	for key, held := range swappedVars {
+		if held == cvalue {
+			delete(swappedVars, key)
+		}
+	}
+}
+
 // SetVars makes the exported fields of the provided value available as
 // variables for QML code executed within the c context. The variable names
 // will have the same name of the Go field names, except for the first
 // letter which is lowercased. This is conventional and enforced by
-// the QML implementation.
+// the QML implementation. Fields are renamed or hidden via their tags
+// as documented in SetVar.
 //
 // The engine will hold a reference to the provided value, so it will
 // not be garbage collected until the engine is destroyed, even if the
-// value is unused or changed.
+// value is unused or changed. For contexts created via Spawn, the
+// reference is held until the context itself is destroyed.
 func (ctx *Context) SetVars(value interface{}) {
+	ctx.assertValid()
+	injectSignals(value)
 	gui(func() {
-		C.contextSetObject(ctx.obj.addr, wrapGoValue(ctx.obj.engine, value, cppOwner))
+		cvalue := wrapGoValue(ctx.obj.engine, value, ctx.owner())
+		ctx.hold(cvalue)
+		C.contextSetObject(ctx.obj.addr, cvalue)
 	})
 }
 
 // Var returns the context variable with the given name.
 func (ctx *Context) Var(name string) interface{} {
+	ctx.assertValid()
 	cname, cnamelen := unsafeStringData(name)
 
 	var dvalue C.DataValue
@@ -251,153 +1535,670 @@ func (ctx *Context) Var(name string) interface{} {
 	return unpackDataValue(&dvalue, ctx.obj.engine)
 }
 
-// TODO Context.Spawn() => Context
-
-// TODO engine.ObjectOf(&value) => *Object for the Go value
+// ObjectOf returns the object that represents value in QML code running
+// under the engine, such as a value provided via Context.SetVar or
+// returned by a method called by QML code, so that it may be handled as
+// any other QML object from Go. The same *Object is returned every time
+// for the same value. ObjectOf returns an error if value is not currently
+// held by the engine.
+func (e *Engine) ObjectOf(value interface{}) (*Object, error) {
+	var obj *Object
+	var err error
+	gui(func() {
+		if e.isDestroyed() {
+			err = fmt.Errorf("cannot find object for %T: engine was destroyed", value)
+			return
+		}
+		var fold *valueFold
+		var ok bool
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Slice, reflect.Map, reflect.Func:
+			// Not usable as map keys, so never held.
+		default:
+			fold, ok = e.values[value]
+		}
+		if !ok {
+			err = fmt.Errorf("cannot find object for %T: value is not held by the engine", value)
+			return
+		}
+		obj = wrapObject(fold.cvalue, e)
+	})
+	return obj, err
+}
 
 // Object represents a QML object.
 type Object struct {
 	addr   unsafe.Pointer
 	engine *Engine
+
+	// destroyed is set to 1 once the object is destroyed, and is
+	// accessed atomically so it may be checked out of the GUI thread.
+	destroyed int32
+}
+
+// objects holds the wrappers of the QML objects obtained so far, so that
+// the same *Object is used for the same underlying object until it is
+// destroyed. Wrappers are dropped when their object is destroyed, so
+// they never extend its lifetime.
+var (
+	objectsMutex sync.Mutex
+	objects      = make(map[unsafe.Pointer]*Object)
+
+	// foreignObjects holds the wrappers of the objects in objects that
+	// were obtained via other engines, which are also marked as
+	// destroyed once their object is destroyed.
+	foreignObjects = make(map[unsafe.Pointer][]*Object)
+
+	// owned holds the addresses of the objects created from Go that
+	// were not yet destroyed, as counted by Statistics.ObjectsAlive.
+	owned = make(map[unsafe.Pointer]bool)
+
+	// jsHandedOver holds the addresses of the objects explicitly handed
+	// over to the JavaScript garbage collector via SetOwnership, which
+	// must not be pinned again when returned to Go.
+	jsHandedOver = make(map[unsafe.Pointer]bool)
+)
+
+// wrapObject returns the wrapper for the QML object at addr, obtained
+// via engine. Objects obtained via different engines, which may only
+// happen while packing values before an engine is known, get their own
+// wrappers, which are tracked in foreignObjects.
+//
+// This may be run out of the main GUI thread.
+func wrapObject(addr unsafe.Pointer, engine *Engine) *Object {
+	if addr == nilPtr {
+		return &Object{engine: engine}
+	}
+	objectsMutex.Lock()
+	defer objectsMutex.Unlock()
+	if obj, ok := objects[addr]; ok {
+		if obj.engine == engine {
+			return obj
+		}
+		for _, obj := range foreignObjects[addr] {
+			if obj.engine == engine {
+				return obj
+			}
+		}
+		obj = &Object{engine: engine, addr: addr}
+		foreignObjects[addr] = append(foreignObjects[addr], obj)
+		if isStrict() {
+			strictTrack(obj)
+		}
+		return obj
+	}
+	obj := &Object{engine: engine, addr: addr}
+	objects[addr] = obj
+	if isStrict() {
+		strictTrack(obj)
+	}
+	C.objectTrackDestroyed(addr)
+	return obj
+}
+
+//export hookObjectDestroyed
+func hookObjectDestroyed(addr unsafe.Pointer) {
+	// The wrapper must be dropped right away, since another object
+	// may be allocated at the same address once this call returns.
+	objectsMutex.Lock()
+	if obj, ok := objects[addr]; ok {
+		atomic.StoreInt32(&obj.destroyed, 1)
+	}
+	for _, obj := range foreignObjects[addr] {
+		atomic.StoreInt32(&obj.destroyed, 1)
+	}
+	delete(objects, addr)
+	delete(foreignObjects, addr)
+	delete(jsHandedOver, addr)
+	if isStrict() {
+		strictForget(addr)
+	}
+	wasOwned := owned[addr]
+	delete(owned, addr)
+	objectsMutex.Unlock()
+	if wasOwned {
+		stats.objectsAlive(-1)
+	}
+	unscope(addr)
 }
 
-// Set changes the named object property to the given value.
+// ownObject records obj as created from Go, so that it's accounted for
+// until destroyed.
+//
+// This must be run from the main GUI thread.
+func ownObject(obj *Object) {
+	objectsMutex.Lock()
+	owned[obj.addr] = true
+	objectsMutex.Unlock()
+	stats.objectsAlive(+1)
+}
+
+// Set changes the named object property to the given value, and returns
+// an error if the object has no such property, if the property is
+// read-only, or if the value cannot be converted to the property type.
+//
+// The property name may be a dotted path reaching grouped, value type,
+// and attached properties, as done in QML documents:
+//
+//     obj.Set("anchors.margins", 10)
+//     obj.Set("font.pixelSize", 14)
+//     obj.Set("Layout.fillWidth", true)
+//
+// Attached properties are only available on objects created from QML
+// documents importing the respective module. The error returned when
+// such a path cannot be resolved mentions the first missing segment.
+//
+// Enum keys obtained via Enum are set as their value in the object type.
+//
+// Go values that are not of a basic type are held by the engine until it
+// is destroyed, unless the CollectableSetValues compatibility flag is set.
+// See SetCompat.
 func (obj *Object) Set(property string, value interface{}) error {
-	cproperty := C.CString(property)
-	defer C.free(unsafe.Pointer(cproperty))
+	obj.assertLive()
+	if sym, ok := value.(EnumSymbol); ok {
+		v, found := obj.enumValue(sym.String())
+		if !found {
+			return fmt.Errorf("cannot assign enum key %q to property %q: object has no such key", sym.String(), property)
+		}
+		value = v
+	}
+	injectSignals(value)
+	var owner valueOwner = cppOwner
+	if compat(CollectableSetValues) {
+		owner = jsOwner
+	}
+	var held bool
+	var result C.int
+	var typeName, missing string
 	gui(func() {
 		var dvalue C.DataValue
-		packDataValue(value, &dvalue, obj.engine, cppOwner)
-		C.objectSetProperty(obj.addr, cproperty, &dvalue)
+		var ctypeName *C.char
+		packDataValue(value, &dvalue, obj.engine, owner)
+		cproperty := acquireCString(property)
+		result = C.objectSetProperty(obj.addr, cproperty, &dvalue, &ctypeName)
+		releaseCString(cproperty)
+		if ctypeName != nilCharPtr {
+			typeName = C.GoString(ctypeName)
+		}
+		if result == C.SetNoProperty {
+			missing = obj.missingSegment(property)
+		}
+		held = owner == cppOwner && dvalue.dataType == C.DTObject
 	})
-	// TODO Return an error if the value cannot be set.
+	switch result {
+	case C.SetNoProperty:
+		if missing != "" {
+			return fmt.Errorf("object has no property %q: cannot find %q", property, missing)
+		}
+		return fmt.Errorf("object has no property %q", property)
+	case C.SetReadOnly:
+		return fmt.Errorf("cannot assign to read-only property %q", property)
+	case C.SetWrongType:
+		return fmt.Errorf("cannot assign %T to property %q of type %s", value, property, typeName)
+	}
+	switch value.(type) {
+	case *Object, *LazyModel, *List, *TableModel, *Store, *EventBus:
+	default:
+		if held {
+			reportLegacy(CollectableSetValues, "Go value set as property is held until the engine is destroyed")
+		}
+	}
 	return nil
 }
 
 // Property returns the current value for a property of the object.
 // If the property type is known, type-specific methods such as Int
-// and String are more convenient to use.
+// and String are more convenient to use. The property name may be a
+// dotted path, as documented in Set.
 // Property panics if the property does not exist.
 func (obj *Object) Property(name string) interface{} {
+	value, err := obj.PropertyErr(name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return value
+}
+
+// PropertyErr returns the current value for a property of the object,
+// as done by Property, or an error if the property does not exist. It's
+// useful when walking objects defined by QML documents that may or may
+// not declare the property.
+func (obj *Object) PropertyErr(name string) (interface{}, error) {
+	value, found := obj.property(name)
+	if !found {
+		var missing string
+		gui(func() { missing = obj.missingSegment(name) })
+		if missing != "" {
+			return nil, fmt.Errorf("object does not have a %q property: cannot find %q", name, missing)
+		}
+		return nil, fmt.Errorf("object does not have a %q property", name)
+	}
+	return value, nil
+}
+
+// HasProperty returns whether the object has the named property. The
+// property name may be a dotted path, as documented in Set.
+func (obj *Object) HasProperty(name string) bool {
+	_, found := obj.property(name)
+	return found
+}
+
+// missingSegment returns the first segment of the dotted property path
+// name that cannot be resolved on obj, or an empty string if name is
+// not a dotted path.
+//
+// This must be run from the main GUI thread.
+func (obj *Object) missingSegment(name string) string {
+	if !strings.Contains(name, ".") {
+		return ""
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
+	i := int(C.objectMissingPropertySegment(obj.addr, cname))
+	return strings.Split(name, ".")[i]
+}
 
+// property returns the value of the named property of obj, and
+// whether the property exists.
+func (obj *Object) property(name string) (value interface{}, found bool) {
+	obj.assertLive()
 	var dvalue C.DataValue
-	var found C.int
+	var cfound C.int
 	gui(func() {
-		found = C.objectGetProperty(obj.addr, cname, &dvalue)
+		cname := acquireCString(name)
+		cfound = C.objectGetProperty(obj.addr, cname, &dvalue)
+		releaseCString(cname)
+		pinDataValue(&dvalue)
 	})
-	if found == 0 {
-		panic(fmt.Sprintf("object does not have a %q property", name))
+	if cfound == 0 {
+		return nil, false
 	}
-	return unpackDataValue(&dvalue, obj.engine)
+	return unpackDataValue(&dvalue, obj.engine), true
 }
 
 // Int returns the int value of the given property.
 // Int panics if the property value cannot be represented as an int.
 func (obj *Object) Int(property string) int {
-	switch value := obj.Property(property).(type) {
+	i, err := intValue(propertySubject(property), obj.Property(property))
+	if err != nil {
+		panic(err.Error())
+	}
+	return i
+}
+
+// IntOr returns the int value of the given property, or def if the
+// property does not exist or its value cannot be represented as an int.
+func (obj *Object) IntOr(property string, def int) int {
+	if value, ok := obj.property(property); ok {
+		if i, err := intValue(propertySubject(property), value); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+func intValue(subject string, value interface{}) (int, error) {
+	switch value := value.(type) {
 	case int:
-		return value
+		return value, nil
 	case int32:
-		return int(value)
+		return int(value), nil
 	case int64:
 		if int64(int(value)) != value {
-			panic(fmt.Sprintf("value of property %q is too large for int: %#v", property, value))
+			return 0, fmt.Errorf("value of %s is too large for int: %#v", subject, value)
 		}
-		return int(value)
+		return int(value), nil
 	case float32:
-		// May truncate, but seems a bit too much computing to validate these all the time.
-		return int(value)
+		return int(value), checkTruncation(subject, float64(value), "an int")
 	case float64:
-		// May truncate, but seems a bit too much computing to validate these all the time.
-		return int(value)
-	default:
-		panic(fmt.Sprintf("value of property %q cannot be represented as an int: %#v", property, value))
+		return int(value), checkTruncation(subject, value, "an int")
+	case uint64:
+		if value > math.MaxInt64 || int64(int(value)) != int64(value) {
+			return 0, fmt.Errorf("value of %s is too large for int: %#v", subject, value)
+		}
+		return int(value), nil
+	}
+	if wide, ok := widenNumber(value); ok {
+		return intValue(subject, wide)
+	}
+	return 0, fmt.Errorf("value of %s cannot be represented as an int: %#v", subject, value)
+}
+
+// widenNumber returns value converted to int64, uint64, or float64, if
+// it's of another numeric kind, such as uint8 or a named type.
+func widenNumber(value interface{}) (interface{}, bool) {
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() != typeInt64 {
+			return v.Int(), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Type() != typeUint64 {
+			return v.Uint(), true
+		}
+	case reflect.Float32, reflect.Float64:
+		if v.Type() != typeFloat64 {
+			return v.Float(), true
+		}
+	}
+	return nil, false
+}
+
+// checkTruncation returns an error if value has a fractional part and
+// the StrictCoercions compatibility flag is set. Otherwise the value is
+// truncated by the caller, which is reported as a legacy behavior.
+func checkTruncation(subject string, value float64, what string) error {
+	if value == math.Trunc(value) {
+		return nil
+	}
+	if compat(StrictCoercions) {
+		return fmt.Errorf("value of %s cannot be represented as %s without loss: %#v", subject, what, value)
 	}
+	reportLegacy(StrictCoercions, fmt.Sprintf("value of %s truncated to %s", subject, what))
+	return nil
 }
 
 // Int64 returns the int64 value of the given property.
 // Int64 panics if the property value cannot be represented as an int64.
 func (obj *Object) Int64(property string) int64 {
-	switch value := obj.Property(property).(type) {
+	i, err := int64Value(propertySubject(property), obj.Property(property))
+	if err != nil {
+		panic(err.Error())
+	}
+	return i
+}
+
+// Int64Or returns the int64 value of the given property, or def if the
+// property does not exist or its value cannot be represented as an int64.
+func (obj *Object) Int64Or(property string, def int64) int64 {
+	if value, ok := obj.property(property); ok {
+		if i, err := int64Value(propertySubject(property), value); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+func int64Value(subject string, value interface{}) (int64, error) {
+	switch value := value.(type) {
 	case int:
-		return int64(value)
+		return int64(value), nil
 	case int32:
-		return int64(value)
+		return int64(value), nil
 	case int64:
-		return value
+		return value, nil
 	case float32:
-		// May truncate, but seems a bit too much computing to validate these all the time.
-		return int64(value)
+		return int64(value), checkTruncation(subject, float64(value), "an int64")
 	case float64:
-		// May truncate, but seems a bit too much computing to validate these all the time.
-		return int64(value)
-	default:
-		panic(fmt.Sprintf("value of property %q cannot be represented as an int64: %#v", property, value))
+		return int64(value), checkTruncation(subject, value, "an int64")
+	case uint64:
+		if value > math.MaxInt64 {
+			return 0, fmt.Errorf("value of %s is too large for int64: %#v", subject, value)
+		}
+		return int64(value), nil
+	}
+	if wide, ok := widenNumber(value); ok {
+		return int64Value(subject, wide)
 	}
+	return 0, fmt.Errorf("value of %s cannot be represented as an int64: %#v", subject, value)
 }
 
 // Float64 returns the float64 value of the given property.
 // Float64 panics if the property value cannot be represented as float64.
 func (obj *Object) Float64(property string) float64 {
-	switch value := obj.Property(property).(type) {
+	f, err := float64Value(propertySubject(property), obj.Property(property))
+	if err != nil {
+		panic(err.Error())
+	}
+	return f
+}
+
+// Float64Or returns the float64 value of the given property, or def if
+// the property does not exist or its value cannot be represented as a
+// float64.
+func (obj *Object) Float64Or(property string, def float64) float64 {
+	if value, ok := obj.property(property); ok {
+		if f, err := float64Value(propertySubject(property), value); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+func float64Value(subject string, value interface{}) (float64, error) {
+	switch value := value.(type) {
 	case int:
-		return float64(value)
+		return float64(value), nil
 	case int32:
-		return float64(value)
+		return float64(value), nil
 	case int64:
-		return float64(value)
+		return float64(value), nil
 	case float32:
-		return float64(value)
+		return float64(value), nil
 	case float64:
-		return value
-	default:
-		panic(fmt.Sprintf("value of property %q cannot be represented as a float64: %#v", property, value))
+		return value, nil
+	case uint64:
+		return float64(value), nil
+	}
+	if wide, ok := widenNumber(value); ok {
+		return float64Value(subject, wide)
 	}
+	return 0, fmt.Errorf("value of %s cannot be represented as a float64: %#v", subject, value)
 }
 
-// Bool returns the bool value of the given property.
-// Bool panics if the property value is not a bool.
-func (obj *Object) Bool(property string) bool {
-	value := obj.Property(property)
-	b, ok := value.(bool)
-	if !ok {
-		panic(fmt.Sprintf("value of property %q is not a bool: %#v", property, value))
+// Uint64 returns the uint64 value of the given property.
+// Uint64 panics if the property value cannot be represented as a uint64.
+func (obj *Object) Uint64(property string) uint64 {
+	u, err := uint64Value(propertySubject(property), obj.Property(property))
+	if err != nil {
+		panic(err.Error())
 	}
-	return b
+	return u
 }
 
-// String returns the string value of the given property.
-// String panics if the property value is not a string.
-func (obj *Object) String(property string) string {
-	value := obj.Property(property)
-	s, ok := value.(string)
-	if !ok {
-		panic(fmt.Sprintf("value of property %q is not a string: %#v", property, value))
+// Uint64Or returns the uint64 value of the given property, or def if the
+// property does not exist or its value cannot be represented as a uint64.
+func (obj *Object) Uint64Or(property string, def uint64) uint64 {
+	if value, ok := obj.property(property); ok {
+		if u, err := uint64Value(propertySubject(property), value); err == nil {
+			return u
+		}
 	}
-	return s
+	return def
 }
 
-
-// TODO Consider getting rid of int32 and float32 results. Always returning 64-bit
-//      results will make it easier on clients that want to handle arbitrary typing.
-
-// Object returns the *qml.Object value of the given property.
-// Object panics if the property value is not a *qml.Object.
-func (obj *Object) Object(property string) *Object {
-	value := obj.Property(property)
-	object, ok := value.(*Object)
-	if !ok {
+func uint64Value(subject string, value interface{}) (uint64, error) {
+	switch value := value.(type) {
+	case int:
+		if value >= 0 {
+			return uint64(value), nil
+		}
+	case int32:
+		if value >= 0 {
+			return uint64(value), nil
+		}
+	case int64:
+		if value >= 0 {
+			return uint64(value), nil
+		}
+	case float32:
+		if value >= 0 && value < math.MaxUint64 {
+			return uint64(value), checkTruncation(subject, float64(value), "a uint64")
+		}
+	case float64:
+		if value >= 0 && value < math.MaxUint64 {
+			return uint64(value), checkTruncation(subject, value, "a uint64")
+		}
+	case uint64:
+		return value, nil
+	default:
+		if wide, ok := widenNumber(value); ok {
+			return uint64Value(subject, wide)
+		}
+	}
+	return 0, fmt.Errorf("value of %s cannot be represented as a uint64: %#v", subject, value)
+}
+
+// Float32 returns the float32 value of the given property.
+// Float32 panics if the property value cannot be represented as float32.
+func (obj *Object) Float32(property string) float32 {
+	f, err := float32Value(propertySubject(property), obj.Property(property))
+	if err != nil {
+		panic(err.Error())
+	}
+	return f
+}
+
+// Float32Or returns the float32 value of the given property, or def if
+// the property does not exist or its value cannot be represented as a
+// float32.
+func (obj *Object) Float32Or(property string, def float32) float32 {
+	if value, ok := obj.property(property); ok {
+		if f, err := float32Value(propertySubject(property), value); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+func float32Value(subject string, value interface{}) (float32, error) {
+	f, err := float64Value(subject, value)
+	if err != nil {
+		return 0, fmt.Errorf("value of %s cannot be represented as a float32: %#v", subject, value)
+	}
+	if math.Abs(f) > math.MaxFloat32 && !math.IsInf(f, 0) {
+		return 0, fmt.Errorf("value of %s is too large for float32: %#v", subject, value)
+	}
+	return float32(f), nil
+}
+
+// propertySubject returns how the named property is referred to in
+// conversion errors.
+func propertySubject(name string) string {
+	return fmt.Sprintf("property %q", name)
+}
+
+// Bool returns the bool value of the given property.
+// Bool panics if the property value is not a bool.
+func (obj *Object) Bool(property string) bool {
+	value := obj.Property(property)
+	b, ok := value.(bool)
+	if !ok {
+		panic(fmt.Sprintf("value of property %q is not a bool: %#v", property, value))
+	}
+	return b
+}
+
+// BoolOr returns the bool value of the given property, or def if the
+// property does not exist or its value is not a bool.
+func (obj *Object) BoolOr(property string, def bool) bool {
+	value, _ := obj.property(property)
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return def
+}
+
+// String returns the string value of the given property.
+// String panics if the property value is not a string.
+func (obj *Object) String(property string) string {
+	value := obj.Property(property)
+	s, ok := value.(string)
+	if !ok {
+		panic(fmt.Sprintf("value of property %q is not a string: %#v", property, value))
+	}
+	return s
+}
+
+// StringOr returns the string value of the given property, or def if
+// the property does not exist or its value is not a string.
+func (obj *Object) StringOr(property string, def string) string {
+	value, _ := obj.property(property)
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return def
+}
+
+// Time returns the time.Time value of the given property, such as
+// the value of a date property.
+// Time panics if the property value is not a time.Time.
+func (obj *Object) Time(property string) time.Time {
+	value := obj.Property(property)
+	t, ok := value.(time.Time)
+	if !ok {
+		panic(fmt.Sprintf("value of property %q is not a time.Time: %#v", property, value))
+	}
+	return t
+}
+
+// TimeOr returns the time.Time value of the given property, or def if
+// the property does not exist or its value is not a time.Time.
+func (obj *Object) TimeOr(property string, def time.Time) time.Time {
+	value, _ := obj.property(property)
+	if t, ok := value.(time.Time); ok {
+		return t
+	}
+	return def
+}
+
+// Object returns the *qml.Object value of the given property.
+// Object panics if the property value is not a *qml.Object.
+func (obj *Object) Object(property string) *Object {
+	value := obj.Property(property)
+	object, ok := value.(*Object)
+	if !ok {
 		panic(fmt.Sprintf("value of property %q is not a *qml.Object: %#v", property, value))
 	}
 	return object
 }
 
+// ObjectOr returns the *qml.Object value of the given property, or def
+// if the property does not exist or its value is not a *qml.Object.
+func (obj *Object) ObjectOr(property string, def *Object) *Object {
+	value, _ := obj.property(property)
+	if object, ok := value.(*Object); ok {
+		return object
+	}
+	return def
+}
+
+// Interface returns the Go value wrapped by obj, for objects created by
+// QML from types registered via RegisterType and related functions, and
+// for the objects wrapping values provided to QML by Go, such as via
+// Context.SetVar. The value returned is the one provided to or created
+// for QML, rather than a copy, so its methods may be called as usual:
+//
+//     obj := component.Create(nil) // Document is a registered Go type
+//     value, err := obj.Interface()
+//     if err != nil {
+//         return err
+//     }
+//     value.(*Document).Save()
+//
+// An error is returned for objects that do not wrap a Go value.
+func (obj *Object) Interface() (interface{}, error) {
+	obj.assertLive()
+	var gvalue interface{}
+	var className string
+	gui(func() {
+		if foldp := C.objectGoAddr(obj.addr); foldp != nilPtr {
+			gvalue = (*valueFold)(foldp).gvalue
+		} else {
+			className = C.GoString(C.objectClassName(obj.addr))
+		}
+	})
+	if gvalue == nil {
+		return nil, fmt.Errorf("object of class %s does not wrap a Go value", className)
+	}
+	return gvalue, nil
+}
+
 // ObjectByName returns the *qml.Object value of the descendant object that
 // was defined with the objectName property set to the provided value.
 // ObjectByName panics if the object is not found.
 func (obj *Object) ObjectByName(objectName string) *Object {
+	obj.assertLive()
 	cname, cnamelen := unsafeStringData(objectName)
 	var dvalue C.DataValue
 	gui(func() {
@@ -412,31 +2213,88 @@ func (obj *Object) ObjectByName(objectName string) *Object {
 	return object
 }
 
-// TODO Consider using a Result wrapper type to be used by the Object.Call,
-//      Object.Property, and Context.Var methods. It would offer methods such as
-//      Int, and String, to facilitate converting (rather than just type-asserting)
-//      results to the desired types, in a way equivalent to what Object currently
-//      does for properties.
+// CreationLocation returns the URL of the QML document and the line and
+// column in it where the object was declared, for objects created from
+// QML documents either declaratively or dynamically, such as via
+// Qt.createComponent. The ok result is false for objects without that
+// information, such as the ones created by Go or C++ code.
+func (obj *Object) CreationLocation() (url string, line, column int, ok bool) {
+	obj.assertLive()
+	gui(func() {
+		var cline, ccolumn C.int
+		curl := C.objectCreationLocation(obj.addr, &cline, &ccolumn)
+		if curl == nilCharPtr {
+			return
+		}
+		url = C.GoString(curl)
+		C.free(unsafe.Pointer(curl))
+		line, column, ok = int(cline), int(ccolumn), true
+	})
+	return
+}
 
 // Call calls the given object method with the provided parameters.
-// Call panics if the method does not exist.
+// Call panics if the method cannot be called, as reported by CallError.
 func (obj *Object) Call(method string, params ...interface{}) interface{} {
-	if len(params) > len(dataValueArray) {
-		panic("too many parameters")
+	result, err := obj.CallError(method, params...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return result
+}
+
+// CallError calls the given object method with the provided parameters,
+// and returns an error if the object has no such method, if no overload
+// of the method can take the provided parameters, or if invoking it fails.
+// The error message includes the signatures of the methods with that name
+// that were considered, so that calls into QML code that may not define
+// the method as expected are easy to diagnose.
+//
+// Methods implemented in C++ take up to 10 parameters. Functions declared
+// in QML code take any number of parameters, including more than the ones
+// they declare, which are then available to them via rest parameters or
+// the arguments object, as usual in JavaScript. Slices are provided to
+// JavaScript as arrays, like any other parameter.
+func (obj *Object) CallError(method string, params ...interface{}) (interface{}, error) {
+	obj.assertLive()
+	for _, param := range params {
+		injectSignals(param)
 	}
-	cmethod := C.CString(method)
-	defer C.free(unsafe.Pointer(cmethod))
 	var result C.DataValue
+	var status C.int
+	var candidates string
 	gui(func() {
+		dvalues := dataValueArray[:]
+		if len(params) > len(dvalues) {
+			dvalues = make([]C.DataValue, len(params))
+		}
 		for i, param := range params {
-			packDataValue(param, &dataValueArray[i], obj.engine, jsOwner)
+			packDataValue(param, &dvalues[i], obj.engine, jsOwner)
+		}
+		var ccandidates *C.char
+		cmethod := acquireCString(method)
+		status = C.objectInvoke(obj.addr, cmethod, &result, &dvalues[0], C.int(len(params)), &ccandidates)
+		releaseCString(cmethod)
+		pinDataValue(&result)
+		if ccandidates != nilCharPtr {
+			candidates = C.GoString(ccandidates)
+			C.free(unsafe.Pointer(ccandidates))
 		}
-		// TODO Panic if the underlying invokation returns false.
-		// TODO Is there any other actual error other than existence that can be observed?
-		//      If so, this method needs an error result too.
-		C.objectInvoke(obj.addr, cmethod, &result, &dataValueArray[0], C.int(len(params)))
 	})
-	return unpackDataValue(&result, obj.engine)
+	switch status {
+	case C.InvokeNoMethod:
+		return nil, fmt.Errorf("object has no method %q", method)
+	case C.InvokeNoMatch:
+		return nil, fmt.Errorf("cannot call method %q with %d arguments; candidates are:\n%s", method, len(params), indent(candidates))
+	case C.InvokeFailed:
+		return nil, fmt.Errorf("failed to call method %q; candidates are:\n%s", method, indent(candidates))
+	}
+	return unpackDataValue(&result, obj.engine), nil
+}
+
+// indent indents every line in s with a tab.
+func indent(s string) string {
+	return "\t" + strings.Replace(s, "\n", "\n\t", -1)
 }
 
 // Create creates a new instance of the component held by obj.
@@ -444,21 +2302,48 @@ func (obj *Object) Call(method string, params ...interface{}) interface{} {
 // it runs under the same context as obj.
 //
 // The Create method panics if called on an object that does not
-// represent a QML component.
+// represent a QML component, or if the component instance cannot be
+// created. In the latter case the panic message holds the errors
+// reported by the component.
 func (obj *Object) Create(ctx *Context) *Object {
+	obj.assertLive()
 	if C.objectIsComponent(obj.addr) == 0 {
 		panic("object is not a component")
 	}
-	var root Object
-	root.engine = obj.engine
+	if ctx != nil {
+		ctx.assertValid()
+	}
+	var root *Object
+	var err error
 	gui(func() {
 		ctxaddr := nilPtr
 		if ctx != nil {
 			ctxaddr = ctx.obj.addr
 		}
-		root.addr = C.componentCreate(obj.addr, ctxaddr)
+		addr := C.componentCreate(obj.addr, ctxaddr)
+		if addr == nilPtr {
+			err = createError(obj.addr)
+			return
+		}
+		root = wrapObject(addr, obj.engine)
+		ownObject(root)
+		ctx.scope(addr)
 	})
-	return &root
+	if err != nil {
+		panic(err.Error())
+	}
+	return root
+}
+
+// createError returns an error describing why an instance of the
+// component at addr could not be created.
+//
+// This must be run from the main GUI thread.
+func createError(addr unsafe.Pointer) error {
+	if err := componentError(addr); err != nil {
+		return fmt.Errorf("cannot create component instance: %v", err)
+	}
+	return errors.New("cannot create component instance")
 }
 
 // CreateWindow creates a new instance of the component held by obj,
@@ -467,12 +2352,19 @@ func (obj *Object) Create(ctx *Context) *Object {
 // it runs under the same context as obj.
 //
 // The CreateWindow method panics if called on an object that
-// does not represent a QML component.
+// does not represent a QML component, or if the component instance
+// cannot be created. In the latter case the panic message holds the
+// errors reported by the component.
 func (obj *Object) CreateWindow(ctx *Context) *Window {
+	obj.assertLive()
 	if C.objectIsComponent(obj.addr) == 0 {
 		panic("object is not a component")
 	}
+	if ctx != nil {
+		ctx.assertValid()
+	}
 	var win Window
+	var err error
 	win.obj.engine = obj.engine
 	gui(func() {
 		ctxaddr := nilPtr
@@ -480,30 +2372,258 @@ func (obj *Object) CreateWindow(ctx *Context) *Window {
 			ctxaddr = ctx.obj.addr
 		}
 		win.obj.addr = C.componentCreateView(obj.addr, ctxaddr)
+		if win.obj.addr == nilPtr {
+			err = createError(obj.addr)
+		} else {
+			windows = append(windows, &win)
+			ownObject(wrapObject(win.obj.addr, obj.engine))
+			ctx.scope(win.obj.addr)
+		}
 	})
+	if err != nil {
+		panic(err.Error())
+	}
 	return &win
 }
 
+// FocusReason describes why an item obtained focus.
+type FocusReason int
+
+const (
+	MouseFocusReason FocusReason = iota
+	TabFocusReason
+	BacktabFocusReason
+	ActiveWindowFocusReason
+	PopupFocusReason
+	ShortcutFocusReason
+	MenuBarFocusReason
+	OtherFocusReason
+)
+
+// HasFocus returns whether obj is a visual item holding active focus.
+func (obj *Object) HasFocus() bool {
+	obj.assertLive()
+	var focus C.int
+	gui(func() {
+		focus = C.itemHasFocus(obj.addr)
+	})
+	return focus != 0
+}
+
+// ForceFocus gives active focus to the visual item obj, and to the
+// focus scopes enclosing it, as done by forceActiveFocus in QML.
+// ForceFocus returns an error if obj is not a visual item, or if it
+// is disabled or invisible and thus cannot hold focus. With Qt 5.0,
+// the reason is not reported to the item.
+func (obj *Object) ForceFocus(reason FocusReason) error {
+	obj.assertLive()
+	var result C.int
+	gui(func() {
+		result = C.itemForceFocus(obj.addr, C.int(reason))
+	})
+	switch result {
+	case C.FocusNotItem:
+		return fmt.Errorf("cannot focus object: not a visual item")
+	case C.FocusDisabled:
+		return fmt.Errorf("cannot focus disabled item")
+	case C.FocusInvisible:
+		return fmt.Errorf("cannot focus invisible item")
+	}
+	return nil
+}
+
+// MapToScene maps the point at x and y in the coordinate system of the
+// visual item obj into the coordinate system of the scene it's in, which
+// is the content of its window. MapToScene panics if obj is not a
+// visual item.
+func (obj *Object) MapToScene(x, y float64) (sceneX, sceneY float64) {
+	obj.assertLive()
+	var ok C.int
+	var cx, cy C.double
+	gui(func() {
+		ok = C.itemMapToScene(obj.addr, C.double(x), C.double(y), &cx, &cy)
+	})
+	if ok == 0 {
+		panic("cannot map point to scene: object is not a visual item")
+	}
+	return float64(cx), float64(cy)
+}
+
+// MapFromScene maps the point at sceneX and sceneY in the coordinate
+// system of the scene the visual item obj is in into the coordinate
+// system of obj. MapFromScene panics if obj is not a visual item.
+func (obj *Object) MapFromScene(sceneX, sceneY float64) (x, y float64) {
+	obj.assertLive()
+	var ok C.int
+	var cx, cy C.double
+	gui(func() {
+		ok = C.itemMapFromScene(obj.addr, C.double(sceneX), C.double(sceneY), &cx, &cy)
+	})
+	if ok == 0 {
+		panic("cannot map point from scene: object is not a visual item")
+	}
+	return float64(cx), float64(cy)
+}
+
+// Geometry returns the x, y, width, and height properties of the visual
+// item obj, relative to its parent item, with a single trip into the main
+// GUI thread. Geometry panics if obj is not a visual item.
+func (obj *Object) Geometry() (x, y, width, height float64) {
+	obj.assertLive()
+	var ok C.int
+	var cx, cy, cw, ch C.double
+	gui(func() {
+		ok = C.itemGeometry(obj.addr, &cx, &cy, &cw, &ch)
+	})
+	if ok == 0 {
+		panic("cannot get geometry of object: not a visual item")
+	}
+	return float64(cx), float64(cy), float64(cw), float64(ch)
+}
+
+// SetGeometry sets the x, y, width, and height properties of the visual
+// item obj with a single trip into the main GUI thread, breaking any
+// bindings these properties had. SetGeometry panics if obj is not a
+// visual item.
+func (obj *Object) SetGeometry(x, y, width, height float64) {
+	obj.assertLive()
+	var ok C.int
+	gui(func() {
+		ok = C.itemSetGeometry(obj.addr, C.double(x), C.double(y), C.double(width), C.double(height))
+	})
+	if ok == 0 {
+		panic("cannot set geometry of object: not a visual item")
+	}
+}
+
+// SetParentItem makes the visual item obj a child of the visual item
+// parent, so that it's shown within parent at a position relative to it,
+// as if obj was declared within parent in a QML document. Like items
+// declared in documents, obj is also owned by parent from then on, and is
+// destroyed with it. If parent is nil, obj is removed from the scene and
+// is owned by nobody, so it must be destroyed via its Destroy method.
+//
+// SetParentItem returns an error if obj or parent are not visual items.
+func (obj *Object) SetParentItem(parent *Object) error {
+	obj.assertLive()
+	paddr := nilPtr
+	if parent != nil {
+		parent.assertLive()
+		paddr = parent.addr
+	}
+	var ok C.int
+	gui(func() {
+		ok = C.itemSetParentItem(obj.addr, paddr)
+	})
+	if ok == 0 {
+		return fmt.Errorf("cannot set parent item: object is not a visual item")
+	}
+	return nil
+}
+
 // Destroy finalizes the value and releases any resources used.
-// The value must not be used after calling this method.
+// The value must not be used after calling this method, and the methods
+// of obj panic if it is. Destroy has no effect if the engine obj was
+// obtained from is already destroyed, or if obj was already destroyed
+// by QML itself.
 func (obj *Object) Destroy() {
-	// TODO We might hook into the destroyed signal, and prevent this object
-	//      from being used in post-destruction crash-prone ways.
 	gui(func() {
+		if obj.engine != nil && obj.engine.isDestroyed() || atomic.LoadInt32(&obj.destroyed) != 0 {
+			// Destroyed with the engine or by QML.
+			obj.addr = nilPtr
+		}
 		if obj.addr != nilPtr {
 			C.delObjectLater(obj.addr)
 			obj.addr = nilPtr
 		}
+		atomic.StoreInt32(&obj.destroyed, 1)
+	})
+}
+
+// Ownership defines whether an object is destroyed by the JavaScript
+// garbage collector once QML code does not reference it anymore.
+type Ownership int
+
+// The values match the respective QQmlEngine::ObjectOwnership values.
+const (
+	// CppOwnership leaves the object alive until it is explicitly
+	// destroyed, such as via Object.Destroy, or by its parent object.
+	CppOwnership Ownership = 0
+
+	// JsOwnership lets the JavaScript garbage collector destroy the
+	// object once it has no parent and is not referenced by QML code.
+	JsOwnership Ownership = 1
+)
+
+// SetOwnership defines whether obj may be destroyed by the JavaScript
+// garbage collector, as done by QQmlEngine::setObjectOwnership.
+//
+// Objects created by QML code without a parent, such as via the
+// createObject method of components, are owned by JavaScript. When such
+// objects are obtained via Object.Property or Object.Call, they are
+// switched to CppOwnership so that the garbage collector does not
+// destroy them while Go still holds them. These objects must be
+// destroyed via Object.Destroy, or handed back to the garbage collector
+// with JsOwnership, once Go does not need them anymore. Objects handed
+// back are not switched to CppOwnership again.
+//
+// Using an object after it was destroyed panics, whoever destroyed it.
+func (obj *Object) SetOwnership(ownership Ownership) {
+	obj.assertLive()
+	gui(func() {
+		C.objectSetOwnership(obj.addr, C.int(ownership))
+		objectsMutex.Lock()
+		if ownership == JsOwnership {
+			jsHandedOver[obj.addr] = true
+		} else {
+			delete(jsHandedOver, obj.addr)
+		}
+		objectsMutex.Unlock()
 	})
 }
 
-// TODO Object.Connect(name, func(...) {})
+// Ownership returns whether obj may be destroyed by the JavaScript
+// garbage collector. See SetOwnership.
+func (obj *Object) Ownership() Ownership {
+	obj.assertLive()
+	var ownership Ownership
+	gui(func() {
+		ownership = Ownership(C.objectOwnership(obj.addr))
+	})
+	return ownership
+}
 
-// TODO Signal emitting support for go values.
+// pinDataValue switches the object in dvalue, if any, to CppOwnership
+// if it's owned by JavaScript and has no parent, so that it is not
+// destroyed by the garbage collector while held by Go, unless it was
+// explicitly handed over via SetOwnership.
+//
+// This must be run from the main GUI thread.
+func pinDataValue(dvalue *C.DataValue) {
+	if dvalue.dataType != C.DTObject {
+		return
+	}
+	addr := *(*unsafe.Pointer)(unsafe.Pointer(&dvalue.data))
+	objectsMutex.Lock()
+	handedOver := jsHandedOver[addr]
+	objectsMutex.Unlock()
+	if !handedOver {
+		C.objectPinOwnership(addr)
+	}
+}
 
 // Window represents a QML window where components are rendered.
 type Window struct {
 	obj Object
+
+	// Only accessed from the main GUI thread.
+	group string
+
+	// clickThrough and inputRegionEmpty hold what was requested via
+	// SetClickThrough and SetInputRegion, which both map onto the
+	// same window flag. Only accessed from the main GUI thread.
+	clickThrough     bool
+	inputRegionEmpty bool
 }
 
 // Show exposes the window.
@@ -522,91 +2642,1175 @@ func (win *Window) Hide() {
 
 // Root returns the root object being rendered in the window.
 func (win *Window) Root() *Object {
-	var obj Object
-	obj.engine = win.obj.engine
+	var addr unsafe.Pointer
 	gui(func() {
-		obj.addr = C.viewRootObject(win.obj.addr)
+		addr = C.viewRootObject(win.obj.addr)
 	})
-	return &obj
+	return wrapObject(addr, win.obj.engine)
 }
 
-// Wait blocks the current goroutine until the window is closed.
+// Wait blocks the current goroutine until the window is closed. Any
+// number of goroutines may wait for the same window, and all of them
+// are released together when the window is hidden, or when either the
+// window or its engine is destroyed. Wait returns immediately if the
+// window is not visible or was already destroyed.
 func (win *Window) Wait() {
-	// XXX Test this.
-	var m sync.Mutex
-	m.Lock()
+	var done chan bool
 	gui(func() {
-		// TODO Must be able to wait for the same Window from multiple goroutines.
-		// TODO If the window is not visible, must return immediately.
-		waitingWindows[win.obj.addr] = &m
-		C.viewConnectHidden(win.obj.addr)
+		if win.obj.addr == nilPtr || win.obj.engine != nil && win.obj.engine.isDestroyed() {
+			return
+		}
+		if C.viewIsVisible(win.obj.addr) == 0 {
+			return
+		}
+		watch := win.watch()
+		if watch.waiters == nil {
+			watch.waiters = make(chan bool)
+		}
+		done = watch.waiters
 	})
-	m.Lock()
+	if done != nil {
+		assertMayBlock("wait for window")
+		<-done
+	}
 }
 
-// Destroy destroys the window.
-// The window should not be used after this method is called.
-func (win *Window) Destroy() {
-	win.obj.Destroy()
+// CloseEvent is provided to the functions registered via Window.OnClosing
+// when the user attempts to close a window.
+type CloseEvent struct {
+	ignored bool
 }
 
-var waitingWindows = make(map[unsafe.Pointer]*sync.Mutex)
+// Ignore prevents the window from being closed.
+func (ev *CloseEvent) Ignore() {
+	ev.ignored = true
+}
 
-//export hookWindowHidden
-func hookWindowHidden(addr unsafe.Pointer) {
-	m, ok := waitingWindows[addr]
-	if !ok {
-		panic("window is not waiting")
+// OnClosing arranges for f to be called whenever the user attempts to
+// close the window, such as via the close button of its title bar, so
+// that the close may be prevented by calling Ignore on the provided
+// event, for example to ask whether unsaved changes should be saved.
+// All registered functions are called in registration order, and the
+// window is closed unless any of them ignores the event.
+//
+// Since the close must be decided while the event is processed, f is
+// called in the main GUI thread, so it must not block. It may call any
+// function of the qml package, though, and it may show a dialog and
+// hide the window later on, for example.
+func (win *Window) OnClosing(f func(ev *CloseEvent)) {
+	gui(func() {
+		watch := win.watch()
+		watch.closing = append(watch.closing, f)
+	})
+}
+
+// OnHide arranges for f to be called in a goroutine owned by the package
+// whenever the window is hidden, including when it is closed by the user,
+// so that application state may be persisted, for example. Functions are
+// called in registration order, one at a time. See the Callbacks section
+// of the package documentation.
+func (win *Window) OnHide(f func()) {
+	gui(func() {
+		watch := win.watch()
+		watch.hide = append(watch.hide, f)
+	})
+}
+
+// SetInputRegion restricts the area of the window that receives mouse
+// and touch input to the provided rectangles, in window coordinates,
+// so that input elsewhere reaches whatever is below the window. The
+// region may be changed at any time, for example to follow the layout
+// of the QML content. An empty slice makes the whole window transparent
+// for input, as done by SetClickThrough, and a nil slice removes the
+// restriction. Neither affects the setting made via SetClickThrough.
+//
+// The region is enforced by the window system as a window mask, so
+// content outside of it may not be painted on some platforms.
+func (win *Window) SetInputRegion(rects []image.Rectangle) {
+	crects := make([]C.int, len(rects)*4+1)
+	for i, r := range rects {
+		r = r.Canon()
+		crects[i*4+0] = C.int(r.Min.X)
+		crects[i*4+1] = C.int(r.Min.Y)
+		crects[i*4+2] = C.int(r.Dx())
+		crects[i*4+3] = C.int(r.Dy())
 	}
-	delete(waitingWindows, addr)
-	m.Unlock()
+	gui(func() {
+		C.viewSetMask(win.obj.addr, &crects[0], C.int(len(rects)))
+		win.inputRegionEmpty = rects != nil && len(rects) == 0
+		win.updateTransparentForInput()
+	})
 }
 
-type TypeSpec struct {
-	Location     string
-	Major, Minor int
-	// TODO Consider refactoring this type into ModuleSpec for the above + []TypeSpec for the below
-	Name string
-	New  func() interface{}
+// SetClickThrough defines whether the whole window is transparent for
+// mouse and touch input, which then reaches whatever is below the window.
+// The setting is independent from the region set via SetInputRegion, so
+// changing the region doesn't enable or disable it.
+func (win *Window) SetClickThrough(enabled bool) {
+	gui(func() {
+		win.clickThrough = enabled
+		win.updateTransparentForInput()
+	})
 }
 
-var types []*TypeSpec
+// updateTransparentForInput makes the window transparent for input if
+// either SetClickThrough or SetInputRegion requested it.
+//
+// This must be run from the main GUI thread.
+func (win *Window) updateTransparentForInput() {
+	transparent := C.int(0)
+	if win.clickThrough || win.inputRegionEmpty {
+		transparent = 1
+	}
+	C.viewSetTransparentForInput(win.obj.addr, transparent)
+}
 
-func RegisterType(spec *TypeSpec) error {
-	return registerType(spec, false)
+// isTransparentForInput returns whether the window is currently
+// transparent for input.
+func (win *Window) isTransparentForInput() bool {
+	var transparent bool
+	gui(func() {
+		transparent = C.viewTransparentForInput(win.obj.addr) != 0
+	})
+	return transparent
 }
 
-func RegisterSingleton(spec *TypeSpec) error {
-	return registerType(spec, true)
+// SetTitle sets the title of the window.
+func (win *Window) SetTitle(title string) {
+	ctitle, ctitleLen := unsafeStringData(title)
+	gui(func() {
+		C.viewSetTitle(win.obj.addr, ctitle, ctitleLen)
+	})
+}
+
+// Title returns the title of the window.
+func (win *Window) Title() string {
+	var title string
+	gui(func() {
+		ctitle := C.viewTitle(win.obj.addr)
+		title = C.GoString(ctitle)
+		C.free(unsafe.Pointer(ctitle))
+	})
+	return title
+}
+
+// SetPosition moves the window so that the top left corner of its
+// content area, excluding the window frame, is at (x, y) on the screen.
+func (win *Window) SetPosition(x, y int) {
+	gui(func() {
+		C.viewSetPosition(win.obj.addr, C.int(x), C.int(y))
+	})
 }
 
-func registerType(spec *TypeSpec, singleton bool) error {
-	// Copy and hold a reference to the spec data.
-	localSpec := *spec
+// Position returns the position of the top left corner of the window
+// content area on the screen.
+func (win *Window) Position() (x, y int) {
+	var cx, cy C.int
+	gui(func() {
+		C.viewPosition(win.obj.addr, &cx, &cy)
+	})
+	return int(cx), int(cy)
+}
 
-	// TODO Validate localSpec fields.
+// SetSize resizes the content area of the window, excluding the window
+// frame. The root object of the window is resized along with it.
+func (win *Window) SetSize(width, height int) {
+	gui(func() {
+		C.viewSetSize(win.obj.addr, C.int(width), C.int(height))
+	})
+}
 
-	var err error
+// Size returns the size of the content area of the window.
+func (win *Window) Size() (width, height int) {
+	var cwidth, cheight C.int
 	gui(func() {
-		sample := spec.New()
-		if sample == nil {
-			err = fmt.Errorf("TypeSpec.New for type %q returned nil", spec.Name)
-			return
-		}
+		C.viewSize(win.obj.addr, &cwidth, &cheight)
+	})
+	return int(cwidth), int(cheight)
+}
 
-		cloc := C.CString(localSpec.Location)
-		cname := C.CString(localSpec.Name)
-		if singleton {
-			C.registerSingleton(cloc, C.int(localSpec.Major), C.int(localSpec.Minor), cname, typeInfo(sample), unsafe.Pointer(&localSpec))
-		} else {
-			C.registerType(cloc, C.int(localSpec.Major), C.int(localSpec.Minor), cname, typeInfo(sample), unsafe.Pointer(&localSpec))
-		}
-		// TODO Check if qmlRegisterType keeps a reference to those.
-		//C.free(unsafe.Pointer(cloc))
-		//C.free(unsafe.Pointer(cname))
-		types = append(types, &localSpec)
+// SetMinimumSize sets the size the user may not shrink the window below.
+func (win *Window) SetMinimumSize(width, height int) {
+	gui(func() {
+		C.viewSetMinimumSize(win.obj.addr, C.int(width), C.int(height))
 	})
+}
 
-	// TODO Are there really no errors possible from qmlRegisterType?
-	return err
+// MinimumSize returns the minimum size of the window.
+func (win *Window) MinimumSize() (width, height int) {
+	var cwidth, cheight C.int
+	gui(func() {
+		C.viewMinimumSize(win.obj.addr, &cwidth, &cheight)
+	})
+	return int(cwidth), int(cheight)
+}
+
+// SetMaximumSize sets the size the user may not grow the window beyond.
+func (win *Window) SetMaximumSize(width, height int) {
+	gui(func() {
+		C.viewSetMaximumSize(win.obj.addr, C.int(width), C.int(height))
+	})
+}
+
+// MaximumSize returns the maximum size of the window.
+func (win *Window) MaximumSize() (width, height int) {
+	var cwidth, cheight C.int
+	gui(func() {
+		C.viewMaximumSize(win.obj.addr, &cwidth, &cheight)
+	})
+	return int(cwidth), int(cheight)
+}
+
+// WindowState describes how a window is shown on the screen.
+type WindowState int
+
+const (
+	NormalState WindowState = iota
+	MinimizedState
+	MaximizedState
+	FullScreenState
+)
+
+// SetState changes how the window is shown on the screen. When called
+// before the window is shown, the state is applied once it is shown.
+func (win *Window) SetState(state WindowState) {
+	gui(func() {
+		C.viewSetState(win.obj.addr, C.int(state))
+	})
+}
+
+// State returns how the window is shown on the screen.
+func (win *Window) State() WindowState {
+	var state C.int
+	gui(func() {
+		state = C.viewState(win.obj.addr)
+	})
+	return WindowState(state)
+}
+
+// WindowFlags holds hints about how the window system should present
+// a window.
+type WindowFlags int
+
+const (
+	// FramelessWindow shows the window without the frame and title bar
+	// provided by the window system.
+	FramelessWindow WindowFlags = 1 << iota
+
+	// StaysOnTopWindow keeps the window above all other windows.
+	StaysOnTopWindow
+
+	// StaysOnBottomWindow keeps the window below all other windows.
+	StaysOnBottomWindow
+)
+
+// SetFlags changes the hints about how the window system should present
+// the window. Some window systems only take changed hints into account
+// when the window is shown again.
+func (win *Window) SetFlags(flags WindowFlags) {
+	gui(func() {
+		C.viewSetFlags(win.obj.addr, C.int(flags))
+	})
+}
+
+// Flags returns the hints about how the window system should present
+// the window.
+func (win *Window) Flags() WindowFlags {
+	var flags C.int
+	gui(func() {
+		flags = C.viewFlags(win.obj.addr)
+	})
+	return WindowFlags(flags)
+}
+
+// OnFirstFrame arranges for f to be called in a goroutine owned by the
+// package once the first frame of the window is presented, which is
+// useful for measuring the perceived startup time of applications. Each
+// provided function is called only once, even if the window is hidden
+// and shown again, and is called right away if the first frame was
+// already presented. Functions pending when the window is destroyed are
+// never called.
+func (win *Window) OnFirstFrame(f func()) {
+	gui(func() {
+		if C.viewFirstFramePresented(win.obj.addr) != 0 {
+			(&callbackQueue{}).dispatch(f)
+			return
+		}
+		firstFrameHandlers[win.obj.addr] = append(firstFrameHandlers[win.obj.addr], f)
+	})
+}
+
+// ShowWhenReady exposes the window, as done by Show, but keeps it fully
+// transparent until its first frame is presented, so that the user does
+// not see a blank window while the content is being prepared.
+//
+// Window opacity is not supported by Qt 5.0 and by some window systems,
+// in which case the window is shown right away.
+func (win *Window) ShowWhenReady() {
+	gui(func() {
+		C.viewShowWhenReady(win.obj.addr)
+	})
+}
+
+// Snapshot returns the content currently rendered in the window. The
+// image holds the full pixel buffer of the window, so on high density
+// displays it is larger than the logical size reported by Size.
+//
+// Hidden windows are rendered offscreen for the snapshot where Qt
+// supports it. An error is returned if the window was destroyed or if
+// nothing could be rendered.
+func (win *Window) Snapshot() (image.Image, error) {
+	var img image.Image
+	var err error
+	gui(func() {
+		if win.obj.addr == nilPtr || win.obj.engine != nil && win.obj.engine.isDestroyed() {
+			err = errors.New("cannot snapshot window: window was destroyed")
+			return
+		}
+		var bits *C.uchar
+		var width, height, stride C.int
+		qimage := C.viewGrabWindow(win.obj.addr, &bits, &width, &height, &stride)
+		defer C.delImage(qimage)
+		if width == 0 || height == 0 {
+			err = errors.New("cannot snapshot window: nothing was rendered")
+			return
+		}
+		img = copyImage(unsafe.Pointer(bits), int(width), int(height), int(stride))
+	})
+	return img, err
+}
+
+// SnapshotEncoded returns the content currently rendered in the window as
+// done by Snapshot, but encoded by Qt in the named format, such as "png"
+// or "jpg", which is considerably cheaper than encoding the image
+// returned by Snapshot when the snapshot is to be written out as is:
+//
+//     data, err := win.SnapshotEncoded("png", -1)
+//     if err == nil {
+//         err = ioutil.WriteFile("window.png", data, 0644)
+//     }
+//
+// The quality ranges from 0, for the smallest output, to 100, for the
+// best quality, and -1 selects the default of the format. An error
+// listing the available formats is returned if the format cannot be
+// encoded. See ImageFormats.
+func (win *Window) SnapshotEncoded(format string, quality int) ([]byte, error) {
+	if quality < -1 || quality > 100 {
+		return nil, fmt.Errorf("cannot snapshot window: invalid quality %d", quality)
+	}
+	format = strings.ToLower(format)
+	if err := checkImageFormat(format, true); err != nil {
+		return nil, fmt.Errorf("cannot snapshot window: %v", err)
+	}
+	cformat := C.CString(format)
+	defer C.free(unsafe.Pointer(cformat))
+	var data []byte
+	var err error
+	gui(func() {
+		if win.obj.addr == nilPtr || win.obj.engine != nil && win.obj.engine.isDestroyed() {
+			err = errors.New("cannot snapshot window: window was destroyed")
+			return
+		}
+		var cdata *C.char
+		var cdatalen C.int
+		switch C.viewGrabWindowEncoded(win.obj.addr, cformat, C.int(quality), &cdata, &cdatalen) {
+		case C.EncodeEmpty:
+			err = errors.New("cannot snapshot window: nothing was rendered")
+		case C.EncodeFailed:
+			err = fmt.Errorf("cannot snapshot window: cannot encode image as %q", format)
+		default:
+			data = C.GoBytes(unsafe.Pointer(cdata), cdatalen)
+			C.free(unsafe.Pointer(cdata))
+		}
+	})
+	return data, err
+}
+
+// ErrUnsupported is returned when the requested functionality is not
+// supported by the Qt version or scene graph backend in use, or by the
+// platform, such as when it has no system tray.
+var ErrUnsupported = errors.New("not supported by the Qt version or scene graph backend in use")
+
+// SceneStats holds statistics about the scene rendered in a window.
+type SceneStats struct {
+	// Items is the number of visual items in the window.
+	Items int
+
+	// Nodes is the number of scene graph nodes, and TextureBytes the
+	// approximate memory used by textures, or -1 when unknown.
+	Nodes        int
+	TextureBytes int64
+}
+
+// SceneStats returns statistics about the scene rendered in the window.
+// The item count is always reported. If the scene graph backend does not
+// report the other statistics, they are set to -1 and ErrUnsupported is
+// returned together with the item count, so that unknown statistics are
+// not mistaken for zero. The scene graph renderers of the Qt versions
+// supported so far do not report them.
+func (win *Window) SceneStats() (SceneStats, error) {
+	var stats SceneStats
+	var supported C.int
+	gui(func() {
+		var items, nodes C.int
+		var textureBytes C.longlong
+		supported = C.viewSceneStats(win.obj.addr, &items, &nodes, &textureBytes)
+		stats = SceneStats{int(items), int(nodes), int64(textureBytes)}
+	})
+	if supported == 0 {
+		return stats, ErrUnsupported
+	}
+	return stats, nil
+}
+
+// SetStatsOverlay enables or disables the overlay showing the render
+// statistics of the scene graph on top of the window content, or returns
+// ErrUnsupported if the scene graph backend does not offer it, as is the
+// case with the Qt versions supported so far.
+func (win *Window) SetStatsOverlay(enabled bool) error {
+	return ErrUnsupported
+}
+
+// FocusedObject returns the item with active focus in the window, or
+// nil if no item has it or the window itself is not active.
+func (win *Window) FocusedObject() *Object {
+	var obj *Object
+	gui(func() {
+		if addr := C.viewActiveFocusItem(win.obj.addr); addr != nilPtr {
+			obj = wrapObject(addr, win.obj.engine)
+		}
+	})
+	return obj
+}
+
+// OnFocusChanged arranges for f to be called in a goroutine owned by
+// the package whenever the item with active focus in the window changes,
+// with the items that lost and gained it, one change at a time and in
+// the order the changes happened. Either of them is nil when the window
+// had or has no focused item, including when the window itself is
+// deactivated or activated.
+//
+// Focus changes are only reported with Qt 5.1 or later.
+func (win *Window) OnFocusChanged(f func(old, new *Object)) {
+	gui(func() {
+		watch, ok := focusWatches[win.obj.addr]
+		if !ok {
+			watch = &focusWatch{engine: win.obj.engine}
+			focusWatches[win.obj.addr] = watch
+			C.viewConnectFocusChanged(win.obj.addr)
+		}
+		watch.handlers = append(watch.handlers, f)
+	})
+}
+
+// MoveItem moves the visual item into the content of targetWindow, at
+// the x and y position relative to the window, so that parts of the
+// interface such as detachable panels may be moved across windows.
+// Mouse grabs and active focus held by the item in its previous window
+// are released, and the item remains a child of targetWindow until it is
+// moved again, so it is not destroyed together with its previous window.
+// Connections established via Object.Connect and values held by the
+// item are preserved, and moving the item back works the same way.
+//
+// MoveItem returns an error if item is not a visual item, or if it was
+// created by an engine other than the one of targetWindow.
+func MoveItem(item *Object, targetWindow *Window, x, y float64) error {
+	if item.engine != targetWindow.obj.engine {
+		return fmt.Errorf("cannot move item to a window of a different engine")
+	}
+	var result C.int
+	gui(func() {
+		result = C.itemMoveToView(item.addr, targetWindow.obj.addr, C.double(x), C.double(y))
+	})
+	switch result {
+	case C.MoveNotItem:
+		return fmt.Errorf("cannot move object to a window: not a visual item")
+	case C.MoveOtherEngine:
+		return fmt.Errorf("cannot move item to a window of a different engine")
+	}
+	return nil
+}
+
+// Destroy destroys the window.
+// The window should not be used after this method is called.
+func (win *Window) Destroy() {
+	gui(func() {
+		releaseWindowWaiters(win.obj.addr)
+		forgetWindow(win)
+		resumeUpdates(win.obj.addr)
+		win.obj.Destroy()
+	})
+}
+
+// windowWatch holds the goroutines and functions observing whether a
+// window is closed, and the engine of the window.
+type windowWatch struct {
+	engine  *Engine
+	waiters chan bool
+	closing []func(ev *CloseEvent)
+	hide    []func()
+	queue   callbackQueue
+}
+
+var windowWatches = make(map[unsafe.Pointer]*windowWatch)
+
+// watch returns the watch for win, creating it if necessary.
+//
+// This must be run from the main GUI thread.
+func (win *Window) watch() *windowWatch {
+	watch, ok := windowWatches[win.obj.addr]
+	if !ok {
+		watch = &windowWatch{engine: win.obj.engine}
+		windowWatches[win.obj.addr] = watch
+		C.viewWatch(win.obj.addr)
+	}
+	return watch
+}
+
+// releaseWindowWaiters releases the goroutines waiting for the window
+// at addr, if any.
+//
+// This must be run from the main GUI thread.
+func releaseWindowWaiters(addr unsafe.Pointer) {
+	if watch, ok := windowWatches[addr]; ok && watch.waiters != nil {
+		close(watch.waiters)
+		watch.waiters = nil
+	}
+}
+
+//export hookWindowHidden
+func hookWindowHidden(addr unsafe.Pointer) {
+	if !onGuiThread("hookWindowHidden") {
+		gui(func() { hookWindowHidden(addr) })
+		return
+	}
+	watch, ok := windowWatches[addr]
+	if !ok {
+		return
+	}
+	releaseWindowWaiters(addr)
+	for _, f := range watch.hide {
+		watch.queue.dispatch(f)
+	}
+}
+
+//export hookWindowClosing
+func hookWindowClosing(addr unsafe.Pointer) C.int {
+	if !onGuiThread("hookWindowClosing") {
+		var accept C.int
+		gui(func() { accept = hookWindowClosing(addr) })
+		return accept
+	}
+	watch, ok := windowWatches[addr]
+	if !ok {
+		return 1
+	}
+	ev := &CloseEvent{}
+	for _, f := range watch.closing {
+		f(ev)
+	}
+	if ev.ignored {
+		return 0
+	}
+	return 1
+}
+
+//export hookWindowUnwatched
+func hookWindowUnwatched(addr unsafe.Pointer) {
+	if !onGuiThread("hookWindowUnwatched") {
+		gui(func() { hookWindowUnwatched(addr) })
+		return
+	}
+	releaseWindowWaiters(addr)
+	delete(windowWatches, addr)
+}
+
+// focusWatch holds the functions called when the focused item of a
+// window changes, and the engine of the window items.
+type focusWatch struct {
+	engine   *Engine
+	handlers []func(old, new *Object)
+	queue    callbackQueue
+}
+
+var focusWatches = make(map[unsafe.Pointer]*focusWatch)
+
+//export hookWindowFocusChanged
+func hookWindowFocusChanged(addr, oldAddr, newAddr unsafe.Pointer) {
+	if !onGuiThread("hookWindowFocusChanged") {
+		gui(func() { hookWindowFocusChanged(addr, oldAddr, newAddr) })
+		return
+	}
+	watch, ok := focusWatches[addr]
+	if !ok {
+		return
+	}
+	var old, new *Object
+	if oldAddr != nilPtr {
+		old = wrapObject(oldAddr, watch.engine)
+	}
+	if newAddr != nilPtr {
+		new = wrapObject(newAddr, watch.engine)
+	}
+	for _, f := range watch.handlers {
+		f := f
+		watch.queue.dispatch(func() { f(old, new) })
+	}
+}
+
+//export hookWindowFocusDisconnected
+func hookWindowFocusDisconnected(addr unsafe.Pointer) {
+	if !onGuiThread("hookWindowFocusDisconnected") {
+		gui(func() { hookWindowFocusDisconnected(addr) })
+		return
+	}
+	delete(focusWatches, addr)
+}
+
+var firstFrameHandlers = make(map[unsafe.Pointer][]func())
+
+//export hookWindowFirstFrame
+func hookWindowFirstFrame(addr unsafe.Pointer, presented C.int) {
+	if !onGuiThread("hookWindowFirstFrame") {
+		gui(func() { hookWindowFirstFrame(addr, presented) })
+		return
+	}
+	handlers := firstFrameHandlers[addr]
+	delete(firstFrameHandlers, addr)
+	if presented != 0 {
+		queue := &callbackQueue{}
+		for _, f := range handlers {
+			queue.dispatch(f)
+		}
+	}
+}
+
+type TypeSpec struct {
+	Location     string
+	Major, Minor int
+	Name         string
+	New          func() interface{}
+
+	// Singleton defines whether the type is registered as a singleton
+	// by RegisterType and RegisterTypes, as done by RegisterSingleton.
+	Singleton bool
+
+	// Init, if set, is called with each value created via New for QML
+	// and with the object wrapping it, once the object is constructed
+	// and before QML sets its properties and evaluates its bindings, so
+	// that the value may keep the object, connect to its signals, and
+	// allocate resources of its own.
+	//
+	// Destroy, if set, is called with each value created via New for
+	// QML when its object is destroyed, so that the resources held by
+	// the value may be released. The object must not be used anymore
+	// by then.
+	//
+	// Both functions are called in the main GUI thread, so they may
+	// call the methods of Object without deadlocking, but must not
+	// block for long.
+	Init    func(obj *Object, value interface{})
+	Destroy func(value interface{})
+
+	// DependsOn holds the names of the singletons that must be constructed
+	// before this type's values are, as done by Engine.InitializeModules.
+	// Types in other modules are named as "Location.Name".
+	DependsOn []string
+
+	// GLStage defines whether values of types registered with
+	// RegisterGLType are painted after or before the QML scene.
+	GLStage GLStage
+
+	// Focusable defines whether items of types registered with
+	// RegisterPaintedType or RegisterGLType take the keyboard focus
+	// when the tab key is used to move it around, as done by the
+	// activeFocusOnTab property of Item. See KeyEvent.
+	Focusable bool
+
+	// Exposure defines which fields of the type are available to QML,
+	// overriding the policy set via SetExposurePolicy unless it is
+	// DefaultExposure.
+	Exposure ExposurePolicy
+
+	// Async holds the names of the methods of the type that run
+	// asynchronously, ordered as defined by AsyncOrder. See SetTypeAsync.
+	Async      []string
+	AsyncOrder AsyncOrder
+
+	// Enums holds enums made available to QML as attributes of the type,
+	// mapping each enum name to its keys and their values. Enum and key
+	// names must start with an uppercase letter, and keys must be unique
+	// across all the enums of the type, since QML refers to them by the
+	// type name alone:
+	//
+	//     Enums: map[string]map[string]int{
+	//         "State": {"StateIdle": StateIdle, "StateRunning": StateRunning},
+	//     },
+	//
+	// allows QML code to use MyItem.StateRunning. Values must fit in 32 bits.
+	Enums map[string]map[string]int
+
+	kind  typeKind
+	enums string
+
+	// sampleType is the type of the values created via New, and
+	// replacement is the spec set via ReplaceType for the values
+	// created afterwards, if any.
+	sampleType  reflect.Type
+	replacement *TypeSpec
+}
+
+// typeKind defines how a registered type is exposed to QML.
+type typeKind int
+
+const (
+	plainType typeKind = iota
+	singletonType
+	paintedType
+	glType
+)
+
+var types []*TypeSpec
+
+// RegisterType registers the type described by spec with QML, so that
+// QML documents importing the spec.Location module at the spec.Major and
+// spec.Minor version may create values of the type via spec.New.
+//
+// RegisterType returns an error if the spec is invalid, if the same
+// type was registered before with the same location and version, if Qt
+// refuses the registration, or if the module was already imported by a
+// component loaded earlier, since types registered into a module after
+// it is first imported are not seen by Qt. Only components loaded via
+// the Engine methods are considered.
+//
+// Types may be registered before the package is initialized, such as
+// right before calling Main. The registration is then only validated as
+// far as possible without Qt, and completed once the package is
+// initialized, with any errors reported by Init, InitErr, Main, or Run.
+func RegisterType(spec *TypeSpec) error {
+	return registerType(spec, plainType)
+}
+
+func RegisterSingleton(spec *TypeSpec) error {
+	return registerType(spec, singletonType)
+}
+
+// RegisterPaintedType registers a type of visual items which paint their
+// contents via the Paint method of the Go values created by spec.New:
+//
+//     Paint(p *qml.Painter)
+//
+// Paint is called whenever the item needs repainting, such as when it is
+// first shown, when its size changes, and after Update is called with the
+// value. Paint is run while the GUI thread is blocked, and it may run on
+// a different thread, so it may read the value's fields but must not call
+// functions that run on the GUI thread, such as the methods of Object.
+//
+// If the value also has a method
+//
+//     Resized(width, height float64)
+//
+// it is called from the GUI thread whenever the size of the item changes.
+//
+// The item has the properties of Item, such as width and height, besides
+// the ones exposed by the Go value as documented in Context.SetVar. It
+// receives key events while it holds the active focus if the value has
+// KeyPress or KeyRelease methods, as documented in KeyEvent, and mouse
+// and hover events if it has the methods documented in MouseEvent.
+func RegisterPaintedType(spec *TypeSpec) error {
+	return registerType(spec, paintedType)
+}
+
+// RegisterGLType registers a type of visual items which render their
+// contents with OpenGL via the Paint method of the Go values created
+// by spec.New:
+//
+//     Paint(gl *qml.GL)
+//
+// Paint is called with the OpenGL context of the window current whenever
+// the window is rendered, either after or before the QML scene as defined
+// by spec.GLStage, and Update may be called with the value to request
+// the window to be rendered again. Paint must leave the OpenGL state it
+// changes as it found it, as the scene graph depends on it.
+//
+// Paint runs on the rendering thread of the window, concurrently with
+// the GUI thread, so it must not call functions that run on the GUI
+// thread, such as the methods of Object, and data it shares with other
+// goroutines, including the value's fields, must be synchronized.
+//
+// The item has the properties of Item, such as width and height, besides
+// the ones exposed by the Go value as documented in Context.SetVar, and
+// receives key, mouse, and hover events as documented in
+// RegisterPaintedType.
+func RegisterGLType(spec *TypeSpec) error {
+	return registerType(spec, glType)
+}
+
+// RegisterTypes registers the types described by specs with QML in the
+// module at location, with the major and minor version, which override
+// the respective fields of the specs. Types with the Singleton field set
+// are registered as singletons.
+//
+// The specs are all validated before any of them is registered, as done
+// by RegisterType, so if any of them is invalid or conflicts with an
+// existing type, none of them are registered and the returned error names
+// the offending type. Qt may still refuse a registration after the types
+// before it in specs were registered, in which case these remain so.
+func RegisterTypes(location string, major, minor int, specs []TypeSpec) error {
+	batch := make([]*TypeSpec, len(specs))
+	kinds := make([]typeKind, len(specs))
+	for i := range specs {
+		spec := specs[i]
+		spec.Location = location
+		spec.Major = major
+		spec.Minor = minor
+		batch[i] = &spec
+		kinds[i] = plainType
+	}
+	return registerTypes(batch, kinds)
+}
+
+func registerType(spec *TypeSpec, kind typeKind) error {
+	return registerTypes([]*TypeSpec{spec}, []typeKind{kind})
+}
+
+// registerTypes registers specs with the respective kinds, either all
+// or none of them, unless Qt refuses a registration midway.
+func registerTypes(specs []*TypeSpec, kinds []typeKind) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	localSpecs := make([]*TypeSpec, len(specs))
+	for i, spec := range specs {
+		if err := validateSpec(spec); err != nil {
+			return err
+		}
+
+		// Copy and hold a reference to the spec data.
+		localSpec := *spec
+		localSpec.DependsOn = append([]string(nil), spec.DependsOn...)
+		localSpec.kind = kinds[i]
+		if spec.Singleton {
+			switch localSpec.kind {
+			case plainType:
+				localSpec.kind = singletonType
+			case paintedType, glType:
+				return fmt.Errorf("cannot register type %q: visual types cannot be singletons", spec.Name)
+			}
+		}
+		if spec.Focusable && localSpec.kind != paintedType && localSpec.kind != glType {
+			return fmt.Errorf("cannot register type %q: only visual types may be focusable", spec.Name)
+		}
+
+		var err error
+		localSpec.enums, err = encodeEnums(spec)
+		if err != nil {
+			return err
+		}
+		localSpecs[i] = &localSpec
+	}
+
+	return whenInitialized(func() error {
+		var err error
+		gui(func() {
+			// Types are checked as if the previous ones were registered
+			// already, so that duplicates and dependency cycles are found.
+			registered := len(types)
+			samples := make([]interface{}, len(localSpecs))
+			for i, localSpec := range localSpecs {
+				samples[i], err = checkType(localSpec)
+				if err != nil {
+					types = types[:registered]
+					return
+				}
+				localSpec.sampleType = reflect.TypeOf(samples[i])
+				types = append(types, localSpec)
+			}
+			for i, localSpec := range localSpecs {
+				if err = registerSpec(localSpec, samples[i]); err != nil {
+					types = types[:registered+i]
+					return
+				}
+			}
+		})
+		return err
+	})
+}
+
+// checkType returns an error if spec cannot be registered alongside the
+// registered types, or otherwise a sample value created via spec.New.
+//
+// This must be run from the main GUI thread.
+func checkType(spec *TypeSpec) (sample interface{}, err error) {
+	for _, other := range types {
+		if other.Location == spec.Location && other.Major == spec.Major && other.Minor == spec.Minor && other.Name == spec.Name {
+			return nil, fmt.Errorf("type %q is already registered in %s %d.%d", spec.Name, spec.Location, spec.Major, spec.Minor)
+		}
+	}
+	if registeredComponents[fmt.Sprintf("%s %d.%d %s", spec.Location, spec.Major, spec.Minor, spec.Name)] != "" {
+		return nil, fmt.Errorf("type %q is already registered in %s %d.%d", spec.Name, spec.Location, spec.Major, spec.Minor)
+	}
+	if importedModules[spec.Location] {
+		return nil, fmt.Errorf("cannot register type %q: module %s was already imported by a loaded component", spec.Name, spec.Location)
+	}
+	if path := dependencyCycle(spec, spec, nil); path != nil {
+		return nil, fmt.Errorf("type %q has cyclic dependencies: %s", spec.Name, strings.Join(path, " -> "))
+	}
+
+	sample = spec.New()
+	if sample == nil {
+		return nil, fmt.Errorf("TypeSpec.New for type %q returned nil", spec.Name)
+	}
+	if err := checkMemberNames(reflect.TypeOf(sample)); err != nil {
+		return nil, fmt.Errorf("cannot register type %q: %v", spec.Name, err)
+	}
+	if _, ok := sample.(paintedValue); spec.kind == paintedType && !ok {
+		return nil, fmt.Errorf("cannot register painted type %q: %T has no Paint(*qml.Painter) method", spec.Name, sample)
+	}
+	if _, ok := sample.(glValue); spec.kind == glType && !ok {
+		return nil, fmt.Errorf("cannot register GL type %q: %T has no Paint(*qml.GL) method", spec.Name, sample)
+	}
+	return sample, nil
+}
+
+// registerSpec registers spec with Qt, using sample to obtain the
+// type information.
+//
+// This must be run from the main GUI thread.
+func registerSpec(spec *TypeSpec, sample interface{}) error {
+	if spec.Exposure != DefaultExposure {
+		setTypeExposure(reflect.TypeOf(sample), spec.Exposure)
+	}
+	if len(spec.Async) > 0 {
+		setTypeAsync(reflect.TypeOf(sample), spec.AsyncOrder, spec.Async)
+	}
+
+	cloc := C.CString(spec.Location)
+	cname := C.CString(spec.Name)
+	var result C.int
+	switch spec.kind {
+	case singletonType:
+		result = C.registerSingleton(cloc, C.int(spec.Major), C.int(spec.Minor), cname, typeInfo(sample), unsafe.Pointer(spec))
+	case paintedType:
+		result = C.registerPaintedType(cloc, C.int(spec.Major), C.int(spec.Minor), cname, typeInfo(sample), unsafe.Pointer(spec))
+	case glType:
+		result = C.registerGLType(cloc, C.int(spec.Major), C.int(spec.Minor), cname, typeInfo(sample), unsafe.Pointer(spec), C.int(spec.GLStage))
+	default:
+		result = C.registerType(cloc, C.int(spec.Major), C.int(spec.Minor), cname, typeInfo(sample), unsafe.Pointer(spec))
+	}
+	// TODO Check if qmlRegisterType keeps a reference to those.
+	//C.free(unsafe.Pointer(cloc))
+	//C.free(unsafe.Pointer(cname))
+	switch result {
+	case C.RegisterTooMany:
+		return fmt.Errorf("cannot register type %q: too many types registered", spec.Name)
+	case C.RegisterFailed:
+		return fmt.Errorf("cannot register type %q: rejected by Qt (see the logged messages)", spec.Name)
+	}
+	return nil
+}
+
+var locationPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// validateSpec returns an error if spec cannot be registered as a type.
+func validateSpec(spec *TypeSpec) error {
+	if spec.Name == "" {
+		return fmt.Errorf("cannot register type with an empty name")
+	}
+	if !isUpperName(spec.Name) {
+		return fmt.Errorf("cannot register type %q: name must start with an uppercase letter and hold only letters, digits, and underscores", spec.Name)
+	}
+	if !locationPattern.MatchString(spec.Location) {
+		return fmt.Errorf("cannot register type %q: invalid location %q", spec.Name, spec.Location)
+	}
+	if spec.Major < 0 || spec.Minor < 0 {
+		return fmt.Errorf("cannot register type %q: invalid version %d.%d", spec.Name, spec.Major, spec.Minor)
+	}
+	if spec.New == nil {
+		return fmt.Errorf("cannot register type %q: TypeSpec.New is nil", spec.Name)
+	}
+	return nil
+}
+
+// importedModules holds the modules imported by the documents loaded so
+// far, since types registered into them afterwards are not seen by Qt.
+//
+// Only accessed from the main GUI thread.
+var importedModules = make(map[string]bool)
+
+// noteImports records the modules imported by the QML document in data.
+//
+// This must be run from the main GUI thread.
+func noteImports(data []byte) {
+	for _, m := range importPattern.FindAllSubmatch(data, -1) {
+		importedModules[string(m[1])] = true
+	}
+}
+
+// lookupType returns the registered type with the given name, as
+// provided in TypeSpec.DependsOn by a type in the location module.
+//
+// This must be run from the main GUI thread.
+func lookupType(location, name string) *TypeSpec {
+	for _, spec := range types {
+		if typeNamed(spec, location, name) {
+			return spec
+		}
+	}
+	return nil
+}
+
+// typeNamed returns whether spec has the given name, as provided in
+// TypeSpec.DependsOn by a type in the location module.
+func typeNamed(spec *TypeSpec, location, name string) bool {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		location, name = name[:i], name[i+1:]
+	}
+	return spec.Location == location && spec.Name == name
+}
+
+// dependencyCycle returns the path of a dependency cycle from spec back
+// to target, which is being registered, or nil if there isn't one.
+//
+// This must be run from the main GUI thread.
+func dependencyCycle(spec, target *TypeSpec, path []string) []string {
+	path = append(path, spec.Name)
+	for _, name := range spec.DependsOn {
+		if typeNamed(target, spec.Location, name) {
+			return append(path, target.Name)
+		}
+		if dep := lookupType(spec.Location, name); dep != nil {
+			if cycle := dependencyCycle(dep, target, path); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// InitializeModules constructs within e the singletons registered for
+// the modules with the provided locations, or for all modules if none
+// are provided, so that they don't depend on the order in which QML
+// code happens to use them. Singletons are constructed in registration
+// order, except that the ones listed in TypeSpec.DependsOn, including
+// those of other modules, are constructed first.
+//
+// Construction stops at the first singleton that fails to be constructed,
+// and the returned error reports its type name.
+func (e *Engine) InitializeModules(locations ...string) error {
+	var order []*TypeSpec
+	var err error
+	gui(func() {
+		visited := make(map[*TypeSpec]bool)
+		var visit func(spec *TypeSpec)
+		visit = func(spec *TypeSpec) {
+			if visited[spec] || err != nil {
+				return
+			}
+			visited[spec] = true
+			for _, name := range spec.DependsOn {
+				dep := lookupType(spec.Location, name)
+				if dep == nil {
+					err = fmt.Errorf("type %q depends on %q, which is not registered", spec.Name, name)
+					return
+				}
+				visit(dep)
+			}
+			if spec.kind == singletonType {
+				order = append(order, spec)
+			}
+		}
+		for _, spec := range types {
+			if len(locations) == 0 {
+				visit(spec)
+				continue
+			}
+			for _, location := range locations {
+				if spec.Location == location {
+					visit(spec)
+					break
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, spec := range order {
+		if err := e.initializeSingleton(spec); err != nil {
+			return fmt.Errorf("cannot initialize singleton %q: %v", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// initializeSingleton constructs the singleton of spec within e by
+// having QML code refer to it.
+func (e *Engine) initializeSingleton(spec *TypeSpec) error {
+	_, err := e.singletonFold(spec, spec.Major, spec.Minor)
+	return err
+}
+
+// Singleton returns the Go value and the object wrapping it for the
+// singleton registered via RegisterSingleton with the provided module
+// location, version, and name, as seen by QML code running under e.
+// Each engine has its own instance of every singleton, which is
+// constructed on demand as done when QML code first refers to it:
+//
+//     value, obj, err := engine.Singleton("GoExtensions", 1, 0, "Settings")
+//     if err != nil {
+//         return err
+//     }
+//     settings := value.(*Settings)
+//
+// An error is returned if no such singleton was registered, or if it
+// cannot be constructed.
+func (e *Engine) Singleton(location string, major, minor int, name string) (interface{}, *Object, error) {
+	e.assertValid()
+	var spec *TypeSpec
+	gui(func() {
+		for _, s := range types {
+			if s.kind == singletonType && s.Location == location && s.Name == name && s.Major == major && s.Minor <= minor {
+				spec = s
+			}
+		}
+	})
+	if spec == nil {
+		return nil, nil, fmt.Errorf("no singleton %q registered in module %s %d.%d", name, location, major, minor)
+	}
+	fold, err := e.singletonFold(spec, major, minor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot construct singleton %q: %v", name, err)
+	}
+	return fold.gvalue, wrapObject(fold.cvalue, e), nil
+}
+
+// singletonFold returns the fold of the singleton of spec within e,
+// constructing it if necessary by having QML code refer to it.
+func (e *Engine) singletonFold(spec *TypeSpec, major, minor int) (fold *valueFold, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	qml := fmt.Sprintf("import QtQuick 2.0\nimport %s %d.%d\nQtObject { property var singleton: %s }", spec.Location, major, minor, spec.Name)
+	component, err := e.LoadString(spec.Location+"."+spec.Name+".qml", qml)
+	if err != nil {
+		return nil, err
+	}
+	obj := component.Create(nil)
+	defer obj.Destroy()
+	cname := C.CString("singleton")
+	defer C.free(unsafe.Pointer(cname))
+	gui(func() {
+		var dvalue C.DataValue
+		C.objectGetProperty(obj.addr, cname, &dvalue)
+		if dvalue.dataType == C.DTGoAddr {
+			fold = *(**valueFold)(unsafe.Pointer(&dvalue.data))
+		}
+	})
+	if fold == nil {
+		return nil, fmt.Errorf("singleton was not constructed")
+	}
+	return fold, nil
 }
@@ -0,0 +1,121 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/niemeyer/qml/tref"
+)
+
+// LoadFailure describes an element that failed to load its content, as
+// reported by Object.WaitReady.
+type LoadFailure struct {
+	// Class is the name of the C++ class of the element, such as
+	// QQuickImage or QQuickLoader.
+	Class string
+
+	// Name is the object name of the element, if any.
+	Name string
+
+	// Source is the source the element failed to load, if any.
+	Source string
+}
+
+func (f *LoadFailure) Error() string {
+	name := f.Class
+	if f.Name != "" {
+		name += " " + strconv.Quote(f.Name)
+	}
+	if f.Source == "" {
+		return name + " failed to load"
+	}
+	return fmt.Sprintf("%s failed to load %s", name, f.Source)
+}
+
+// LoadFailures holds all the elements that failed to load their content,
+// as returned by Object.WaitReady.
+type LoadFailures []*LoadFailure
+
+func (errs LoadFailures) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readyPollDelay is the delay between the scans made by WaitReady.
+const readyPollDelay = 10 * time.Millisecond
+
+// WaitReady blocks until all the elements under obj that load content
+// asynchronously, such as Image, AnimatedImage, BorderImage, Loader, and
+// FontLoader elements, have either finished loading or failed, so that
+// the content is complete before a window is shown or a snapshot taken:
+//
+//     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//     defer cancel()
+//     if err := obj.WaitReady(ctx); err != nil {
+//         return err
+//     }
+//     img, err := win.Snapshot()
+//
+// Elements are found by following both the children and the visual
+// children of obj, and the tree is scanned again until it remains the
+// same while nothing is loading, so elements created while waiting,
+// such as the content of loaders and of repeaters, are waited on too.
+//
+// If some elements failed to load, a LoadFailures error describing them
+// is returned once all others are done. If ctx is done first, its error
+// is returned instead.
+//
+// WaitReady must not be called from the main GUI thread, as the content
+// could never finish loading.
+func (obj *Object) WaitReady(ctx context.Context) error {
+	obj.assertLive()
+	if tref.Ref() == guiLoopRef {
+		panic("cannot wait for readiness from within the main GUI thread")
+	}
+	lastReport, lastTotal := "", -1
+	for {
+		var report string
+		var total C.int
+		gui(func() {
+			creport := C.objectReadyReport(obj.addr, &total)
+			report = C.GoString(creport)
+			C.free(unsafe.Pointer(creport))
+		})
+		loading := false
+		var failures LoadFailures
+		for _, fields := range splitReport(report, 4) {
+			status, _ := strconv.Atoi(fields[0])
+			switch Status(status) {
+			case StatusLoading:
+				loading = true
+			case StatusError:
+				failures = append(failures, &LoadFailure{Class: fields[1], Name: fields[2], Source: fields[3]})
+			}
+		}
+		if !loading && report == lastReport && int(total) == lastTotal {
+			if len(failures) > 0 {
+				return failures
+			}
+			return nil
+		}
+		lastReport, lastTotal = report, int(total)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyPollDelay):
+		}
+	}
+}
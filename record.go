@@ -0,0 +1,217 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// The input recording format holds a header line with the format version
+// and the window size at the time of the recording, followed by one line
+// per event with the time since the recording started in milliseconds,
+// the event type, position, button, buttons, wheel delta, key, modifiers,
+// and the quoted text of the event:
+//
+//     qml-input 1 640 480
+//     1520 2 120.5 33 1 1 0 0 0 ""
+//     1610 3 120.5 33 1 0 0 0 0 ""
+//     2300 6 0 0 0 0 0 74 0 "J"
+//
+const inputHeader = "qml-input 1"
+
+// ErrReplayStopped is returned by Window.ReplayInput when the replay is
+// interrupted via Window.StopReplay.
+var ErrReplayStopped = errors.New("input replay stopped")
+
+// replayStops holds the channel closed by StopReplay for each window.
+var (
+	replayMutex sync.Mutex
+	replayStops = make(map[unsafe.Pointer]chan bool)
+)
+
+// RecordInput starts writing the mouse, wheel, and key events delivered
+// to the window to w, along with the time they were delivered at, so that
+// the interaction of a user may be replayed via ReplayInput, for example
+// to reproduce a reported problem. Events are written in a goroutine
+// owned by the package, so a slow writer does not block the GUI loop.
+//
+// Recording stops once the returned function is called, which waits for
+// the pending events to be written. Writing stops at the first error
+// returned by w.
+func (win *Window) RecordInput(w io.Writer) (stop func()) {
+	var queue callbackQueue
+	var failed bool
+	write := func(line string) {
+		queue.dispatch(func() {
+			if !failed {
+				_, err := io.WriteString(w, line)
+				failed = err != nil
+			}
+		})
+	}
+
+	width, height := win.Size()
+	write(fmt.Sprintf("%s %d %d\n", inputHeader, width, height))
+	start := time.Now()
+	filter := win.AddEventFilter(func(ev InputEvent) bool {
+		write(fmt.Sprintf("%d %d %g %g %d %d %d %d %d %s\n", time.Since(start)/time.Millisecond,
+			ev.Type, ev.X, ev.Y, ev.Button, ev.Buttons, ev.Delta, ev.Key, ev.Modifiers, strconv.Quote(ev.Text)))
+		return false
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			filter.Remove()
+			done := make(chan bool)
+			queue.dispatch(func() { close(done) })
+			<-done
+		})
+	}
+}
+
+// ReplayInput injects into the window the input events recorded via
+// RecordInput and read from r, with the timing they were recorded with,
+// sped up by the speed factor. Positions are scaled by the difference
+// between the recorded window size and the current one, so replays
+// tolerate minor differences in layout. Touch events are not replayed.
+//
+// ReplayInput blocks until all events are injected, and returns
+// ErrReplayStopped if interrupted via StopReplay. Events are injected as
+// done by PostMouseEvent, so Settle must be called before observing the
+// effects of the last events.
+func (win *Window) ReplayInput(r io.Reader, speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("cannot replay input at speed %g", speed)
+	}
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("cannot replay input: no input recorded")
+	}
+	var recWidth, recHeight int
+	header := strings.TrimPrefix(scanner.Text(), inputHeader+" ")
+	if _, err := fmt.Sscanf(header, "%d %d", &recWidth, &recHeight); err != nil || header == scanner.Text() {
+		return errors.New("cannot replay input: unknown recording format")
+	}
+	width, height := win.Size()
+	scaleX, scaleY := 1.0, 1.0
+	if recWidth > 0 && recHeight > 0 {
+		scaleX = float64(width) / float64(recWidth)
+		scaleY = float64(height) / float64(recHeight)
+	}
+
+	stop := win.replayStop()
+	start := time.Now()
+	for line := 2; scanner.Scan(); line++ {
+		at, ev, err := parseInputEvent(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("cannot replay input: line %d: %v", line, err)
+		}
+		wait := time.Duration(float64(at)/speed) - time.Since(start)
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-stop:
+			return ErrReplayStopped
+		case <-time.After(wait):
+		}
+		ev.X *= scaleX
+		ev.Y *= scaleY
+		if !win.postInputEvent(ev) {
+			return errors.New("cannot replay input: window was destroyed")
+		}
+	}
+	return scanner.Err()
+}
+
+// StopReplay interrupts the replays of input running in the window via
+// ReplayInput, which return ErrReplayStopped.
+func (win *Window) StopReplay() {
+	replayMutex.Lock()
+	if stop, ok := replayStops[win.obj.addr]; ok {
+		close(stop)
+		delete(replayStops, win.obj.addr)
+	}
+	replayMutex.Unlock()
+}
+
+// replayStop returns the channel closed when the replays of the window
+// are stopped.
+func (win *Window) replayStop() chan bool {
+	replayMutex.Lock()
+	defer replayMutex.Unlock()
+	stop, ok := replayStops[win.obj.addr]
+	if !ok {
+		stop = make(chan bool)
+		replayStops[win.obj.addr] = stop
+	}
+	return stop
+}
+
+// parseInputEvent parses a line holding an event recorded by RecordInput,
+// and returns the time it was recorded at and the event.
+func parseInputEvent(line string) (at time.Duration, ev InputEvent, err error) {
+	fields := strings.SplitN(line, " ", 10)
+	if len(fields) != 10 {
+		return 0, ev, fmt.Errorf("expected 10 fields, got %d", len(fields))
+	}
+	var ints [7]int
+	for i, j := range []int{0, 1, 4, 5, 6, 7, 8} {
+		if ints[i], err = strconv.Atoi(fields[j]); err != nil {
+			return 0, ev, err
+		}
+	}
+	if ev.X, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return 0, ev, err
+	}
+	if ev.Y, err = strconv.ParseFloat(fields[3], 64); err != nil {
+		return 0, ev, err
+	}
+	if ev.Text, err = strconv.Unquote(fields[9]); err != nil {
+		return 0, ev, err
+	}
+	at = time.Duration(ints[0]) * time.Millisecond
+	ev.Type = EventType(ints[1])
+	ev.Button = MouseButton(ints[2])
+	ev.Buttons = MouseButton(ints[3])
+	ev.Delta = ints[4]
+	ev.Key = Key(ints[5])
+	ev.Modifiers = Modifier(ints[6])
+	return at, ev, nil
+}
+
+// postInputEvent queues ev to the window, and returns false if the window
+// was destroyed.
+func (win *Window) postInputEvent(ev InputEvent) bool {
+	ctext, ctextlen := unsafeStringData(ev.Text)
+	alive := true
+	gui(func() {
+		if win.obj.addr == nilPtr || win.obj.engine != nil && win.obj.engine.isDestroyed() {
+			alive = false
+			return
+		}
+		switch ev.Type {
+		case MouseButtonPress, MouseButtonRelease, MouseButtonDblClick, MouseMove:
+			C.viewPostMouseEvent(win.obj.addr, C.int(ev.Type), C.double(ev.X), C.double(ev.Y), C.int(ev.Button), C.int(ev.Buttons), C.int(ev.Modifiers))
+		case Wheel:
+			C.viewPostWheelEvent(win.obj.addr, C.double(ev.X), C.double(ev.Y), C.int(ev.Delta), C.int(ev.Modifiers))
+		case KeyPress, KeyRelease:
+			C.viewPostKeyEvent(win.obj.addr, C.int(ev.Type), C.int(ev.Key), C.int(ev.Modifiers), ctext, ctextlen)
+		}
+	})
+	return alive
+}
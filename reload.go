@@ -0,0 +1,191 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClearComponentCache discards the components compiled so far by the
+// engine, so that QML files modified since then are read again when next
+// loaded, including those imported by the files loaded explicitly.
+// Objects already created from previously loaded components are not
+// affected.
+func (e *Engine) ClearComponentCache() {
+	e.assertValid()
+	gui(func() {
+		C.engineClearComponentCache(e.addr)
+	})
+}
+
+// Recreate creates a new instance of component and makes it the root
+// object of the window, replacing the previous one, which is destroyed.
+// The window itself is preserved, so its geometry, state, and visibility
+// do not change. The new instance runs under the ctx context, or under the
+// same context as component if ctx is nil, so context variables set before
+// remain visible to it.
+//
+// If the new instance cannot be created, the window is left untouched and
+// the returned error holds the problems reported by the component.
+func (win *Window) Recreate(component *Object, ctx *Context) error {
+	if C.objectIsComponent(component.addr) == 0 {
+		panic("object is not a component")
+	}
+	if ctx != nil {
+		ctx.assertValid()
+	}
+	var err error
+	gui(func() {
+		ctxaddr := nilPtr
+		if ctx != nil {
+			ctxaddr = ctx.obj.addr
+		}
+		switch C.viewSetRoot(win.obj.addr, component.addr, ctxaddr) {
+		case 0:
+			err = createError(component.addr)
+		case -1:
+			err = errors.New("cannot recreate window created by QML code")
+		}
+	})
+	return err
+}
+
+// Reloader replaces the root object of a window with a fresh instance of
+// the component in a QML file whenever asked to, or whenever the QML files
+// in a watched directory change, so that changes made to the QML content
+// during development are seen without restarting the application:
+//
+//     reloader := qml.NewReloader(window, "qml/main.qml", nil)
+//     reloader.Watch("qml", time.Second)
+//     defer reloader.Stop()
+//
+// The root object being replaced is destroyed, so Go code holding it or
+// any of its children must obtain them again from the window once the
+// content is reloaded.
+type Reloader struct {
+	win  *Window
+	path string
+	ctx  *Context
+
+	mutex   sync.Mutex
+	onError []func(err error)
+	stop    chan bool
+	queue   callbackQueue
+}
+
+// NewReloader returns a reloader that creates the root object of win
+// from the QML file at path, under the ctx context as documented in
+// Window.Recreate.
+func NewReloader(win *Window, path string, ctx *Context) *Reloader {
+	return &Reloader{win: win, path: path, ctx: ctx}
+}
+
+// Reload discards the components compiled by the window's engine, loads
+// the QML file again, and replaces the root object of the window with a
+// new instance of it. If the file cannot be loaded or the instance cannot
+// be created, the window is left untouched and the problem is returned.
+func (r *Reloader) Reload() error {
+	engine := r.win.obj.engine
+	engine.ClearComponentCache()
+	component, err := engine.LoadFile(r.path)
+	if err != nil {
+		return err
+	}
+	return r.win.Recreate(component, r.ctx)
+}
+
+// OnError registers f to be called with the problems found when content
+// is reloaded due to changes in a watched directory. Without such
+// functions, the problems are logged. The functions are called in a
+// goroutine owned by the package, as documented in the package
+// documentation under "Callbacks".
+func (r *Reloader) OnError(f func(err error)) {
+	r.mutex.Lock()
+	r.onError = append(r.onError, f)
+	r.mutex.Unlock()
+}
+
+// Watch checks the QML, JavaScript, and qmldir files under dir for modifications
+// once per interval, and reloads the content whenever any of them is
+// added, removed, or modified. Calling Watch again replaces the directory
+// being watched.
+func (r *Reloader) Watch(dir string, interval time.Duration) {
+	r.mutex.Lock()
+	if r.stop != nil {
+		close(r.stop)
+	}
+	stop := make(chan bool)
+	r.stop = stop
+	r.mutex.Unlock()
+
+	go func() {
+		last := watchState(dir)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			state := watchState(dir)
+			if state == last {
+				continue
+			}
+			last = state
+			if err := r.Reload(); err != nil {
+				r.reportError(err)
+			}
+		}
+	}()
+}
+
+// Stop stops watching for modifications.
+func (r *Reloader) Stop() {
+	r.mutex.Lock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	r.mutex.Unlock()
+}
+
+func (r *Reloader) reportError(err error) {
+	r.mutex.Lock()
+	onError := r.onError
+	r.mutex.Unlock()
+	if len(onError) == 0 {
+		log.Printf("qml: cannot reload %s: %v", r.path, err)
+		return
+	}
+	for _, f := range onError {
+		f := f
+		r.queue.dispatch(func() { f(err) })
+	}
+}
+
+// watchState returns a summary of the names, sizes, and modification
+// times of the QML, JavaScript, and qmldir files under dir, which changes
+// whenever any of them is added, removed, or modified.
+func watchState(dir string) string {
+	var state []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext == ".qml" || ext == ".js" || info.Name() == "qmldir" {
+			state = append(state, path+"\x00"+info.ModTime().String()+"\x00"+strconv.FormatInt(info.Size(), 10))
+		}
+		return nil
+	})
+	return strings.Join(state, "\n")
+}
@@ -0,0 +1,647 @@
+package qml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// The renderer protocol exchanges JSON messages, one per line, over a
+// pair of pipes passed to the renderer process as file descriptors 3
+// (parent to renderer) and 4 (renderer to parent), so that the standard
+// streams of the renderer remain available for logging.
+//
+// The parent sends the setvar, load, set, get, call, and watch requests.
+// The renderer answers each request with a result message holding the
+// same sequence number, and sends changed messages for watched
+// properties and frame messages with PNG encoded frames on its own.
+const rendererEnv = "QML_RENDERER"
+
+// remoteMessage is a single message of the renderer protocol.
+type remoteMessage struct {
+	Op    string        `json:"op"`
+	Seq   int           `json:"seq,omitempty"`
+	Name  string        `json:"name,omitempty"`
+	Value interface{}   `json:"value,omitempty"`
+	Args  []interface{} `json:"args,omitempty"`
+	Error string        `json:"error,omitempty"`
+	Frame []byte        `json:"frame,omitempty"`
+}
+
+// ErrRendererClosed is returned by the RemoteWindow methods once the
+// window was closed, whether by the Close method or by the user, or once
+// its renderer process failed and was not restarted.
+var ErrRendererClosed = errors.New("renderer window is closed")
+
+// RemoteOptions holds the options for the renderer process started by
+// SpawnRenderer.
+type RemoteOptions struct {
+	// Args holds additional arguments for the renderer binary.
+	Args []string
+
+	// Env holds additional environment variables for the renderer
+	// process, in the form "key=value".
+	Env []string
+
+	// Vars holds variables set as done by RemoteWindow.SetVar before
+	// the QML file is loaded.
+	Vars map[string]interface{}
+
+	// FrameInterval is the interval between the frames streamed by the
+	// renderer to OnFrame, so that the window content may be embedded
+	// in the parent. Frames are not streamed if it is zero.
+	FrameInterval time.Duration
+
+	// OnFrame is called with every frame streamed by the renderer.
+	OnFrame func(img image.Image)
+
+	// OnError is called whenever the renderer process fails, such as
+	// when it crashes, and when restarting it fails.
+	OnError func(err error)
+
+	// Restart is whether the renderer process is restarted when it
+	// fails, as done by RemoteWindow.Restart.
+	Restart bool
+}
+
+// RemoteWindow is a window rendered by a separate renderer process, as
+// started by SpawnRenderer, so that crashes while rendering, such as in
+// the GPU driver, don't take the parent process down. RemoteWindow
+// mirrors a subset of the Window and Object API, with the methods acting
+// on the root object of the window.
+//
+// Values exchanged with the renderer are encoded as JSON, so they must be
+// nil, booleans, numbers, strings, or slices and maps of those, and
+// numbers are always received as float64 values.
+//
+// RemoteWindow methods may be called from any goroutine. Callbacks are
+// called in a goroutine owned by the package. See the Callbacks section
+// of the package documentation.
+type RemoteWindow struct {
+	binary  string
+	qmlPath string
+	opts    RemoteOptions
+	queue   callbackQueue
+
+	mutex   sync.Mutex
+	proc    *rendererProcess
+	seq     int
+	vars    map[string]interface{}
+	watches map[string][]func(value interface{})
+	closed  bool
+	done    chan bool
+	err     error
+}
+
+// rendererProcess holds the state of a single renderer process.
+type rendererProcess struct {
+	cmd     *exec.Cmd
+	in      *os.File
+	enc     *json.Encoder
+	pending map[int]chan *remoteMessage
+	dead    bool
+	killed  bool
+}
+
+// SpawnRenderer starts binary as a renderer process that loads the QML
+// file at qmlPath and shows it in a window, and returns a RemoteWindow
+// to interact with it. The binary must be a program built with this
+// package that calls ServeRenderer via Run:
+//
+//     func main() {
+//         if err := qml.Run(qml.ServeRenderer); err != nil {
+//             fmt.Fprintf(os.Stderr, "error: %v\n", err)
+//             os.Exit(1)
+//         }
+//     }
+//
+// An error is returned if the process cannot be started, or if the QML
+// file cannot be loaded. The parent process does not have to initialize
+// the qml package to use SpawnRenderer.
+func SpawnRenderer(binary, qmlPath string, opts RemoteOptions) (*RemoteWindow, error) {
+	win := &RemoteWindow{
+		binary:  binary,
+		qmlPath: qmlPath,
+		opts:    opts,
+		vars:    make(map[string]interface{}),
+		watches: make(map[string][]func(value interface{})),
+		done:    make(chan bool),
+	}
+	for name, value := range opts.Vars {
+		if err := checkRemoteValue(value); err != nil {
+			return nil, fmt.Errorf("cannot set variable %q: %v", name, err)
+		}
+		win.vars[name] = value
+	}
+	win.mutex.Lock()
+	defer win.mutex.Unlock()
+	if err := win.start(); err != nil {
+		return nil, err
+	}
+	return win, nil
+}
+
+// start starts a new renderer process, replays the variables and the
+// watches registered so far, and loads the QML file.
+//
+// This must be called with win.mutex held.
+func (win *RemoteWindow) start() error {
+	parentr, childw, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("cannot start renderer: %v", err)
+	}
+	childr, parentw, err := os.Pipe()
+	if err != nil {
+		parentr.Close()
+		childw.Close()
+		return fmt.Errorf("cannot start renderer: %v", err)
+	}
+	cmd := exec.Command(win.binary, win.opts.Args...)
+	cmd.Env = append(append(os.Environ(), rendererEnv+"=1"), win.opts.Env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{childr, childw}
+	err = cmd.Start()
+	childr.Close()
+	childw.Close()
+	if err != nil {
+		parentr.Close()
+		parentw.Close()
+		return fmt.Errorf("cannot start renderer: %v", err)
+	}
+
+	proc := &rendererProcess{
+		cmd:     cmd,
+		in:      parentw,
+		enc:     json.NewEncoder(parentw),
+		pending: make(map[int]chan *remoteMessage),
+	}
+	win.proc = proc
+	go win.read(proc, parentr)
+
+	for name, value := range win.vars {
+		win.send(proc, &remoteMessage{Op: "setvar", Name: name, Value: value})
+	}
+	load := win.send(proc, &remoteMessage{Op: "load", Name: win.qmlPath, Value: win.opts.FrameInterval.Seconds()})
+	for name := range win.watches {
+		win.send(proc, &remoteMessage{Op: "watch", Name: name})
+	}
+
+	// Wait for the outcome of the load request without holding the
+	// mutex, which the reading goroutine needs to deliver it.
+	win.mutex.Unlock()
+	result := <-load
+	win.mutex.Lock()
+	if result.Error != "" {
+		win.kill(proc)
+		return fmt.Errorf("cannot load %s in renderer: %s", win.qmlPath, result.Error)
+	}
+	return nil
+}
+
+// send sends msg to proc with a new sequence number, and returns the
+// channel that receives its result.
+//
+// This must be called with win.mutex held.
+func (win *RemoteWindow) send(proc *rendererProcess, msg *remoteMessage) chan *remoteMessage {
+	result := make(chan *remoteMessage, 1)
+	if proc.dead {
+		result <- &remoteMessage{Op: "result", Error: "renderer process exited"}
+		return result
+	}
+	win.seq++
+	msg.Seq = win.seq
+	proc.pending[msg.Seq] = result
+	if err := proc.enc.Encode(msg); err != nil {
+		delete(proc.pending, msg.Seq)
+		result <- &remoteMessage{Op: "result", Error: err.Error()}
+	}
+	return result
+}
+
+// kill stops proc without reporting its exit as a failure.
+//
+// This must be called with win.mutex held.
+func (win *RemoteWindow) kill(proc *rendererProcess) {
+	if proc.killed {
+		return
+	}
+	proc.killed = true
+	proc.in.Close()
+	proc.cmd.Process.Kill()
+}
+
+// request sends the op request for name to the current renderer process
+// and waits for its result.
+func (win *RemoteWindow) request(op, name string, value interface{}, args []interface{}) (interface{}, error) {
+	win.mutex.Lock()
+	if win.closed {
+		win.mutex.Unlock()
+		return nil, ErrRendererClosed
+	}
+	result := win.send(win.proc, &remoteMessage{Op: op, Name: name, Value: value, Args: args})
+	win.mutex.Unlock()
+	msg := <-result
+	if msg.Error != "" {
+		return nil, errors.New(msg.Error)
+	}
+	return msg.Value, nil
+}
+
+// read delivers the messages sent by proc until it exits, and then
+// handles its exit.
+func (win *RemoteWindow) read(proc *rendererProcess, r *os.File) {
+	dec := json.NewDecoder(r)
+	for {
+		var msg remoteMessage
+		if err := dec.Decode(&msg); err != nil {
+			break
+		}
+		switch msg.Op {
+		case "result":
+			win.mutex.Lock()
+			result := proc.pending[msg.Seq]
+			delete(proc.pending, msg.Seq)
+			win.mutex.Unlock()
+			if result != nil {
+				result <- &msg
+			}
+		case "changed":
+			win.mutex.Lock()
+			funcs := win.watches[msg.Name]
+			win.mutex.Unlock()
+			for _, f := range funcs {
+				f, value := f, msg.Value
+				win.queue.dispatch(func() { f(value) })
+			}
+		case "frame":
+			if win.opts.OnFrame == nil {
+				continue
+			}
+			img, err := png.Decode(bytes.NewReader(msg.Frame))
+			if err == nil {
+				win.queue.dispatch(func() { win.opts.OnFrame(img) })
+			}
+		}
+	}
+	r.Close()
+	err := proc.cmd.Wait()
+
+	win.mutex.Lock()
+	defer win.mutex.Unlock()
+	proc.dead = true
+	proc.in.Close()
+	for seq, result := range proc.pending {
+		result <- &remoteMessage{Op: "result", Seq: seq, Error: "renderer process exited"}
+		delete(proc.pending, seq)
+	}
+	if win.proc != proc || proc.killed || win.closed {
+		return
+	}
+	if err == nil {
+		// The window was closed by the user.
+		win.finish(nil)
+		return
+	}
+	err = fmt.Errorf("renderer process failed: %v", err)
+	win.reportError(err)
+	if !win.opts.Restart {
+		win.finish(err)
+		return
+	}
+	if err := win.start(); err != nil {
+		win.reportError(err)
+		win.finish(err)
+	}
+}
+
+// reportError reports err to the OnError function, if any.
+func (win *RemoteWindow) reportError(err error) {
+	if win.opts.OnError != nil {
+		win.queue.dispatch(func() { win.opts.OnError(err) })
+	}
+}
+
+// finish marks the window as closed for good, with err as the outcome
+// reported by Wait.
+//
+// This must be called with win.mutex held.
+func (win *RemoteWindow) finish(err error) {
+	if win.closed {
+		return
+	}
+	win.closed = true
+	win.err = err
+	close(win.done)
+}
+
+// SetVar makes the provided value available as a variable with the
+// given name to the QML code of the window, as done by Context.SetVar
+// for the root context of the renderer engine. Variables are set again
+// in the new process when the renderer is restarted.
+func (win *RemoteWindow) SetVar(name string, value interface{}) error {
+	if err := checkRemoteValue(value); err != nil {
+		return fmt.Errorf("cannot set variable %q: %v", name, err)
+	}
+	win.mutex.Lock()
+	win.vars[name] = value
+	win.mutex.Unlock()
+	_, err := win.request("setvar", name, value, nil)
+	return err
+}
+
+// Set changes the named property of the root object of the window, as
+// done by Object.Set.
+func (win *RemoteWindow) Set(property string, value interface{}) error {
+	if err := checkRemoteValue(value); err != nil {
+		return fmt.Errorf("cannot set property %q: %v", property, err)
+	}
+	_, err := win.request("set", property, value, nil)
+	return err
+}
+
+// Property returns the current value of the named property of the root
+// object of the window, as done by Object.Property.
+func (win *RemoteWindow) Property(name string) (interface{}, error) {
+	return win.request("get", name, nil, nil)
+}
+
+// Call calls the named method of the root object of the window with the
+// provided parameters, as done by Object.CallError.
+func (win *RemoteWindow) Call(method string, params ...interface{}) (interface{}, error) {
+	for i, param := range params {
+		if err := checkRemoteValue(param); err != nil {
+			return nil, fmt.Errorf("cannot call method %q: parameter %d: %v", method, i+1, err)
+		}
+	}
+	return win.request("call", method, nil, params)
+}
+
+// OnPropertyChanged registers f to be called with the new value of the
+// named property of the root object of the window whenever it changes.
+// Functions registered for a property are called in the order they were
+// registered, and keep being called after the renderer is restarted.
+func (win *RemoteWindow) OnPropertyChanged(property string, f func(value interface{})) error {
+	win.mutex.Lock()
+	watched := len(win.watches[property]) > 0
+	win.watches[property] = append(win.watches[property], f)
+	win.mutex.Unlock()
+	if watched {
+		return nil
+	}
+	_, err := win.request("watch", property, nil, nil)
+	return err
+}
+
+// Restart stops the renderer process, if it is still running, and starts
+// a new one that loads the QML file again, sets the variables set via
+// SetVar, and reports the changes to the properties observed via
+// OnPropertyChanged. Restart may be called after the renderer process
+// failed, or after the window was closed by the user, but not after
+// Close is called.
+func (win *RemoteWindow) Restart() error {
+	win.mutex.Lock()
+	defer win.mutex.Unlock()
+	if win.closed && win.err == ErrRendererClosed {
+		return ErrRendererClosed
+	}
+	win.kill(win.proc)
+	if err := win.start(); err != nil {
+		return err
+	}
+	if win.closed {
+		win.closed = false
+		win.err = nil
+		win.done = make(chan bool)
+	}
+	return nil
+}
+
+// Wait blocks until the window is closed, and returns the error that
+// made the renderer process stop, if any. Wait returns nil if the window
+// was closed by the user or via Close.
+func (win *RemoteWindow) Wait() error {
+	win.mutex.Lock()
+	done := win.done
+	win.mutex.Unlock()
+	<-done
+	win.mutex.Lock()
+	defer win.mutex.Unlock()
+	if win.err == ErrRendererClosed {
+		return nil
+	}
+	return win.err
+}
+
+// Close closes the window and stops its renderer process. The window
+// must not be used after Close is called.
+func (win *RemoteWindow) Close() error {
+	win.mutex.Lock()
+	defer win.mutex.Unlock()
+	if win.closed && win.err == ErrRendererClosed {
+		return nil
+	}
+	win.kill(win.proc)
+	if win.closed {
+		win.err = ErrRendererClosed
+		return nil
+	}
+	win.finish(ErrRendererClosed)
+	return nil
+}
+
+// checkRemoteValue returns an error if value cannot be exchanged with a
+// renderer process.
+func checkRemoteValue(value interface{}) error {
+	switch value := value.(type) {
+	case nil, bool, string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return nil
+	case []interface{}:
+		for _, item := range value {
+			if err := checkRemoteValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for _, item := range value {
+			if err := checkRemoteValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot send %T value to renderer", value)
+}
+
+// IsRenderer returns whether the current process was started as a
+// renderer by SpawnRenderer, so that a program may act both as the
+// parent and as the renderer by starting itself.
+func IsRenderer() bool {
+	return os.Getenv(rendererEnv) == "1"
+}
+
+// ServeRenderer runs the renderer side of SpawnRenderer in the current
+// process, which must have been started by it: it loads the requested
+// QML file in a new engine, shows it in a window, and serves the requests
+// of the parent process until the parent closes the window or exits, or
+// until the user closes the window. ServeRenderer is meant to be run via
+// Run, as documented in SpawnRenderer.
+func ServeRenderer() error {
+	if !IsRenderer() {
+		return errors.New("cannot serve renderer: process was not started by SpawnRenderer")
+	}
+	in := os.NewFile(3, "renderer-in")
+	out := os.NewFile(4, "renderer-out")
+	defer out.Close()
+
+	r := &rendererServer{engine: NewEngine(nil), enc: json.NewEncoder(out)}
+	msgs := make(chan *remoteMessage)
+	go func() {
+		dec := json.NewDecoder(in)
+		for {
+			var msg remoteMessage
+			if err := dec.Decode(&msg); err != nil {
+				close(msgs)
+				return
+			}
+			msgs <- &msg
+		}
+	}()
+
+	var closed chan bool
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				// The parent is gone or closed the window.
+				Quit()
+				return nil
+			}
+			value, err := r.handle(msg)
+			reply := &remoteMessage{Op: "result", Seq: msg.Seq, Value: value}
+			if err != nil {
+				reply.Error = err.Error()
+			}
+			r.send(reply)
+			if msg.Op == "load" && err == nil {
+				closed = make(chan bool)
+				go func(win *Window) {
+					win.Wait()
+					close(closed)
+				}(r.win)
+			}
+		case <-closed:
+			return nil
+		}
+	}
+}
+
+// rendererServer holds the state of the renderer side of SpawnRenderer.
+type rendererServer struct {
+	engine *Engine
+	win    *Window
+
+	mutex sync.Mutex
+	enc   *json.Encoder
+}
+
+// send sends msg to the parent process.
+func (r *rendererServer) send(msg *remoteMessage) {
+	r.mutex.Lock()
+	r.enc.Encode(msg)
+	r.mutex.Unlock()
+}
+
+// handle serves the request in msg, and returns its result.
+func (r *rendererServer) handle(msg *remoteMessage) (result interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%v", v)
+		}
+	}()
+	if msg.Op == "setvar" {
+		r.engine.Context().SetVar(msg.Name, msg.Value)
+		return nil, nil
+	}
+	if msg.Op == "load" {
+		if r.win != nil {
+			return nil, errors.New("window was already loaded")
+		}
+		component, err := r.engine.LoadFile(msg.Name)
+		if err != nil {
+			return nil, err
+		}
+		r.win = component.CreateWindow(nil)
+		r.win.Show()
+		if interval, _ := msg.Value.(float64); interval > 0 {
+			go r.streamFrames(time.Duration(interval * float64(time.Second)))
+		}
+		return nil, nil
+	}
+	if r.win == nil {
+		return nil, errors.New("window was not loaded")
+	}
+	root := r.win.Root()
+	switch msg.Op {
+	case "set":
+		return nil, root.Set(msg.Name, msg.Value)
+	case "get":
+		value, err := root.PropertyErr(msg.Name)
+		if err != nil {
+			return nil, err
+		}
+		return value, checkRemoteValue(value)
+	case "call":
+		value, err := root.CallError(msg.Name, msg.Args...)
+		if err != nil {
+			return nil, err
+		}
+		return value, checkRemoteValue(value)
+	case "watch":
+		r.watch(root, msg.Name)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown renderer request %q", msg.Op)
+}
+
+// watch reports the changes to the named property of root to the parent.
+// Notify signals of properties take at most the new value as parameter.
+func (r *rendererServer) watch(root *Object, name string) {
+	changed := func() {
+		value := root.Property(name)
+		if checkRemoteValue(value) == nil {
+			r.send(&remoteMessage{Op: "changed", Name: name, Value: value})
+		}
+	}
+	defer func() {
+		if recover() != nil {
+			root.Connect(name+"Changed", func(interface{}) { changed() })
+		}
+	}()
+	root.Connect(name+"Changed", changed)
+}
+
+// streamFrames sends a snapshot of the window to the parent at every
+// interval, until the window is closed.
+func (r *rendererServer) streamFrames(interval time.Duration) {
+	var buf bytes.Buffer
+	for {
+		time.Sleep(interval)
+		img, err := r.win.Snapshot()
+		if err != nil {
+			return
+		}
+		buf.Reset()
+		if png.Encode(&buf, img) == nil {
+			r.send(&remoteMessage{Op: "frame", Frame: buf.Bytes()})
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// RenderOptions holds options for RenderFile.
+type RenderOptions struct {
+	// Width and Height hold the size the root item of the component
+	// is set to before rendering. Zero values leave the respective
+	// size as defined by the component.
+	Width, Height int
+
+	// Scale holds the factor the content is scaled by when rendered,
+	// so that a scale of 2 renders a 100x50 component into a 200x100
+	// image, as done for high density displays. Defaults to 1.
+	Scale float64
+
+	// Vars holds values set in the context of the component before
+	// it is instantiated, as done by Context.SetVar.
+	Vars map[string]interface{}
+
+	// Timeout holds the maximum time to wait for the images and fonts
+	// used by the component to load and for the window to be rendered.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// RenderFile loads the QML file at path, instantiates its component
+// as described by opts, and returns the rendered content once all the
+// images and fonts it uses are loaded. Everything created for rendering
+// is destroyed before RenderFile returns, so it may be called several
+// times in the same process, such as for generating documentation images
+// in continuous integration environments.
+//
+// An error is returned if the file cannot be loaded, if its root object
+// is not a visual item, if any of its images or fonts fail to load, or
+// if loading and rendering take longer than opts.Timeout.
+//
+// If the qml package was not yet initialized, RenderFile initializes it
+// with default options, as done by Init, and with the offscreen platform
+// plugin of Qt unless the QT_QPA_PLATFORM environment variable is set.
+// Rendering requires OpenGL support from the platform, so in environments
+// such as a virtual X server that may have to be set to "xcb" instead.
+func RenderFile(path string, opts RenderOptions) (image.Image, error) {
+	if err := initForRender(); err != nil {
+		return nil, err
+	}
+	if opts.Scale == 0 {
+		opts.Scale = 1
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	img, err := renderFile(path, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot render %s: %v", path, err)
+	}
+	return img, nil
+}
+
+// initForRender initializes the qml package for RenderFile, if it
+// was not yet initialized.
+func initForRender() error {
+	lazyInitMutex.Lock()
+	defer lazyInitMutex.Unlock()
+	if atomic.LoadInt32(&initialized) != 0 {
+		return nil
+	}
+	if runtime.GOOS == "darwin" {
+		return errors.New("cannot initialize the qml package for rendering on Mac OS; call RenderFile from within qml.Main instead")
+	}
+	if os.Getenv("QT_QPA_PLATFORM") == "" {
+		os.Setenv("QT_QPA_PLATFORM", "offscreen")
+	}
+	Init(nil)
+	return nil
+}
+
+func renderFile(path string, opts *RenderOptions) (image.Image, error) {
+	deadline := time.Now().Add(opts.Timeout)
+
+	engine := NewEngine(nil)
+	defer engine.Destroy()
+
+	ctx := engine.Context()
+	for name, value := range opts.Vars {
+		ctx.SetVar(name, value)
+	}
+	component, err := engine.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	win, err := createWindow(component)
+	if err != nil {
+		return nil, err
+	}
+	defer win.Destroy()
+
+	var ok C.int
+	gui(func() {
+		ok = C.viewSetRenderSize(win.obj.addr, C.int(opts.Width), C.int(opts.Height), C.double(opts.Scale))
+	})
+	if ok == 0 {
+		return nil, errors.New("root object is not a visual item")
+	}
+
+	// Wait for the resources before showing the window, so that the
+	// first frame holds the final content.
+	for {
+		var loading, failed C.int
+		gui(func() {
+			C.viewResourceStatus(win.obj.addr, &loading, &failed)
+		})
+		if failed > 0 {
+			return nil, fmt.Errorf("%d images or fonts failed to load", failed)
+		}
+		if loading == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout waiting for %d images or fonts to load", loading)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	presented := make(chan bool, 1)
+	win.OnFirstFrame(func() { presented <- true })
+	win.Show()
+	select {
+	case <-presented:
+	case <-time.After(deadline.Sub(time.Now())):
+		return nil, errors.New("timeout waiting for the window to be rendered")
+	}
+
+	return win.Snapshot()
+}
+
+// createWindow creates a window for component, as done by
+// Object.CreateWindow, returning an error instead of panicking.
+func createWindow(component *Object) (win *Window, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return component.CreateWindow(nil), nil
+}
+
+// copyImage returns a copy of the image in the buffer at bits, holding
+// height rows of stride bytes with width 32-bit non-premultiplied ARGB
+// pixels in native byte order, as used by QImage.
+func copyImage(bits unsafe.Pointer, width, height, stride int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		src := (*[1 << 28]uint32)(unsafe.Pointer(uintptr(bits) + uintptr(y*stride)))[:width]
+		dst := img.Pix[y*img.Stride:]
+		for x, p := range src {
+			dst[x*4+0] = uint8(p >> 16)
+			dst[x*4+1] = uint8(p >> 8)
+			dst[x*4+2] = uint8(p)
+			dst[x*4+3] = uint8(p >> 24)
+		}
+	}
+	return img
+}
@@ -0,0 +1,434 @@
+package qml
+
+// #include <stdlib.h>
+// #include <string.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// Resources holds a collection of resources, such as QML files, scripts,
+// and images, in the binary format of the Qt resource system. Once loaded
+// via LoadResources, a resource added with a path such as "ui/main.qml"
+// is available at the "qrc:///ui/main.qml" location, and may be loaded via
+// Engine.LoadFile. Resources referenced from QML content loaded that way,
+// such as imported directories and scripts or image sources, are resolved
+// within the loaded resources, so that applications may be shipped as a
+// single binary holding all of their content.
+//
+// Resources are created via a ResourcesPacker, or by parsing data in the
+// format generated by the "rcc -binary" tool of Qt via ParseResources.
+type Resources struct {
+	data []byte
+}
+
+const (
+	resVersion        = 1
+	resHeaderSize     = 20
+	resNodeSize       = 14
+	resFlagCompressed = 0x01
+	resFlagDirectory  = 0x02
+)
+
+// ParseResources parses resources in the binary format generated by the
+// "rcc -binary" tool of Qt.
+func ParseResources(data []byte) (*Resources, error) {
+	if len(data) < resHeaderSize || string(data[:4]) != "qres" {
+		return nil, errors.New("cannot parse resources: invalid header")
+	}
+	if version := binary.BigEndian.Uint32(data[4:]); version != resVersion {
+		return nil, fmt.Errorf("cannot parse resources: unsupported version %d", version)
+	}
+	for i := 8; i < resHeaderSize; i += 4 {
+		if int(binary.BigEndian.Uint32(data[i:])) >= len(data) {
+			return nil, errors.New("cannot parse resources: invalid header")
+		}
+	}
+	return &Resources{append([]byte(nil), data...)}, nil
+}
+
+// Bytes returns the resources in the binary format of the Qt resource
+// system, as accepted by ParseResources.
+func (r *Resources) Bytes() []byte {
+	return append([]byte(nil), r.data...)
+}
+
+// files returns the content of the files under the root directory
+// of r, keyed by their path relative to root.
+func (r *Resources) files(root string) (map[string][]byte, error) {
+	treeOffset := int(binary.BigEndian.Uint32(r.data[8:]))
+	dataOffset := int(binary.BigEndian.Uint32(r.data[12:]))
+	namesOffset := int(binary.BigEndian.Uint32(r.data[16:]))
+	corrupt := errors.New("cannot read resources: data is corrupt")
+	read := func(offset, size int) []byte {
+		if offset < 0 || offset+size > len(r.data) {
+			return nil
+		}
+		return r.data[offset : offset+size]
+	}
+	node := func(index int) []byte {
+		return read(treeOffset+index*resNodeSize, resNodeSize)
+	}
+	name := func(n []byte) (string, bool) {
+		offset := namesOffset + int(binary.BigEndian.Uint32(n))
+		size := read(offset, 2)
+		if size == nil {
+			return "", false
+		}
+		raw := read(offset+6, int(binary.BigEndian.Uint16(size))*2)
+		if raw == nil {
+			return "", false
+		}
+		chars := make([]uint16, len(raw)/2)
+		for i := range chars {
+			chars[i] = binary.BigEndian.Uint16(raw[i*2:])
+		}
+		return string(utf16.Decode(chars)), true
+	}
+
+	// Find the root directory.
+	index := 0
+	for _, part := range strings.Split(root, "/") {
+		if part == "" {
+			continue
+		}
+		n := node(index)
+		if n == nil {
+			return nil, corrupt
+		}
+		found := false
+		if binary.BigEndian.Uint16(n[4:])&resFlagDirectory != 0 {
+			count := int(binary.BigEndian.Uint32(n[6:]))
+			first := int(binary.BigEndian.Uint32(n[10:]))
+			for i := first; i < first+count; i++ {
+				child := node(i)
+				if child == nil {
+					return nil, corrupt
+				}
+				if childName, ok := name(child); ok && childName == part {
+					index = i
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cannot read resources: directory %q not found", root)
+		}
+	}
+
+	files := make(map[string][]byte)
+	var walk func(index int, path string) error
+	walk = func(index int, path string) error {
+		n := node(index)
+		if n == nil {
+			return corrupt
+		}
+		flags := binary.BigEndian.Uint16(n[4:])
+		if flags&resFlagDirectory != 0 {
+			count := int(binary.BigEndian.Uint32(n[6:]))
+			first := int(binary.BigEndian.Uint32(n[10:]))
+			for i := first; i < first+count; i++ {
+				child := node(i)
+				if child == nil || i <= index {
+					return corrupt
+				}
+				childName, ok := name(child)
+				if !ok {
+					return corrupt
+				}
+				if err := walk(i, path+childName+"/"); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		offset := dataOffset + int(binary.BigEndian.Uint32(n[10:]))
+		size := read(offset, 4)
+		if size == nil {
+			return corrupt
+		}
+		data := read(offset+4, int(binary.BigEndian.Uint32(size)))
+		if data == nil {
+			return corrupt
+		}
+		if flags&resFlagCompressed != 0 {
+			// Compressed as done by qCompress, with the uncompressed
+			// size preceding the zlib stream.
+			if len(data) < 4 {
+				return corrupt
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(data[4:]))
+			if err != nil {
+				return corrupt
+			}
+			data, err = ioutil.ReadAll(zr)
+			if err != nil {
+				return corrupt
+			}
+		}
+		files[strings.TrimSuffix(path, "/")] = append([]byte(nil), data...)
+		return nil
+	}
+	if node(index) == nil || binary.BigEndian.Uint16(node(index)[4:])&resFlagDirectory == 0 {
+		return nil, fmt.Errorf("cannot read resources: %q is not a directory", root)
+	}
+	if err := walk(index, ""); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// loadedResources holds the C copies of the resources currently loaded,
+// since Qt uses the data in place while they are registered.
+var loadedResources = make(map[*Resources]unsafe.Pointer)
+
+// LoadResources makes the resources in r available at "qrc:///" locations
+// to all engines. Loading resources that were already loaded has no effect.
+func LoadResources(r *Resources) {
+	gui(func() {
+		if _, ok := loadedResources[r]; ok {
+			return
+		}
+		cdata := C.malloc(C.size_t(len(r.data)))
+		C.memcpy(cdata, unsafe.Pointer(&r.data[0]), C.size_t(len(r.data)))
+		C.registerResourceData(cdata)
+		loadedResources[r] = cdata
+	})
+}
+
+// UnloadResources makes the resources in r unavailable again. Content
+// already loaded from them is not affected.
+func UnloadResources(r *Resources) {
+	gui(func() {
+		if cdata, ok := loadedResources[r]; ok {
+			delete(loadedResources, r)
+			C.unregisterResourceData(cdata)
+			C.free(cdata)
+		}
+	})
+}
+
+// readResource returns the content of the loaded resource at the
+// "qrc:" location.
+func readResource(location string) ([]byte, error) {
+	path := ":/" + strings.TrimLeft(strings.TrimPrefix(location, "qrc:"), "/")
+	cpath, cpathLen := unsafeStringData(path)
+	var data []byte
+	gui(func() {
+		var cdataLen C.int
+		cdata := C.readResource(cpath, cpathLen, &cdataLen)
+		if cdata != nilPtr {
+			data = C.GoBytes(cdata, cdataLen)
+			C.free(cdata)
+		}
+	})
+	if data == nil {
+		return nil, fmt.Errorf("cannot open %s: resource not found", location)
+	}
+	return data, nil
+}
+
+// ResourcesPacker builds Resources out of individual files. The zero
+// value is ready for use:
+//
+//     var rp qml.ResourcesPacker
+//     rp.Add("main.qml", mainQML)
+//     rp.Add("images/logo.png", logoPNG)
+//     qml.LoadResources(rp.Pack())
+//
+type ResourcesPacker struct {
+	root resNode
+}
+
+// resNode is a file or directory added to a ResourcesPacker.
+type resNode struct {
+	name     string
+	data     []byte
+	children []*resNode
+	dir      bool
+}
+
+// Add adds a file with the provided data at path, which holds names
+// separated by slashes, such as "ui/main.qml". Adding a file at a path
+// that was already added replaces its data. Add panics if path is empty,
+// or if it holds a name previously added as a file and now used as a
+// directory, or vice versa.
+func (rp *ResourcesPacker) Add(path string, data []byte) {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		panic("cannot add resource with an empty path")
+	}
+	node := &rp.root
+	node.dir = true
+	for i, name := range names {
+		dir := i < len(names)-1
+		var child *resNode
+		for _, c := range node.children {
+			if c.name == name {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			child = &resNode{name: name, dir: dir}
+			node.children = append(node.children, child)
+		} else if child.dir != dir {
+			panic(fmt.Sprintf("cannot add resource %q: %q is both a file and a directory", path, strings.Join(names[:i+1], "/")))
+		}
+		node = child
+	}
+	node.data = data
+}
+
+// Pack returns the resources added so far.
+func (rp *ResourcesPacker) Pack() *Resources {
+	rp.root.dir = true
+
+	// Nodes are laid out breadth first, with the children of each
+	// directory sorted by the hash of their names, as Qt looks them
+	// up via binary search.
+	nodes := []*resNode{&rp.root}
+	first := make(map[*resNode]int)
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if !node.dir {
+			continue
+		}
+		children := append([]*resNode(nil), node.children...)
+		sort.Sort(resNodesByHash(children))
+		first[node] = len(nodes)
+		nodes = append(nodes, children...)
+	}
+
+	var data, names, tree bytes.Buffer
+	for i, node := range nodes {
+		nameOffset := 0
+		if i > 0 {
+			nameOffset = names.Len()
+			chars := utf16.Encode([]rune(node.name))
+			binary.Write(&names, binary.BigEndian, uint16(len(chars)))
+			binary.Write(&names, binary.BigEndian, resHash(chars))
+			binary.Write(&names, binary.BigEndian, chars)
+		}
+		binary.Write(&tree, binary.BigEndian, uint32(nameOffset))
+		if node.dir {
+			binary.Write(&tree, binary.BigEndian, uint16(resFlagDirectory))
+			binary.Write(&tree, binary.BigEndian, uint32(len(node.children)))
+			binary.Write(&tree, binary.BigEndian, uint32(first[node]))
+		} else {
+			binary.Write(&tree, binary.BigEndian, uint16(0))
+			binary.Write(&tree, binary.BigEndian, uint16(0)) // Any country.
+			binary.Write(&tree, binary.BigEndian, uint16(1)) // C language.
+			binary.Write(&tree, binary.BigEndian, uint32(data.Len()))
+			binary.Write(&data, binary.BigEndian, uint32(len(node.data)))
+			data.Write(node.data)
+		}
+	}
+
+	var buf bytes.Buffer
+	dataOffset := resHeaderSize
+	namesOffset := dataOffset + data.Len()
+	treeOffset := namesOffset + names.Len()
+	buf.WriteString("qres")
+	binary.Write(&buf, binary.BigEndian, uint32(resVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(treeOffset))
+	binary.Write(&buf, binary.BigEndian, uint32(dataOffset))
+	binary.Write(&buf, binary.BigEndian, uint32(namesOffset))
+	buf.Write(data.Bytes())
+	buf.Write(names.Bytes())
+	buf.Write(tree.Bytes())
+	return &Resources{buf.Bytes()}
+}
+
+// resHash returns the hash of a resource name, as computed by Qt.
+func resHash(chars []uint16) uint32 {
+	var h uint32
+	for _, c := range chars {
+		h = (h << 4) + uint32(c)
+		h ^= (h & 0xf0000000) >> 23
+		h &= 0x0fffffff
+	}
+	return h
+}
+
+type resNodesByHash []*resNode
+
+func (s resNodesByHash) Len() int      { return len(s) }
+func (s resNodesByHash) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s resNodesByHash) Less(i, j int) bool {
+	hi := resHash(utf16.Encode([]rune(s[i].name)))
+	hj := resHash(utf16.Encode([]rune(s[j].name)))
+	if hi != hj {
+		return hi < hj
+	}
+	return s[i].name < s[j].name
+}
+
+const modulesPath = "goqml-modules"
+
+// registeredModules holds the URIs of the modules registered so far.
+var registeredModules = make(map[string]bool)
+
+// RegisterModule makes the QML module in the root directory of r, which
+// must hold a qmldir file, importable under uri by all engines created
+// afterwards, as if it was installed in an import path of Qt. Given a
+// module registered with the "MyLib.Widgets" URI, documents may then
+// import it as usual:
+//
+//     import MyLib.Widgets 1.0
+//
+// The module is resolved by Qt from its qmldir file, so versioned types,
+// singletons, and JavaScript libraries declared there are available as
+// they would be for modules on disk.
+func RegisterModule(uri string, r *Resources, root string) error {
+	parts := strings.Split(uri, ".")
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, "/\\ ") {
+			return fmt.Errorf("cannot register module %q: invalid URI", uri)
+		}
+	}
+	files, err := r.files(root)
+	if err != nil {
+		return fmt.Errorf("cannot register module %q: %v", uri, err)
+	}
+	if _, ok := files["qmldir"]; !ok {
+		return fmt.Errorf("cannot register module %q: %q has no qmldir file", uri, root)
+	}
+
+	var rp ResourcesPacker
+	prefix := modulesPath + "/" + strings.Join(parts, "/") + "/"
+	for path, data := range files {
+		rp.Add(prefix+path, data)
+	}
+	module := rp.Pack()
+
+	var result error
+	gui(func() {
+		if registeredModules[uri] {
+			result = fmt.Errorf("cannot register module %q: module already registered", uri)
+			return
+		}
+		registeredModules[uri] = true
+		LoadResources(module)
+	})
+	return result
+}
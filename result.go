@@ -0,0 +1,269 @@
+package qml
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result holds a value obtained from QML, such as the value of a
+// property, the result of a method call, or the value of a context
+// variable, and converts it into the Go type requested via its methods.
+// Results are obtained via Object.PropertyResult, Object.CallResult,
+// and Context.VarResult:
+//
+//     count, err := obj.CallResult("countItems").Int()
+//
+// The conversions are more lenient than the ones done by the getters of
+// Object, such as Object.Int, as QML code often hands back numbers held
+// in strings, or integral values as floating point numbers. Numeric
+// strings are parsed as numbers, numbers are formatted as strings, and
+// times may be held as a number of milliseconds since the Unix epoch, as
+// returned by Date.now in JavaScript, or as RFC 3339 text, as returned
+// by the toISOString method of Date objects. Values that cannot be
+// converted are reported as errors rather than panics, and so is the
+// error that prevented obtaining the value in the first place, if any.
+type Result struct {
+	value   interface{}
+	err     error
+	subject string
+}
+
+// ResultOf returns a Result holding value, so that values obtained from
+// QML by other means, such as the parameters of a function connected to
+// a signal, may be converted as well.
+func ResultOf(value interface{}) Result {
+	return Result{value: value, subject: "result"}
+}
+
+// PropertyResult returns the current value of a property of the object,
+// as done by Property, held in a Result.
+func (obj *Object) PropertyResult(name string) Result {
+	value, err := obj.PropertyErr(name)
+	return Result{value, err, propertySubject(name)}
+}
+
+// CallResult calls the given object method with the provided parameters,
+// as done by CallError, and returns its result held in a Result.
+func (obj *Object) CallResult(method string, params ...interface{}) Result {
+	value, err := obj.CallError(method, params...)
+	return Result{value, err, fmt.Sprintf("result of method %q", method)}
+}
+
+// VarResult returns the context variable with the given name, as done
+// by Var, held in a Result.
+func (ctx *Context) VarResult(name string) Result {
+	return Result{ctx.Var(name), nil, fmt.Sprintf("variable %q", name)}
+}
+
+// Value returns the value held by r as is, or the error that prevented
+// obtaining it.
+func (r Result) Value() (interface{}, error) {
+	return r.value, r.err
+}
+
+// Err returns the error that prevented obtaining the value held by r,
+// if any.
+func (r Result) Err() error {
+	return r.err
+}
+
+// number returns the value held by r, parsed as a number if it's a
+// numeric string.
+func (r Result) number() (interface{}, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	s, ok := r.value.(string)
+	if !ok {
+		return r.value, nil
+	}
+	s = strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("value of %s is not a number: %q", r.subject, r.value)
+}
+
+// Int returns the value held by r as an int.
+func (r Result) Int() (int, error) {
+	value, err := r.number()
+	if err != nil {
+		return 0, err
+	}
+	return intValue(r.subject, value)
+}
+
+// Int64 returns the value held by r as an int64.
+func (r Result) Int64() (int64, error) {
+	value, err := r.number()
+	if err != nil {
+		return 0, err
+	}
+	return int64Value(r.subject, value)
+}
+
+// Uint64 returns the value held by r as a uint64.
+func (r Result) Uint64() (uint64, error) {
+	value, err := r.number()
+	if err != nil {
+		return 0, err
+	}
+	return uint64Value(r.subject, value)
+}
+
+// Float64 returns the value held by r as a float64.
+func (r Result) Float64() (float64, error) {
+	value, err := r.number()
+	if err != nil {
+		return 0, err
+	}
+	return float64Value(r.subject, value)
+}
+
+// Float32 returns the value held by r as a float32.
+func (r Result) Float32() (float32, error) {
+	value, err := r.number()
+	if err != nil {
+		return 0, err
+	}
+	return float32Value(r.subject, value)
+}
+
+// String returns the value held by r as a string. Numbers and booleans
+// are formatted as done by JavaScript.
+func (r Result) String() (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	switch value := r.value.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case float32:
+		return strconv.FormatFloat(float64(value), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	}
+	if wide, ok := widenNumber(r.value); ok {
+		return Result{wide, nil, r.subject}.String()
+	}
+	return "", fmt.Errorf("value of %s cannot be represented as a string: %#v", r.subject, r.value)
+}
+
+// Bool returns the value held by r as a bool. The strings "true" and
+// "false" are accepted as well.
+func (r Result) Bool() (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	switch value := r.value.(type) {
+	case bool:
+		return value, nil
+	case string:
+		switch strings.TrimSpace(value) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("value of %s cannot be represented as a bool: %#v", r.subject, r.value)
+}
+
+// Time returns the value held by r as a time.Time.
+func (r Result) Time() (time.Time, error) {
+	if r.err != nil {
+		return time.Time{}, r.err
+	}
+	if t, ok := r.value.(time.Time); ok {
+		return t, nil
+	}
+	if s, ok := r.value.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	if msecs, err := r.Float64(); err == nil && math.Abs(msecs) < math.MaxInt64 {
+		ms := int64(msecs)
+		return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)), nil
+	}
+	return time.Time{}, fmt.Errorf("value of %s cannot be represented as a time.Time: %#v", r.subject, r.value)
+}
+
+// Object returns the value held by r as a *qml.Object. A nil value
+// is returned as a nil object.
+func (r Result) Object() (*Object, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	switch value := r.value.(type) {
+	case nil:
+		return nil, nil
+	case *Object:
+		return value, nil
+	}
+	return nil, fmt.Errorf("value of %s is not a *qml.Object: %#v", r.subject, r.value)
+}
+
+// List returns the value held by r as a []interface{}, whatever the
+// type of the list it holds, such as the []int or []string lists
+// obtained from QML by default. A nil value is returned as a nil list.
+func (r Result) List() ([]interface{}, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.value == nil {
+		return nil, nil
+	}
+	if list, ok := r.value.([]interface{}); ok {
+		return list, nil
+	}
+	v := reflect.ValueOf(r.value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("value of %s is not a list: %#v", r.subject, r.value)
+	}
+	list := make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+	return list, nil
+}
+
+// Map returns the value held by r as a map[string]interface{}, such as
+// the values obtained from JavaScript objects. A nil value is returned
+// as a nil map.
+func (r Result) Map() (map[string]interface{}, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.value == nil {
+		return nil, nil
+	}
+	if m, ok := r.value.(map[string]interface{}); ok {
+		return m, nil
+	}
+	v := reflect.ValueOf(r.value)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("value of %s is not a map: %#v", r.subject, r.value)
+	}
+	m := make(map[string]interface{}, v.Len())
+	for _, key := range v.MapKeys() {
+		m[key.String()] = v.MapIndex(key).Interface()
+	}
+	return m, nil
+}
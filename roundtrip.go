@@ -0,0 +1,127 @@
+package qml
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// RoundTrip pushes value through a new engine in each of the ways Go
+// values reach QML, and returns the value read back from a context
+// variable it was set into. The value is also passed to a JavaScript
+// function that returns it unchanged, and is assigned to a var property
+// and read back from it. RoundTrip returns an error if converting the
+// value panics, or if the paths return values that differ from each
+// other, so that conversion bugs may be found with fuzz tests:
+//
+//     func FuzzRecord(f *testing.F) {
+//         f.Fuzz(func(t *testing.T, name string, size int64) {
+//             if _, err := qml.RoundTrip(&Record{name, size}); err != nil {
+//                 t.Fatal(err)
+//             }
+//         })
+//     }
+//
+// Values coming back from JavaScript are numbers regardless of the Go
+// numeric type provided, so numbers are compared by their float64 value,
+// and lists and maps are compared item by item. Strings with invalid
+// UTF-8 come back with the invalid bytes replaced by U+FFFD.
+//
+// RoundTrip is meant for tests of conversion logic, including custom
+// marshalers, and is slow due to the engine created on every call.
+func RoundTrip(value interface{}) (result interface{}, err error) {
+	engine := NewEngine(nil)
+	defer engine.Destroy()
+	component, err := engine.LoadString("roundtrip.qml", "import QtQuick 2.0\nQtObject { property var held; function identity(v) { return v } }")
+	if err != nil {
+		return nil, err
+	}
+	obj := component.Create(nil)
+	defer obj.Destroy()
+
+	var step string
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = fmt.Errorf("cannot round trip %T value via %s: %v", value, step, r)
+		}
+	}()
+
+	step = "context variable"
+	ctx := engine.Context()
+	ctx.SetVar("roundTripValue", value)
+	result = ctx.Var("roundTripValue")
+	ctx.SetVar("roundTripValue", nil)
+
+	step = "function call"
+	called := obj.Call("identity", value)
+
+	step = "var property"
+	if err := obj.Set("held", value); err != nil {
+		return nil, fmt.Errorf("cannot round trip %T value via %s: %v", value, step, err)
+	}
+	held := obj.Property("held")
+	obj.Set("held", nil)
+
+	if !roundTripEqual(result, called) {
+		return nil, fmt.Errorf("round trip of %T value via function call returned %#v, via context variable returned %#v", value, called, result)
+	}
+	if !roundTripEqual(result, held) {
+		return nil, fmt.Errorf("round trip of %T value via var property returned %#v, via context variable returned %#v", value, held, result)
+	}
+	return result, nil
+}
+
+// roundTripEqual returns whether a and b hold equivalent values, as
+// documented in RoundTrip.
+func roundTripEqual(a, b interface{}) bool {
+	if fa, ok := roundTripNumber(a); ok {
+		fb, ok := roundTripNumber(b)
+		return ok && (fa == fb || math.IsNaN(fa) && math.IsNaN(fb))
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.IsValid() && vb.IsValid() {
+		switch {
+		case isList(va.Kind()) && isList(vb.Kind()):
+			if va.Len() != vb.Len() {
+				return false
+			}
+			for i := 0; i < va.Len(); i++ {
+				if !roundTripEqual(va.Index(i).Interface(), vb.Index(i).Interface()) {
+					return false
+				}
+			}
+			return true
+		case va.Kind() == reflect.Map && vb.Kind() == reflect.Map:
+			if va.Len() != vb.Len() {
+				return false
+			}
+			for _, key := range va.MapKeys() {
+				item := vb.MapIndex(key)
+				if !item.IsValid() || !roundTripEqual(va.MapIndex(key).Interface(), item.Interface()) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isList(kind reflect.Kind) bool {
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+// roundTripNumber returns v as a float64 if it holds a number.
+func roundTripNumber(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,220 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Scan sets the exported fields of the struct pointed to by dest to the
+// values of the properties of obj with the same names, so that the state
+// of a whole form may be obtained at once. Property names are obtained
+// from field names as documented in Context.SetVar, or from the field
+// tag in the form `qml:"name"`. Fields tagged with `qml:"-"` are ignored.
+//
+// Property values are converted to the field types with the coercions
+// used by methods such as Int and Float64. Fields holding structs, or
+// pointers to structs, are scanned from the object found in the property
+// with the field name, or else from the descendant of obj having it as
+// its objectName.
+//
+// Fields are scanned even after a problem is found in a previous one, and
+// the returned error reports the problems found in all of them.
+func (obj *Object) Scan(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot scan object into %T: not a pointer to a struct", dest)
+	}
+	var msgs []string
+	obj.scan(v.Elem(), "", &msgs)
+	if len(msgs) > 0 {
+		return fmt.Errorf("cannot scan object into %T:\n%s", dest, strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+// Fill sets the properties of obj to the values of the exported fields of
+// the struct value or pointer src, following the same naming and nesting
+// rules documented in Scan. Fields are applied even after a problem is
+// found in a previous one, and the returned error reports the problems
+// found in all of them.
+func (obj *Object) Fill(src interface{}) error {
+	v := reflect.ValueOf(src)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot fill object from %T: not a struct", src)
+	}
+	var msgs []string
+	obj.fill(v, "", &msgs)
+	if len(msgs) > 0 {
+		return fmt.Errorf("cannot fill object from %T:\n%s", src, strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+func (obj *Object) scan(v reflect.Value, prefix string, msgs *[]string) {
+	vt := v.Type()
+	for i := 0; i < vt.NumField(); i++ {
+		field := vt.Field(i)
+		name, ok := propertyName(vt, field)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		path := prefix + field.Name
+		if isScanStruct(field.Type) {
+			sub, err := obj.subObject(name)
+			if err != nil {
+				*msgs = append(*msgs, fmt.Sprintf("%s: %v", path, err))
+				continue
+			}
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(field.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			sub.scan(fv, path+".", msgs)
+			continue
+		}
+		value, found := obj.property(name)
+		if !found {
+			*msgs = append(*msgs, fmt.Sprintf("%s: object has no %q property", path, name))
+			continue
+		}
+		cv, err := coerce(value, field.Type)
+		if err != nil {
+			*msgs = append(*msgs, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		fv.Set(cv)
+	}
+}
+
+func (obj *Object) fill(v reflect.Value, prefix string, msgs *[]string) {
+	vt := v.Type()
+	for i := 0; i < vt.NumField(); i++ {
+		field := vt.Field(i)
+		name, ok := propertyName(vt, field)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		path := prefix + field.Name
+		if isScanStruct(field.Type) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			sub, err := obj.subObject(name)
+			if err != nil {
+				*msgs = append(*msgs, fmt.Sprintf("%s: %v", path, err))
+				continue
+			}
+			sub.fill(fv, path+".", msgs)
+			continue
+		}
+		if err := obj.Set(name, fv.Interface()); err != nil {
+			*msgs = append(*msgs, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+}
+
+// propertyName returns the name of the property that maps to field of
+// the struct type st, and whether field maps to a property at all.
+func propertyName(st reflect.Type, field reflect.StructField) (name string, ok bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("qml")
+	if tag == "-" || tag == "" && optsIn(st) {
+		return "", false
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return memberName(field.Name), true
+}
+
+// isScanStruct returns whether typ is a struct, or a pointer to a struct,
+// that is scanned from a sub-object rather than from a single property.
+func isScanStruct(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == typeObject.Elem() {
+		return false
+	}
+	if useMarshalers && (reflect.PtrTo(typ).Implements(typeTextUnmarshaler) || typ.Implements(typeTextUnmarshaler)) {
+		return false
+	}
+	return true
+}
+
+// subObject returns the object held by the named property of obj, or
+// else the descendant of obj with name as its objectName.
+func (obj *Object) subObject(name string) (*Object, error) {
+	if value, found := obj.property(name); found {
+		if sub, ok := value.(*Object); ok {
+			return sub, nil
+		}
+	}
+	cname, cnamelen := unsafeStringData(name)
+	var dvalue C.DataValue
+	gui(func() {
+		qname := C.newString(cname, cnamelen)
+		defer C.delString(qname)
+		C.objectFindChild(obj.addr, qname, &dvalue)
+	})
+	if sub, ok := unpackDataValue(&dvalue, obj.engine).(*Object); ok {
+		return sub, nil
+	}
+	return nil, fmt.Errorf("cannot find object in property or descendant named %q", name)
+}
+
+// coerce converts value as obtained from a property to typ, with the
+// coercions used by methods such as Object.Int and Object.Float64.
+func coerce(value interface{}, typ reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(typ), nil
+	}
+	v := reflect.ValueOf(value)
+	if useMarshalers && v.Kind() == reflect.String {
+		if uv, ok, err := unmarshalText(v.String(), typ); ok {
+			return uv, err
+		}
+	}
+	if v.Type().AssignableTo(typ) {
+		return v, nil
+	}
+	if typ == typeDuration && isNumber(v.Kind()) {
+		// Durations are handled in QML as milliseconds.
+		return reflect.ValueOf(time.Duration(v.Convert(typeFloat64).Float() * float64(time.Millisecond))), nil
+	}
+	if isNumber(v.Kind()) && isNumber(typ.Kind()) {
+		return v.Convert(typ), nil
+	}
+	if v.Kind() == typ.Kind() && v.Type().ConvertibleTo(typ) {
+		return v.Convert(typ), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use value %#v as %s", value, typ)
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	itemTypePattern   = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*\.)?[A-Z][A-Za-z0-9_]*$`)
+	itemImportPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)* [0-9]+\.[0-9]+( as [A-Z][A-Za-z0-9_]*)?$`)
+)
+
+// Item creates a new visual item of the named QML type, such as
+// "Rectangle" or "MouseArea", so that scenes may be built entirely from
+// Go code, without QML documents:
+//
+//     win := engine.NewWindow(200, 100)
+//     rect, err := engine.Item("Rectangle")
+//     ...
+//     rect.Set("color", "steelblue")
+//     rect.SetGeometry(10, 10, 80, 30)
+//     rect.SetParentItem(win.Root())
+//
+// The QtQuick 2.0 module is always imported, and imports holds further
+// modules to import, each as the module name and version followed by an
+// optional qualifier, as in "GoExtensions 1.0" or "QtQuick.Controls 2.0 as
+// C" for creating a "C.Button". Types registered via RegisterType and
+// related functions may be created as well, once their module is imported.
+//
+// The new item has no parent item, so it's not shown until it is made the
+// child of an item in a window via SetParentItem, after which it's owned
+// by its parent. Items that never get a parent must be destroyed via their
+// Destroy method.
+//
+// An error is returned if the type or the imports are malformed, or if
+// the item cannot be created, such as when the type is unknown or is not
+// a visual item type.
+func (e *Engine) Item(typeName string, imports ...string) (*Object, error) {
+	e.assertValid()
+	if !itemTypePattern.MatchString(typeName) {
+		return nil, fmt.Errorf("cannot create item: invalid type name %q", typeName)
+	}
+	var header strings.Builder
+	header.WriteString("import QtQuick 2.0\n")
+	for _, imp := range imports {
+		if !itemImportPattern.MatchString(imp) {
+			return nil, fmt.Errorf("cannot create item of type %s: invalid import %q", typeName, imp)
+		}
+		header.WriteString("import " + imp + "\n")
+	}
+	source := header.String() + typeName + " {}\n"
+
+	var component *Object
+	gui(func() {
+		component = e.items[source]
+	})
+	if component == nil {
+		var err error
+		component, err = e.LoadString(typeName+".qml", source)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create item of type %s: %v", typeName, err)
+		}
+		gui(func() {
+			if e.items == nil {
+				e.items = make(map[string]*Object)
+			}
+			e.items[source] = component
+		})
+	}
+	var item *Object
+	var err error
+	gui(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("cannot create item of type %s: %v", typeName, r)
+			}
+		}()
+		item = component.Create(nil)
+		var x, y, width, height C.double
+		if C.itemGeometry(item.addr, &x, &y, &width, &height) == 0 {
+			item.Destroy()
+			item = nil
+			err = fmt.Errorf("cannot create item of type %s: not a visual item type", typeName)
+		}
+	})
+	return item, err
+}
+
+// NewWindow creates a new window of the provided size, with an empty
+// item as its root object, which is resized along with the window, so
+// that a scene may be built within it from Go code via Engine.Item and
+// Object.SetParentItem. See Item.
+func (e *Engine) NewWindow(width, height int) *Window {
+	e.assertValid()
+	component, err := e.LoadString("window.qml", "import QtQuick 2.0\nItem {}\n")
+	if err != nil {
+		panic(err.Error())
+	}
+	win := component.CreateWindow(nil)
+	win.SetSize(width, height)
+	return win
+}
@@ -0,0 +1,162 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+)
+
+// Screen describes a screen attached to the system, as it was when the
+// value was obtained. See Screens and Window.Screen.
+//
+// Geometries are in logical pixels, as are window positions and sizes,
+// so they may be used to place windows directly. Multiplying them by
+// DevicePixelRatio yields device pixels.
+type Screen struct {
+	// Name identifies the screen, such as "HDMI-1". The name is stable
+	// while the screen remains attached.
+	Name string
+
+	// Geometry holds the area of the virtual desktop covered by the
+	// screen, and AvailableGeometry the part of it not taken by
+	// elements of the window system, such as panels and docks.
+	Geometry          image.Rectangle
+	AvailableGeometry image.Rectangle
+
+	// DevicePixelRatio holds the number of device pixels per logical pixel.
+	DevicePixelRatio float64
+
+	// RefreshRate holds the refresh rate of the screen in Hz.
+	RefreshRate float64
+
+	// LogicalDPI holds the number of logical dots per inch used to
+	// scale fonts, and PhysicalDPI the one reported by the display.
+	LogicalDPI  float64
+	PhysicalDPI float64
+
+	// Primary holds whether the screen is the primary screen, where new
+	// windows are shown by default.
+	Primary bool
+}
+
+// screensChanged holds the function registered via OnScreensChanged.
+//
+// Only accessed from the main GUI thread.
+var (
+	screensChanged func(screens []Screen)
+	screensQueue   callbackQueue
+	screensWatched bool
+)
+
+// Screens returns the screens attached to the system, with the primary
+// screen first:
+//
+//     for _, screen := range qml.Screens() {
+//         fmt.Println(screen.Name, screen.Geometry, screen.DevicePixelRatio)
+//     }
+//
+func Screens() []Screen {
+	var screens []Screen
+	gui(func() {
+		screens = currentScreens()
+	})
+	return screens
+}
+
+// currentScreens returns the screens attached to the system.
+//
+// This must be run from the main GUI thread.
+func currentScreens() []Screen {
+	count := int(C.applicationScreenCount())
+	screens := make([]Screen, count)
+	for i := range screens {
+		var cinfo C.ScreenInfo
+		C.applicationScreen(C.int(i), &cinfo)
+		screens[i] = screenFromInfo(&cinfo)
+	}
+	return screens
+}
+
+// screenFromInfo returns the Screen described by cinfo, and releases the
+// memory it refers to.
+func screenFromInfo(cinfo *C.ScreenInfo) Screen {
+	screen := Screen{
+		Name: C.GoString(cinfo.name),
+		Geometry: image.Rect(
+			int(cinfo.x), int(cinfo.y),
+			int(cinfo.x+cinfo.width), int(cinfo.y+cinfo.height)),
+		AvailableGeometry: image.Rect(
+			int(cinfo.availableX), int(cinfo.availableY),
+			int(cinfo.availableX+cinfo.availableWidth), int(cinfo.availableY+cinfo.availableHeight)),
+		DevicePixelRatio: float64(cinfo.devicePixelRatio),
+		RefreshRate:      float64(cinfo.refreshRate),
+		LogicalDPI:       float64(cinfo.logicalDpi),
+		PhysicalDPI:      float64(cinfo.physicalDpi),
+		Primary:          cinfo.primary != 0,
+	}
+	C.free(unsafe.Pointer(cinfo.name))
+	return screen
+}
+
+// Screen returns the screen the window is shown on.
+func (win *Window) Screen() Screen {
+	var screen Screen
+	gui(func() {
+		var cinfo C.ScreenInfo
+		C.viewScreen(win.obj.addr, &cinfo)
+		screen = screenFromInfo(&cinfo)
+	})
+	return screen
+}
+
+// SetScreen moves the window onto the given screen, keeping its position
+// relative to the area of the screen available to windows, as far as
+// the window fits in the new one. The screen is looked up by name, so
+// an error is returned if it is not attached to the system anymore.
+func (win *Window) SetScreen(screen Screen) error {
+	var ok C.int
+	gui(func() {
+		cname, cnamelen := unsafeStringData(screen.Name)
+		ok = C.viewSetScreen(win.obj.addr, cname, cnamelen)
+	})
+	if ok == 0 {
+		return fmt.Errorf("cannot move window to screen %q: screen not found", screen.Name)
+	}
+	return nil
+}
+
+// OnScreensChanged registers f to be called with the screens attached to
+// the system whenever a screen is attached or detached, such as when a
+// laptop is docked, or the primary screen changes, replacing any
+// function previously registered. If f is nil, changes are not reported
+// anymore. The function is called in a goroutine owned by the package.
+// See the Callbacks section of the package documentation.
+func OnScreensChanged(f func(screens []Screen)) {
+	gui(func() {
+		screensChanged = f
+		if !screensWatched {
+			screensWatched = true
+			C.applicationWatchScreens()
+		}
+	})
+}
+
+//export hookScreensChanged
+func hookScreensChanged() {
+	if !onGuiThread("hookScreensChanged") {
+		gui(func() { hookScreensChanged() })
+		return
+	}
+	f := screensChanged
+	if f == nil {
+		return
+	}
+	screens := currentScreens()
+	screensQueue.dispatch(func() { f(screens) })
+}
@@ -0,0 +1,68 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetScriptTimeout limits how long any single JavaScript execution of the
+// engine, such as the evaluation of a binding or of a signal handler, may
+// run without returning, so that a script stuck in a loop does not freeze
+// the application. Executions running longer than d are aborted, and
+// reported as a warning to the logger set via SetLogger with the location
+// of the script. A zero duration removes the limit.
+//
+// Frames that evaluate many short scripts never trigger the timeout, as
+// only uninterrupted executions are considered. These are detected by
+// sampling the engine from a separate thread about 20 times within d, so
+// the timeout is approximate, and not meant to be tighter than a few
+// milliseconds.
+//
+// SetScriptTimeout returns ErrUnsupported with Qt versions before 5.14,
+// which cannot interrupt scripts.
+func (e *Engine) SetScriptTimeout(d time.Duration) error {
+	e.assertValid()
+	if d < 0 {
+		return fmt.Errorf("invalid script timeout: %v", d)
+	}
+	var err error
+	gui(func() {
+		if e.watchdog == nilPtr {
+			if d == 0 {
+				return
+			}
+			e.watchdog = C.newScriptWatchdog(e.addr)
+			if e.watchdog == nilPtr {
+				err = ErrUnsupported
+				return
+			}
+		}
+		msec := d / time.Millisecond
+		if msec == 0 && d > 0 {
+			msec = 1
+		}
+		C.scriptWatchdogSetTimeout(e.watchdog, C.int(msec))
+	})
+	return err
+}
+
+// InterruptScripts aborts the JavaScript execution of the engine that is
+// running at the time, if any, such as one stuck in a loop. Differently
+// from most engine methods, InterruptScripts does not wait for the main
+// GUI thread, so it may be called by a watchdog goroutine while the GUI
+// thread is stuck running the script. Scripts that start before the GUI
+// loop gets to process events again are aborted too.
+//
+// InterruptScripts returns ErrUnsupported with Qt versions before 5.14,
+// which cannot interrupt scripts.
+func (e *Engine) InterruptScripts() error {
+	e.assertValid()
+	if C.engineInterruptScripts(e.addr) == 0 {
+		return ErrUnsupported
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// SerializeOptions holds options for Object.SerializeQML.
+type SerializeOptions struct {
+	// SkipBindings causes properties set by bindings to be omitted,
+	// rather than serialized with their current value.
+	SkipBindings bool
+
+	// CommentBindings causes properties set by bindings and serialized
+	// with their current value to be marked with a trailing comment.
+	CommentBindings bool
+}
+
+// SerializeQML returns QML source that reproduces the visual item obj and
+// its visual children, so that scenes built dynamically may be saved as
+// documents. Each item is serialized with its element type, the imports
+// of the modules defining the types used, and the properties with values
+// different from the defaults of the type, followed by its children in
+// order:
+//
+//     import QtQuick 2.0
+//
+//     Rectangle {
+//         width: 100
+//         height: 50
+//         color: "#ffff0000"
+//
+//         Text {
+//             text: "Hello"
+//         }
+//     }
+//
+// Items of types registered via RegisterType and related functions are
+// serialized by their QML type name, with the values of the fields they
+// expose.
+//
+// The serialization is meant to preserve the structure and the property
+// values, not the source the items were created from:
+//
+//   - Ids, bindings, signal handlers, states, and transitions are not
+//     serialized. Properties set by bindings are serialized with their
+//     current value, unless SkipBindings is set.
+//   - Grouped and attached properties, such as anchors, font, and
+//     Layout, are not serialized. Items positioned by anchors or by
+//     layouts are serialized with their resulting position and size.
+//   - Only properties holding numbers, strings, booleans, enumerations,
+//     colors, urls, points, sizes, and rectangles are serialized.
+//   - Items defined by QML documents are serialized as the type they
+//     are based on, including the items defined within the document.
+//   - Non-visual children, such as timers and models, are not serialized.
+//
+// An error is returned if obj is not a visual item, or if some item has
+// no QML type.
+func (obj *Object) SerializeQML(opts *SerializeOptions) (string, error) {
+	obj.assertLive()
+	if opts == nil {
+		opts = &SerializeOptions{}
+	}
+	var report string
+	var isItem bool
+	gui(func() {
+		creport := C.itemSerializeReport(obj.addr)
+		if isItem = creport != nilCharPtr; isItem {
+			report = C.GoString(creport)
+			C.free(unsafe.Pointer(creport))
+		}
+	})
+	if !isItem {
+		return "", fmt.Errorf("cannot serialize object: not a visual item")
+	}
+
+	imports := make(map[string]int)
+	var body bytes.Buffer
+	open := 0
+	closeTo := func(depth int) {
+		for open > depth {
+			open--
+			body.WriteString(strings.Repeat("    ", open) + "}\n")
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(report, "\n"), "\n") {
+		fields := strings.SplitN(line, "\t", 6)
+		switch fields[0] {
+		case "E":
+			return "", fmt.Errorf("cannot serialize object of class %s: not a QML type", fields[1])
+		case "I":
+			depth, _ := strconv.Atoi(fields[1])
+			module, name := fields[2], fields[5]
+			major, _ := strconv.Atoi(fields[3])
+			minor, _ := strconv.Atoi(fields[4])
+			if module != "" {
+				key := module + " " + strconv.Itoa(major)
+				if v, ok := imports[key]; !ok || v < minor {
+					imports[key] = minor
+				}
+			}
+			closeTo(depth)
+			if depth > 0 {
+				body.WriteString("\n")
+			}
+			body.WriteString(strings.Repeat("    ", depth) + name + " {\n")
+			open++
+		case "P":
+			bound := fields[2] == "1"
+			if bound && opts.SkipBindings {
+				continue
+			}
+			body.WriteString(strings.Repeat("    ", open) + fields[1] + ": " + fields[3])
+			if bound && opts.CommentBindings {
+				body.WriteString(" // bound")
+			}
+			body.WriteString("\n")
+		}
+	}
+	closeTo(0)
+
+	var keys []string
+	for key := range imports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var src bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&src, "import %s.%d\n", key, imports[key])
+	}
+	if len(keys) > 0 {
+		src.WriteString("\n")
+	}
+	src.Write(body.Bytes())
+	return src.String(), nil
+}
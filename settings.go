@@ -0,0 +1,243 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"image/color"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// SettingsStore holds persistent application settings, such as window
+// geometry and user preferences, as stored by QSettings in the standard
+// location of the platform. See Settings.
+type SettingsStore struct {
+	addr   unsafe.Pointer
+	prefix string
+}
+
+// settingsAddrs holds the QSettings objects for each organization and
+// application pair, which are kept alive so that changes are written in
+// the background by the GUI loop rather than on every change.
+//
+// Only accessed from the main GUI thread.
+var settingsAddrs = make(map[[2]string]unsafe.Pointer)
+
+// Settings returns the persistent settings of the named application by
+// the named organization. If both names are empty, the names set via
+// InitOptions are used, which are the ones Settings elements of the
+// Qt.labs.settings module use as well, so that Go and QML code see the
+// same values. The category property of those elements matches the
+// settings returned by Group:
+//
+//     settings := qml.Settings("", "")
+//     width := settings.Get("window/width", 800)
+//
+//     Settings { category: "window"; property int width: 800 }
+//
+// Values are converted as done for QML, so strings, booleans, numbers,
+// times, colors, and slices and maps holding them may be stored, and
+// read back with the same types as values provided by QML. Changes are
+// written to permanent storage in the background, or by Sync.
+//
+// The settings may be used from any goroutine.
+func Settings(organization, application string) *SettingsStore {
+	corg, corglen := unsafeStringData(organization)
+	capp, capplen := unsafeStringData(application)
+	settings := &SettingsStore{}
+	gui(func() {
+		key := [2]string{organization, application}
+		addr, ok := settingsAddrs[key]
+		if !ok {
+			addr = C.newSettings(corg, corglen, capp, capplen)
+			settingsAddrs[key] = addr
+		}
+		settings.addr = addr
+	})
+	return settings
+}
+
+// Group returns the settings within the named group of s. Group names
+// and keys may also hold groups separated by slashes, so that
+// s.Group("window").Get("width", 0) is the same as s.Get("window/width", 0).
+func (s *SettingsStore) Group(name string) *SettingsStore {
+	return &SettingsStore{addr: s.addr, prefix: s.prefix + strings.Trim(name, "/") + "/"}
+}
+
+// Get returns the value of key, or def if key is not set. If def is not
+// nil and the value has a different type, it's converted to the type of
+// def when possible, so that numbers and booleans read from settings
+// stored as text, as done on Linux, come back with their original type.
+func (s *SettingsStore) Get(key string, def interface{}) interface{} {
+	ckey, ckeylen := unsafeStringData(s.prefix + key)
+	var dvalue C.DataValue
+	var found C.int
+	gui(func() {
+		found = C.settingsValue(s.addr, ckey, ckeylen, &dvalue)
+	})
+	if found == 0 {
+		return def
+	}
+	value := unpackDataValue(&dvalue, nil)
+	if def == nil || value == nil {
+		return value
+	}
+	typ := reflect.TypeOf(def)
+	if text, ok := value.(string); ok && typ.Kind() != reflect.String {
+		if parsed, ok := parseSetting(text, typ); ok {
+			value = parsed
+		}
+	}
+	if v, err := coerce(value, typ); err == nil {
+		return v.Interface()
+	}
+	return value
+}
+
+// parseSetting parses text stored in settings as a value of typ.
+func parseSetting(text string, typ reflect.Type) (interface{}, bool) {
+	switch typ.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		return b, err == nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, 64)
+		return i, err == nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, 64)
+		return u, err == nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// Contains returns whether key is set.
+func (s *SettingsStore) Contains(key string) bool {
+	ckey, ckeylen := unsafeStringData(s.prefix + key)
+	var dvalue C.DataValue
+	var found C.int
+	gui(func() {
+		found = C.settingsValue(s.addr, ckey, ckeylen, &dvalue)
+	})
+	if found != 0 {
+		// Releases the memory held by packed lists and maps.
+		unpackDataValue(&dvalue, nil)
+	}
+	return found != 0
+}
+
+// Set sets the value of key. Set panics if value holds values other than
+// the ones documented in Settings, such as Go structs or QML objects,
+// which cannot be stored.
+func (s *SettingsStore) Set(key string, value interface{}) {
+	if err := checkSettingsValue(reflect.ValueOf(value)); err != nil {
+		panic(fmt.Sprintf("cannot store %T value in settings key %q: %v", value, key, err))
+	}
+	ckey, ckeylen := unsafeStringData(s.prefix + key)
+	gui(func() {
+		var dvalue C.DataValue
+		packDataValue(value, &dvalue, nil, cppOwner)
+		C.settingsSetValue(s.addr, ckey, ckeylen, &dvalue)
+	})
+}
+
+// Remove removes key, or all keys within the group named by key.
+func (s *SettingsStore) Remove(key string) {
+	ckey, ckeylen := unsafeStringData(s.prefix + key)
+	gui(func() {
+		C.settingsRemove(s.addr, ckey, ckeylen)
+	})
+}
+
+// Keys returns the keys set directly within s, excluding the ones within
+// its groups.
+func (s *SettingsStore) Keys() []string {
+	return s.children(0)
+}
+
+// Groups returns the names of the groups within s.
+func (s *SettingsStore) Groups() []string {
+	return s.children(1)
+}
+
+func (s *SettingsStore) children(groups C.int) []string {
+	cgroup, cgrouplen := unsafeStringData(strings.TrimSuffix(s.prefix, "/"))
+	var cnames *C.char
+	gui(func() {
+		cnames = C.settingsChildren(s.addr, cgroup, cgrouplen, groups)
+	})
+	defer C.free(unsafe.Pointer(cnames))
+	names := C.GoString(cnames)
+	if names == "" {
+		return nil
+	}
+	return strings.Split(names, "\n")
+}
+
+// Sync writes the changes made to permanent storage, and reads the
+// changes made meanwhile by other applications.
+func (s *SettingsStore) Sync() error {
+	var status C.int
+	gui(func() {
+		status = C.settingsSync(s.addr)
+	})
+	switch status {
+	case 1:
+		return fmt.Errorf("cannot sync settings: access error")
+	case 2:
+		return fmt.Errorf("cannot sync settings: format error")
+	}
+	return nil
+}
+
+// checkSettingsValue returns an error if v cannot be stored in settings.
+func checkSettingsValue(v reflect.Value) error {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Interface().(type) {
+	case time.Time, time.Duration, url.URL, *url.URL:
+		return nil
+	}
+	if _, ok := v.Interface().(color.Color); ok {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return nil
+	case reflect.Interface:
+		return checkSettingsValue(v.Elem())
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkSettingsValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("map keys must be strings")
+		}
+		for _, key := range v.MapKeys() {
+			if err := checkSettingsValue(v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s values cannot be stored", v.Type())
+}
@@ -0,0 +1,172 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"time"
+
+	"github.com/niemeyer/qml/tref"
+)
+
+// windows holds the windows created via CreateWindow that were not
+// destroyed yet, in the order they were created.
+//
+// Only accessed from the main GUI thread.
+var windows []*Window
+
+// forgetWindow removes win from the list of windows.
+//
+// This must be run from the main GUI thread.
+func forgetWindow(win *Window) {
+	for i, w := range windows {
+		if w == win {
+			copy(windows[i:], windows[i+1:])
+			windows[len(windows)-1] = nil
+			windows = windows[:len(windows)-1]
+			return
+		}
+	}
+}
+
+// SetGroup puts the window in the named group, so that it may be closed
+// together with the other windows in the group via CloseGroup. A window
+// is in a single group at a time, and an empty name takes it out of
+// any group.
+func (win *Window) SetGroup(name string) {
+	gui(func() {
+		win.group = name
+	})
+}
+
+// Group returns the name of the group the window is in, as defined by
+// SetGroup.
+func (win *Window) Group() string {
+	var name string
+	gui(func() {
+		name = win.group
+	})
+	return name
+}
+
+// Close attempts to close the window as if the user had requested it,
+// so the functions registered via OnClosing may prevent it. Close
+// returns whether the window was closed, in which case it is hidden.
+// Windows already destroyed are reported as closed.
+func (win *Window) Close() bool {
+	closed := C.int(1)
+	gui(func() {
+		if win.obj.addr != nilPtr && (win.obj.engine == nil || !win.obj.engine.isDestroyed()) {
+			closed = C.viewClose(win.obj.addr)
+		}
+	})
+	return closed != 0
+}
+
+// CloseVetoError is returned by CloseAll and CloseGroup when a window
+// prevents being closed.
+type CloseVetoError struct {
+	// Window is the window that prevented being closed.
+	Window *Window
+
+	// Forced is whether the window was hidden anyway once the
+	// timeout was reached.
+	Forced bool
+}
+
+func (e *CloseVetoError) Error() string {
+	if e.Forced {
+		return "window prevented being closed and was hidden after timeout"
+	}
+	return "window prevented being closed"
+}
+
+// CloseAll closes all visible windows, one at a time and in the reverse
+// order they were created, so dialogs and other windows created after
+// the main window of an application are closed before it. Each window
+// is closed as done by Window.Close, so the functions registered via
+// OnClosing may prevent it, for example to ask whether unsaved changes
+// should be saved.
+//
+// With a zero timeout, CloseAll stops at the first window that prevents
+// being closed, leaving it and the windows not yet closed visible, and
+// returns a *CloseVetoError reporting the window. With a positive
+// timeout, windows that prevent being closed are given until timeout
+// elapses, counted from the start of CloseAll, to close themselves, such
+// as after the user answers a dialog. Windows still visible by then are
+// hidden anyway, and the first of them is reported in the returned
+// *CloseVetoError, with its Forced field set.
+//
+// Goroutines blocked in Window.Wait are released as each window is
+// closed. Closing windows never stops the GUI event loop, as the package
+// does not quit when the last window is closed, so engines may be safely
+// destroyed once CloseAll returns:
+//
+//     if err := qml.CloseAll(5 * time.Second); err != nil {
+//         log.Print(err)
+//     }
+//     engine.Destroy()
+//
+// CloseAll must not be called from the main GUI thread, as it blocks
+// while the windows are closed.
+func CloseAll(timeout time.Duration) error {
+	return closeWindows(func(win *Window) bool { return true }, timeout)
+}
+
+// CloseGroup works as CloseAll, but only closes the windows in the named
+// group, as defined via Window.SetGroup.
+func CloseGroup(name string, timeout time.Duration) error {
+	return closeWindows(func(win *Window) bool { return win.group == name }, timeout)
+}
+
+// closeWindows closes the visible windows selected by match as
+// documented in CloseAll. The match function is run from the main
+// GUI thread.
+func closeWindows(match func(win *Window) bool, timeout time.Duration) error {
+	if tref.Ref() == guiLoopRef {
+		panic("cannot close windows from the main GUI thread")
+	}
+	deadline := time.Now().Add(timeout)
+	var selected []*Window
+	gui(func() {
+		for i := len(windows) - 1; i >= 0; i-- {
+			win := windows[i]
+			if win.obj.engine != nil && win.obj.engine.isDestroyed() {
+				// Destroyed with the engine.
+				forgetWindow(win)
+				continue
+			}
+			if C.viewIsVisible(win.obj.addr) != 0 && match(win) {
+				selected = append(selected, win)
+			}
+		}
+	})
+	var forced *CloseVetoError
+	for _, win := range selected {
+		if win.Close() {
+			continue
+		}
+		if timeout <= 0 {
+			return &CloseVetoError{Window: win}
+		}
+		hidden := make(chan bool)
+		go func(win *Window) {
+			win.Wait()
+			close(hidden)
+		}(win)
+		select {
+		case <-hidden:
+			continue
+		case <-time.After(deadline.Sub(time.Now())):
+		}
+		win.Hide()
+		if forced == nil {
+			forced = &CloseVetoError{Window: win, Forced: true}
+		}
+	}
+	if forced != nil {
+		return forced
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package qml
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// StateSnapshot returns the values of the named properties of obj and of
+// its descendants up to depth levels below it, or all of them if depth is
+// negative, as a nested map meant to be compared against golden values
+// in tests via DiffSnapshots. Unlike images of the rendered scene, the
+// snapshot is unaffected by fonts, antialiasing, and graphic drivers.
+//
+// The map of each object holds the values of the properties it has, and
+// the maps of its children under the "children" key. Children are keyed
+// by their objectName, or by their position among the children of their
+// parent when unnamed or when siblings share the name, as in "#2":
+//
+//     {
+//         "width": 200,
+//         "children": {
+//             "okButton": {"width": 80, "children": {...}},
+//             "#1": {"width": 120}
+//         }
+//     }
+//
+// Values are converted to the types the encoding/json package produces
+// when unmarshaling into an interface{}, so that snapshots may be stored
+// as JSON and compared with the live ones as is. Numbers become float64
+// values rounded to 10 significant digits, colors become "#aarrggbb"
+// strings, times become RFC 3339 strings, objects become their objectName,
+// lists become []interface{} values, and other values become the string
+// formatted by the fmt package.
+//
+// An error is returned if obj itself lacks one of the properties.
+// Descendants lacking properties have them omitted from their map.
+func (obj *Object) StateSnapshot(props []string, depth int) (map[string]interface{}, error) {
+	obj.assertLive()
+	var snapshot map[string]interface{}
+	var err error
+	gui(func() {
+		for _, prop := range props {
+			if _, ok := obj.property(prop); !ok {
+				err = fmt.Errorf("cannot snapshot object: object does not have a %q property", prop)
+				return
+			}
+		}
+		snapshot = obj.stateSnapshot(props, depth)
+	})
+	return snapshot, err
+}
+
+func (obj *Object) stateSnapshot(props []string, depth int) map[string]interface{} {
+	snapshot := make(map[string]interface{})
+	for _, prop := range props {
+		if value, ok := obj.property(prop); ok {
+			snapshot[prop] = snapshotValue(value)
+		}
+	}
+	if depth == 0 {
+		return snapshot
+	}
+	children := obj.Children()
+	if len(children) == 0 {
+		return snapshot
+	}
+	names := make([]string, len(children))
+	seen := make(map[string]int)
+	for i, child := range children {
+		names[i] = child.StringOr("objectName", "")
+		seen[names[i]]++
+	}
+	childMaps := make(map[string]interface{})
+	for i, child := range children {
+		key := names[i]
+		if key == "" || seen[key] > 1 {
+			key += "#" + strconv.Itoa(i)
+		}
+		childMaps[key] = child.stateSnapshot(props, depth-1)
+	}
+	snapshot["children"] = childMaps
+	return snapshot
+}
+
+// snapshotValue returns value converted as documented in StateSnapshot.
+func snapshotValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string, bool:
+		return value
+	case *Object:
+		return value.StringOr("objectName", "")
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case color.Color:
+		c := color.NRGBAModel.Convert(value).(color.NRGBA)
+		return fmt.Sprintf("#%02x%02x%02x%02x", c.A, c.R, c.G, c.B)
+	}
+	if f, ok := roundTripNumber(value); ok {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 10, 64), 64)
+		return f
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = snapshotValue(rv.Index(i).Interface())
+		}
+		return list
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]interface{}, rv.Len())
+			for _, key := range rv.MapKeys() {
+				m[key.String()] = snapshotValue(rv.MapIndex(key).Interface())
+			}
+			return m
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// Difference describes a value that differs between two snapshots, as
+// reported by DiffSnapshots.
+type Difference struct {
+	// Path identifies the value, such as "children.okButton.width".
+	// List items are identified by their index, as in "model[2]".
+	Path string
+
+	// A and B hold the value in each snapshot. MissingA and MissingB
+	// report whether the value is missing from the respective snapshot,
+	// in which case the respective value is nil.
+	A, B     interface{}
+	MissingA bool
+	MissingB bool
+}
+
+// String returns a readable description of the difference, such as
+// `children.okButton.width: 80 != 96`.
+func (d Difference) String() string {
+	a, b := formatSnapshotValue(d.A), formatSnapshotValue(d.B)
+	if d.MissingA {
+		a = "<missing>"
+	}
+	if d.MissingB {
+		b = "<missing>"
+	}
+	return d.Path + ": " + a + " != " + b
+}
+
+func formatSnapshotValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprint(value)
+}
+
+// DiffSnapshots returns the differences between the snapshots a and b,
+// as obtained via Object.StateSnapshot or by unmarshaling JSON data, in
+// the order of their paths. Numbers are compared by their float64 value.
+// See DiffSnapshotsWithin for comparing numbers with a tolerance.
+func DiffSnapshots(a, b map[string]interface{}) []Difference {
+	return DiffSnapshotsWithin(a, b, 0)
+}
+
+// DiffSnapshotsWithin works as DiffSnapshots, but numbers are considered
+// equal when they differ by no more than tolerance, so that positions
+// and sizes computed differently across platforms don't break tests.
+func DiffSnapshotsWithin(a, b map[string]interface{}, tolerance float64) []Difference {
+	var diffs []Difference
+	diffSnapshotMaps(a, b, "", tolerance, &diffs)
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+func diffSnapshotMaps(a, b map[string]interface{}, prefix string, tolerance float64, diffs *[]Difference) {
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	for key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		av, aok := a[key]
+		bv, bok := b[key]
+		switch {
+		case !aok:
+			*diffs = append(*diffs, Difference{Path: path, B: bv, MissingA: true})
+		case !bok:
+			*diffs = append(*diffs, Difference{Path: path, A: av, MissingB: true})
+		default:
+			diffSnapshotValues(av, bv, path, tolerance, diffs)
+		}
+	}
+}
+
+func diffSnapshotValues(a, b interface{}, path string, tolerance float64, diffs *[]Difference) {
+	if am, ok := a.(map[string]interface{}); ok {
+		if bm, ok := b.(map[string]interface{}); ok {
+			diffSnapshotMaps(am, bm, path, tolerance, diffs)
+			return
+		}
+	}
+	if al, ok := a.([]interface{}); ok {
+		if bl, ok := b.([]interface{}); ok && len(al) == len(bl) {
+			for i := range al {
+				diffSnapshotValues(al[i], bl[i], path+"["+strconv.Itoa(i)+"]", tolerance, diffs)
+			}
+			return
+		}
+	}
+	if fa, ok := roundTripNumber(a); ok {
+		if fb, ok := roundTripNumber(b); ok && math.Abs(fa-fb) <= tolerance {
+			return
+		}
+	} else if reflect.DeepEqual(a, b) {
+		return
+	}
+	*diffs = append(*diffs, Difference{Path: path, A: a, B: b})
+}
@@ -0,0 +1,281 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SaveStateDeadline is how long the functions registered via OnSaveState
+// have to complete, once the application is asked to save its state.
+const SaveStateDeadline = 3 * time.Second
+
+// StateSaver collects the state of the application, from Go values and
+// from properties of QML objects, when the application is about to be
+// suspended or terminated. See OnSaveState.
+type StateSaver struct {
+	mutex    sync.Mutex
+	deadline time.Time
+	values   map[string]interface{}
+	objects  map[string]map[string]interface{}
+	problems []string
+}
+
+// savedState is the serialized form of the state collected by a StateSaver.
+type savedState struct {
+	Values  map[string]interface{}            `json:"values,omitempty"`
+	Objects map[string]map[string]interface{} `json:"objects,omitempty"`
+}
+
+var (
+	saveStateMutex    sync.Mutex
+	saveStateHandlers []func(s *StateSaver)
+)
+
+// OnSaveState registers f to be called when the application is about to
+// be suspended or terminated by the system, so that it may collect its
+// state into s and store the result of s.Bytes, which may be provided to
+// RestoreState once the application runs again:
+//
+//     qml.OnSaveState(func(s *qml.StateSaver) {
+//         s.Set("document", doc.Path)
+//         s.Include(list, "contentY")
+//         data, err := s.Bytes()
+//         ...
+//     })
+//
+// The state is saved when the session manager asks the application to
+// commit its data, when the application is suspended with Qt 5.2 or later,
+// or when SaveState is called.
+//
+// Each function is called in its own goroutine with its own StateSaver,
+// and the state is saved by the time it returns. All of them must return
+// within SaveStateDeadline, as the system may terminate the application
+// soon after. Meanwhile the main GUI thread only runs functions requested
+// by the qml package, so QML code and other events are not processed, and
+// s.Include and other functions of the package may be used.
+func OnSaveState(f func(s *StateSaver)) {
+	saveStateMutex.Lock()
+	saveStateHandlers = append(saveStateHandlers, f)
+	saveStateMutex.Unlock()
+}
+
+// SaveState calls the functions registered via OnSaveState as done when
+// the system asks the application to save its state, and returns once
+// they all return, or once SaveStateDeadline elapses. It returns an error
+// if the deadline elapses first.
+func SaveState() error {
+	var err error
+	gui(func() {
+		err = saveState()
+	})
+	return err
+}
+
+// saveState calls the functions registered via OnSaveState.
+//
+// This must be run from the main GUI thread.
+func saveState() error {
+	saveStateMutex.Lock()
+	handlers := saveStateHandlers
+	saveStateMutex.Unlock()
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(SaveStateDeadline)
+	done := make(chan bool)
+	var wg sync.WaitGroup
+	for _, f := range handlers {
+		s := &StateSaver{
+			deadline: deadline,
+			values:   make(map[string]interface{}),
+			objects:  make(map[string]map[string]interface{}),
+		}
+		wg.Add(1)
+		go func(f func(s *StateSaver)) {
+			defer wg.Done()
+			f(s)
+		}(f)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	if !guiServe(done, deadline.Sub(time.Now())) {
+		return errors.New("cannot save state: functions did not return within the deadline")
+	}
+	return nil
+}
+
+//export hookSaveState
+func hookSaveState() {
+	if !onGuiThread("hookSaveState") {
+		gui(hookSaveState)
+		return
+	}
+	if err := saveState(); err != nil {
+		log.Printf("qml: %v", err)
+	}
+}
+
+// Deadline returns the time by which the state must be saved.
+func (s *StateSaver) Deadline() time.Time {
+	return s.deadline
+}
+
+// Set sets the state under key to value, which must be serializable
+// via the encoding/json package.
+func (s *StateSaver) Set(key string, value interface{}) {
+	s.mutex.Lock()
+	s.values[key] = value
+	s.mutex.Unlock()
+}
+
+// Include adds the current values of the named properties of obj to the
+// state, so that RestoredState.Apply may set them back. The object is
+// identified by its objectName property, which must be set and unique
+// among the objects included. Problems found, such as unknown properties
+// or values that cannot be serialized, are reported by Bytes, and do not
+// prevent the rest of the state from being saved.
+func (s *StateSaver) Include(obj *Object, properties ...string) {
+	name := obj.String("objectName")
+	values := make(map[string]interface{})
+	var problems []string
+	if name == "" {
+		problems = append(problems, "cannot include object without objectName")
+	} else {
+		for _, property := range properties {
+			value, ok := obj.property(property)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("cannot include property %q of %q: object has no such property", property, name))
+				continue
+			}
+			if _, err := json.Marshal(value); err != nil {
+				problems = append(problems, fmt.Sprintf("cannot include property %q of %q: %v", property, name, err))
+				continue
+			}
+			values[property] = value
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.problems = append(s.problems, problems...)
+	if name == "" {
+		return
+	}
+	if s.objects[name] == nil {
+		s.objects[name] = values
+		return
+	}
+	for property, value := range values {
+		s.objects[name][property] = value
+	}
+}
+
+// Bytes returns the state collected so far serialized, for providing to
+// RestoreState later. If problems were found while collecting the state,
+// the state collected in spite of them is returned together with an error
+// describing them.
+func (s *StateSaver) Bytes() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state := savedState{Values: make(map[string]interface{}), Objects: s.objects}
+	problems := s.problems
+	for key, value := range s.values {
+		if _, err := json.Marshal(value); err != nil {
+			problems = append(problems, fmt.Sprintf("cannot save value %q: %v", key, err))
+			continue
+		}
+		state.Values[key] = value
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return nil, fmt.Errorf("cannot save state: %v", err)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return data, errors.New(strings.Join(problems, "; "))
+	}
+	return data, nil
+}
+
+// RestoredState holds the state saved via a StateSaver. See RestoreState.
+type RestoredState struct {
+	values  map[string]json.RawMessage
+	objects map[string]map[string]interface{}
+}
+
+// RestoreState parses state previously obtained via StateSaver.Bytes.
+// The values set via StateSaver.Set are then available via Get, and the
+// properties of the objects provided to StateSaver.Include may be set
+// back via Apply once the interface is loaded.
+func RestoreState(data []byte) (*RestoredState, error) {
+	var state struct {
+		Values  map[string]json.RawMessage        `json:"values"`
+		Objects map[string]map[string]interface{} `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("cannot restore state: %v", err)
+	}
+	return &RestoredState{state.Values, state.Objects}, nil
+}
+
+// Get unmarshals the value saved under key into value, as done by the
+// encoding/json package, and returns whether a value was saved under key.
+func (st *RestoredState) Get(key string, value interface{}) (bool, error) {
+	data, ok := st.values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return true, fmt.Errorf("cannot restore value %q: %v", key, err)
+	}
+	return true, nil
+}
+
+// Apply sets the saved properties of the objects included in the state
+// on the descendants of root with the same objectName, or on root itself.
+// Problems found, such as objects that cannot be found, do not prevent
+// the remaining properties from being set, and are reported together
+// by the returned error.
+func (st *RestoredState) Apply(root *Object) error {
+	var problems []string
+	gui(func() {
+		rootName := root.String("objectName")
+		for name, values := range st.objects {
+			obj := root
+			if name != rootName {
+				var dvalue C.DataValue
+				cname, cnamelen := unsafeStringData(name)
+				qname := C.newString(cname, cnamelen)
+				C.objectFindChild(root.addr, qname, &dvalue)
+				C.delString(qname)
+				var ok bool
+				if obj, ok = unpackDataValue(&dvalue, root.engine).(*Object); !ok {
+					problems = append(problems, fmt.Sprintf("cannot find object %q", name))
+					continue
+				}
+			}
+			for property, value := range values {
+				if err := obj.Set(property, value); err != nil {
+					problems = append(problems, fmt.Sprintf("cannot restore %q of %q: %v", property, name, err))
+				}
+			}
+		}
+	})
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -1,59 +1,281 @@
 package qml
 
 import (
+	"log"
+	"reflect"
+	"runtime"
 	"sync"
+	"sync/atomic"
 )
 
-var stats *Statistics
+// collected holds the statistics being collected, if enabled via
+// CollectStats. It's guarded by statsMutex, as it's updated from the
+// main GUI thread while other goroutines take snapshots of it.
+var collected *Statistics
 var statsMutex sync.Mutex
 
+// stats records changes into the collected statistics, if enabled.
+var stats statsRecorder
+
+type statsRecorder struct{}
+
+// Stats returns a snapshot of the statistics collected since the last
+// call to ResetStats, or since collection was enabled via CollectStats.
+// The zero Statistics value is returned if collection is disabled.
+//
+// Stats may be called from any goroutine.
 func Stats() (snapshot Statistics) {
 	statsMutex.Lock()
-	snapshot = *stats
+	if collected != nil {
+		snapshot = *collected
+	}
 	statsMutex.Unlock()
 	return
 }
 
+// CollectStats enables or disables the collection of statistics about
+// the resources held by the package, as reported by Stats. Collection
+// is disabled by default, and disabling it discards the statistics
+// collected so far.
+//
+// The counts of alive resources only account for the resources created
+// and released while collection is enabled, so it should be enabled
+// before any engine is created for these counts to be exact.
 func CollectStats(enabled bool) {
 	statsMutex.Lock()
 	if enabled {
-		if stats == nil {
-			stats = &Statistics{}
+		if collected == nil {
+			collected = &Statistics{}
+		}
+		if atomic.CompareAndSwapInt32(&gcWatching, 0, 1) {
+			watchGC()
 		}
 	} else {
-		stats = nil
+		collected = nil
 	}
 	statsMutex.Unlock()
 }
 
+// ResetStats resets the cumulative statistics, such as ValuesCreated,
+// while preserving the counts of alive resources. It has no effect if
+// collection is disabled.
 func ResetStats() {
 	statsMutex.Lock()
-	old := stats
-	stats = &Statistics{}
-	// These are absolute values:
-	stats.EnginesAlive = old.EnginesAlive
-	stats.ValuesAlive = old.ValuesAlive
+	old := collected
+	if old != nil {
+		collected = &Statistics{}
+		// These are absolute values:
+		collected.EnginesAlive = old.EnginesAlive
+		collected.ValuesAlive = old.ValuesAlive
+		collected.ObjectsAlive = old.ObjectsAlive
+	}
 	statsMutex.Unlock()
 	return
 }
 
+// Statistics holds the statistics collected while CollectStats is
+// enabled. Tests may compare the counts of alive resources before and
+// after some logic runs to find out whether it leaks them.
 type Statistics struct {
+	// EnginesAlive counts the engines created and not yet fully
+	// released. Destroying an engine releases it once its values
+	// are released as well.
 	EnginesAlive int
-	ValuesAlive  int
+
+	// ValuesAlive counts the Go values wrapped for use by QML and not
+	// yet released. Values are held by their engine while referenced
+	// by QML, so a count that keeps growing is a sign of values that
+	// are set into contexts or objects and never dropped.
+	ValuesAlive int
+
+	// ObjectsAlive counts the QML objects and windows created from Go
+	// via Object.Create and Object.CreateWindow and not yet destroyed,
+	// either via Object.Destroy or along with their engine.
+	ObjectsAlive int
+
+	// ValuesCreated and ValuesEvicted count the values wrapped for use
+	// by QML and the ones released again because the garbage collector
+	// of a live engine disposed of their JavaScript references.
+	ValuesCreated int
+	ValuesEvicted int
+
+	// ValuesResurrected counts the evicted values that were wrapped for
+	// use by QML again by the same engine, which means the JavaScript
+	// references to them are dropped and recreated over and over. Only
+	// pointer values are accounted for, and only until the next Go
+	// garbage collection cycle after they were evicted, as the records
+	// don't keep the values alive and their memory may be reused after
+	// that.
+	ValuesResurrected int
+}
+
+// leakDetection is set to 1 while leak detection is enabled.
+var leakDetection int32
+
+// SetLeakDetection enables or disables the detection of Go values that
+// are garbage collected while QML still references them, which happens
+// if the package loses track of a wrapped value and is likely to crash
+// the application later on. Each detected value is logged along with
+// its type. Only values wrapped while detection is enabled are checked,
+// and checking them delays the collection of released values, so leak
+// detection is meant for tests and debugging sessions.
+func SetLeakDetection(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&leakDetection, v)
+}
+
+// watchFold arranges for fold to be reported if it's garbage collected
+// before being released, when leak detection is enabled.
+//
+// This must be run from the main GUI thread.
+func watchFold(fold *valueFold) {
+	if atomic.LoadInt32(&leakDetection) == 0 {
+		return
+	}
+	fold.watched = true
+	runtime.SetFinalizer(fold, func(fold *valueFold) {
+		log.Printf("qml: Go value of type %T was garbage collected while still referenced by QML", fold.gvalue)
+	})
+}
+
+// unwatchFold stops reporting fold once it is released.
+//
+// This must be run from the main GUI thread.
+func unwatchFold(fold *valueFold) {
+	if fold.watched {
+		fold.watched = false
+		runtime.SetFinalizer(fold, nil)
+	}
+}
+
+func (statsRecorder) enginesAlive(delta int) {
+	statsMutex.Lock()
+	if collected != nil {
+		collected.EnginesAlive += delta
+	}
+	statsMutex.Unlock()
+}
+
+func (statsRecorder) valuesAlive(delta int) {
+	statsMutex.Lock()
+	if collected != nil {
+		collected.ValuesAlive += delta
+		if delta > 0 {
+			collected.ValuesCreated += delta
+		}
+	}
+	statsMutex.Unlock()
+}
+
+func (statsRecorder) valuesEvicted(delta int) {
+	statsMutex.Lock()
+	if collected != nil {
+		collected.ValuesEvicted += delta
+	}
+	statsMutex.Unlock()
+}
+
+func (statsRecorder) valuesResurrected(delta int) {
+	statsMutex.Lock()
+	if collected != nil {
+		collected.ValuesResurrected += delta
+	}
+	statsMutex.Unlock()
+}
+
+func (statsRecorder) enabled() bool {
+	statsMutex.Lock()
+	enabled := collected != nil
+	statsMutex.Unlock()
+	return enabled
+}
+
+// gcCycles counts the Go garbage collection cycles observed while
+// statistics are collected, and gcWatching is set to 1 while they
+// are being observed. Both are accessed atomically.
+var gcCycles uint32
+var gcWatching int32
+
+// gcSentinel is large enough to not be batched with other tiny
+// allocations, which could delay its finalization indefinitely.
+type gcSentinel struct{ _ [16]byte }
+
+// watchGC increments gcCycles when the next garbage collection cycle
+// completes, and rearms itself for as long as statistics are collected.
+func watchGC() {
+	runtime.SetFinalizer(&gcSentinel{}, func(*gcSentinel) {
+		atomic.AddUint32(&gcCycles, 1)
+		if stats.enabled() {
+			watchGC()
+		} else {
+			atomic.StoreInt32(&gcWatching, 0)
+		}
+	})
+}
+
+// evictedValue identifies a pointer value evicted from an engine by
+// its type and address, so that the record doesn't keep it alive.
+type evictedValue struct {
+	engine *Engine
+	typ    reflect.Type
+	addr   uintptr
+}
+
+// evicted holds the values evicted during the garbage collection
+// cycle counted in evictedCycle, for computing ValuesResurrected.
+//
+// Only accessed from the main GUI thread.
+var (
+	evicted      map[evictedValue]bool
+	evictedCycle uint32
+)
+
+// evictedKey returns the key identifying gvalue in evicted, and whether
+// gvalue may be recorded there at all. The records of past collection
+// cycles are dropped, since their memory may now hold other values.
+//
+// This must be run from the main GUI thread.
+func evictedKey(engine *Engine, gvalue interface{}) (evictedValue, bool) {
+	if cycle := atomic.LoadUint32(&gcCycles); cycle != evictedCycle {
+		evicted = nil
+		evictedCycle = cycle
+	}
+	v := reflect.ValueOf(gvalue)
+	if v.Kind() != reflect.Ptr || !stats.enabled() {
+		return evictedValue{}, false
+	}
+	return evictedValue{engine, v.Type(), v.Pointer()}, true
+}
+
+// recordEviction records that gvalue was evicted from engine.
+//
+// This must be run from the main GUI thread.
+func recordEviction(engine *Engine, gvalue interface{}) {
+	if key, ok := evictedKey(engine, gvalue); ok {
+		if evicted == nil {
+			evicted = make(map[evictedValue]bool)
+		}
+		evicted[key] = true
+	}
 }
 
-func (stats *Statistics) enginesAlive(delta int) {
-	if stats != nil {
-		statsMutex.Lock()
-		stats.EnginesAlive += delta
-		statsMutex.Unlock()
+// recordWrap counts gvalue as resurrected if it was evicted from engine.
+//
+// This must be run from the main GUI thread.
+func recordWrap(engine *Engine, gvalue interface{}) {
+	if key, ok := evictedKey(engine, gvalue); ok && evicted[key] {
+		delete(evicted, key)
+		stats.valuesResurrected(+1)
 	}
 }
 
-func (stats *Statistics) valuesAlive(delta int) {
-	if stats != nil {
-		statsMutex.Lock()
-		stats.ValuesAlive += delta
-		statsMutex.Unlock()
+func (statsRecorder) objectsAlive(delta int) {
+	statsMutex.Lock()
+	if collected != nil {
+		collected.ObjectsAlive += delta
 	}
+	statsMutex.Unlock()
 }
@@ -0,0 +1,222 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// Store is an observable set of key/value pairs that is made available
+// to QML as a single object, so that small bits of state shared between
+// Go and QML don't each need their own context variable. Once the store
+// is made available to QML via Context.SetVar, bindings on its keys are
+// updated whenever the respective values are changed by Go code.
+type Store struct {
+	addr        unsafe.Pointer
+	engine      *Engine
+	values      map[string]interface{}
+	subscribers map[string][]storeSubscriber
+	queue       callbackQueue
+}
+
+// storeSubscriber holds a function registered via Store.OnChange or
+// Store.OnChangeInline.
+type storeSubscriber struct {
+	f      func(old, new interface{})
+	inline bool
+}
+
+// stores holds the stores alive until they are destroyed, since their
+// C++ counterparts only hold unsafe references to them.
+var stores = make(map[*Store]bool)
+
+// NewStore returns a new empty store. The Destroy method must be called
+// once the store is not necessary anymore.
+func NewStore() *Store {
+	store := &Store{
+		values:      make(map[string]interface{}),
+		subscribers: make(map[string][]storeSubscriber),
+	}
+	gui(func() {
+		stores[store] = true
+		store.addr = C.newStore(unsafe.Pointer(store))
+	})
+	return store
+}
+
+// Set sets the value of key, creating it if necessary. Keys must be
+// valid QML property names.
+//
+// Go values that are not of a basic type are made available to QML as
+// done by Context.SetVar, and the engine will hold a reference to them
+// until it is destroyed, even if the key is changed or deleted.
+func (store *Store) Set(key string, value interface{}) {
+	injectSignals(value)
+	gui(func() {
+		store.values[key] = value
+		store.insert(key, value)
+	})
+}
+
+// Get returns the value of key, or nil if key is not set.
+func (store *Store) Get(key string) interface{} {
+	var value interface{}
+	gui(func() {
+		value = store.values[key]
+	})
+	return value
+}
+
+// Delete removes key from the store. QML code observes the value of
+// deleted keys as undefined.
+func (store *Store) Delete(key string) {
+	gui(func() {
+		if _, ok := store.values[key]; ok {
+			delete(store.values, key)
+			if store.engine != nil {
+				store.clear(key)
+			}
+		}
+	})
+}
+
+// Keys returns the keys set in the store, in sorted order.
+func (store *Store) Keys() []string {
+	var keys []string
+	gui(func() {
+		for key := range store.values {
+			keys = append(keys, key)
+		}
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// Map returns a map holding all the key/value pairs in the store, so that
+// its state may be persisted and restored later via SetMap.
+func (store *Store) Map() map[string]interface{} {
+	m := make(map[string]interface{})
+	gui(func() {
+		for key, value := range store.values {
+			m[key] = value
+		}
+	})
+	return m
+}
+
+// SetMap replaces the content of the store with the key/value pairs in m.
+// Keys in the store that are not in m are deleted.
+func (store *Store) SetMap(m map[string]interface{}) {
+	for _, value := range m {
+		injectSignals(value)
+	}
+	gui(func() {
+		for key := range store.values {
+			if _, ok := m[key]; !ok {
+				delete(store.values, key)
+				if store.engine != nil {
+					store.clear(key)
+				}
+			}
+		}
+		for key, value := range m {
+			store.values[key] = value
+			store.insert(key, value)
+		}
+	})
+}
+
+// OnChange arranges for f to be called with the old and new values of key
+// whenever QML code assigns to it. Changes made via Set and SetMap do not
+// call f. The function is called in a goroutine owned by the package, one
+// change at a time and in the order the changes were made to the store.
+// See the Callbacks section of the package documentation.
+func (store *Store) OnChange(key string, f func(old, new interface{})) {
+	store.subscribe(key, storeSubscriber{f, false})
+}
+
+// OnChangeInline works as OnChange, but f is called in the main GUI
+// thread while the assignment is being made, so it must not block.
+func (store *Store) OnChangeInline(key string, f func(old, new interface{})) {
+	store.subscribe(key, storeSubscriber{f, true})
+}
+
+func (store *Store) subscribe(key string, sub storeSubscriber) {
+	gui(func() {
+		store.subscribers[key] = append(store.subscribers[key], sub)
+	})
+}
+
+// Destroy destroys the store. The store must not be used after this
+// method is called.
+func (store *Store) Destroy() {
+	gui(func() {
+		if stores[store] {
+			delete(stores, store)
+			C.delObjectLater(store.addr)
+		}
+	})
+}
+
+// attach makes engine the one used to pack the values of the store,
+// and inserts the values set so far. Until then values are only
+// recorded, since packing Go values requires an engine.
+//
+// This must be run from the main GUI thread.
+func (store *Store) attach(engine *Engine) {
+	store.engine = engine
+	C.engineSetContextForObject(engine.addr, store.addr)
+	for key, value := range store.values {
+		store.insert(key, value)
+	}
+}
+
+// insert inserts value under key in the C++ counterpart of store, if
+// the store is already attached to an engine.
+//
+// This must be run from the main GUI thread.
+func (store *Store) insert(key string, value interface{}) {
+	if store.engine == nil {
+		return
+	}
+	var dvalue C.DataValue
+	packDataValue(value, &dvalue, store.engine, cppOwner)
+	ckey, ckeylen := unsafeStringData(key)
+	qkey := C.newString(ckey, ckeylen)
+	defer C.delString(qkey)
+	C.storeInsert(store.addr, qkey, &dvalue)
+}
+
+// clear clears key in the C++ counterpart of store.
+//
+// This must be run from the main GUI thread.
+func (store *Store) clear(key string) {
+	ckey, ckeylen := unsafeStringData(key)
+	qkey := C.newString(ckey, ckeylen)
+	defer C.delString(qkey)
+	C.storeClear(store.addr, qkey)
+}
+
+//export hookStoreChanged
+func hookStoreChanged(addr unsafe.Pointer, ckey *C.char, ckeylen C.int, dvalue *C.DataValue) {
+	if !onGuiThread("hookStoreChanged") {
+		gui(func() { hookStoreChanged(addr, ckey, ckeylen, dvalue) })
+		return
+	}
+	store := (*Store)(addr)
+	key := C.GoStringN(ckey, ckeylen)
+	value := unpackDataValue(dvalue, store.engine)
+	old := store.values[key]
+	store.values[key] = value
+	for _, sub := range store.subscribers[key] {
+		f := sub.f
+		if sub.inline {
+			f(old, value)
+		} else {
+			store.queue.dispatch(func() { f(old, value) })
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package qml
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"unsafe"
+)
+
+// strictMode is set to 1 while strict mode is enabled. It's read
+// atomically so that checking it is cheap when strict mode is off.
+var strictMode int32
+
+// The following maps are only populated while strict mode is enabled,
+// and are guarded by objectsMutex.
+var (
+	// strictLive holds the wrappers of each live object address.
+	strictLive = make(map[unsafe.Pointer][]*Object)
+
+	// strictStacks holds the stack trace of the goroutine that created
+	// each wrapper.
+	strictStacks = make(map[*Object][]byte)
+
+	// strictDead holds the wrappers whose object was destroyed.
+	strictDead = make(map[*Object]bool)
+)
+
+// SetStrictMode enables or disables the strict mode, in which the package
+// checks expensive invariants to find misuses that would otherwise crash
+// the application at some later point, or silently corrupt its memory.
+// In strict mode, Object methods panic if the object was destroyed,
+// either via Object.Destroy or by QML itself, or if its engine was
+// destroyed. Accessing Go values from QML panics if their engine was
+// destroyed, and callbacks meant to run in the main GUI thread panic if
+// run out of it, instead of logging the problem and moving on.
+//
+// Panics report the stack trace of the offending call and, for objects,
+// the stack trace of the goroutine that first obtained the object. These
+// traces are slow to capture, and the wrappers of destroyed objects are
+// kept around to be reported, so strict mode is meant for tests and
+// debugging sessions. Only objects obtained while strict mode is enabled
+// are tracked, and with strict mode disabled the checks cost a single
+// atomic load.
+func SetStrictMode(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&strictMode, v)
+	if !enabled {
+		objectsMutex.Lock()
+		strictLive = make(map[unsafe.Pointer][]*Object)
+		strictStacks = make(map[*Object][]byte)
+		strictDead = make(map[*Object]bool)
+		objectsMutex.Unlock()
+	}
+}
+
+// isStrict returns whether strict mode is enabled.
+func isStrict() bool {
+	return atomic.LoadInt32(&strictMode) != 0
+}
+
+// strictTrack records obj as a wrapper of a live object, along with the
+// stack trace of its creation.
+//
+// This must be run while holding objectsMutex.
+func strictTrack(obj *Object) {
+	if obj.addr == nilPtr {
+		return
+	}
+	strictLive[obj.addr] = append(strictLive[obj.addr], obj)
+	strictStacks[obj] = debug.Stack()
+}
+
+// strictForget records that the wrappers of the object at addr point to
+// a destroyed object.
+//
+// This must be run while holding objectsMutex.
+func strictForget(addr unsafe.Pointer) {
+	for _, obj := range strictLive[addr] {
+		strictDead[obj] = true
+	}
+	delete(strictLive, addr)
+}
+
+// assertLive panics if obj was destroyed, or if strict mode is enabled
+// and its engine was destroyed. In strict mode the panic also reports
+// where obj was obtained.
+func (obj *Object) assertLive() {
+	if !isStrict() {
+		if atomic.LoadInt32(&obj.destroyed) != 0 {
+			panic("qml: object used after being destroyed")
+		}
+		return
+	}
+	objectsMutex.Lock()
+	dead := strictDead[obj]
+	stack := strictStacks[obj]
+	objectsMutex.Unlock()
+
+	var problem string
+	switch {
+	case dead || obj.addr == nilPtr || atomic.LoadInt32(&obj.destroyed) != 0:
+		problem = "object used after being destroyed"
+	case obj.engine != nil && obj.engine.isDestroyed():
+		problem = "object used after its engine was destroyed"
+	default:
+		return
+	}
+	strictPanic(problem, stack)
+}
+
+// strictPanic panics reporting problem along with the current stack
+// trace and, if known, the stack trace that created the value involved.
+func strictPanic(problem string, created []byte) {
+	msg := fmt.Sprintf("qml: %s\n\nUsed at:\n%s", problem, debug.Stack())
+	if created != nil {
+		msg += fmt.Sprintf("\nCreated at:\n%s", created)
+	}
+	panic(msg)
+}
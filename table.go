@@ -0,0 +1,341 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// TableModel is a table model holding a Go slice of structs, which views
+// such as TableView display and update live as rows are added, removed,
+// changed, and sorted via the TableModel methods. Each row holds an item
+// of the slice, and each column one of its exported fields, which are
+// also available to delegates as model roles, named as done for List.
+// Views that address columns by role, such as the TableView of the
+// QtQuick.Controls module, refer to the fields by these names:
+//
+//     TableView {
+//         model: people
+//         TableViewColumn { role: "name"; title: "Name" }
+//         TableViewColumn { role: "age"; title: "Age" }
+//     }
+//
+// Rows are converted for QML only as views request them, so large
+// tables are cheap to display and to scroll through.
+//
+// TableModel methods may be called from any goroutine.
+type TableModel struct {
+	addr   unsafe.Pointer
+	engine *Engine
+
+	itemType
+	items reflect.Value
+}
+
+// tables holds the tables alive until they are destroyed, since their
+// C++ counterparts only hold unsafe references to them.
+var tables = make(map[*TableModel]bool)
+
+// NewTableModel returns a table holding a copy of the items in slice,
+// which must be a slice of structs or of pointers to structs. Values
+// provided to the table methods are converted to the type of the slice
+// items as documented in NewListModel.
+//
+// The table is made available to QML via Context.SetVar, and its Destroy
+// method must be called once it is not necessary anymore.
+func NewTableModel(slice interface{}) *TableModel {
+	sv := reflect.ValueOf(slice)
+	if sv.Kind() != reflect.Slice || !isScanStruct(sv.Type().Elem()) {
+		panic(fmt.Sprintf("cannot create table from %T: not a slice of structs", slice))
+	}
+	table := &TableModel{
+		itemType: newItemType("table", sv.Type().Elem()),
+		items:    reflect.MakeSlice(sv.Type(), sv.Len(), sv.Len()),
+	}
+	reflect.Copy(table.items, sv)
+
+	croles, crolesLen := unsafeStringData(strings.Join(table.roles, ","))
+	gui(func() {
+		tables[table] = true
+		table.addr = C.newTableModel(unsafe.Pointer(table), croles, crolesLen)
+	})
+	return table
+}
+
+// RowCount returns the number of rows in the table.
+func (table *TableModel) RowCount() int {
+	var n int
+	gui(func() {
+		n = table.items.Len()
+	})
+	return n
+}
+
+// ColumnCount returns the number of columns in the table, which is the
+// number of fields of the items that are available to QML.
+func (table *TableModel) ColumnCount() int {
+	return len(table.roles)
+}
+
+// Columns returns the role names of the table columns, in order.
+func (table *TableModel) Columns() []string {
+	return append([]string(nil), table.roles...)
+}
+
+// Get returns the item at row.
+func (table *TableModel) Get(row int) interface{} {
+	var item interface{}
+	gui(func() {
+		item = table.items.Index(row).Interface()
+	})
+	return item
+}
+
+// Append adds the provided items as rows at the end of the table. If any
+// of the items cannot be converted to the table item type, no rows are
+// added.
+func (table *TableModel) Append(items ...interface{}) error {
+	var err error
+	gui(func() {
+		if len(items) == 0 {
+			return
+		}
+		values := make([]reflect.Value, len(items))
+		for i, item := range items {
+			values[i], err = table.itemValue(item)
+			if err != nil {
+				err = fmt.Errorf("cannot append table row %d: %v", table.items.Len()+i, err)
+				return
+			}
+		}
+		n := table.items.Len()
+		C.tableModelBeginInsert(table.addr, C.int(n), C.int(n+len(values)-1))
+		table.items = reflect.Append(table.items, values...)
+		C.tableModelEndInsert(table.addr)
+	})
+	return err
+}
+
+// Remove removes count rows from the table starting at row.
+func (table *TableModel) Remove(row, count int) {
+	gui(func() {
+		n := table.items.Len()
+		if row < 0 || count < 0 || row+count > n {
+			panic(fmt.Sprintf("cannot remove %d rows from table at row %d: table has %d rows", count, row, n))
+		}
+		if count == 0 {
+			return
+		}
+		C.tableModelBeginRemove(table.addr, C.int(row), C.int(row+count-1))
+		reflect.Copy(table.items.Slice(row, n), table.items.Slice(row+count, n))
+		for i := n - count; i < n; i++ {
+			table.items.Index(i).Set(reflect.Zero(table.elemType))
+		}
+		table.items = table.items.Slice(0, n-count)
+		C.tableModelEndRemove(table.addr)
+	})
+}
+
+// Set replaces the item at row with the provided one.
+func (table *TableModel) Set(row int, item interface{}) error {
+	var err error
+	gui(func() {
+		if row < 0 || row >= table.items.Len() {
+			panic(fmt.Sprintf("cannot set table row %d: table has %d rows", row, table.items.Len()))
+		}
+		var v reflect.Value
+		v, err = table.itemValue(item)
+		if err != nil {
+			err = fmt.Errorf("cannot set table row %d: %v", row, err)
+			return
+		}
+		table.items.Index(row).Set(v)
+		C.tableModelChanged(table.addr, C.int(row), C.int(row))
+	})
+	return err
+}
+
+// Reset replaces all the rows of the table with a copy of the items in
+// slice, which must be a slice of the same type provided to
+// NewTableModel. Views are told to reload the table once, rather than
+// once per row, so Reset is the cheapest way to replace most of the
+// rows at once.
+func (table *TableModel) Reset(slice interface{}) {
+	sv := reflect.ValueOf(slice)
+	if sv.Type() != table.items.Type() {
+		panic(fmt.Sprintf("cannot reset table of %s with %T", table.elemType, slice))
+	}
+	items := reflect.MakeSlice(sv.Type(), sv.Len(), sv.Len())
+	reflect.Copy(items, sv)
+	gui(func() {
+		C.tableModelBeginReset(table.addr)
+		table.items = items
+		C.tableModelEndReset(table.addr)
+	})
+}
+
+// Sort sorts the rows of the table by the values of the named column,
+// in ascending or descending order. Rows with equal values keep their
+// relative order. Views keep track of the rows they refer to, such as
+// the current row, and move them accordingly.
+//
+// Columns holding strings, numbers, booleans, and time.Time values may
+// be sorted on, and rows holding nil pointers are sorted as if lower
+// than any other value. Rows added or changed after sorting are not kept
+// sorted, so Sort must be called again to do so.
+func (table *TableModel) Sort(column string, ascending bool) error {
+	index := -1
+	for i, role := range table.roles {
+		if role == column {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("cannot sort table by %q: table has no such column", column)
+	}
+	typ := table.structType().Field(table.fields[index]).Type
+	if !isOrdered(typ) {
+		return fmt.Errorf("cannot sort table by %q: %s values are not ordered", column, typ)
+	}
+	gui(func() {
+		sorter := &tableSorter{table: table, field: index, ascending: ascending}
+		sorter.rows = make([]int, table.items.Len())
+		for i := range sorter.rows {
+			sorter.rows[i] = i
+		}
+		sort.Stable(sorter)
+
+		// The sorter holds the old row of each new row, while views
+		// need the new row of each old row.
+		newRows := make([]C.int, len(sorter.rows))
+		items := reflect.MakeSlice(table.items.Type(), len(sorter.rows), len(sorter.rows))
+		for i, old := range sorter.rows {
+			newRows[old] = C.int(i)
+			items.Index(i).Set(table.items.Index(old))
+		}
+		C.tableModelBeginLayout(table.addr)
+		table.items = items
+		if len(newRows) > 0 {
+			C.tableModelEndLayout(table.addr, &newRows[0], C.int(len(newRows)))
+		} else {
+			C.tableModelEndLayout(table.addr, (*C.int)(nil), 0)
+		}
+	})
+	return nil
+}
+
+// Destroy destroys the table. The table must not be used after this
+// method is called.
+func (table *TableModel) Destroy() {
+	gui(func() {
+		if tables[table] {
+			delete(tables, table)
+			C.delObjectLater(table.addr)
+		}
+	})
+}
+
+// tableSorter sorts the rows of a table by the values of a field, via
+// the permutation in rows.
+type tableSorter struct {
+	table     *TableModel
+	field     int
+	ascending bool
+	rows      []int
+}
+
+func (s *tableSorter) Len() int      { return len(s.rows) }
+func (s *tableSorter) Swap(i, j int) { s.rows[i], s.rows[j] = s.rows[j], s.rows[i] }
+
+func (s *tableSorter) Less(i, j int) bool {
+	a, aok := s.table.roleValue(s.table.items.Index(s.rows[i]), s.field)
+	b, bok := s.table.roleValue(s.table.items.Index(s.rows[j]), s.field)
+	if !aok || !bok {
+		if s.ascending {
+			return !aok && bok
+		}
+		return aok && !bok
+	}
+	if s.ascending {
+		return lessValue(a, b)
+	}
+	return lessValue(b, a)
+}
+
+// isOrdered returns whether values of typ may be compared by lessValue.
+func isOrdered(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return typ == typeTime
+}
+
+// lessValue returns whether a is ordered before b, which must be values
+// of the same type that is ordered according to isOrdered.
+func lessValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	}
+	return a.Interface().(time.Time).Before(b.Interface().(time.Time))
+}
+
+//export hookTableModelCount
+func hookTableModelCount(addr unsafe.Pointer) C.int {
+	if !onGuiThread("hookTableModelCount") {
+		var count C.int
+		gui(func() { count = hookTableModelCount(addr) })
+		return count
+	}
+	return C.int((*TableModel)(addr).items.Len())
+}
+
+//export hookTableModelData
+func hookTableModelData(enginep, addr unsafe.Pointer, row, column C.int, result *C.DataValue) {
+	if !onGuiThread("hookTableModelData") {
+		gui(func() { hookTableModelData(enginep, addr, row, column, result) })
+		return
+	}
+	table := (*TableModel)(addr)
+	engine := table.engine
+	if enginep != nilPtr {
+		engine = engines[enginep]
+	}
+	if int(row) >= table.items.Len() {
+		result.dataType = C.DTInvalid
+		return
+	}
+	value, ok := table.roleValue(table.items.Index(int(row)), int(column))
+	if !ok {
+		result.dataType = C.DTInvalid
+		return
+	}
+	packDataValue(value.Interface(), result, engine, jsOwner)
+}
+
+//export hookTableModelDestroyed
+func hookTableModelDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookTableModelDestroyed") {
+		gui(func() { hookTableModelDestroyed(addr) })
+		return
+	}
+	delete(tables, (*TableModel)(addr))
+}
@@ -0,0 +1,138 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"log"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// ThrottledSetter sets a property of an object at most once per interval,
+// coalescing the values provided in between. See Throttle.
+type ThrottledSetter struct {
+	obj      *Object
+	property string
+	min      time.Duration
+
+	// These are only accessed from the main GUI thread.
+	timer     unsafe.Pointer
+	last      time.Time
+	destroyed bool
+
+	mutex     sync.Mutex
+	value     interface{}
+	pending   bool
+	scheduled bool
+	closed    bool
+}
+
+// throttlers holds the throttled setters alive until their timer is
+// destroyed, since the C++ timer only holds unsafe references to them.
+var throttlers = make(map[*ThrottledSetter]bool)
+
+// Throttle returns a setter for the given property of obj that writes
+// the property at most once per min interval, so that values changing
+// at a high rate, such as progress counters, don't flood the GUI event
+// loop with updates. Values provided in between writes are coalesced,
+// and the last value provided is always written.
+//
+// The Close method must be called once the setter is not necessary
+// anymore. Using the setter after obj is destroyed has no effect.
+func Throttle(obj *Object, property string, min time.Duration) *ThrottledSetter {
+	t := &ThrottledSetter{obj: obj, property: property, min: min}
+	gui(func() {
+		throttlers[t] = true
+		t.timer = C.objectNewThrottleTimer(obj.addr, unsafe.Pointer(t))
+	})
+	return t
+}
+
+// Set arranges for the property to be set to value. The property is
+// set right away if it wasn't set during the last interval, and
+// otherwise once the interval is over, to the last value provided.
+func (t *ThrottledSetter) Set(value interface{}) {
+	t.mutex.Lock()
+	if t.closed {
+		t.mutex.Unlock()
+		return
+	}
+	t.value = value
+	t.pending = true
+	schedule := !t.scheduled
+	t.scheduled = true
+	t.mutex.Unlock()
+
+	if schedule {
+		gui(func() {
+			if t.destroyed {
+				return
+			}
+			delay := t.min - time.Since(t.last)
+			if delay < 0 {
+				delay = 0
+			}
+			C.throttleTimerStart(t.timer, C.int(delay/time.Millisecond))
+		})
+	}
+}
+
+// Close writes the last value provided to Set, if it wasn't written yet,
+// and stops the setter. Calls to Set after Close have no effect.
+func (t *ThrottledSetter) Close() {
+	t.mutex.Lock()
+	t.closed = true
+	t.mutex.Unlock()
+	gui(func() {
+		if !t.destroyed {
+			t.flush()
+			t.destroyed = true
+			C.delObjectLater(t.timer)
+		}
+	})
+}
+
+// flush writes the pending value, if any, to the property.
+//
+// This must be run from the main GUI thread.
+func (t *ThrottledSetter) flush() {
+	t.mutex.Lock()
+	value, pending := t.value, t.pending
+	t.value = nil
+	t.pending = false
+	t.scheduled = false
+	t.mutex.Unlock()
+	if !pending {
+		return
+	}
+	t.last = time.Now()
+	if err := t.obj.Set(t.property, value); err != nil {
+		log.Printf("qml: cannot set throttled property: %v", err)
+	}
+}
+
+//export hookThrottleTimeout
+func hookThrottleTimeout(addr unsafe.Pointer) {
+	if !onGuiThread("hookThrottleTimeout") {
+		gui(func() { hookThrottleTimeout(addr) })
+		return
+	}
+	t := (*ThrottledSetter)(addr)
+	if !t.destroyed {
+		t.flush()
+	}
+}
+
+//export hookThrottleDestroyed
+func hookThrottleDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookThrottleDestroyed") {
+		gui(func() { hookThrottleDestroyed(addr) })
+		return
+	}
+	t := (*ThrottledSetter)(addr)
+	t.destroyed = true
+	delete(throttlers, t)
+}
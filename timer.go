@@ -0,0 +1,135 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// frameInterval is the interval between the calls made by Tick, close
+// to the refresh rate of most displays.
+const frameInterval = time.Second / 60
+
+// Timer is a callback registered via Tick, After, or Every, which runs
+// in the main GUI thread driven by the GUI loop itself, so that it may
+// update QML state cheaply and without spawning goroutines. Since the
+// callback runs in the main GUI thread, it must not block.
+type Timer struct {
+	addr unsafe.Pointer
+	f    func(t time.Time)
+	once bool
+
+	// Only accessed from the main GUI thread.
+	owner   *Object
+	stopped bool
+}
+
+// timers holds the timers alive until they are stopped, since their
+// C++ counterparts only hold unsafe references to them.
+var timers = make(map[*Timer]bool)
+
+// Tick registers f to be called once per frame, at about the refresh rate
+// of common displays, with the time of the call, so that values shown by
+// QML may be animated from Go smoothly:
+//
+//     qml.Tick(func(t time.Time) {
+//         needle.Set("rotation", angleAt(t))
+//     }).StopWith(needle)
+//
+// The timer keeps running until stopped.
+func Tick(f func(t time.Time)) *Timer {
+	return newTimer(frameInterval, false, f)
+}
+
+// After registers f to be called once, after at least d has elapsed.
+func After(d time.Duration, f func()) *Timer {
+	return newTimer(d, true, func(time.Time) { f() })
+}
+
+// Every registers f to be called repeatedly, every d, until the timer
+// is stopped.
+func Every(d time.Duration, f func()) *Timer {
+	return newTimer(d, false, func(time.Time) { f() })
+}
+
+func newTimer(d time.Duration, once bool, f func(t time.Time)) *Timer {
+	t := &Timer{f: f, once: once}
+	singleShot := C.int(0)
+	if once {
+		singleShot = 1
+	}
+	gui(func() {
+		timers[t] = true
+		t.addr = C.newTimer(unsafe.Pointer(t), C.int(d/time.Millisecond), singleShot)
+	})
+	return t
+}
+
+// Stop stops the timer, so that its function is not called anymore.
+// Stopping a timer that was already stopped has no effect.
+func (t *Timer) Stop() {
+	gui(func() {
+		t.stop()
+	})
+}
+
+// stop stops the timer and schedules its C++ counterpart for deletion.
+//
+// This must be run from the main GUI thread.
+func (t *Timer) stop() {
+	if !t.stopped {
+		t.stopped = true
+		C.delObjectLater(t.addr)
+	}
+}
+
+// StopWith ties the timer to obj, so that it's stopped once obj is
+// destroyed, and returns the timer. Timers meant to run while a window
+// or a component instance is alive may be tied to its root object, which
+// is destroyed with the window, the instance, or their engine.
+func (t *Timer) StopWith(obj *Object) *Timer {
+	obj.assertLive()
+	gui(func() {
+		if !t.stopped {
+			t.owner = obj
+			C.objectSetParent(t.addr, obj.addr)
+		}
+	})
+	return t
+}
+
+//export hookTimerTimeout
+func hookTimerTimeout(addr unsafe.Pointer) {
+	if !onGuiThread("hookTimerTimeout") {
+		gui(func() { hookTimerTimeout(addr) })
+		return
+	}
+	t := (*Timer)(addr)
+	if t.stopped {
+		return
+	}
+	if t.owner != nil && atomic.LoadInt32(&t.owner.destroyed) != 0 {
+		// The owner is being destroyed via Object.Destroy.
+		t.stop()
+		return
+	}
+	t.f(time.Now())
+	if t.once {
+		t.stop()
+	}
+}
+
+//export hookTimerDestroyed
+func hookTimerDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookTimerDestroyed") {
+		gui(func() { hookTimerDestroyed(addr) })
+		return
+	}
+	t := (*Timer)(addr)
+	t.stopped = true
+	delete(timers, t)
+}
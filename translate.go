@@ -0,0 +1,167 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// translationDir and translationPrefix locate the translations loaded by
+// Engine.SetLocale, as set via SetTranslationSource.
+//
+// Only accessed from the main GUI thread.
+var translationDir, translationPrefix string
+
+// LoadTranslation loads the compiled Qt translation file at path, such
+// as a .qm file produced by the lrelease tool, and installs it so that
+// strings marked for translation in QML via qsTr are translated. Loading
+// a translation replaces the one loaded before, if any, so switching
+// languages at runtime only requires loading the new translation and
+// calling Engine.Retranslate on the engines affected.
+//
+// If the file cannot be loaded an error is returned, and the translation
+// loaded before remains installed.
+func LoadTranslation(path string) error {
+	cpath, cpathlen := unsafeStringData(path)
+	var ok C.int
+	gui(func() {
+		ok = C.applicationLoadTranslation(cpath, cpathlen)
+	})
+	if ok == 0 {
+		return fmt.Errorf("cannot load translation from %q", path)
+	}
+	return nil
+}
+
+// RemoveTranslation removes the translation loaded via LoadTranslation,
+// if any, so that strings are shown as written in the QML documents.
+// As with LoadTranslation, Engine.Retranslate must be called for visible
+// strings to be updated.
+func RemoveTranslation() {
+	gui(func() {
+		C.applicationRemoveTranslation()
+	})
+}
+
+// Retranslate updates all the bindings of the engine that use strings
+// marked for translation, so that visible strings reflect the translation
+// installed via LoadTranslation without recreating any objects. It
+// returns ErrUnsupported with Qt versions before 5.10, which do not
+// offer this functionality.
+func (e *Engine) Retranslate() error {
+	e.assertValid()
+	var ok C.int
+	gui(func() {
+		ok = C.engineRetranslate(e.addr)
+	})
+	if ok == 0 {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// Locale returns the name of the default locale used to format numbers
+// and dates, and by QML's Qt.locale(), in the "language_COUNTRY" form,
+// such as "en_US". The default locale is taken from the system settings
+// unless overridden via SetLocale.
+func Locale() string {
+	var name string
+	gui(func() {
+		cname := C.localeName()
+		name = C.GoString(cname)
+		C.free(unsafe.Pointer(cname))
+	})
+	return name
+}
+
+// SetLocale overrides the default locale with the one named as in
+// "pt_BR" or "de". Only objects created afterwards and strings formatted
+// afterwards use the new locale. The translation to use for the locale
+// must be loaded separately via LoadTranslation.
+func SetLocale(name string) {
+	cname, cnamelen := unsafeStringData(name)
+	gui(func() {
+		C.localeSetDefault(cname, cnamelen)
+	})
+}
+
+// SetTranslationSource makes Engine.SetLocale load the translation for
+// the locale set from the files in dir named after prefix followed by the
+// locale name, such as "app_pt_BR.qm" for the "app_" prefix. The file
+// best matching the locale is loaded, so "app_pt.qm" is used for the
+// "pt-BR" locale if there's no file for Brazil in particular, and no
+// translation is installed if there's no match at all.
+func SetTranslationSource(dir, prefix string) {
+	gui(func() {
+		translationDir, translationPrefix = dir, prefix
+	})
+}
+
+// SetLocale sets the locale of the engine, named by a BCP 47 language tag
+// such as "pt-BR" or "de", or by a name in the "pt_BR" form. The locale is
+// used by Qt.locale() and for formatting numbers and dates by default, and
+// is reported by Qt.uiLanguage with Qt 5.15 and later. If the source of the
+// translations is set via SetTranslationSource, the translation for the
+// locale is loaded as well.
+//
+// Bindings of the engine are reevaluated so that the interface reflects
+// the new locale and translation without recreating any objects, as done
+// by Retranslate. With Qt versions before 5.10 that is not possible, and
+// only objects created afterwards observe the change.
+//
+// Qt holds a single default locale and a single translation for the whole
+// application, so setting the locale of one engine affects the formatting
+// and translations seen by other engines as well, although the locale
+// reported by Locale for each engine is the one set on it.
+//
+// An error is returned if the locale is unknown, including when the
+// language is known but the country is not, rather than falling back to
+// some other locale.
+func (e *Engine) SetLocale(bcp47 string) error {
+	e.assertValid()
+	cname, cnamelen := unsafeStringData(bcp47)
+	var err error
+	gui(func() {
+		ccanonical := C.localeCanonicalName(cname, cnamelen)
+		if ccanonical == nilCharPtr {
+			err = fmt.Errorf("cannot set locale: unknown locale %q", bcp47)
+			return
+		}
+		canonical := C.GoString(ccanonical)
+		C.free(unsafe.Pointer(ccanonical))
+		ccanon, ccanonlen := unsafeStringData(canonical)
+		C.localeSetDefault(ccanon, ccanonlen)
+		C.engineSetUiLanguage(e.addr, ccanon, ccanonlen)
+		e.locale = canonical
+		if translationDir != "" {
+			cdir, cdirlen := unsafeStringData(translationDir)
+			cprefix, cprefixlen := unsafeStringData(translationPrefix)
+			if C.applicationLoadLocaleTranslation(ccanon, ccanonlen, cdir, cdirlen, cprefix, cprefixlen) == 0 {
+				C.applicationRemoveTranslation()
+			}
+		}
+		C.engineRetranslate(e.addr)
+	})
+	return err
+}
+
+// Locale returns the locale of the engine as a BCP 47 language tag with
+// the language and the country, such as "pt-BR", or the application's
+// default locale in that form if no locale was set via SetLocale.
+func (e *Engine) Locale() string {
+	e.assertValid()
+	var name string
+	gui(func() {
+		name = e.locale
+	})
+	if name == "" {
+		name = strings.Replace(Locale(), "_", "-", -1)
+	}
+	return name
+}
@@ -0,0 +1,182 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"image"
+	"time"
+	"unsafe"
+)
+
+// TrayIcon is an icon shown in the system tray, also known as the
+// notification area, with an optional menu shown when the user
+// right-clicks it.
+//
+// TrayIcon methods may be called from any goroutine.
+type TrayIcon struct {
+	addr unsafe.Pointer
+
+	// Only accessed from the main GUI thread.
+	menu      *Menu
+	activated func(reason TrayActivation)
+	queue     callbackQueue
+}
+
+// TrayActivation identifies how the user activated a tray icon.
+type TrayActivation int
+
+// The values match the respective QSystemTrayIcon::ActivationReason values.
+const (
+	UnknownActivation     TrayActivation = 0
+	ContextActivation     TrayActivation = 1 // Right click, which also shows the menu.
+	DoubleClickActivation TrayActivation = 2
+	TriggerActivation     TrayActivation = 3 // Left click.
+	MiddleClickActivation TrayActivation = 4
+)
+
+// trayIcons holds the tray icons alive until they are destroyed, since
+// their C++ counterparts only hold unsafe references to them.
+var trayIcons = make(map[*TrayIcon]bool)
+
+// NewTrayIcon returns a new tray icon showing icon, initially hidden.
+// The icon may be nil, and may be changed at any time via SetIcon, so
+// that it may reflect the status of the application. ErrUnsupported is
+// returned if the system has no tray to show icons in. The Destroy method
+// must be called once the icon is not necessary anymore.
+func NewTrayIcon(icon image.Image) (*TrayIcon, error) {
+	tray := &TrayIcon{}
+	var available bool
+	gui(func() {
+		if available = C.trayIsAvailable() != 0; !available {
+			return
+		}
+		tray.addr = C.newTrayIcon(unsafe.Pointer(tray))
+		trayIcons[tray] = true
+	})
+	if !available {
+		return nil, ErrUnsupported
+	}
+	if icon != nil {
+		tray.SetIcon(icon)
+	}
+	return tray, nil
+}
+
+// SetIcon sets the image shown in the tray. Images of types *image.RGBA
+// and *image.NRGBA are converted more efficiently than other types.
+func (tray *TrayIcon) SetIcon(img image.Image) {
+	bounds := img.Bounds()
+	premultiplied := C.int(1)
+	if _, ok := img.(*image.NRGBA); ok {
+		premultiplied = 0
+	}
+	gui(func() {
+		var bits *C.uchar
+		var stride C.int
+		qimage := C.newImage(C.int(bounds.Dx()), C.int(bounds.Dy()), premultiplied, &bits, &stride)
+		defer C.delImage(qimage)
+		fillImage(img, unsafe.Pointer(bits), int(stride))
+		C.traySetImage(tray.addr, qimage)
+	})
+}
+
+// SetIconFile sets the image shown in the tray to the one in the file at
+// path, which may also be a "qrc:///path" location.
+func (tray *TrayIcon) SetIconFile(path string) {
+	cpath, cpathlen := unsafeStringData(path)
+	gui(func() {
+		C.traySetIconFile(tray.addr, cpath, cpathlen)
+	})
+}
+
+// SetToolTip sets the text shown when the mouse hovers over the icon.
+func (tray *TrayIcon) SetToolTip(text string) {
+	ctext, ctextlen := unsafeStringData(text)
+	gui(func() {
+		C.traySetToolTip(tray.addr, ctext, ctextlen)
+	})
+}
+
+// SetMenu sets the menu shown when the user right-clicks the icon, or
+// removes it if menu is nil. The menu must not be destroyed while set.
+func (tray *TrayIcon) SetMenu(menu *Menu) {
+	gui(func() {
+		tray.menu = menu
+		addr := nilPtr
+		if menu != nil {
+			addr = menu.addr
+		}
+		C.traySetMenu(tray.addr, addr)
+	})
+}
+
+// OnActivated registers f to be called whenever the user activates the
+// icon, replacing any function previously registered, with the reason
+// telling a left click from a double click, a middle click, or a right
+// click. The function is called in a goroutine owned by the package. See
+// the Callbacks section of the package documentation.
+func (tray *TrayIcon) OnActivated(f func(reason TrayActivation)) {
+	gui(func() {
+		tray.activated = f
+	})
+}
+
+// Show shows the icon in the tray.
+func (tray *TrayIcon) Show() {
+	gui(func() {
+		C.traySetVisible(tray.addr, 1)
+	})
+}
+
+// Hide hides the icon from the tray.
+func (tray *TrayIcon) Hide() {
+	gui(func() {
+		C.traySetVisible(tray.addr, 0)
+	})
+}
+
+// ShowMessage shows a notification with title and body next to the icon,
+// for roughly the timeout duration, although some systems ignore it. The
+// icon must be shown for the message to appear. ErrUnsupported is returned
+// if the system cannot show notifications.
+func (tray *TrayIcon) ShowMessage(title, body string, timeout time.Duration) error {
+	ctitle, ctitlelen := unsafeStringData(title)
+	cbody, cbodylen := unsafeStringData(body)
+	var shown C.int
+	gui(func() {
+		shown = C.trayShowMessage(tray.addr, ctitle, ctitlelen, cbody, cbodylen, C.int(timeout/time.Millisecond))
+	})
+	if shown == 0 {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// Destroy removes the icon from the tray right away and destroys it. The
+// icon must not be used after this method is called. The menu set via
+// SetMenu is not destroyed with the icon.
+func (tray *TrayIcon) Destroy() {
+	gui(func() {
+		if trayIcons[tray] {
+			delete(trayIcons, tray)
+			// Deleting is deferred as the icon may be handling an
+			// event, so hide it first for it to leave the tray now.
+			C.traySetVisible(tray.addr, 0)
+			C.delObjectLater(tray.addr)
+		}
+	})
+}
+
+//export hookTrayActivated
+func hookTrayActivated(addr unsafe.Pointer, reason C.int) {
+	if !onGuiThread("hookTrayActivated") {
+		gui(func() { hookTrayActivated(addr, reason) })
+		return
+	}
+	tray := (*TrayIcon)(addr)
+	if f := tray.activated; f != nil {
+		tray.queue.dispatch(func() { f(TrayActivation(reason)) })
+	}
+}
@@ -0,0 +1,225 @@
+package qml
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// TypeInfo holds precomputed information about the members of a Go type
+// that are visible to QML. Values of this type are generated by
+// WriteTypeInfo, and should not be crafted by hand.
+type TypeInfo struct {
+	Name    string
+	Fields  []TypeField
+	Methods []TypeMethod
+	Signals []TypeSignal
+
+	// promoted holds the index sequences of the fields promoted from
+	// embedded structs, which are referred to by field indexes starting
+	// at the number of fields of the struct itself.
+	promoted [][]int
+}
+
+// TypeField holds precomputed information about a field of a Go type.
+// See TypeInfo.
+type TypeField struct {
+	Name   string
+	Index  int
+	Offset uintptr
+}
+
+// TypeMethod holds precomputed information about a method of a Go type.
+// See TypeInfo.
+type TypeMethod struct {
+	Name      string
+	Index     int
+	Signature string
+	Result    string
+	NumIn     int
+	NumOut    int
+
+	// Type holds the Go type of the method without its receiver,
+	// as in "func(string) error".
+	Type string
+}
+
+// TypeSignal holds precomputed information about a field of a Go type
+// that is exposed to QML as a signal. See TypeInfo.
+type TypeSignal struct {
+	Name      string
+	Index     int
+	Offset    uintptr
+	Signature string
+	NumIn     int
+}
+
+var typeInfoTables = make(map[reflect.Type]*TypeInfo)
+
+// UseTypeInfo records info as the member information to be used for the
+// type of sample when values of that type are exposed to QML, instead of
+// obtaining the same information via reflection. It panics if info is
+// not consistent with the type, which means it must be regenerated.
+//
+// UseTypeInfo is called by the code generated with WriteTypeInfo during
+// package initialization, and must not be called after the qml package
+// is initialized.
+func UseTypeInfo(sample interface{}, info *TypeInfo) {
+	vt := reflect.TypeOf(sample)
+	for vt.Kind() == reflect.Ptr {
+		vt = vt.Elem()
+	}
+	numMethod := 0
+	for i := 0; i < reflect.PtrTo(vt).NumMethod(); i++ {
+		if isMethodExposed(reflect.PtrTo(vt).Method(i)) {
+			numMethod++
+		}
+	}
+	numField, numSignal := 0, 0
+	for _, vf := range visibleFields(vt) {
+		signal := isSignalType(vf.field.Type)
+		if _, ok := wrappedFieldName(vf.owner, vf.field, signal); !ok {
+			continue
+		}
+		if signal {
+			numSignal++
+		} else {
+			numField++
+		}
+	}
+	stale := vt.Name() != info.Name || numMethod != len(info.Methods) ||
+		numField != len(info.Fields) || numSignal != len(info.Signals)
+	for _, field := range info.Fields {
+		if stale || field.Index >= vt.NumField() {
+			stale = true
+			break
+		}
+		vfield := vt.Field(field.Index)
+		name, ok := wrappedFieldName(vt, vfield, false)
+		stale = !ok || name != field.Name || vfield.Offset != field.Offset
+	}
+	for _, signal := range info.Signals {
+		if stale || signal.Index >= vt.NumField() {
+			stale = true
+			break
+		}
+		vfield := vt.Field(signal.Index)
+		name, ok := wrappedFieldName(vt, vfield, true)
+		stale = !ok || !isSignalType(vfield.Type) || name != signal.Name || vfield.Offset != signal.Offset
+	}
+	for _, method := range info.Methods {
+		if stale || method.Index >= reflect.PtrTo(vt).NumMethod() {
+			stale = true
+			break
+		}
+		vmethod := reflect.PtrTo(vt).Method(method.Index)
+		stale = !isMethodExposed(vmethod) || reflectMethodInfo(vt, method.Index, vmethod) != method
+	}
+	if stale {
+		panic(fmt.Sprintf("type information for %s is out of date; regenerate it with qml.WriteTypeInfo", vt))
+	}
+	typeInfoTables[vt] = info
+}
+
+// WriteTypeInfo writes to w the Go source code for a file that, once
+// compiled into the package that defines the types of the provided
+// sample values, precomputes the information about their members that
+// is otherwise obtained via reflection when the values are exposed to
+// QML. Values behave the same either way, but with the generated file
+// in place the reflection work is avoided at runtime, and renamed or
+// removed fields are reported at build time.
+//
+// All the samples must be values of, or pointers to, struct types
+// defined in a single package. The generated file must be regenerated
+// whenever the exported fields or methods of these types change, and
+// the qml package panics during initialization if it is out of date.
+//
+// A small program such as the following may be run via go generate:
+//
+//     func main() {
+//         err := qml.WriteTypeInfo(os.Stdout, &mypkg.Foo{}, &mypkg.Bar{})
+//         if err != nil {
+//             log.Fatal(err)
+//         }
+//     }
+//
+func WriteTypeInfo(w io.Writer, samples ...interface{}) error {
+	if len(samples) == 0 {
+		return fmt.Errorf("no sample values provided")
+	}
+	var pkgPath, pkgName string
+	var types []reflect.Type
+	for _, sample := range samples {
+		vt := reflect.TypeOf(sample)
+		for vt != nil && vt.Kind() == reflect.Ptr {
+			vt = vt.Elem()
+		}
+		if vt == nil || vt.Kind() != reflect.Struct || vt.Name() == "" {
+			return fmt.Errorf("cannot generate type information for %T: not a named struct type", sample)
+		}
+		if pkgPath == "" {
+			pkgPath = vt.PkgPath()
+			// The package name may differ from the last element of its path.
+			pkgName = strings.TrimSuffix(vt.String(), "."+vt.Name())
+		} else if vt.PkgPath() != pkgPath {
+			return fmt.Errorf("cannot generate type information for types in both %s and %s", pkgPath, vt.PkgPath())
+		}
+		types = append(types, vt)
+	}
+
+	var buf bytes.Buffer
+	var hasFields bool
+	for _, vt := range types {
+		info := reflectTypeInfo(vt)
+		if len(info.promoted) > 0 {
+			return fmt.Errorf("cannot generate type information for %s: fields promoted from embedded structs are not supported", vt)
+		}
+		if len(info.Fields) > 0 || len(info.Signals) > 0 {
+			hasFields = true
+		}
+		fmt.Fprintf(&buf, "\tqml.UseTypeInfo((*%s)(nil), &qml.TypeInfo{\n", vt.Name())
+		fmt.Fprintf(&buf, "\t\tName: %q,\n", info.Name)
+		if len(info.Fields) > 0 {
+			fmt.Fprintf(&buf, "\t\tFields: []qml.TypeField{\n")
+			for _, field := range info.Fields {
+				fmt.Fprintf(&buf, "\t\t\t{%q, %d, unsafe.Offsetof(%s{}.%s)},\n", field.Name, field.Index, vt.Name(), vt.Field(field.Index).Name)
+			}
+			fmt.Fprintf(&buf, "\t\t},\n")
+		}
+		if len(info.Methods) > 0 {
+			fmt.Fprintf(&buf, "\t\tMethods: []qml.TypeMethod{\n")
+			for _, m := range info.Methods {
+				fmt.Fprintf(&buf, "\t\t\t{%q, %d, %q, %q, %d, %d, %q},\n", m.Name, m.Index, m.Signature, m.Result, m.NumIn, m.NumOut, m.Type)
+			}
+			fmt.Fprintf(&buf, "\t\t},\n")
+		}
+		if len(info.Signals) > 0 {
+			fmt.Fprintf(&buf, "\t\tSignals: []qml.TypeSignal{\n")
+			for _, sig := range info.Signals {
+				fmt.Fprintf(&buf, "\t\t\t{%q, %d, unsafe.Offsetof(%s{}.%s), %q, %d},\n", sig.Name, sig.Index, vt.Name(), vt.Field(sig.Index).Name, sig.Signature, sig.NumIn)
+			}
+			fmt.Fprintf(&buf, "\t\t},\n")
+		}
+		fmt.Fprintf(&buf, "\t})\n")
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// This file was generated by qml.WriteTypeInfo. Do not edit.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkgName)
+	if hasFields {
+		fmt.Fprintf(&src, "import (\n\t\"github.com/niemeyer/qml\"\n\t\"unsafe\"\n)\n\n")
+	} else {
+		fmt.Fprintf(&src, "import \"github.com/niemeyer/qml\"\n\n")
+	}
+	fmt.Fprintf(&src, "func init() {\n%s}\n", buf.Bytes())
+
+	data, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot format generated code: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,317 @@
+package qml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// UndoStack records the changes made to the fields of tracked Go values,
+// whether assigned by QML code or reported by Go code via Changed or
+// SetField, so that they may be undone and redone. Changes made while a
+// macro is open are undone and redone together:
+//
+//     stack := qml.NewUndoStack()
+//     stack.Track(doc, "Title", "Body")
+//     context.SetVar("undoStack", stack)
+//
+//     stack.BeginMacro("Rename")
+//     qml.SetField(doc, "Title", title)
+//     stack.EndMacro()
+//
+// The stack may be made available to QML, so that controls bind to its
+// canUndo and canRedo properties and call its undo and redo methods:
+//
+//     Button { text: "Undo"; enabled: undoStack.canUndo; onClicked: undoStack.undo() }
+//
+// Field values are copied as done by an assignment, so changes made to
+// the content of slices and maps held by fields cannot be undone.
+//
+// The exported fields of UndoStack are updated in the main GUI thread, and
+// are meant to be read by QML. Its methods may be called from any goroutine.
+type UndoStack struct {
+	// CanUndo and CanRedo report whether there are changes to undo
+	// and to redo, respectively.
+	CanUndo bool
+	CanRedo bool
+
+	// UndoText and RedoText hold the name of the changes that Undo and
+	// Redo would act on, which is the macro name for changes made while
+	// a macro was open, and the field name otherwise.
+	UndoText string
+	RedoText string
+
+	// Only accessed from the main GUI thread.
+	tracked map[interface{}][]*undoField
+	done    []*undoCommand
+	undone  []*undoCommand
+	macro   *undoCommand
+	depth   int
+}
+
+// undoField holds a tracked field of a value, and its value as of the
+// last recorded change.
+type undoField struct {
+	name     string
+	offset   uintptr
+	snapshot reflect.Value
+}
+
+// undoCommand holds changes that are undone and redone together.
+type undoCommand struct {
+	name    string
+	changes []undoChange
+}
+
+type undoChange struct {
+	value    interface{}
+	field    *undoField
+	old, new reflect.Value
+}
+
+// undoStacks holds the stacks tracking each value.
+//
+// Only accessed from the main GUI thread.
+var undoStacks = make(map[interface{}][]*UndoStack)
+
+// NewUndoStack returns a new stack with no tracked values.
+func NewUndoStack() *UndoStack {
+	return &UndoStack{tracked: make(map[interface{}][]*undoField)}
+}
+
+// Track starts recording the changes made to the named fields of value,
+// which must be a pointer to a struct. The fields are named as in Go, and
+// all exported fields are tracked if none are named. Tracking a value
+// again replaces the fields tracked for it.
+//
+// Track panics if value has no such fields.
+func (s *UndoStack) Track(value interface{}, fields ...string) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("cannot track changes of %T: not a pointer to a struct", value))
+	}
+	v = v.Elem()
+	if len(fields) == 0 {
+		for i := 0; i < v.NumField(); i++ {
+			if sf := v.Type().Field(i); sf.PkgPath == "" && !sf.Anonymous && sf.Type.Size() > 0 {
+				fields = append(fields, sf.Name)
+			}
+		}
+	}
+	var tracked []*undoField
+	for _, name := range fields {
+		fv := v.FieldByName(name)
+		if !fv.IsValid() || !fv.CanSet() {
+			panic(fmt.Sprintf("cannot track field %q: %T has no such exported field", name, value))
+		}
+		offset := fv.UnsafeAddr() - v.UnsafeAddr()
+		if offset >= v.Type().Size() {
+			panic(fmt.Sprintf("cannot track field %q of %T: reached via an embedded pointer", name, value))
+		}
+		tracked = append(tracked, &undoField{name: name, offset: offset})
+	}
+	gui(func() {
+		for _, field := range tracked {
+			field.snapshot = copyValue(v.FieldByName(field.name))
+		}
+		if _, ok := s.tracked[value]; !ok {
+			undoStacks[value] = append(undoStacks[value], s)
+		}
+		s.tracked[value] = tracked
+	})
+}
+
+// Untrack stops recording the changes made to value. Changes already
+// recorded may still be undone and redone.
+func (s *UndoStack) Untrack(value interface{}) {
+	gui(func() {
+		if _, ok := s.tracked[value]; !ok {
+			return
+		}
+		delete(s.tracked, value)
+		stacks := undoStacks[value]
+		for i, stack := range stacks {
+			if stack == s {
+				stacks = append(stacks[:i], stacks[i+1:]...)
+				break
+			}
+		}
+		if len(stacks) == 0 {
+			delete(undoStacks, value)
+		} else {
+			undoStacks[value] = stacks
+		}
+	})
+}
+
+// BeginMacro opens a macro with the given name, so that the changes
+// recorded until the respective EndMacro call are undone and redone
+// together. Macros may be nested, in which case the changes are grouped
+// under the outermost one.
+func (s *UndoStack) BeginMacro(name string) {
+	gui(func() {
+		if s.depth == 0 {
+			s.macro = &undoCommand{name: name}
+		}
+		s.depth++
+	})
+}
+
+// EndMacro closes the macro opened by the last BeginMacro call.
+//
+// EndMacro panics if there's no open macro.
+func (s *UndoStack) EndMacro() {
+	var open bool
+	gui(func() {
+		if open = s.depth > 0; !open {
+			return
+		}
+		s.depth--
+		if s.depth == 0 {
+			macro := s.macro
+			s.macro = nil
+			if len(macro.changes) > 0 {
+				s.push(macro)
+			}
+		}
+	})
+	if !open {
+		panic("qml.UndoStack.EndMacro called without an open macro")
+	}
+}
+
+// Undo reverts the last recorded changes not yet undone, if any, and
+// reports them to QML as done by Changed.
+func (s *UndoStack) Undo() {
+	gui(func() {
+		if len(s.done) == 0 || s.depth > 0 {
+			return
+		}
+		cmd := s.done[len(s.done)-1]
+		s.done = s.done[:len(s.done)-1]
+		for i := len(cmd.changes) - 1; i >= 0; i-- {
+			cmd.changes[i].apply(cmd.changes[i].old)
+		}
+		s.undone = append(s.undone, cmd)
+		s.update()
+	})
+}
+
+// Redo reapplies the last changes reverted by Undo, if any, and reports
+// them to QML as done by Changed. Redo has no effect once new changes
+// are recorded after the changes were undone.
+func (s *UndoStack) Redo() {
+	gui(func() {
+		if len(s.undone) == 0 || s.depth > 0 {
+			return
+		}
+		cmd := s.undone[len(s.undone)-1]
+		s.undone = s.undone[:len(s.undone)-1]
+		for _, change := range cmd.changes {
+			change.apply(change.new)
+		}
+		s.done = append(s.done, cmd)
+		s.update()
+	})
+}
+
+// Clear discards all the changes recorded so far.
+func (s *UndoStack) Clear() {
+	gui(func() {
+		s.done = nil
+		s.undone = nil
+		s.update()
+	})
+}
+
+// apply sets the changed field to v, and reports the change to QML. The
+// snapshot is updated first, so that the stacks tracking the value don't
+// record it as a new change.
+//
+// This must be run from the main GUI thread.
+func (change *undoChange) apply(v reflect.Value) {
+	fv := reflect.ValueOf(change.value).Elem().FieldByName(change.field.name)
+	fv.Set(v)
+	for _, stack := range undoStacks[change.value] {
+		for _, field := range stack.tracked[change.value] {
+			if field.offset == change.field.offset {
+				field.snapshot = copyValue(fv)
+			}
+		}
+	}
+	Changed(change.value, fv.Addr().Interface())
+}
+
+// push records cmd as the last change made, discarding the changes that
+// were undone.
+//
+// This must be run from the main GUI thread.
+func (s *UndoStack) push(cmd *undoCommand) {
+	s.done = append(s.done, cmd)
+	s.undone = nil
+	s.update()
+}
+
+// update refreshes the exported fields of the stack, and reports to QML
+// the ones that changed.
+//
+// This must be run from the main GUI thread.
+func (s *UndoStack) update() {
+	canUndo, canRedo := len(s.done) > 0, len(s.undone) > 0
+	var undoText, redoText string
+	if canUndo {
+		undoText = s.done[len(s.done)-1].name
+	}
+	if canRedo {
+		redoText = s.undone[len(s.undone)-1].name
+	}
+	if s.CanUndo != canUndo {
+		s.CanUndo = canUndo
+		Changed(s, &s.CanUndo)
+	}
+	if s.CanRedo != canRedo {
+		s.CanRedo = canRedo
+		Changed(s, &s.CanRedo)
+	}
+	if s.UndoText != undoText {
+		s.UndoText = undoText
+		Changed(s, &s.UndoText)
+	}
+	if s.RedoText != redoText {
+		s.RedoText = redoText
+		Changed(s, &s.RedoText)
+	}
+}
+
+// observeUndo records the change made to the field at offset of value in
+// the stacks tracking it, if the field value differs from the one last
+// recorded.
+//
+// This must be run from the main GUI thread.
+func observeUndo(value interface{}, offset uintptr) {
+	for _, stack := range undoStacks[value] {
+		for _, field := range stack.tracked[value] {
+			if field.offset != offset {
+				continue
+			}
+			fv := reflect.ValueOf(value).Elem().FieldByName(field.name)
+			if reflect.DeepEqual(fv.Interface(), field.snapshot.Interface()) {
+				continue
+			}
+			change := undoChange{value: value, field: field, old: field.snapshot, new: copyValue(fv)}
+			field.snapshot = change.new
+			if stack.macro != nil {
+				stack.macro.changes = append(stack.macro.changes, change)
+			} else {
+				stack.push(&undoCommand{name: field.name, changes: []undoChange{change}})
+			}
+		}
+	}
+}
+
+// copyValue returns a copy of v held in a new variable, so that it isn't
+// changed with v.
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
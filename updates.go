@@ -0,0 +1,177 @@
+package qml
+
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"log"
+	"time"
+	"unsafe"
+)
+
+// DefaultUpdatesTimeout is the time after which rendering of a window is
+// resumed if EndUpdates isn't called, unless changed via
+// Window.SetUpdatesTimeout.
+const DefaultUpdatesTimeout = 5 * time.Second
+
+// updateBlock holds the state of a window regarding the suspension of
+// its rendering via BeginUpdates.
+type updateBlock struct {
+	blocker unsafe.Pointer
+	depth   int
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// updateBlocks holds the update state of windows, until their blocker
+// is destroyed together with them.
+//
+// Only accessed from the main GUI thread.
+var updateBlocks = make(map[unsafe.Pointer]*updateBlock)
+
+// updates returns the update state of win, creating it if necessary.
+//
+// This must be run from the main GUI thread.
+func (win *Window) updates() *updateBlock {
+	addr := win.obj.addr
+	block, ok := updateBlocks[addr]
+	if !ok {
+		block = &updateBlock{
+			blocker: C.viewInstallUpdateBlocker(addr),
+			timeout: DefaultUpdatesTimeout,
+		}
+		updateBlocks[addr] = block
+	}
+	return block
+}
+
+// BeginUpdates suspends rendering of the window until a matching call to
+// EndUpdates, so that a batch of changes to its scene, such as objects
+// being created, destroyed, or having properties set, is shown at once
+// rather than piecemeal, and rendered a single time:
+//
+//     win.BeginUpdates()
+//     defer win.EndUpdates()
+//     for _, item := range items {
+//         item.Set("x", x)
+//     }
+//
+// While suspended, the scene graph of the window is neither synchronized
+// with its items nor rendered, whatever render loop Qt uses, and Snapshot
+// reports an error. Calls may be nested, and rendering is resumed when
+// the outermost one ends. If that doesn't happen within the duration set
+// via SetUpdatesTimeout, rendering is resumed anyway and a warning
+// logged, so that a missing call doesn't leave the window frozen. See
+// also BatchUpdates, which resumes rendering even if the batch panics.
+func (win *Window) BeginUpdates() {
+	gui(func() {
+		block := win.updates()
+		block.depth++
+		if block.depth > 1 {
+			return
+		}
+		C.updateBlockerSuspend(block.blocker)
+		if block.timeout <= 0 {
+			return
+		}
+		addr, timeout := win.obj.addr, block.timeout
+		var timer *time.Timer
+		timer = time.AfterFunc(timeout, func() {
+			gui(func() {
+				if updateBlocks[addr] == block && block.timer == timer {
+					log.Printf("qml: window updates not ended within %v; resuming rendering", timeout)
+					block.resume(true)
+				}
+			})
+		})
+		block.timer = timer
+	})
+}
+
+// EndUpdates ends the updates started by the matching call to
+// BeginUpdates and, once the outermost updates end, renders the window
+// a single time with all changes made meanwhile. Calls without a
+// matching BeginUpdates, such as ones made after rendering was resumed
+// due to the timeout, have no effect.
+func (win *Window) EndUpdates() {
+	gui(func() {
+		block, ok := updateBlocks[win.obj.addr]
+		if !ok || block.depth == 0 {
+			return
+		}
+		block.depth--
+		if block.depth == 0 {
+			block.resume(true)
+		}
+	})
+}
+
+// BatchUpdates calls f with rendering of the window suspended, as done
+// by BeginUpdates, and resumes it when f returns or panics.
+func (win *Window) BatchUpdates(f func()) {
+	win.BeginUpdates()
+	defer win.EndUpdates()
+	f()
+}
+
+// UpdatesSuspended returns whether rendering of the window is currently
+// suspended via BeginUpdates.
+func (win *Window) UpdatesSuspended() bool {
+	var suspended bool
+	gui(func() {
+		block, ok := updateBlocks[win.obj.addr]
+		suspended = ok && block.depth > 0
+	})
+	return suspended
+}
+
+// SetUpdatesTimeout sets the duration after which rendering of the window
+// is resumed if the outermost BeginUpdates isn't ended by then. Updates
+// already started keep the timeout they started with. A zero or negative
+// duration disables the timeout. It defaults to DefaultUpdatesTimeout.
+func (win *Window) SetUpdatesTimeout(timeout time.Duration) {
+	gui(func() {
+		win.updates().timeout = timeout
+	})
+}
+
+// resume resumes rendering, rendering the window once if render is set.
+//
+// This must be run from the main GUI thread.
+func (block *updateBlock) resume(render bool) {
+	block.depth = 0
+	if block.timer != nil {
+		block.timer.Stop()
+		block.timer = nil
+	}
+	var crender C.int
+	if render {
+		crender = 1
+	}
+	C.updateBlockerResume(block.blocker, crender)
+}
+
+// resumeUpdates resumes rendering of the window at addr without
+// rendering it, so that it may be deleted.
+//
+// This must be run from the main GUI thread.
+func resumeUpdates(addr unsafe.Pointer) {
+	if block, ok := updateBlocks[addr]; ok && block.depth > 0 {
+		block.resume(false)
+	}
+}
+
+//export hookUpdateBlockerDestroyed
+func hookUpdateBlockerDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookUpdateBlockerDestroyed") {
+		gui(func() { hookUpdateBlockerDestroyed(addr) })
+		return
+	}
+	if block, ok := updateBlocks[addr]; ok {
+		if block.timer != nil {
+			block.timer.Stop()
+		}
+		delete(updateBlocks, addr)
+	}
+}
@@ -0,0 +1,91 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"unsafe"
+)
+
+// ValidationState is the result of validating user input.
+// See NewValidator for details.
+type ValidationState int
+
+const (
+	Invalid ValidationState = iota
+	Intermediate
+	Acceptable
+)
+
+// ValidateFunc validates the user input in a text field. The pos parameter
+// holds the cursor position as a byte offset into input. The function
+// returns the validation state, and the input and cursor position that
+// should replace the ones provided, which enables fixing up the input
+// while the user types.
+type ValidateFunc func(input string, pos int) (state ValidationState, fixed string, newPos int)
+
+type validator struct {
+	validate ValidateFunc
+}
+
+// validators holds the validators alive until their C++ counterpart
+// is destroyed, since the latter only holds an unsafe reference.
+var validators = make(map[*validator]bool)
+
+// NewValidator returns an object that may be assigned to the validator
+// property of QML text input elements, such as TextInput, and that uses
+// the validate function to decide whether the user input is acceptable.
+//
+// The validate function runs in the main GUI thread once per keystroke,
+// so it must not block and must not call back into blocking functionality
+// of the qml package.
+//
+// The returned object is not owned by any engine, and its Destroy method
+// must be called once it is not necessary anymore.
+func NewValidator(validate ValidateFunc) *Object {
+	v := &validator{validate}
+	var obj *Object
+	gui(func() {
+		validators[v] = true
+		obj = wrapObject(C.newValidator(unsafe.Pointer(v)), nil)
+	})
+	return obj
+}
+
+//export hookValidatorValidate
+func hookValidatorValidate(addr unsafe.Pointer, cinput *C.char, cinputLen C.int, cpos *C.int, cfixed **C.char, cfixedLen *C.int) C.int {
+	if !onGuiThread("hookValidatorValidate") {
+		var state C.int
+		gui(func() { state = hookValidatorValidate(addr, cinput, cinputLen, cpos, cfixed, cfixedLen) })
+		return state
+	}
+	v := (*validator)(addr)
+	input := C.GoStringN(cinput, cinputLen)
+	state, fixed, pos := v.validate(input, int(*cpos))
+	if pos < 0 {
+		pos = 0
+	}
+	if fixed != input {
+		if pos > len(fixed) {
+			pos = len(fixed)
+		}
+		*cfixed = C.CString(fixed)
+		*cfixedLen = C.int(len(fixed))
+	} else if pos > len(input) {
+		pos = len(input)
+	}
+	*cpos = C.int(pos)
+	return C.int(state)
+}
+
+//export hookValidatorDestroyed
+func hookValidatorDestroyed(addr unsafe.Pointer) {
+	if !onGuiThread("hookValidatorDestroyed") {
+		gui(func() { hookValidatorDestroyed(addr) })
+		return
+	}
+	delete(validators, (*validator)(addr))
+}
@@ -0,0 +1,208 @@
+package qml
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// guiCurrent holds the entry point of the function being run in the main
+// GUI thread on behalf of a gui call, or zero if there's none, so that
+// watchdogs may report what the thread is busy with.
+var guiCurrent uintptr
+
+// StallReport describes the state of the main GUI thread when it was
+// found to be stalled by a watchdog. See StartWatchdog.
+type StallReport struct {
+	// Stalled is how long the heartbeat has been waiting for the main
+	// GUI thread when the report was made.
+	Stalled time.Duration
+
+	// Pending is the number of goroutines other than the watchdog itself
+	// that are waiting for the main GUI thread to run a function for them.
+	Pending int
+
+	// Operation is the name of the function being run in the main GUI
+	// thread on behalf of a goroutine, such as one provided to RunMain
+	// or a closure within a package method, or empty if the thread is not
+	// running one, which is the case when it's stuck handling Qt events or
+	// running QML code.
+	Operation string
+
+	// Stacks holds the stack traces of all goroutines, as formatted by
+	// runtime.Stack.
+	Stacks []byte
+}
+
+// Watchdog detects stalls of the main GUI thread. See StartWatchdog.
+type Watchdog struct {
+	interval  time.Duration
+	threshold time.Duration
+	onStall   func(report StallReport)
+	callbacks callbackQueue
+	stop      chan bool
+
+	mutex    sync.Mutex
+	onResume func(stalled time.Duration)
+	refire   time.Duration
+	stopped  bool
+}
+
+// StartWatchdog starts sending a heartbeat through the main GUI thread
+// every interval, and calls onStall with a report of the state of the
+// thread whenever a heartbeat waits for longer than threshold, so that
+// frozen user interfaces in production may be diagnosed:
+//
+//     qml.StartWatchdog(time.Second, 5*time.Second, func(r qml.StallReport) {
+//         log.Printf("GUI stalled for %v running %q:\n%s", r.Stalled, r.Operation, r.Stacks)
+//     })
+//
+// A single report is made per stall, however long it lasts, and once the
+// thread resumes no further reports are made until the refire interval
+// set via SetRefireInterval elapses, so that long legitimate operations
+// run in a row don't flood onStall with reports.
+//
+// The callbacks are called in order within a goroutine owned by the
+// package, and may use the qml package, although doing so blocks until
+// the stall is over. The Stop method must be called once the watchdog is
+// not necessary anymore.
+func StartWatchdog(interval, threshold time.Duration, onStall func(report StallReport)) *Watchdog {
+	w := &Watchdog{
+		interval:  interval,
+		threshold: threshold,
+		onStall:   onStall,
+		refire:    threshold,
+		stop:      make(chan bool),
+	}
+	go w.run()
+	return w
+}
+
+// OnResume arranges for f to be called with the overall duration of a
+// stall once the main GUI thread recovers from a stall that was reported.
+func (w *Watchdog) OnResume(f func(stalled time.Duration)) {
+	w.mutex.Lock()
+	w.onResume = f
+	w.mutex.Unlock()
+}
+
+// SetRefireInterval sets the minimum interval between the start of a
+// reported stall and the next report. It defaults to the watchdog
+// threshold.
+func (w *Watchdog) SetRefireInterval(d time.Duration) {
+	w.mutex.Lock()
+	w.refire = d
+	w.mutex.Unlock()
+}
+
+// Stop stops sending heartbeats. Callbacks already due may still be
+// called after Stop returns.
+func (w *Watchdog) Stop() {
+	w.mutex.Lock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.stop)
+	}
+	w.mutex.Unlock()
+}
+
+// run sends heartbeats through the main GUI thread until the watchdog is
+// stopped or the thread dies.
+func (w *Watchdog) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	var lastReport time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		case <-guiDead:
+			return
+		}
+
+		sent := time.Now()
+		beat := make(chan bool)
+		go heartbeat(beat)
+
+		timer := time.NewTimer(w.threshold)
+		reported := false
+		select {
+		case <-beat:
+		case <-timer.C:
+			w.mutex.Lock()
+			refire := w.refire
+			w.mutex.Unlock()
+			if lastReport.IsZero() || sent.Sub(lastReport) >= refire {
+				lastReport = sent
+				reported = true
+				report := stallReport(time.Since(sent))
+				w.callbacks.dispatch(func() { w.onStall(report) })
+			}
+			select {
+			case <-beat:
+			case <-w.stop:
+				return
+			case <-guiDead:
+				return
+			}
+		case <-w.stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+
+		if reported {
+			stalled := time.Since(sent)
+			w.mutex.Lock()
+			onResume := w.onResume
+			w.mutex.Unlock()
+			if onResume != nil {
+				w.callbacks.dispatch(func() { onResume(stalled) })
+			}
+		}
+	}
+}
+
+// heartbeat runs an empty function in the main GUI thread, and closes
+// beat once it's done.
+func heartbeat(beat chan bool) {
+	defer func() {
+		recover()
+		close(beat)
+	}()
+	gui(func() {})
+}
+
+// stallReport returns a report of the current state of the main GUI thread.
+func stallReport(stalled time.Duration) StallReport {
+	report := StallReport{Stalled: stalled}
+	// Discount the heartbeat of the watchdog itself.
+	report.Pending = int(atomic.LoadInt32((*int32)(unsafe.Pointer(&hookWaiting)))) - 1
+	if report.Pending < 0 {
+		report.Pending = 0
+	}
+	if pc := atomic.LoadUintptr(&guiCurrent); pc != 0 {
+		if f := runtime.FuncForPC(pc); f != nil {
+			report.Operation = f.Name()
+		}
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			report.Stacks = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	return report
+}
+
+// funcEntry returns the entry point of f, as recorded in guiCurrent.
+func funcEntry(f func()) uintptr {
+	return reflect.ValueOf(f).Pointer()
+}
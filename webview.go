@@ -0,0 +1,173 @@
+package qml
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/niemeyer/qml/tref"
+)
+
+// WebView provides access to the page shown by a WebEngineView element
+// of the QtWebEngine module, so that Go code may exchange messages with
+// the JavaScript code of the page. See NewWebView.
+type WebView struct {
+	view   *Object
+	helper *Object
+
+	mutex   sync.Mutex
+	lastID  int
+	pending map[int]chan webResult
+}
+
+type webResult struct {
+	value interface{}
+	err   error
+}
+
+// webViewHelper is the QML document of the object that holds the web
+// channel of a view, and runs scripts in its page on behalf of Go.
+// Scripts are run by eval so that exceptions are reported rather than
+// turned into an undefined result.
+const webViewHelper = `
+import QtQuick 2.0
+import QtWebChannel 1.0
+
+Item {
+    visible: false
+
+    property var view
+    property var objects: ({})
+    property WebChannel channel: WebChannel {}
+
+    signal finished(int id, var result)
+
+    function attach(target) {
+        if (!target || typeof target.runJavaScript !== "function" || !("webChannel" in target)) {
+            return false
+        }
+        view = target
+        view.webChannel = channel
+        return true
+    }
+
+    function register(name, object) {
+        objects[name] = object
+        channel.registerObject(name, object)
+    }
+
+    function run(id, script) {
+        var wrapped = "(function() { try { return {ok: true, value: eval(" + JSON.stringify(script) + ")} } " +
+            "catch (e) { return {ok: false, error: String(e)} } })()"
+        view.runJavaScript(wrapped, function(result) { finished(id, result) })
+    }
+}
+`
+
+// NewWebView returns a WebView for the page shown by view, which must
+// be a WebEngineView element:
+//
+//     web, err := qml.NewWebView(root.ObjectByName("browser"))
+//     if err != nil {
+//         return err
+//     }
+//     web.RegisterObject("backend", &Backend{})
+//     title, err := web.RunJavaScript("document.title")
+//
+// The QtWebEngine and QtWebChannel modules are only looked up at run
+// time, so applications using this package run on systems that lack
+// them. NewWebView returns ErrUnsupported in that case.
+func NewWebView(view *Object) (*WebView, error) {
+	view.assertLive()
+	if view.engine == nil {
+		return nil, errors.New("cannot use web view: object has no engine")
+	}
+	component, err := view.engine.LoadString("webview.qml", webViewHelper)
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	helper := component.Create(nil)
+	component.Destroy()
+	if attached, _ := helper.Call("attach", view).(bool); !attached {
+		helper.Destroy()
+		return nil, errors.New("cannot use web view: object is not a WebEngineView")
+	}
+	// Destroyed together with the view.
+	if err := helper.SetParentItem(view); err != nil {
+		helper.Destroy()
+		return nil, fmt.Errorf("cannot use web view: %v", err)
+	}
+	web := &WebView{view: view, helper: helper, pending: make(map[int]chan webResult)}
+	helper.ConnectInline("finished", web.finished)
+	return web, nil
+}
+
+// RegisterObject makes value available to the JavaScript code of the
+// page under the given name via the web channel of the view, as done by
+// Context.SetVar for QML code. The page accesses the object via the
+// qwebchannel.js library shipped with Qt:
+//
+//     new QWebChannel(qt.webChannelTransport, function(channel) {
+//         channel.objects.backend.save(text, function(result) { ... })
+//     })
+//
+// As the page runs in a separate process, method results are delivered
+// to callbacks rather than returned, and property changes notified via
+// Changed are reflected in the page asynchronously.
+func (web *WebView) RegisterObject(name string, value interface{}) {
+	web.helper.Call("register", name, value)
+}
+
+// RunJavaScript runs script in the page shown by the view, and returns
+// the value of its last statement converted as done for values obtained
+// from QML, or an error holding the exception thrown by script.
+// RunJavaScript panics if called from within the main GUI thread, as
+// the result is delivered by it.
+func (web *WebView) RunJavaScript(script string) (interface{}, error) {
+	if tref.Ref() == guiLoopRef {
+		panic("cannot run JavaScript in web page from within the main GUI thread")
+	}
+	done := make(chan webResult, 1)
+	web.mutex.Lock()
+	web.lastID++
+	id := web.lastID
+	web.pending[id] = done
+	web.mutex.Unlock()
+
+	web.helper.Call("run", id, script)
+	result := <-done
+	return result.value, result.err
+}
+
+// finished delivers the result of the script run with the given id.
+func (web *WebView) finished(id int, result interface{}) {
+	web.mutex.Lock()
+	done, ok := web.pending[id]
+	delete(web.pending, id)
+	web.mutex.Unlock()
+	if !ok {
+		return
+	}
+	outcome, _ := result.(map[string]interface{})
+	switch {
+	case outcome == nil:
+		done <- webResult{err: errors.New("cannot run JavaScript in web page: page is not loaded")}
+	case outcome["ok"] == true:
+		done <- webResult{value: outcome["value"]}
+	default:
+		done <- webResult{err: fmt.Errorf("JavaScript error in web page: %v", outcome["error"])}
+	}
+}
+
+// Close detaches the view from Go, so that registered objects are not
+// available to the page anymore. Pending calls to RunJavaScript return
+// an error.
+func (web *WebView) Close() {
+	web.helper.Destroy()
+	web.mutex.Lock()
+	for id, done := range web.pending {
+		delete(web.pending, id)
+		done <- webResult{err: errors.New("cannot run JavaScript in web page: web view closed")}
+	}
+	web.mutex.Unlock()
+}
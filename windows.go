@@ -0,0 +1,149 @@
+package qml
+
+// #include <stdlib.h>
+//
+// #include "capi.h"
+//
+import "C"
+
+import (
+	"unsafe"
+)
+
+// adoptedWindows holds the values representing windows created by QML
+// code, such as via Window elements, which were handed out by Windows
+// or OnFocusWindowChanged.
+//
+// Only accessed from the main GUI thread.
+var adoptedWindows = make(map[unsafe.Pointer]*Window)
+
+// focusWindowChanged holds the function registered via OnFocusWindowChanged.
+//
+// Only accessed from the main GUI thread.
+var (
+	focusWindowChanged func(win *Window)
+	focusWindowQueue   callbackQueue
+	focusWindowWatched bool
+)
+
+// Windows returns the top-level windows of the application that render
+// QML content, in the order they were created. That includes windows
+// created via CreateWindow and NewWindow, and windows created by QML code
+// itself, such as those defined with Window elements, which may be
+// inspected and driven from Go like any other window:
+//
+//     for _, win := range qml.Windows() {
+//         if win.Root().String("objectName") == "preferences" {
+//             win.RequestActivate()
+//         }
+//     }
+//
+// Windows created by QML code are not owned by Go, so they may not be
+// recreated via Recreate, and they are destroyed together with the
+// objects that created them.
+func Windows() []*Window {
+	var result []*Window
+	gui(func() {
+		var clen C.int
+		caddrs := C.applicationWindows(&clen)
+		live := make(map[unsafe.Pointer]bool, int(clen))
+		for i := 0; i < int(clen); i++ {
+			addr := *(*unsafe.Pointer)(unsafe.Pointer(uintptr(unsafe.Pointer(caddrs)) + uintptr(i)*unsafe.Sizeof(nilPtr)))
+			live[addr] = true
+			result = append(result, windowFor(addr))
+		}
+		if caddrs != nil {
+			C.free(unsafe.Pointer(caddrs))
+		}
+		for addr := range adoptedWindows {
+			if !live[addr] {
+				delete(adoptedWindows, addr)
+			}
+		}
+	})
+	return result
+}
+
+// windowFor returns the value representing the window at addr, adopting
+// the window if it was not created via Go.
+//
+// This must be run from the main GUI thread.
+func windowFor(addr unsafe.Pointer) *Window {
+	for _, win := range windows {
+		if win.obj.addr == addr {
+			return win
+		}
+	}
+	win, ok := adoptedWindows[addr]
+	if !ok {
+		win = &Window{}
+		win.obj.addr = addr
+		adoptedWindows[addr] = win
+	}
+	// The engine is looked up every time, as the window may outlive the
+	// one it was first seen with, and its address be reused.
+	win.obj.engine = engines[C.viewEngine(addr)]
+	return win
+}
+
+// Raise raises the window above other windows of the application.
+func (win *Window) Raise() {
+	gui(func() {
+		C.viewRaise(win.obj.addr)
+	})
+}
+
+// RequestActivate requests the window to be activated, so that it
+// receives keyboard input. The window system may refuse the request,
+// such as to prevent focus stealing, so the outcome is only known once
+// IsActive reports it or the function registered via OnFocusWindowChanged
+// is called.
+func (win *Window) RequestActivate() {
+	gui(func() {
+		C.viewRequestActivate(win.obj.addr)
+	})
+}
+
+// IsActive returns whether the window is the active window of the
+// application, which receives keyboard input.
+func (win *Window) IsActive() bool {
+	var active C.int
+	gui(func() {
+		active = C.viewIsActive(win.obj.addr)
+	})
+	return active != 0
+}
+
+// OnFocusWindowChanged registers f to be called whenever the window of
+// the application that receives keyboard input changes, replacing any
+// function previously registered. The window is nil when no window
+// rendering QML content has the focus anymore, such as when another
+// application is activated. If f is nil, changes are not reported
+// anymore. The function is called in a goroutine owned by the package.
+// See the Callbacks section of the package documentation.
+func OnFocusWindowChanged(f func(win *Window)) {
+	gui(func() {
+		focusWindowChanged = f
+		if !focusWindowWatched {
+			focusWindowWatched = true
+			C.applicationWatchFocusWindow()
+		}
+	})
+}
+
+//export hookFocusWindowChanged
+func hookFocusWindowChanged(addr unsafe.Pointer) {
+	if !onGuiThread("hookFocusWindowChanged") {
+		gui(func() { hookFocusWindowChanged(addr) })
+		return
+	}
+	f := focusWindowChanged
+	if f == nil {
+		return
+	}
+	var win *Window
+	if addr != nilPtr {
+		win = windowFor(addr)
+	}
+	focusWindowQueue.dispatch(func() { f(win) })
+}